@@ -0,0 +1,191 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// PermissionPolicy decides an agent's tool permission requests.
+//
+// Deny is checked first, then Allow, then Decide. A request matching neither
+// list is denied when Decide is nil. Entries match canonical tool names exactly,
+// or by prefix when they end in "*" (e.g. "mcp__github__*").
+type PermissionPolicy struct {
+	Allow  []string             // Tools allowed without asking
+	Deny   []string             // Tools that are always denied
+	Decide types.CanUseToolFunc // Consulted for tools matching neither list
+}
+
+// CanUseTool returns the policy as a permission callback. The callback does
+// not observe later changes to the policy.
+func (p PermissionPolicy) CanUseTool() types.CanUseToolFunc {
+	allow, deny, decide := slices.Clone(p.Allow), slices.Clone(p.Deny), p.Decide
+
+	return func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+		if matchesToolPattern(deny, toolName) {
+			return types.PermissionResultDeny{Behavior: "deny", Message: fmt.Sprintf("%s is denied by policy", toolName)}, nil
+		}
+		if matchesToolPattern(allow, toolName) {
+			return types.PermissionResultAllow{Behavior: "allow"}, nil
+		}
+		if decide != nil {
+			return decide(ctx, toolName, input, permCtx)
+		}
+		return types.PermissionResultDeny{Behavior: "deny", Message: fmt.Sprintf("%s is not allowed by policy", toolName)}, nil
+	}
+}
+
+// matchesToolPattern reports whether toolName matches an exact name or "prefix*" pattern.
+func matchesToolPattern(patterns []string, toolName string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(toolName, prefix) {
+				return true
+			}
+		} else if pattern == toolName {
+			return true
+		}
+	}
+	return false
+}
+
+// AgentSpec describes a reusable agent.
+type AgentSpec struct {
+	Name    string                    // Identifies the agent in transcripts
+	Options *types.ClaudeAgentOptions // Base options (nil uses defaults); copied by NewAgent
+
+	// Policy handles tool permission requests. Nil leaves permissions to the
+	// permission mode and any CanUseTool set in Options.
+	Policy *PermissionPolicy
+
+	// Hooks are registered in addition to any hooks in Options.
+	Hooks map[types.HookEvent][]types.HookMatcher
+
+	// Transcript, when set, records every turn run with Agent.Run.
+	Transcript *Transcript
+
+	// OnTurn, when set, receives a summary of every turn run with Agent.Run,
+	// including failed ones. It may be called concurrently.
+	OnTurn func(agent string, summary TurnSummary)
+}
+
+// AgentOverride adjusts the options of a single run. It receives a private
+// copy of the agent's options, so it may modify them freely.
+type AgentOverride func(opts *types.ClaudeAgentOptions)
+
+// Agent couples options, a permission policy, hooks and transcript recording
+// into one reusable unit.
+//
+// Agents are immutable once created and safe to share between goroutines: every
+// Run and Session works on its own copy of the options.
+//
+// Example:
+//
+//	reviewer, err := claude.NewAgent(claude.AgentSpec{
+//	    Name: "reviewer",
+//	    Options: types.NewClaudeAgentOptions().
+//	        WithSystemPrompt("You review Go code for correctness.").
+//	        WithModel("claude-sonnet-4-5"),
+//	    Policy: &claude.PermissionPolicy{Allow: []string{"Read", "Grep", "Glob"}},
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//
+//	turn, err := reviewer.Run(ctx, "Review client.go")
+type Agent struct {
+	name       string
+	options    *types.ClaudeAgentOptions // composed at creation, never modified
+	transcript *Transcript
+	onTurn     func(agent string, summary TurnSummary)
+}
+
+// NewAgent creates an Agent from a spec. The spec's options, policy and hooks
+// are copied, so later changes to them do not affect the agent.
+func NewAgent(spec AgentSpec) (*Agent, error) {
+	options := spec.Options.Clone()
+	if options == nil {
+		options = types.NewClaudeAgentOptions()
+	}
+
+	if spec.Policy != nil {
+		if options.CanUseTool != nil {
+			return nil, fmt.Errorf("agent %q: Policy cannot be combined with Options.CanUseTool", spec.Name)
+		}
+		options.CanUseTool = spec.Policy.CanUseTool()
+	}
+	for event, matchers := range spec.Hooks {
+		for _, matcher := range matchers {
+			options.WithHook(event, matcher)
+		}
+	}
+
+	return &Agent{
+		name:       spec.Name,
+		options:    options,
+		transcript: spec.Transcript,
+		onTurn:     spec.OnTurn,
+	}, nil
+}
+
+// Name returns the agent's name.
+func (a *Agent) Name() string {
+	return a.name
+}
+
+// Options returns a copy of the agent's options with the policy and hooks
+// applied, followed by any overrides.
+func (a *Agent) Options(overrides ...AgentOverride) *types.ClaudeAgentOptions {
+	options := a.options.Clone()
+	for _, override := range overrides {
+		override(options)
+	}
+	return options
+}
+
+// Run sends a single prompt on a new connection and returns the completed turn.
+//
+// The returned error is the turn's Err (see TurnResult), or the connection error
+// if the CLI could not be started. The turn is recorded in the agent's transcript
+// and reported to OnTurn even when it fails.
+func (a *Agent) Run(ctx context.Context, prompt string, overrides ...AgentOverride) (TurnResult, error) {
+	client, err := a.Session(ctx, overrides...)
+	if err != nil {
+		return TurnResult{Prompt: prompt, Err: err}, err
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+
+	started := time.Now()
+	turn := runScriptTurn(ctx, client, prompt, client.options)
+
+	if a.transcript != nil {
+		a.transcript.Record(TranscriptTurn{Agent: a.name, Prompt: prompt, Messages: turn.Messages, Started: started})
+	}
+	if a.onTurn != nil {
+		summary, _ := Summarize(turn.Messages)
+		summary.Refused = turn.Refused // Detected with the agent's classifier
+		a.onTurn(a.name, summary)
+	}
+	return turn, turn.Err
+}
+
+// Session returns a connected Client configured with the agent's options and
+// any overrides. The caller owns the Client and must Close it. Turns sent on a
+// session are not recorded in the agent's transcript.
+func (a *Agent) Session(ctx context.Context, overrides ...AgentOverride) (*Client, error) {
+	client, err := NewClient(ctx, a.Options(overrides...))
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
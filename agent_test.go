@@ -0,0 +1,208 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestPermissionPolicy(t *testing.T) {
+	decided := ""
+	policy := PermissionPolicy{
+		Allow: []string{"Read", "mcp__docs__*"},
+		Deny:  []string{"Bash", "mcp__docs__delete"},
+		Decide: func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+			decided = toolName
+			return types.PermissionResultAllow{Behavior: "allow"}, nil
+		},
+	}
+	canUseTool := policy.CanUseTool()
+	policy.Allow[0] = "Bash" // later changes must not affect the callback
+
+	tests := []struct {
+		tool      string
+		wantAllow bool
+		decided   bool
+	}{
+		{"Read", true, false},
+		{"Bash", false, false},
+		{"mcp__docs__search", true, false},
+		{"mcp__docs__delete", false, false},
+		{"Write", true, true},
+	}
+	for _, tt := range tests {
+		decided = ""
+		result, err := canUseTool(context.Background(), tt.tool, nil, types.ToolPermissionContext{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.tool, err)
+		}
+		_, allowed := result.(types.PermissionResultAllow)
+		if allowed != tt.wantAllow {
+			t.Errorf("%s: got %#v, want allow=%v", tt.tool, result, tt.wantAllow)
+		}
+		if (decided == tt.tool) != tt.decided {
+			t.Errorf("%s: Decide called = %v, want %v", tt.tool, decided == tt.tool, tt.decided)
+		}
+	}
+
+	result, _ := PermissionPolicy{Allow: []string{"Read"}}.CanUseTool()(context.Background(), "Write", nil, types.ToolPermissionContext{})
+	if _, ok := result.(types.PermissionResultDeny); !ok {
+		t.Errorf("unlisted tool without Decide: got %#v, want deny", result)
+	}
+}
+
+func TestNewAgent_OptionComposition(t *testing.T) {
+	noop := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		return nil, nil
+	}
+	base := types.NewClaudeAgentOptions().
+		WithModel("base-model").
+		WithEnvVar("TEAM", "docs").
+		WithHook(types.HookEventPreToolUse, types.HookMatcher{Hooks: []types.HookCallbackFunc{noop}})
+
+	agent, err := NewAgent(AgentSpec{
+		Name:    "docs",
+		Options: base,
+		Policy:  &PermissionPolicy{Allow: []string{"Read"}},
+		Hooks: map[types.HookEvent][]types.HookMatcher{
+			types.HookEventPreToolUse:  {{Hooks: []types.HookCallbackFunc{noop}}},
+			types.HookEventPostToolUse: {{Hooks: []types.HookCallbackFunc{noop}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+	if agent.Name() != "docs" {
+		t.Errorf("Name() = %q", agent.Name())
+	}
+
+	opts := agent.Options(func(o *types.ClaudeAgentOptions) {
+		o.WithModel("override-model").WithEnvVar("TEAM", "review")
+	})
+	if opts.CanUseTool == nil {
+		t.Error("policy should set CanUseTool")
+	}
+	if got := len(opts.Hooks[types.HookEventPreToolUse]); got != 2 {
+		t.Errorf("PreToolUse matchers = %d, want base and spec hooks (2)", got)
+	}
+	if got := len(opts.Hooks[types.HookEventPostToolUse]); got != 1 {
+		t.Errorf("PostToolUse matchers = %d, want 1", got)
+	}
+	if *opts.Model != "override-model" || opts.Env["TEAM"] != "review" {
+		t.Errorf("override not applied: model %q, env %v", *opts.Model, opts.Env)
+	}
+
+	// Neither the base options nor the agent see the override
+	if base.CanUseTool != nil || len(base.Hooks[types.HookEventPreToolUse]) != 1 || base.Env["TEAM"] != "docs" {
+		t.Error("NewAgent modified the spec's options")
+	}
+	if again := agent.Options(); *again.Model != "base-model" || again.Env["TEAM"] != "docs" {
+		t.Errorf("override leaked into the agent: model %q, env %v", *again.Model, again.Env)
+	}
+}
+
+func TestNewAgent_PolicyConflict(t *testing.T) {
+	allowAll := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+		return types.PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	_, err := NewAgent(AgentSpec{
+		Options: types.NewClaudeAgentOptions().WithCanUseTool(allowAll),
+		Policy:  &PermissionPolicy{Allow: []string{"Read"}},
+	})
+	if err == nil {
+		t.Error("expected an error when both Policy and CanUseTool are set")
+	}
+}
+
+func TestAgent_Run(t *testing.T) {
+	ctx := testContext(t, 15*time.Second)
+	transcript := NewTranscript()
+	var summaries []TurnSummary
+
+	agent, err := NewAgent(AgentSpec{
+		Name:       "script",
+		Options:    types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, scriptCLI)),
+		Transcript: transcript,
+		OnTurn: func(name string, summary TurnSummary) {
+			summaries = append(summaries, summary)
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+
+	turn, err := agent.Run(ctx, "hello")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if turn.Text != "reply 1" {
+		t.Errorf("Text = %q, want %q", turn.Text, "reply 1")
+	}
+
+	if _, err := agent.Run(ctx, "please fail"); !types.IsResultError(err) {
+		t.Errorf("expected a ResultError, got %v", err)
+	}
+
+	turns := transcript.Turns()
+	if len(turns) != 2 || turns[0].Agent != "script" || turns[1].Prompt != "please fail" {
+		t.Fatalf("unexpected transcript: %+v", turns)
+	}
+	if len(summaries) != 2 || summaries[0].CostUSD != 0.01 || !summaries[1].IsError {
+		t.Errorf("unexpected summaries: %+v", summaries)
+	}
+}
+
+// TestAgent_ConcurrentRuns checks that concurrent runs with different overrides
+// do not share mutable state. Run with -race.
+func TestAgent_ConcurrentRuns(t *testing.T) {
+	ctx := testContext(t, 30*time.Second)
+	transcript := NewTranscript()
+
+	agent, err := NewAgent(AgentSpec{
+		Name: "shared",
+		Options: types.NewClaudeAgentOptions().
+			WithCLIPath(writeMockCLI(t, scriptCLI)).
+			WithEnvVar("RUN", "base"),
+		Policy:     &PermissionPolicy{Allow: []string{"Read"}},
+		Transcript: transcript,
+	})
+	if err != nil {
+		t.Fatalf("NewAgent failed: %v", err)
+	}
+
+	const runs = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, runs)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			turn, err := agent.Run(ctx, fmt.Sprintf("run %d", i), func(o *types.ClaudeAgentOptions) {
+				o.WithEnvVar("RUN", fmt.Sprint(i)).WithExtraArg(fmt.Sprintf("flag-%d", i), nil)
+			})
+			if err == nil && turn.Text != "reply 1" {
+				err = fmt.Errorf("run %d: Text = %q", i, turn.Text)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if transcript.Len() != runs {
+		t.Errorf("transcript has %d turns, want %d", transcript.Len(), runs)
+	}
+	opts := agent.Options()
+	if opts.Env["RUN"] != "base" || len(opts.ExtraArgs) != 0 {
+		t.Errorf("overrides leaked into the agent: env %v, extra args %v", opts.Env, opts.ExtraArgs)
+	}
+}
@@ -0,0 +1,107 @@
+package claudetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// InitializeRequest is the initialize control request an SDK client sends on
+// connecting, which registers its hooks with the CLI.
+type InitializeRequest struct {
+	ControlRequest
+
+	// Hooks maps each event with hooks to its matchers, in registration order
+	Hooks map[types.HookEvent][]HookMatcherConfig
+}
+
+// HookMatcherConfig is the registration of one types.HookMatcher.
+type HookMatcherConfig struct {
+	// Matcher is the tool name pattern as sent to the CLI, widened to cover
+	// tool name aliases (e.g. "Bash|bash_tool"); empty matches every tool
+	Matcher string
+
+	// CallbackIDs identify the matcher's callbacks in hook_callback requests
+	CallbackIDs []string
+}
+
+// CapturedInitialize returns the initialize request the SDK wrote to tr,
+// waiting up to WaitTimeout for it. It fails the test if there is none.
+func CapturedInitialize(t testing.TB, tr *Transport) InitializeRequest {
+	t.Helper()
+
+	return ParseInitialize(CapturedControlRequest(t, tr, "initialize"))
+}
+
+// ParseInitialize decodes the hooks configuration of an initialize request,
+// for use outside tests with Transport.WaitForControlRequest.
+func ParseInitialize(request ControlRequest) InitializeRequest {
+	init := InitializeRequest{ControlRequest: request, Hooks: make(map[types.HookEvent][]HookMatcherConfig)}
+	hooks, _ := request.Request["hooks"].(map[string]interface{})
+	for event, value := range hooks {
+		matchers, _ := value.([]interface{})
+		for _, m := range matchers {
+			matcher, _ := m.(map[string]interface{})
+			var config HookMatcherConfig
+			config.Matcher, _ = matcher["matcher"].(string)
+			ids, _ := matcher["hookCallbackIds"].([]interface{})
+			for _, id := range ids {
+				if s, ok := id.(string); ok {
+					config.CallbackIDs = append(config.CallbackIDs, s)
+				}
+			}
+			init.Hooks[types.HookEvent(event)] = append(init.Hooks[types.HookEvent(event)], config)
+		}
+	}
+	return init
+}
+
+// CapturedControlRequest returns the first control request of subtype the
+// SDK wrote to tr, waiting up to WaitTimeout for it. It fails the test if
+// there is none.
+func CapturedControlRequest(t testing.TB, tr *Transport, subtype string) ControlRequest {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), WaitTimeout)
+	defer cancel()
+	request, err := tr.WaitForControlRequest(ctx, subtype)
+	if err != nil {
+		t.Fatalf("claudetest: %v", err)
+	}
+	return request
+}
+
+// RespondToInitialize answers the initialize requests the SDK sends to tr
+// with success, reporting capabilities, which the client exposes through
+// ServerInfo.
+func RespondToInitialize(tr *Transport, capabilities ...string) {
+	RespondWith(tr, "initialize", map[string]interface{}{"capabilities": append([]string{}, capabilities...)})
+}
+
+// RespondWith answers the control requests of subtype the SDK sends to tr
+// with a success response carrying response.
+func RespondWith(tr *Transport, subtype string, response map[string]interface{}) {
+	tr.Respond(subtype, func(ControlRequest) (map[string]interface{}, error) {
+		return response, nil
+	})
+}
+
+// RespondWithError answers the control requests of subtype the SDK sends to
+// tr with an error response carrying message.
+func RespondWithError(tr *Transport, subtype, message string) {
+	tr.Respond(subtype, func(ControlRequest) (map[string]interface{}, error) {
+		return nil, errors.New(message)
+	})
+}
+
+// InvokeHook sends a hook_callback request for callbackID to the SDK, as the
+// CLI does when a hook fires, and returns the hook's output.
+func InvokeHook(ctx context.Context, tr *Transport, callbackID string, input map[string]interface{}) (map[string]interface{}, error) {
+	return tr.Request(ctx, map[string]interface{}{
+		"subtype":     "hook_callback",
+		"callback_id": callbackID,
+		"input":       input,
+	})
+}
@@ -0,0 +1,58 @@
+package claudetest_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// A *Transport is a claude.Transport, which code outside the SDK can name.
+var _ claude.Transport = (*claudetest.Transport)(nil)
+
+// This example checks the hooks an application registers and runs one the
+// way the CLI would. In a test, CapturedInitialize(t, tr) does the first two
+// steps and fails the test if the client sent no initialize request.
+func Example() {
+	ctx := context.Background()
+	blockRm := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		return map[string]interface{}{"decision": "block", "reason": "no rm"}, nil
+	}
+	bash := "Bash"
+	opts := types.NewClaudeAgentOptions().
+		WithHook(types.HookEventPreToolUse, types.HookMatcher{Matcher: &bash, Hooks: []types.HookCallbackFunc{blockRm}})
+
+	tr := claudetest.NewTransport()
+	claudetest.RespondToInitialize(tr, "hooks")
+	client, err := claude.NewClientWithTransport(ctx, tr, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close(ctx)
+	if err := client.Connect(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	request, err := tr.WaitForControlRequest(ctx, "initialize")
+	if err != nil {
+		log.Fatal(err)
+	}
+	init := claudetest.ParseInitialize(request)
+	hook := init.Hooks[types.HookEventPreToolUse][0]
+	fmt.Println("matcher:", hook.Matcher)
+
+	output, err := claudetest.InvokeHook(ctx, tr, hook.CallbackIDs[0], map[string]interface{}{
+		"tool_name":  "Bash",
+		"tool_input": map[string]interface{}{"command": "rm -rf /"},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("decision:", output["decision"])
+	// Output:
+	// matcher: Bash|bash_tool
+	// decision: block
+}
@@ -0,0 +1,329 @@
+// Package claudetest provides an in-memory stand-in for the Claude Code CLI,
+// for testing applications built on the SDK without spawning the CLI.
+//
+// Build a client over a Transport with claude.NewClientWithTransport, then
+// script the CLI's side: Send delivers messages as if the CLI wrote them,
+// Respond and RespondToInitialize answer the control requests the SDK sends,
+// and Request sends control requests the CLI would send, such as hook
+// callbacks. What the SDK wrote can be inspected with Written,
+// ControlRequests, CapturedInitialize and CapturedControlRequest.
+//
+// Example:
+//
+//	tr := claudetest.NewTransport()
+//	claudetest.RespondToInitialize(tr, "hooks")
+//	client, err := claude.NewClientWithTransport(ctx, tr, opts)
+//	if err != nil {
+//	    t.Fatal(err)
+//	}
+//	if err := client.Connect(ctx); err != nil {
+//	    t.Fatal(err)
+//	}
+//	init := claudetest.CapturedInitialize(t, tr)
+//	if len(init.Hooks[types.HookEventPreToolUse]) != 1 {
+//	    t.Errorf("PreToolUse hooks = %v", init.Hooks[types.HookEventPreToolUse])
+//	}
+package claudetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// WaitTimeout bounds how long the Captured* helpers wait for the SDK to
+// write the request they look for.
+var WaitTimeout = 5 * time.Second
+
+// Responder answers a control request the SDK sent. A non-nil error is sent
+// to the SDK as an error response carrying its message.
+type Responder func(request ControlRequest) (map[string]interface{}, error)
+
+// ControlRequest is a control request written by the SDK.
+type ControlRequest struct {
+	RequestID string
+	Subtype   string
+	Request   map[string]interface{} // The whole request, subtype included
+}
+
+// Transport is an in-memory CLI. Control requests the SDK writes are
+// answered with an empty success response unless a Responder is registered
+// for their subtype. It may be connected again after Close, as a reconnecting
+// client does. A Transport is safe for concurrent use.
+type Transport struct {
+	mu         sync.Mutex
+	messages   chan types.Message
+	written    []string
+	responders map[string]Responder
+	pending    map[string]chan controlReply // Request's waiters, by request ID
+	nextID     int
+	changed    chan struct{} // Closed and replaced on every write
+	ready      bool
+	closed     bool
+	err        error
+}
+
+// controlReply is the SDK's answer to a control request sent with Request.
+type controlReply struct {
+	response map[string]interface{}
+	err      error
+}
+
+// NewTransport creates a disconnected Transport.
+func NewTransport() *Transport {
+	return &Transport{
+		messages:   make(chan types.Message, 100),
+		responders: make(map[string]Responder),
+		pending:    make(map[string]chan controlReply),
+		changed:    make(chan struct{}),
+	}
+}
+
+// Respond registers responder for the control requests of subtype, such as
+// "initialize", "interrupt" or "set_model", replacing the default empty
+// success response. It may be called before or after connecting.
+func (t *Transport) Respond(subtype string, responder Responder) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.responders[subtype] = responder
+}
+
+// Send delivers msg to the SDK as if the CLI wrote it. It blocks while the
+// SDK is not reading and the buffer is full, and drops msg once the
+// transport is closed.
+func (t *Transport) Send(msg types.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.messages <- msg
+	}
+}
+
+// SendJSON parses line as a line of CLI output and delivers it with Send.
+func (t *Transport) SendJSON(line string) error {
+	msg, err := types.UnmarshalMessage([]byte(line))
+	if err != nil {
+		return err
+	}
+	t.Send(msg)
+	return nil
+}
+
+// Request sends a control request from the CLI to the SDK, such as a
+// "hook_callback" or "can_use_tool" request, and waits for the SDK's answer.
+// request must include the subtype. An error response from the SDK is
+// returned as an error.
+//
+// Example:
+//
+//	response, err := tr.Request(ctx, map[string]interface{}{
+//	    "subtype":     "hook_callback",
+//	    "callback_id": init.Hooks[types.HookEventPreToolUse][0].CallbackIDs[0],
+//	    "input":       map[string]interface{}{"tool_name": "Bash"},
+//	})
+func (t *Transport) Request(ctx context.Context, request map[string]interface{}) (map[string]interface{}, error) {
+	reply := make(chan controlReply, 1)
+	t.mu.Lock()
+	t.nextID++
+	requestID := fmt.Sprintf("cli_req_%d", t.nextID)
+	t.pending[requestID] = reply
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, requestID)
+		t.mu.Unlock()
+	}()
+
+	t.Send(&types.SystemMessage{Type: "control_request", RequestID: requestID, Request: request})
+	select {
+	case r := <-reply:
+		return r.response, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Written returns the lines the SDK has written, in order.
+func (t *Transport) Written() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.written...)
+}
+
+// ControlRequests returns the control requests the SDK has written, in order.
+func (t *Transport) ControlRequests() []ControlRequest {
+	var requests []ControlRequest
+	for _, line := range t.Written() {
+		if request, ok := parseControlRequest(line); ok {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// WaitForControlRequest returns the first control request of subtype the SDK
+// has written, waiting for it until ctx ends.
+func (t *Transport) WaitForControlRequest(ctx context.Context, subtype string) (ControlRequest, error) {
+	for {
+		t.mu.Lock()
+		changed := t.changed
+		t.mu.Unlock()
+
+		for _, request := range t.ControlRequests() {
+			if request.Subtype == subtype {
+				return request, nil
+			}
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ControlRequest{}, fmt.Errorf("no %s control request written: %w", subtype, ctx.Err())
+		}
+	}
+}
+
+// Connect makes the transport ready, reopening it after Close.
+func (t *Transport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		t.messages = make(chan types.Message, 100)
+		t.closed = false
+	}
+	t.ready = true
+	return nil
+}
+
+// Write records data and answers it if it is a control request, or hands it
+// to Request if it answers one.
+func (t *Transport) Write(ctx context.Context, data string) error {
+	t.mu.Lock()
+	if !t.ready {
+		t.mu.Unlock()
+		return types.NewCLIConnectionError("claudetest transport is not connected")
+	}
+	t.written = append(t.written, data)
+	close(t.changed)
+	t.changed = make(chan struct{})
+	t.mu.Unlock()
+
+	if request, ok := parseControlRequest(data); ok {
+		go t.answer(request)
+		return nil
+	}
+
+	var msg struct {
+		Type     string `json:"type"`
+		Response struct {
+			Subtype   string                 `json:"subtype"`
+			RequestID string                 `json:"request_id"`
+			Response  map[string]interface{} `json:"response"`
+			Error     string                 `json:"error"`
+		} `json:"response"`
+	}
+	if json.Unmarshal([]byte(data), &msg) == nil && msg.Type == "control_response" {
+		t.mu.Lock()
+		reply, ok := t.pending[msg.Response.RequestID]
+		t.mu.Unlock()
+		if ok {
+			r := controlReply{response: msg.Response.Response}
+			if msg.Response.Subtype == "error" {
+				r = controlReply{err: types.NewControlProtocolError(msg.Response.Error)}
+			}
+			reply <- r
+		}
+	}
+	return nil
+}
+
+// answer sends the response to a control request the SDK wrote.
+func (t *Transport) answer(request ControlRequest) {
+	t.mu.Lock()
+	responder := t.responders[request.Subtype]
+	t.mu.Unlock()
+
+	response := map[string]interface{}{}
+	var err error
+	if responder != nil {
+		response, err = responder(request)
+	}
+
+	payload := map[string]interface{}{"subtype": "success", "request_id": request.RequestID, "response": response}
+	if err != nil {
+		payload = map[string]interface{}{"subtype": "error", "request_id": request.RequestID, "error": err.Error()}
+	}
+	t.Send(&types.SystemMessage{Type: "control_response", Response: payload})
+}
+
+// ReadMessages returns the messages delivered with Send.
+func (t *Transport) ReadMessages(ctx context.Context) <-chan types.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.messages
+}
+
+// Close stops delivery, as if the CLI exited.
+func (t *Transport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		close(t.messages)
+		t.closed = true
+	}
+	t.ready = false
+	return nil
+}
+
+// OnError records err for GetError.
+func (t *Transport) OnError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
+
+// IsReady reports whether the transport is connected and not closed.
+func (t *Transport) IsReady() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ready
+}
+
+// ReadinessReason explains the current readiness.
+func (t *Transport) ReadinessReason() transport.ReadinessReason {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.closed:
+		return transport.ReadinessClosed
+	case t.ready:
+		return transport.ReadinessReady
+	default:
+		return transport.ReadinessNeverConnected
+	}
+}
+
+// GetError returns the last error recorded by OnError.
+func (t *Transport) GetError() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// parseControlRequest decodes a control request line.
+func parseControlRequest(line string) (ControlRequest, bool) {
+	var msg struct {
+		Type      string                 `json:"type"`
+		RequestID string                 `json:"request_id"`
+		Request   map[string]interface{} `json:"request"`
+	}
+	if err := json.Unmarshal([]byte(line), &msg); err != nil || msg.Type != "control_request" {
+		return ControlRequest{}, false
+	}
+	subtype, _ := msg.Request["subtype"].(string)
+	return ControlRequest{RequestID: msg.RequestID, Subtype: subtype, Request: msg.Request}, true
+}
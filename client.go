@@ -2,9 +2,12 @@ package claude
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/schlunsen/claude-agent-sdk-go/internal"
 	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
@@ -25,6 +28,7 @@ import (
 //  4. Receive responses with ReceiveResponse()
 //  5. Repeat steps 3-4 as needed
 //  6. Clean up with Close()
+//  7. Optionally resume the session later with Reconnect()
 //
 // Example usage:
 //
@@ -64,8 +68,23 @@ import (
 //
 // Thread Safety:
 //
-// Client is not thread-safe. All methods should be called from the same goroutine,
-// or you must provide your own synchronization.
+// A Client guards its own state, so its methods may be called from any
+// goroutine. These are safe to call while another goroutine is sending a query
+// or reading a response:
+//   - Interrupt, Close, Shutdown and Ping
+//   - Enqueue, Pending and CancelQueued
+//   - Subscribe and the listener registrations (OnAssistantText and the like)
+//   - the accessors: IsConnected, Err, SessionID, ServerInfo,
+//     SupportedCommands, PermissionMode, Usage, CacheEfficiency, Stats,
+//     ResetStats, ExcludedUserMessages and DroppedControlEvents
+//
+// A connection carries one conversation at a time, though: sending a query and
+// reading its response (the Query methods, SendToolResult, ReceiveResponse,
+// ReceiveMessages, ResponseSeq, Run, ReceiveText, DrainResponse and
+// CancelResponse) should happen in one goroutine, or under your own
+// synchronization. The one exception is QueryWithSession, whose receivers of
+// different sessions may run concurrently. Connect and Reconnect should not
+// race with each other.
 type Client struct {
 	options   *types.ClaudeAgentOptions
 	transport transport.Transport
@@ -76,8 +95,87 @@ type Client struct {
 	connected bool
 	ctx       context.Context
 	cancel    context.CancelFunc
+
+	// Control protocol initialization for the current connection
+	init *initState
+
+	// Turn bookkeeping for ReceiveResponse, guarded by mu
+	pendingTurns int   // Queries sent whose ResultMessage has not been received
+	turnFinished bool  // The last pending turn completed and no query was sent since
+	settling     bool  // Messages before the next turn's first one belong to the finished turn
+	receiving    bool  // A ReceiveResponse or ReceiveMessages consumer is active
+	timeoutErr   error // Set when the latest response hit QueryTimeout
+	streamErr    error // Set when the CLI's output ended before a turn's result
+
+	// Session multiplexing (see QueryWithSession), guarded by mu; nil until the
+	// first session-scoped call on the connection
+	sessions *sessionRouter
+
+	// Automatic reconnection (see WithAutoReconnect), guarded by mu
+	newTransport func(resumeID string) transport.Transport // Creates the transport of each connection
+	stream       chan types.Message                        // Messages across connections; nil without reconnection
+	reconnecting bool                                      // A lost connection is being replaced
+	reconnectErr error                                     // Set when reconnecting failed
+	connChanged  chan struct{}                             // Closed and replaced when the above change
+
+	// Session locking (see WithSessionLocking), guarded by mu
+	resumeID    string                                                                      // Session resumed by the next connection
+	lockSession func(ctx context.Context, sessionID string) (*transport.SessionLock, error) // Nil when locking is off
+	sessionLock *transport.SessionLock                                                      // Held from connecting until Close
+
+	lastSessionID string // Session of the connection ended by Close, resumed by Reconnect
+
+	// Idle timeout (see WithIdleTimeout), guarded by mu
+	lastActive time.Time   // Last query, message read or control request
+	idleClose  *time.Timer // Fires closeIfIdle; nil when disabled or closed
+	closedErr  error       // Set when the idle timeout closed the client
+
+	// Settings overridden for a query (see QueryWithOptions), guarded by mu
+	restore   *settingsRestore // Pending until the overriding turn completes; nil when none
+	restoring chan struct{}    // Closed once the restoration in progress is done; nil when none
+
+	// Listeners (see OnAssistantText), guarded by mu
+	listeners       *listenerSet // Nil until a listener is registered
+	channelConsumer bool         // Messages were consumed through a channel
+	dispatching     bool         // A dispatcher to the listeners holds the consumer slot
+	dispatchGen     uint64       // Identifies the current dispatcher
+
+	// Prompts queued with Enqueue, guarded by mu
+	queue        []*queuedPrompt // Not yet sent, in order
+	queueRunning bool            // A goroutine is running the queue's turns
+
+	// Observers of the message stream (see Subscribe)
+	subsMu      sync.Mutex
+	subscribers map[chan types.Message]struct{}
+
+	stats *internal.StatsRecorder // Results of every connection (see Stats)
+}
+
+// initState tracks control protocol initialization for one connection.
+// Queries are only written to the CLI after done is closed with a nil err.
+type initState struct {
+	started bool
+	done    chan struct{}
+	err     error // set before done is closed
+}
+
+// controlRequestTimeout bounds how long Interrupt, SetPermissionMode and
+// SetModel wait for the CLI to acknowledge.
+var controlRequestTimeout = 30 * time.Second
+
+// tagged records the client's connection ID in a connection error it created
+// (see types.WithConnectionID).
+func (c *Client) tagged(err error) error {
+	return types.WithConnectionID(err, c.logger.Field("conn"))
 }
 
+// pingTimeout bounds how long Ping waits for the CLI to answer.
+var pingTimeout = 5 * time.Second
+
+// initializeTimeout bounds how long Query waits for control protocol
+// initialization before returning types.ErrNotInitialized.
+var initializeTimeout = 60 * time.Second
+
 // NewClient creates a new interactive client with the given options.
 //
 // This does not establish a connection; you must call Connect() before sending queries.
@@ -90,20 +188,9 @@ type Client struct {
 //   - A new Client instance
 //   - An error if the CLI cannot be found or options are invalid
 func NewClient(ctx context.Context, options *types.ClaudeAgentOptions) (*Client, error) {
-	// Use default options if not provided
-	if options == nil {
-		options = types.NewClaudeAgentOptions()
-	}
-
-	// Validate permission callback configuration
-	if options.CanUseTool != nil && options.PermissionPromptToolName != nil {
-		return nil, fmt.Errorf("can_use_tool callback cannot be used with permission_prompt_tool_name")
-	}
-
-	// If CanUseTool is provided, automatically set PermissionPromptToolName to "stdio"
-	if options.CanUseTool != nil && options.PermissionPromptToolName == nil {
-		stdio := "stdio"
-		options.PermissionPromptToolName = &stdio
+	options, err := prepareOptions(options)
+	if err != nil {
+		return nil, err
 	}
 
 	// Find CLI path
@@ -112,7 +199,7 @@ func NewClient(ctx context.Context, options *types.ClaudeAgentOptions) (*Client,
 		cliPath = *options.CLIPath
 	} else {
 		var err error
-		cliPath, err = transport.FindCLI()
+		cliPath, err = transport.FindCLIWithOptions(transport.NewDiscoveryOptions(options, log.NewLogger(options.Verbose)))
 		if err != nil {
 			return nil, err
 		}
@@ -121,7 +208,10 @@ func NewClient(ctx context.Context, options *types.ClaudeAgentOptions) (*Client,
 	// Determine working directory
 	cwd := ""
 	if options.CWD != nil {
-		cwd = *options.CWD
+		var err error
+		if cwd, err = transport.ResolveCWD(*options.CWD); err != nil {
+			return nil, err
+		}
 	}
 
 	// Prepare environment
@@ -132,11 +222,7 @@ func NewClient(ctx context.Context, options *types.ClaudeAgentOptions) (*Client,
 		}
 	}
 
-	// Create client context
-	clientCtx, cancel := context.WithCancel(ctx)
-
-	// Create logger
-	logger := log.NewLogger(options.Verbose)
+	logger := newClientLogger(options)
 
 	// Determine resume session ID from options
 	resumeID := ""
@@ -144,17 +230,87 @@ func NewClient(ctx context.Context, options *types.ClaudeAgentOptions) (*Client,
 		resumeID = *options.Resume
 	}
 
-	// Create subprocess transport with optional resume and options
-	transportInst := transport.NewSubprocessCLITransport(cliPath, cwd, env, logger, resumeID, options)
+	// Create subprocess transport with optional resume and options; reconnecting
+	// creates another one resuming the session
+	newTransport := func(resumeID string) transport.Transport {
+		return transport.NewSubprocessCLITransport(cliPath, cwd, env, logger, resumeID, options)
+	}
+
+	client := newClient(ctx, options, logger, newTransport(resumeID), newTransport)
+	client.resumeID = resumeID
+	if options.SessionLocking != types.SessionLockOff {
+		client.lockSession = func(ctx context.Context, sessionID string) (*transport.SessionLock, error) {
+			return transport.LockSession(ctx, options, cwd, sessionID, logger)
+		}
+	}
+	return client, nil
+}
+
+// NewClientWithTransport creates a client that talks to tr instead of a CLI
+// subprocess. It is meant for tests: pass a *claudetest.Transport to script
+// the CLI's side of the conversation, or your own Transport. Options that only concern the
+// subprocess, such as CLIPath and CWD, are ignored, and reconnecting connects
+// tr again.
+//
+// Example:
+//
+//	tr := claudetest.NewTransport()
+//	client, err := claude.NewClientWithTransport(ctx, tr, opts)
+func NewClientWithTransport(ctx context.Context, tr Transport, options *types.ClaudeAgentOptions) (*Client, error) {
+	options, err := prepareOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	newTransport := func(string) transport.Transport { return tr }
+	return newClient(ctx, options, newClientLogger(options), tr, newTransport), nil
+}
+
+// prepareOptions validates options, nil meaning the defaults, and returns the
+// copy a client or query works on: clients built concurrently from one options
+// value do not write to it, and later changes by the caller have no effect.
+// When CanUseTool is set, the CLI is told to ask it through the control
+// protocol ("stdio") unless another permission prompt tool is set.
+func prepareOptions(options *types.ClaudeAgentOptions) (*types.ClaudeAgentOptions, error) {
+	if options == nil {
+		options = types.NewClaudeAgentOptions()
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	options = options.Clone()
+	if options.CanUseTool != nil && options.PermissionPromptToolName == nil {
+		stdio := "stdio"
+		options.PermissionPromptToolName = &stdio
+	}
+	return options, nil
+}
+
+// newClientLogger creates the logger of a client. Its lines, and the
+// connection errors, carry an ID telling the client apart from others in the
+// process.
+func newClientLogger(options *types.ClaudeAgentOptions) *log.Logger {
+	return log.NewLogger(options.Verbose).WithField("conn", log.NewConnectionID())
+}
 
+// newClient creates a disconnected client over tr, using newTransport for the
+// transports of later connections.
+func newClient(ctx context.Context, options *types.ClaudeAgentOptions, logger *log.Logger, tr transport.Transport, newTransport func(resumeID string) transport.Transport) *Client {
+	if options.ConfigFile != "" {
+		logger.Debug("Using project options from %s", options.ConfigFile)
+	}
+	clientCtx, cancel := context.WithCancel(ctx)
 	return &Client{
-		options:   options,
-		transport: transportInst,
-		logger:    logger,
-		connected: false,
-		ctx:       clientCtx,
-		cancel:    cancel,
-	}, nil
+		options:      options,
+		transport:    tr,
+		logger:       logger,
+		connected:    false,
+		ctx:          clientCtx,
+		cancel:       cancel,
+		newTransport: newTransport,
+		connChanged:  make(chan struct{}),
+		stats:        internal.NewStatsRecorder(),
+	}
 }
 
 // Connect establishes a connection to Claude Code CLI in streaming mode.
@@ -163,8 +319,12 @@ func NewClient(ctx context.Context, options *types.ClaudeAgentOptions) (*Client,
 // which enables full control protocol support including permissions, hooks, and
 // bidirectional communication.
 //
+// By default Connect also initializes the control protocol (registering hooks) before
+// returning. With WithLazyInitialize, initialization is deferred to the first Query.
+//
 // Returns an error if:
 //   - Already connected
+//   - The resumed session is locked by another client (see WithSessionLocking)
 //   - CLI subprocess fails to start
 //   - Initialization fails
 //
@@ -183,13 +343,90 @@ func (c *Client) Connect(ctx context.Context) error {
 	if c.connected {
 		return types.NewControlProtocolError("client already connected")
 	}
+	return c.connectLocked(ctx)
+}
 
+// connectLocked starts the current transport and initializes the control
+// protocol on it. The caller holds c.mu.
+func (c *Client) connectLocked(ctx context.Context) error {
 	c.logger.Info("Connecting to Claude CLI...")
+	c.closedErr = nil
+
+	if c.lockSession != nil && c.sessionLock == nil {
+		lock, err := c.lockSession(ctx, c.resumeID)
+		if err != nil {
+			return err
+		}
+		c.sessionLock = lock
+	}
+
+	query, err := c.startQuery(ctx, c.transport)
+	if err != nil {
+		c.releaseSessionLock()
+		return err
+	}
+	c.query = query
+
+	c.init = &initState{done: make(chan struct{})}
+	c.pendingTurns = 0
+	c.turnFinished = false
+	c.settling = false
+	c.timeoutErr = nil
+	c.streamErr = nil
+	if c.sessions != nil {
+		// The router of the previous connection held the consumer slot
+		c.sessions = nil
+		c.receiving = false
+	}
+
+	// Initialize control protocol, unless deferred to the first query
+	if c.options.LazyInitialize {
+		c.logger.Debug("Deferring control protocol initialization to first query")
+	} else {
+		c.init.started = true
+		c.runInitialize(ctx, c.query, c.init)
+		if c.init.err != nil {
+			_ = c.query.Close(ctx)
+			c.releaseSessionLock()
+			return c.init.err
+		}
+	}
 
+	// Optionally wait for the session init message from the data stream
+	if c.options.WaitForInit {
+		waitCtx, cancel := context.WithTimeout(ctx, initializeTimeout)
+		_, err := c.query.WaitForInit(waitCtx)
+		cancel()
+		if err != nil {
+			c.logger.Error("Init message not received: %v", err)
+			_ = c.query.Close(ctx)
+			c.releaseSessionLock()
+			return types.NewControlProtocolErrorWithCause("init message not received", err)
+		}
+	}
+
+	if c.options.AutoReconnectAttempts > 0 {
+		c.stream = make(chan types.Message, 10)
+		go c.superviseConnection(c.query, c.stream)
+	}
+
+	if c.listeners != nil {
+		c.startListenersLocked()
+	}
+
+	c.connected = true
+	c.startIdleTimeout()
+	c.logger.Info("Successfully connected to Claude")
+	return nil
+}
+
+// startQuery connects tr and starts a query handler in streaming mode on it.
+// The transport is closed if the query cannot be started.
+func (c *Client) startQuery(ctx context.Context, tr transport.Transport) (*internal.Query, error) {
 	// Connect transport
-	if err := c.transport.Connect(ctx); err != nil {
+	if err := tr.Connect(ctx); err != nil {
 		c.logger.Error("Failed to connect transport: %v", err)
-		return types.NewCLIConnectionErrorWithCause("failed to connect to Claude CLI", err)
+		return nil, c.tagged(types.NewCLIConnectionErrorWithCause("failed to connect to Claude CLI", err))
 	}
 	c.logger.Debug("Transport connected successfully")
 
@@ -197,41 +434,163 @@ func (c *Client) Connect(ctx context.Context) error {
 	// This gives the stderr reader time to detect and report early errors
 	select {
 	case <-c.ctx.Done():
-		_ = c.transport.Close(ctx)
-		return ctx.Err()
+		_ = tr.Close(ctx)
+		return nil, ctx.Err()
 	default:
 		// Check if transport reported an error (e.g., session not found)
-		if err := c.transport.GetError(); err != nil {
+		if err := tr.GetError(); err != nil {
 			c.logger.Error("Transport error detected during connection: %v", err)
-			_ = c.transport.Close(ctx)
-			return err
+			_ = tr.Close(ctx)
+			return nil, err
 		}
 	}
 
 	// Create query handler in streaming mode
-	c.query = internal.NewQuery(ctx, c.transport, c.options, c.logger, true)
+	query := internal.NewQuery(ctx, tr, c.options, c.logger, true)
+	query.SetStatsRecorder(c.stats)
 	c.logger.Debug("Query handler created")
 
 	// Start message processing
-	if err := c.query.Start(ctx); err != nil {
+	if err := query.Start(ctx); err != nil {
 		c.logger.Error("Failed to start message processing: %v", err)
-		_ = c.transport.Close(ctx)
-		return err
+		_ = tr.Close(ctx)
+		return nil, err
 	}
 	c.logger.Debug("Message processing started")
+	if c.options.OnDisconnect != nil {
+		go c.watchDisconnect(query, tr)
+	}
+	return query, nil
+}
 
-	// Initialize control protocol
-	if _, err := c.query.Initialize(ctx); err != nil {
-		c.logger.Error("Failed to initialize control protocol: %v", err)
-		_ = c.query.Stop(ctx)
-		_ = c.transport.Close(ctx)
-		return types.NewControlProtocolErrorWithCause("failed to initialize control protocol", err)
+// disconnectExitTimeout bounds how long watchDisconnect waits for the exit
+// status of a CLI whose output has ended.
+var disconnectExitTimeout = 5 * time.Second
+
+// watchDisconnect invokes the OnDisconnect callback once query's message loop
+// has exited because the output of tr ended, with the CLI's exit status when
+// tr runs a process. A loop stopped by Close, or by a failed connect, is not
+// reported.
+func (c *Client) watchDisconnect(query *internal.Query, tr transport.Transport) {
+	<-query.Done()
+	if !query.TransportEnded() {
+		return
 	}
-	c.logger.Debug("Control protocol initialized")
 
-	c.connected = true
-	c.logger.Info("Successfully connected to Claude")
-	return nil
+	var err error
+	if process, ok := tr.(interface{ WaitExit(context.Context) error }); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), disconnectExitTimeout)
+		err = process.WaitExit(ctx)
+		cancel()
+	}
+	if err != nil {
+		c.logger.Warning("Disconnected from the CLI: %v", err)
+	} else {
+		c.logger.Info("Disconnected from the CLI")
+	}
+	c.options.OnDisconnect(err)
+}
+
+// WaitForInit blocks until the CLI's system init message has been received.
+//
+// The init message arrives on the data stream rather than as a control response, so
+// it may not have been processed when Connect returns. Call WaitForInit before reading
+// session details such as SessionID. The init message is still delivered to
+// ReceiveResponse consumers as usual.
+//
+// Returns an error if not connected, if ctx is done first, or if the stream ends
+// before init arrives.
+func (c *Client) WaitForInit(ctx context.Context) error {
+	c.mu.Lock()
+	q := c.query
+	notConnected := c.notConnectedError()
+	c.mu.Unlock()
+
+	if q == nil {
+		return notConnected
+	}
+	_, err := q.WaitForInit(ctx)
+	return err
+}
+
+// ServerInfo returns what the CLI reported when the control protocol was
+// initialized: its capabilities, the available slash commands and the raw
+// response. It returns nil before Connect, while initialization deferred with
+// WithLazyInitialize has not completed, or if initialization failed.
+//
+// Example:
+//
+//	if info := client.ServerInfo(); info != nil && !info.HasCapability("hooks") {
+//	    log.Println("this CLI version does not support hooks")
+//	}
+func (c *Client) ServerInfo() *types.ServerInfo {
+	c.mu.Lock()
+	state, q := c.init, c.query
+	c.mu.Unlock()
+	if state == nil || q == nil {
+		return nil
+	}
+
+	select {
+	case <-state.done:
+	default:
+		return nil
+	}
+	if state.err != nil {
+		return nil
+	}
+	return types.NewServerInfo(q.InitializeResult())
+}
+
+// SupportedCommands returns the slash commands available in the session, built
+// in or provided by plugins, e.g. to offer autocompletion. The commands of the
+// initialize response come first with their descriptions, followed by those
+// only named by the CLI's system init message. The result is empty, never
+// nil, when the CLI advertises none or nothing has been received yet.
+//
+// Example:
+//
+//	for _, command := range client.SupportedCommands() {
+//	    fmt.Printf("/%s\t%s\n", command.Name, command.Description)
+//	}
+func (c *Client) SupportedCommands() []types.SlashCommand {
+	commands := []types.SlashCommand{}
+	if info := c.ServerInfo(); info != nil {
+		commands = append(commands, info.SlashCommands...)
+	}
+
+	c.mu.Lock()
+	q := c.query
+	c.mu.Unlock()
+	if q == nil {
+		return commands
+	}
+	if init := q.InitMessage(); init != nil {
+		for _, name := range init.SlashCommands {
+			name = strings.TrimPrefix(name, "/")
+			known := slices.ContainsFunc(commands, func(command types.SlashCommand) bool { return command.Name == name })
+			if name != "" && !known {
+				commands = append(commands, types.SlashCommand{Name: name})
+			}
+		}
+	}
+	return commands
+}
+
+// SessionID returns the session ID announced by the CLI's init message, or an
+// empty string if it has not been received yet (see WaitForInit).
+func (c *Client) SessionID() string {
+	c.mu.Lock()
+	q := c.query
+	c.mu.Unlock()
+
+	if q == nil {
+		return ""
+	}
+	if init := q.InitMessage(); init != nil {
+		return init.SessionID
+	}
+	return ""
 }
 
 // Query sends a prompt to Claude in the current session.
@@ -246,8 +605,13 @@ func (c *Client) Connect(ctx context.Context) error {
 //   - ctx: Context for cancellation
 //   - prompt: The text prompt to send
 //
+// Query never writes to the CLI before control protocol initialization has completed.
+// If initialization is still running (or deferred with WithLazyInitialize), Query waits
+// for it, returning types.ErrNotInitialized if it does not finish in time.
+//
 // Returns an error if:
 //   - Not connected (call Connect() first)
+//   - Control protocol initialization failed or timed out
 //   - Write to CLI fails
 //   - Context is cancelled
 //
@@ -262,40 +626,16 @@ func (c *Client) Connect(ctx context.Context) error {
 //	    // Process messages
 //	}
 func (c *Client) Query(ctx context.Context, prompt string) error {
-	c.mu.Lock()
-	if !c.connected {
-		c.mu.Unlock()
-		return types.NewCLIConnectionError("not connected - call Connect() first")
+	if err := c.awaitWritable(ctx); err != nil {
+		return err
 	}
-	c.mu.Unlock()
 
 	// Validate prompt
 	if prompt == "" {
 		return fmt.Errorf("prompt cannot be empty")
 	}
 
-	// Build query message
-	queryMsg := map[string]interface{}{
-		"type": "user",
-		"message": map[string]interface{}{
-			"role":    "user",
-			"content": prompt,
-		},
-		"parent_tool_use_id": nil,
-		"session_id":         "default",
-	}
-
-	// Marshal and send
-	data, err := json.Marshal(queryMsg)
-	if err != nil {
-		return types.NewControlProtocolErrorWithCause("failed to marshal query", err)
-	}
-
-	if err := c.transport.Write(ctx, string(data)); err != nil {
-		return err
-	}
-
-	return nil
+	return c.sendPrompt(ctx, prompt, DefaultSessionID)
 }
 
 // QueryWithContent sends a structured content query (text + images) to Claude.
@@ -304,25 +644,17 @@ func (c *Client) Query(ctx context.Context, prompt string) error {
 // following the Claude API's content block format. Unlike Query() which only accepts
 // plain text, this method accepts an array of content blocks.
 //
-// Content blocks can be:
-//   - Text blocks: map[string]interface{}{"type": "text", "text": "..."}
-//   - Image blocks: map[string]interface{}{"type": "image", "source": {...}}
+// Build the blocks as a []types.UserContentBlock with types.NewTextContent,
+// types.NewImageContentBase64 and types.NewImageContentURL. They are checked with
+// types.ValidateUserContent before anything is sent, so an unsupported media type
+// or an oversized image fails with a *types.ValidationError instead of an API error.
+// Hand-built content such as []interface{} of maps is sent as is.
 //
 // Example usage:
 //
-//	content := []interface{}{
-//	    map[string]interface{}{
-//	        "type": "text",
-//	        "text": "What's in this image?",
-//	    },
-//	    map[string]interface{}{
-//	        "type": "image",
-//	        "source": map[string]interface{}{
-//	            "type":       "base64",
-//	            "media_type": "image/png",
-//	            "data":       "iVBORw0KG...",
-//	        },
-//	    },
+//	content := []types.UserContentBlock{
+//	    types.NewTextContent("What's in this image?"),
+//	    types.NewImageContentBase64("image/png", "iVBORw0KG..."),
 //	}
 //
 //	if err := client.QueryWithContent(ctx, content); err != nil {
@@ -333,52 +665,231 @@ func (c *Client) Query(ctx context.Context, prompt string) error {
 //	    // Process messages
 //	}
 func (c *Client) QueryWithContent(ctx context.Context, content interface{}) error {
-	c.mu.Lock()
-	if !c.connected {
-		c.mu.Unlock()
-		return types.NewCLIConnectionError("not connected - call Connect() first")
+	if err := c.awaitWritable(ctx); err != nil {
+		return err
 	}
-	c.mu.Unlock()
 
 	// Validate content
 	if content == nil {
 		return fmt.Errorf("content cannot be nil")
 	}
+	if blocks, ok := content.([]types.UserContentBlock); ok {
+		if err := types.ValidateUserContent(blocks); err != nil {
+			return err
+		}
+	}
+
+	return c.sendPrompt(ctx, content, DefaultSessionID)
+}
+
+// SendToolResult answers the tool use toolUseID with a result of your own,
+// written as a user message holding a tool_result block in the format the CLI
+// uses for the results it produces. Use it to substitute a synthetic result
+// for a tool call the CLI did not run, for example after denying it from
+// CanUseTool with Interrupt set: "network access is disabled here, this is
+// the cached data instead". Claude continues from the result as from any
+// other, so receive the response as after Query.
+//
+// content is the result: a string, a []types.UserContentBlock (checked with
+// types.ValidateUserContent) or nil for no content. isError marks the tool
+// call as failed. An empty toolUseID is rejected with a *types.ValidationError
+// before anything is sent.
+//
+// Example:
+//
+//	err := client.SendToolResult(ctx, toolUseID, "Network access is disabled; cached data: ...", false)
+func (c *Client) SendToolResult(ctx context.Context, toolUseID string, content interface{}, isError bool) error {
+	if toolUseID == "" {
+		return types.NewValidationError("tool_use_id", "must not be empty")
+	}
+	if blocks, ok := content.([]types.UserContentBlock); ok {
+		if err := types.ValidateUserContent(blocks); err != nil {
+			return err
+		}
+	}
+	if err := c.awaitWritable(ctx); err != nil {
+		return err
+	}
 
-	// Build query message with structured content
-	queryMsg := map[string]interface{}{
-		"type": "user",
-		"message": map[string]interface{}{
-			"role":    "user",
-			"content": content, // This can be a string or []ContentBlock
-		},
-		"parent_tool_use_id": nil,
-		"session_id":         "default",
+	result := &types.ToolResultBlock{Type: "tool_result", ToolUseID: toolUseID, Content: content, IsError: &isError}
+	return c.sendPrompt(ctx, []interface{}{result}, DefaultSessionID)
+}
+
+// sendPrompt writes a user message with the given content in sessionID once the
+// control protocol is initialized and settings overridden for the previous
+// query are restored.
+func (c *Client) sendPrompt(ctx context.Context, content interface{}, sessionID string) error {
+	if err := c.awaitRestore(ctx); err != nil {
+		return err
+	}
+	if err := c.ensureInitialized(ctx); err != nil {
+		return err
 	}
 
-	// Marshal and send
-	data, err := json.Marshal(queryMsg)
+	data, err := internal.MarshalUserMessage(content, sessionID)
 	if err != nil {
 		return types.NewControlProtocolErrorWithCause("failed to marshal query", err)
 	}
 
-	if err := c.transport.Write(ctx, string(data)); err != nil {
+	return c.writeQuery(ctx, data, sessionID)
+}
+
+// checkWritable returns a *types.CLIConnectionError if a query cannot be sent:
+// the client is not connected, or its transport has stopped being ready (e.g.
+// the CLI's output ended), in which case a query would never be answered.
+func (c *Client) checkWritable() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return c.notConnectedError()
+	}
+	if !c.transport.IsReady() {
+		return c.tagged(types.NewCLIConnectionError(fmt.Sprintf("connection to the CLI was lost (%s)", c.transport.ReadinessReason())))
+	}
+	return nil
+}
+
+// awaitWritable is checkWritable, first waiting for a lost connection to be
+// replaced when automatic reconnection is enabled.
+func (c *Client) awaitWritable(ctx context.Context) error {
+	err := c.checkWritable()
+	if err == nil || c.options.AutoReconnectAttempts == 0 {
+		return err
+	}
+	c.mu.Lock()
+	tr, connected := c.transport, c.connected
+	c.mu.Unlock()
+	if !connected {
+		return err
+	}
+	if waitErr := c.awaitReconnect(ctx, tr); waitErr != nil {
+		return waitErr
+	}
+	return c.checkWritable()
+}
+
+// writeQuery writes a user message of sessionID and records the pending turn,
+// first settling messages that arrived after the last turn's result (see
+// settleLateMessages). When the write fails because the CLI exited and automatic reconnection is
+// enabled, it is retried once on the new connection.
+func (c *Client) writeQuery(ctx context.Context, data []byte, sessionID string) error {
+	c.settleLateMessages()
+
+	// The turn is counted and expected before its prompt is written, so a
+	// quick response is attributed to it
+	c.mu.Lock()
+	tr, sessions := c.transport, c.sessions
+	c.pendingTurns++
+	c.mu.Unlock()
+	if sessions != nil {
+		sessions.expect(sessionID)
+	}
+
+	err := tr.Write(ctx, string(data))
+	if err != nil && c.options.AutoReconnectAttempts > 0 && !tr.IsReady() {
+		if err = c.awaitReconnect(ctx, tr); err == nil {
+			// The new connection starts without pending turns
+			c.mu.Lock()
+			tr = c.transport
+			c.pendingTurns++
+			c.mu.Unlock()
+			err = tr.Write(ctx, string(data))
+		}
+	}
+	if err != nil {
+		c.mu.Lock()
+		if c.pendingTurns > 0 {
+			c.pendingTurns--
+		}
+		c.mu.Unlock()
+		if sessions != nil {
+			sessions.forget(sessionID)
+		}
 		return err
 	}
 
+	c.mu.Lock()
+	c.lastActive = time.Now()
+	q := c.query
+	c.mu.Unlock()
+	if q != nil {
+		q.BeginTurn(sessionID)
+	}
 	return nil
 }
 
+// ensureInitialized blocks until the control protocol is initialized, starting
+// deferred initialization on the first call when LazyInitialize is set.
+func (c *Client) ensureInitialized(ctx context.Context) error {
+	c.mu.Lock()
+	state, q := c.init, c.query
+	if state == nil || q == nil {
+		err := c.notConnectedError()
+		c.mu.Unlock()
+		return err
+	}
+	start := !state.started
+	state.started = true
+	c.mu.Unlock()
+
+	if start {
+		c.logger.Debug("Running deferred control protocol initialization")
+		go func() {
+			initCtx, cancel := context.WithTimeout(c.ctx, initializeTimeout)
+			defer cancel()
+			c.runInitialize(initCtx, q, state)
+		}()
+	}
+
+	timer := time.NewTimer(initializeTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-state.done:
+		return state.err
+	case <-timer.C:
+		c.logger.Warning("Control protocol not initialized after %v", initializeTimeout)
+		return types.ErrNotInitialized
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runInitialize performs control protocol initialization and records the outcome in state.
+func (c *Client) runInitialize(ctx context.Context, q *internal.Query, state *initState) {
+	defer close(state.done)
+
+	if _, err := q.Initialize(ctx); err != nil {
+		c.logger.Error("Failed to initialize control protocol: %v", err)
+		state.err = types.NewControlProtocolErrorWithCause("failed to initialize control protocol", err)
+		return
+	}
+	c.logger.Debug("Control protocol initialized")
+}
+
 // ReceiveResponse returns a channel of response messages from Claude.
 //
 // This should be called after Query() to receive the response. The channel will
 // receive messages until a ResultMessage is received, then it will be closed.
+// Messages the CLI sends after the result belong to the finished turn: they are
+// taken off the stream when the next query is sent, and go to subscribers and
+// OnLateMessage (see types.ClaudeAgentOptions.WithOnLateMessage) instead of the
+// next response.
+//
+// Each turn has one consumer: call ReceiveResponse once per Query, and do not
+// call it again until the previous channel has closed. If there is no pending
+// turn, another consumer is active, or the client is not connected, the returned
+// channel is closed immediately and a warning is logged. Use ReceiveResponseE to
+// get these conditions as errors instead. To consume a session continuously
+// across results, use ReceiveMessages.
 //
 // The channel yields:
 //   - UserMessage: Messages from the user (echoed back)
 //   - AssistantMessage: Claude's text responses and tool uses
 //   - SystemMessage: System notifications and control messages
 //   - ResultMessage: Final result with cost/usage info (last message)
+//   - ErrorMessage: A line of output that was not valid JSON, or, as the last
+//     message, the CLI's output ending before the result (see Err)
 //
 // The channel is closed when:
 //   - A ResultMessage is received
@@ -400,47 +911,646 @@ func (c *Client) QueryWithContent(ctx context.Context, content interface{}) erro
 //	    }
 //	}
 func (c *Client) ReceiveResponse(ctx context.Context) <-chan types.Message {
-	outputChan := make(chan types.Message, 10)
-
-	go func() {
-		defer close(outputChan)
-
+	outputChan, err := c.ReceiveResponseE(ctx)
+	if err != nil {
+		c.logger.Warning("ReceiveResponse: %v", err)
+		closed := make(chan types.Message)
+		close(closed)
+		return closed
+	}
+	return outputChan
+}
+
+// ReceiveResponseE is like ReceiveResponse but reports misuse as an error instead
+// of returning a closed channel:
+//   - types.ErrNoPendingTurn if every query's response has already been received
+//   - types.ErrConcurrentReceive if another consumer is receiving the current turn,
+//     or the connection is multiplexed by QueryWithSession
+//   - types.ErrListenerConsumer if listeners are registered (see OnAssistantText)
+//   - a *types.CLIConnectionError if the client is not connected
+func (c *Client) ReceiveResponseE(ctx context.Context) (<-chan types.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected || c.query == nil {
+		return nil, c.notConnectedError()
+	}
+	if c.listeners != nil {
+		return nil, types.ErrListenerConsumer
+	}
+	if c.pendingTurns == 0 {
+		return nil, types.ErrNoPendingTurn
+	}
+	if c.receiving {
+		return nil, types.ErrConcurrentReceive
+	}
+	c.receiving = true
+	c.channelConsumer = true
+	c.timeoutErr = nil
+
+	outputChan := make(chan types.Message, 10)
+	go c.forwardResponse(ctx, c.messages(ctx), outputChan, c.options.QueryTimeout)
+	return outputChan, nil
+}
+
+// ReceiveMessages returns a channel of every message from Claude, across turns:
+// responses to any number of queries, results of subagent turns and system
+// messages that arrive between queries. Unlike ReceiveResponse it does not
+// close at a ResultMessage; it closes when ctx is cancelled or the connection
+// ends. Results still complete their turns, so Query can be called while the
+// channel is being read.
+//
+// ReceiveMessages and ReceiveResponse share the single consumer slot: while
+// one is active the other is refused (ReceiveResponseE reports
+// types.ErrConcurrentReceive). If the slot is taken or the client is not
+// connected, the returned channel is closed immediately and a warning is logged.
+//
+// Example:
+//
+//	go func() {
+//	    for msg := range client.ReceiveMessages(ctx) {
+//	        render(msg)
+//	    }
+//	}()
+//	err := client.Query(ctx, "Watch the build and report failures.")
+func (c *Client) ReceiveMessages(ctx context.Context) <-chan types.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	switch {
+	case !c.connected || c.query == nil:
+		err = c.notConnectedError()
+	case c.listeners != nil:
+		err = types.ErrListenerConsumer
+	case c.receiving:
+		err = types.ErrConcurrentReceive
+	}
+	if err != nil {
+		c.logger.Warning("ReceiveMessages: %v", err)
+		closed := make(chan types.Message)
+		close(closed)
+		return closed
+	}
+	c.receiving = true
+	c.channelConsumer = true
+
+	outputChan := make(chan types.Message, 10)
+	go c.forwardMessages(ctx, c.messages(ctx), outputChan)
+	return outputChan
+}
+
+// messages returns the channel consumers read: the stream that outlives
+// reconnections when automatic reconnection is enabled, else the messages of
+// the current query. The caller holds c.mu.
+func (c *Client) messages(ctx context.Context) <-chan types.Message {
+	if c.stream != nil {
+		return c.stream
+	}
+	return c.query.GetMessages(ctx)
+}
+
+// forwardMessages copies messages to outputChan until ctx is done or
+// messagesChan closes, completing a turn at each ResultMessage.
+func (c *Client) forwardMessages(ctx context.Context, messagesChan <-chan types.Message, outputChan chan<- types.Message) {
+	defer close(outputChan)
+	defer func() {
 		c.mu.Lock()
-		if !c.connected || c.query == nil {
-			c.mu.Unlock()
+		c.receiving = false
+		c.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case msg, ok := <-messagesChan:
+			if !ok {
+				c.deliverStreamEnd(ctx, outputChan)
+				return
+			}
+			c.touch()
+			if c.takeLateMessage(msg) {
+				continue
+			}
+			c.broadcast(msg)
+			if _, isResult := msg.(*types.ResultMessage); isResult {
+				c.completeTurn()
+			}
+			select {
+			case outputChan <- msg:
+			case <-ctx.Done():
+				return
+			}
 		}
-		messagesChan := c.query.GetMessages(ctx)
+	}
+}
+
+// forwardResponse copies one turn's messages to outputChan, up to and including
+// its ResultMessage. If timeout is positive and no message arrives for that
+// long, the turn is abandoned (see abandonTimedOutTurn).
+func (c *Client) forwardResponse(ctx context.Context, messagesChan <-chan types.Message, outputChan chan<- types.Message, timeout time.Duration) {
+	closeOutput := sync.OnceFunc(func() { close(outputChan) })
+	defer closeOutput()
+	defer func() {
+		c.mu.Lock()
+		c.receiving = false
 		c.mu.Unlock()
+	}()
 
-		for {
+	idle := newIdleTimer(timeout)
+	defer idle.stop()
+	tracker := internal.NewTurnTracker()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-idle.expired():
+			closeOutput()
+			c.abandonTimedOutTurn(ctx, messagesChan, timeout, tracker.Context())
+			return
+		case msg, ok := <-messagesChan:
+			if !ok {
+				// Messages channel closed before the result
+				c.deliverStreamEnd(ctx, outputChan)
+				return
+			}
+			idle.reset()
+			c.touch()
+			if c.takeLateMessage(msg) {
+				continue
+			}
+			c.broadcast(msg)
+			tracker.Observe(msg)
+
+			// The turn is complete once its result has been read, even if the
+			// consumer stops before taking it
+			_, isResult := msg.(*types.ResultMessage)
+			if isResult {
+				c.completeTurn()
+			}
+
+			// Forward message to output; after a reconnection the turn's result
+			// will never arrive
 			select {
+			case outputChan <- msg:
+				if isResult || isReconnected(msg) {
+					return
+				}
 			case <-ctx.Done():
 				return
-			case msg, ok := <-messagesChan:
-				if !ok {
-					// Messages channel closed
-					return
+			}
+		}
+	}
+}
+
+// deliverStreamEnd delivers an ErrorMessage to outputChan when a consumer's
+// messages ended although the client was neither closed nor stopped on
+// purpose, e.g. because the CLI died (see endOfStreamError).
+func (c *Client) deliverStreamEnd(ctx context.Context, outputChan chan<- types.Message) {
+	err := c.endOfStreamError()
+	if err == nil {
+		return
+	}
+	errMsg := types.NewErrorMessage(err)
+	c.broadcast(errMsg)
+	select {
+	case outputChan <- errMsg:
+	case <-ctx.Done():
+	}
+}
+
+// endOfStreamError returns the error that ended the messages of the current
+// connection, recording it for Err: the *types.ProcessError of a failed
+// reconnection, else a *types.CLIConnectionError wrapping the transport's
+// error. It returns nil when the client was closed, or when delivery was
+// stopped by the SDK with an error already reported by Err.
+func (c *Client) endOfStreamError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.reconnectErr != nil {
+		return c.reconnectErr
+	}
+	if !c.connected || c.ctx.Err() != nil || c.query == nil || c.query.Err() != nil {
+		return nil
+	}
+	if c.streamErr == nil {
+		c.streamErr = c.tagged(streamEndError(c.transport, "the CLI's output ended before the turn's result"))
+	}
+	return c.streamErr
+}
+
+// streamEndError returns the *types.CLIConnectionError reported when the
+// output of tr ended early, wrapping the error tr recorded, if any. Errors
+// decoding the output are left out: they were delivered in band when they
+// occurred.
+func streamEndError(tr transport.Transport, message string) error {
+	if cause := tr.GetError(); cause != nil && !types.IsJSONDecodeError(cause) {
+		return types.NewCLIConnectionErrorWithCause(message, cause)
+	}
+	return types.NewCLIConnectionError(message)
+}
+
+// idleTimer fires when no message has been received for its timeout. A nil
+// idleTimer, for a zero timeout, never fires.
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newIdleTimer(timeout time.Duration) *idleTimer {
+	if timeout <= 0 {
+		return nil
+	}
+	return &idleTimer{timeout: timeout, timer: time.NewTimer(timeout)}
+}
+
+// expired returns the channel that fires on expiry, or nil if disabled.
+func (t *idleTimer) expired() <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+// reset restarts the timeout after a message was received.
+func (t *idleTimer) reset() {
+	if t != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+func (t *idleTimer) stop() {
+	if t != nil {
+		t.timer.Stop()
+	}
+}
+
+// completeTurn records that a pending turn's ResultMessage has been received.
+func (c *Client) completeTurn() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pendingTurns > 0 {
+		c.pendingTurns--
+		c.turnFinished = c.pendingTurns == 0
+	}
+	c.restoreAfterResult()
+}
+
+// abandonTimedOutTurn records a TimeoutError for a response that went quiet,
+// interrupts the turn and discards its remaining messages up to the result, so
+// the client can take the next query. The response channel has already been
+// closed; the cleanup is bounded by runCleanupTimeout and outlives ctx.
+func (c *Client) abandonTimedOutTurn(ctx context.Context, messagesChan <-chan types.Message, timeout time.Duration, turnContext *types.ErrorContext) {
+	timeoutErr := types.NewTimeoutError(timeout)
+	timeoutErr.Context = turnContext
+	c.logger.Warning("%v; interrupting turn", timeoutErr)
+
+	c.mu.Lock()
+	c.timeoutErr = timeoutErr
+	query, tr := c.query, c.transport
+	c.mu.Unlock()
+	if tr != nil {
+		tr.OnError(timeoutErr)
+	}
+	if query == nil {
+		return
+	}
+
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), runCleanupTimeout)
+	defer cancel()
+	if err := query.Interrupt(cleanupCtx); err != nil {
+		c.logger.Warning("Failed to interrupt timed out turn: %v", err)
+	}
+	for {
+		select {
+		case msg, ok := <-messagesChan:
+			if !ok {
+				return
+			}
+			c.broadcast(msg)
+			if _, isResult := msg.(*types.ResultMessage); isResult {
+				c.completeTurn()
+				return
+			}
+			if isReconnected(msg) {
+				return
+			}
+		case <-cleanupCtx.Done():
+			return
+		}
+	}
+}
+
+// runCleanupTimeout bounds how long Run spends interrupting and draining an
+// abandoned turn.
+const runCleanupTimeout = 5 * time.Second
+
+// Run sends a prompt and blocks until its turn completes, passing every message
+// of the turn, including the final ResultMessage, to onMessage (which may be nil)
+// on the calling goroutine. It combines Query and ReceiveResponse into a single
+// call that fits goroutine lifecycles such as errgroup.
+//
+// If onMessage returns an error or ctx ends before the result arrives, Run
+// interrupts the CLI, discards the rest of the turn so the client can take the
+// next query, and returns that error (or ctx.Err()). Cleanup is bounded and
+// proceeds even after ctx is cancelled.
+//
+// On completion Run returns the ResultMessage. The error is a *types.ResultError
+// for an error result, carrying the turn's partial output, and nil otherwise.
+//
+// Example:
+//
+//	g, ctx := errgroup.WithContext(ctx)
+//	g.Go(func() error {
+//	    _, err := client.Run(ctx, "Summarize the changes", func(msg types.Message) error {
+//	        return events.Publish(ctx, msg)
+//	    })
+//	    return err
+//	})
+func (c *Client) Run(ctx context.Context, prompt string, onMessage func(types.Message) error) (*types.ResultMessage, error) {
+	if err := c.Query(ctx, prompt); err != nil {
+		return nil, err
+	}
+	messages, err := c.ReceiveResponseE(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tracker := internal.NewTurnTracker()
+	for msg := range messages {
+		tracker.Observe(msg)
+		if onMessage != nil {
+			if err := onMessage(msg); err != nil {
+				if _, isResult := msg.(*types.ResultMessage); !isResult {
+					c.abandonTurn(ctx, messages)
 				}
+				return nil, err
+			}
+		}
+		if result, ok := msg.(*types.ResultMessage); ok {
+			return result, tracker.Finish(result)
+		}
+	}
 
-				// Forward message to output
-				select {
-				case outputChan <- msg:
-					// Check if this is a result message (end of response)
-					if _, isResult := msg.(*types.ResultMessage); isResult {
-						return
-					}
-				case <-ctx.Done():
-					return
+	if ctx.Err() != nil {
+		c.abandonTurn(ctx, messages)
+		return nil, ctx.Err()
+	}
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	return nil, tracker.Incomplete("connection closed before the turn completed", nil)
+}
+
+// abandonTurn interrupts the current turn and discards its remaining messages,
+// first from messages and then, if that stream ended before the result, from a
+// new receive. It works after ctx has been cancelled.
+func (c *Client) abandonTurn(ctx context.Context, messages <-chan types.Message) {
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), runCleanupTimeout)
+	defer cancel()
+
+	c.mu.Lock()
+	query := c.query
+	c.mu.Unlock()
+	if query == nil {
+		return
+	}
+	if err := query.Interrupt(cleanupCtx); err != nil {
+		c.logger.Warning("Failed to interrupt abandoned turn: %v", err)
+	}
+
+	// drain reports whether the turn's result was discarded
+	drain := func(ch <-chan types.Message) bool {
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					return false
+				}
+				if _, isResult := msg.(*types.ResultMessage); isResult || isReconnected(msg) {
+					return true
 				}
+			case <-cleanupCtx.Done():
+				return false
 			}
 		}
-	}()
+	}
+	if drain(messages) {
+		return
+	}
+	if rest, err := c.ReceiveResponseE(cleanupCtx); err == nil {
+		drain(rest)
+	}
+}
 
-	return outputChan
+// drainReleaseWait bounds how long DrainResponse waits for a consumer whose
+// context was just cancelled to release the response.
+const drainReleaseWait = 200 * time.Millisecond
+
+// DrainResponse discards the messages of every pending turn up to its
+// ResultMessage, so the next ReceiveResponse only yields messages of the next
+// query. Use it after abandoning a response mid-way (e.g. the user navigated
+// away): without it, the next ReceiveResponse first delivers the rest of the
+// abandoned turn. The turn runs to completion; CancelResponse stops it first.
+//
+// The abandoned ReceiveResponse must have ended, for example by cancelling its
+// context; otherwise DrainResponse returns types.ErrConcurrentReceive. It returns
+// nil when no turn is pending, ctx.Err() if ctx ends first, and the client's
+// error (or a *types.IncompleteStreamError) if the stream ends before the
+// result arrives.
+//
+// Example:
+//
+//	cancelReceive() // Stop reading the abandoned response
+//	if err := client.DrainResponse(ctx); err != nil {
+//	    log.Printf("drain failed: %v", err)
+//	}
+//	err := client.Query(ctx, nextPrompt)
+func (c *Client) DrainResponse(ctx context.Context) error {
+	released := time.Now().Add(drainReleaseWait)
+	for {
+		messages, err := c.ReceiveResponseE(ctx)
+		switch {
+		case errors.Is(err, types.ErrNoPendingTurn):
+			return nil
+		case errors.Is(err, types.ErrConcurrentReceive) && time.Now().Before(released):
+			// A cancelled consumer releases the response asynchronously
+			select {
+			case <-time.After(10 * time.Millisecond):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case err != nil:
+			return err
+		}
+
+		complete := false
+		for msg := range messages {
+			if _, isResult := msg.(*types.ResultMessage); isResult || isReconnected(msg) {
+				complete = true
+			}
+		}
+		if complete {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := c.Err(); err != nil {
+			return err
+		}
+		return types.NewIncompleteStreamError("message stream ended before the drained turn completed")
+	}
+}
+
+// CancelResponse interrupts the turn in progress and then discards the rest of
+// every pending turn like DrainResponse, so the next query starts clean without
+// waiting for the abandoned turn to finish. It returns nil when no turn is
+// pending. With listeners (see OnAssistantText) it only interrupts the turn,
+// whose rest the listeners receive.
+func (c *Client) CancelResponse(ctx context.Context) error {
+	c.mu.Lock()
+	pending := c.connected && c.pendingTurns > 0
+	listening := c.listeners != nil
+	c.mu.Unlock()
+	if !pending {
+		return nil
+	}
+	if err := c.Interrupt(ctx); err != nil {
+		return err
+	}
+	if listening {
+		// The listeners receive the rest of the turn
+		return nil
+	}
+	return c.DrainResponse(ctx)
+}
+
+// Interrupt asks Claude to stop the turn in progress and waits for the CLI to
+// acknowledge, without ending the session. The interrupted turn still ends with
+// a ResultMessage, which ReceiveResponse delivers as usual; the client can then
+// take the next query. Prompts still queued with Enqueue are abandoned.
+//
+// It returns a *types.CLIConnectionError if the client is not connected, and a
+// *types.ControlProtocolError if the CLI rejects the request or does not
+// acknowledge it in time (wrapping ctx.Err() when ctx ended first).
+//
+// Example:
+//
+//	go func() {
+//	    <-stopButton
+//	    if err := client.Interrupt(ctx); err != nil {
+//	        log.Printf("interrupt failed: %v", err)
+//	    }
+//	}()
+//	for msg := range client.ReceiveResponse(ctx) {
+//	    // ...
+//	}
+func (c *Client) Interrupt(ctx context.Context) error {
+	c.abandonQueued("interrupted", nil)
+	return c.sendControlRequest(ctx, "interrupt", func(ctx context.Context, query *internal.Query) error {
+		return query.Interrupt(ctx)
+	})
+}
+
+// sendControlRequest runs send, a control request to the CLI, bounded by
+// controlRequestTimeout. what names the request in the error returned when the
+// CLI does not acknowledge it in time.
+func (c *Client) sendControlRequest(ctx context.Context, what string, send func(context.Context, *internal.Query) error) error {
+	c.mu.Lock()
+	query := c.query
+	connected := c.connected
+	notConnected := c.notConnectedError()
+	c.lastActive = time.Now()
+	c.mu.Unlock()
+	if !connected || query == nil {
+		return notConnected
+	}
+
+	requestCtx, cancel := context.WithTimeout(ctx, controlRequestTimeout)
+	defer cancel()
+	if err := send(requestCtx, query); err != nil {
+		if requestCtx.Err() != nil {
+			return types.NewControlProtocolErrorWithCause(what+" was not acknowledged", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// SetPermissionMode switches the permission mode of the running session without
+// reconnecting, for example to acceptEdits once the user trusts the project.
+// The change applies from the next tool use; PermissionMode and the
+// ToolPermissionContext passed to CanUseTool reflect it once the CLI
+// acknowledges.
+//
+// Unknown modes are rejected with a *types.ValidationError before anything is
+// sent. It returns a *types.CLIConnectionError if the client is not connected,
+// and a *types.ControlProtocolError if the CLI rejects the request or does not
+// acknowledge it in time.
+//
+// Example:
+//
+//	if userTrustsProject {
+//	    if err := client.SetPermissionMode(ctx, types.PermissionModeAcceptEdits); err != nil {
+//	        return err
+//	    }
+//	}
+func (c *Client) SetPermissionMode(ctx context.Context, mode types.PermissionMode) error {
+	if !mode.IsValid() {
+		return types.NewValidationError("permission_mode",
+			fmt.Sprintf("%q is not a permission mode (default, acceptEdits, plan, bypassPermissions)", mode))
+	}
+	return c.sendControlRequest(ctx, "permission mode change", func(ctx context.Context, query *internal.Query) error {
+		return query.SetPermissionMode(ctx, mode)
+	})
+}
+
+// SetModel switches the model used for the rest of the session, for example
+// to a cheaper model for simple follow-ups. Subsequent AssistantMessages carry
+// the new model in their Model field. An empty model switches back to the
+// CLI's default.
+//
+// It returns a *types.CLIConnectionError if the client is not connected. If the
+// CLI rejects the model, the *types.ControlProtocolError carrying its error
+// message is returned as is.
+//
+// Example:
+//
+//	if err := client.SetModel(ctx, "haiku"); err != nil {
+//	    return err
+//	}
+//	err := client.Query(ctx, "Now just list the file names.")
+func (c *Client) SetModel(ctx context.Context, model string) error {
+	return c.sendControlRequest(ctx, "model change", func(ctx context.Context, query *internal.Query) error {
+		return query.SetModel(ctx, model)
+	})
+}
+
+// PermissionMode returns the active permission mode of the session: the mode
+// last set with SetPermissionMode or reported by the CLI, or the configured
+// mode before Connect.
+func (c *Client) PermissionMode() types.PermissionMode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.query != nil {
+		return c.query.PermissionMode()
+	}
+	if c.options != nil && c.options.PermissionMode != nil {
+		return *c.options.PermissionMode
+	}
+	return types.PermissionModeDefault
 }
 
-// Close gracefully terminates the Claude session and cleans up resources.
+// Close terminates the Claude session and cleans up resources right away.
+// A turn still in flight is interrupted first, bounded by
+// closeInterruptTimeout, and a concurrent ReceiveResponse ends without its
+// ResultMessage; Shutdown lets the turn finish instead. Prompts still queued
+// with Enqueue are abandoned.
 //
 // This should be called when you're done with the client, typically using defer:
 //
@@ -450,43 +1560,59 @@ func (c *Client) ReceiveResponse(ctx context.Context) <-chan types.Message {
 //	}
 //	defer client.Close(ctx)
 //
-// After Close() is called, the client cannot be reused. Create a new client if needed.
+// After Close, Reconnect connects the same client again and resumes its session.
+// Calling Close again, or after Shutdown, returns nil.
 //
 // Returns an error if cleanup fails, but the client is marked as disconnected regardless.
 func (c *Client) Close(ctx context.Context) error {
+	c.abandonQueued("client closed", types.ErrClientClosed)
+	c.interruptPendingTurn()
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.closeLocked(ctx)
+}
 
+// closeLocked implements Close. The caller holds c.mu.
+func (c *Client) closeLocked(ctx context.Context) error {
 	if !c.connected {
 		return nil
 	}
 
 	c.logger.Info("Closing Claude connection...")
+	c.stopIdleTimeout()
+
+	// Prompts queued meanwhile, or when the idle timeout closes the client
+	if abandoned := c.queue; len(abandoned) > 0 {
+		c.queue = nil
+		go c.finishAbandoned(abandoned, "client closed", types.ErrClientClosed)
+	}
+
+	// Cancel context first, so a lost connection is no longer replaced
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
 
 	var errs []error
 
-	// Stop query handler
+	// Stop the query handler, then its transport (see internal.Query.Close)
 	if c.query != nil {
-		if err := c.query.Stop(ctx); err != nil {
-			c.logger.Warning("Error stopping query handler: %v", err)
+		c.lastSessionID = c.resumableSessionID(c.query)
+		if err := c.query.Close(ctx); err != nil {
+			c.logger.Warning("Error closing query handler: %v", err)
 			errs = append(errs, err)
 		}
 		c.query = nil
-	}
-
-	// Close transport
-	if c.transport != nil {
+	} else if c.transport != nil {
 		if err := c.transport.Close(ctx); err != nil {
 			c.logger.Warning("Error closing transport: %v", err)
 			errs = append(errs, err)
 		}
 	}
-
-	// Cancel context
-	if c.cancel != nil {
-		c.cancel()
-		c.cancel = nil
-	}
+	c.init = nil
+	c.restore = nil
+	c.releaseSessionLock()
+	c.closeSubscribers()
 
 	c.connected = false
 	c.logger.Debug("Connection closed")
@@ -499,12 +1625,284 @@ func (c *Client) Close(ctx context.Context) error {
 	return nil
 }
 
+// closeInterruptTimeout bounds how long Close waits for the CLI to
+// acknowledge the interrupt of a turn in flight.
+var closeInterruptTimeout = 2 * time.Second
+
+// interruptPendingTurn asks the CLI to stop the turn in flight, if any, before
+// Close stops the connection. It is best effort: the connection is closed
+// whether or not the CLI acknowledges, so the request is bounded by the
+// connection's context rather than by Close's.
+func (c *Client) interruptPendingTurn() {
+	c.mu.Lock()
+	query, connCtx := c.query, c.ctx
+	pending := c.connected && c.pendingTurns > 0 && c.transport != nil && c.transport.IsReady()
+	c.mu.Unlock()
+	if !pending || query == nil || connCtx.Err() != nil {
+		return
+	}
+
+	interruptCtx, cancel := context.WithTimeout(connCtx, closeInterruptTimeout)
+	defer cancel()
+	if err := query.Interrupt(interruptCtx); err != nil {
+		c.logger.Debug("Interrupting the turn before closing failed: %v", err)
+	}
+}
+
+// shutdownPollInterval is how often Shutdown checks whether a concurrent
+// ReceiveResponse has delivered the result of the turn in flight.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown closes the client once the turn in flight has finished. It waits
+// for the ResultMessage of every pending turn, which a concurrent
+// ReceiveResponse still delivers as usual, and then closes like Close. When
+// nobody is reading the response, Shutdown discards it like DrainResponse.
+//
+// If ctx ends before the turn finishes, the turn is interrupted and the client
+// closed at once, killing the CLI if it does not exit in time, and Shutdown
+// returns ctx.Err(). If the connection is lost before the result arrives, the
+// client is closed and the error DrainResponse reports is returned.
+//
+// Like Close, Shutdown is idempotent: it returns nil on a client that is not
+// connected.
+//
+// Example:
+//
+//	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//	defer cancel()
+//	if err := client.Shutdown(shutdownCtx); err != nil {
+//	    log.Printf("turn did not finish cleanly: %v", err)
+//	}
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.abandonQueued("client closed", types.ErrClientClosed)
+	waitErr := c.awaitPendingTurns(ctx)
+	if ctx.Err() != nil {
+		_ = c.Close(ctx)
+		return ctx.Err()
+	}
+	if err := c.Close(ctx); err != nil {
+		return err
+	}
+	return waitErr
+}
+
+// awaitPendingTurns returns once no turn is pending: the consumer receiving
+// the response completes it, or, without one, the response is drained.
+func (c *Client) awaitPendingTurns(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		pending := c.connected && c.pendingTurns > 0
+		// The queue of Enqueue receives the turns it sends
+		receiving := c.receiving || c.queueRunning
+		c.mu.Unlock()
+		if !pending {
+			return nil
+		}
+
+		if !receiving {
+			// A consumer that started meanwhile keeps the response
+			if err := c.DrainResponse(ctx); !errors.Is(err, types.ErrConcurrentReceive) {
+				return err
+			}
+		}
+		select {
+		case <-time.After(shutdownPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// releaseSessionLock releases the lock on the resumed session, if held. The
+// caller holds c.mu.
+func (c *Client) releaseSessionLock() {
+	if err := c.sessionLock.Release(); err != nil {
+		c.logger.Warning("Failed to release session lock: %v", err)
+	}
+	c.sessionLock = nil
+}
+
 // IsConnected returns true if the client is currently connected to Claude.
 //
 // This can be used to check connection state before calling methods that require
-// an active connection.
+// an active connection. It turns false as soon as the transport stops being ready
+// in either direction, even before Close is called.
 func (c *Client) IsConnected() bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.connected
+	return c.connected && c.transport.IsReady()
+}
+
+// Ping checks that the CLI behind the client is alive and answering, cheaply
+// enough to call before routing each request to a pooled client. It checks the
+// transport in both directions, then makes a control request round trip that
+// changes nothing, bounded by pingTimeout, which also catches a hung CLI.
+//
+// It returns nil when the connection is healthy, and otherwise a
+// *types.HealthCheckError whose Reason says what is wrong: not connected,
+// process exited, stdin closed or control timeout.
+//
+// Example:
+//
+//	if err := client.Ping(ctx); err != nil {
+//	    log.Printf("dropping client from the pool: %v", err)
+//	    _ = client.Close(ctx)
+//	}
+func (c *Client) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	query, tr, connected := c.query, c.transport, c.connected
+	closedErr := c.closedErr
+	c.lastActive = time.Now()
+	c.mu.Unlock()
+	if !connected || query == nil {
+		return types.NewHealthCheckError(types.HealthNotConnected, closedErr)
+	}
+	if !tr.IsReady() {
+		return types.NewHealthCheckError(healthCheckReason(tr.ReadinessReason()), tr.GetError())
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	if err := query.Ping(pingCtx); err != nil {
+		if pingCtx.Err() != nil {
+			return types.NewHealthCheckError(types.HealthControlTimeout, err)
+		}
+		if !tr.IsReady() {
+			return types.NewHealthCheckError(healthCheckReason(tr.ReadinessReason()), err)
+		}
+		return types.NewHealthCheckError(types.HealthStdinClosed, err)
+	}
+	return nil
+}
+
+// healthCheckReason maps why a transport is not ready to a health check reason.
+func healthCheckReason(reason transport.ReadinessReason) types.HealthCheckReason {
+	switch reason {
+	case transport.ReadinessStdinBroken:
+		return types.HealthStdinClosed
+	case transport.ReadinessStdoutClosed:
+		return types.HealthProcessExited
+	default:
+		return types.HealthNotConnected
+	}
+}
+
+// Err returns the error that ended message delivery on the current connection, if any.
+//
+// Check it after ReceiveResponse's channel closes. When MaxBudgetUSD was exceeded it
+// returns a *types.BudgetExceededError; the ResultMessage that crossed the limit is
+// still delivered first so the final cost is visible:
+//
+//	for msg := range client.ReceiveResponse(ctx) {
+//	    // ...
+//	}
+//	if err := client.Err(); types.IsBudgetExceededError(err) {
+//	    log.Printf("stopped: %v", err)
+//	}
+//
+// When the latest response was abandoned under QueryTimeout it returns a
+// *types.TimeoutError until the next ReceiveResponse; the client remains usable.
+// When the CLI exited and automatic reconnection failed it returns a
+// *types.ProcessError. When the CLI's output otherwise ended before a turn's
+// result it returns a *types.CLIConnectionError, also delivered in band as a
+// *types.ErrorMessage.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reconnectErr != nil {
+		return c.reconnectErr
+	}
+	if c.query == nil {
+		return nil
+	}
+	if err := c.query.Err(); err != nil {
+		return err
+	}
+	if c.streamErr != nil {
+		return c.streamErr
+	}
+	return c.timeoutErr
+}
+
+// CacheEfficiency returns prompt cache use and model request counts summed over
+// every turn of the session so far. It returns a zero value before the first
+// result or when the CLI does not report usage.
+//
+// Example:
+//
+//	cache := client.CacheEfficiency()
+//	fmt.Printf("cache hit ratio %.0f%% over %d requests\n", cache.HitRatio()*100, cache.ModelRequests)
+func (c *Client) CacheEfficiency() types.CacheEfficiency {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.query == nil {
+		return types.CacheEfficiency{}
+	}
+	return c.query.CacheEfficiency()
+}
+
+// Usage returns the usage summed over every turn of the session so far: prompt
+// cache use and request counts, and the split of output tokens between visible
+// output and extended thinking. It returns a zero value before the first result.
+//
+// Example:
+//
+//	thinking := client.Usage().Thinking
+//	fmt.Printf("%d of %d output tokens were thinking\n", thinking.ThinkingTokens, thinking.OutputTokens)
+func (c *Client) Usage() types.SessionUsage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.query == nil {
+		return types.SessionUsage{}
+	}
+	return c.query.Usage()
+}
+
+// ExcludedUserMessages returns how many UserMessages echoed by the CLI were
+// dropped on the current connection instead of being delivered, as set by
+// WithEchoedUserMessages. It returns 0 when the client is not connected.
+func (c *Client) ExcludedUserMessages() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.query == nil {
+		return 0
+	}
+	return c.query.ExcludedUserMessages()
+}
+
+// DroppedControlEvents returns how many control protocol events were not
+// delivered to the observer set by WithControlObserver on the current
+// connection, because it fell behind. It returns 0 when the client is not
+// connected.
+func (c *Client) DroppedControlEvents() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.query == nil {
+		return 0
+	}
+	return c.query.DroppedControlEvents()
+}
+
+// Stats returns totals accumulated from every ResultMessage the client has
+// received: queries, agent turns, cost, durations and token usage by model.
+// The totals survive Query/ReceiveResponse cycles, reconnections and Close,
+// until ResetStats. Results without a reported cost are counted in
+// UnpricedResults. It is safe to call concurrently with other methods.
+//
+// Example:
+//
+//	stats := client.Stats()
+//	fmt.Printf("%d queries, $%.4f\n", stats.Queries, stats.CostUSD)
+//	for model, usage := range stats.Models {
+//	    fmt.Printf("%s: %d in, %d out\n", model, usage.InputTokens, usage.OutputTokens)
+//	}
+func (c *Client) Stats() types.SessionStats {
+	return c.stats.Stats()
+}
+
+// ResetStats clears the totals returned by Stats and returns those accumulated
+// until then, so billing windows can be cut without losing a result in
+// between.
+func (c *Client) ResetStats() types.SessionStats {
+	return c.stats.Reset()
 }
@@ -2,10 +2,22 @@ package claude
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
@@ -65,8 +77,62 @@ func TestNewClient_ConflictingPermissionOptions(t *testing.T) {
 		t.Fatal("expected error for conflicting permission options")
 	}
 
-	if err.Error() != "can_use_tool callback cannot be used with permission_prompt_tool_name" {
-		t.Errorf("unexpected error message: %v", err)
+	if !types.IsOptionsValidationError(err) || !strings.Contains(err.Error(), "permission_prompt_tool_name") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewClient_ConcurrentSharedOptions(t *testing.T) {
+	ctx := context.Background()
+	canUseTool := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+		return types.PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath("/bin/echo").
+		WithCanUseTool(canUseTool).
+		WithEnvVar("SHARED_VALUE", "1")
+
+	const clients = 10
+	errs := make(chan error, clients)
+	for i := 0; i < clients; i++ {
+		go func() {
+			client, err := NewClient(ctx, opts)
+			if err == nil && (client.options.PermissionPromptToolName == nil || *client.options.PermissionPromptToolName != "stdio") {
+				err = errors.New("client prompt tool is not stdio")
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < clients; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	if opts.PermissionPromptToolName != nil {
+		t.Errorf("shared options were modified: PermissionPromptToolName = %q", *opts.PermissionPromptToolName)
+	}
+}
+
+func TestNewClient_InvalidSystemPrompt(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath("/bin/echo").
+		WithSystemPrompt([]string{"not", "a", "prompt"})
+
+	if _, err := NewClient(context.Background(), opts); !types.IsValidationError(err) {
+		t.Errorf("NewClient() error = %v, want ValidationError", err)
+	}
+}
+
+func TestNewClient_MissingCWD(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath("/bin/echo").
+		WithCWD(missing)
+
+	_, err := NewClient(context.Background(), opts)
+	if !types.IsValidationError(err) || !strings.Contains(err.Error(), missing) {
+		t.Errorf("NewClient() error = %v, want ValidationError naming %s", err, missing)
 	}
 }
 
@@ -354,6 +420,220 @@ func TestClient_MultipleQueries(t *testing.T) {
 	}
 }
 
+// TestClient_InitializeOrdering covers the eager, lazy, and failing initialization paths.
+func TestClient_InitializeOrdering(t *testing.T) {
+	t.Run("eager initializes during Connect", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if got := mock.writtenTypes(); !reflect.DeepEqual(got, []string{"initialize"}) {
+			t.Fatalf("writes after Connect = %v, want [initialize]", got)
+		}
+
+		if err := client.Query(ctx, "hello"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if got := mock.writtenTypes(); !reflect.DeepEqual(got, []string{"initialize", "user"}) {
+			t.Errorf("writes = %v, want [initialize user]", got)
+		}
+	})
+
+	t.Run("lazy defers initialization to first query", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		release := make(chan struct{})
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			<-release
+			return map[string]interface{}{}, nil
+		}
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithLazyInitialize(true), mock)
+
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if got := mock.writtenTypes(); len(got) != 0 {
+			t.Fatalf("writes after lazy Connect = %v, want none", got)
+		}
+
+		queryErr := make(chan error, 1)
+		go func() {
+			queryErr <- client.Query(ctx, "hello")
+		}()
+
+		// The prompt must not be written while initialize is outstanding
+		time.Sleep(50 * time.Millisecond)
+		if got := mock.writtenTypes(); !reflect.DeepEqual(got, []string{"initialize"}) {
+			t.Fatalf("writes during initialization = %v, want [initialize]", got)
+		}
+
+		close(release)
+		if err := <-queryErr; err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if err := client.Query(ctx, "again"); err != nil {
+			t.Fatalf("second Query failed: %v", err)
+		}
+		if got := mock.writtenTypes(); !reflect.DeepEqual(got, []string{"initialize", "user", "user"}) {
+			t.Errorf("writes = %v, want [initialize user user]", got)
+		}
+	})
+
+	t.Run("failure during lazy init is returned by every query", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			return nil, errors.New("hooks rejected")
+		}
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithLazyInitialize(true), mock)
+
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			err := client.Query(ctx, "hello")
+			if !types.IsControlProtocolError(err) {
+				t.Fatalf("Query %d error = %v, want ControlProtocolError", i+1, err)
+			}
+		}
+		if got := mock.writtenTypes(); !reflect.DeepEqual(got, []string{"initialize"}) {
+			t.Errorf("writes = %v, want only [initialize]", got)
+		}
+	})
+
+	t.Run("failure during eager init fails Connect", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			return nil, errors.New("hooks rejected")
+		}
+		client := newMockClient(t, nil, mock)
+
+		if err := client.Connect(ctx); !types.IsControlProtocolError(err) {
+			t.Fatalf("Connect error = %v, want ControlProtocolError", err)
+		}
+		if client.IsConnected() {
+			t.Error("client should not be connected after initialization failure")
+		}
+	})
+
+	t.Run("timeout returns ErrNotInitialized", func(t *testing.T) {
+		old := initializeTimeout
+		initializeTimeout = 100 * time.Millisecond
+		t.Cleanup(func() { initializeTimeout = old })
+
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithLazyInitialize(true), mock)
+
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Query(ctx, "hello"); !errors.Is(err, types.ErrNotInitialized) {
+			t.Fatalf("Query error = %v, want ErrNotInitialized", err)
+		}
+		if got := mock.writtenTypes(); !reflect.DeepEqual(got, []string{"initialize"}) {
+			t.Errorf("writes = %v, want only [initialize]", got)
+		}
+	})
+}
+
+// TestClient_WaitForInit covers waiting for the delayed system init message.
+func TestClient_WaitForInit(t *testing.T) {
+	initMsg := func() *types.SystemMessage {
+		return &types.SystemMessage{Type: "system", Subtype: types.SystemSubtypeInit, SessionID: "s-init"}
+	}
+
+	t.Run("explicit wait after connect", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if id := client.SessionID(); id != "" {
+			t.Fatalf("SessionID before init = %q, want empty", id)
+		}
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			mock.send(initMsg())
+			mock.send(&types.ResultMessage{Type: "result", Subtype: "success"})
+		}()
+
+		if err := client.WaitForInit(ctx); err != nil {
+			t.Fatalf("WaitForInit failed: %v", err)
+		}
+		if id := client.SessionID(); id != "s-init" {
+			t.Errorf("SessionID = %q, want s-init", id)
+		}
+
+		// The init message is still delivered to consumers
+		if err := client.Query(ctx, "hello"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		messages := collectMessages(t, client.ReceiveResponse(ctx), 2*time.Second)
+		if len(messages) != 2 {
+			t.Fatalf("received %d messages, want init and result", len(messages))
+		}
+		if sys, ok := messages[0].(*types.SystemMessage); !ok || !sys.IsInit() {
+			t.Errorf("first message = %#v, want init system message", messages[0])
+		}
+	})
+
+	t.Run("connect waits when configured", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				mock.send(initMsg())
+			}()
+			return map[string]interface{}{}, nil
+		}
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithWaitForInit(true), mock)
+
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if id := client.SessionID(); id != "s-init" {
+			t.Errorf("SessionID right after Connect = %q, want s-init", id)
+		}
+	})
+
+	t.Run("connect times out without init", func(t *testing.T) {
+		old := initializeTimeout
+		initializeTimeout = 100 * time.Millisecond
+		t.Cleanup(func() { initializeTimeout = old })
+
+		ctx := testContext(t, 5*time.Second)
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithWaitForInit(true), newMockTransport())
+
+		if err := client.Connect(ctx); !types.IsControlProtocolError(err) {
+			t.Fatalf("Connect error = %v, want ControlProtocolError", err)
+		}
+		if client.IsConnected() {
+			t.Error("client should not be connected after waiting for init failed")
+		}
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		client := newMockClient(t, nil, newMockTransport())
+		if err := client.WaitForInit(context.Background()); !types.IsCLIConnectionError(err) {
+			t.Errorf("WaitForInit error = %v, want CLIConnectionError", err)
+		}
+	})
+}
+
 // BenchmarkClient benchmarks the Client type
 func BenchmarkClient_Create(b *testing.B) {
 	ctx := context.Background()
@@ -367,3 +647,1994 @@ func BenchmarkClient_Create(b *testing.B) {
 		}
 	}
 }
+
+// TestClient_ReceiveResponseTurns covers the one-consumer-per-turn rule.
+func TestClient_ReceiveResponseTurns(t *testing.T) {
+	result := func() *types.ResultMessage {
+		return &types.ResultMessage{Type: "result", Subtype: "success"}
+	}
+
+	t.Run("no pending turn", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client := newMockClient(t, nil, newMockTransport())
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrNoPendingTurn) {
+			t.Errorf("ReceiveResponseE error = %v, want ErrNoPendingTurn", err)
+		}
+		// The lenient variant closes its channel immediately instead of blocking
+		if messages := collectMessages(t, client.ReceiveResponse(ctx), time.Second); len(messages) != 0 {
+			t.Errorf("received %d messages, want none", len(messages))
+		}
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		client := newMockClient(t, nil, newMockTransport())
+		if _, err := client.ReceiveResponseE(context.Background()); !types.IsCLIConnectionError(err) {
+			t.Errorf("ReceiveResponseE error = %v, want CLIConnectionError", err)
+		}
+	})
+
+	t.Run("one response per query", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		for turn := 1; turn <= 2; turn++ {
+			if err := client.Query(ctx, "hello"); err != nil {
+				t.Fatalf("turn %d: Query failed: %v", turn, err)
+			}
+			mock.send(&types.AssistantMessage{Type: "assistant"})
+			mock.send(result())
+
+			messages, err := client.ReceiveResponseE(ctx)
+			if err != nil {
+				t.Fatalf("turn %d: ReceiveResponseE failed: %v", turn, err)
+			}
+			if got := collectMessages(t, messages, 2*time.Second); len(got) != 2 {
+				t.Errorf("turn %d: received %d messages, want 2", turn, len(got))
+			}
+		}
+
+		if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrNoPendingTurn) {
+			t.Errorf("after both turns: error = %v, want ErrNoPendingTurn", err)
+		}
+	})
+
+	t.Run("double subscribe", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Query(ctx, "hello"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+
+		first, err := client.ReceiveResponseE(ctx)
+		if err != nil {
+			t.Fatalf("first ReceiveResponseE failed: %v", err)
+		}
+		if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrConcurrentReceive) {
+			t.Errorf("second ReceiveResponseE error = %v, want ErrConcurrentReceive", err)
+		}
+
+		mock.send(result())
+		if got := collectMessages(t, first, 2*time.Second); len(got) != 1 {
+			t.Errorf("first consumer received %d messages, want the result", len(got))
+		}
+	})
+}
+
+// truncatingCLI answers the first two user messages with an answer cut off at
+// max_tokens and the third with the end of the answer.
+const truncatingCLI = `
+turn=0
+while read line; do
+  case "$line" in
+    *control_request*)
+      id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+      echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+      ;;
+    *'"type":"user"'*)
+      turn=$((turn+1))
+      if [ $turn -le 2 ]; then
+        echo '{"type":"assistant","message":{"model":"m","stop_reason":"max_tokens","content":[{"type":"text","text":"part '$turn', "}]}}'
+      else
+        echo '{"type":"assistant","message":{"model":"m","stop_reason":"end_turn","content":[{"type":"text","text":"the end."}]}}'
+      fi
+      echo '{"type":"result","subtype":"success","is_error":false,"session_id":"s-trunc","num_turns":1,"total_cost_usd":0.01}'
+      ;;
+  esac
+done
+`
+
+func TestClient_AutoContinueOnTruncation(t *testing.T) {
+	for _, tt := range []struct {
+		maxContinues int
+		wantText     string
+		wantEvents   int
+	}{
+		{maxContinues: 0, wantText: "part 1, ", wantEvents: 0},
+		{maxContinues: 1, wantText: "part 1, part 2, ", wantEvents: 1},
+		{maxContinues: 3, wantText: "part 1, part 2, the end.", wantEvents: 2},
+	} {
+		t.Run(fmt.Sprintf("max %d", tt.maxContinues), func(t *testing.T) {
+			ctx := testContext(t, 15*time.Second)
+			opts := types.NewClaudeAgentOptions().
+				WithCLIPath(writeMockCLI(t, truncatingCLI)).
+				WithAutoContinueOnTruncation(tt.maxContinues)
+
+			turns, err := RunScript(ctx, []string{"write a long answer"}, opts)
+			if err != nil {
+				t.Fatalf("RunScript failed: %v", err)
+			}
+			turn := turns[0]
+			if turn.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", turn.Text, tt.wantText)
+			}
+
+			summary, err := Summarize(turn.Messages)
+			if err != nil {
+				t.Fatalf("Summarize failed: %v", err)
+			}
+			if summary.AutoContinues != tt.wantEvents {
+				t.Errorf("AutoContinues = %d, want %d", summary.AutoContinues, tt.wantEvents)
+			}
+			if results := summary.MessageCounts["result"]; results != 1 {
+				t.Errorf("got %d results, want only the final one", results)
+			}
+
+			transcript := NewTranscript()
+			transcript.Record(TranscriptTurn{Prompt: turn.Prompt, Messages: turn.Messages})
+			var out strings.Builder
+			if err := transcript.ExportEvalJSONL(&out, EvalExportOptions{}); err != nil {
+				t.Fatalf("ExportEvalJSONL failed: %v", err)
+			}
+			if !strings.Contains(out.String(), `"response":"`+tt.wantText+`"`) {
+				t.Errorf("exported response should be the stitched answer, got %s", out.String())
+			}
+		})
+	}
+}
+
+// TestClient_AutoContinueSession tests that a truncated answer is continued in
+// the session of the prompt it answers.
+func TestClient_AutoContinueSession(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, types.NewClaudeAgentOptions().WithAutoContinueOnTruncation(1), mock)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// userSessions waits for n user messages and returns their session IDs
+	userSessions := func(n int) []string {
+		t.Helper()
+		for {
+			var sessions []string
+			mock.mu.Lock()
+			for _, data := range mock.written {
+				var msg struct {
+					Type      string `json:"type"`
+					SessionID string `json:"session_id"`
+				}
+				if err := json.Unmarshal([]byte(data), &msg); err == nil && msg.Type == "user" {
+					sessions = append(sessions, msg.SessionID)
+				}
+			}
+			mock.mu.Unlock()
+			if len(sessions) >= n || ctx.Err() != nil {
+				return sessions
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	truncated := func(sessionID string) *types.AssistantMessage {
+		return &types.AssistantMessage{Type: "assistant", SessionID: sessionID, StopReason: types.StopReasonMaxTokens, Content: []types.ContentBlock{
+			&types.TextBlock{Type: "text", Text: "part 1, "},
+		}}
+	}
+	result := func(sessionID string) *types.ResultMessage {
+		return &types.ResultMessage{Type: "result", Subtype: "success", SessionID: sessionID}
+	}
+
+	for _, sessionID := range []string{"review", "plan"} {
+		if err := client.QueryWithSession(ctx, "write a long answer", sessionID); err != nil {
+			t.Fatalf("QueryWithSession(%s) failed: %v", sessionID, err)
+		}
+	}
+	mock.send(truncated("review"))
+	mock.send(result("review"))
+	userSessions(3)
+	mock.send(result("review"))
+	mock.send(truncated("plan"))
+	mock.send(result("plan"))
+
+	got := userSessions(4)
+	want := []string{"review", "plan", "review", "plan"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("user messages sent in sessions %v, want %v", got, want)
+	}
+}
+
+func TestClient_Run(t *testing.T) {
+	text := func(s string) *types.AssistantMessage {
+		return &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: s}}}
+	}
+	// interruptible answers an interrupt by ending the turn, as the CLI does
+	interruptible := func(mock *mockTransport) func(subtype string) (map[string]interface{}, error) {
+		return func(subtype string) (map[string]interface{}, error) {
+			if subtype == "interrupt" {
+				mock.send(&types.ResultMessage{Type: "result", Subtype: "error_during_execution", IsError: true})
+			}
+			return map[string]interface{}{}, nil
+		}
+	}
+	connect := func(t *testing.T, ctx context.Context) (*Client, *mockTransport) {
+		mock := newMockTransport()
+		mock.respond = interruptible(mock)
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		return client, mock
+	}
+	assertTurnDrained := func(t *testing.T, ctx context.Context, client *Client, mock *mockTransport) {
+		t.Helper()
+		if !slices.Contains(mock.writtenTypes(), "interrupt") {
+			t.Errorf("written = %v, want an interrupt", mock.writtenTypes())
+		}
+		if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrNoPendingTurn) {
+			t.Errorf("abandoned turn should be drained, ReceiveResponseE error = %v", err)
+		}
+	}
+
+	t.Run("completes", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx)
+		mock.send(text("hello"))
+		mock.send(&types.ResultMessage{Type: "result", Subtype: "success", SessionID: "s-run"})
+
+		var seen []string
+		result, err := client.Run(ctx, "hi", func(msg types.Message) error {
+			seen = append(seen, msg.GetMessageType())
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		if result == nil || result.SessionID != "s-run" {
+			t.Errorf("result = %+v, want the turn's result", result)
+		}
+		if !reflect.DeepEqual(seen, []string{"assistant", "result"}) {
+			t.Errorf("callback saw %v, want assistant then result", seen)
+		}
+	})
+
+	t.Run("callback error aborts the turn", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx)
+		mock.send(text("first"))
+		mock.send(text("second"))
+
+		errStop := errors.New("stop")
+		calls := 0
+		result, err := client.Run(ctx, "hi", func(msg types.Message) error {
+			calls++
+			return errStop
+		})
+		if !errors.Is(err, errStop) || result != nil {
+			t.Fatalf("Run = %v, %v; want the callback error", result, err)
+		}
+		if calls != 1 {
+			t.Errorf("callback called %d times, want 1", calls)
+		}
+		assertTurnDrained(t, ctx, client, mock)
+	})
+
+	t.Run("context cancellation aborts the turn", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx)
+		mock.send(text("working"))
+
+		runCtx, cancel := context.WithCancel(ctx)
+		_, err := client.Run(runCtx, "hi", func(msg types.Message) error {
+			cancel()
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Run error = %v, want context.Canceled", err)
+		}
+		assertTurnDrained(t, ctx, client, mock)
+	})
+}
+
+// TestClient_QueryTimeout tests that a response going quiet for QueryTimeout is
+// abandoned with a TimeoutError, while messages keep restarting the timeout.
+func TestClient_QueryTimeout(t *testing.T) {
+	text := func(s string) *types.AssistantMessage {
+		return &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: s}}}
+	}
+	connect := func(t *testing.T, ctx context.Context, timeout time.Duration) (*Client, *mockTransport) {
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			if subtype == "interrupt" {
+				mock.send(&types.ResultMessage{Type: "result", Subtype: "error_during_execution", IsError: true})
+			}
+			return map[string]interface{}{}, nil
+		}
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithQueryTimeout(timeout), mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Query(ctx, "hi"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		return client, mock
+	}
+
+	t.Run("quiet response times out", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx, 100*time.Millisecond)
+		mock.send(text("partial answer"))
+
+		var received []types.Message
+		for msg := range client.ReceiveResponse(ctx) {
+			received = append(received, msg)
+		}
+		if len(received) != 1 {
+			t.Fatalf("received %d messages, want only the assistant message", len(received))
+		}
+
+		var timeoutErr *types.TimeoutError
+		if err := client.Err(); !errors.As(err, &timeoutErr) {
+			t.Fatalf("Err() = %v, want *types.TimeoutError", err)
+		}
+		if timeoutErr.Timeout != 100*time.Millisecond || timeoutErr.Context == nil || timeoutErr.Context.AssistantText != "partial answer" {
+			t.Errorf("TimeoutError = %+v, want the timeout and partial output", timeoutErr)
+		}
+		if !types.IsTimeoutError(mock.GetError()) {
+			t.Errorf("transport error = %v, want TimeoutError", mock.GetError())
+		}
+		if !slices.Contains(mock.writtenTypes(), "interrupt") {
+			t.Errorf("written = %v, want an interrupt", mock.writtenTypes())
+		}
+
+		// The abandoned turn is drained in the background
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			_, err := client.ReceiveResponseE(ctx)
+			if errors.Is(err, types.ErrNoPendingTurn) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("abandoned turn was not drained: ReceiveResponseE error = %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("messages restart the timeout", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx, 150*time.Millisecond)
+		go func() {
+			for i := 0; i < 5; i++ {
+				time.Sleep(60 * time.Millisecond)
+				mock.send(text("still working"))
+			}
+			mock.send(&types.ResultMessage{Type: "result", Subtype: "success"})
+		}()
+
+		var last types.Message
+		for msg := range client.ReceiveResponse(ctx) {
+			last = msg
+		}
+		if _, ok := last.(*types.ResultMessage); !ok {
+			t.Fatalf("last message = %T, want the ResultMessage", last)
+		}
+		if err := client.Err(); err != nil {
+			t.Errorf("Err() = %v, want nil", err)
+		}
+	})
+}
+
+// TestClient_QueryAfterTransportLost tests that a query fails fast once the
+// transport has stopped being ready, naming the reason.
+func TestClient_QueryAfterTransportLost(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	_ = mock.Close(ctx)
+	if client.IsConnected() {
+		t.Error("IsConnected() should turn false when the transport is no longer ready")
+	}
+	err := client.Query(ctx, "hi")
+	if !types.IsCLIConnectionError(err) || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("Query() error = %v, want a CLIConnectionError naming the reason", err)
+	}
+}
+
+// TestClient_Interrupt tests the interrupt control request and its errors.
+func TestClient_Interrupt(t *testing.T) {
+	t.Run("not connected", func(t *testing.T) {
+		client := newMockClient(t, nil, newMockTransport())
+		if err := client.Interrupt(context.Background()); !types.IsCLIConnectionError(err) {
+			t.Errorf("Interrupt() error = %v, want CLIConnectionError", err)
+		}
+	})
+
+	t.Run("acknowledged", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		if err := client.Interrupt(ctx); err != nil {
+			t.Fatalf("Interrupt() failed: %v", err)
+		}
+
+		mock.mu.Lock()
+		last := mock.written[len(mock.written)-1]
+		mock.mu.Unlock()
+		var payload struct {
+			Type      string                 `json:"type"`
+			RequestID string                 `json:"request_id"`
+			Request   map[string]interface{} `json:"request"`
+		}
+		if err := json.Unmarshal([]byte(last), &payload); err != nil {
+			t.Fatalf("written payload is not JSON: %v", err)
+		}
+		if payload.Type != "control_request" || payload.RequestID == "" || !reflect.DeepEqual(payload.Request, map[string]interface{}{"subtype": "interrupt"}) {
+			t.Errorf("written payload = %s", last)
+		}
+	})
+
+	t.Run("not acknowledged in time", func(t *testing.T) {
+		old := controlRequestTimeout
+		controlRequestTimeout = 100 * time.Millisecond
+		t.Cleanup(func() { controlRequestTimeout = old })
+
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			if subtype == "interrupt" {
+				time.Sleep(time.Second)
+			}
+			return map[string]interface{}{}, nil
+		}
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		err := client.Interrupt(ctx)
+		if !types.IsControlProtocolError(err) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Interrupt() error = %v, want ControlProtocolError wrapping the deadline", err)
+		}
+	})
+}
+
+// TestClient_Ping tests the health check of a ready, lost, closed and hung
+// connection.
+func TestClient_Ping(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		if err := client.Ping(ctx); err != nil {
+			t.Fatalf("Ping() failed: %v", err)
+		}
+		mock.mu.Lock()
+		last := mock.written[len(mock.written)-1]
+		mock.mu.Unlock()
+		if !strings.Contains(last, `"request":{"mode":"default","subtype":"set_permission_mode"}`) {
+			t.Errorf("written payload = %s, want a request restating the permission mode", last)
+		}
+
+		// A CLI that rejects the request is still alive
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			return nil, errors.New("unsupported")
+		}
+		if err := client.Ping(ctx); err != nil {
+			t.Errorf("Ping() with a rejected request = %v, want nil", err)
+		}
+	})
+
+	t.Run("lost", func(t *testing.T) {
+		for reason, want := range map[transport.ReadinessReason]types.HealthCheckReason{
+			transport.ReadinessStdinBroken:  types.HealthStdinClosed,
+			transport.ReadinessStdoutClosed: types.HealthProcessExited,
+		} {
+			ctx := testContext(t, 5*time.Second)
+			mock := newMockTransport()
+			client := newMockClient(t, nil, mock)
+			if err := client.Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+			mock.mu.Lock()
+			mock.lost = reason
+			mock.mu.Unlock()
+
+			var healthErr *types.HealthCheckError
+			if err := client.Ping(ctx); !errors.As(err, &healthErr) || healthErr.Reason != want {
+				t.Errorf("Ping() after %s = %v, want %s", reason, err, want)
+			}
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client := newMockClient(t, nil, newMockTransport())
+		var healthErr *types.HealthCheckError
+		if err := client.Ping(ctx); !errors.As(err, &healthErr) || healthErr.Reason != types.HealthNotConnected {
+			t.Errorf("Ping() before Connect = %v, want %s", err, types.HealthNotConnected)
+		}
+
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Close(ctx); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if err := client.Ping(ctx); !errors.As(err, &healthErr) || healthErr.Reason != types.HealthNotConnected {
+			t.Errorf("Ping() after Close = %v, want %s", err, types.HealthNotConnected)
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		old := pingTimeout
+		pingTimeout = 100 * time.Millisecond
+		t.Cleanup(func() { pingTimeout = old })
+
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			time.Sleep(time.Second)
+			return map[string]interface{}{}, nil
+		}
+
+		var healthErr *types.HealthCheckError
+		err := client.Ping(ctx)
+		if !errors.As(err, &healthErr) || healthErr.Reason != types.HealthControlTimeout || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Ping() = %v, want %s wrapping the deadline", err, types.HealthControlTimeout)
+		}
+	})
+}
+
+// TestClient_SetPermissionMode tests switching the permission mode of a running
+// session, and that permission callbacks see the new mode.
+func TestClient_SetPermissionMode(t *testing.T) {
+	t.Run("invalid mode", func(t *testing.T) {
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(testContext(t, 5*time.Second)); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		written := len(mock.writtenTypes())
+
+		if err := client.SetPermissionMode(context.Background(), "yolo"); !types.IsValidationError(err) {
+			t.Errorf("SetPermissionMode() error = %v, want ValidationError", err)
+		}
+		if got := len(mock.writtenTypes()); got != written {
+			t.Errorf("an invalid mode should not be sent, wrote %v", mock.writtenTypes())
+		}
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		client := newMockClient(t, nil, newMockTransport())
+		if err := client.SetPermissionMode(context.Background(), types.PermissionModePlan); !types.IsCLIConnectionError(err) {
+			t.Errorf("SetPermissionMode() error = %v, want CLIConnectionError", err)
+		}
+	})
+
+	t.Run("escalate to acceptEdits", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		modes := make(chan types.PermissionMode, 1)
+		opts := types.NewClaudeAgentOptions().
+			WithPermissionMode(types.PermissionModeDefault).
+			WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+				modes <- permCtx.PermissionMode
+				return types.PermissionResultAllow{Behavior: "allow"}, nil
+			})
+		mock := newMockTransport()
+		client := newMockClient(t, opts, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if got := client.PermissionMode(); got != types.PermissionModeDefault {
+			t.Errorf("PermissionMode() = %q before the switch, want default", got)
+		}
+
+		if err := client.SetPermissionMode(ctx, types.PermissionModeAcceptEdits); err != nil {
+			t.Fatalf("SetPermissionMode() failed: %v", err)
+		}
+		mock.mu.Lock()
+		last := mock.written[len(mock.written)-1]
+		mock.mu.Unlock()
+		var payload struct {
+			Type    string                 `json:"type"`
+			Request map[string]interface{} `json:"request"`
+		}
+		if err := json.Unmarshal([]byte(last), &payload); err != nil {
+			t.Fatalf("written payload is not JSON: %v", err)
+		}
+		want := map[string]interface{}{"subtype": "set_permission_mode", "mode": "acceptEdits"}
+		if payload.Type != "control_request" || !reflect.DeepEqual(payload.Request, want) {
+			t.Errorf("written payload = %s", last)
+		}
+		if got := client.PermissionMode(); got != types.PermissionModeAcceptEdits {
+			t.Errorf("PermissionMode() = %q, want acceptEdits", got)
+		}
+
+		mock.send(&types.SystemMessage{
+			Type:      "control_request",
+			RequestID: "req-perm-1",
+			Request:   map[string]interface{}{"subtype": "can_use_tool", "tool_name": "Edit", "input": map[string]interface{}{}},
+		})
+		select {
+		case mode := <-modes:
+			if mode != types.PermissionModeAcceptEdits {
+				t.Errorf("CanUseTool saw mode %q, want acceptEdits", mode)
+			}
+		case <-ctx.Done():
+			t.Fatal("CanUseTool was not called")
+		}
+	})
+
+	t.Run("rejected by the CLI", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			if subtype == "set_permission_mode" {
+				return nil, errors.New("bypassPermissions requires --allow-dangerously-skip-permissions")
+			}
+			return map[string]interface{}{}, nil
+		}
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithPermissionMode(types.PermissionModePlan), mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		if err := client.SetPermissionMode(ctx, types.PermissionModeBypassPermissions); err == nil {
+			t.Fatal("SetPermissionMode() should fail when the CLI rejects the change")
+		}
+		if got := client.PermissionMode(); got != types.PermissionModePlan {
+			t.Errorf("PermissionMode() = %q after a rejected change, want plan", got)
+		}
+	})
+}
+
+// TestClient_SetModel tests switching models mid-session and that a rejection
+// by the CLI is returned as is.
+func TestClient_SetModel(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithModel("opus"), mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		if err := client.SetModel(ctx, "haiku"); err != nil {
+			t.Fatalf("SetModel() failed: %v", err)
+		}
+		mock.mu.Lock()
+		last := mock.written[len(mock.written)-1]
+		mock.mu.Unlock()
+		var payload struct {
+			Request map[string]interface{} `json:"request"`
+		}
+		if err := json.Unmarshal([]byte(last), &payload); err != nil {
+			t.Fatalf("written payload is not JSON: %v", err)
+		}
+		if want := map[string]interface{}{"subtype": "set_model", "model": "haiku"}; !reflect.DeepEqual(payload.Request, want) {
+			t.Errorf("written request = %v, want %v", payload.Request, want)
+		}
+
+		// The CLI answers follow-ups with the new model
+		if err := client.Query(ctx, "list the files"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		mock.send(&types.AssistantMessage{Type: "assistant", Model: "claude-haiku-4-5", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: "go.mod"}}})
+		mock.send(&types.ResultMessage{Type: "result", Subtype: "success", SessionID: "s-1"})
+		for _, msg := range collectMessages(t, client.ReceiveResponse(ctx), 2*time.Second) {
+			if assistant, ok := msg.(*types.AssistantMessage); ok && assistant.Model != "claude-haiku-4-5" {
+				t.Errorf("AssistantMessage.Model = %q, want claude-haiku-4-5", assistant.Model)
+			}
+		}
+	})
+
+	t.Run("default model", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.SetModel(ctx, ""); err != nil {
+			t.Fatalf("SetModel() failed: %v", err)
+		}
+		mock.mu.Lock()
+		last := mock.written[len(mock.written)-1]
+		mock.mu.Unlock()
+		if !strings.Contains(last, `"model":null`) {
+			t.Errorf("an empty model should be sent as null, wrote %s", last)
+		}
+	})
+
+	t.Run("rejected by the CLI", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			if subtype == "set_model" {
+				return nil, errors.New("model 'gpt-4' is not available")
+			}
+			return map[string]interface{}{}, nil
+		}
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		err := client.SetModel(ctx, "gpt-4")
+		var protocolErr *types.ControlProtocolError
+		if !errors.As(err, &protocolErr) || protocolErr.Message != "model 'gpt-4' is not available" {
+			t.Errorf("SetModel() error = %v, want the CLI's ControlProtocolError", err)
+		}
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		client := newMockClient(t, nil, newMockTransport())
+		if err := client.SetModel(context.Background(), "haiku"); !types.IsCLIConnectionError(err) {
+			t.Errorf("SetModel() error = %v, want CLIConnectionError", err)
+		}
+	})
+}
+
+// TestClient_InterruptedTurn tests that turns ended by an interrupt, from
+// another surface or from Client.Interrupt, are told apart from failures.
+func TestClient_InterruptedTurn(t *testing.T) {
+	errorResult := func() *types.ResultMessage {
+		return &types.ResultMessage{Type: "result", Subtype: "error_during_execution", IsError: true, SessionID: "s-1"}
+	}
+
+	t.Run("interrupted from another surface", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		mock.send(&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: "Refactoring the"}}})
+		mock.send(&types.SystemMessage{Type: "control_request", RequestID: "cli-1", Request: map[string]interface{}{"subtype": "interrupt"}})
+		mock.send(errorResult())
+		result, err := client.Run(ctx, "refactor the parser", nil)
+		if !result.IsInterrupted() {
+			t.Errorf("result should be marked as interrupted, Meta = %+v", result.Meta)
+		}
+		var interrupted *types.TurnInterruptedError
+		if !errors.As(err, &interrupted) || !types.IsResultError(err) {
+			t.Fatalf("Run() error = %v, want TurnInterruptedError wrapping the ResultError", err)
+		}
+		if interrupted.Context == nil || interrupted.Context.AssistantText != "Refactoring the" {
+			t.Errorf("Context = %+v, want the output before the interrupt", interrupted.Context)
+		}
+
+		// The next turn is not affected
+		mock.send(errorResult())
+		result, err = client.Run(ctx, "try again", nil)
+		if result.IsInterrupted() || types.IsTurnInterruptedError(err) || !types.IsResultError(err) {
+			t.Errorf("next turn: interrupted = %v, error = %v, want a plain ResultError", result.IsInterrupted(), err)
+		}
+	})
+
+	t.Run("Client.Interrupt", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Query(ctx, "write a long essay"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if err := client.Interrupt(ctx); err != nil {
+			t.Fatalf("Interrupt failed: %v", err)
+		}
+		mock.send(errorResult())
+
+		summary, err := Summarize(collectMessages(t, client.ReceiveResponse(ctx), 2*time.Second))
+		if err != nil {
+			t.Fatalf("Summarize failed: %v", err)
+		}
+		if !summary.Interrupted || !types.IsTurnInterruptedError(summary.Err()) {
+			t.Errorf("Interrupted = %v, Err() = %v, want a TurnInterruptedError", summary.Interrupted, summary.Err())
+		}
+		if !strings.HasPrefix(summary.String(), "Interrupted in") {
+			t.Errorf("String() = %q", summary.String())
+		}
+	})
+}
+
+// TestClient_ServerInfo tests that the initialize response is exposed after Connect.
+func TestClient_ServerInfo(t *testing.T) {
+	newTransport := func() *claudetest.Transport {
+		tr := claudetest.NewTransport()
+		claudetest.RespondWith(tr, "initialize", map[string]interface{}{
+			"capabilities": []interface{}{"hooks", "permissions"},
+			"commands": []interface{}{
+				map[string]interface{}{"name": "compact", "description": "Clear history but keep a summary"},
+				map[string]interface{}{"name": "review", "description": "Review a pull request"},
+			},
+			"output_style": "default",
+		})
+		return tr
+	}
+
+	t.Run("after Connect", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, err := NewClientWithTransport(ctx, newTransport(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close(ctx)
+		if info := client.ServerInfo(); info != nil {
+			t.Errorf("ServerInfo() before Connect = %+v, want nil", info)
+		}
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		info := client.ServerInfo()
+		if info == nil {
+			t.Fatal("ServerInfo() = nil after Connect")
+		}
+		if !slices.Equal(info.Capabilities, []string{"hooks", "permissions"}) || !info.HasCapability("hooks") || info.HasCapability("mcp") {
+			t.Errorf("Capabilities = %v", info.Capabilities)
+		}
+		if !slices.Equal(info.Commands, []string{"compact", "review"}) {
+			t.Errorf("Commands = %v", info.Commands)
+		}
+		if info.Raw["output_style"] != "default" {
+			t.Errorf("Raw = %v, want the full response", info.Raw)
+		}
+	})
+
+	t.Run("lazy initialization", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		tr := newTransport()
+		client, err := NewClientWithTransport(ctx, tr, types.NewClaudeAgentOptions().WithLazyInitialize(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close(ctx)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if info := client.ServerInfo(); info != nil {
+			t.Errorf("ServerInfo() before the deferred initialization = %+v, want nil", info)
+		}
+		if requests := tr.ControlRequests(); len(requests) != 0 {
+			t.Errorf("control requests before the first query = %v, want none", requests)
+		}
+		if err := client.Query(ctx, "hello"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if info := client.ServerInfo(); !info.HasCapability("permissions") {
+			t.Errorf("ServerInfo() after the first query = %+v", info)
+		}
+	})
+}
+
+// TestClient_SupportedCommands tests that slash commands are gathered from the
+// initialize response and the system init message, and that a CLI advertising
+// none gives an empty list.
+func TestClient_SupportedCommands(t *testing.T) {
+	initMessage := `{"type":"system","subtype":"init","cwd":"/work","session_id":"s-1",` +
+		`"tools":["Bash","Read","Edit"],"mcp_servers":[],"model":"claude-sonnet-4-5","permissionMode":"default",` +
+		`"slash_commands":["compact","context","cost","greet","review"],"apiKeySource":"none","output_style":"default"}`
+
+	t.Run("advertised", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		tr := claudetest.NewTransport()
+		claudetest.RespondWith(tr, "initialize", map[string]interface{}{
+			"commands": []interface{}{
+				map[string]interface{}{"name": "compact", "description": "Clear history but keep a summary", "argumentHint": "<instructions>"},
+				map[string]interface{}{"name": "greet", "description": "Say hello (plugin:hello)"},
+			},
+		})
+		client, err := NewClientWithTransport(ctx, tr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close(ctx)
+		if commands := client.SupportedCommands(); commands == nil || len(commands) != 0 {
+			t.Errorf("SupportedCommands() before Connect = %#v, want an empty slice", commands)
+		}
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := tr.SendJSON(initMessage); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.WaitForInit(ctx); err != nil {
+			t.Fatalf("WaitForInit failed: %v", err)
+		}
+
+		want := []types.SlashCommand{
+			{Name: "compact", Description: "Clear history but keep a summary", ArgumentHint: "<instructions>"},
+			{Name: "greet", Description: "Say hello (plugin:hello)"},
+			{Name: "context"},
+			{Name: "cost"},
+			{Name: "review"},
+		}
+		if got := client.SupportedCommands(); !slices.Equal(got, want) {
+			t.Errorf("SupportedCommands() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("none advertised", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, err := NewClientWithTransport(ctx, claudetest.NewTransport(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close(ctx)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if commands := client.SupportedCommands(); commands == nil || len(commands) != 0 {
+			t.Errorf("SupportedCommands() = %#v, want an empty slice", commands)
+		}
+	})
+}
+
+// TestClient_HookRegistration tests that hooks are registered in the
+// initialize request and run when the CLI calls them back.
+func TestClient_HookRegistration(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	var calls []string
+	hook := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		calls = append(calls, hookCtx.ToolName)
+		return map[string]interface{}{"decision": "block"}, nil
+	}
+	bash := "Bash"
+	opts := types.NewClaudeAgentOptions().
+		WithHook(types.HookEventPreToolUse, types.HookMatcher{Matcher: &bash, Hooks: []types.HookCallbackFunc{hook}}).
+		WithHook(types.HookEventStop, types.HookMatcher{Hooks: []types.HookCallbackFunc{hook, hook}})
+
+	tr := claudetest.NewTransport()
+	claudetest.RespondToInitialize(tr, "hooks")
+	client, err := NewClientWithTransport(ctx, tr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(ctx)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	init := claudetest.CapturedInitialize(t, tr)
+	preToolUse, stop := init.Hooks[types.HookEventPreToolUse], init.Hooks[types.HookEventStop]
+	if len(init.Hooks) != 2 || len(preToolUse) != 1 || len(stop) != 1 {
+		t.Fatalf("hooks = %+v, want one PreToolUse and one Stop matcher", init.Hooks)
+	}
+	if preToolUse[0].Matcher != "Bash|bash_tool" || len(preToolUse[0].CallbackIDs) != 1 {
+		t.Errorf("PreToolUse = %+v, want the widened matcher and one callback", preToolUse[0])
+	}
+	if stop[0].Matcher != "" || len(stop[0].CallbackIDs) != 2 {
+		t.Errorf("Stop = %+v, want no matcher and two callbacks", stop[0])
+	}
+
+	output, err := claudetest.InvokeHook(ctx, tr, preToolUse[0].CallbackIDs[0], map[string]interface{}{"tool_name": "bash_tool"})
+	if err != nil {
+		t.Fatalf("InvokeHook failed: %v", err)
+	}
+	if output["decision"] != "block" || !slices.Equal(calls, []string{"Bash"}) {
+		t.Errorf("hook output = %v after calls %v, want a block decision for Bash", output, calls)
+	}
+	if _, err := claudetest.InvokeHook(ctx, tr, "hook_unknown", nil); !types.IsControlProtocolError(err) {
+		t.Errorf("InvokeHook with an unknown callback = %v, want a ControlProtocolError", err)
+	}
+}
+
+// TestClient_ReceiveMessages tests streaming across results, and that it
+// shares the consumer slot with ReceiveResponse.
+func TestClient_ReceiveMessages(t *testing.T) {
+	t.Run("not connected", func(t *testing.T) {
+		client := newMockClient(t, nil, newMockTransport())
+		if _, ok := <-client.ReceiveMessages(context.Background()); ok {
+			t.Error("channel should be closed when not connected")
+		}
+	})
+
+	t.Run("streams across results", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		messages := client.ReceiveMessages(streamCtx)
+
+		for _, prompt := range []string{"first", "second"} {
+			if err := client.Query(ctx, prompt); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+		}
+		if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrConcurrentReceive) {
+			t.Errorf("ReceiveResponseE() error = %v, want ErrConcurrentReceive", err)
+		}
+		mock.send(&types.ResultMessage{Type: "result", Subtype: "success", SessionID: "s-1"})
+		mock.send(&types.SystemMessage{Type: "system", Subtype: "status"})
+		mock.send(&types.ResultMessage{Type: "result", Subtype: "success", SessionID: "s-1"})
+
+		var got []string
+		for len(got) < 3 {
+			select {
+			case msg := <-messages:
+				got = append(got, msg.GetMessageType())
+			case <-ctx.Done():
+				t.Fatalf("got %v before timing out", got)
+			}
+		}
+		if !slices.Equal(got, []string{"result", "system", "result"}) {
+			t.Errorf("received %v", got)
+		}
+
+		cancel()
+		collectMessages(t, messages, time.Second)
+
+		// Both results completed their turns, and the slot is free again
+		if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrNoPendingTurn) {
+			t.Errorf("ReceiveResponseE() error = %v, want ErrNoPendingTurn", err)
+		}
+	})
+}
+
+// TestClient_QueryWithContent tests that typed content blocks are sent as the
+// user message's content, and that invalid blocks are rejected before writing.
+func TestClient_QueryWithContent(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	invalid := []types.UserContentBlock{types.NewImageContentBase64("image/bmp", "aGk=")}
+	if err := client.QueryWithContent(ctx, invalid); !types.IsValidationError(err) {
+		t.Errorf("QueryWithContent(invalid) error = %v, want a ValidationError", err)
+	}
+	if slices.Contains(mock.writtenTypes(), "user") {
+		t.Fatal("invalid content was written to the CLI")
+	}
+
+	content := []types.UserContentBlock{
+		types.NewTextContent("What's in this image?"),
+		types.NewImageContentURL("https://example.com/cat.png"),
+	}
+	if err := client.QueryWithContent(ctx, content); err != nil {
+		t.Fatalf("QueryWithContent failed: %v", err)
+	}
+	mock.mu.Lock()
+	last := mock.written[len(mock.written)-1]
+	mock.mu.Unlock()
+	var sent struct {
+		Message struct {
+			Content []map[string]interface{} `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(last), &sent); err != nil {
+		t.Fatalf("written message is not JSON: %v", err)
+	}
+	if len(sent.Message.Content) != 2 || sent.Message.Content[0]["text"] != "What's in this image?" || sent.Message.Content[1]["type"] != "image" {
+		t.Errorf("sent content = %v", sent.Message.Content)
+	}
+}
+
+// TestClient_SendToolResult tests the user message written for a substituted
+// tool result, and that it parses back as the CLI's own tool results do.
+func TestClient_SendToolResult(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	if err := client.SendToolResult(ctx, "", "cached", false); !types.IsValidationError(err) {
+		t.Errorf("SendToolResult with no tool use ID: error = %v, want a ValidationError", err)
+	}
+	if slices.Contains(mock.writtenTypes(), "user") {
+		t.Fatal("an invalid tool result was written to the CLI")
+	}
+
+	if err := client.SendToolResult(ctx, "toolu_01", "Network access is disabled; cached data: 42", true); err != nil {
+		t.Fatalf("SendToolResult failed: %v", err)
+	}
+	mock.mu.Lock()
+	last := mock.written[len(mock.written)-1]
+	mock.mu.Unlock()
+	want := `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_01",` +
+		`"content":"Network access is disabled; cached data: 42","is_error":true}]},"parent_tool_use_id":null,"session_id":"default"}`
+	if last != want {
+		t.Errorf("written:\n%s\nwant:\n%s", last, want)
+	}
+
+	msg, err := types.UnmarshalMessage([]byte(last))
+	if err != nil {
+		t.Fatalf("written message does not parse: %v", err)
+	}
+	user, ok := msg.(*types.UserMessage)
+	if !ok || !user.HasToolResults() {
+		t.Errorf("written message parses as %#v, want a UserMessage with a tool result", msg)
+	}
+}
+
+// runawayCLI answers each prompt with an endless tool loop, which only an
+// interrupt stops. It reports any --max-turns flag as an error, like a CLI
+// that cannot honor it.
+const runawayCLI = `
+case " $* " in
+  *" --max-turns "*) flag=1 ;;
+esac
+while read line; do
+  case "$line" in
+    *control_request*)
+      id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+      case "$line" in
+        *'"subtype":"interrupt"'*)
+          kill $loop 2>/dev/null
+          wait $loop 2>/dev/null
+          echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+          echo '{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"s-loop","total_cost_usd":0.05}'
+          ;;
+        *)
+          echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+          ;;
+      esac
+      ;;
+    *'"type":"user"'*)
+      if [ -n "$flag" ]; then
+        echo '{"type":"result","subtype":"error_during_execution","is_error":true,"result":"unsupported flag --max-turns","session_id":"s-loop"}'
+        continue
+      fi
+      (
+        i=0
+        while :; do
+          i=$((i+1))
+          echo '{"type":"assistant","message":{"model":"m","content":[{"type":"tool_use","id":"t'$i'","name":"Bash","input":{"command":"make"}}]},"session_id":"s-loop"}'
+          echo '{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"t'$i'","content":"FAIL"}]},"session_id":"s-loop"}'
+          sleep 0.02
+        done
+      ) &
+      loop=$!
+      ;;
+  esac
+done
+`
+
+// TestClient_MaxTurnsEnforcedBySDK tests that MaxTurns stops a runaway tool
+// loop on a CLI profile without --max-turns: the turn ends with an
+// error_max_turns result after the limit, and the next query is unaffected.
+func TestClient_MaxTurnsEnforcedBySDK(t *testing.T) {
+	ctx := testContext(t, 15*time.Second)
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, runawayCLI)).
+		WithCLIProfile(types.CLIProfileV1).
+		WithMaxTurns(2)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close(ctx)
+
+	for _, prompt := range []string{"fix the build", "try again"} {
+		if err := client.Query(ctx, prompt); err != nil {
+			t.Fatalf("Query(%q) failed: %v", prompt, err)
+		}
+		msgs := collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second)
+		result := lastResult(t, msgs)
+
+		if result.Subtype != "error_max_turns" || !result.IsError || result.NumTurns != 2 || result.SessionID != "s-loop" {
+			t.Fatalf("%q: result = %+v, want error_max_turns after 2 turns", prompt, result)
+		}
+		if result.Meta == nil || !result.Meta.TurnLimitedBySDK {
+			t.Errorf("%q: result should be marked as limited by the SDK", prompt)
+		}
+		assistants := 0
+		for _, msg := range msgs {
+			if _, ok := msg.(*types.AssistantMessage); ok {
+				assistants++
+			}
+		}
+		if assistants != 2 {
+			t.Errorf("%q: received %d assistant messages, want 2", prompt, assistants)
+		}
+	}
+}
+
+// TestClient_DrainResponse tests that the rest of an abandoned response is
+// discarded, so the next ReceiveResponse only yields the new query's messages.
+func TestClient_DrainResponse(t *testing.T) {
+	text := func(text string) *types.AssistantMessage {
+		return &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: text}}}
+	}
+	result := func(text string) *types.ResultMessage {
+		return &types.ResultMessage{Type: "result", Subtype: "success", SessionID: "s-1", Result: &text}
+	}
+	texts := func(msgs []types.Message) []string {
+		var got []string
+		for _, msg := range msgs {
+			switch m := msg.(type) {
+			case *types.AssistantMessage:
+				got = append(got, m.Content[0].(*types.TextBlock).Text)
+			case *types.ResultMessage:
+				got = append(got, *m.Result)
+			}
+		}
+		return got
+	}
+
+	t.Run("drain", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.DrainResponse(ctx); err != nil {
+			t.Errorf("DrainResponse without a pending turn failed: %v", err)
+		}
+
+		// The consumer stops reading mid-response
+		if err := client.Query(ctx, "first"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		receiveCtx, cancelReceive := context.WithCancel(ctx)
+		messages := client.ReceiveResponse(receiveCtx)
+		mock.send(text("old 1"))
+		<-messages
+		cancelReceive()
+		mock.send(text("old 2"))
+		mock.send(result("old done"))
+
+		if err := client.DrainResponse(ctx); err != nil {
+			t.Fatalf("DrainResponse failed: %v", err)
+		}
+
+		if err := client.Query(ctx, "second"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		mock.send(text("new"))
+		mock.send(result("new done"))
+		got := texts(collectMessages(t, client.ReceiveResponse(ctx), 2*time.Second))
+		if !slices.Equal(got, []string{"new", "new done"}) {
+			t.Errorf("next response = %v, want [new new done]", got)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Query(ctx, "first"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		mock.send(text("old"))
+		mock.send(result("interrupted"))
+
+		if err := client.CancelResponse(ctx); err != nil {
+			t.Fatalf("CancelResponse failed: %v", err)
+		}
+		if !slices.Contains(mock.writtenTypes(), "interrupt") {
+			t.Errorf("CancelResponse did not interrupt the turn: %v", mock.writtenTypes())
+		}
+		if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrNoPendingTurn) {
+			t.Errorf("ReceiveResponseE after CancelResponse error = %v, want ErrNoPendingTurn", err)
+		}
+	})
+}
+
+// TestClient_Shutdown tests that Shutdown lets a pending turn finish before
+// closing, whether or not a consumer is reading it, and that Close and an
+// expired Shutdown interrupt the turn instead.
+func TestClient_Shutdown(t *testing.T) {
+	text := &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: "working"}}}
+	result := &types.ResultMessage{Type: "result", Subtype: "success"}
+	connect := func(t *testing.T, ctx context.Context) (*Client, *mockTransport) {
+		t.Helper()
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Query(ctx, "hi"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		return client, mock
+	}
+	shutdown := func(ctx context.Context, client *Client) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- client.Shutdown(ctx)
+		}()
+		return done
+	}
+
+	t.Run("waits for the consumer's result", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx)
+		messages := client.ReceiveResponse(ctx)
+		mock.send(text)
+		<-messages
+
+		done := shutdown(ctx, client)
+		select {
+		case err := <-done:
+			t.Fatalf("Shutdown returned before the turn finished: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		mock.send(result)
+		var got *types.ResultMessage
+		for msg := range messages {
+			if r, ok := msg.(*types.ResultMessage); ok {
+				got = r
+			}
+		}
+		if got == nil {
+			t.Error("consumer did not receive the result")
+		}
+		if err := <-done; err != nil {
+			t.Errorf("Shutdown failed: %v", err)
+		}
+		if client.IsConnected() {
+			t.Error("client still connected after Shutdown")
+		}
+		if slices.Contains(mock.writtenTypes(), "interrupt") {
+			t.Errorf("Shutdown interrupted the turn: %v", mock.writtenTypes())
+		}
+	})
+
+	t.Run("drains without a consumer", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx)
+		done := shutdown(ctx, client)
+		mock.send(text)
+		mock.send(result)
+
+		if err := <-done; err != nil {
+			t.Errorf("Shutdown failed: %v", err)
+		}
+		if client.IsConnected() {
+			t.Error("client still connected after Shutdown")
+		}
+		if err := client.Shutdown(ctx); err != nil {
+			t.Errorf("second Shutdown failed: %v", err)
+		}
+	})
+
+	t.Run("deadline interrupts the turn", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx)
+		messages := client.ReceiveResponse(ctx)
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		if err := client.Shutdown(shutdownCtx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Shutdown error = %v, want context.DeadlineExceeded", err)
+		}
+		if !slices.Contains(mock.writtenTypes(), "interrupt") {
+			t.Errorf("expired Shutdown did not interrupt the turn: %v", mock.writtenTypes())
+		}
+		// The consumer's response ends with the connection
+		collectMessages(t, messages, 2*time.Second)
+		if client.IsConnected() {
+			t.Error("client still connected after Shutdown")
+		}
+	})
+
+	t.Run("close interrupts the turn", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx)
+		messages := client.ReceiveResponse(ctx)
+
+		if err := client.Close(ctx); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+		if !slices.Contains(mock.writtenTypes(), "interrupt") {
+			t.Errorf("Close did not interrupt the turn: %v", mock.writtenTypes())
+		}
+		collectMessages(t, messages, 2*time.Second)
+		if err := client.Close(ctx); err != nil {
+			t.Errorf("second Close failed: %v", err)
+		}
+		if err := client.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown after Close failed: %v", err)
+		}
+	})
+}
+
+// TestClient_Stats tests that Stats accumulates the results of several
+// queries, with and without a reported cost, and that ResetStats cuts a window.
+func TestClient_Stats(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// Read concurrently with the queries; the race detector checks the access
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = client.Stats()
+			}
+		}
+	}()
+
+	turns := []struct {
+		model  string
+		result *types.ResultMessage
+	}{
+		{"claude-sonnet-4-5", &types.ResultMessage{
+			Type: "result", Subtype: "success", NumTurns: 2, DurationMs: 1000, DurationAPIMs: 800, TotalCostUSD: ptrFloat(0.01),
+			Usage: map[string]interface{}{"input_tokens": float64(100), "output_tokens": float64(20), "cache_read_input_tokens": float64(50)},
+		}},
+		{"claude-sonnet-4-5", &types.ResultMessage{
+			Type: "result", Subtype: "success", NumTurns: 1, DurationMs: 500, DurationAPIMs: 400,
+			Usage: map[string]interface{}{"input_tokens": float64(10), "output_tokens": float64(5)},
+		}},
+		{"claude-haiku-4-5", &types.ResultMessage{
+			Type: "result", Subtype: "success", NumTurns: 1, DurationMs: 250, DurationAPIMs: 200, TotalCostUSD: ptrFloat(0.002),
+			Usage: map[string]interface{}{"input_tokens": float64(30), "output_tokens": float64(7), "cache_creation_input_tokens": float64(40)},
+		}},
+	}
+	for i, turn := range turns {
+		if err := client.Query(ctx, fmt.Sprintf("question %d", i)); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		mock.send(&types.AssistantMessage{Type: "assistant", Model: turn.model, Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: "answer"}}})
+		mock.send(turn.result)
+		collectMessages(t, client.ReceiveResponse(ctx), 2*time.Second)
+	}
+
+	stats := client.Stats()
+	if stats.Queries != 3 || stats.Turns != 4 || stats.UnpricedResults != 1 {
+		t.Errorf("Queries, Turns, UnpricedResults = %d, %d, %d, want 3, 4, 1", stats.Queries, stats.Turns, stats.UnpricedResults)
+	}
+	if stats.CostUSD < 0.0119 || stats.CostUSD > 0.0121 {
+		t.Errorf("CostUSD = %v, want 0.012", stats.CostUSD)
+	}
+	if stats.Duration != 1750*time.Millisecond || stats.APIDuration != 1400*time.Millisecond {
+		t.Errorf("Duration, APIDuration = %s, %s, want 1.75s, 1.4s", stats.Duration, stats.APIDuration)
+	}
+	want := map[string]types.ModelUsage{
+		"claude-sonnet-4-5": {Results: 2, InputTokens: 110, OutputTokens: 25, CacheReadTokens: 50, CostUSD: 0.01},
+		"claude-haiku-4-5":  {Results: 1, InputTokens: 30, OutputTokens: 7, CacheCreationTokens: 40, CostUSD: 0.002},
+	}
+	if !reflect.DeepEqual(stats.Models, want) {
+		t.Errorf("Models = %+v, want %+v", stats.Models, want)
+	}
+
+	// The returned map is a copy
+	stats.Models["claude-haiku-4-5"] = types.ModelUsage{}
+	if client.Stats().Models["claude-haiku-4-5"].Results != 1 {
+		t.Error("modifying the returned stats changed the client's")
+	}
+
+	if window := client.ResetStats(); window.Queries != 3 {
+		t.Errorf("ResetStats() returned %d queries, want 3", window.Queries)
+	}
+	if stats := client.Stats(); stats.Queries != 0 || len(stats.Models) != 0 || stats.CostUSD != 0 {
+		t.Errorf("Stats() after ResetStats = %+v, want zero", stats)
+	}
+}
+
+// TestClient_ExcludedUserMessages tests that echoed UserMessages dropped by
+// the delivery policy are counted on the client.
+func TestClient_ExcludedUserMessages(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, types.NewClaudeAgentOptions().WithEchoedUserMessages(types.EchoedUserMessagesExclude), mock)
+	if n := client.ExcludedUserMessages(); n != 0 {
+		t.Errorf("ExcludedUserMessages() = %d before connecting, want 0", n)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	mock.send(&types.UserMessage{Type: "user", Content: "hi"})
+	mock.send(&types.UserMessage{
+		Type:    "user",
+		Content: []types.ContentBlock{&types.ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_1", Content: "ok"}},
+	})
+	mock.send(&types.ResultMessage{Type: "result", Subtype: "success"})
+
+	for _, msg := range collectMessages(t, client.ReceiveResponse(ctx), 2*time.Second) {
+		if _, ok := msg.(*types.UserMessage); ok {
+			t.Errorf("UserMessage delivered despite the exclude policy: %+v", msg)
+		}
+	}
+	if n := client.ExcludedUserMessages(); n != 2 {
+		t.Errorf("ExcludedUserMessages() = %d, want 2", n)
+	}
+}
+
+// TestClient_DroppedControlEvents tests that control events a blocked observer
+// cannot take are dropped and counted, without blocking message routing.
+func TestClient_DroppedControlEvents(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	var once sync.Once
+	observer := func(direction types.Direction, subtype string, payload map[string]interface{}) {
+		once.Do(func() { close(started) })
+		<-release
+	}
+	mock := newMockTransport()
+	client := newMockClient(t, types.NewClaudeAgentOptions().WithControlObserver(observer), mock)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	// The observer is stuck on the initialize request, with its response queued
+	<-started
+
+	// Orphaned responses are observed and otherwise ignored; 255 of them fill
+	// the observer's queue of 256
+	for i := 0; i < 300; i++ {
+		mock.send(&types.SystemMessage{Type: "control_response", Response: map[string]interface{}{
+			"subtype":    "success",
+			"request_id": fmt.Sprintf("req_orphan_%d", i),
+		}})
+	}
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	mock.send(&types.ResultMessage{Type: "result", Subtype: "success"})
+	lastResult(t, collectMessages(t, client.ReceiveResponse(ctx), 2*time.Second))
+
+	if n := client.DroppedControlEvents(); n != 45 {
+		t.Errorf("DroppedControlEvents() = %d, want 45", n)
+	}
+}
+
+// TestClient_LogPrefixes tests that the log lines of two concurrent clients
+// carry distinct connection IDs, and their session IDs once known.
+func TestClient_LogPrefixes(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w // Loggers write to the stderr of the time they are created
+	t.Cleanup(func() { os.Stderr = stderr })
+	captured := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		captured <- string(data)
+	}()
+
+	sessions := []string{"11111111-aaaa", "22222222-bbbb"}
+	clients := make([]*Client, len(sessions))
+	for i := range sessions {
+		clients[i] = newMockClient(t, types.NewClaudeAgentOptions().WithVerbose(true), newMockTransport())
+	}
+	os.Stderr = stderr
+
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := testContext(t, 5*time.Second)
+			mock := client.transport.(*mockTransport)
+			if err := client.Connect(ctx); err != nil {
+				t.Errorf("Connect failed: %v", err)
+				return
+			}
+			mock.send(&types.SystemMessage{Type: "system", Subtype: "init", SessionID: sessions[i]})
+			if err := client.WaitForInit(ctx); err != nil {
+				t.Errorf("WaitForInit failed: %v", err)
+			}
+			_ = client.Close(ctx)
+		}()
+	}
+	wg.Wait()
+	_ = w.Close()
+	output := <-captured
+
+	conns := make(map[string]bool)
+	for i, client := range clients {
+		conn := client.logger.Field("conn")
+		conns[conn] = true
+		prefix := fmt.Sprintf("[conn=%s session=%s] ", conn, sessions[i][:8])
+		if !strings.Contains(output, "[SDK INFO] "+prefix+"Closing Claude connection") {
+			t.Errorf("no close line prefixed with %q in:\n%s", prefix, output)
+		}
+	}
+	if len(conns) != 2 {
+		t.Errorf("connection IDs %v are not distinct", conns)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if !strings.HasPrefix(line, "[SDK ") || !strings.Contains(line, "] [conn=") {
+			t.Errorf("line without a connection prefix: %q", line)
+		}
+	}
+}
+
+// brokenCLI answers control requests; a prompt containing "garbled" gets a
+// line of invalid JSON before a normal answer, and one containing "crash"
+// makes the CLI exit partway through its answer.
+const brokenCLI = `
+while read line; do
+  case "$line" in
+    *control_request*)
+      id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+      echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+      ;;
+    *garbled*)
+      echo '{"type":"assistant","message":'
+      echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"fine"}]}}'
+      echo '{"type":"result","subtype":"success","is_error":false,"result":"fine","session_id":"s-broken"}'
+      ;;
+    *crash*)
+      echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"partial"}]}}'
+      exit 3
+      ;;
+  esac
+done
+`
+
+// TestClient_StreamErrors tests that malformed output and the CLI dying
+// mid-turn are delivered to ReceiveResponse consumers as ErrorMessages.
+func TestClient_StreamErrors(t *testing.T) {
+	ctx := testContext(t, 10*time.Second)
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, brokenCLI)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close(ctx)
+
+	if err := client.Query(ctx, "garbled"); err != nil {
+		t.Fatal(err)
+	}
+	messages := collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second)
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want error, assistant and result: %v", len(messages), messages)
+	}
+	if errMsg, ok := messages[0].(*types.ErrorMessage); !ok || !types.IsJSONDecodeError(errMsg) {
+		t.Errorf("messages[0] = %#v, want an ErrorMessage wrapping a JSONDecodeError", messages[0])
+	}
+	lastResult(t, messages)
+	if err := client.Err(); err != nil {
+		t.Errorf("Err() after malformed output = %v, want nil", err)
+	}
+
+	if err := client.Query(ctx, "crash"); err != nil {
+		t.Fatal(err)
+	}
+	messages = collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second)
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want assistant and error: %v", len(messages), messages)
+	}
+	errMsg, ok := messages[1].(*types.ErrorMessage)
+	if !ok || !types.IsCLIConnectionError(errMsg) {
+		t.Fatalf("last message = %#v, want an ErrorMessage wrapping a CLIConnectionError", messages[1])
+	}
+	if types.IsJSONDecodeError(errMsg) {
+		t.Errorf("error = %v, want the earlier malformed line left out", errMsg)
+	}
+	if err := client.Err(); err != errMsg.Err {
+		t.Errorf("Err() = %v, want the delivered error", err)
+	}
+}
+
+// lockingOptions returns options resuming a fixture session stored in a
+// temporary configuration directory, with the given locking mode.
+func lockingOptions(t *testing.T, cliPath string, mode types.SessionLockMode) *types.ClaudeAgentOptions {
+	t.Helper()
+
+	configDir, cwd := t.TempDir(), t.TempDir()
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cliPath).
+		WithCWD(cwd).
+		WithEnvVar("CLAUDE_CONFIG_DIR", configDir).
+		WithResume("s-fixture").
+		WithSessionLocking(mode)
+	sessionFile, err := transport.SessionFilePath(opts, cwd, "s-fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(sessionFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sessionFile, []byte(`{"type":"user","sessionId":"s-fixture"}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// TestClient_SessionLocking tests that two clients of this process cannot
+// resume the same session at once.
+func TestClient_SessionLocking(t *testing.T) {
+	cliPath := writeMockCLI(t, scriptCLI)
+
+	t.Run("fail", func(t *testing.T) {
+		ctx := testContext(t, 10*time.Second)
+		opts := lockingOptions(t, cliPath, types.SessionLockFail)
+		first, err := NewClient(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := first.Connect(ctx); err != nil {
+			t.Fatalf("first Connect failed: %v", err)
+		}
+
+		second, err := NewClient(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = second.Connect(ctx)
+		var locked *types.SessionLockedError
+		if !errors.As(err, &locked) {
+			t.Fatalf("second Connect = %v, want SessionLockedError", err)
+		}
+		if locked.SessionID != "s-fixture" || locked.HolderPID != os.Getpid() {
+			t.Errorf("SessionLockedError = %+v, want s-fixture held by this process", locked)
+		}
+
+		if err := first.Close(ctx); err != nil {
+			t.Logf("Close: %v", err)
+		}
+		if err := second.Connect(ctx); err != nil {
+			t.Fatalf("Connect after the holder closed failed: %v", err)
+		}
+		_ = second.Close(ctx)
+	})
+
+	t.Run("block", func(t *testing.T) {
+		ctx := testContext(t, 10*time.Second)
+		opts := lockingOptions(t, cliPath, types.SessionLockBlock)
+		first, err := NewClient(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := first.Connect(ctx); err != nil {
+			t.Fatalf("first Connect failed: %v", err)
+		}
+
+		second, err := NewClient(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shortCtx, cancel := context.WithTimeout(ctx, 150*time.Millisecond)
+		err = second.Connect(shortCtx)
+		cancel()
+		if !types.IsSessionLockedError(err) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Connect with a short deadline = %v, want SessionLockedError and DeadlineExceeded", err)
+		}
+
+		connected := make(chan error, 1)
+		go func() { connected <- second.Connect(ctx) }()
+		select {
+		case err := <-connected:
+			t.Fatalf("second Connect returned %v while the session was held", err)
+		case <-time.After(150 * time.Millisecond):
+		}
+		_ = first.Close(ctx)
+		if err := <-connected; err != nil {
+			t.Fatalf("second Connect failed after the holder closed: %v", err)
+		}
+		_ = second.Close(ctx)
+	})
+}
+
+// TestClient_OnDisconnect tests that the OnDisconnect callback reports a
+// killed CLI as a ProcessError, once, and is not invoked by Close.
+func TestClient_OnDisconnect(t *testing.T) {
+	cliPath := writeMockCLI(t, `echo $$ > "$MOCK_PID_FILE"`+scriptCLI)
+
+	connect := func(t *testing.T) (*Client, chan error, string) {
+		t.Helper()
+
+		pidFile := filepath.Join(t.TempDir(), "pid")
+		disconnects := make(chan error, 2)
+		opts := types.NewClaudeAgentOptions().
+			WithCLIPath(cliPath).
+			WithEnvVar("MOCK_PID_FILE", pidFile).
+			WithOnDisconnect(func(err error) { disconnects <- err })
+		ctx := testContext(t, 10*time.Second)
+		client, err := NewClient(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		return client, disconnects, pidFile
+	}
+
+	t.Run("killed", func(t *testing.T) {
+		client, disconnects, pidFile := connect(t)
+		defer client.Close(context.Background())
+
+		data, err := os.ReadFile(pidFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		process, err := os.FindProcess(pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := process.Kill(); err != nil {
+			t.Fatalf("failed to kill the mock CLI: %v", err)
+		}
+
+		select {
+		case err := <-disconnects:
+			if !types.IsProcessError(err) {
+				t.Fatalf("OnDisconnect(%v), want a ProcessError", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("OnDisconnect was not invoked after the CLI was killed")
+		}
+
+		_ = client.Close(context.Background())
+		select {
+		case err := <-disconnects:
+			t.Errorf("OnDisconnect invoked again with %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		client, disconnects, _ := connect(t)
+		if err := client.Close(context.Background()); err != nil {
+			t.Logf("Close: %v", err)
+		}
+
+		select {
+		case err := <-disconnects:
+			t.Errorf("OnDisconnect invoked by Close with %v", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+}
+
+// TestClient_IdleTimeout tests that a client unused for its idle timeout
+// closes itself, that activity and a response being received keep it open,
+// and that calls on the closed client report ErrClientClosed.
+func TestClient_IdleTimeout(t *testing.T) {
+	connect := func(t *testing.T, ctx context.Context, timeout time.Duration) (*Client, *mockTransport) {
+		mock := newMockTransport()
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithIdleTimeout(timeout), mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		return client, mock
+	}
+	result := &types.ResultMessage{Type: "result", Subtype: "success"}
+
+	t.Run("unused client closes", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx, 100*time.Millisecond)
+
+		deadline := time.Now().Add(2 * time.Second)
+		for client.IsConnected() {
+			if time.Now().After(deadline) {
+				t.Fatal("client was not closed after its idle timeout")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		mock.mu.Lock()
+		closed := mock.closed
+		mock.mu.Unlock()
+		if !closed {
+			t.Error("transport was not closed")
+		}
+
+		if err := client.Query(ctx, "hi"); !errors.Is(err, types.ErrClientClosed) || !types.IsCLIConnectionError(err) {
+			t.Errorf("Query = %v, want a CLIConnectionError matching ErrClientClosed", err)
+		}
+		if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrClientClosed) {
+			t.Errorf("ReceiveResponseE = %v, want ErrClientClosed", err)
+		}
+		if err := client.Interrupt(ctx); !errors.Is(err, types.ErrClientClosed) {
+			t.Errorf("Interrupt = %v, want ErrClientClosed", err)
+		}
+		if err := client.Ping(ctx); !errors.Is(err, types.ErrClientClosed) || !types.IsHealthCheckError(err) {
+			t.Errorf("Ping = %v, want a HealthCheckError matching ErrClientClosed", err)
+		}
+	})
+
+	t.Run("activity keeps the client open", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx, 150*time.Millisecond)
+
+		for i := 0; i < 6; i++ {
+			time.Sleep(60 * time.Millisecond)
+			if i%2 == 0 {
+				if err := client.Ping(ctx); err != nil {
+					t.Fatalf("Ping failed: %v", err)
+				}
+				continue
+			}
+			if err := client.Query(ctx, "hi"); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			mock.send(result)
+			collectMessages(t, client.ReceiveResponse(ctx), time.Second)
+		}
+		if !client.IsConnected() {
+			t.Fatal("client closed although it was in use")
+		}
+	})
+
+	t.Run("response being received keeps the client open", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx, 100*time.Millisecond)
+
+		if err := client.Query(ctx, "hi"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		responses := client.ReceiveResponse(ctx)
+		time.Sleep(300 * time.Millisecond)
+		if !client.IsConnected() {
+			t.Fatal("client closed while a response was being received")
+		}
+		mock.send(result)
+		if messages := collectMessages(t, responses, time.Second); len(messages) != 1 {
+			t.Errorf("got %d messages, want the result", len(messages))
+		}
+	})
+}
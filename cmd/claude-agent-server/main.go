@@ -0,0 +1,145 @@
+// Command claude-agent-server lets programs in other languages drive Claude
+// through this SDK, with the server's permission policy, over newline-delimited
+// JSON-RPC 2.0 on stdio or a unix socket. Each line is one JSON-RPC message,
+// and payloads use the JSON encoding of the SDK's types.
+//
+// The caller sends these requests:
+//
+//	connect    {"options": {...}, "permission_callback": true} -> {"client": "c1"}
+//	query      {"client": "c1", "prompt": "..."}              -> {}
+//	interrupt  {"client": "c1"}                               -> {}
+//	close      {"client": "c1", "graceful": true, "timeout_ms": 30000} -> {}
+//
+// A graceful close fails when the turn does not finish within timeout_ms; the
+// client is closed either way.
+//
+// The options of connect use the keys of types.LoadOptionsFromFile and apply
+// on top of the -config file. Callers may set the keys that shape the
+// conversation (model, system_prompt, max_turns, resume, ...); the keys that
+// decide what the CLI may run, such as cli_path, permission_mode,
+// allowed_tools, disallowed_tools, env, extra_args, settings and mcp_servers,
+// are rejected and only the -config file sets them.
+//
+// After connect, every message of the client is sent to the caller in order as
+// a notification, and a last one when the client is closed:
+//
+//	message  {"client": "c1", "message": {"type": "assistant", ...}}
+//	closed   {"client": "c1"}
+//
+// Tools matching -allow or -deny are decided by the server. With
+// permission_callback, the server asks the caller about the other tools with a
+// request of its own, answered with a types.PermissionResultAllow or
+// types.PermissionResultDeny:
+//
+//	can_use_tool  {"client": "c1", "tool_name": "Bash", "input": {...}, "context": {...}}
+//	              -> {"behavior": "allow"} or {"behavior": "deny", "message": "..."}
+//
+// A caller that does not answer within -permission-timeout, or answers with an
+// error, gets the -permission-default decision. Without permission_callback,
+// tools matching neither list are denied when a list is set, and otherwise
+// left to the CLI's permission mode.
+//
+// Usage:
+//
+//	claude-agent-server [-socket path] [-config file] [-cli path] [-allow tools] [-deny tools]
+//	                    [-permission-timeout 30s] [-permission-default deny]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func main() {
+	socket := flag.String("socket", "", "listen on this unix socket instead of serving stdio")
+	configFile := flag.String("config", "", "JSON options file the callers' options apply on top of")
+	cliPath := flag.String("cli", "", "path of the Claude CLI, overriding the -config file's cli_path")
+	allow := flag.String("allow", "", "comma-separated tools (or prefix* patterns) allowed without asking the caller")
+	deny := flag.String("deny", "", "comma-separated tools (or prefix* patterns) always denied")
+	permissionTimeout := flag.Duration("permission-timeout", 30*time.Second, "how long the caller has to decide a tool")
+	permissionDefault := flag.String("permission-default", "deny", `decision when the caller does not decide a tool: "allow" or "deny"`)
+	flag.Parse()
+
+	// stdout carries the protocol in stdio mode
+	logger := log.New(os.Stderr, "claude-agent-server: ", log.LstdFlags)
+
+	cfg := config{
+		cliPath:           *cliPath,
+		allow:             splitList(*allow),
+		deny:              splitList(*deny),
+		permissionTimeout: *permissionTimeout,
+		permissionDefault: *permissionDefault,
+	}
+	if cfg.permissionDefault != "allow" && cfg.permissionDefault != "deny" {
+		logger.Fatalf(`-permission-default must be "allow" or "deny", got %q`, cfg.permissionDefault)
+	}
+	if *configFile != "" {
+		base, err := types.LoadOptionsFromFile(*configFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.base = base
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	if *socket == "" {
+		err = serve(ctx, os.Stdin, os.Stdout, cfg, logger)
+	} else {
+		err = listen(ctx, *socket, cfg, logger)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Fatal(err)
+	}
+}
+
+// listen serves every connection to the unix socket at path until ctx is done.
+func listen(ctx context.Context, path string, cfg config, logger *log.Logger) error {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", path, err)
+	}
+	defer listener.Close()
+	context.AfterFunc(ctx, func() { _ = listener.Close() })
+	logger.Printf("listening on %s", path)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := serve(ctx, conn, conn, cfg, logger); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Printf("connection ended: %v", err)
+			}
+		}()
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeServerError    = -32000 // The SDK returned an error
+)
+
+// message is a JSON-RPC 2.0 request, notification or response, one per line.
+// A request has a method and an id, a notification a method and no id, and a
+// response an id and either a result or an error.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error object of a JSON-RPC response.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// invalidParams returns the error for a request whose params are unusable.
+func invalidParams(format string, args ...interface{}) *rpcError {
+	return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// serverError returns the error for a request the SDK failed.
+func serverError(err error) *rpcError {
+	return &rpcError{Code: codeServerError, Message: err.Error()}
+}
+
+// connectParams are the params of "connect". Options uses the keys of
+// types.LoadOptionsFromFile. With PermissionCallback, tools the server's
+// policy does not decide are sent to the caller as "can_use_tool" requests.
+type connectParams struct {
+	Options            json.RawMessage `json:"options,omitempty"`
+	PermissionCallback bool            `json:"permission_callback,omitempty"`
+}
+
+// connectResult is the result of "connect".
+type connectResult struct {
+	Client string `json:"client"`
+}
+
+// clientParams name the client a request is for.
+type clientParams struct {
+	Client string `json:"client"`
+}
+
+// queryParams are the params of "query".
+type queryParams struct {
+	Client string `json:"client"`
+	Prompt string `json:"prompt"`
+}
+
+// closeParams are the params of "close". With Graceful, the turn in flight
+// finishes first (see Client.Shutdown), for at most TimeoutMs milliseconds
+// when positive.
+type closeParams struct {
+	Client    string `json:"client"`
+	Graceful  bool   `json:"graceful,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+}
+
+// messageParams are the params of the "message" notification, one per
+// message of a client, in order. Message is encoded as by the SDK's types.
+type messageParams struct {
+	Client  string      `json:"client"`
+	Message interface{} `json:"message"`
+}
+
+// canUseToolParams are the params of the "can_use_tool" request the server
+// sends the caller. The result is a types.PermissionResultAllow or
+// types.PermissionResultDeny, told apart by "behavior".
+type canUseToolParams struct {
+	Client   string                      `json:"client"`
+	ToolName string                      `json:"tool_name"`
+	Input    map[string]interface{}      `json:"input"`
+	Context  types.ToolPermissionContext `json:"context"`
+}
+
+// emptyResult is the result of requests that return nothing.
+type emptyResult struct{}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// maxLineBytes bounds one JSON-RPC message; tool inputs can be large.
+const maxLineBytes = 16 << 20
+
+// config is how the server treats every connection.
+type config struct {
+	base              *types.ClaudeAgentOptions // Options the caller's options apply on top of
+	cliPath           string                    // Overrides the base options' cli_path when set
+	allow, deny       []string                  // Tools decided without asking the caller
+	permissionTimeout time.Duration             // How long the caller has to decide a tool
+	permissionDefault string                    // "allow" or "deny" when the caller does not decide
+}
+
+// conn serves one caller: its requests, the clients it connected, and the
+// requests the server sends it.
+type conn struct {
+	cfg    config
+	logger *log.Logger
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu         sync.Mutex
+	clients    map[string]*claude.Client
+	nextClient int
+	calls      map[string]chan *message // Requests sent to the caller, by id
+	nextCall   int
+
+	wg sync.WaitGroup // Request handlers and message forwarders
+}
+
+// serve reads requests from r and writes responses and notifications to w
+// until r ends or ctx is done. Requests are handled concurrently, so a caller
+// can answer "can_use_tool" while its "query" or "close" is in progress. The
+// clients of the connection are closed when it ends.
+func serve(ctx context.Context, r io.Reader, w io.Writer, cfg config, logger *log.Logger) error {
+	ctx, cancel := context.WithCancel(ctx)
+	if cfg.base == nil {
+		cfg.base = types.NewClaudeAgentOptions()
+	}
+
+	c := &conn{
+		cfg:     cfg,
+		logger:  logger,
+		enc:     json.NewEncoder(w),
+		clients: make(map[string]*claude.Client),
+		calls:   make(map[string]chan *message),
+	}
+	defer func() {
+		cancel()
+		c.closeAll()
+		c.wg.Wait()
+	}()
+
+	// Stop reading when ctx ends, even if r blocks
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			return err
+		case line := <-lines:
+			c.handleLine(ctx, line)
+		}
+	}
+}
+
+// handleLine dispatches one message from the caller.
+func (c *conn) handleLine(ctx context.Context, line []byte) {
+	if len(line) == 0 {
+		return
+	}
+	var msg message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		c.respond(nil, nil, &rpcError{Code: codeParseError, Message: err.Error()})
+		return
+	}
+
+	switch {
+	case msg.Method != "":
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			result, rpcErr := c.handleRequest(ctx, msg.Method, msg.Params)
+			if msg.ID != nil {
+				c.respond(msg.ID, result, rpcErr)
+			}
+		}()
+	case msg.ID != nil:
+		c.deliverResponse(&msg)
+	default:
+		c.respond(nil, nil, &rpcError{Code: codeInvalidRequest, Message: "message is neither a request nor a response"})
+	}
+}
+
+// handleRequest runs one request from the caller.
+func (c *conn) handleRequest(ctx context.Context, method string, params json.RawMessage) (interface{}, *rpcError) {
+	switch method {
+	case "connect":
+		var p connectParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return c.connect(ctx, p)
+	case "query":
+		var p queryParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		client, rpcErr := c.client(p.Client)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		if err := client.Query(ctx, p.Prompt); err != nil {
+			return nil, serverError(err)
+		}
+		return emptyResult{}, nil
+	case "interrupt":
+		var p clientParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		client, rpcErr := c.client(p.Client)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		if err := client.Interrupt(ctx); err != nil {
+			return nil, serverError(err)
+		}
+		return emptyResult{}, nil
+	case "close":
+		var p closeParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return c.close(ctx, p)
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("unknown method %q", method)}
+	}
+}
+
+// decodeParams decodes the params of a request into v.
+func decodeParams(params json.RawMessage, v interface{}) *rpcError {
+	if len(params) == 0 {
+		return invalidParams("missing params")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return invalidParams("%v", err)
+	}
+	return nil
+}
+
+// callerOptions are the option keys a caller may set. The others decide what
+// the CLI may run or touch (cli_path, permission_mode, allowed_tools,
+// disallowed_tools, env, extra_args, settings, mcp_servers, ...) and only the
+// -config file sets them, so that a caller cannot get around the server's
+// permission policy.
+var callerOptions = map[string]bool{
+	"system_prompt":               true,
+	"continue_conversation":       true,
+	"resume":                      true,
+	"fork_session":                true,
+	"model":                       true,
+	"model_fallbacks":             true,
+	"max_turns":                   true,
+	"max_thinking_tokens":         true,
+	"max_budget_usd":              true,
+	"max_image_size":              true,
+	"max_image_dimension":         true,
+	"downscale_images":            true,
+	"image_jpeg_quality":          true,
+	"include_partial_messages":    true,
+	"echoed_user_messages":        true,
+	"mirror_tool_status":          true,
+	"user":                        true,
+	"auto_continue_on_truncation": true,
+	"query_timeout":               true,
+	"idle_timeout":                true,
+	"fail_on_refusal":             true,
+}
+
+// connect creates and connects a client with the caller's options, and starts
+// forwarding its messages to the caller as "message" notifications.
+func (c *conn) connect(ctx context.Context, p connectParams) (interface{}, *rpcError) {
+	opts := c.cfg.base.Clone()
+	if len(p.Options) > 0 {
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(p.Options, &keys); err != nil {
+			return nil, invalidParams("options: %v", err)
+		}
+		for key := range keys {
+			if !callerOptions[key] {
+				return nil, invalidParams("options: %q cannot be set by the caller", key)
+			}
+		}
+		merged, err := types.MergeOptionsJSON(c.cfg.base, p.Options)
+		if err != nil {
+			return nil, invalidParams("options: %v", err)
+		}
+		opts = merged
+	}
+	if c.cfg.cliPath != "" {
+		opts.WithCLIPath(c.cfg.cliPath)
+	}
+
+	c.mu.Lock()
+	c.nextClient++
+	id := "c" + strconv.Itoa(c.nextClient)
+	c.mu.Unlock()
+
+	// The server's policy decides first; the caller decides the rest
+	policy := claude.PermissionPolicy{Allow: c.cfg.allow, Deny: c.cfg.deny}
+	if p.PermissionCallback {
+		policy.Decide = c.remoteDecision(ctx, id)
+	}
+	if p.PermissionCallback || len(policy.Allow) > 0 || len(policy.Deny) > 0 {
+		opts.WithCanUseTool(policy.CanUseTool())
+	}
+
+	client, err := claude.NewClient(ctx, opts)
+	if err != nil {
+		return nil, serverError(err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		return nil, serverError(err)
+	}
+
+	c.mu.Lock()
+	c.clients[id] = client
+	c.mu.Unlock()
+
+	messages := client.ReceiveMessages(ctx)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for msg := range messages {
+			c.notify("message", messageParams{Client: id, Message: msg})
+		}
+		c.notify("closed", clientParams{Client: id})
+	}()
+	return connectResult{Client: id}, nil
+}
+
+// close closes a client, letting its turn finish first if asked to. It fails
+// only when the turn does not finish within the caller's timeout.
+func (c *conn) close(ctx context.Context, p closeParams) (interface{}, *rpcError) {
+	client, rpcErr := c.client(p.Client)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	c.mu.Lock()
+	delete(c.clients, p.Client)
+	c.mu.Unlock()
+
+	var err error
+	if p.Graceful {
+		if p.TimeoutMs > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(p.TimeoutMs)*time.Millisecond)
+			defer cancel()
+		}
+		err = client.Shutdown(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			// The turn was cut short, which the caller asked to avoid
+			return nil, serverError(err)
+		}
+	} else {
+		err = client.Close(ctx)
+	}
+	// The client is closed either way; how its CLI exited is the server's concern
+	if err != nil {
+		c.logger.Printf("closing client %s: %v", p.Client, err)
+	}
+	return emptyResult{}, nil
+}
+
+// closeAll closes the clients the caller left open.
+func (c *conn) closeAll() {
+	c.mu.Lock()
+	clients := c.clients
+	c.clients = make(map[string]*claude.Client)
+	c.mu.Unlock()
+
+	for id, client := range clients {
+		if err := client.Close(context.Background()); err != nil {
+			c.logger.Printf("closing client %s: %v", id, err)
+		}
+	}
+}
+
+// client returns the caller's client named id.
+func (c *conn) client(id string) (*claude.Client, *rpcError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	client, ok := c.clients[id]
+	if !ok {
+		return nil, invalidParams("unknown client %q", id)
+	}
+	return client, nil
+}
+
+// remoteDecision returns the permission callback that asks the caller about
+// the tools of client id. When the caller does not answer within the
+// permission timeout, answers with an error, or answers something other than
+// allow or deny, the server's default decision applies.
+func (c *conn) remoteDecision(connCtx context.Context, id string) types.CanUseToolFunc {
+	return func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+		callCtx, cancel := context.WithTimeout(ctx, c.cfg.permissionTimeout)
+		defer cancel()
+		// Give up when the caller goes away, too
+		stop := context.AfterFunc(connCtx, cancel)
+		defer stop()
+
+		raw, err := c.call(callCtx, "can_use_tool", canUseToolParams{Client: id, ToolName: toolName, Input: input, Context: permCtx})
+		if err != nil {
+			return c.defaultDecision(toolName, err), nil
+		}
+		var reply struct {
+			Behavior string `json:"behavior"`
+		}
+		if err := json.Unmarshal(raw, &reply); err != nil {
+			return c.defaultDecision(toolName, err), nil
+		}
+		switch reply.Behavior {
+		case "allow":
+			var allow types.PermissionResultAllow
+			if err := json.Unmarshal(raw, &allow); err != nil {
+				return c.defaultDecision(toolName, err), nil
+			}
+			return &allow, nil
+		case "deny":
+			var deny types.PermissionResultDeny
+			if err := json.Unmarshal(raw, &deny); err != nil {
+				return c.defaultDecision(toolName, err), nil
+			}
+			return &deny, nil
+		default:
+			return c.defaultDecision(toolName, fmt.Errorf("unknown behavior %q", reply.Behavior)), nil
+		}
+	}
+}
+
+// defaultDecision is the permission result when the caller did not decide
+// toolName because of err.
+func (c *conn) defaultDecision(toolName string, err error) interface{} {
+	c.logger.Printf("no permission decision for %s from the caller, applying %q: %v", toolName, c.cfg.permissionDefault, err)
+	if c.cfg.permissionDefault == "allow" {
+		return &types.PermissionResultAllow{Behavior: "allow"}
+	}
+	return &types.PermissionResultDeny{Behavior: "deny", Message: fmt.Sprintf("no permission decision for %s: %v", toolName, err)}
+}
+
+// call sends a request to the caller and waits for its result.
+func (c *conn) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	c.mu.Lock()
+	c.nextCall++
+	id := "s" + strconv.Itoa(c.nextCall)
+	reply := make(chan *message, 1)
+	c.calls[id] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, id)
+		c.mu.Unlock()
+	}()
+
+	rawID, _ := json.Marshal(id)
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.write(&message{JSONRPC: "2.0", ID: rawID, Method: method, Params: rawParams}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-reply:
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// deliverResponse hands the caller's response to the call waiting for it.
+// Responses to calls that gave up are dropped.
+func (c *conn) deliverResponse(msg *message) {
+	var id string
+	if err := json.Unmarshal(msg.ID, &id); err != nil {
+		c.logger.Printf("dropping response with id %s: %v", msg.ID, err)
+		return
+	}
+	c.mu.Lock()
+	reply, ok := c.calls[id]
+	c.mu.Unlock()
+	if !ok {
+		c.logger.Printf("dropping response to %s, which is no longer waiting", id)
+		return
+	}
+	select {
+	case reply <- msg:
+	default:
+		c.logger.Printf("dropping duplicate response to %s", id)
+	}
+}
+
+// respond writes the response to the request id.
+func (c *conn) respond(id json.RawMessage, result interface{}, rpcErr *rpcError) {
+	msg := &message{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if id == nil {
+		msg.ID = json.RawMessage("null")
+	}
+	if rpcErr == nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			msg.Error = &rpcError{Code: codeServerError, Message: err.Error()}
+		} else {
+			msg.Result = raw
+		}
+	}
+	if err := c.write(msg); err != nil {
+		c.logger.Printf("writing response: %v", err)
+	}
+}
+
+// notify writes a notification.
+func (c *conn) notify(method string, params interface{}) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		c.logger.Printf("encoding %s notification: %v", method, err)
+		return
+	}
+	if err := c.write(&message{JSONRPC: "2.0", Method: method, Params: raw}); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		c.logger.Printf("writing %s notification: %v", method, err)
+	}
+}
+
+// write writes msg as one line.
+func (c *conn) write(msg *message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.enc.Encode(msg)
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockCLI acknowledges control requests and answers each prompt with
+// "Answer <n>.". A prompt mentioning "permission" first asks to use Bash and
+// answers with the decision instead.
+const mockCLI = `#!/bin/sh
+turn=0
+while read line; do
+  case "$line" in
+    *control_request*)
+      id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+      echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+      ;;
+    *permission*)
+      turn=$((turn+1))
+      echo '{"type":"control_request","request_id":"perm-'$turn'","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"ls"},"permission_suggestions":[]}}'
+      read reply
+      case "$reply" in
+        *'"behavior":"allow"'*) text="Bash allowed." ;;
+        *) text="Bash denied." ;;
+      esac
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"'"$text"'"}],"model":"claude-test"}}'
+      echo '{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s-1"}'
+      ;;
+    *'"type":"user"'*)
+      turn=$((turn+1))
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Answer '$turn'."}],"model":"claude-test"}}'
+      echo '{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s-1"}'
+      ;;
+  esac
+done
+`
+
+// writeMockCLI writes mockCLI to an executable file.
+func writeMockCLI(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("mock CLI is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(path, []byte(mockCLI), 0o755); err != nil {
+		t.Fatalf("writing mock CLI failed: %v", err)
+	}
+	return path
+}
+
+// remote is a scripted caller of the server. It reads the server's messages on
+// the test's goroutine, answering "can_use_tool" with decide and keeping
+// notifications for later.
+type remote struct {
+	t      *testing.T
+	w      io.Writer
+	lines  chan []byte
+	nextID int
+	notes  []*message
+
+	// decide returns the result to answer "can_use_tool" with, an *rpcError
+	// to answer with an error, or nil not to answer.
+	decide func(p canUseToolParams) interface{}
+	asked  []canUseToolParams
+}
+
+// startServer serves a connection with cfg and returns its caller.
+func startServer(t *testing.T, cfg config) *remote {
+	t.Helper()
+	serverIn, remoteOut := io.Pipe()
+	remoteIn, serverOut := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, serverIn, serverOut, cfg, log.New(io.Discard, "", 0))
+		_ = serverOut.Close()
+	}()
+
+	r := &remote{t: t, w: remoteOut, lines: make(chan []byte, 100)}
+	go func() {
+		defer close(r.lines)
+		scanner := bufio.NewScanner(remoteIn)
+		for scanner.Scan() {
+			r.lines <- append([]byte(nil), scanner.Bytes()...)
+		}
+	}()
+
+	t.Cleanup(func() {
+		// Hang up and let the server close its clients
+		_ = remoteOut.Close()
+		go func() {
+			for range r.lines {
+			}
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("serve failed: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("serve did not return after the caller hung up")
+		}
+		cancel()
+	})
+	return r
+}
+
+// send writes one line to the server.
+func (r *remote) send(line string) {
+	r.t.Helper()
+	if _, err := io.WriteString(r.w, line+"\n"); err != nil {
+		r.t.Fatalf("writing to the server failed: %v", err)
+	}
+}
+
+// next returns the server's next response or notification, answering its
+// requests on the way.
+func (r *remote) next() *message {
+	r.t.Helper()
+	for {
+		select {
+		case line, ok := <-r.lines:
+			if !ok {
+				r.t.Fatal("server closed the connection")
+			}
+			var msg message
+			if err := json.Unmarshal(line, &msg); err != nil {
+				r.t.Fatalf("server sent invalid JSON %q: %v", line, err)
+			}
+			if msg.Method == "can_use_tool" && msg.ID != nil {
+				r.answer(&msg)
+				continue
+			}
+			return &msg
+		case <-time.After(5 * time.Second):
+			r.t.Fatal("timed out waiting for the server")
+		}
+	}
+}
+
+// answer answers a "can_use_tool" request from the server with decide.
+func (r *remote) answer(msg *message) {
+	r.t.Helper()
+	var p canUseToolParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		r.t.Fatalf("invalid can_use_tool params %s: %v", msg.Params, err)
+	}
+	r.asked = append(r.asked, p)
+	if r.decide == nil {
+		r.t.Fatalf("server asked about %s unexpectedly", p.ToolName)
+	}
+	reply := &message{JSONRPC: "2.0", ID: msg.ID}
+	switch decision := r.decide(p).(type) {
+	case nil:
+		return
+	case *rpcError:
+		reply.Error = decision
+	default:
+		reply.Result, _ = json.Marshal(decision)
+	}
+	line, _ := json.Marshal(reply)
+	r.send(string(line))
+}
+
+// call sends a request and returns its response, keeping the notifications
+// that arrive first.
+func (r *remote) call(method string, params interface{}) *message {
+	r.t.Helper()
+	r.nextID++
+	id := strconv.Itoa(r.nextID)
+	rawParams, _ := json.Marshal(params)
+	line, _ := json.Marshal(&message{JSONRPC: "2.0", ID: json.RawMessage(id), Method: method, Params: rawParams})
+	r.send(string(line))
+	for {
+		msg := r.next()
+		if msg.Method == "" && string(msg.ID) == id {
+			return msg
+		}
+		r.notes = append(r.notes, msg)
+	}
+}
+
+// mustCall is call for requests that must succeed.
+func (r *remote) mustCall(method string, params interface{}, result interface{}) {
+	r.t.Helper()
+	msg := r.call(method, params)
+	if msg.Error != nil {
+		r.t.Fatalf("%s failed: %v", method, msg.Error)
+	}
+	if result != nil {
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			r.t.Fatalf("invalid %s result %s: %v", method, msg.Result, err)
+		}
+	}
+}
+
+// connect connects a client with the server's CLI and returns its id.
+func (r *remote) connect(permissionCallback bool) string {
+	r.t.Helper()
+	var result connectResult
+	r.mustCall("connect", map[string]interface{}{
+		"options":             map[string]interface{}{"max_turns": 3},
+		"permission_callback": permissionCallback,
+	}, &result)
+	if result.Client == "" {
+		r.t.Fatal("connect returned no client")
+	}
+	return result.Client
+}
+
+// note returns the next notification, kept or new.
+func (r *remote) note() *message {
+	r.t.Helper()
+	if len(r.notes) > 0 {
+		msg := r.notes[0]
+		r.notes = r.notes[1:]
+		return msg
+	}
+	msg := r.next()
+	if msg.Method == "" {
+		r.t.Fatalf("unexpected response %s", msg.ID)
+	}
+	return msg
+}
+
+// turnText returns the assistant text client's messages carry until the next
+// result.
+func (r *remote) turnText(client string) string {
+	r.t.Helper()
+	var text strings.Builder
+	for {
+		msg := r.note()
+		if msg.Method != "message" {
+			r.t.Fatalf("unexpected %s notification before the result", msg.Method)
+		}
+		var p struct {
+			Client  string `json:"client"`
+			Message struct {
+				Type    string `json:"type"`
+				Message struct {
+					Content []struct {
+						Type string `json:"type"`
+						Text string `json:"text"`
+					} `json:"content"`
+				} `json:"message"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			r.t.Fatalf("invalid message params %s: %v", msg.Params, err)
+		}
+		if p.Client != client {
+			r.t.Fatalf("message for client %q, want %q", p.Client, client)
+		}
+		switch p.Message.Type {
+		case "assistant":
+			for _, block := range p.Message.Message.Content {
+				if block.Type == "text" {
+					text.WriteString(block.Text)
+				}
+			}
+		case "result":
+			return text.String()
+		}
+	}
+}
+
+// TestServer_Query tests that a caller's queries are answered turn after turn,
+// with the client's messages sent as notifications.
+func TestServer_Query(t *testing.T) {
+	cli := writeMockCLI(t)
+	r := startServer(t, config{cliPath: cli})
+	client := r.connect(false)
+
+	for turn := 1; turn <= 2; turn++ {
+		r.mustCall("query", queryParams{Client: client, Prompt: "hello"}, nil)
+		if got, want := r.turnText(client), "Answer "+strconv.Itoa(turn)+"."; got != want {
+			t.Errorf("turn %d text = %q, want %q", turn, got, want)
+		}
+	}
+}
+
+// TestServer_Permission tests that the server asks the caller about tools and
+// applies its decision, or the default one when the caller does not decide.
+func TestServer_Permission(t *testing.T) {
+	cli := writeMockCLI(t)
+	tests := []struct {
+		name              string
+		permissionDefault string
+		decide            func(p canUseToolParams) interface{}
+		want              string
+	}{
+		{
+			name:   "caller allows",
+			decide: func(canUseToolParams) interface{} { return map[string]string{"behavior": "allow"} },
+			want:   "Bash allowed.",
+		},
+		{
+			name: "caller denies",
+			decide: func(canUseToolParams) interface{} {
+				return map[string]string{"behavior": "deny", "message": "not here"}
+			},
+			want: "Bash denied.",
+		},
+		{
+			name:              "caller does not answer, default deny",
+			permissionDefault: "deny",
+			decide:            func(canUseToolParams) interface{} { return nil },
+			want:              "Bash denied.",
+		},
+		{
+			name:              "caller does not answer, default allow",
+			permissionDefault: "allow",
+			decide:            func(canUseToolParams) interface{} { return nil },
+			want:              "Bash allowed.",
+		},
+		{
+			name:              "caller fails, default allow",
+			permissionDefault: "allow",
+			decide: func(canUseToolParams) interface{} {
+				return &rpcError{Code: -1, Message: "no idea"}
+			},
+			want: "Bash allowed.",
+		},
+		{
+			name:              "caller answers nonsense, default deny",
+			permissionDefault: "deny",
+			decide:            func(canUseToolParams) interface{} { return map[string]string{"behavior": "maybe"} },
+			want:              "Bash denied.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := startServer(t, config{cliPath: cli, permissionTimeout: 200 * time.Millisecond, permissionDefault: tt.permissionDefault})
+			r.decide = tt.decide
+			client := r.connect(true)
+
+			r.mustCall("query", queryParams{Client: client, Prompt: "needs permission"}, nil)
+			if got := r.turnText(client); got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+			if len(r.asked) != 1 {
+				t.Fatalf("caller asked %d times, want 1", len(r.asked))
+			}
+			if asked := r.asked[0]; asked.Client != client || asked.ToolName != "Bash" || asked.Input["command"] != "ls" {
+				t.Errorf("caller asked %+v, want Bash with ls for %s", asked, client)
+			}
+		})
+	}
+}
+
+// TestServer_PermissionPolicy tests that tools the server's policy decides are
+// not sent to the caller.
+func TestServer_PermissionPolicy(t *testing.T) {
+	cli := writeMockCLI(t)
+	for _, tt := range []struct {
+		name string
+		cfg  config
+		want string
+	}{
+		{"allowed", config{allow: []string{"Bash"}}, "Bash allowed."},
+		{"denied", config{deny: []string{"Ba*"}}, "Bash denied."},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.permissionTimeout = time.Second
+			tt.cfg.permissionDefault = "allow"
+			tt.cfg.cliPath = cli
+			r := startServer(t, tt.cfg)
+			client := r.connect(true)
+
+			r.mustCall("query", queryParams{Client: client, Prompt: "needs permission"}, nil)
+			if got := r.turnText(client); got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestServer_CallerOptions tests that a caller cannot set the options that
+// decide what the CLI may run, so a denied tool stays denied.
+func TestServer_CallerOptions(t *testing.T) {
+	cli := writeMockCLI(t)
+	r := startServer(t, config{cliPath: cli, deny: []string{"Bash"}, permissionTimeout: time.Second, permissionDefault: "allow"})
+
+	for _, options := range []map[string]interface{}{
+		{"permission_mode": "bypassPermissions"},
+		{"allowed_tools": []string{"Bash"}},
+		{"dangerously_skip_permissions": true},
+		{"extra_args": map[string]string{"dangerously-skip-permissions": ""}},
+		{"cli_path": "/bin/sh"},
+		{"env": map[string]string{"PATH": "/tmp"}},
+		{"settings": "/tmp/settings.json"},
+		{"model": "claude-test", "mcp_servers": map[string]interface{}{}},
+	} {
+		msg := r.call("connect", map[string]interface{}{"options": options, "permission_callback": true})
+		if msg.Error == nil || msg.Error.Code != codeInvalidParams {
+			t.Errorf("connect with %v got error %v, want code %d", options, msg.Error, codeInvalidParams)
+		}
+	}
+
+	client := r.connect(true)
+	r.mustCall("query", queryParams{Client: client, Prompt: "needs permission"}, nil)
+	if got, want := r.turnText(client), "Bash denied."; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+	if len(r.asked) != 0 {
+		t.Errorf("caller asked %d times about a denied tool, want 0", len(r.asked))
+	}
+}
+
+// TestServer_Errors tests the errors of malformed and unknown requests.
+func TestServer_Errors(t *testing.T) {
+	r := startServer(t, config{})
+
+	r.send("{not json")
+	if msg := r.next(); msg.Error == nil || msg.Error.Code != codeParseError || string(msg.ID) != "null" {
+		t.Errorf("bad JSON got %+v, want a parse error for id null", msg)
+	}
+
+	tests := []struct {
+		method string
+		params interface{}
+		code   int
+	}{
+		{"explode", map[string]string{}, codeMethodNotFound},
+		{"query", queryParams{Client: "c9", Prompt: "hi"}, codeInvalidParams},
+		{"query", nil, codeInvalidParams},
+		{"connect", map[string]interface{}{"options": map[string]interface{}{"max_turns": "many"}}, codeInvalidParams},
+		{"close", clientParams{Client: "c9"}, codeInvalidParams},
+	}
+	for _, tt := range tests {
+		msg := r.call(tt.method, tt.params)
+		if msg.Error == nil || msg.Error.Code != tt.code {
+			t.Errorf("%s %v got error %v, want code %d", tt.method, tt.params, msg.Error, tt.code)
+		}
+	}
+}
+
+// TestServer_Close tests that closing a client ends its notifications and
+// makes it unknown, gracefully or not.
+func TestServer_Close(t *testing.T) {
+	cli := writeMockCLI(t)
+	for _, graceful := range []bool{false, true} {
+		t.Run("graceful "+strconv.FormatBool(graceful), func(t *testing.T) {
+			r := startServer(t, config{cliPath: cli})
+			client := r.connect(false)
+			r.mustCall("query", queryParams{Client: client, Prompt: "hello"}, nil)
+			if got := r.turnText(client); got != "Answer 1." {
+				t.Errorf("text = %q, want %q", got, "Answer 1.")
+			}
+
+			r.mustCall("close", closeParams{Client: client, Graceful: graceful, TimeoutMs: 2000}, nil)
+			for {
+				msg := r.note()
+				if msg.Method == "closed" {
+					break
+				}
+				if msg.Method != "message" {
+					t.Fatalf("unexpected %s notification", msg.Method)
+				}
+			}
+
+			if msg := r.call("query", queryParams{Client: client, Prompt: "again"}); msg.Error == nil || msg.Error.Code != codeInvalidParams {
+				t.Errorf("query after close got error %v, want code %d", msg.Error, codeInvalidParams)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package claude
+
+import (
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ephemeralQueryTimeout is the QueryTimeout of NewEphemeralOptions: a response
+// that goes quiet this long is abandoned well before a typical function
+// timeout.
+const ephemeralQueryTimeout = 60 * time.Second
+
+// NewEphemeralOptions returns options for short-lived environments such as AWS
+// Lambda, where cold starts are costly, the home directory is read-only or
+// shared, and nothing may outlive the handler:
+//   - the CLI bundled at cliPath is used as is, without discovery or the
+//     version check, which would start an extra process
+//   - every file the SDK and the CLI write goes under tempDir (see
+//     types.ClaudeAgentOptions.WithEphemeral); nothing is written to the home
+//     directory
+//   - a response that receives nothing for 60 seconds is abandoned (see
+//     WithQueryTimeout)
+//
+// The CLI subprocess is reaped before Query's channel closes, and before
+// Client.Close returns, so close every Client before the handler returns. The
+// CLI still needs credentials, typically ANTHROPIC_API_KEY in the environment.
+//
+// Example:
+//
+//	func handler(ctx context.Context, event Event) (string, error) {
+//	    opts := claude.NewEphemeralOptions("/opt/claude/claude", os.TempDir())
+//	    turns, err := claude.RunScript(ctx, []string{event.Prompt}, opts)
+//	    if err != nil {
+//	        return "", err
+//	    }
+//	    return turns[0].Text, nil
+//	}
+func NewEphemeralOptions(cliPath, tempDir string) *types.ClaudeAgentOptions {
+	return types.NewClaudeAgentOptions().
+		WithCLIPath(cliPath).
+		WithSkipVersionCheck(true).
+		WithEphemeral(true).
+		WithTempDir(tempDir).
+		WithQueryTimeout(ephemeralQueryTimeout)
+}
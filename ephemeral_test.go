@@ -0,0 +1,93 @@
+package claude
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ephemeralCLI writes its files where the real CLI does, under
+// CLAUDE_CONFIG_DIR or else ~/.claude: its arguments, its PID and a session
+// transcript.
+const ephemeralCLI = `
+dir=${CLAUDE_CONFIG_DIR:-$HOME/.claude}
+mkdir -p "$dir/projects"
+echo $$ > "$dir/pid"
+echo "$*" > "$dir/args"
+while read line; do
+  case "$line" in
+    *control_request*)
+      id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+      echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+      ;;
+    *'"type":"user"'*)
+      echo "$line" >> "$dir/projects/s-ephemeral.jsonl"
+      echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"hi"}]}}'
+      echo '{"type":"result","subtype":"success","is_error":false,"result":"hi","session_id":"s-ephemeral"}'
+      ;;
+  esac
+done
+`
+
+// TestNewEphemeralOptions tests that a scripted query with the ephemeral
+// preset writes nothing outside its temp dir, and that the CLI is reaped by
+// the time the query returns.
+func TestNewEphemeralOptions(t *testing.T) {
+	cliPath := writeMockCLI(t, ephemeralCLI)
+	home, systemTemp, tempDir := t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("TMPDIR", systemTemp)
+
+	opts := NewEphemeralOptions(cliPath, tempDir).
+		WithMcpServers(map[string]interface{}{"docs": types.McpStdioServerConfig{Command: "docs-server"}})
+	turns, err := RunScript(testContext(t, 10*time.Second), []string{"hello"}, opts)
+	if err != nil {
+		t.Fatalf("RunScript failed: %v", err)
+	}
+	if turns[0].Text != "hi" {
+		t.Errorf("Text = %q, want hi", turns[0].Text)
+	}
+
+	for _, dir := range []string{home, systemTemp} {
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%s was written to: %v", dir, entries)
+		}
+	}
+
+	config := filepath.Join(tempDir, ".claude")
+	if _, err := os.Stat(filepath.Join(config, "projects", "s-ephemeral.jsonl")); err != nil {
+		t.Errorf("the CLI's session file is not under the temp dir: %v", err)
+	}
+	args, err := os.ReadFile(filepath.Join(config, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "--mcp-config "+filepath.Join(tempDir, "claude-mcp-config-")) {
+		t.Errorf("MCP config was not written to the temp dir: %s", args)
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(tempDir, "claude-mcp-config-*")); len(leftover) != 0 {
+		t.Errorf("MCP config files left behind: %v", leftover)
+	}
+
+	data, err := os.ReadFile(filepath.Join(config, "pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if process, err := os.FindProcess(pid); err == nil && process.Signal(syscall.Signal(0)) == nil {
+		t.Errorf("CLI process %d is still running or unreaped", pid)
+	}
+
+	if err := NewEphemeralOptions(cliPath, tempDir).WithDefaultStderrLogFile().Validate(); !types.IsValidationError(err) {
+		t.Errorf("Validate() with the default stderr log file = %v, want ValidationError", err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/schlunsen/claude-agent-sdk-go/examples/internal/flows"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Agents demonstrates defining reusable agents once and running them
+// concurrently. Both agents share a transcript that records every turn.
+func main() {
+	ctx := context.Background()
+
+	// Both agents start from these options and add their own system prompt
+	base := types.NewClaudeAgentOptions().
+		WithModel("claude-sonnet-4-5-20250929")
+
+	if _, err := flows.RunAgents(ctx, os.Stdout, base); err != nil {
+		log.Fatalf("Agents failed: %v", err)
+	}
+}
@@ -1,14 +1,12 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"log"
 	"os"
-	"strings"
 
-	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/examples/internal/flows"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
@@ -20,72 +18,13 @@ func main() {
 	// Create options for the interactive client
 	opts := types.NewClaudeAgentOptions()
 
-	// Create client
-	client, err := claude.NewClient(ctx, opts)
-	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
-	}
-
-	// Connect to Claude
-	fmt.Println("Connecting to Claude....")
-	if err := client.Connect(ctx); err != nil {
-		log.Fatalf("Failed to connect: %v", err)
-	}
-	defer func() {
-		_ = client.Close(ctx)
-	}()
-
-	fmt.Println("Connected! Type your questions (press Ctrl+C to exit)")
+	fmt.Println("Type your questions (press Ctrl+D to exit)")
 	fmt.Println("---")
 
-	// Interactive loop
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		// Read user input
-		fmt.Print("You: ")
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			if strings.Contains(err.Error(), "EOF") {
-				break
-			}
-			log.Fatalf("Error reading input: %v", err)
-		}
-
-		prompt := strings.TrimSpace(input)
-		if prompt == "" {
-			continue
-		}
-
-		// Send query to Claude
-		if err := client.Query(ctx, prompt); err != nil {
-			fmt.Printf("Error sending query: %v\n", err)
-			continue
-		}
-
-		// Receive and print responses
-		foundResponse := false
-		for msg := range client.ReceiveResponse(ctx) {
-			msgType := msg.GetMessageType()
-
-			switch msgType {
-			case "assistant":
-				if !foundResponse {
-					fmt.Print("Claude: ")
-					foundResponse = true
-				}
-				if assistantMsg, ok := msg.(*types.AssistantMessage); ok {
-					for _, block := range assistantMsg.Content {
-						if textBlock, ok := block.(*types.TextBlock); ok {
-							fmt.Print(textBlock.Text)
-						}
-					}
-				}
-			case "result":
-				fmt.Println()
-				fmt.Println()
-			}
-		}
+	// Every line read from stdin is a turn in the same session
+	if err := flows.Chat(ctx, os.Stdout, os.Stdin, opts); err != nil {
+		log.Fatalf("Chat failed: %v", err)
 	}
 
-	fmt.Println("\nGoodbye!")
+	fmt.Println("Goodbye!")
 }
@@ -0,0 +1,127 @@
+package flows
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// NewAgents defines a read-only code reviewer and a docs writer that may only
+// edit Markdown files, both on the options of base and recording their turns
+// in transcript. Turn summaries and the docs writer's edits are reported to w.
+func NewAgents(base *types.ClaudeAgentOptions, transcript *claude.Transcript, w io.Writer) (reviewer, docs *claude.Agent, err error) {
+	printSummary := func(agent string, summary claude.TurnSummary) {
+		fmt.Fprintf(w, "[%s] turn finished: %d tool calls, $%.4f\n", agent, len(summary.ToolUses), summary.CostUSD)
+	}
+
+	// A read-only reviewer: it may look at files but never change them
+	reviewer, err = claude.NewAgent(claude.AgentSpec{
+		Name:    "reviewer",
+		Options: base.Clone().WithSystemPrompt("You are a careful Go code reviewer. Point out bugs, not style."),
+		Policy: &claude.PermissionPolicy{
+			Allow: []string{"Read", "Grep", "Glob"},
+			Deny:  []string{"Bash", "Write", "Edit"},
+		},
+		Transcript: transcript,
+		OnTurn:     printSummary,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating reviewer: %w", err)
+	}
+
+	// A docs writer: it may edit Markdown files and asks for anything else
+	writeOrEdit := "Write|Edit"
+	docs, err = claude.NewAgent(claude.AgentSpec{
+		Name:    "docs",
+		Options: base.Clone().WithSystemPrompt("You write concise developer documentation."),
+		Policy: &claude.PermissionPolicy{
+			Allow:  []string{"Read", "Glob"},
+			Decide: allowMarkdownEdits,
+		},
+		Hooks: map[types.HookEvent][]types.HookMatcher{
+			types.HookEventPostToolUse: {{
+				Matcher: &writeOrEdit,
+				Hooks: []types.HookCallbackFunc{func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+					fmt.Fprintf(w, "[docs] edited a file with %s\n", hookCtx.ToolName)
+					return map[string]interface{}{}, nil
+				}},
+			}},
+		},
+		Transcript: transcript,
+		OnTurn:     printSummary,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating docs agent: %w", err)
+	}
+	return reviewer, docs, nil
+}
+
+// allowMarkdownEdits allows writes to Markdown files and denies everything else.
+func allowMarkdownEdits(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+	path, _ := input["file_path"].(string)
+	if (toolName == "Write" || toolName == "Edit") && strings.HasSuffix(path, ".md") {
+		return &types.PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	return &types.PermissionResultDeny{Behavior: "deny", Message: "the docs agent may only edit Markdown files"}, nil
+}
+
+// RunAgents runs the agents of NewAgents concurrently, one turn each, and
+// prints their answers to w. It returns the transcript the agents share and
+// the first agent error.
+func RunAgents(ctx context.Context, w io.Writer, base *types.ClaudeAgentOptions) (*claude.Transcript, error) {
+	// Both agents report to w at once
+	w = &lockedWriter{w: w}
+	transcript := claude.NewTranscript()
+	reviewer, docs, err := NewAgents(base, transcript, w)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	run := func(agent *claude.Agent, prompt string, overrides ...claude.AgentOverride) {
+		defer wg.Done()
+		turn, err := agent.Run(ctx, prompt, overrides...)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			fmt.Fprintf(w, "%s failed: %v\n", agent.Name(), err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		fmt.Fprintf(w, "[%s] %s\n", agent.Name(), turn.Text)
+	}
+
+	wg.Add(2)
+	// Per-run overrides apply to this run only
+	go run(reviewer, "Review client.go for concurrency bugs.", func(o *types.ClaudeAgentOptions) {
+		o.WithMaxTurns(5)
+	})
+	go run(docs, "Summarize what client.go does in two sentences.")
+	wg.Wait()
+
+	fmt.Fprintf(w, "---\nTranscript holds %d turns\n", transcript.Len())
+	return transcript, firstErr
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,69 @@
+// Package flows holds the logic of the examples, so that tests can run it
+// against a scripted mock CLI. Each example's main.go builds its options and
+// calls one flow, printing to os.Stdout.
+package flows
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// blockPrinter prints one content block of an assistant message.
+type blockPrinter func(w io.Writer, block types.ContentBlock)
+
+// printText prints text blocks as Claude's answer.
+func printText(w io.Writer, block types.ContentBlock) {
+	if text, ok := block.(*types.TextBlock); ok {
+		fmt.Fprintf(w, "Claude: %s\n", text.Text)
+	}
+}
+
+// printMessages prints the assistant blocks of messages with print, ending
+// with a footer summarizing the turn. It returns the turn's error.
+func printMessages(w io.Writer, messages <-chan types.Message, print blockPrinter) error {
+	var received []types.Message
+	for msg := range messages {
+		received = append(received, msg)
+		if assistant, ok := msg.(*types.AssistantMessage); ok {
+			for _, block := range assistant.Content {
+				print(w, block)
+			}
+		}
+	}
+
+	summary, err := claude.Summarize(received)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "---\n%s\n", summary)
+	return summary.Err()
+}
+
+// runClientTurn sends prompt on a new Client and prints its response. Hooks
+// and permission callbacks are served over the Client's control protocol,
+// which the one-shot claude.Query does not use.
+func runClientTurn(ctx context.Context, w io.Writer, prompt string, opts *types.ClaudeAgentOptions, print blockPrinter) error {
+	client, err := claude.NewClient(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := client.Connect(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+
+	if err := client.Query(ctx, prompt); err != nil {
+		return err
+	}
+	messages, err := client.ReceiveResponseE(ctx)
+	if err != nil {
+		return err
+	}
+	return printMessages(w, messages, print)
+}
@@ -0,0 +1,273 @@
+package flows
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// mockCLI stands in for the Claude CLI. It records its arguments next to
+// itself, acknowledges control requests, and answers each user message: one
+// mentioning "permission" asks for Bash and Write and reports the decisions,
+// one mentioning "hooks" fires the first two hook callbacks, and any other
+// gets "Answer <turn>.".
+const mockCLI = `
+printf '%s\n' "$@" > "$(dirname "$0")/args"
+turn=0
+while read line; do
+  case "$line" in
+    *control_request*)
+      id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+      echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+      ;;
+    *'"type":"user"'*)
+      turn=$((turn+1))
+      case "$line" in
+        *permission*)
+          echo '{"type":"assistant","message":{"model":"m","content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"ls"}}]}}'
+          echo '{"type":"control_request","request_id":"perm-1","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"ls"}}}'
+          read bash_reply
+          echo '{"type":"control_request","request_id":"perm-2","request":{"subtype":"can_use_tool","tool_name":"Write","input":{"file_path":"a.txt","content":"x"}}}'
+          read write_reply
+          bash=denied; case "$bash_reply" in *'"behavior":"allow"'*) bash=allowed;; esac
+          write=denied; case "$write_reply" in *'"behavior":"allow"'*) write=allowed;; esac
+          answer="Bash $bash, Write $write."
+          ;;
+        *hooks*)
+          echo '{"type":"control_request","request_id":"hook-1","request":{"subtype":"hook_callback","callback_id":"hook_1","input":{"hook_event_name":"PreToolUse","tool_name":"Bash"}}}'
+          read reply
+          echo '{"type":"assistant","message":{"model":"m","content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"pwd"}}]}}'
+          echo '{"type":"control_request","request_id":"hook-2","request":{"subtype":"hook_callback","callback_id":"hook_2","input":{"hook_event_name":"PostToolUse","tool_name":"Bash"}}}'
+          read reply
+          answer="Hooks ran."
+          ;;
+        *)
+          answer="Answer $turn."
+          ;;
+      esac
+      echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"'"$answer"'"}]}}'
+      echo '{"type":"result","subtype":"success","is_error":false,"result":"'"$answer"'","session_id":"mock-session","num_turns":'$turn',"total_cost_usd":0.01}'
+      ;;
+  esac
+done
+`
+
+// writeMockCLI writes mockCLI to a temp dir and returns its path.
+func writeMockCLI(t *testing.T) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("mock CLI scripts require a POSIX shell")
+	}
+
+	path := filepath.Join(t.TempDir(), "mock-claude.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+mockCLI), 0755); err != nil {
+		t.Fatalf("failed to write mock CLI: %v", err)
+	}
+	return path
+}
+
+// mockArgs returns the arguments the mock CLI at cliPath was last started with.
+func mockArgs(t *testing.T, cliPath string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(cliPath), "args"))
+	if err != nil {
+		t.Fatalf("mock CLI recorded no arguments: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// hasFlag reports whether args contain flag followed by value.
+func hasFlag(args []string, flag, value string) bool {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag && args[i+1] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// syncBuffer is a bytes.Buffer that callbacks, which the SDK runs on its own
+// goroutines, can write to while the flow prints.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func assertContains(t *testing.T, output string, want ...string) {
+	t.Helper()
+
+	for _, w := range want {
+		if !strings.Contains(output, w) {
+			t.Errorf("output missing %q:\n%s", w, output)
+		}
+	}
+}
+
+func TestSimpleQuery(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t))
+
+	var out bytes.Buffer
+	if err := SimpleQuery(testContext(t), &out, "What is 2 + 2?", opts); err != nil {
+		t.Fatalf("SimpleQuery failed: %v", err)
+	}
+	assertContains(t, out.String(), "Claude: Answer 1.\n", "---\n")
+}
+
+func TestChat(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t))
+
+	var out bytes.Buffer
+	in := strings.NewReader("First question\n\nSecond question\n")
+	if err := Chat(testContext(t), &out, in, opts); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	// Both turns go to the same CLI process, which counts them
+	assertContains(t, out.String(), "Claude: Answer 1.\n", "Claude: Answer 2.\n")
+	if strings.Contains(out.String(), "Error") {
+		t.Errorf("Chat reported an error:\n%s", out.String())
+	}
+}
+
+func TestRunWithHooks(t *testing.T) {
+	var out syncBuffer
+	opts := WithHooks(types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t)), &out)
+
+	if err := RunWithHooks(testContext(t), &out, "Run the hooks", opts); err != nil {
+		t.Fatalf("RunWithHooks failed: %v", err)
+	}
+	assertContains(t, out.String(),
+		"[Hook] PreToolUse triggered for Bash\n",
+		"[Hook] PostToolUse triggered for Bash\n",
+		"[Tool] Tool call received: Bash\n",
+		"[Message] Hooks ran.\n",
+	)
+}
+
+func TestRunWithPermissions(t *testing.T) {
+	cliPath := writeMockCLI(t)
+	var out syncBuffer
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cliPath).
+		WithCanUseTool(PermissionHandler(&out))
+
+	if err := RunWithPermissions(testContext(t), &out, "Ask for permission", opts); err != nil {
+		t.Fatalf("RunWithPermissions failed: %v", err)
+	}
+	assertContains(t, out.String(),
+		"[Permission Request] Tool: Bash\n",
+		"Decision: APPROVED\n",
+		"[Permission Request] Tool: Write\n",
+		"Decision: DENIED (write operations disabled)\n",
+		"Text: Bash allowed, Write denied.\n",
+	)
+	if !hasFlag(mockArgs(t, cliPath), "--permission-prompt-tool", "stdio") {
+		t.Errorf("CLI was not told to ask the SDK for permissions: %v", mockArgs(t, cliPath))
+	}
+}
+
+func TestPermissionHandler_RiskyCommand(t *testing.T) {
+	var out bytes.Buffer
+	result, err := PermissionHandler(&out)(context.Background(), "Bash", map[string]interface{}{"command": "rm -rf /"}, types.ToolPermissionContext{})
+	if err != nil {
+		t.Fatalf("handler failed: %v", err)
+	}
+	if _, ok := result.(*types.PermissionResultDeny); !ok {
+		t.Errorf("result = %#v, want a denial", result)
+	}
+	assertContains(t, out.String(), "Decision: DENIED (risky command)\n")
+}
+
+func TestRunWithPlugins(t *testing.T) {
+	cliPath := writeMockCLI(t)
+	pluginDir := t.TempDir()
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cliPath).
+		WithLocalPlugin(pluginDir)
+
+	var out bytes.Buffer
+	if err := RunWithPlugins(testContext(t), &out, "Please use the /greet command", opts); err != nil {
+		t.Fatalf("RunWithPlugins failed: %v", err)
+	}
+	assertContains(t, out.String(), "[Assistant] Answer 1.\n", "Session ID: mock-session\n", "Result: success\n")
+	if !hasFlag(mockArgs(t, cliPath), "--plugin-dir", pluginDir) {
+		t.Errorf("plugin was not passed to the CLI: %v", mockArgs(t, cliPath))
+	}
+}
+
+func TestRunAgents(t *testing.T) {
+	base := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t))
+
+	var out bytes.Buffer
+	transcript, err := RunAgents(testContext(t), &out, base)
+	if err != nil {
+		t.Fatalf("RunAgents failed: %v", err)
+	}
+	if transcript.Len() != 2 {
+		t.Errorf("transcript holds %d turns, want 2", transcript.Len())
+	}
+	assertContains(t, out.String(), "[reviewer] Answer 1.\n", "[docs] Answer 1.\n", "Transcript holds 2 turns\n")
+}
+
+func TestAllowMarkdownEdits(t *testing.T) {
+	tests := []struct {
+		tool, path string
+		allowed    bool
+	}{
+		{"Write", "README.md", true},
+		{"Edit", "docs/guide.md", true},
+		{"Write", "main.go", false},
+		{"Bash", "README.md", false},
+	}
+	for _, tt := range tests {
+		result, err := allowMarkdownEdits(context.Background(), tt.tool, map[string]interface{}{"file_path": tt.path}, types.ToolPermissionContext{})
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.tool, tt.path, err)
+		}
+		if _, allowed := result.(*types.PermissionResultAllow); allowed != tt.allowed {
+			t.Errorf("%s %s: allowed = %v, want %v", tt.tool, tt.path, allowed, tt.allowed)
+		}
+	}
+}
+
+func TestLambdaHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(testContext(t), cleanupMargin+10*time.Second)
+	defer cancel()
+
+	response, err := LambdaHandler(ctx, Event{Prompt: "What is 2 + 2?"}, writeMockCLI(t))
+	if err != nil {
+		t.Fatalf("LambdaHandler failed: %v", err)
+	}
+	if response.Answer != "Answer 1." || response.CostUSD != 0.01 {
+		t.Errorf("response = %+v, want Answer 1. at $0.01", response)
+	}
+}
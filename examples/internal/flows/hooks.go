@@ -0,0 +1,36 @@
+package flows
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// WithHooks adds PreToolUse and PostToolUse hooks to opts that report each
+// tool call to w. Hooks could also audit, block or follow up on tool use.
+func WithHooks(opts *types.ClaudeAgentOptions, w io.Writer) *types.ClaudeAgentOptions {
+	report := func(event types.HookEvent) types.HookCallbackFunc {
+		return func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+			fmt.Fprintf(w, "[Hook] %s triggered for %s\n", event, hookCtx.ToolName)
+			return map[string]interface{}{"continue": true}, nil
+		}
+	}
+	return opts.
+		WithHook(types.HookEventPreToolUse, types.HookMatcher{Hooks: []types.HookCallbackFunc{report(types.HookEventPreToolUse)}}).
+		WithHook(types.HookEventPostToolUse, types.HookMatcher{Hooks: []types.HookCallbackFunc{report(types.HookEventPostToolUse)}})
+}
+
+// RunWithHooks sends prompt on a Client, which registers the hooks of opts
+// with the CLI, and prints the answer and the tool calls to w.
+func RunWithHooks(ctx context.Context, w io.Writer, prompt string, opts *types.ClaudeAgentOptions) error {
+	return runClientTurn(ctx, w, prompt, opts, func(w io.Writer, block types.ContentBlock) {
+		switch block := block.(type) {
+		case *types.TextBlock:
+			fmt.Fprintf(w, "[Message] %s\n", block.Text)
+		case *types.ToolUseBlock:
+			fmt.Fprintf(w, "[Tool] Tool call received: %s\n", block.Name)
+		}
+	})
+}
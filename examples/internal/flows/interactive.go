@@ -0,0 +1,52 @@
+package flows
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Chat holds a conversation on one Client: each non-empty line read from in
+// is sent as a query in the same session and Claude's answer is printed to w,
+// until in ends. A query that fails is reported and the conversation goes on.
+func Chat(ctx context.Context, w io.Writer, in io.Reader, opts *types.ClaudeAgentOptions) error {
+	client, err := claude.NewClient(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := client.Connect(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(w, "You: ")
+		if !scanner.Scan() {
+			break
+		}
+		prompt := strings.TrimSpace(scanner.Text())
+		if prompt == "" {
+			continue
+		}
+
+		if err := client.Query(ctx, prompt); err != nil {
+			fmt.Fprintf(w, "Error sending query: %v\n", err)
+			continue
+		}
+		text, _, err := client.ReceiveText(ctx)
+		fmt.Fprintf(w, "Claude: %s\n\n", text)
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+		}
+	}
+	fmt.Fprintln(w)
+	return scanner.Err()
+}
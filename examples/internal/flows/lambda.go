@@ -0,0 +1,56 @@
+package flows
+
+import (
+	"context"
+	"os"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+)
+
+// Event is the input of the Lambda example's function.
+type Event struct {
+	Prompt string `json:"prompt"`
+}
+
+// Response is the output of the Lambda example's function.
+type Response struct {
+	Answer  string  `json:"answer"`
+	CostUSD float64 `json:"cost_usd"`
+}
+
+// cleanupMargin is kept free before the function's deadline, so the CLI is
+// closed and reaped before Lambda freezes the environment.
+const cleanupMargin = 5 * time.Second
+
+// LambdaHandler answers event.Prompt with the CLI at cliPath the way a
+// short-lived function should: nothing is written outside a per-invocation
+// temp dir, and the CLI subprocess is reaped before it returns.
+func LambdaHandler(ctx context.Context, event Event, cliPath string) (Response, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-cleanupMargin))
+		defer cancel()
+	}
+
+	// /tmp survives between warm invocations, so each one gets its own dir
+	tempDir, err := os.MkdirTemp("", "claude-*")
+	if err != nil {
+		return Response{}, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	opts := claude.NewEphemeralOptions(cliPath, tempDir).
+		WithMaxTurns(3)
+
+	// RunScript closes the connection, reaping the CLI, before it returns
+	turns, err := claude.RunScript(ctx, []string{event.Prompt}, opts)
+	if err != nil {
+		return Response{}, err
+	}
+	turn := turns[0]
+	if turn.Err != nil {
+		return Response{}, turn.Err
+	}
+	return Response{Answer: turn.Text, CostUSD: turn.CostUSD}, nil
+}
@@ -0,0 +1,67 @@
+package flows
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// PermissionHandler returns a CanUseTool callback that decides each tool
+// request and reports it to w: Read is allowed, Bash unless the command looks
+// destructive, and Write and anything else are denied.
+//
+// Tools listed in AllowedTools are approved by the CLI without asking, so a
+// tool this handler should decide must not be listed there.
+func PermissionHandler(w io.Writer) types.CanUseToolFunc {
+	return func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+		inputJSON, _ := json.MarshalIndent(input, "", "  ")
+		fmt.Fprintf(w, "[Permission Request] Tool: %s\nInput: %s\n", toolName, inputJSON)
+
+		deny := func(reason string) (interface{}, error) {
+			fmt.Fprintf(w, "Decision: DENIED (%s)\n", reason)
+			return &types.PermissionResultDeny{Behavior: "deny", Message: "Denied: " + reason}, nil
+		}
+		switch toolName {
+		case "Bash":
+			if cmd, _ := input["command"].(string); isRiskyCommand(cmd) {
+				return deny("risky command")
+			}
+		case "Read":
+		case "Write":
+			return deny("write operations disabled")
+		default:
+			return deny("unknown tool")
+		}
+		fmt.Fprintln(w, "Decision: APPROVED")
+		return &types.PermissionResultAllow{Behavior: "allow"}, nil
+	}
+}
+
+// isRiskyCommand checks if a bash command is potentially dangerous. This is
+// a simple heuristic; in production, parse the command properly.
+func isRiskyCommand(cmd string) bool {
+	for _, keyword := range []string{"rm -rf", "mkfs", "dd if=/dev"} {
+		if strings.Contains(cmd, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunWithPermissions sends prompt on a Client, which asks opts.CanUseTool
+// about each tool call, and prints the answer and the tool calls to w.
+func RunWithPermissions(ctx context.Context, w io.Writer, prompt string, opts *types.ClaudeAgentOptions) error {
+	return runClientTurn(ctx, w, prompt, opts, func(w io.Writer, block types.ContentBlock) {
+		switch block := block.(type) {
+		case *types.TextBlock:
+			fmt.Fprintf(w, "Text: %s\n", block.Text)
+		case *types.ToolUseBlock:
+			inputJSON, _ := json.MarshalIndent(block.Input, "", "  ")
+			fmt.Fprintf(w, "Tool Use: %s (%s)\nInput: %s\n", block.Name, block.ID, inputJSON)
+		}
+	})
+}
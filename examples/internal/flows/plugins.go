@@ -0,0 +1,53 @@
+package flows
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// RunWithPlugins sends prompt with the one-shot claude.Query, loading the
+// plugins of opts, and prints the conversation and the result to w.
+func RunWithPlugins(ctx context.Context, w io.Writer, prompt string, opts *types.ClaudeAgentOptions) error {
+	messages, err := claude.Query(ctx, prompt, opts)
+	if err != nil {
+		return err
+	}
+
+	var result *types.ResultMessage
+	for msg := range messages {
+		switch m := msg.(type) {
+		case *types.UserMessage:
+			// User messages can have string or structured content
+			if text, ok := m.Content.(string); ok {
+				fmt.Fprintf(w, "[User] %s\n", text)
+			}
+		case *types.AssistantMessage:
+			for _, block := range m.Content {
+				switch block := block.(type) {
+				case *types.TextBlock:
+					fmt.Fprintf(w, "[Assistant] %s\n", block.Text)
+				case *types.ToolUseBlock:
+					fmt.Fprintf(w, "[Tool Use] %s (id: %s)\n", block.Name, block.ID)
+				}
+			}
+		case *types.ResultMessage:
+			result = m
+		case *types.ErrorMessage:
+			return m.Err
+		}
+	}
+	if result == nil {
+		return fmt.Errorf("query ended without a result")
+	}
+
+	fmt.Fprintf(w, "\n=== Query Complete ===\nSession ID: %s\nDuration: %dms\n", result.SessionID, result.DurationMs)
+	if result.TotalCostUSD != nil {
+		fmt.Fprintf(w, "Cost: $%.4f\n", *result.TotalCostUSD)
+	}
+	fmt.Fprintf(w, "Result: %s\n", result.Subtype)
+	return nil
+}
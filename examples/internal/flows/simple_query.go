@@ -0,0 +1,19 @@
+package flows
+
+import (
+	"context"
+	"io"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// SimpleQuery sends prompt with the one-shot claude.Query and prints Claude's
+// answer and an end-of-turn footer to w.
+func SimpleQuery(ctx context.Context, w io.Writer, prompt string, opts *types.ClaudeAgentOptions) error {
+	messages, err := claude.Query(ctx, prompt, opts)
+	if err != nil {
+		return err
+	}
+	return printMessages(w, messages, printText)
+}
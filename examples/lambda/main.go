@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/examples/internal/flows"
+)
+
+// Lambda demonstrates running the SDK in a short-lived environment such as AWS
+// Lambda: the CLI is bundled with the function (for example in a layer under
+// /opt), nothing is written outside a per-invocation temp dir, and the CLI
+// subprocess is reaped before the handler returns.
+//
+// With github.com/aws/aws-lambda-go, main would just call lambda.Start(handler).
+// To stay dependency-free, this example invokes the handler once with the
+// prompt from the command line:
+//
+//	CLAUDE_CLI_PATH=$(which claude) go run main.go "What is 2 + 2?"
+func main() {
+	prompt := "What is 2 + 2?"
+	if len(os.Args) > 1 {
+		prompt = strings.Join(os.Args[1:], " ")
+	}
+
+	// Lambda passes a context with the function's deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	response, err := handler(ctx, flows.Event{Prompt: prompt})
+	if err != nil {
+		log.Fatalf("Handler failed: %v", err)
+	}
+	out, _ := json.MarshalIndent(response, "", "  ")
+	fmt.Println(string(out))
+}
+
+func handler(ctx context.Context, event flows.Event) (flows.Response, error) {
+	cliPath := os.Getenv("CLAUDE_CLI_PATH")
+	if cliPath == "" {
+		cliPath = "/opt/claude/bin/claude"
+	}
+	return flows.LambdaHandler(ctx, event, cliPath)
+}
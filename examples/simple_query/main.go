@@ -4,8 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 
-	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/examples/internal/flows"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
@@ -18,31 +19,11 @@ func main() {
 	opts := types.NewClaudeAgentOptions().
 		WithModel("claude-sonnet-4-5-20250929")
 
-	// Simple query
 	fmt.Println("Sending query: 'What is 2 + 2?'")
 	fmt.Println("---")
 
-	messages, err := claude.Query(ctx, "What is 2 + 2?", opts)
-	if err != nil {
+	// The flow prints Claude's answer and an end-of-turn footer
+	if err := flows.SimpleQuery(ctx, os.Stdout, "What is 2 + 2?", opts); err != nil {
 		log.Fatalf("Query failed: %v", err)
 	}
-
-	// Process messages from the channel
-	for msg := range messages {
-		msgType := msg.GetMessageType()
-
-		switch msgType {
-		case "assistant":
-			if assistantMsg, ok := msg.(*types.AssistantMessage); ok {
-				for _, block := range assistantMsg.Content {
-					if textBlock, ok := block.(*types.TextBlock); ok {
-						fmt.Printf("Claude: %s\n", textBlock.Text)
-					}
-				}
-			}
-		case "result":
-			fmt.Println("---")
-			fmt.Println("Query completed successfully")
-		}
-	}
 }
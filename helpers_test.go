@@ -0,0 +1,225 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// writeMockCLI writes an executable shell script that stands in for the Claude CLI
+// and returns its path. Tests are skipped on platforms without /bin/sh.
+func writeMockCLI(t *testing.T, script string) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("mock CLI scripts require a POSIX shell")
+	}
+
+	path := filepath.Join(t.TempDir(), "mock-claude.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write mock CLI: %v", err)
+	}
+	return path
+}
+
+// collectMessages drains a message channel, failing the test if it does not close in time.
+func collectMessages(t *testing.T, messages <-chan types.Message, timeout time.Duration) []types.Message {
+	t.Helper()
+
+	var collected []types.Message
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return collected
+			}
+			collected = append(collected, msg)
+		case <-deadline:
+			t.Fatalf("message channel did not close within %v (got %d messages)", timeout, len(collected))
+			return collected
+		}
+	}
+}
+
+// testContext returns a context bounded by the given timeout.
+func testContext(t *testing.T, timeout time.Duration) context.Context {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// mockTransport is an in-memory transport for Client tests. Control requests
+// written by the SDK are answered by respond (an empty success when nil).
+type mockTransport struct {
+	mu       sync.Mutex
+	messages chan types.Message
+	written  []string
+	ready    bool
+	closed   bool
+	err      error
+
+	// respond builds the reply to a control request of the given subtype. It may
+	// block to simulate a slow CLI; a non-nil error is sent as an error response.
+	respond func(subtype string) (map[string]interface{}, error)
+
+	// connectErr, when set, is returned by Connect
+	connectErr error
+
+	// lost, when set, makes the transport not ready for that reason
+	lost transport.ReadinessReason
+}
+
+func newMockTransport() *mockTransport {
+	return &mockTransport{messages: make(chan types.Message, 100)}
+}
+
+// newMockClient creates a Client whose transport is replaced by mock.
+func newMockClient(t *testing.T, opts *types.ClaudeAgentOptions, mock *mockTransport) *Client {
+	t.Helper()
+
+	if opts == nil {
+		opts = types.NewClaudeAgentOptions()
+	}
+	client, err := NewClient(context.Background(), opts.WithCLIPath("/bin/echo"))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	client.transport = mock
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+	return client
+}
+
+func (m *mockTransport) Connect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.connectErr != nil {
+		return m.connectErr
+	}
+	m.ready = true
+	return nil
+}
+
+func (m *mockTransport) Close(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.messages)
+	}
+	m.ready = false
+	return nil
+}
+
+func (m *mockTransport) Write(ctx context.Context, data string) error {
+	m.mu.Lock()
+	m.written = append(m.written, data)
+	m.mu.Unlock()
+
+	var msg struct {
+		Type      string                 `json:"type"`
+		RequestID string                 `json:"request_id"`
+		Request   map[string]interface{} `json:"request"`
+	}
+	if err := json.Unmarshal([]byte(data), &msg); err == nil && msg.Type == "control_request" {
+		subtype, _ := msg.Request["subtype"].(string)
+		go m.reply(msg.RequestID, subtype)
+	}
+	return nil
+}
+
+// reply answers a control request through the message stream.
+func (m *mockTransport) reply(requestID, subtype string) {
+	response := map[string]interface{}{}
+	var err error
+	if m.respond != nil {
+		response, err = m.respond(subtype)
+	}
+
+	payload := map[string]interface{}{"request_id": requestID, "subtype": "success", "response": response}
+	if err != nil {
+		payload = map[string]interface{}{"request_id": requestID, "subtype": "error", "error": err.Error()}
+	}
+	m.send(&types.SystemMessage{Type: "control_response", Response: payload})
+}
+
+// send delivers a message to the SDK unless the transport has been closed.
+func (m *mockTransport) send(msg types.Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.messages <- msg
+	}
+}
+
+func (m *mockTransport) ReadMessages(ctx context.Context) <-chan types.Message {
+	return m.messages
+}
+
+func (m *mockTransport) OnError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+func (m *mockTransport) IsReady() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ready && m.lost == ""
+}
+
+func (m *mockTransport) ReadinessReason() transport.ReadinessReason {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.closed:
+		return transport.ReadinessClosed
+	case m.lost != "":
+		return m.lost
+	case m.ready:
+		return transport.ReadinessReady
+	default:
+		return transport.ReadinessNeverConnected
+	}
+}
+
+func (m *mockTransport) GetError() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// writtenTypes returns the type (or control request subtype) of each written message.
+func (m *mockTransport) writtenTypes() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kinds := make([]string, 0, len(m.written))
+	for _, data := range m.written {
+		var msg struct {
+			Type    string                 `json:"type"`
+			Request map[string]interface{} `json:"request"`
+		}
+		_ = json.Unmarshal([]byte(data), &msg)
+		if subtype, ok := msg.Request["subtype"].(string); ok {
+			kinds = append(kinds, subtype)
+			continue
+		}
+		kinds = append(kinds, msg.Type)
+	}
+	return kinds
+}
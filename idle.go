@@ -0,0 +1,70 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// startIdleTimeout arms the idle timeout of a new connection, if configured
+// (see WithIdleTimeout). The caller holds c.mu.
+func (c *Client) startIdleTimeout() {
+	c.lastActive = time.Now()
+	if c.options.IdleTimeout > 0 {
+		c.idleClose = time.AfterFunc(c.options.IdleTimeout, c.closeIfIdle)
+	}
+}
+
+// stopIdleTimeout disarms the idle timeout. The caller holds c.mu.
+func (c *Client) stopIdleTimeout() {
+	if c.idleClose != nil {
+		c.idleClose.Stop()
+		c.idleClose = nil
+	}
+}
+
+// touch records activity that restarts the idle timeout.
+func (c *Client) touch() {
+	c.mu.Lock()
+	c.lastActive = time.Now()
+	c.mu.Unlock()
+}
+
+// closeIfIdle closes the client when nothing has touched it for the idle
+// timeout, and otherwise rearms the timer for the remainder. A turn whose
+// response is being received keeps the client open.
+func (c *Client) closeIfIdle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected || c.idleClose == nil {
+		return
+	}
+	timeout := c.options.IdleTimeout
+	if c.receiving && c.pendingTurns > 0 {
+		c.idleClose.Reset(timeout)
+		return
+	}
+	if idle := time.Since(c.lastActive); idle < timeout {
+		c.idleClose.Reset(timeout - idle)
+		return
+	}
+
+	c.logger.Info("Closing client after %s without activity", timeout)
+	if err := c.closeLocked(context.Background()); err != nil {
+		c.logger.Warning("Error closing idle client: %v", err)
+	}
+	c.closedErr = types.NewCLIConnectionErrorWithCause(fmt.Sprintf("closed after %s without activity", timeout), types.ErrClientClosed)
+}
+
+// notConnectedError returns the error of a call that needs a connection: the
+// one recorded when the idle timeout closed the client, else a
+// *types.CLIConnectionError asking for Connect. The caller holds c.mu.
+func (c *Client) notConnectedError() error {
+	if c.closedErr != nil {
+		return c.closedErr
+	}
+	return types.NewCLIConnectionError("not connected - call Connect() first")
+}
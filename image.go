@@ -0,0 +1,121 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// maxDownscaleFileBytes is the largest image file QueryWithImage reads when
+// DownscaleImages is set, since the file itself may exceed MaxImageSize.
+const maxDownscaleFileBytes = 64 << 20
+
+// QueryWithImage sends a prompt together with one image file, the common
+// "here's a screenshot, what's wrong?" case of QueryWithContent.
+//
+// The image's media type is detected from its content, falling back to the
+// file extension; it must be one of types.ImageMediaTypes. Files larger than
+// MaxImageSize (types.MaxImageBytes by default), or with a side longer than
+// MaxImageDimension, fail with a *types.ImageTooLargeError before anything is
+// sent. With DownscaleImages they are scaled down and re-encoded to fit
+// instead, as types.NewImageContent describes, and the change is logged.
+//
+// Example:
+//
+//	if err := client.QueryWithImage(ctx, "What's wrong with this page?", "screenshot.png"); err != nil {
+//	    log.Fatal(err)
+//	}
+//	for msg := range client.ReceiveResponse(ctx) {
+//	    // Process messages
+//	}
+func (c *Client) QueryWithImage(ctx context.Context, prompt string, imagePath string) error {
+	if prompt == "" {
+		return fmt.Errorf("prompt cannot be empty")
+	}
+	image, info, err := loadImage(imagePath, types.ImageOptions{
+		MaxBytes:     c.options.MaxImageSize,
+		MaxDimension: c.options.MaxImageDimension,
+		Downscale:    c.options.DownscaleImages,
+		JPEGQuality:  c.options.ImageJPEGQuality,
+	})
+	if err != nil {
+		return err
+	}
+	if info.Transformed() {
+		c.logger.Info("Downscaled image %s from %dx%d %s (%d bytes) to %dx%d %s (%d bytes)", imagePath,
+			info.OriginalWidth, info.OriginalHeight, info.OriginalMediaType, info.OriginalBytes,
+			info.Width, info.Height, info.MediaType, info.Bytes)
+	}
+	return c.QueryWithContent(ctx, []types.UserContentBlock{types.NewTextContent(prompt), image})
+}
+
+// loadImage reads an image file into a base64 content block with
+// types.NewImageContent. Without opts.Downscale, files over opts.MaxBytes
+// (types.MaxImageBytes when 0 or larger) are rejected before being read.
+func loadImage(path string, opts types.ImageOptions) (types.UserContentBlock, *types.ImageInfo, error) {
+	limit := opts.MaxBytes
+	if limit <= 0 || limit > types.MaxImageBytes {
+		limit = types.MaxImageBytes
+	}
+	if opts.Downscale {
+		limit = maxDownscaleFileBytes
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if stat.Size() > limit {
+		return nil, nil, types.NewImageTooLargeError(path, stat.Size(), limit)
+	}
+	// Read one byte past the limit in case the file grew since Stat
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, nil, types.NewImageTooLargeError(path, int64(len(data)), limit)
+	}
+
+	mediaType := imageMediaType(path, data)
+	if mediaType == "" {
+		return nil, nil, types.NewValidationError("image", fmt.Sprintf("%s is not a supported image (want one of %s)", path, strings.Join(types.ImageMediaTypes, ", ")))
+	}
+	block, info, err := types.NewImageContent(mediaType, data, opts)
+	var tooLarge *types.ImageTooLargeError
+	var badFormat *types.ImageFormatError
+	switch {
+	case errors.As(err, &tooLarge):
+		tooLarge.Path = path
+	case errors.As(err, &badFormat):
+		badFormat.Path = path
+	}
+	return block, info, err
+}
+
+// imageMediaType returns the supported media type of an image from its magic
+// bytes, else from its extension, or "" when neither is supported.
+func imageMediaType(path string, data []byte) string {
+	if detected := http.DetectContentType(data); slices.Contains(types.ImageMediaTypes, detected) {
+		return detected
+	}
+	byExtension, _, _ := strings.Cut(mime.TypeByExtension(strings.ToLower(filepath.Ext(path))), ";")
+	if slices.Contains(types.ImageMediaTypes, byExtension) {
+		return byExtension
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	pngenc "image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestClient_QueryWithImage tests the content message written for an image
+// file, media type detection, and the rejection of oversized files.
+func TestClient_QueryWithImage(t *testing.T) {
+	png, err := os.ReadFile(filepath.Join("testdata", "pixel.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Magic bytes win over a misleading extension
+	misnamed := filepath.Join(t.TempDir(), "screenshot.jpg")
+	if err := os.WriteFile(misnamed, png, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("sends the image", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.QueryWithImage(ctx, "What's wrong?", misnamed); err != nil {
+			t.Fatalf("QueryWithImage failed: %v", err)
+		}
+
+		mock.mu.Lock()
+		last := mock.written[len(mock.written)-1]
+		mock.mu.Unlock()
+		var sent struct {
+			Type    string `json:"type"`
+			Message struct {
+				Role    string `json:"role"`
+				Content []struct {
+					Type   string `json:"type"`
+					Text   string `json:"text"`
+					Source struct {
+						Type      string `json:"type"`
+						MediaType string `json:"media_type"`
+						Data      string `json:"data"`
+					} `json:"source"`
+				} `json:"content"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(last), &sent); err != nil {
+			t.Fatalf("written message is not JSON: %v", err)
+		}
+		content := sent.Message.Content
+		if sent.Type != "user" || sent.Message.Role != "user" || len(content) != 2 {
+			t.Fatalf("sent %s", last)
+		}
+		if content[0].Type != "text" || content[0].Text != "What's wrong?" {
+			t.Errorf("first block = %+v, want the prompt", content[0])
+		}
+		image := content[1]
+		if image.Type != "image" || image.Source.Type != "base64" || image.Source.MediaType != "image/png" {
+			t.Errorf("second block = %+v, want a base64 image/png", image)
+		}
+		if image.Source.Data != base64.StdEncoding.EncodeToString(png) {
+			t.Error("image data is not the base64 of the file")
+		}
+	})
+
+	t.Run("rejects oversized and unsupported files", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithMaxImageSize(int64(len(png)-1)), mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		err := client.QueryWithImage(ctx, "What's wrong?", misnamed)
+		if !types.IsImageTooLargeError(err) {
+			t.Errorf("oversized image error = %v, want ImageTooLargeError", err)
+		}
+
+		notes := filepath.Join(t.TempDir(), "notes.txt")
+		if err := os.WriteFile(notes, []byte("not an image"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.QueryWithImage(ctx, "What's wrong?", notes); !types.IsValidationError(err) {
+			t.Errorf("unsupported file error = %v, want ValidationError", err)
+		}
+		if err := client.QueryWithImage(ctx, "What's wrong?", filepath.Join(t.TempDir(), "missing.png")); !os.IsNotExist(err) {
+			t.Errorf("missing file error = %v, want not exist", err)
+		}
+		if slices.Contains(mock.writtenTypes(), "user") {
+			t.Error("a rejected image was written to the CLI")
+		}
+	})
+	t.Run("downscales oversized images", func(t *testing.T) {
+		large := filepath.Join(t.TempDir(), "large.png")
+		img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+		var buf bytes.Buffer
+		if err := pngenc.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(large, buf.Bytes(), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithMaxImageDimension(100), mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		var tooLarge *types.ImageTooLargeError
+		if err := client.QueryWithImage(ctx, "What's wrong?", large); !errors.As(err, &tooLarge) || tooLarge.Path != large {
+			t.Fatalf("without downscaling: error = %v, want an ImageTooLargeError naming the file", err)
+		}
+
+		mock = newMockTransport()
+		client = newMockClient(t, types.NewClaudeAgentOptions().WithMaxImageDimension(100).WithImageDownscaling(0), mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.QueryWithImage(ctx, "What's wrong?", large); err != nil {
+			t.Fatalf("QueryWithImage failed: %v", err)
+		}
+		mock.mu.Lock()
+		last := mock.written[len(mock.written)-1]
+		mock.mu.Unlock()
+		var sent struct {
+			Message struct {
+				Content []struct {
+					Source struct {
+						MediaType string `json:"media_type"`
+						Data      string `json:"data"`
+					} `json:"source"`
+				} `json:"content"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(last), &sent); err != nil || len(sent.Message.Content) != 2 {
+			t.Fatalf("sent %s", last)
+		}
+		data, err := base64.StdEncoding.DecodeString(sent.Message.Content[1].Source.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || format != "png" || config.Width != 100 || config.Height != 75 {
+			t.Errorf("sent a %dx%d %s image (%v), want a 100x75 PNG", config.Width, config.Height, format, err)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// autoContinuer decides when a truncated answer is continued instead of ending
+// the turn. Apart from prompted, it is only touched by the message loop.
+type autoContinuer struct {
+	maxContinues int
+	truncated    bool // The turn's last top-level assistant message hit max_tokens
+	attempts     int  // Continuations sent for the current turn
+
+	mu       sync.Mutex
+	sessions []string // Session IDs of the prompts whose turns have not ended, oldest first
+}
+
+// newAutoContinuer returns nil, which never continues, when maxContinues is
+// not positive or the session cannot take further prompts.
+func newAutoContinuer(maxContinues int, isStreamingMode bool) *autoContinuer {
+	if maxContinues <= 0 || !isStreamingMode {
+		return nil
+	}
+	return &autoContinuer{maxContinues: maxContinues}
+}
+
+// observe records whether the latest assistant answer was truncated. Subagent
+// messages are ignored; only the main answer is continued.
+func (a *autoContinuer) observe(msg types.Message) {
+	if a == nil {
+		return
+	}
+	if assistant, ok := msg.(*types.AssistantMessage); ok && assistant.ParentToolUseID == nil {
+		a.truncated = assistant.IsTruncated()
+	}
+}
+
+// prompted records the session ID a prompt was sent in, so that its turn is
+// continued in the same session. The CLI answers prompts in order.
+func (a *autoContinuer) prompted(sessionID string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sessions = append(a.sessions, sessionID)
+}
+
+// next reports whether the turn ending with result should be continued, and
+// if so returns the attempt number and the session ID of the turn's prompt. A
+// result that ends the turn resets the attempt count for the next turn.
+func (a *autoContinuer) next(result *types.ResultMessage) (int, string, bool) {
+	if a == nil {
+		return 0, "", false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sessionID := "default"
+	if len(a.sessions) > 0 {
+		sessionID = a.sessions[0]
+	}
+	if !a.truncated || IsErrorResult(result) || a.attempts >= a.maxContinues {
+		a.truncated = false
+		a.attempts = 0
+		if len(a.sessions) > 0 {
+			a.sessions = a.sessions[1:]
+		}
+		return 0, "", false
+	}
+	a.truncated = false
+	a.attempts++
+	return a.attempts, sessionID, true
+}
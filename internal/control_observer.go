@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// controlObserverQueueSize bounds the number of pending observer events.
+// Events beyond this are dropped so a slow observer never stalls routing.
+const controlObserverQueueSize = 256
+
+// controlEvent is a single observed control message awaiting delivery.
+// The payload is kept as raw JSON and decoded on the observer goroutine,
+// which gives every observer call its own deep copy.
+type controlEvent struct {
+	direction types.Direction
+	subtype   string
+	raw       []byte
+}
+
+// controlObserver delivers control protocol traffic to a user callback.
+type controlObserver struct {
+	fn      types.ControlObserverFunc
+	events  chan controlEvent
+	dropped int64 // accessed atomically
+	logger  *log.Logger
+}
+
+// newControlObserver returns nil when no callback is configured, which
+// makes observe a no-op.
+func newControlObserver(fn types.ControlObserverFunc, logger *log.Logger) *controlObserver {
+	if fn == nil {
+		return nil
+	}
+	return &controlObserver{
+		fn:     fn,
+		events: make(chan controlEvent, controlObserverQueueSize),
+		logger: logger,
+	}
+}
+
+// observe enqueues an event without blocking.
+func (o *controlObserver) observe(direction types.Direction, subtype string, raw []byte) {
+	if o == nil {
+		return
+	}
+	select {
+	case o.events <- controlEvent{direction: direction, subtype: subtype, raw: raw}:
+	default:
+		atomic.AddInt64(&o.dropped, 1)
+	}
+}
+
+// observeMessage marshals an inbound control message and enqueues it.
+func (o *controlObserver) observeMessage(direction types.Direction, subtype string, msg *types.SystemMessage) {
+	if o == nil {
+		return
+	}
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		o.logger.Warning("Control observer: failed to marshal %s message: %v", subtype, err)
+		return
+	}
+	o.observe(direction, subtype, raw)
+}
+
+// run delivers queued events until stop is closed.
+func (o *controlObserver) run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-o.events:
+			o.deliver(event)
+		}
+	}
+}
+
+// deliver decodes the payload and invokes the callback, isolating routing from observer panics.
+func (o *controlObserver) deliver(event controlEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			o.logger.Warning("Control observer panicked: %v", r)
+		}
+	}()
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(event.raw, &payload); err != nil {
+		o.logger.Warning("Control observer: failed to decode %s payload: %v", event.subtype, err)
+		return
+	}
+	o.fn(event.direction, event.subtype, payload)
+}
+
+// droppedEvents returns how many events were discarded because the queue was full.
+func (o *controlObserver) droppedEvents() int64 {
+	if o == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&o.dropped)
+}
@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// observedEvent records a single control observer invocation.
+type observedEvent struct {
+	direction types.Direction
+	subtype   string
+	payload   map[string]interface{}
+}
+
+// startObservedQuery starts a streaming Query whose control observer records events.
+func startObservedQuery(t *testing.T, opts *types.ClaudeAgentOptions) (*Query, *mockTransport, <-chan observedEvent) {
+	t.Helper()
+
+	events := make(chan observedEvent, 16)
+	opts.WithControlObserver(func(direction types.Direction, subtype string, payload map[string]interface{}) {
+		events <- observedEvent{direction, subtype, payload}
+	})
+
+	ctx := context.Background()
+	transport := newMockTransport()
+	query := NewQuery(ctx, transport, opts, log.NewLogger(false), true)
+	if err := query.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = query.Stop(ctx)
+	})
+	return query, transport, events
+}
+
+// expectEvents waits for the given direction/subtype pairs in order.
+func expectEvents(t *testing.T, events <-chan observedEvent, want ...observedEvent) []observedEvent {
+	t.Helper()
+
+	got := make([]observedEvent, 0, len(want))
+	for _, w := range want {
+		select {
+		case e := <-events:
+			if e.direction != w.direction || e.subtype != w.subtype {
+				t.Fatalf("event %d = (%s, %s), want (%s, %s)", len(got), e.direction, e.subtype, w.direction, w.subtype)
+			}
+			got = append(got, e)
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for event (%s, %s)", w.direction, w.subtype)
+		}
+	}
+	return got
+}
+
+// TestControlObserverInitialize tests that both sides of initialize are observed.
+func TestControlObserverInitialize(t *testing.T) {
+	query, transport, events := startObservedQuery(t, types.NewClaudeAgentOptions())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := query.Initialize(context.Background())
+		done <- err
+	}()
+
+	got := expectEvents(t, events, observedEvent{direction: types.DirectionOutbound, subtype: "initialize"})
+	requestID, _ := got[0].payload["request_id"].(string)
+	if requestID == "" {
+		t.Fatalf("outbound payload missing request_id: %v", got[0].payload)
+	}
+
+	transport.sendMessage(&types.SystemMessage{
+		Type: "control_response",
+		Response: map[string]interface{}{
+			"subtype":    "success",
+			"request_id": requestID,
+			"response":   map[string]interface{}{"commands": []interface{}{}},
+		},
+	})
+
+	got = expectEvents(t, events, observedEvent{direction: types.DirectionInbound, subtype: "success"})
+	response, _ := got[0].payload["response"].(map[string]interface{})
+	if response["request_id"] != requestID {
+		t.Errorf("inbound payload request_id = %v, want %s", response["request_id"], requestID)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+}
+
+// TestControlObserverInboundErrorResponse tests that error responses from the CLI are observed.
+func TestControlObserverInboundErrorResponse(t *testing.T) {
+	query, transport, events := startObservedQuery(t, types.NewClaudeAgentOptions())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := query.Initialize(context.Background())
+		done <- err
+	}()
+
+	got := expectEvents(t, events, observedEvent{direction: types.DirectionOutbound, subtype: "initialize"})
+	transport.sendMessage(&types.SystemMessage{
+		Type: "control_response",
+		Response: map[string]interface{}{
+			"subtype":    "error",
+			"request_id": got[0].payload["request_id"],
+			"error":      "hooks rejected",
+		},
+	})
+
+	expectEvents(t, events, observedEvent{direction: types.DirectionInbound, subtype: "error"})
+	if err := <-done; err == nil {
+		t.Fatal("expected Initialize to fail")
+	}
+}
+
+// TestControlObserverCanUseTool tests that permission requests and replies are observed,
+// and that mutating an observed payload does not affect routing.
+func TestControlObserverCanUseTool(t *testing.T) {
+	var seenTool string
+	opts := types.NewClaudeAgentOptions().WithCanUseTool(
+		func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+			seenTool = toolName
+			return types.PermissionResultAllow{Behavior: "allow"}, nil
+		},
+	)
+	_, transport, events := startObservedQuery(t, opts)
+
+	transport.sendMessage(&types.SystemMessage{
+		Type:      "control_request",
+		RequestID: "cli-1",
+		Request: map[string]interface{}{
+			"subtype":   "can_use_tool",
+			"tool_name": "Bash",
+			"input":     map[string]interface{}{"command": "ls"},
+		},
+	})
+
+	got := expectEvents(t, events,
+		observedEvent{direction: types.DirectionInbound, subtype: "can_use_tool"},
+		observedEvent{direction: types.DirectionOutbound, subtype: "success"},
+	)
+
+	request, _ := got[0].payload["request"].(map[string]interface{})
+	if request["tool_name"] != "Bash" {
+		t.Errorf("inbound payload tool_name = %v, want Bash", request["tool_name"])
+	}
+	request["tool_name"] = "Tampered"
+
+	if seenTool != "Bash" {
+		t.Errorf("permission callback saw tool %q, want Bash", seenTool)
+	}
+
+	// The observer sees the reply just before it is written
+	deadline := time.Now().Add(time.Second)
+	for len(transport.getWrittenData()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	data := transport.getWrittenData()
+	if len(data) == 0 {
+		t.Fatal("permission response was not written")
+	}
+
+	var written map[string]interface{}
+	if err := json.Unmarshal([]byte(data[0]), &written); err != nil {
+		t.Fatalf("failed to decode written response: %v", err)
+	}
+	response, _ := written["response"].(map[string]interface{})
+	if response["request_id"] != "cli-1" {
+		t.Errorf("written response request_id = %v, want cli-1", response["request_id"])
+	}
+}
+
+// TestControlObserverHookCallbackError tests that hook callbacks and error replies are observed.
+func TestControlObserverHookCallbackError(t *testing.T) {
+	_, transport, events := startObservedQuery(t, types.NewClaudeAgentOptions())
+
+	transport.sendMessage(&types.SystemMessage{
+		Type:      "control_request",
+		RequestID: "cli-2",
+		Request: map[string]interface{}{
+			"subtype":     "hook_callback",
+			"callback_id": "hook_missing",
+			"input":       map[string]interface{}{},
+		},
+	})
+
+	got := expectEvents(t, events,
+		observedEvent{direction: types.DirectionInbound, subtype: "hook_callback"},
+		observedEvent{direction: types.DirectionOutbound, subtype: "error"},
+	)
+
+	response, _ := got[1].payload["response"].(map[string]interface{})
+	if response["request_id"] != "cli-2" {
+		t.Errorf("error payload request_id = %v, want cli-2", response["request_id"])
+	}
+}
+
+// TestControlObserverDropsWhenFull tests that a blocked observer never stalls routing.
+func TestControlObserverDropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	opts := types.NewClaudeAgentOptions().WithControlObserver(
+		func(direction types.Direction, subtype string, payload map[string]interface{}) {
+			<-release
+		},
+	)
+	defer close(release)
+
+	observer := newControlObserver(opts.ControlObserver, log.NewLogger(false))
+	stop := make(chan struct{})
+	defer close(stop)
+	go observer.run(stop)
+
+	for i := 0; i < controlObserverQueueSize+10; i++ {
+		observer.observe(types.DirectionInbound, "can_use_tool", []byte(`{}`))
+	}
+
+	if observer.droppedEvents() == 0 {
+		t.Error("expected events to be dropped when the queue is full")
+	}
+}
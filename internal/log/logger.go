@@ -1,43 +1,157 @@
 package log
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
 )
 
 // Logger provides simple logging for the SDK.
 // It writes to stderr with an [SDK] prefix to distinguish from CLI output.
+//
+// A logger can carry fields, such as the connection and session IDs, that
+// prefix every line so the output of concurrent clients can be told apart.
+// Each line is written with a single call, so lines of concurrent loggers do
+// not interleave within a line.
 type Logger struct {
 	verbose bool
+	out     io.Writer
+
+	mu     sync.RWMutex
+	fields []field
+	prefix string // Rendered fields, such as "[conn=a1b2c3] "
+}
+
+// field is a key=value pair shown on every line of a logger.
+type field struct {
+	key, value string
 }
 
 // NewLogger creates a new logger instance.
 func NewLogger(verbose bool) *Logger {
 	return &Logger{
 		verbose: verbose,
+		out:     os.Stderr,
+	}
+}
+
+// NewConnectionID returns a short random ID for telling connections apart in
+// logs and errors.
+func NewConnectionID() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithField returns a child logger whose lines also carry key=value. The child
+// writes to the same output; later changes to either logger's fields do not
+// affect the other.
+func (l *Logger) WithField(key, value string) *Logger {
+	l.mu.RLock()
+	child := &Logger{
+		verbose: l.verbose,
+		out:     l.out,
+		fields:  append(make([]field, 0, len(l.fields)+1), l.fields...),
+	}
+	l.mu.RUnlock()
+	child.SetField(key, value)
+	return child
+}
+
+// WithOutput returns a child logger writing to w instead, for tests.
+func (l *Logger) WithOutput(w io.Writer) *Logger {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return &Logger{
+		verbose: l.verbose,
+		out:     w,
+		fields:  append([]field(nil), l.fields...),
+		prefix:  l.prefix,
+	}
+}
+
+// SetField sets key=value on the lines of this logger from now on, replacing
+// an earlier value of key; an empty value removes it. It is used for values
+// learned after the logger was handed out, such as the session ID.
+func (l *Logger) SetField(key, value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i := 0
+	for i < len(l.fields) && l.fields[i].key != key {
+		i++
+	}
+	switch {
+	case i < len(l.fields) && value == "":
+		l.fields = append(l.fields[:i], l.fields[i+1:]...)
+	case i < len(l.fields):
+		l.fields[i].value = value
+	case value != "":
+		l.fields = append(l.fields, field{key, value})
+	}
+
+	var b strings.Builder
+	for i, f := range l.fields {
+		if i == 0 {
+			b.WriteString("[")
+		} else {
+			b.WriteString(" ")
+		}
+		b.WriteString(f.key + "=" + f.value)
+	}
+	if b.Len() > 0 {
+		b.WriteString("] ")
 	}
+	l.prefix = b.String()
+}
+
+// Field returns the value of key, or "" when it is not set.
+func (l *Logger) Field(key string) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, f := range l.fields {
+		if f.key == key {
+			return f.value
+		}
+	}
+	return ""
 }
 
 // Debug logs a debug message (only when verbose mode is enabled).
 func (l *Logger) Debug(format string, args ...interface{}) {
 	if l.verbose {
-		fmt.Fprintf(os.Stderr, "[SDK DEBUG] "+format+"\n", args...)
+		l.write("[SDK DEBUG] ", format, args)
 	}
 }
 
 // Info logs an informational message (only when verbose mode is enabled).
 func (l *Logger) Info(format string, args ...interface{}) {
 	if l.verbose {
-		fmt.Fprintf(os.Stderr, "[SDK INFO] "+format+"\n", args...)
+		l.write("[SDK INFO] ", format, args)
 	}
 }
 
 // Warning logs a warning message (always displayed).
 func (l *Logger) Warning(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "[SDK WARNING] "+format+"\n", args...)
+	l.write("[SDK WARNING] ", format, args)
 }
 
 // Error logs an error message (always displayed).
 func (l *Logger) Error(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "[SDK ERROR] "+format+"\n", args...)
+	l.write("[SDK ERROR] ", format, args)
+}
+
+// write formats a line and writes it with a single call.
+func (l *Logger) write(level, format string, args []interface{}) {
+	l.mu.RLock()
+	prefix, out := l.prefix, l.out
+	l.mu.RUnlock()
+	if out == nil {
+		out = os.Stderr
+	}
+	_, _ = io.WriteString(out, level+prefix+fmt.Sprintf(format, args...)+"\n")
 }
@@ -0,0 +1,44 @@
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestLogger_Fields tests the prefixes of child loggers and fields set later.
+func TestLogger_Fields(t *testing.T) {
+	var out strings.Builder
+	parent := NewLogger(true).WithOutput(&out)
+	child := parent.WithField("conn", "a1b2c3")
+	child.SetField("session", "8587b432")
+	parent.Info("parent")
+	child.Debug("started %d", 1)
+	child.SetField("session", "")
+	child.Warning("session cleared")
+
+	want := "[SDK INFO] parent\n" +
+		"[SDK DEBUG] [conn=a1b2c3 session=8587b432] started 1\n" +
+		"[SDK WARNING] [conn=a1b2c3] session cleared\n"
+	if out.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", out.String(), want)
+	}
+	if got := child.Field("conn"); got != "a1b2c3" {
+		t.Errorf("Field(conn) = %q, want a1b2c3", got)
+	}
+	if got := parent.Field("conn"); got != "" {
+		t.Errorf("parent Field(conn) = %q, want empty", got)
+	}
+
+	// Quiet loggers still write warnings and errors
+	out.Reset()
+	quiet := NewLogger(false).WithOutput(&out).WithField("conn", "x")
+	quiet.Debug("hidden")
+	quiet.Error("shown: %s", "100%")
+	if out.String() != "[SDK ERROR] [conn=x] shown: 100%\n" {
+		t.Errorf("quiet output = %q", out.String())
+	}
+
+	if a, b := NewConnectionID(), NewConnectionID(); len(a) != 6 || a == b {
+		t.Errorf("NewConnectionID() = %q, %q, want distinct 6-character IDs", a, b)
+	}
+}
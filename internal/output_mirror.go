@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// outputMirror writes assistant text to a writer as messages are routed.
+// It is only used by the message loop and is not safe for concurrent use.
+type outputMirror struct {
+	w          io.Writer
+	toolStatus bool
+	logger     *log.Logger
+	midLine    bool // last write did not end with a newline
+}
+
+// newOutputMirror returns nil when w is nil; a nil mirror ignores messages.
+func newOutputMirror(w io.Writer, toolStatus bool, logger *log.Logger) *outputMirror {
+	if w == nil {
+		return nil
+	}
+	return &outputMirror{w: w, toolStatus: toolStatus, logger: logger}
+}
+
+// mirror writes the text of assistant messages (and tool status lines when
+// enabled), and ends the current line when a turn's result arrives. Thinking
+// blocks are never mirrored.
+func (m *outputMirror) mirror(msg types.Message) {
+	if m == nil {
+		return
+	}
+
+	switch msg := msg.(type) {
+	case *types.AssistantMessage:
+		for _, block := range msg.Content {
+			switch b := block.(type) {
+			case *types.TextBlock:
+				m.write(b.Text)
+			case *types.ToolUseBlock:
+				if m.toolStatus {
+					m.endLine()
+					m.write(fmt.Sprintf("[tool: %s]\n", b.Name))
+				}
+			}
+		}
+	case *types.ResultMessage:
+		m.endLine()
+	}
+}
+
+// endLine writes a newline if the previous write left a partial line.
+func (m *outputMirror) endLine() {
+	if m.midLine {
+		m.write("\n")
+	}
+}
+
+func (m *outputMirror) write(s string) {
+	if s == "" || m.w == nil {
+		return
+	}
+	if _, err := io.WriteString(m.w, s); err != nil {
+		// Stop mirroring rather than reporting the same failure for every message
+		m.logger.Warning("Output mirror write failed, disabling mirror: %v", err)
+		m.w = nil
+		return
+	}
+	m.midLine = s[len(s)-1] != '\n'
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestOutputMirror(t *testing.T) {
+	turn := []types.Message{
+		&types.AssistantMessage{Content: []types.ContentBlock{
+			&types.ThinkingBlock{Thinking: "secret reasoning"},
+			&types.TextBlock{Text: "Checking."},
+			&types.ToolUseBlock{Name: "Bash"},
+		}},
+		&types.UserMessage{Content: "tool output"},
+		&types.AssistantMessage{Content: []types.ContentBlock{&types.TextBlock{Text: "All good."}}},
+		&types.ResultMessage{Subtype: "success"},
+	}
+
+	tests := []struct {
+		name       string
+		toolStatus bool
+		want       string
+	}{
+		{"text only", false, "Checking.All good.\n"},
+		{"with tool status", true, "Checking.\n[tool: Bash]\nAll good.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			m := newOutputMirror(&out, tt.toolStatus, log.NewLogger(false))
+			for _, msg := range turn {
+				m.mirror(msg)
+			}
+			if out.String() != tt.want {
+				t.Errorf("mirrored %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+
+	t.Run("nil writer", func(t *testing.T) {
+		if m := newOutputMirror(nil, true, log.NewLogger(false)); m != nil {
+			t.Fatal("expected a nil mirror")
+		}
+		var m *outputMirror
+		m.mirror(turn[0]) // must not panic
+	})
+
+	t.Run("write failure disables mirror", func(t *testing.T) {
+		w := &failingWriter{}
+		m := newOutputMirror(w, false, log.NewLogger(false))
+		for _, msg := range turn {
+			m.mirror(msg)
+		}
+		if w.calls != 1 {
+			t.Errorf("writer called %d times after failing, want 1", w.calls)
+		}
+	})
+}
+
+type failingWriter struct{ calls int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.calls++
+	return 0, errors.New("closed pipe")
+}
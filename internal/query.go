@@ -3,10 +3,16 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
 	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
@@ -34,15 +40,81 @@ type Query struct {
 	canUseTool types.CanUseToolFunc
 	hooks      map[types.HookEvent][]types.HookMatcher
 	mcpServers map[string]types.MCPServer
+	observer   *controlObserver
+
+	// Tool name normalization (alias -> canonical, on top of types.DefaultToolAliases)
+	toolAliases map[string]string
+
+	// Delivery policy
+	echoPolicy           types.EchoedUserMessagePolicy
+	excludedUserMessages int64 // accessed atomically
+
+	// Budget enforcement (spentUSD and deliveryClosed are only touched by the message loop)
+	budgetUSD      *float64
+	spentUSD       float64
+	deliveryClosed bool
+	err            error // terminal error, guarded by mu
+
+	// Output of the current turn, for error context (only touched by the message loop)
+	turns *TurnTracker
+
+	// Progressive copy of assistant text (only touched by the message loop)
+	mirror *outputMirror
+
+	// Usage summed over the session's results, guarded by mu
+	usage types.SessionUsage
+
+	// Statistics shared with the client (nil disables), and the model of the
+	// latest top-level assistant message, to attribute results to (only
+	// touched by the message loop)
+	stats     *StatsRecorder
+	lastModel string
+
+	// Session ID shown on the logger's lines (only touched by the message loop)
+	loggedSessionID string
+
+	// Set when an interrupt was requested, until the result of the interrupted turn
+	interrupted atomic.Bool
+
+	// Set when the message loop exited because the transport's messages ended
+	transportEnded atomic.Bool
+
+	// Length of the current turn's thinking blocks, for estimating thinking
+	// tokens (only touched by the message loop)
+	thinkingChars int
+
+	// Permission mode, session ID and subagents, for permission callbacks
+	session *sessionState
+
+	// Subagent lifecycle events (only touched by the message loop; nil disables)
+	subagents *subagentTracker
+
+	// Continuation of truncated answers (only touched by the message loop; nil disables)
+	autoContinue *autoContinuer
+
+	// SDK-side MaxTurns for CLIs that cannot enforce it, set up by Start
+	// (only touched by the message loop; nil disables)
+	maxTurns  int
+	turnLimit *turnLimiter
+
+	// Tracing spans (nil disables)
+	spans *spanTracker
 
 	// Message handling
 	messagesChan     chan types.Message
+	closeMessages    sync.Once
 	stopChan         chan struct{}
+	stopOnce         sync.Once
 	readLoopDone     chan struct{}
 	started          bool
 	initialized      bool
 	initializeResult map[string]interface{}
 	isStreamingMode  bool
+
+	// System init message from the data stream (distinct from the initialize control request)
+	initMessage     *types.SystemMessage // set before initMessageDone is closed
+	initMessageOnce sync.Once
+	initMessageDone chan struct{}
 }
 
 // responseResult wraps the response or error from a control request.
@@ -65,13 +137,42 @@ func NewQuery(ctx context.Context, transport transport.Transport, opts *types.Cl
 		messagesChan:    make(chan types.Message, 100),
 		stopChan:        make(chan struct{}),
 		readLoopDone:    make(chan struct{}),
+		initMessageDone: make(chan struct{}),
 		isStreamingMode: isStreamingMode,
 		mcpServers:      make(map[string]types.MCPServer),
+		turns:           NewTurnTracker(),
+		session:         newSessionState(types.PermissionModeDefault),
 	}
 
 	if opts != nil {
 		q.canUseTool = opts.CanUseTool
 		q.hooks = opts.Hooks
+		q.echoPolicy = opts.EchoedUserMessages
+		q.budgetUSD = opts.MaxBudgetUSD
+		q.observer = newControlObserver(opts.ControlObserver, logger)
+		q.toolAliases = opts.ToolAliases
+		if opts.PermissionMode != nil {
+			q.session.setPermissionMode(*opts.PermissionMode)
+		}
+		if opts.Model != nil {
+			q.session.setModel(*opts.Model)
+		}
+		q.session.setMaxThinkingTokens(opts.MaxThinkingTokens)
+		q.mirror = newOutputMirror(opts.StdoutMirror, opts.MirrorToolStatus, logger)
+		q.subagents = newSubagentTracker(opts.SubagentObserver, logger)
+		q.autoContinue = newAutoContinuer(opts.AutoContinueOnTruncation, isStreamingMode)
+		if opts.MaxTurns != nil {
+			q.maxTurns = *opts.MaxTurns
+		}
+		q.spans = newSpanTracker(opts.SpanSink, q.session, q.normalizeToolName, logger)
+		if servers, ok := opts.McpServers.(map[string]interface{}); ok {
+			q.registerSDKMCPServers(servers)
+		}
+		for _, name := range slices.Sorted(maps.Keys(opts.Agents)) {
+			for _, tool := range opts.Agents[name].UnknownTools() {
+				logger.Warning("Agent %q lists unknown tool %q", name, tool)
+			}
+		}
 	}
 
 	return q
@@ -89,10 +190,12 @@ func (q *Query) Initialize(ctx context.Context) (map[string]interface{}, error)
 
 	q.logger.Debug("Initializing control protocol...")
 
-	// Build hooks configuration
+	// Build hooks configuration. Events are visited in sorted order so that
+	// callback IDs, and with them the request bytes, are the same on every run.
 	hooksConfig := make(map[string]interface{})
 	if q.hooks != nil {
-		for event, matchers := range q.hooks {
+		for _, event := range slices.Sorted(maps.Keys(q.hooks)) {
+			matchers := q.hooks[event]
 			if len(matchers) == 0 {
 				continue
 			}
@@ -109,7 +212,7 @@ func (q *Query) Initialize(ctx context.Context) (map[string]interface{}, error)
 					"hookCallbackIds": callbackIDs,
 				}
 				if matcher.Matcher != nil {
-					hookConfig["matcher"] = *matcher.Matcher
+					hookConfig["matcher"] = q.expandMatcher(*matcher.Matcher)
 				}
 				eventHooks = append(eventHooks, hookConfig)
 			}
@@ -137,6 +240,12 @@ func (q *Query) Initialize(ctx context.Context) (map[string]interface{}, error)
 	return result, nil
 }
 
+// InitializeResult returns the CLI's response to the initialize request, or
+// nil before Initialize has succeeded. Callers must not race with Initialize.
+func (q *Query) InitializeResult() map[string]interface{} {
+	return q.initializeResult
+}
+
 // Start begins the control message handling loop.
 func (q *Query) Start(ctx context.Context) error {
 	q.mu.Lock()
@@ -147,37 +256,162 @@ func (q *Query) Start(ctx context.Context) error {
 	q.started = true
 	q.mu.Unlock()
 
+	// The transport is connected, so it knows whether its CLI honors --max-turns
+	if enforcer, ok := q.transport.(sdkEnforcer); ok && enforcer.EnforcedBySDK("--max-turns") {
+		q.turnLimit = newTurnLimiter(q.maxTurns)
+	}
+
 	// Start message reading loop
 	go q.messageLoop()
 
+	if q.observer != nil {
+		go q.observer.run(q.stopChan)
+	}
+
 	return nil
 }
 
-// Stop gracefully stops the query handler.
+// Stop gracefully stops the query handler. It does not close the transport;
+// use Close to tear down both.
 func (q *Query) Stop(ctx context.Context) error {
-	// Signal stop
-	select {
-	case <-q.stopChan:
-		// Already stopped
-		return nil
-	default:
-		close(q.stopChan)
+	err := q.stopLoop(ctx)
+	q.finishMessages()
+	return err
+}
+
+// Close tears down the query handler and its transport in a fixed order:
+//
+//  1. Cancel delivery, which unblocks a message loop waiting on a consumer
+//     that stopped reading.
+//  2. Wait for the message loop to exit, bounded by ctx.
+//  3. Close the transport, once nothing routes messages from it.
+//  4. Close the consumer channel.
+//
+// If ctx ends before the message loop exits, the transport is closed anyway
+// and the consumer channel is closed as soon as the loop has exited, so the
+// channel is never closed while the loop might still send on it.
+func (q *Query) Close(ctx context.Context) error {
+	var errs []error
+	if err := q.stopLoop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := q.transport.Close(ctx); err != nil {
+		errs = append(errs, err)
 	}
+	q.spans.finish()
+	q.finishMessages()
+	return errors.Join(errs...)
+}
 
-	// Cancel context to stop all operations
-	q.cancel()
+// stopLoop signals the message loop to stop, cancels in-flight operations and
+// waits for the loop to exit.
+func (q *Query) stopLoop(ctx context.Context) error {
+	q.stopOnce.Do(func() {
+		close(q.stopChan)
+		q.cancel()
+	})
+	if !q.isStarted() {
+		return nil
+	}
 
-	// Wait for read loop to complete
 	select {
 	case <-q.readLoopDone:
+		return nil
 	case <-ctx.Done():
 		return ctx.Err()
 	}
+}
 
-	// Close message channel
-	close(q.messagesChan)
+// finishMessages closes the consumer channel once the message loop, its only
+// sender, has exited. It does not block.
+func (q *Query) finishMessages() {
+	if !q.isStarted() {
+		q.closeMessagesChan()
+		return
+	}
+	select {
+	case <-q.readLoopDone:
+		q.closeMessagesChan()
+	default:
+		go func() {
+			<-q.readLoopDone
+			q.closeMessagesChan()
+		}()
+	}
+}
 
-	return nil
+// isStarted reports whether Start launched the message loop.
+func (q *Query) isStarted() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.started
+}
+
+// closeMessagesChan closes the consumer channel exactly once.
+func (q *Query) closeMessagesChan() {
+	q.closeMessages.Do(func() {
+		close(q.messagesChan)
+	})
+}
+
+// Err returns the terminal error that ended message delivery, if any.
+// It returns a *types.BudgetExceededError when MaxBudgetUSD was exceeded.
+func (q *Query) Err() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+// CacheEfficiency returns the cache and request counts summed over every result
+// received so far.
+func (q *Query) CacheEfficiency() types.CacheEfficiency {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usage.Cache
+}
+
+// Usage returns the usage summed over every result received so far.
+func (q *Query) Usage() types.SessionUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usage
+}
+
+// countUsage adds the usage of a result to the session's, attributing the
+// thinking blocks seen since the previous result to it, and records it in the
+// client's statistics. ended is set for the result delivered to end a query.
+func (q *Query) countUsage(result *types.ResultMessage, ended bool) {
+	usage := types.SessionUsage{
+		Cache:    types.CacheEfficiencyFromResult(result),
+		Thinking: types.ThinkingUsageFromResult(result, q.thinkingChars),
+	}
+	q.thinkingChars = 0
+
+	q.mu.Lock()
+	q.usage = q.usage.Add(usage)
+	q.mu.Unlock()
+
+	q.stats.record(result, q.lastModel, ended)
+}
+
+// logSessionID adds the session ID to the logger's lines once the CLI has
+// announced it, shortened like a git hash.
+func (q *Query) logSessionID() {
+	id := q.session.currentSessionID()
+	if id == "" || id == q.loggedSessionID {
+		return
+	}
+	q.loggedSessionID = id
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	q.logger.SetField("session", id)
+}
+
+// SetStatsRecorder makes the query record its results in stats. It must be
+// called before Start.
+func (q *Query) SetStatsRecorder(stats *StatsRecorder) {
+	q.stats = stats
 }
 
 // GetMessages returns a channel for consuming normal (non-control) messages.
@@ -185,6 +419,19 @@ func (q *Query) GetMessages(ctx context.Context) <-chan types.Message {
 	return q.messagesChan
 }
 
+// Done returns a channel closed when the message loop has exited, because the
+// transport's messages ended or the query was stopped.
+func (q *Query) Done() <-chan struct{} {
+	return q.readLoopDone
+}
+
+// TransportEnded reports whether the message loop exited because the
+// transport's messages ended, e.g. because the CLI exited, rather than
+// because the query was stopped.
+func (q *Query) TransportEnded() bool {
+	return q.transportEnded.Load()
+}
+
 // messageLoop reads messages from transport and routes them.
 func (q *Query) messageLoop() {
 	defer close(q.readLoopDone)
@@ -203,7 +450,10 @@ func (q *Query) messageLoop() {
 		case msg, ok := <-messages:
 			if !ok {
 				q.logger.Debug("Message loop stopped: transport channel closed")
-				// Channel closed - transport has stopped
+				// Channel closed - transport has stopped, so nothing more will be
+				// delivered; the loop is the only sender
+				q.transportEnded.Store(true)
+				q.closeMessagesChan()
 				return
 			}
 
@@ -227,6 +477,8 @@ func (q *Query) routeMessage(msg types.Message) error {
 	// Handle control responses
 	if msgType == "control_response" {
 		if sysMsg, ok := msg.(*types.SystemMessage); ok {
+			subtype, _ := sysMsg.Response["subtype"].(string)
+			q.observer.observeMessage(types.DirectionInbound, subtype, sysMsg)
 			return q.handleControlResponse(sysMsg)
 		}
 		return types.NewControlProtocolError("invalid control_response message type")
@@ -236,19 +488,353 @@ func (q *Query) routeMessage(msg types.Message) error {
 	if msgType == "control_request" {
 		q.logger.Debug("Handling control request from CLI")
 		if sysMsg, ok := msg.(*types.SystemMessage); ok {
+			subtype, _ := sysMsg.Request["subtype"].(string)
+			q.observer.observeMessage(types.DirectionInbound, subtype, sysMsg)
+			if subtype == "interrupt" {
+				// Interrupted from another surface; the turn's result follows
+				q.interrupted.Store(true)
+			}
 			go q.handleControlRequest(sysMsg)
 			return nil
 		}
 		return types.NewControlProtocolError("invalid control_request message type")
 	}
 
+	// Record the session init message; it is still delivered below
+	if sysMsg, ok := msg.(*types.SystemMessage); ok && sysMsg.IsInit() {
+		q.initMessageOnce.Do(func() {
+			q.initMessage = sysMsg
+			close(q.initMessageDone)
+		})
+	}
+
+	q.session.observe(msg)
+	q.logSessionID()
+	q.subagents.observe(msg)
+	if assistant, ok := msg.(*types.AssistantMessage); ok && assistant.ParentToolUseID == nil && assistant.Model != "" {
+		q.lastModel = assistant.Model
+	}
+	q.spans.observe(msg)
+
+	// Mark the result of a turn ended by a user interrupt
+	if result, ok := msg.(*types.ResultMessage); ok && q.interrupted.Swap(false) {
+		if result.Meta == nil {
+			result.Meta = &types.ResultMeta{}
+		}
+		result.Meta.InterruptedByUser = true
+	}
+
+	// A query over the SDK-enforced turn limit ends with a synthesized result
+	switch q.turnLimit.observe(msg) {
+	case turnLimitExceeded:
+		msg = q.limitTurns(msg)
+		msgType = msg.GetMessageType()
+	case turnLimitDrop:
+		if result, ok := msg.(*types.ResultMessage); ok {
+			q.countUsage(result, false)
+		}
+		q.logger.Debug("Dropping message after the turn limit: type=%s", msgType)
+		return nil
+	}
+
+	// Apply the echoed user message policy before delivery
+	if userMsg, ok := msg.(*types.UserMessage); ok && !q.shouldDeliverUserMessage(userMsg) {
+		atomic.AddInt64(&q.excludedUserMessages, 1)
+		q.logger.Debug("Excluding echoed user message (policy=%s)", q.echoPolicy)
+		return nil
+	}
+
+	// Delivery has ended (e.g. budget exceeded) - drop remaining messages
+	if q.deliveryClosed {
+		q.logger.Debug("Dropping message after delivery closed: type=%s", msgType)
+		return nil
+	}
+
+	q.thinkingChars += types.ThinkingChars(msg)
+
+	// A truncated answer is continued instead of ending the turn
+	q.autoContinue.observe(msg)
+	if result, ok := msg.(*types.ResultMessage); ok {
+		if attempt, sessionID, ok := q.autoContinue.next(result); ok && q.continueTruncatedTurn(result, attempt, sessionID) {
+			return nil
+		}
+		q.spans.endTurn(result)
+	}
+
+	q.mirror.mirror(msg)
+
+	// Count usage before delivery so a consumer that has seen the result also sees its usage
+	if result, ok := msg.(*types.ResultMessage); ok {
+		q.countUsage(result, true)
+	}
+
 	// Regular message - send to consumer
 	select {
 	case q.messagesChan <- msg:
-		return nil
 	case <-q.ctx.Done():
 		return q.ctx.Err()
 	}
+
+	q.turns.Observe(msg)
+	if result, ok := msg.(*types.ResultMessage); ok {
+		q.enforceBudget(result, q.turns.Context())
+		q.turns.Reset()
+	}
+	return nil
+}
+
+// continueTruncatedTurn withholds the result of a turn whose answer was cut off
+// by the output token limit, asks the CLI to continue in sessionID, the session
+// of the turn's prompt, and announces it with an auto_continue SystemMessage.
+// The result's usage and cost are still counted. It returns false, so the
+// result is delivered as usual, if the prompt could not be sent.
+func (q *Query) continueTruncatedTurn(result *types.ResultMessage, attempt int, sessionID string) bool {
+	data, err := MarshalUserMessage(types.ContinuationPrompt, sessionID)
+	if err == nil {
+		err = q.transport.Write(q.ctx, string(data))
+	}
+	if err != nil {
+		q.logger.Warning("Failed to continue truncated answer: %v", err)
+		return false
+	}
+	q.logger.Debug("Continuing truncated answer (attempt %d of %d)", attempt, q.autoContinue.maxContinues)
+
+	q.countUsage(result, false)
+	q.enforceBudget(result, q.turns.Context())
+	if q.deliveryClosed {
+		return true
+	}
+
+	event := &types.SystemMessage{
+		Type:    "system",
+		Subtype: types.SystemSubtypeAutoContinue,
+		Data: map[string]interface{}{
+			"attempt":       attempt,
+			"max_continues": q.autoContinue.maxContinues,
+			"session_id":    result.SessionID,
+		},
+		SessionID: result.SessionID,
+	}
+	select {
+	case q.messagesChan <- event:
+	case <-q.ctx.Done():
+	}
+	return true
+}
+
+// limitTurns returns the error_max_turns result that replaces msg, the message
+// starting a turn over MaxTurns, and interrupts the CLI so it stops the query.
+// Its own result of the query is dropped when it arrives.
+func (q *Query) limitTurns(msg types.Message) *types.ResultMessage {
+	sessionID := types.MessageSessionID(msg)
+	if sessionID == "" {
+		sessionID = q.session.currentSessionID()
+	}
+	result := q.turnLimit.result(sessionID)
+	q.logger.Warning("%s; interrupting query", *result.Result)
+
+	if q.isStreamingMode {
+		// The response is routed by this loop, so wait for it on a separate goroutine
+		go func() {
+			ctx, cancel := context.WithTimeout(q.ctx, budgetInterruptTimeout)
+			defer cancel()
+			if err := q.sendInterrupt(ctx); err != nil {
+				q.logger.Warning("Failed to interrupt after the turn limit: %v", err)
+			}
+		}()
+	}
+	return result
+}
+
+// Interrupt asks the CLI to stop the turn in progress and waits for it to
+// acknowledge. The CLI still ends the turn with a ResultMessage, which is
+// marked as interrupted by the user.
+func (q *Query) Interrupt(ctx context.Context) error {
+	q.interrupted.Store(true)
+	return q.sendInterrupt(ctx)
+}
+
+// sendInterrupt sends an interrupt request without marking the turn's result.
+func (q *Query) sendInterrupt(ctx context.Context) error {
+	_, err := q.sendControlRequest(ctx, map[string]interface{}{"subtype": "interrupt"})
+	return err
+}
+
+// SetPermissionMode asks the CLI to switch the session to mode and, once it
+// acknowledges, records the new mode for permission callbacks.
+func (q *Query) SetPermissionMode(ctx context.Context, mode types.PermissionMode) error {
+	request := map[string]interface{}{"subtype": "set_permission_mode", "mode": string(mode)}
+	if _, err := q.sendControlRequest(ctx, request); err != nil {
+		return err
+	}
+	q.session.setPermissionMode(mode)
+	return nil
+}
+
+// SetModel asks the CLI to use model for the rest of the session and, once it
+// acknowledges, records it. An empty model selects the CLI's default.
+func (q *Query) SetModel(ctx context.Context, model string) error {
+	request := map[string]interface{}{"subtype": "set_model", "model": nil}
+	if model != "" {
+		request["model"] = model
+	}
+	if _, err := q.sendControlRequest(ctx, request); err != nil {
+		return err
+	}
+	q.session.setModel(model)
+	return nil
+}
+
+// Model returns the model last set through the options or SetModel, or "" for
+// the CLI's default.
+func (q *Query) Model() string {
+	return q.session.currentModel()
+}
+
+// SetMaxThinkingTokens asks the CLI to limit extended thinking to tokens for
+// the rest of the session and, once it acknowledges, records the limit. A nil
+// limit selects the CLI's default.
+func (q *Query) SetMaxThinkingTokens(ctx context.Context, tokens *int) error {
+	request := map[string]interface{}{"subtype": "set_max_thinking_tokens", "max_thinking_tokens": nil}
+	if tokens != nil {
+		request["max_thinking_tokens"] = *tokens
+	}
+	if _, err := q.sendControlRequest(ctx, request); err != nil {
+		return err
+	}
+	q.session.setMaxThinkingTokens(tokens)
+	return nil
+}
+
+// MaxThinkingTokens returns the thinking limit last set through the options
+// or SetMaxThinkingTokens, or nil for the CLI's default.
+func (q *Query) MaxThinkingTokens() *int {
+	return q.session.currentMaxThinkingTokens()
+}
+
+// Ping makes a control request round trip that changes nothing: it restates
+// the active permission mode, which every CLI version acknowledges. An error
+// response still shows the CLI is alive and answering, so only a failed write
+// or the end of ctx is returned.
+func (q *Query) Ping(ctx context.Context) error {
+	if !q.isStreamingMode {
+		return types.NewControlProtocolErrorWithCause("ping failed", errors.New("control requests require streaming mode"))
+	}
+	request := map[string]interface{}{"subtype": "set_permission_mode", "mode": string(q.PermissionMode())}
+	_, err := q.sendControlRequest(ctx, request)
+	var rejected *types.ControlProtocolError
+	if errors.As(err, &rejected) && rejected.Cause == nil {
+		return nil
+	}
+	return err
+}
+
+// PermissionMode returns the session's active permission mode, as last
+// reported by the CLI or changed through the control protocol.
+func (q *Query) PermissionMode() types.PermissionMode {
+	return q.session.currentPermissionMode()
+}
+
+// budgetInterruptTimeout bounds how long the SDK waits for the CLI to acknowledge
+// the interrupt sent when the budget is exceeded.
+const budgetInterruptTimeout = 5 * time.Second
+
+// enforceBudget accumulates the cost of a delivered ResultMessage and, once the
+// configured budget is exceeded, records a BudgetExceededError, closes the
+// message channel and interrupts the CLI. turnContext is the output of the
+// turn that produced the result.
+func (q *Query) enforceBudget(result *types.ResultMessage, turnContext *types.ErrorContext) {
+	if q.budgetUSD == nil || result.TotalCostUSD == nil {
+		return
+	}
+
+	q.spentUSD += *result.TotalCostUSD
+	if q.spentUSD <= *q.budgetUSD {
+		return
+	}
+
+	budgetErr := types.NewBudgetExceededError(*q.budgetUSD, q.spentUSD)
+	budgetErr.Context = turnContext
+	q.logger.Warning("%v; interrupting session", budgetErr)
+
+	q.mu.Lock()
+	q.err = budgetErr
+	q.mu.Unlock()
+
+	q.deliveryClosed = true
+	q.closeMessagesChan()
+
+	if !q.isStreamingMode {
+		return
+	}
+
+	// The response is routed by this loop, so wait for it on a separate goroutine
+	go func() {
+		ctx, cancel := context.WithTimeout(q.ctx, budgetInterruptTimeout)
+		defer cancel()
+		if err := q.sendInterrupt(ctx); err != nil {
+			q.logger.Warning("Failed to interrupt after budget exceeded: %v", err)
+		}
+	}()
+}
+
+// shouldDeliverUserMessage applies the echoed user message policy to a UserMessage.
+func (q *Query) shouldDeliverUserMessage(msg *types.UserMessage) bool {
+	switch q.echoPolicy {
+	case types.EchoedUserMessagesExclude:
+		return false
+	case types.EchoedUserMessagesToolResultsOnly:
+		return msg.HasToolResults()
+	default:
+		return true
+	}
+}
+
+// WaitForInit blocks until the CLI's system init message has been routed and returns it.
+func (q *Query) WaitForInit(ctx context.Context) (*types.SystemMessage, error) {
+	select {
+	case <-q.initMessageDone:
+		return q.initMessage, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-q.readLoopDone:
+		// The stream may have ended right after delivering init
+		select {
+		case <-q.initMessageDone:
+			return q.initMessage, nil
+		default:
+		}
+		return nil, types.NewControlProtocolError("message stream ended before init message")
+	}
+}
+
+// BeginTurn marks the start of a turn, once its prompt has been sent in
+// sessionID: the turn is traced, and a truncated answer is continued in the
+// same session.
+func (q *Query) BeginTurn(sessionID string) {
+	q.autoContinue.prompted(sessionID)
+	q.spans.beginTurn()
+}
+
+// InitMessage returns the CLI's system init message, or nil if it has not arrived yet.
+func (q *Query) InitMessage() *types.SystemMessage {
+	select {
+	case <-q.initMessageDone:
+		return q.initMessage
+	default:
+		return nil
+	}
+}
+
+// DroppedControlEvents returns how many control observer events were dropped
+// because the observer could not keep up.
+func (q *Query) DroppedControlEvents() int64 {
+	return q.observer.droppedEvents()
+}
+
+// ExcludedUserMessages returns how many echoed UserMessages were dropped by the delivery policy.
+func (q *Query) ExcludedUserMessages() int64 {
+	return atomic.LoadInt64(&q.excludedUserMessages)
 }
 
 // handleControlResponse handles a control response message.
@@ -334,16 +920,27 @@ func (q *Query) handleControlRequest(msg *types.SystemMessage) {
 
 	switch subtype {
 	case "can_use_tool":
+		toolName, _ := requestData["tool_name"].(string)
+		toolUseID, _ := requestData["tool_use_id"].(string)
+		span := q.spans.child(types.SpanPermission, toolUseID, map[string]interface{}{
+			types.SpanAttrToolName:  q.normalizeToolName(toolName),
+			types.SpanAttrToolUseID: toolUseID,
+		})
 		response, err = q.handlePermissionRequest(requestData)
+		span.end(permissionOutcome(response, err), err)
 	case "hook_callback":
+		span := q.spans.child(types.SpanHook, hookToolUseID(requestData), hookSpanAttributes(requestData, q.normalizeToolName))
 		response, err = q.handleHookCallback(requestData)
+		span.end(spanOutcome(err), err)
 	case "mcp_message":
 		response, err = q.handleMCPMessage(requestData)
 	case "interrupt":
 		// Handle interrupt - just acknowledge for now
 		response = make(map[string]interface{})
 	case "set_permission_mode":
-		// Handle permission mode change - acknowledge for now
+		if mode, ok := requestData["mode"].(string); ok && mode != "" {
+			q.session.setPermissionMode(types.PermissionMode(mode))
+		}
 		response = make(map[string]interface{})
 	default:
 		err = types.NewControlProtocolError("unsupported control request subtype: " + subtype)
@@ -379,6 +976,10 @@ func (q *Query) handlePermissionRequest(requestData map[string]interface{}) (map
 		return nil, types.NewControlProtocolError("missing tool_name or input in permission request")
 	}
 
+	// Callbacks see the canonical name; the raw name is kept in the context
+	rawToolName := toolName
+	toolName = q.normalizeToolName(rawToolName)
+
 	// Build permission context
 	permissionUpdates := make([]types.PermissionUpdate, 0)
 	for _, s := range suggestions {
@@ -395,7 +996,11 @@ func (q *Query) handlePermissionRequest(requestData map[string]interface{}) (map
 
 	ctx := types.ToolPermissionContext{
 		Suggestions: permissionUpdates,
+		RawToolName: rawToolName,
+		RawRequest:  copyJSONObject(requestData),
 	}
+	parentToolUseID, _ := requestData["parent_tool_use_id"].(string)
+	q.session.fillPermissionContext(&ctx, parentToolUseID)
 
 	// Call permission callback
 	q.logger.Debug("handlePermissionRequest: CALLING canUseTool callback for tool=%s", toolName)
@@ -419,6 +1024,7 @@ func (q *Query) handlePermissionRequest(requestData map[string]interface{}) (map
 		}
 		if len(r.UpdatedPermissions) > 0 {
 			response["updatedPermissions"] = r.UpdatedPermissions
+			q.session.applyPermissionUpdates(r.UpdatedPermissions)
 		}
 
 	case *types.PermissionResultAllow:
@@ -430,6 +1036,7 @@ func (q *Query) handlePermissionRequest(requestData map[string]interface{}) (map
 		}
 		if len(r.UpdatedPermissions) > 0 {
 			response["updatedPermissions"] = r.UpdatedPermissions
+			q.session.applyPermissionUpdates(r.UpdatedPermissions)
 		}
 
 	case types.PermissionResultDeny:
@@ -476,8 +1083,13 @@ func (q *Query) handleHookCallback(requestData map[string]interface{}) (map[stri
 		return nil, types.NewControlProtocolError("no hook callback found for ID: " + callbackID)
 	}
 
-	// Build hook context
-	hookCtx := types.HookContext{}
+	// Build hook context, exposing both raw and canonical tool names
+	inputMap, _ := input.(map[string]interface{})
+	hookCtx := types.HookContext{RawInput: copyJSONObject(inputMap)}
+	if rawToolName, ok := inputMap["tool_name"].(string); ok && rawToolName != "" {
+		hookCtx.RawToolName = rawToolName
+		hookCtx.ToolName = q.normalizeToolName(rawToolName)
+	}
 
 	// Call hook callback
 	hookOutput, err := callback(q.ctx, input, toolUseID, hookCtx)
@@ -495,6 +1107,33 @@ func (q *Query) handleHookCallback(requestData map[string]interface{}) (map[stri
 	return response, nil
 }
 
+// copyJSONObject returns a deep copy of a decoded JSON object, so callbacks
+// can read or modify it without affecting the request. A nil object yields an
+// empty map.
+func copyJSONObject(object map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		copied[key] = copyJSONValue(value)
+	}
+	return copied
+}
+
+// copyJSONValue returns a deep copy of a decoded JSON value.
+func copyJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyJSONObject(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyJSONValue(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
 // handleMCPMessage handles an MCP message request.
 func (q *Query) handleMCPMessage(requestData map[string]interface{}) (map[string]interface{}, error) {
 	serverName, _ := requestData["server_name"].(string)
@@ -548,6 +1187,15 @@ func (q *Query) handleMCPMessage(requestData map[string]interface{}) (map[string
 
 // sendControlRequest sends a control request to CLI and waits for response.
 func (q *Query) sendControlRequest(ctx context.Context, request map[string]interface{}) (map[string]interface{}, error) {
+	subtype, _ := request["subtype"].(string)
+	span := q.spans.child(types.SpanControlRequest, "", map[string]interface{}{types.SpanAttrSubtype: subtype})
+	response, err := q.exchangeControlRequest(ctx, request)
+	span.end(spanOutcome(err), err)
+	return response, err
+}
+
+// exchangeControlRequest writes a control request and waits for its response.
+func (q *Query) exchangeControlRequest(ctx context.Context, request map[string]interface{}) (map[string]interface{}, error) {
 	if !q.isStreamingMode {
 		return nil, types.NewControlProtocolError("control requests require streaming mode")
 	}
@@ -562,10 +1210,10 @@ func (q *Query) sendControlRequest(ctx context.Context, request map[string]inter
 	q.mu.Unlock()
 
 	// Build control request
-	controlRequest := map[string]interface{}{
-		"type":       "control_request",
-		"request_id": requestID,
-		"request":    request,
+	controlRequest := controlRequestEnvelope{
+		Type:      "control_request",
+		RequestID: requestID,
+		Request:   request,
 	}
 
 	// Marshal and send
@@ -577,6 +1225,9 @@ func (q *Query) sendControlRequest(ctx context.Context, request map[string]inter
 		return nil, types.NewControlProtocolErrorWithCause("failed to marshal control request", err)
 	}
 
+	subtype, _ := request["subtype"].(string)
+	q.observer.observe(types.DirectionOutbound, subtype, data)
+
 	if err := q.transport.Write(ctx, string(data)); err != nil {
 		q.mu.Lock()
 		delete(q.requestMap, requestID)
@@ -591,6 +1242,20 @@ func (q *Query) sendControlRequest(ctx context.Context, request map[string]inter
 			return nil, result.err
 		}
 		return result.response, nil
+	case <-q.readLoopDone:
+		// Nothing reads the response any more, unless it came in last
+		select {
+		case result := <-responseChan:
+			if result.err != nil {
+				return nil, result.err
+			}
+			return result.response, nil
+		default:
+		}
+		q.mu.Lock()
+		delete(q.requestMap, requestID)
+		q.mu.Unlock()
+		return nil, types.NewControlProtocolError("message loop stopped before the response arrived")
 	case <-ctx.Done():
 		q.mu.Lock()
 		delete(q.requestMap, requestID)
@@ -601,12 +1266,12 @@ func (q *Query) sendControlRequest(ctx context.Context, request map[string]inter
 
 // sendSuccessResponse sends a success control response.
 func (q *Query) sendSuccessResponse(requestID string, response map[string]interface{}) {
-	controlResponse := map[string]interface{}{
-		"type": "control_response",
-		"response": map[string]interface{}{
-			"subtype":    "success",
-			"request_id": requestID,
-			"response":   response,
+	controlResponse := controlResponseEnvelope{
+		Type: "control_response",
+		Response: controlSuccessBody{
+			Subtype:   "success",
+			RequestID: requestID,
+			Response:  response,
 		},
 	}
 
@@ -617,19 +1282,20 @@ func (q *Query) sendSuccessResponse(requestID string, response map[string]interf
 	}
 
 	q.logger.Debug("sendSuccessResponse: sending control_response: %s", string(data))
+	q.observer.observe(types.DirectionOutbound, "success", data)
 	if err := q.transport.Write(q.ctx, string(data)); err != nil {
-		q.logger.Error("sendSuccessResponse: failed to write: %v", err)
+		q.logWriteError("sendSuccessResponse", err)
 	}
 }
 
 // sendErrorResponse sends an error control response.
 func (q *Query) sendErrorResponse(requestID string, errorMsg string) {
-	controlResponse := map[string]interface{}{
-		"type": "control_response",
-		"response": map[string]interface{}{
-			"subtype":    "error",
-			"request_id": requestID,
-			"error":      errorMsg,
+	controlResponse := controlResponseEnvelope{
+		Type: "control_response",
+		Response: controlErrorBody{
+			Subtype:   "error",
+			RequestID: requestID,
+			Error:     errorMsg,
 		},
 	}
 
@@ -638,9 +1304,20 @@ func (q *Query) sendErrorResponse(requestID string, errorMsg string) {
 		return
 	}
 
+	q.observer.observe(types.DirectionOutbound, "error", data)
 	_ = q.transport.Write(q.ctx, string(data))
 }
 
+// logWriteError reports a failed control response write. Writes that fail
+// because the query is shutting down are expected and only logged at debug level.
+func (q *Query) logWriteError(op string, err error) {
+	if q.ctx.Err() != nil {
+		q.logger.Debug("%s: not written during shutdown: %v", op, err)
+		return
+	}
+	q.logger.Error("%s: failed to write: %v", op, err)
+}
+
 // generateRequestID generates a unique request ID.
 func (q *Query) generateRequestID() string {
 	id := atomic.AddInt64(&q.nextRequestID, 1)
@@ -658,6 +1335,32 @@ func (q *Query) registerHookCallback(callback types.HookCallbackFunc) string {
 	return callbackID
 }
 
+// registerSDKMCPServers registers in-process SDK servers from the McpServers
+// option so mcp_message requests from the CLI can be routed to them.
+func (q *Query) registerSDKMCPServers(servers map[string]interface{}) {
+	for name, server := range servers {
+		var instance interface{}
+		switch config := server.(type) {
+		case types.McpSdkServerConfig:
+			instance = config.Instance
+		case *types.McpSdkServerConfig:
+			if config == nil {
+				continue
+			}
+			instance = config.Instance
+		default:
+			continue
+		}
+
+		mcpServer, ok := instance.(types.MCPServer)
+		if !ok {
+			q.logger.Warning("SDK MCP server %q instance (%T) does not implement types.MCPServer; its messages will fail", name, instance)
+			continue
+		}
+		q.AddMCPServer(name, mcpServer)
+	}
+}
+
 // AddMCPServer adds an MCP server for handling MCP messages.
 func (q *Query) AddMCPServer(name string, server types.MCPServer) {
 	q.mu.Lock()
@@ -665,8 +1368,38 @@ func (q *Query) AddMCPServer(name string, server types.MCPServer) {
 	q.mcpServers[name] = server
 }
 
+// normalizeToolName maps a tool name reported by the CLI to its canonical form.
+func (q *Query) normalizeToolName(name string) string {
+	canonical := types.NormalizeToolName(name, q.toolAliases)
+	if canonical != name {
+		q.logger.Debug("Normalized tool name %s -> %s", name, canonical)
+	}
+	return canonical
+}
+
+// expandMatcher extends a hook matcher pattern with every alias whose canonical
+// name it matches, so matchers written against canonical names also fire when
+// the CLI reports an alternate name.
+func (q *Query) expandMatcher(pattern string) string {
+	if pattern == "" || pattern == "*" {
+		return pattern
+	}
+
+	var extra []string
+	for alias, canonical := range types.MergeToolAliases(q.toolAliases) {
+		if matchesToolName(canonical, &pattern) && !matchesToolName(alias, &pattern) {
+			extra = append(extra, regexp.QuoteMeta(alias))
+		}
+	}
+	if len(extra) == 0 {
+		return pattern
+	}
+
+	sort.Strings(extra)
+	return pattern + "|" + strings.Join(extra, "|")
+}
+
 // matchesToolName checks if a tool name matches a matcher pattern.
-// nolint:unused
 func matchesToolName(toolName string, pattern *string) bool {
 	if pattern == nil || *pattern == "" {
 		return true // No pattern means match all
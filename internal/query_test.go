@@ -3,11 +3,17 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
 	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
@@ -71,6 +77,19 @@ func (m *mockTransport) IsReady() bool {
 	return m.ready
 }
 
+func (m *mockTransport) ReadinessReason() transport.ReadinessReason {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.closed:
+		return transport.ReadinessClosed
+	case m.ready:
+		return transport.ReadinessReady
+	default:
+		return transport.ReadinessNeverConnected
+	}
+}
+
 func (m *mockTransport) GetError() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -85,6 +104,27 @@ func (m *mockTransport) sendMessage(msg types.Message) {
 	}
 }
 
+// trySendMessage sends msg unless the transport is closed or its buffer is full.
+func (m *mockTransport) trySendMessage(msg types.Message) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return false
+	}
+	select {
+	case m.messagesChan <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *mockTransport) isClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
 func (m *mockTransport) getWrittenData() []string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -120,7 +160,11 @@ func TestNewQuery(t *testing.T) {
 // TestInitialize tests Query initialization with hooks.
 func TestInitialize(t *testing.T) {
 	ctx := context.Background()
-	transport := newMockTransport()
+	transport := claudetest.NewTransport()
+	claudetest.RespondToInitialize(transport, "hooks", "permissions")
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
 
 	// Create hook callback
 	hookCallback := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
@@ -151,45 +195,6 @@ func TestInitialize(t *testing.T) {
 		}
 	}()
 
-	// Start goroutine to respond to initialize request
-	go func() {
-		time.Sleep(50 * time.Millisecond)
-		written := transport.getWrittenData()
-
-		for _, data := range written {
-			var sentRequest map[string]interface{}
-			if err := json.Unmarshal([]byte(data), &sentRequest); err != nil {
-				continue
-			}
-
-			reqType, _ := sentRequest["type"].(string)
-			if reqType != "control_request" {
-				continue
-			}
-
-			requestID, _ := sentRequest["request_id"].(string)
-			request, _ := sentRequest["request"].(map[string]interface{})
-			subtype, _ := request["subtype"].(string)
-
-			if subtype == "initialize" {
-				// Send success response
-				controlResponse := &types.SystemMessage{
-					Type:    "control_response",
-					Subtype: "control_response",
-					Response: map[string]interface{}{
-						"subtype":    "success",
-						"request_id": requestID,
-						"response": map[string]interface{}{
-							"capabilities": []string{"hooks", "permissions"},
-						},
-					},
-				}
-				transport.sendMessage(controlResponse)
-				return
-			}
-		}
-	}()
-
 	// Initialize
 	result, err := query.Initialize(ctx)
 	if err != nil {
@@ -209,6 +214,22 @@ func TestInitialize(t *testing.T) {
 		t.Errorf("expected 1 hook callback, got %d", hookCount)
 	}
 
+	// Verify the matcher was widened to cover tool aliases
+	init := claudetest.CapturedInitialize(t, transport)
+	preToolUse := init.Hooks[types.HookEventPreToolUse]
+	if len(init.Hooks) != 1 || len(preToolUse) != 1 {
+		t.Fatalf("expected 1 PreToolUse hook config, got %v", init.Hooks)
+	}
+	if preToolUse[0].Matcher != "Bash|bash_tool" || len(preToolUse[0].CallbackIDs) != 1 {
+		t.Errorf("PreToolUse config = %+v, want matcher Bash|bash_tool and one callback", preToolUse[0])
+	}
+
+	// The registered callback answers the CLI's hook_callback requests
+	output, err := claudetest.InvokeHook(ctx, transport, preToolUse[0].CallbackIDs[0], map[string]interface{}{"tool_name": "Bash"})
+	if err != nil || output["continue"] != true {
+		t.Errorf("InvokeHook = %v, %v, want the callback's output", output, err)
+	}
+
 	// Test non-streaming mode
 	logger = log.NewLogger(false) // Non-verbose for tests
 	nonStreamingQuery := NewQuery(ctx, transport, opts, logger, false)
@@ -224,7 +245,11 @@ func TestInitialize(t *testing.T) {
 // TestErrorResponse tests error response handling.
 func TestErrorResponse(t *testing.T) {
 	ctx := context.Background()
-	transport := newMockTransport()
+	transport := claudetest.NewTransport()
+	claudetest.RespondWithError(transport, "set_permission_mode", "invalid permission mode")
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
 	opts := types.NewClaudeAgentOptions()
 
 	logger := log.NewLogger(false) // Non-verbose for tests
@@ -251,47 +276,72 @@ func TestErrorResponse(t *testing.T) {
 		responseChan <- err
 	}()
 
-	// Wait a bit for request to be sent
-	time.Sleep(50 * time.Millisecond)
-
-	// Get the written data to extract request ID
-	written := transport.getWrittenData()
-	if len(written) == 0 {
-		t.Fatal("no data written to transport")
-	}
-
-	var sentRequest map[string]interface{}
-	if err := json.Unmarshal([]byte(written[0]), &sentRequest); err != nil {
-		t.Fatalf("failed to unmarshal request: %v", err)
-	}
-
-	requestID, _ := sentRequest["request_id"].(string)
-
-	// Send an error response
-	controlResponse := &types.SystemMessage{
-		Type:    "control_response",
-		Subtype: "control_response",
-		Response: map[string]interface{}{
-			"subtype":    "error",
-			"request_id": requestID,
-			"error":      "invalid permission mode",
-		},
-	}
-
-	transport.sendMessage(controlResponse)
-
 	// Wait for error
 	select {
 	case err := <-responseChan:
 		if err == nil {
 			t.Fatal("expected error response")
 		}
-		if !types.IsControlProtocolError(err) {
-			t.Errorf("expected ControlProtocolError, got %T", err)
+		if !types.IsControlProtocolError(err) || !strings.Contains(err.Error(), "invalid permission mode") {
+			t.Errorf("expected ControlProtocolError with the CLI's message, got %T: %v", err, err)
 		}
 	case <-time.After(2 * time.Second):
 		t.Fatal("timeout waiting for error response")
 	}
+	if request := claudetest.CapturedControlRequest(t, transport, "set_permission_mode"); request.Request["mode"] != "invalid" {
+		t.Errorf("sent request = %v", request.Request)
+	}
+}
+
+// TestQueryCloseWithStalledConsumer closes the query while the transport floods
+// messages and nobody reads them. Close must not hang, race or panic, and the
+// consumer channel must be closed once teardown completes.
+func TestQueryCloseWithStalledConsumer(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		transport := newMockTransport()
+		query := NewQuery(context.Background(), transport, types.NewClaudeAgentOptions(), log.NewLogger(false), true)
+		if err := query.Start(context.Background()); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+
+		floodDone := make(chan struct{})
+		go func() {
+			defer close(floodDone)
+			msg := &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: "flood"}}}
+			for !transport.isClosed() {
+				if !transport.trySendMessage(msg) {
+					runtime.Gosched()
+				}
+			}
+		}()
+
+		// Wait until the message loop is blocked on the full consumer channel
+		deadline := time.Now().Add(2 * time.Second)
+		for len(query.messagesChan) < cap(query.messagesChan) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := query.Close(ctx); err != nil {
+			t.Fatalf("iteration %d: Close failed: %v", i, err)
+		}
+		cancel()
+
+		select {
+		case <-floodDone:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("iteration %d: transport was not closed", i)
+		}
+
+		timeout := time.After(2 * time.Second)
+		for open := true; open; {
+			select {
+			case _, open = <-query.messagesChan:
+			case <-timeout:
+				t.Fatalf("iteration %d: consumer channel was not closed", i)
+			}
+		}
+	}
 }
 
 // TestQueryStartStop tests lifecycle management.
@@ -725,6 +775,503 @@ func TestControlMessageFiltering(t *testing.T) {
 	}
 }
 
+// TestEchoedUserMessagePolicy tests that echoed user messages are filtered per policy.
+func TestEchoedUserMessagePolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       types.EchoedUserMessagePolicy
+		wantUser     []bool // HasToolResults of each delivered user message, in order
+		wantExcluded int64
+	}{
+		{"default includes all", "", []bool{false, true}, 0},
+		{"include", types.EchoedUserMessagesInclude, []bool{false, true}, 0},
+		{"tool results only", types.EchoedUserMessagesToolResultsOnly, []bool{true}, 1},
+		{"exclude", types.EchoedUserMessagesExclude, nil, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			transport := newMockTransport()
+			opts := types.NewClaudeAgentOptions().WithEchoedUserMessages(tt.policy)
+
+			query := NewQuery(ctx, transport, opts, log.NewLogger(false), true)
+			if err := query.Start(ctx); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			defer func() {
+				_ = query.Stop(ctx)
+			}()
+
+			transport.sendMessage(&types.UserMessage{Type: "user", Content: "echoed prompt"})
+			transport.sendMessage(&types.UserMessage{
+				Type: "user",
+				Content: []types.ContentBlock{
+					&types.ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_1", Content: "ok"},
+				},
+			})
+			transport.sendMessage(&types.AssistantMessage{Type: "assistant"})
+
+			var gotUser []bool
+			messages := query.GetMessages(ctx)
+			for done := false; !done; {
+				select {
+				case msg := <-messages:
+					switch m := msg.(type) {
+					case *types.UserMessage:
+						gotUser = append(gotUser, m.HasToolResults())
+					case *types.AssistantMessage:
+						done = true
+					}
+				case <-time.After(1 * time.Second):
+					t.Fatal("timeout waiting for messages")
+				}
+			}
+
+			if len(gotUser) != len(tt.wantUser) {
+				t.Fatalf("delivered user messages = %v, want %v", gotUser, tt.wantUser)
+			}
+			for i := range gotUser {
+				if gotUser[i] != tt.wantUser[i] {
+					t.Errorf("user message %d HasToolResults = %v, want %v", i, gotUser[i], tt.wantUser[i])
+				}
+			}
+			if got := query.ExcludedUserMessages(); got != tt.wantExcluded {
+				t.Errorf("ExcludedUserMessages() = %d, want %d", got, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+// TestBudgetEnforcement tests that exceeding MaxBudgetUSD interrupts and closes delivery.
+func TestBudgetEnforcement(t *testing.T) {
+	ctx := context.Background()
+	transport := newMockTransport()
+	opts := types.NewClaudeAgentOptions().WithMaxBudgetUSD(0.05)
+
+	query := NewQuery(ctx, transport, opts, log.NewLogger(false), true)
+	if err := query.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() {
+		_ = query.Stop(ctx)
+	}()
+
+	cost := func(usd float64) *types.ResultMessage {
+		return &types.ResultMessage{Type: "result", Subtype: "success", TotalCostUSD: &usd}
+	}
+	transport.sendMessage(cost(0.03))
+	transport.sendMessage(cost(0.03)) // pushes the total to 0.06
+	transport.sendMessage(&types.AssistantMessage{Type: "assistant"})
+	transport.sendMessage(cost(0.01))
+
+	var results []*types.ResultMessage
+	messages := query.GetMessages(ctx)
+	timeout := time.After(2 * time.Second)
+	for closed := false; !closed; {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				closed = true
+				break
+			}
+			result, isResult := msg.(*types.ResultMessage)
+			if !isResult {
+				t.Fatalf("unexpected message after budget exceeded: %T", msg)
+			}
+			results = append(results, result)
+		case <-timeout:
+			t.Fatal("timeout waiting for message channel to close")
+		}
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("delivered %d results, want 2 (including the one that exceeded the budget)", len(results))
+	}
+
+	err := query.Err()
+	if !types.IsBudgetExceededError(err) {
+		t.Fatalf("Err() = %v, want BudgetExceededError", err)
+	}
+	var budgetErr *types.BudgetExceededError
+	if errors.As(err, &budgetErr) {
+		if budgetErr.BudgetUSD != 0.05 {
+			t.Errorf("BudgetUSD = %v, want 0.05", budgetErr.BudgetUSD)
+		}
+		if budgetErr.SpentUSD < 0.059 || budgetErr.SpentUSD > 0.061 {
+			t.Errorf("SpentUSD = %v, want 0.06", budgetErr.SpentUSD)
+		}
+	}
+
+	// The interrupt is sent asynchronously
+	deadline := time.Now().Add(time.Second)
+	for {
+		interrupted := false
+		for _, data := range transport.getWrittenData() {
+			var req map[string]interface{}
+			if json.Unmarshal([]byte(data), &req) != nil || req["type"] != "control_request" {
+				continue
+			}
+			if inner, ok := req["request"].(map[string]interface{}); ok && inner["subtype"] == "interrupt" {
+				interrupted = true
+			}
+		}
+		if interrupted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("interrupt control request not written: %v", transport.getWrittenData())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestBudgetNotExceeded tests that delivery continues while under budget.
+func TestBudgetNotExceeded(t *testing.T) {
+	ctx := context.Background()
+	transport := newMockTransport()
+	opts := types.NewClaudeAgentOptions().WithMaxBudgetUSD(1.0)
+
+	query := NewQuery(ctx, transport, opts, log.NewLogger(false), true)
+	if err := query.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() {
+		_ = query.Stop(ctx)
+	}()
+
+	usd := 0.5
+	transport.sendMessage(&types.ResultMessage{Type: "result", TotalCostUSD: &usd})
+	transport.sendMessage(&types.AssistantMessage{Type: "assistant"})
+
+	messages := query.GetMessages(ctx)
+	for i := 0; i < 2; i++ {
+		select {
+		case _, ok := <-messages:
+			if !ok {
+				t.Fatal("message channel closed while under budget")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+	}
+
+	if err := query.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+	if len(transport.getWrittenData()) != 0 {
+		t.Errorf("unexpected writes while under budget: %v", transport.getWrittenData())
+	}
+}
+
+// TestQueryCacheEfficiency tests that cache and request counts accumulate over results.
+func TestQueryCacheEfficiency(t *testing.T) {
+	ctx := context.Background()
+	transport := newMockTransport()
+
+	query := NewQuery(ctx, transport, types.NewClaudeAgentOptions(), log.NewLogger(false), true)
+	if err := query.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() {
+		_ = query.Stop(ctx)
+	}()
+
+	transport.sendMessage(&types.ResultMessage{Type: "result", NumTurns: 2, Usage: map[string]interface{}{
+		"input_tokens": float64(100), "cache_creation_input_tokens": float64(900),
+	}})
+	transport.sendMessage(&types.ResultMessage{Type: "result", NumTurns: 1, Usage: map[string]interface{}{
+		"input_tokens": float64(100), "cache_read_input_tokens": float64(900),
+	}})
+
+	messages := query.GetMessages(ctx)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-messages:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for result")
+		}
+	}
+
+	want := types.CacheEfficiency{InputTokens: 200, CacheReadTokens: 900, CacheCreationTokens: 900, ModelRequests: 3}
+	if got := query.CacheEfficiency(); got != want {
+		t.Errorf("CacheEfficiency() = %+v, want %+v", got, want)
+	}
+}
+
+// TestQueryThinkingUsage tests that thinking tokens accumulate per result,
+// estimated from the turn's thinking blocks when the usage has no breakdown.
+func TestQueryThinkingUsage(t *testing.T) {
+	ctx := context.Background()
+	transport := newMockTransport()
+
+	query := NewQuery(ctx, transport, types.NewClaudeAgentOptions(), log.NewLogger(false), true)
+	if err := query.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() {
+		_ = query.Stop(ctx)
+	}()
+
+	thinking := &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+		&types.ThinkingBlock{Type: "thinking", Thinking: strings.Repeat("x", 1200)},
+	}}
+	transport.sendMessage(thinking)
+	transport.sendMessage(&types.ResultMessage{Type: "result", Usage: map[string]interface{}{
+		"output_tokens":         float64(800),
+		"output_tokens_details": map[string]interface{}{"thinking_tokens": float64(500)},
+	}})
+	transport.sendMessage(thinking)
+	transport.sendMessage(&types.ResultMessage{Type: "result", Usage: map[string]interface{}{"output_tokens": float64(700)}})
+
+	messages := query.GetMessages(ctx)
+	for i := 0; i < 4; i++ {
+		select {
+		case <-messages:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+
+	want := types.ThinkingUsage{OutputTokens: 1500, ThinkingTokens: 800, Estimated: true}
+	if got := query.Usage().Thinking; got != want {
+		t.Errorf("Usage().Thinking = %+v, want %+v", got, want)
+	}
+	if got := query.Usage().Thinking.VisibleTokens(); got != 700 {
+		t.Errorf("VisibleTokens() = %d, want 700", got)
+	}
+}
+
+// TestToolNameNormalization tests that callbacks see canonical names alongside raw ones.
+func TestPermissionContextSessionState(t *testing.T) {
+	var gotCtx types.ToolPermissionContext
+	opts := types.NewClaudeAgentOptions().
+		WithPermissionMode(types.PermissionModeAcceptEdits).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+			gotCtx = permCtx
+			return types.PermissionResultAllow{Behavior: "allow"}, nil
+		})
+	query := NewQuery(context.Background(), newMockTransport(), opts, log.NewLogger(false), true)
+
+	request := func(extra map[string]interface{}) types.ToolPermissionContext {
+		t.Helper()
+		requestData := map[string]interface{}{"tool_name": "Bash", "input": map[string]interface{}{}}
+		for k, v := range extra {
+			requestData[k] = v
+		}
+		if _, err := query.handlePermissionRequest(requestData); err != nil {
+			t.Fatalf("handlePermissionRequest failed: %v", err)
+		}
+		return gotCtx
+	}
+	route := func(msg types.Message) {
+		t.Helper()
+		if err := query.routeMessage(msg); err != nil {
+			t.Fatalf("routeMessage failed: %v", err)
+		}
+	}
+
+	if ctx := request(nil); ctx.PermissionMode != types.PermissionModeAcceptEdits || ctx.SessionID != "" {
+		t.Errorf("before init: got mode %q session %q, want configured mode and no session", ctx.PermissionMode, ctx.SessionID)
+	}
+
+	route(&types.SystemMessage{Type: "system", Subtype: types.SystemSubtypeInit, SessionID: "s-1", PermissionMode: types.PermissionModeDefault})
+	if ctx := request(nil); ctx.PermissionMode != types.PermissionModeDefault || ctx.SessionID != "s-1" {
+		t.Errorf("after init: got mode %q session %q, want default and s-1", ctx.PermissionMode, ctx.SessionID)
+	}
+
+	// The CLI switches modes mid-session
+	query.handleControlRequest(&types.SystemMessage{
+		Type:      "control_request",
+		RequestID: "req-mode",
+		Request:   map[string]interface{}{"subtype": "set_permission_mode", "mode": "plan"},
+	})
+	if ctx := request(nil); ctx.PermissionMode != types.PermissionModePlan {
+		t.Errorf("after set_permission_mode: mode = %q, want plan", ctx.PermissionMode)
+	}
+
+	// A callback switches the session's mode through a permission update
+	bypass := types.PermissionModeBypassPermissions
+	query.canUseTool = func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+		gotCtx = permCtx
+		return types.PermissionResultAllow{
+			Behavior:           "allow",
+			UpdatedPermissions: []types.PermissionUpdate{{Type: "setMode", Mode: &bypass}},
+		}, nil
+	}
+	request(nil)
+	if ctx := request(nil); ctx.PermissionMode != types.PermissionModeBypassPermissions {
+		t.Errorf("after setMode update: mode = %q, want bypassPermissions", ctx.PermissionMode)
+	}
+
+	// Requests from a subagent name the agent its Task call started
+	route(&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+		&types.ToolUseBlock{Type: "tool_use", ID: "task-1", Name: "Task", Input: map[string]interface{}{"subagent_type": "code-reviewer"}},
+	}})
+	if ctx := request(map[string]interface{}{"parent_tool_use_id": "task-1"}); ctx.AgentName != "code-reviewer" {
+		t.Errorf("subagent request: AgentName = %q, want code-reviewer", ctx.AgentName)
+	}
+	if ctx := request(nil); ctx.AgentName != "" {
+		t.Errorf("main agent request: AgentName = %q, want empty", ctx.AgentName)
+	}
+}
+
+func TestToolNameNormalization(t *testing.T) {
+	t.Run("permission callback", func(t *testing.T) {
+		var gotName string
+		var gotCtx types.ToolPermissionContext
+		opts := types.NewClaudeAgentOptions().
+			WithToolAliases(map[string]string{"shell": "Bash"}).
+			WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+				gotName, gotCtx = toolName, permCtx
+				return types.PermissionResultAllow{Behavior: "allow"}, nil
+			})
+		query := NewQuery(context.Background(), newMockTransport(), opts, log.NewLogger(false), true)
+
+		for raw, want := range map[string]string{
+			"str_replace_editor": "Edit",
+			"shell":              "Bash",
+			"UnknownTool":        "UnknownTool",
+		} {
+			_, err := query.handlePermissionRequest(map[string]interface{}{
+				"tool_name": raw,
+				"input":     map[string]interface{}{},
+			})
+			if err != nil {
+				t.Fatalf("handlePermissionRequest(%s) failed: %v", raw, err)
+			}
+			if gotName != want || gotCtx.RawToolName != raw {
+				t.Errorf("callback got (%q, raw %q), want (%q, raw %q)", gotName, gotCtx.RawToolName, want, raw)
+			}
+		}
+	})
+
+	t.Run("hook context", func(t *testing.T) {
+		var gotCtx types.HookContext
+		query := NewQuery(context.Background(), newMockTransport(), types.NewClaudeAgentOptions(), log.NewLogger(false), true)
+		callbackID := query.registerHookCallback(func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+			gotCtx = hookCtx
+			return map[string]interface{}{}, nil
+		})
+
+		_, err := query.handleHookCallback(map[string]interface{}{
+			"callback_id": callbackID,
+			"input":       map[string]interface{}{"tool_name": "str_replace_based_edit_tool"},
+		})
+		if err != nil {
+			t.Fatalf("handleHookCallback failed: %v", err)
+		}
+		if gotCtx.ToolName != "Edit" || gotCtx.RawToolName != "str_replace_based_edit_tool" {
+			t.Errorf("hook context = %+v, want canonical Edit with raw name", gotCtx)
+		}
+	})
+}
+
+// TestRawRequestPayload tests that callbacks can read fields of the CLI's
+// requests the SDK does not model, from copies of them.
+func TestRawRequestPayload(t *testing.T) {
+	t.Run("permission callback", func(t *testing.T) {
+		var gotCtx types.ToolPermissionContext
+		opts := types.NewClaudeAgentOptions().
+			WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+				gotCtx = permCtx
+				// Modifying the copy must not reach the request
+				permCtx.RawRequest["blocked_path"] = "changed"
+				permCtx.RawRequest["rule_ids"].([]interface{})[0] = "changed"
+				return types.PermissionResultAllow{Behavior: "allow"}, nil
+			})
+		query := NewQuery(context.Background(), newMockTransport(), opts, log.NewLogger(false), true)
+
+		requestData := map[string]interface{}{
+			"subtype":      "can_use_tool",
+			"tool_name":    "Bash",
+			"input":        map[string]interface{}{"command": "ls"},
+			"blocked_path": "/etc/passwd",
+			"rule_ids":     []interface{}{"r-1", "r-2"},
+		}
+		if _, err := query.handlePermissionRequest(requestData); err != nil {
+			t.Fatalf("handlePermissionRequest failed: %v", err)
+		}
+		if gotCtx.RawRequest["subtype"] != "can_use_tool" || gotCtx.RawRequest["tool_name"] != "Bash" {
+			t.Errorf("RawRequest = %v, want the whole request", gotCtx.RawRequest)
+		}
+		if input, _ := gotCtx.RawRequest["input"].(map[string]interface{}); input["command"] != "ls" {
+			t.Errorf("RawRequest input = %v, want the tool input", gotCtx.RawRequest["input"])
+		}
+		if requestData["blocked_path"] != "/etc/passwd" || requestData["rule_ids"].([]interface{})[0] != "r-1" {
+			t.Errorf("callback modified the request: %v", requestData)
+		}
+	})
+
+	t.Run("hook context", func(t *testing.T) {
+		var gotCtx types.HookContext
+		query := NewQuery(context.Background(), newMockTransport(), types.NewClaudeAgentOptions(), log.NewLogger(false), true)
+		callbackID := query.registerHookCallback(func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+			gotCtx = hookCtx
+			return map[string]interface{}{}, nil
+		})
+
+		for _, tt := range []struct {
+			name  string
+			input interface{}
+			want  map[string]interface{}
+		}{
+			{
+				name:  "object",
+				input: map[string]interface{}{"hook_event_name": "PreToolUse", "sandbox": map[string]interface{}{"enabled": true}},
+				want:  map[string]interface{}{"hook_event_name": "PreToolUse", "sandbox": map[string]interface{}{"enabled": true}},
+			},
+			{name: "missing", input: nil, want: map[string]interface{}{}},
+			{name: "not an object", input: "text", want: map[string]interface{}{}},
+		} {
+			requestData := map[string]interface{}{"callback_id": callbackID}
+			if tt.input != nil {
+				requestData["input"] = tt.input
+			}
+			if _, err := query.handleHookCallback(requestData); err != nil {
+				t.Fatalf("%s: handleHookCallback failed: %v", tt.name, err)
+			}
+			if gotCtx.RawInput == nil || !reflect.DeepEqual(gotCtx.RawInput, tt.want) {
+				t.Errorf("%s: RawInput = %#v, want %#v", tt.name, gotCtx.RawInput, tt.want)
+			}
+		}
+	})
+}
+
+// TestExpandMatcher tests that hook matchers are widened to cover aliases.
+func TestExpandMatcher(t *testing.T) {
+	query := NewQuery(context.Background(), newMockTransport(),
+		types.NewClaudeAgentOptions().WithToolAliases(map[string]string{"shell": "Bash"}),
+		log.NewLogger(false), true)
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"", ""},
+		{"*", "*"},
+		{"Grep", "Grep"},
+		{"^Bash$", "^Bash$|bash_tool|shell"},
+		{"Write|Edit", "Write|Edit|create_file|multi_edit|str_replace_based_edit_tool|str_replace_editor|write_file"},
+	}
+	for _, tt := range tests {
+		if got := query.expandMatcher(tt.pattern); got != tt.want {
+			t.Errorf("expandMatcher(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+
+	// An expanded matcher fires for an alias and still for the canonical name
+	expanded := query.expandMatcher("^Edit$")
+	for _, name := range []string{"Edit", "str_replace_editor"} {
+		if !matchesToolName(name, &expanded) {
+			t.Errorf("expanded matcher %q should match %q", expanded, name)
+		}
+	}
+	if matchesToolName("Write", &expanded) {
+		t.Errorf("expanded matcher %q should not match Write", expanded)
+	}
+}
+
 // TestConcurrentRequests tests multiple simultaneous requests.
 func TestConcurrentRequests(t *testing.T) {
 	ctx := context.Background()
@@ -900,6 +1447,34 @@ func TestCallbackTimeouts(t *testing.T) {
 	}
 }
 
+// TestRegisterSDKMCPServers tests that SDK servers from McpServers are routable.
+func TestRegisterSDKMCPServers(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().WithMcpServers(map[string]interface{}{
+		"calc":     types.McpSdkServerConfig{Type: "sdk", Name: "calc", Instance: &mockMCPServer{name: "calc", version: "1.0.0"}},
+		"ptr":      &types.McpSdkServerConfig{Type: "sdk", Name: "ptr", Instance: &mockMCPServer{name: "ptr", version: "1.0.0"}},
+		"external": types.McpStdioServerConfig{Command: "mcp-files"},
+		"opaque":   types.McpSdkServerConfig{Type: "sdk", Name: "opaque", Instance: "not a server"},
+	})
+	query := NewQuery(context.Background(), newMockTransport(), opts, log.NewLogger(false), true)
+
+	for name, want := range map[string]bool{"calc": true, "ptr": true, "external": false, "opaque": false} {
+		if _, ok := query.mcpServers[name]; ok != want {
+			t.Errorf("server %s registered = %v, want %v", name, ok, want)
+		}
+	}
+
+	result, err := query.handleMCPMessage(map[string]interface{}{
+		"server_name": "calc",
+		"message":     map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "tools/list"},
+	})
+	if err != nil {
+		t.Fatalf("handleMCPMessage failed: %v", err)
+	}
+	if response, _ := result["mcp_response"].(map[string]interface{}); response["error"] != nil {
+		t.Errorf("expected a routed response, got error: %v", response)
+	}
+}
+
 // mockMCPServer implements a mock MCP server for testing.
 type mockMCPServer struct {
 	name    string
@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// sessionState tracks what permission callbacks need to know about the
+// session: the active permission mode, the session ID, and which subagent each
+// Task tool call started. It also records the model and thinking budget last
+// set, so they can be restored after a query that overrides them. It is
+// updated by the message loop and by control request handlers, which run
+// concurrently, so every access takes mu.
+type sessionState struct {
+	mu                sync.Mutex
+	permissionMode    types.PermissionMode
+	sessionID         string
+	subagents         map[string]string // Task tool use ID -> subagent type
+	model             string            // "" for the CLI's default
+	maxThinkingTokens *int              // nil for the CLI's default
+}
+
+func newSessionState(mode types.PermissionMode) *sessionState {
+	return &sessionState{
+		permissionMode: mode,
+		subagents:      make(map[string]string),
+	}
+}
+
+// observe records session details carried by a routed message.
+func (s *sessionState) observe(msg types.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch m := msg.(type) {
+	case *types.SystemMessage:
+		if !m.IsInit() {
+			return
+		}
+		if m.SessionID != "" {
+			s.sessionID = m.SessionID
+		}
+		if m.PermissionMode != "" {
+			s.permissionMode = m.PermissionMode
+		}
+	case *types.ResultMessage:
+		if m.SessionID != "" {
+			s.sessionID = m.SessionID
+		}
+	case *types.AssistantMessage:
+		for _, block := range m.Content {
+			if toolUse, ok := block.(*types.ToolUseBlock); ok && toolUse.Name == "Task" {
+				if agent, ok := toolUse.Input["subagent_type"].(string); ok {
+					s.subagents[toolUse.ID] = agent
+				}
+			}
+		}
+	}
+}
+
+// setPermissionMode records a permission mode change.
+func (s *sessionState) setPermissionMode(mode types.PermissionMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissionMode = mode
+}
+
+// currentPermissionMode returns the active permission mode.
+func (s *sessionState) currentPermissionMode() types.PermissionMode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.permissionMode
+}
+
+// setModel records a model change.
+func (s *sessionState) setModel(model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.model = model
+}
+
+// currentModel returns the model last set, or "" for the CLI's default.
+func (s *sessionState) currentModel() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.model
+}
+
+// setMaxThinkingTokens records a thinking budget change.
+func (s *sessionState) setMaxThinkingTokens(tokens *int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxThinkingTokens = tokens
+}
+
+// currentMaxThinkingTokens returns the thinking budget last set, or nil for
+// the CLI's default.
+func (s *sessionState) currentMaxThinkingTokens() *int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxThinkingTokens
+}
+
+// currentSessionID returns the session ID, or "" before the CLI announced it.
+func (s *sessionState) currentSessionID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessionID
+}
+
+// applyPermissionUpdates records mode changes among updates a permission
+// callback asked the CLI to apply for the session.
+func (s *sessionState) applyPermissionUpdates(updates []types.PermissionUpdate) {
+	for _, update := range updates {
+		if update.Type != "setMode" || update.Mode == nil {
+			continue
+		}
+		if update.Destination == nil || *update.Destination == types.DestinationSession {
+			s.setPermissionMode(*update.Mode)
+		}
+	}
+}
+
+// fillPermissionContext sets the mode, session and agent fields of permCtx.
+// parentToolUseID identifies the Task call of the requesting subagent, if any.
+func (s *sessionState) fillPermissionContext(permCtx *types.ToolPermissionContext, parentToolUseID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	permCtx.PermissionMode = s.permissionMode
+	permCtx.SessionID = s.sessionID
+	if parentToolUseID != "" {
+		permCtx.AgentName = s.subagents[parentToolUseID]
+	}
+}
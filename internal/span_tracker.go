@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// spanTracker reports a connection's lifecycles to a types.SpanSink: turns and
+// tool uses from the message stream, and permission requests, hook callbacks
+// and control requests from their handlers. The message loop and the handlers
+// run concurrently, so every access takes mu.
+type spanTracker struct {
+	sink      types.SpanSink
+	session   *sessionState
+	normalize func(string) string
+	logger    *log.Logger
+
+	mu     sync.Mutex
+	turnID int
+	turn   types.SpanHandle     // Open turn span; nil between turns
+	tools  map[string]*toolSpan // Tool use ID -> open tool use span
+	order  []string             // Open tool use IDs in start order
+}
+
+// toolSpan is an open tool use span.
+type toolSpan struct {
+	handle types.SpanHandle
+	name   string
+}
+
+// traceSpan is a span started for a callback or control request. A nil
+// traceSpan ignores end, so handlers need no checks when tracing is off.
+type traceSpan struct {
+	tracker *spanTracker
+	handle  types.SpanHandle
+}
+
+// newSpanTracker returns nil when no sink is configured; a nil tracker ignores
+// every call.
+func newSpanTracker(sink types.SpanSink, session *sessionState, normalize func(string) string, logger *log.Logger) *spanTracker {
+	if sink == nil {
+		return nil
+	}
+	return &spanTracker{
+		sink:      sink,
+		session:   session,
+		normalize: normalize,
+		logger:    logger,
+		tools:     make(map[string]*toolSpan),
+	}
+}
+
+// beginTurn starts a turn span unless one is open.
+func (s *spanTracker) beginTurn() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beginTurnLocked()
+}
+
+func (s *spanTracker) beginTurnLocked() {
+	if s.turn == nil {
+		s.turnID++
+		s.turn = s.startLocked(s.sink, types.SpanTurn, nil)
+	}
+}
+
+// observe starts and ends tool use spans from a routed message. Messages of a
+// turn arriving before beginTurn start the turn span themselves.
+func (s *spanTracker) observe(msg types.Message) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch m := msg.(type) {
+	case *types.AssistantMessage:
+		s.beginTurnLocked()
+		var parent interface{} = s.turn
+		if m.ParentToolUseID != nil {
+			// Tool uses of a subagent nest in its Task tool use
+			if task, ok := s.tools[*m.ParentToolUseID]; ok {
+				parent = task.handle
+			}
+		}
+		for _, block := range m.Content {
+			toolUse, ok := block.(*types.ToolUseBlock)
+			if !ok || s.tools[toolUse.ID] != nil {
+				continue
+			}
+			name := s.normalize(toolUse.Name)
+			s.tools[toolUse.ID] = &toolSpan{
+				handle: s.startLocked(parent, types.SpanToolUse, map[string]interface{}{
+					types.SpanAttrToolName:  name,
+					types.SpanAttrToolUseID: toolUse.ID,
+				}),
+				name: name,
+			}
+			s.order = append(s.order, toolUse.ID)
+		}
+	case *types.UserMessage:
+		blocks, _ := m.Content.([]types.ContentBlock)
+		for _, block := range blocks {
+			result, ok := block.(*types.ToolResultBlock)
+			if !ok {
+				continue
+			}
+			tool := s.tools[result.ToolUseID]
+			if tool == nil {
+				continue
+			}
+			if result.IsError != nil && *result.IsError {
+				s.endToolLocked(result.ToolUseID, types.SpanOutcomeError, fmt.Errorf("tool %s returned an error", tool.name))
+			} else {
+				s.endToolLocked(result.ToolUseID, types.SpanOutcomeSuccess, nil)
+			}
+		}
+	}
+}
+
+// endTurn ends the turn span with the outcome of its result. Tool uses still
+// open will not return.
+func (s *spanTracker) endTurn(result *types.ResultMessage) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.beginTurnLocked()
+	for len(s.order) > 0 {
+		s.endToolLocked(s.order[0], types.SpanOutcomeNoResult, nil)
+	}
+	var err error
+	if result.IsError {
+		err = fmt.Errorf("turn ended with %s", result.Subtype)
+	}
+	s.endTurnLocked(result.Subtype, err)
+}
+
+// finish ends the open spans when the connection closes.
+func (s *spanTracker) finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.order) > 0 {
+		s.endToolLocked(s.order[0], types.SpanOutcomeClosed, nil)
+	}
+	if s.turn != nil {
+		s.endTurnLocked(types.SpanOutcomeClosed, nil)
+	}
+}
+
+// child starts a span for a callback or control request, nested in the open
+// tool use with toolUseID if there is one, else in the open turn.
+func (s *spanTracker) child(name, toolUseID string, attrs map[string]interface{}) *traceSpan {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var parent interface{} = s.sink
+	if tool, ok := s.tools[toolUseID]; ok {
+		parent = tool.handle
+	} else if s.turn != nil {
+		parent = s.turn
+	}
+	return &traceSpan{tracker: s, handle: s.startLocked(parent, name, attrs)}
+}
+
+// end records the outcome and ends the span.
+func (t *traceSpan) end(outcome string, err error) {
+	if t == nil {
+		return
+	}
+	t.tracker.endSpan(t.handle, outcome, err)
+}
+
+func (s *spanTracker) endToolLocked(toolUseID, outcome string, err error) {
+	tool := s.tools[toolUseID]
+	delete(s.tools, toolUseID)
+	for i, id := range s.order {
+		if id == toolUseID {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	s.endSpan(tool.handle, outcome, err)
+}
+
+func (s *spanTracker) endTurnLocked(outcome string, err error) {
+	// The session ID may have been announced after the turn started
+	s.guard(func() { s.turn.SetAttribute(types.SpanAttrSessionID, s.session.currentSessionID()) })
+	s.endSpan(s.turn, outcome, err)
+	s.turn = nil
+}
+
+// startLocked starts a span through parent when it is a SpanSink, else through
+// the sink, adding the session and turn attributes.
+func (s *spanTracker) startLocked(parent interface{}, name string, attrs map[string]interface{}) types.SpanHandle {
+	span := map[string]interface{}{
+		types.SpanAttrSessionID: s.session.currentSessionID(),
+		types.SpanAttrTurnID:    0,
+	}
+	if s.turn != nil || name == types.SpanTurn {
+		span[types.SpanAttrTurnID] = s.turnID
+	}
+	for k, v := range attrs {
+		span[k] = v
+	}
+
+	starter, ok := parent.(types.SpanSink)
+	if !ok {
+		starter = s.sink
+	}
+	var handle types.SpanHandle
+	s.guard(func() { handle = starter.StartSpan(name, span) })
+	if handle == nil {
+		return types.NoopSpanSink{}.StartSpan(name, span)
+	}
+	return handle
+}
+
+func (s *spanTracker) endSpan(handle types.SpanHandle, outcome string, err error) {
+	s.guard(func() {
+		handle.SetAttribute(types.SpanAttrOutcome, outcome)
+		handle.End(err)
+	})
+}
+
+// guard runs a sink call, isolating the SDK from panics in it.
+func (s *spanTracker) guard(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Warning("Span sink panicked: %v", r)
+		}
+	}()
+	fn()
+}
+
+// spanOutcome returns the outcome of an operation that failed with err, or succeeded.
+func spanOutcome(err error) string {
+	if err != nil {
+		return types.SpanOutcomeError
+	}
+	return types.SpanOutcomeSuccess
+}
+
+// permissionOutcome returns the outcome of a permission request from the
+// response sent to the CLI.
+func permissionOutcome(response map[string]interface{}, err error) string {
+	if err != nil {
+		return types.SpanOutcomeError
+	}
+	if response["behavior"] == "deny" {
+		return types.SpanOutcomeDeny
+	}
+	return types.SpanOutcomeAllow
+}
+
+// hookToolUseID returns the tool use a hook callback request is about, or "".
+func hookToolUseID(requestData map[string]interface{}) string {
+	if id, ok := requestData["tool_use_id"].(string); ok {
+		return id
+	}
+	input, _ := requestData["input"].(map[string]interface{})
+	id, _ := input["tool_use_id"].(string)
+	return id
+}
+
+// hookSpanAttributes returns the attributes of a hook callback span.
+func hookSpanAttributes(requestData map[string]interface{}, normalize func(string) string) map[string]interface{} {
+	input, _ := requestData["input"].(map[string]interface{})
+	event, _ := input["hook_event_name"].(string)
+	attrs := map[string]interface{}{types.SpanAttrHookEvent: event}
+	if toolName, ok := input["tool_name"].(string); ok && toolName != "" {
+		attrs[types.SpanAttrToolName] = normalize(toolName)
+	}
+	if id := hookToolUseID(requestData); id != "" {
+		attrs[types.SpanAttrToolUseID] = id
+	}
+	return attrs
+}
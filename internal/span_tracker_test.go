@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// awaitWrites waits until at least n messages were written to transport and
+// returns them.
+func awaitWrites(t *testing.T, transport *mockTransport, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		written := transport.getWrittenData()
+		if len(written) >= n {
+			return written
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d writes, want %d: %v", len(written), n, written)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// spanTree renders the spans below parent as "name outcome [attr=value...]"
+// lines, indented by depth.
+func spanTree(sink *types.MemorySpanSink, parent int, depth int, attrs ...string) []string {
+	var lines []string
+	for _, span := range sink.Children(parent) {
+		line := fmt.Sprintf("%s%s %v", strings.Repeat("  ", depth), span.Name, span.Attributes[types.SpanAttrOutcome])
+		for _, key := range attrs {
+			if value, ok := span.Attributes[key]; ok {
+				line += fmt.Sprintf(" %s=%v", key, value)
+			}
+		}
+		if !span.Ended {
+			line += " (open)"
+		}
+		lines = append(lines, line)
+		lines = append(lines, spanTree(sink, span.ID, depth+1, attrs...)...)
+	}
+	return lines
+}
+
+// TestQuerySpans tests the span tree of a scripted conversation: a turn with
+// a permission request and a hook nested in the tool use they are about, a
+// tool use cut short by the turn's end, and control requests.
+func TestQuerySpans(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	transport := newMockTransport()
+	sink := types.NewMemorySpanSink()
+
+	opts := types.NewClaudeAgentOptions().
+		WithSpanSink(sink).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+			if toolName == "Write" {
+				return types.PermissionResultDeny{Behavior: "deny", Message: "read only"}, nil
+			}
+			return types.PermissionResultAllow{Behavior: "allow"}, nil
+		})
+	query := NewQuery(ctx, transport, opts, log.NewLogger(false), true)
+	hookID := query.registerHookCallback(func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		return map[string]interface{}{}, nil
+	})
+	if err := query.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	messages := query.GetMessages(ctx)
+
+	// Control requests from the CLI are answered before the script moves on
+	writes := 0
+	request := func(id string, request map[string]interface{}) {
+		t.Helper()
+		transport.sendMessage(&types.SystemMessage{Type: "control_request", RequestID: id, Request: request})
+		writes++
+		awaitWrites(t, transport, writes)
+	}
+	toolUse := func(id, name string) *types.AssistantMessage {
+		return &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.ToolUseBlock{Type: "tool_use", ID: id, Name: name, Input: map[string]interface{}{}},
+		}}
+	}
+
+	transport.sendMessage(&types.SystemMessage{Type: "system", Subtype: types.SystemSubtypeInit, SessionID: "s-1"})
+	<-messages
+	query.BeginTurn("default")
+	transport.sendMessage(toolUse("t1", "Bash"))
+	request("p1", map[string]interface{}{"subtype": "can_use_tool", "tool_name": "Bash", "tool_use_id": "t1", "input": map[string]interface{}{"command": "ls"}})
+	request("h1", map[string]interface{}{"subtype": "hook_callback", "callback_id": hookID, "tool_use_id": "t1", "input": map[string]interface{}{"hook_event_name": "PostToolUse", "tool_name": "Bash"}})
+	isError := false
+	transport.sendMessage(&types.UserMessage{Type: "user", Content: []types.ContentBlock{&types.ToolResultBlock{Type: "tool_result", ToolUseID: "t1", IsError: &isError}}})
+	transport.sendMessage(toolUse("t2", "Write"))
+	request("p2", map[string]interface{}{"subtype": "can_use_tool", "tool_name": "Write", "tool_use_id": "t2", "input": map[string]interface{}{}})
+	transport.sendMessage(&types.ResultMessage{Type: "result", Subtype: "success", SessionID: "s-1"})
+	for msg := range messages {
+		if msg.GetMessageType() == "result" {
+			break
+		}
+	}
+
+	// A control request outside a turn is a root span
+	go func() {
+		written := awaitWrites(t, transport, writes+1)
+		var sent map[string]interface{}
+		_ = json.Unmarshal([]byte(written[writes]), &sent)
+		transport.sendMessage(&types.SystemMessage{Type: "control_response", Response: map[string]interface{}{
+			"subtype": "success", "request_id": sent["request_id"], "response": map[string]interface{}{},
+		}})
+	}()
+	if err := query.SetModel(ctx, "claude-opus-4"); err != nil {
+		t.Fatalf("SetModel failed: %v", err)
+	}
+
+	// The next turn is still open when the connection closes
+	query.BeginTurn("default")
+	if err := query.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	got := spanTree(sink, 0, 0, types.SpanAttrToolName, types.SpanAttrHookEvent, types.SpanAttrSubtype, types.SpanAttrTurnID)
+	want := []string{
+		"claude.turn success turn_id=1",
+		"  claude.tool_use success tool_name=Bash turn_id=1",
+		"    claude.permission allow tool_name=Bash turn_id=1",
+		"    claude.hook success tool_name=Bash hook_event=PostToolUse turn_id=1",
+		"  claude.tool_use no_result tool_name=Write turn_id=1",
+		"    claude.permission deny tool_name=Write turn_id=1",
+		"claude.control_request success subtype=set_model turn_id=0",
+		"claude.turn closed turn_id=2",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("span tree:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	for _, span := range sink.Spans() {
+		if span.Attributes[types.SpanAttrSessionID] != "s-1" {
+			t.Errorf("%s span %d: session_id = %v, want s-1", span.Name, span.ID, span.Attributes[types.SpanAttrSessionID])
+		}
+		if span.End.Before(span.Start) {
+			t.Errorf("%s span %d ends before it starts", span.Name, span.ID)
+		}
+	}
+}
+
+// TestSpanTrackerSinkPanics tests that a panicking sink does not break routing.
+func TestSpanTrackerSinkPanics(t *testing.T) {
+	tracker := newSpanTracker(panickingSink{}, newSessionState(types.PermissionModeDefault), func(name string) string { return name }, log.NewLogger(false))
+
+	tracker.beginTurn()
+	tracker.observe(&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Bash"}}})
+	tracker.child(types.SpanPermission, "t1", nil).end(types.SpanOutcomeAllow, nil)
+	tracker.endTurn(&types.ResultMessage{Type: "result", Subtype: "success"})
+	tracker.finish()
+}
+
+type panickingSink struct{}
+
+func (panickingSink) StartSpan(string, map[string]interface{}) types.SpanHandle {
+	panic("sink failed")
+}
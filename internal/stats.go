@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// StatsRecorder accumulates the SessionStats of a client's results. It is
+// shared by the queries of the client, so the totals outlive reconnects, and
+// is safe for concurrent use. A nil recorder records nothing.
+type StatsRecorder struct {
+	mu    sync.Mutex
+	stats types.SessionStats
+}
+
+// NewStatsRecorder creates an empty recorder.
+func NewStatsRecorder() *StatsRecorder {
+	return &StatsRecorder{}
+}
+
+// record adds a result produced by model. ended is set for the result that
+// ends a query, as opposed to one withheld to continue a truncated answer or
+// dropped after the SDK's turn limit.
+func (r *StatsRecorder) record(result *types.ResultMessage, model string, ended bool) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &r.stats
+	if ended {
+		s.Queries++
+	}
+	// The CLI's own result of a query over the SDK's turn limit reports the turns
+	if result.Meta == nil || !result.Meta.TurnLimitedBySDK {
+		s.Turns += result.NumTurns
+	}
+	if result.TotalCostUSD != nil {
+		s.CostUSD += *result.TotalCostUSD
+	} else {
+		s.UnpricedResults++
+	}
+	s.Duration += time.Duration(result.DurationMs) * time.Millisecond
+	s.APIDuration += time.Duration(result.DurationAPIMs) * time.Millisecond
+	if s.Models == nil {
+		s.Models = make(map[string]types.ModelUsage)
+	}
+	s.Models[model] = s.Models[model].Add(types.ModelUsageFromResult(result))
+}
+
+// Stats returns a copy of the totals.
+func (r *StatsRecorder) Stats() types.SessionStats {
+	if r == nil {
+		return types.SessionStats{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	stats.Models = maps.Clone(r.stats.Models)
+	return stats
+}
+
+// Reset clears the totals and returns those accumulated until then.
+func (r *StatsRecorder) Reset() types.SessionStats {
+	if r == nil {
+		return types.SessionStats{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	r.stats = types.SessionStats{}
+	return stats
+}
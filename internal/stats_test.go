@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestStatsRecorder tests which results count as queries and turns.
+func TestStatsRecorder(t *testing.T) {
+	cost := 0.01
+	r := NewStatsRecorder()
+
+	// A truncated answer continued by the SDK, then its final result
+	r.record(&types.ResultMessage{NumTurns: 1, TotalCostUSD: &cost}, "sonnet", false)
+	r.record(&types.ResultMessage{NumTurns: 1, TotalCostUSD: &cost}, "sonnet", true)
+
+	// A query over the SDK's turn limit: the synthesized result is delivered,
+	// the CLI's own result is dropped but reports the turns
+	r.record(&types.ResultMessage{NumTurns: 2, Meta: &types.ResultMeta{TurnLimitedBySDK: true}}, "sonnet", true)
+	r.record(&types.ResultMessage{NumTurns: 3, TotalCostUSD: &cost}, "sonnet", false)
+
+	stats := r.Stats()
+	if stats.Queries != 2 || stats.Turns != 5 || stats.UnpricedResults != 1 {
+		t.Errorf("Queries, Turns, UnpricedResults = %d, %d, %d, want 2, 5, 1", stats.Queries, stats.Turns, stats.UnpricedResults)
+	}
+	if usage := stats.Models["sonnet"]; usage.Results != 4 {
+		t.Errorf("sonnet results = %d, want 4", usage.Results)
+	}
+
+	var disabled *StatsRecorder
+	disabled.record(&types.ResultMessage{NumTurns: 1}, "", true)
+	if stats := disabled.Stats(); stats.Queries != 0 {
+		t.Errorf("nil recorder recorded %+v", stats)
+	}
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// subagentToolName is the tool the CLI uses to start subagents.
+const subagentToolName = "Task"
+
+// subagentTracker follows Task-tool subagents through the message stream and
+// reports their lifecycle to a user callback. It is only used by the message
+// loop and is not safe for concurrent use.
+type subagentTracker struct {
+	fn      types.SubagentObserverFunc
+	logger  *log.Logger
+	now     func() time.Time
+	running map[string]*types.SubagentEvent // Task tool use ID -> started subagent
+	order   []string                        // Running tool use IDs in start order
+}
+
+// newSubagentTracker returns nil when no callback is configured; a nil tracker
+// ignores messages.
+func newSubagentTracker(fn types.SubagentObserverFunc, logger *log.Logger) *subagentTracker {
+	if fn == nil {
+		return nil
+	}
+	return &subagentTracker{
+		fn:      fn,
+		logger:  logger,
+		now:     time.Now,
+		running: make(map[string]*types.SubagentEvent),
+	}
+}
+
+// observe updates the running subagents from a routed message, reporting
+// those that start or finish.
+func (s *subagentTracker) observe(msg types.Message) {
+	if s == nil {
+		return
+	}
+
+	switch m := msg.(type) {
+	case *types.AssistantMessage:
+		if m.ParentToolUseID != nil {
+			if sub, ok := s.running[*m.ParentToolUseID]; ok {
+				sub.Messages++
+				usage := m.Usage()
+				sub.InputTokens += usageCount(usage, "input_tokens")
+				sub.OutputTokens += usageCount(usage, "output_tokens")
+			}
+		}
+		for _, block := range m.Content {
+			if toolUse, ok := block.(*types.ToolUseBlock); ok && toolUse.Name == subagentToolName {
+				s.start(toolUse)
+			}
+		}
+	case *types.UserMessage:
+		blocks, _ := m.Content.([]types.ContentBlock)
+		for _, block := range blocks {
+			if result, ok := block.(*types.ToolResultBlock); ok {
+				s.finish(result.ToolUseID, result)
+			}
+		}
+	case *types.ResultMessage:
+		// The turn is over, so subagents still running will not return
+		for len(s.order) > 0 {
+			s.finish(s.order[0], nil)
+		}
+	}
+}
+
+// start records a subagent started by a Task tool use and reports it.
+func (s *subagentTracker) start(toolUse *types.ToolUseBlock) {
+	if _, ok := s.running[toolUse.ID]; ok {
+		return
+	}
+	input := func(key string) string {
+		value, _ := toolUse.Input[key].(string)
+		return value
+	}
+	sub := &types.SubagentEvent{
+		Kind:        types.SubagentStarted,
+		ToolUseID:   toolUse.ID,
+		AgentType:   input("subagent_type"),
+		Description: input("description"),
+		Prompt:      input("prompt"),
+		StartedAt:   s.now(),
+	}
+	s.running[toolUse.ID] = sub
+	s.order = append(s.order, toolUse.ID)
+	s.emit(*sub)
+}
+
+// finish reports the end of a running subagent. A nil result means the turn
+// ended without one. Tool results of other tools are ignored.
+func (s *subagentTracker) finish(toolUseID string, result *types.ToolResultBlock) {
+	sub, ok := s.running[toolUseID]
+	if !ok {
+		return
+	}
+	delete(s.running, toolUseID)
+	for i, id := range s.order {
+		if id == toolUseID {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+
+	event := *sub
+	event.Kind = types.SubagentFinished
+	event.Duration = s.now().Sub(sub.StartedAt)
+	event.Result = result
+	event.IsError = result == nil || (result.IsError != nil && *result.IsError)
+	s.emit(event)
+}
+
+// emit invokes the callback, isolating routing from panics.
+func (s *subagentTracker) emit(event types.SubagentEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Warning("Subagent observer panicked: %v", r)
+		}
+	}()
+	s.fn(event)
+}
+
+// usageCount reads a numeric usage field, returning 0 when it is absent or not a number.
+func usageCount(usage map[string]interface{}, key string) int {
+	if v, ok := usage[key].(float64); ok {
+		return int(v)
+	}
+	return 0
+}
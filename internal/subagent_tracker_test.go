@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// loadConversation parses a recorded conversation from testdata, one message per line.
+func loadConversation(t *testing.T, name string) []types.Message {
+	t.Helper()
+
+	file, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var messages []types.Message
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		msg, err := types.UnmarshalMessage(scanner.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+// TestSubagentTracker tests subagent events derived from a recorded
+// conversation with two parallel Task calls and one cut short by the turn's end.
+func TestSubagentTracker(t *testing.T) {
+	var events []types.SubagentEvent
+	tracker := newSubagentTracker(func(event types.SubagentEvent) {
+		events = append(events, event)
+	}, log.NewLogger(false))
+	clock := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	for _, msg := range loadConversation(t, "task_conversation.jsonl") {
+		tracker.observe(msg)
+	}
+
+	type summary struct {
+		kind      types.SubagentEventKind
+		toolUseID string
+		agentType string
+		isError   bool
+		messages  int
+		input     int
+		output    int
+		duration  time.Duration
+	}
+	var got []summary
+	for _, e := range events {
+		got = append(got, summary{e.Kind, e.ToolUseID, e.AgentType, e.IsError, e.Messages, e.InputTokens, e.OutputTokens, e.Duration})
+	}
+	want := []summary{
+		{types.SubagentStarted, "toolu_task_a", "code-reviewer", false, 0, 0, 0, 0},
+		{types.SubagentStarted, "toolu_task_b", "test-runner", false, 0, 0, 0, 0},
+		{types.SubagentFinished, "toolu_task_b", "test-runner", true, 1, 700, 25, time.Second},
+		{types.SubagentFinished, "toolu_task_a", "code-reviewer", false, 2, 2400, 100, 3 * time.Second},
+		{types.SubagentStarted, "toolu_task_c", "docs-writer", false, 0, 0, 0, 0},
+		{types.SubagentFinished, "toolu_task_c", "docs-writer", true, 0, 0, 0, time.Second},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	started := events[0]
+	if started.Description != "Review types" || started.Prompt != "Review the types package for API issues." {
+		t.Errorf("Task input not carried: %+v", started)
+	}
+	if events[3].Result == nil || events[3].Result.ToolUseID != "toolu_task_a" {
+		t.Errorf("finished event should carry the Task result, got %+v", events[3].Result)
+	}
+	if events[5].Result != nil {
+		t.Errorf("a subagent cut short by the turn's end has no result, got %+v", events[5].Result)
+	}
+}
+
+// TestQuerySubagentObserver tests that the routing layer reports subagents
+// from the message stream, even when echoed user messages are excluded.
+func TestQuerySubagentObserver(t *testing.T) {
+	ctx := context.Background()
+	transport := newMockTransport()
+
+	events := make(chan types.SubagentEvent, 10)
+	opts := types.NewClaudeAgentOptions().
+		WithEchoedUserMessages(types.EchoedUserMessagesExclude).
+		WithSubagentObserver(func(event types.SubagentEvent) {
+			events <- event
+		})
+	query := NewQuery(ctx, transport, opts, log.NewLogger(false), true)
+	if err := query.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() {
+		_ = query.Stop(ctx)
+	}()
+
+	for _, msg := range loadConversation(t, "task_conversation.jsonl") {
+		transport.sendMessage(msg)
+	}
+
+	// Events are emitted before the message is delivered, so all are in by the result
+	messages := query.GetMessages(ctx)
+	for {
+		select {
+		case msg := <-messages:
+			if _, ok := msg.(*types.ResultMessage); !ok {
+				continue
+			}
+			var got []string
+			for len(events) > 0 {
+				event := <-events
+				got = append(got, string(event.Kind)+" "+event.ToolUseID)
+			}
+			want := []string{
+				"started toolu_task_a", "started toolu_task_b", "finished toolu_task_b",
+				"finished toolu_task_a", "started toolu_task_c", "finished toolu_task_c",
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("events = %v, want %v", got, want)
+			}
+			return
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+}
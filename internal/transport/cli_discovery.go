@@ -7,9 +7,29 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
+// DiscoveryOptions configures CLI discovery and version checking.
+type DiscoveryOptions struct {
+	SkipVersionCheck bool        // Skip the minimum version check
+	MinimumVersion   string      // Required CLI version; empty means MinimumCLIVersion
+	Logger           *log.Logger // Receives warnings; nil discards them
+}
+
+// NewDiscoveryOptions builds DiscoveryOptions from the SDK options.
+func NewDiscoveryOptions(options *types.ClaudeAgentOptions, logger *log.Logger) DiscoveryOptions {
+	opts := DiscoveryOptions{Logger: logger}
+	if options != nil {
+		opts.SkipVersionCheck = options.SkipVersionCheck
+		if options.MinimumCLIVersion != nil {
+			opts.MinimumVersion = *options.MinimumCLIVersion
+		}
+	}
+	return opts
+}
+
 // FindCLI searches for Claude Code CLI binary in standard locations.
 // It checks in this order:
 //  1. PATH via exec.LookPath("claude")
@@ -27,10 +47,16 @@ import (
 //
 // Returns the path to the CLI binary or a CLINotFoundError if not found.
 func FindCLI() (string, error) {
+	return FindCLIWithOptions(DiscoveryOptions{})
+}
+
+// FindCLIWithOptions searches for the CLI like FindCLI, checking the version
+// of the binary it finds according to opts.
+func FindCLIWithOptions(opts DiscoveryOptions) (string, error) {
 	// First, try to find in PATH
 	if cliPath, err := exec.LookPath("claude"); err == nil {
 		// Check version before returning
-		if err := CheckCLIVersion(cliPath); err != nil {
+		if err := CheckCLIVersionWithOptions(cliPath, opts); err != nil {
 			return "", err
 		}
 		return cliPath, nil
@@ -50,7 +76,7 @@ func FindCLI() (string, error) {
 		expandedPath := expandHome(location)
 		if _, err := os.Stat(expandedPath); err == nil {
 			// Check version before returning
-			if err := CheckCLIVersion(expandedPath); err != nil {
+			if err := CheckCLIVersionWithOptions(expandedPath, opts); err != nil {
 				return "", err
 			}
 			return expandedPath, nil
@@ -0,0 +1,131 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// flagSpec describes how a profile passes one SDK flag to its CLI.
+type flagSpec struct {
+	name   string // Flag name the CLI uses; "" when the flag is not passed
+	env    string // Environment variable set to the flag's value instead of passing it
+	omit   bool   // Left out because the CLI behaves as if it were given
+	sdk    bool   // Left out because the SDK enforces the option itself
+	option string // Option named in the error when the flag is unsupported
+}
+
+// cliProfile is the set of flags understood by one CLI major version.
+type cliProfile struct {
+	name  types.CLIProfile
+	major int
+	flags map[string]flagSpec // Keyed by the 2.x flag name; absent flags are passed unchanged
+}
+
+// profileV2 is the current CLI, which understands every flag the SDK emits.
+var profileV2 = &cliProfile{name: types.CLIProfileV2, major: 2}
+
+// profileV1 covers 1.x CLIs. Flags added in 2.0 are rejected, except that
+// permissions are bypassed without the 2.0 safety switch, the thinking
+// budget is read from the environment, and the turn limit is enforced by the
+// SDK because these CLIs do not honor --max-turns in streaming mode.
+var profileV1 = &cliProfile{
+	name:  types.CLIProfileV1,
+	major: 1,
+	flags: map[string]flagSpec{
+		"--fork-session":                       {option: "fork_session"},
+		"--max-budget-usd":                     {option: "max_budget_usd"},
+		"--setting-sources":                    {option: "setting_sources"},
+		"--plugin-dir":                         {option: "plugins"},
+		"--allow-dangerously-skip-permissions": {omit: true},
+		"--max-thinking-tokens":                {env: "MAX_THINKING_TOKENS"},
+		"--max-turns":                          {sdk: true},
+	},
+}
+
+// cliProfiles lists the profiles, newest first.
+var cliProfiles = []*cliProfile{profileV2, profileV1}
+
+// lookupCLIProfile returns the profile with the given name.
+func lookupCLIProfile(name types.CLIProfile) (*cliProfile, error) {
+	for _, p := range cliProfiles {
+		if p.name == name {
+			return p, nil
+		}
+	}
+	return nil, types.NewValidationError("cli_profile", fmt.Sprintf("unknown profile %q (want 1.x or 2.x)", name))
+}
+
+// profileForMajor returns the profile for a CLI major version. Versions newer
+// than every profile use the newest one.
+func profileForMajor(major int) *cliProfile {
+	for _, p := range cliProfiles {
+		if major >= p.major {
+			return p
+		}
+	}
+	return cliProfiles[len(cliProfiles)-1]
+}
+
+// translate returns the arguments and environment variables that pass flag
+// with its values to the profile's CLI, or a ValidationError if it has no
+// equivalent.
+func (p *cliProfile) translate(flag string, values ...string) ([]string, []string, error) {
+	spec, ok := p.flags[flag]
+	switch {
+	case !ok:
+		return append([]string{flag}, values...), nil, nil
+	case spec.name != "":
+		return append([]string{spec.name}, values...), nil, nil
+	case spec.env != "" && len(values) == 1:
+		return nil, []string{spec.env + "=" + values[0]}, nil
+	case spec.omit, spec.sdk:
+		return nil, nil, nil
+	}
+	return nil, nil, types.NewValidationError(spec.option, fmt.Sprintf("%s is not supported by Claude CLI %s; upgrade the CLI or leave the option unset", flag, p.name))
+}
+
+// enforcedBySDK reports whether the SDK enforces flag itself instead of passing
+// it to the profile's CLI.
+func (p *cliProfile) enforcedBySDK(flag string) bool {
+	return p.flags[flag].sdk
+}
+
+// EnforcedBySDK reports whether the SDK must enforce the option of flag (e.g.
+// "--max-turns") itself, because the CLI selected on Connect cannot.
+func (t *SubprocessCLITransport) EnforcedBySDK(flag string) bool {
+	profile := t.profile
+	if profile == nil {
+		profile = profileV2
+	}
+	return profile.enforcedBySDK(flag)
+}
+
+// detectedVersions holds the version found for each CLI path during discovery,
+// so profiles are selected without running the CLI again.
+var detectedVersions sync.Map // string -> SemanticVersion
+
+// recordCLIVersion remembers the version detected for a CLI path.
+func recordCLIVersion(cliPath string, version SemanticVersion) {
+	detectedVersions.Store(cliPath, version)
+}
+
+// resolveProfile selects the profile used to build the command: the one forced
+// by the options, else the one for the version detected during discovery. The
+// 2.x profile is used when the version is unknown, as when CLIPath bypasses
+// discovery or the version check is skipped.
+func (t *SubprocessCLITransport) resolveProfile() (*cliProfile, error) {
+	if t.options != nil && t.options.CLIProfile != types.CLIProfileAuto {
+		return lookupCLIProfile(t.options.CLIProfile)
+	}
+	value, ok := detectedVersions.Load(t.cliPath)
+	if !ok {
+		t.logger.Debug("CLI version unknown; using the %s argument profile", profileV2.name)
+		return profileV2, nil
+	}
+	version := value.(SemanticVersion)
+	profile := profileForMajor(version.Major)
+	t.logger.Debug("Using the %s argument profile for CLI version %s", profile.name, version)
+	return profile, nil
+}
@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestResolveProfile tests profile selection from the options and the detected version.
+func TestResolveProfile(t *testing.T) {
+	recordCLIVersion("/opt/claude-1", SemanticVersion{Major: 1, Minor: 0, Patch: 128})
+	recordCLIVersion("/opt/claude-3", SemanticVersion{Major: 3, Minor: 1, Patch: 0})
+
+	tests := []struct {
+		name    string
+		cliPath string
+		profile types.CLIProfile
+		want    *cliProfile
+	}{
+		{"detected 1.x", "/opt/claude-1", types.CLIProfileAuto, profileV1},
+		{"newer than every profile", "/opt/claude-3", types.CLIProfileAuto, profileV2},
+		{"version unknown", "/opt/claude-unchecked", types.CLIProfileAuto, profileV2},
+		{"forced over detection", "/opt/claude-1", types.CLIProfileV2, profileV2},
+		{"forced without detection", "/opt/claude-unchecked", types.CLIProfileV1, profileV1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := types.NewClaudeAgentOptions().WithCLIProfile(tt.profile)
+			transport := NewSubprocessCLITransport(tt.cliPath, "", nil, log.NewLogger(false), "", opts)
+			got, err := transport.resolveProfile()
+			if err != nil {
+				t.Fatalf("resolveProfile() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveProfile() = %s, want %s", got.name, tt.want.name)
+			}
+		})
+	}
+
+	opts := types.NewClaudeAgentOptions().WithCLIProfile("0.x")
+	transport := NewSubprocessCLITransport("/opt/claude-1", "", nil, log.NewLogger(false), "", opts)
+	if _, err := transport.resolveProfile(); !types.IsValidationError(err) || !strings.Contains(err.Error(), `unknown profile "0.x"`) {
+		t.Errorf("resolveProfile() error = %v, want ValidationError naming the profile", err)
+	}
+}
+
+// TestCheckCLIVersionRecordsProfile tests that the version found during
+// discovery selects the profile when a lowered minimum admits a 1.x CLI.
+func TestCheckCLIVersionRecordsProfile(t *testing.T) {
+	t.Setenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK", "")
+	cliPath := filepath.Join(writeVersionedCLI(t, "1.0.72"), "claude")
+
+	err := CheckCLIVersionWithOptions(cliPath, DiscoveryOptions{MinimumVersion: "1.0.0", Logger: log.NewLogger(false)})
+	if err != nil {
+		t.Fatalf("CheckCLIVersionWithOptions() unexpected error: %v", err)
+	}
+
+	transport := NewSubprocessCLITransport(cliPath, "", nil, log.NewLogger(false), "", types.NewClaudeAgentOptions().WithForkSession(true))
+	profile, err := transport.resolveProfile()
+	if err != nil || profile != profileV1 {
+		t.Fatalf("resolveProfile() = %v, %v; want the 1.x profile", profile, err)
+	}
+	transport.profile = profile
+	if _, _, err := transport.buildCommandArgs(); !types.IsValidationError(err) || !strings.Contains(err.Error(), "--fork-session is not supported by Claude CLI 1.x") {
+		t.Errorf("buildCommandArgs() error = %v, want ValidationError for --fork-session", err)
+	}
+}
+
+// TestMaxTurnsEnforcedBySDK tests that --max-turns is left to the SDK for 1.x
+// CLIs and passed to newer ones.
+func TestMaxTurnsEnforcedBySDK(t *testing.T) {
+	for _, profile := range []*cliProfile{profileV1, profileV2} {
+		t.Run(string(profile.name), func(t *testing.T) {
+			opts := types.NewClaudeAgentOptions().WithMaxTurns(3)
+			transport := NewSubprocessCLITransport("/opt/claude", "", nil, log.NewLogger(false), "", opts)
+			transport.profile = profile
+			args, _, err := transport.buildCommandArgs()
+			if err != nil {
+				t.Fatalf("buildCommandArgs() unexpected error: %v", err)
+			}
+
+			wantSDK := profile == profileV1
+			if got := transport.EnforcedBySDK("--max-turns"); got != wantSDK {
+				t.Errorf("EnforcedBySDK(--max-turns) = %v, want %v", got, wantSDK)
+			}
+			if passed := strings.Contains(strings.Join(args, " "), "--max-turns 3"); passed == wantSDK {
+				t.Errorf("--max-turns passed = %v with the SDK enforcing it = %v: %v", passed, wantSDK, args)
+			}
+		})
+	}
+}
@@ -124,11 +124,23 @@ func GetCLIVersion(cliPath string) (SemanticVersion, error) {
 // CheckCLIVersion verifies that the CLI version meets minimum requirements
 // Returns nil if version is acceptable, or an error if not
 func CheckCLIVersion(cliPath string) error {
-	// Check if version checking is disabled via environment variable
-	if os.Getenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK") != "" {
+	return CheckCLIVersionWithOptions(cliPath, DiscoveryOptions{})
+}
+
+// CheckCLIVersionWithOptions verifies the CLI version against opts.MinimumVersion
+// (MinimumCLIVersion when empty). The check is skipped when opts.SkipVersionCheck
+// is set or the CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK environment variable is non-empty.
+func CheckCLIVersionWithOptions(cliPath string, opts DiscoveryOptions) error {
+	// Check if version checking is disabled via options or environment variable
+	if opts.SkipVersionCheck || os.Getenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK") != "" {
 		return nil
 	}
 
+	minVersion, err := opts.minimumVersion()
+	if err != nil {
+		return err
+	}
+
 	// Get the CLI version
 	version, err := GetCLIVersion(cliPath)
 	if err != nil {
@@ -136,21 +148,17 @@ func CheckCLIVersion(cliPath string) error {
 		// (for backwards compatibility with older CLIs that might not have --version)
 		return nil
 	}
+	recordCLIVersion(cliPath, version)
 
 	// Check minimum version requirement
-	minVersion := SemanticVersion{
-		Major: MinimumCLIMajor,
-		Minor: MinimumCLIMinor,
-		Patch: MinimumCLIPatch,
-	}
-
 	if !version.IsAtLeast(minVersion) {
 		return types.NewCLINotFoundError(fmt.Sprintf(
 			"Claude CLI version %s is installed, but version %s or higher is required.\n"+
 				"Please update with:\n"+
 				"  npm install -g @anthropic-ai/claude-code@latest\n"+
 				"\nTo skip this check, set:\n"+
-				"  export CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK=1",
+				"  export CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK=1\n"+
+				"or use ClaudeAgentOptions.WithSkipVersionCheck(true)",
 			version.String(),
 			minVersion.String(),
 		))
@@ -158,3 +166,24 @@ func CheckCLIVersion(cliPath string) error {
 
 	return nil
 }
+
+// minimumVersion returns the required CLI version, warning when it is below the SDK default.
+func (opts DiscoveryOptions) minimumVersion() (SemanticVersion, error) {
+	defaultVersion := SemanticVersion{
+		Major: MinimumCLIMajor,
+		Minor: MinimumCLIMinor,
+		Patch: MinimumCLIPatch,
+	}
+	if opts.MinimumVersion == "" {
+		return defaultVersion, nil
+	}
+
+	version, err := ParseSemanticVersion(opts.MinimumVersion)
+	if err != nil {
+		return SemanticVersion{}, types.NewValidationErrorWithCause("minimum_cli_version", fmt.Sprintf("invalid version %q", opts.MinimumVersion), err)
+	}
+	if !version.IsAtLeast(defaultVersion) && opts.Logger != nil {
+		opts.Logger.Warning("Minimum CLI version %s is below the SDK default %s; older CLIs may not support every feature", version, defaultVersion)
+	}
+	return version, nil
+}
@@ -1,7 +1,13 @@
 package transport
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
 func TestParseSemanticVersion(t *testing.T) {
@@ -172,3 +178,89 @@ func TestSemanticVersionString(t *testing.T) {
 		})
 	}
 }
+
+// writeVersionedCLI writes a fake "claude" binary reporting the given version
+// and returns its directory.
+func writeVersionedCLI(t *testing.T, version string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '" + version + " (Claude Code)'\n"
+	if err := os.WriteFile(filepath.Join(dir, "claude"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake CLI: %v", err)
+	}
+	return dir
+}
+
+func TestCheckCLIVersionWithOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		cliVersion string
+		opts       DiscoveryOptions
+		skipEnv    bool
+		wantErr    bool
+	}{
+		{"default minimum satisfied", "2.0.5", DiscoveryOptions{}, false, false},
+		{"default minimum not met", "1.9.0", DiscoveryOptions{}, false, true},
+		{"option-only skip", "1.0.0", DiscoveryOptions{SkipVersionCheck: true}, false, false},
+		{"env override skips", "1.0.0", DiscoveryOptions{}, true, false},
+		{"env override wins over minimum", "1.0.0", DiscoveryOptions{MinimumVersion: "3.0.0"}, true, false},
+		{"raised minimum rejects default-compatible CLI", "2.0.5", DiscoveryOptions{MinimumVersion: "2.1.0"}, false, true},
+		{"raised minimum satisfied", "2.1.3", DiscoveryOptions{MinimumVersion: "2.1.0"}, false, false},
+		{"lowered minimum accepts older CLI", "1.5.0", DiscoveryOptions{MinimumVersion: "1.2.0", Logger: log.NewLogger(false)}, false, false},
+		{"lowered minimum still enforced", "1.1.0", DiscoveryOptions{MinimumVersion: "1.2.0"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.skipEnv {
+				t.Setenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK", "1")
+			} else {
+				t.Setenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK", "")
+			}
+			cliPath := filepath.Join(writeVersionedCLI(t, tt.cliVersion), "claude")
+
+			err := CheckCLIVersionWithOptions(cliPath, tt.opts)
+			if tt.wantErr {
+				if !types.IsCLINotFoundError(err) {
+					t.Errorf("expected CLINotFoundError, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("invalid minimum", func(t *testing.T) {
+		t.Setenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK", "")
+		cliPath := filepath.Join(writeVersionedCLI(t, "2.0.0"), "claude")
+
+		err := CheckCLIVersionWithOptions(cliPath, DiscoveryOptions{MinimumVersion: "two"})
+		if !types.IsValidationError(err) {
+			t.Errorf("expected ValidationError, got %v", err)
+		}
+	})
+}
+
+func TestFindCLIWithOptions(t *testing.T) {
+	t.Setenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK", "")
+	t.Setenv("HOME", t.TempDir())
+	dir := writeVersionedCLI(t, "2.0.1")
+	t.Setenv("PATH", dir)
+
+	if _, err := FindCLIWithOptions(NewDiscoveryOptions(types.NewClaudeAgentOptions().WithMinimumCLIVersion("2.2.0"), nil)); !types.IsCLINotFoundError(err) {
+		t.Errorf("expected raised minimum to reject CLI 2.0.1, got %v", err)
+	}
+
+	opts := types.NewClaudeAgentOptions().WithMinimumCLIVersion("2.2.0").WithSkipVersionCheck(true)
+	path, err := FindCLIWithOptions(NewDiscoveryOptions(opts, nil))
+	if err != nil {
+		t.Fatalf("expected skip option to bypass the check, got %v", err)
+	}
+	if path != filepath.Join(dir, "claude") {
+		t.Errorf("FindCLIWithOptions() = %q, want %q", path, filepath.Join(dir, "claude"))
+	}
+}
@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// mcpConfigArg returns the value for --mcp-config, or "" when no MCP servers are configured.
+//
+// A string is treated as a path to an existing config file and passed through.
+// A map of server configs is written to a temporary JSON file, which is removed on Close.
+// Callers must hold t.mu.
+func (t *SubprocessCLITransport) mcpConfigArg() (string, error) {
+	switch servers := t.options.McpServers.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return servers, nil
+	case map[string]interface{}:
+		if len(servers) == 0 {
+			return "", nil
+		}
+		cliServers := make(map[string]interface{}, len(servers))
+		for name, server := range servers {
+			config, err := mcpServerConfigForCLI(name, server)
+			if err != nil {
+				return "", types.NewValidationErrorWithCause("mcp_servers", fmt.Sprintf("invalid config for server %q", name), err)
+			}
+			cliServers[name] = config
+		}
+		return t.writeMcpConfigFile(cliServers)
+	default:
+		return "", types.NewValidationError("mcp_servers", fmt.Sprintf("unsupported type %T (want a config file path or map[string]interface{})", servers))
+	}
+}
+
+// mcpServerConfigForCLI converts a single server config into the form the CLI expects.
+// SDK servers run in-process, so only their type and name are sent to the CLI.
+func mcpServerConfigForCLI(name string, server interface{}) (interface{}, error) {
+	switch config := server.(type) {
+	case *types.McpStdioServerConfig:
+		if config == nil {
+			return nil, fmt.Errorf("nil config")
+		}
+		return mcpServerConfigForCLI(name, *config)
+	case *types.McpSSEServerConfig:
+		if config == nil {
+			return nil, fmt.Errorf("nil config")
+		}
+		return mcpServerConfigForCLI(name, *config)
+	case *types.McpHTTPServerConfig:
+		if config == nil {
+			return nil, fmt.Errorf("nil config")
+		}
+		return mcpServerConfigForCLI(name, *config)
+	case *types.McpSdkServerConfig:
+		if config == nil {
+			return nil, fmt.Errorf("nil config")
+		}
+		return mcpServerConfigForCLI(name, *config)
+
+	case types.McpStdioServerConfig:
+		if config.Command == "" {
+			return nil, fmt.Errorf("stdio server requires a command")
+		}
+		return config, nil
+	case types.McpSSEServerConfig:
+		if config.URL == "" {
+			return nil, fmt.Errorf("sse server requires a url")
+		}
+		if config.Type == "" {
+			config.Type = "sse"
+		}
+		return config, nil
+	case types.McpHTTPServerConfig:
+		if config.URL == "" {
+			return nil, fmt.Errorf("http server requires a url")
+		}
+		if config.Type == "" {
+			config.Type = "http"
+		}
+		return config, nil
+	case types.McpSdkServerConfig:
+		serverName := config.Name
+		if serverName == "" {
+			serverName = name
+		}
+		return map[string]interface{}{"type": "sdk", "name": serverName}, nil
+
+	case map[string]interface{}:
+		if config["type"] != "sdk" {
+			return config, nil
+		}
+		stripped := make(map[string]interface{}, len(config))
+		for key, value := range config {
+			if key != "instance" {
+				stripped[key] = value
+			}
+		}
+		return stripped, nil
+	default:
+		return nil, fmt.Errorf("unsupported server config type %T", server)
+	}
+}
+
+// writeMcpConfigFile writes the servers to a temporary config file and returns its path.
+func (t *SubprocessCLITransport) writeMcpConfigFile(servers map[string]interface{}) (string, error) {
+	data, err := json.Marshal(map[string]interface{}{"mcpServers": servers})
+	if err != nil {
+		return "", types.NewValidationErrorWithCause("mcp_servers", "failed to encode MCP config", err)
+	}
+
+	// Replace any file left by an earlier build of the arguments
+	t.removeMcpConfigFile()
+
+	file, err := os.CreateTemp(t.tempDir(), "claude-mcp-config-*.json")
+	if err != nil {
+		return "", t.tagged(types.NewCLIConnectionErrorWithCause("failed to create MCP config file", err))
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return "", t.tagged(types.NewCLIConnectionErrorWithCause("failed to write MCP config file", err))
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return "", t.tagged(types.NewCLIConnectionErrorWithCause("failed to write MCP config file", err))
+	}
+
+	t.mcpConfigPath = file.Name()
+	t.logger.Debug("Wrote MCP config for %d server(s) to %s", len(servers), t.mcpConfigPath)
+	return t.mcpConfigPath, nil
+}
+
+// removeMcpConfigFile deletes the temporary MCP config file, if one was written.
+func (t *SubprocessCLITransport) removeMcpConfigFile() {
+	if t.mcpConfigPath == "" {
+		return
+	}
+	if err := os.Remove(t.mcpConfigPath); err != nil && !os.IsNotExist(err) {
+		t.logger.Warning("Failed to remove MCP config file %s: %v", t.mcpConfigPath, err)
+	}
+	t.mcpConfigPath = ""
+}
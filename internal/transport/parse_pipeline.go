@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// parseQueueDepth is how many lines per parser worker may be read ahead of
+// the message being delivered.
+const parseQueueDepth = 8
+
+// parseResult is the outcome of parsing one line of CLI output.
+type parseResult struct {
+	msg types.Message
+	err error
+}
+
+// parseJob is a line waiting for a parser worker, with the slot its result is
+// delivered to.
+type parseJob struct {
+	line   []byte
+	result chan<- parseResult
+}
+
+// parallelReaderLoop reads stdout like messageReaderLoop but parses on workers
+// goroutines. A framing goroutine reads lines and queues each both to the
+// workers and, as a one-element result slot, to an order queue; this goroutine
+// takes the slots from the order queue and waits on each in turn, so messages
+// are delivered in the order the CLI wrote them however parsing interleaves.
+// Both queues are bounded, so a slow consumer stops reading as before.
+func (t *SubprocessCLITransport) parallelReaderLoop(ctx context.Context, workers int) {
+	jobs := make(chan parseJob, workers*parseQueueDepth)
+	order := make(chan chan parseResult, workers*parseQueueDepth)
+	readErr := make(chan error, 1)
+
+	for range workers {
+		go func() {
+			for job := range jobs {
+				msg, err := types.UnmarshalMessage(job.line)
+				job.result <- parseResult{msg: msg, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(order)
+		defer close(jobs)
+
+		reader := NewJSONLineReader(t.stdout)
+		for {
+			line, err := t.readLine(reader)
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			// The reader reuses its buffer for the next line
+			result := make(chan parseResult, 1)
+			select {
+			case order <- result:
+			case <-ctx.Done():
+				readErr <- ctx.Err()
+				return
+			}
+			jobs <- parseJob{line: bytes.Clone(line), result: result}
+		}
+	}()
+
+	for result := range order {
+		var parsed parseResult
+		select {
+		case parsed = <-result:
+		case <-ctx.Done():
+			t.logger.Debug("Message reader loop stopped: context cancelled")
+			return
+		}
+		if !t.deliver(ctx, parsed.msg, parsed.err) {
+			return
+		}
+	}
+
+	if err := <-readErr; err != ctx.Err() {
+		t.endOfOutput(ctx, err)
+	}
+}
@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// proxyEnvKeys are the inherited variables a ProxyConfig replaces unless
+// KeepInherited is set. Both spellings are listed since tools differ in which
+// one they read.
+var proxyEnvKeys = []string{
+	"HTTP_PROXY", "http_proxy",
+	"HTTPS_PROXY", "https_proxy",
+	"NO_PROXY", "no_proxy",
+	"ALL_PROXY", "all_proxy",
+	"NODE_EXTRA_CA_CERTS",
+}
+
+// proxyEnv returns the environment variables for a proxy configuration. A
+// relative ExtraCACertPath is resolved against the working directory, and a
+// ValidationError is returned if it is not a readable file.
+func (t *SubprocessCLITransport) proxyEnv(proxy types.ProxyConfig) ([]string, error) {
+	var env []string
+	set := func(key, value string) {
+		if value != "" {
+			env = append(env, key+"="+value, strings.ToLower(key)+"="+value)
+			t.logger.Debug("Setting %s for CLI subprocess: %s", key, redactEnvValue(key, value))
+		}
+	}
+	set("HTTP_PROXY", proxy.HTTPProxy)
+	set("HTTPS_PROXY", proxy.HTTPSProxy)
+	set("NO_PROXY", proxy.NoProxy)
+
+	if proxy.ExtraCACertPath != "" {
+		caPath, err := resolvePath(proxy.ExtraCACertPath, t.cwd)
+		if err != nil {
+			return nil, types.NewValidationErrorWithCause("proxy", fmt.Sprintf("invalid extra CA certificate path %s", proxy.ExtraCACertPath), err)
+		}
+		file, err := os.Open(caPath)
+		if err == nil {
+			var info os.FileInfo
+			if info, err = file.Stat(); err == nil && info.IsDir() {
+				err = fmt.Errorf("is a directory")
+			}
+			_ = file.Close()
+		}
+		if err != nil {
+			return nil, types.NewValidationErrorWithCause("proxy", fmt.Sprintf("extra CA certificate file %s is not readable", caPath), err)
+		}
+		env = append(env, "NODE_EXTRA_CA_CERTS="+caPath)
+		t.logger.Debug("Setting NODE_EXTRA_CA_CERTS for CLI subprocess: %s", caPath)
+	}
+	return env, nil
+}
+
+// unsetEnvKeys returns the inherited variables removed from the subprocess
+// environment: those a ProxyConfig replaces, unless it keeps inherited values.
+func (t *SubprocessCLITransport) unsetEnvKeys() []string {
+	if t.options == nil || t.options.Proxy == nil || t.options.Proxy.KeepInherited {
+		return nil
+	}
+	return proxyEnvKeys
+}
+
+// CommandLine returns the command of the started subprocess for diagnostics,
+// shell-quoted: the environment variables set by the SDK, the CLI path and its
+// arguments. Proxy credentials and values of variables that look like secrets
+// are redacted. It returns "" before Connect.
+func (t *SubprocessCLITransport) CommandLine() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.commandLine
+}
+
+// formatCommandLine renders a command for CommandLine.
+func formatCommandLine(cliPath string, args, envAdditions, unset []string) string {
+	parts := make([]string, 0, len(envAdditions)+len(args)+2)
+	if len(unset) > 0 {
+		parts = append(parts, "env")
+		for _, key := range unset {
+			parts = append(parts, "-u", key)
+		}
+	}
+	for _, kv := range envAdditions {
+		key, value, _ := strings.Cut(kv, "=")
+		parts = append(parts, key+"="+shellQuote(redactEnvValue(key, value)))
+	}
+	parts = append(parts, shellQuote(cliPath))
+	for _, arg := range args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// sensitiveEnvMarkers are substrings of variable names whose values are redacted.
+var sensitiveEnvMarkers = []string{"KEY", "TOKEN", "SECRET", "PASSWORD", "CREDENTIAL", "AUTH"}
+
+// redactEnvValue hides secrets in an environment variable value: the password
+// of a proxy URL, or the whole value of a variable named like a secret.
+func redactEnvValue(key, value string) string {
+	upper := strings.ToUpper(key)
+	for _, marker := range sensitiveEnvMarkers {
+		if strings.Contains(upper, marker) {
+			return "[REDACTED]"
+		}
+	}
+	if strings.HasSuffix(upper, "_PROXY") {
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+	}
+	return value
+}
+
+// shellQuote single-quotes s for a POSIX shell when it contains special characters.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\$`!*?[]{}()<>|&;#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,274 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ReplayEntry is one recorded line of a session: written to the CLI when Sent
+// is set, read from it otherwise.
+type ReplayEntry struct {
+	Sent bool
+	Line []byte
+}
+
+// ReplayTransport plays back a recorded session in place of the CLI. The
+// recorded output up to the first sent line is read on Connect; each Write
+// then stands in for the next sent line and releases the output recorded
+// after it. Timing is not reproduced.
+//
+// Control responses are rewritten to the request IDs of the control requests
+// actually written, which differ between runs. A control request with no
+// recorded counterpart, such as the initialize request of a recording made
+// without control traffic, is answered with an empty success response. Any
+// other write past the end of the recording fails.
+type ReplayTransport struct {
+	entries []ReplayEntry
+	logger  *log.Logger
+
+	mu       sync.Mutex
+	next     int               // Index of the next entry to replay
+	ids      map[string]string // Recorded control request ID -> ID written in its place
+	pending  [][]byte          // Released lines not yet delivered
+	started  bool
+	ready    bool
+	reason   ReadinessReason
+	err      error
+	wake     chan struct{}
+	done     chan struct{}
+	messages chan types.Message
+}
+
+// NewReplayTransport creates a transport replaying entries.
+func NewReplayTransport(entries []ReplayEntry, logger *log.Logger) *ReplayTransport {
+	return &ReplayTransport{
+		entries:  entries,
+		logger:   logger,
+		ids:      make(map[string]string),
+		reason:   ReadinessNeverConnected,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		messages: make(chan types.Message, 10),
+	}
+}
+
+// Connect releases the output recorded before the first sent line.
+func (t *ReplayTransport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.reason == ReadinessClosed {
+		return types.NewCLIConnectionError("replay transport is closed")
+	}
+	if t.started {
+		return nil
+	}
+	t.started = true
+	t.ready = true
+	t.reason = ReadinessReady
+	t.release()
+	go t.deliver()
+	return nil
+}
+
+// Write consumes the next recorded sent line in place of data and releases
+// the output recorded after it.
+func (t *ReplayTransport) Write(ctx context.Context, data string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.ready {
+		return types.NewCLIConnectionError("transport is not ready for writing (" + string(t.reason) + ")")
+	}
+
+	written := envelopeOf([]byte(data))
+	if written.Type == "control_request" {
+		if t.next < len(t.entries) && envelopeOf(t.entries[t.next].Line).Type == "control_request" {
+			t.ids[envelopeOf(t.entries[t.next].Line).RequestID] = written.RequestID
+			t.next++
+			t.release()
+			return nil
+		}
+		t.logger.Debug("Answering unrecorded control request %s", written.RequestID)
+		response, _ := json.Marshal(map[string]interface{}{
+			"type": "control_response",
+			"response": map[string]interface{}{
+				"subtype":    "success",
+				"request_id": written.RequestID,
+				"response":   map[string]interface{}{},
+			},
+		})
+		t.pending = append(t.pending, response)
+		t.signal()
+		return nil
+	}
+
+	if t.next >= len(t.entries) {
+		return types.NewCLIConnectionError("replay trace has no recorded output left for a " + written.Type + " message")
+	}
+	t.next++
+	t.release()
+	return nil
+}
+
+// release queues the received lines from the next entry up to the next sent
+// one. The caller holds t.mu.
+func (t *ReplayTransport) release() {
+	for t.next < len(t.entries) && !t.entries[t.next].Sent {
+		t.pending = append(t.pending, t.rekey(t.entries[t.next].Line))
+		t.next++
+	}
+	t.signal()
+}
+
+// rekey rewrites the request ID of a recorded control response to that of
+// the request written in place of the recorded one. The caller holds t.mu.
+func (t *ReplayTransport) rekey(line []byte) []byte {
+	envelope := envelopeOf(line)
+	if envelope.Type != "control_response" {
+		return line
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return line
+	}
+	response, ok := msg["response"].(map[string]interface{})
+	if !ok {
+		return line
+	}
+	id, ok := response["request_id"].(string)
+	if !ok || t.ids[id] == "" {
+		return line
+	}
+	response["request_id"] = t.ids[id]
+	rekeyed, err := json.Marshal(msg)
+	if err != nil {
+		return line
+	}
+	return rekeyed
+}
+
+// signal wakes deliver without blocking.
+func (t *ReplayTransport) signal() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver parses the released lines onto the messages channel in order until
+// the transport is closed.
+func (t *ReplayTransport) deliver() {
+	defer close(t.messages)
+
+	for {
+		t.mu.Lock()
+		if len(t.pending) == 0 {
+			t.mu.Unlock()
+			select {
+			case <-t.wake:
+				continue
+			case <-t.done:
+				return
+			}
+		}
+		line := t.pending[0]
+		t.pending = t.pending[1:]
+		t.mu.Unlock()
+
+		msg, err := types.UnmarshalMessage(line)
+		if err != nil {
+			t.logger.Warning("Failed to parse replayed message: %v", err)
+			t.OnError(err)
+			if !types.IsJSONDecodeError(err) {
+				continue
+			}
+			msg = types.NewErrorMessage(err)
+		}
+		select {
+		case t.messages <- msg:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// ReadMessages returns the replayed messages. The channel is closed by Close.
+func (t *ReplayTransport) ReadMessages(ctx context.Context) <-chan types.Message {
+	return t.messages
+}
+
+// Close stops the replay.
+func (t *ReplayTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.reason == ReadinessClosed {
+		return nil
+	}
+	t.ready = false
+	t.reason = ReadinessClosed
+	close(t.done)
+	if !t.started {
+		close(t.messages)
+	}
+	return nil
+}
+
+// OnError stores err for GetError.
+func (t *ReplayTransport) OnError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
+
+// IsReady reports whether the replay is connected and not closed.
+func (t *ReplayTransport) IsReady() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ready
+}
+
+// ReadinessReason explains the current readiness.
+func (t *ReplayTransport) ReadinessReason() ReadinessReason {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.reason
+}
+
+// GetError returns the last error stored by OnError.
+func (t *ReplayTransport) GetError() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// replayEnvelope holds the fields of a line that decide how it is replayed.
+type replayEnvelope struct {
+	Type      string
+	RequestID string
+}
+
+// envelopeOf reads the type of a line and, for control requests and
+// responses, its request ID. Unparseable lines have an empty envelope.
+func envelopeOf(line []byte) replayEnvelope {
+	var msg struct {
+		Type      string `json:"type"`
+		RequestID string `json:"request_id"`
+		Response  struct {
+			RequestID string `json:"request_id"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return replayEnvelope{}
+	}
+	if msg.RequestID == "" {
+		msg.RequestID = msg.Response.RequestID
+	}
+	return replayEnvelope{Type: msg.Type, RequestID: msg.RequestID}
+}
@@ -0,0 +1,143 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// sessionLockPollInterval is how often SessionLockBlock retries a held lock.
+var sessionLockPollInterval = 50 * time.Millisecond
+
+// errLockHeld is returned by tryLockFile when another holder has the lock.
+var errLockHeld = errors.New("lock held")
+
+// SessionLock is an advisory lock on a session file, held while a client
+// resumes the session. See types.ClaudeAgentOptions.WithSessionLocking.
+type SessionLock struct {
+	path    string
+	release func() error
+}
+
+// LockSession takes the lock on the file of sessionID according to
+// options.SessionLocking. It returns nil without locking when locking is off,
+// the session is forked, or the session's project directory does not exist
+// (the CLI will then report the session as not found). cwd is the resolved
+// working directory, "" for the current one.
+func LockSession(ctx context.Context, options *types.ClaudeAgentOptions, cwd, sessionID string, logger *log.Logger) (*SessionLock, error) {
+	if options.SessionLocking == types.SessionLockOff || options.ForkSession || sessionID == "" {
+		return nil, nil
+	}
+
+	sessionFile, err := SessionFilePath(options, cwd, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Dir(sessionFile)); err != nil {
+		logger.Debug("Not locking session %s: %v", sessionID, err)
+		return nil, nil
+	}
+
+	path := sessionFile + ".lock"
+	for {
+		release, err := tryLockFile(path)
+		if err == nil {
+			logger.Debug("Locked session %s (%s)", sessionID, path)
+			return &SessionLock{path: path, release: release}, nil
+		}
+		if !errors.Is(err, errLockHeld) {
+			return nil, fmt.Errorf("lock session %s: %w", sessionID, err)
+		}
+
+		locked := types.NewSessionLockedError(sessionID, path, readLockHolder(path))
+		if options.SessionLocking == types.SessionLockFail {
+			return nil, locked
+		}
+		logger.Info("Waiting for %v", locked)
+		select {
+		case <-ctx.Done():
+			return nil, errors.Join(locked, ctx.Err())
+		case <-time.After(sessionLockPollInterval):
+		}
+	}
+}
+
+// Release releases the lock. It is safe to call on a nil lock and more than once.
+func (l *SessionLock) Release() error {
+	if l == nil || l.release == nil {
+		return nil
+	}
+	release := l.release
+	l.release = nil
+	return release()
+}
+
+// SessionFilePath returns the file in which the CLI stores sessionID:
+// projects/<project>/<sessionID>.jsonl under its configuration directory,
+// where <project> is the working directory with every character other than
+// an ASCII letter or digit replaced by "-". The configuration directory is
+// CLAUDE_CONFIG_DIR as the CLI will see it, else ~/.claude.
+func SessionFilePath(options *types.ClaudeAgentOptions, cwd, sessionID string) (string, error) {
+	configDir, err := cliConfigDir(options)
+	if err != nil {
+		return "", err
+	}
+	if cwd == "" {
+		if cwd, err = os.Getwd(); err != nil {
+			return "", err
+		}
+	}
+
+	project := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, cwd)
+	return filepath.Join(configDir, "projects", project, sessionID+".jsonl"), nil
+}
+
+// cliConfigDir returns the CLI's configuration directory, following the
+// precedence of the environment built for it (see envAdditions): a custom
+// CLAUDE_CONFIG_DIR, then the ephemeral one, then the SDK's own environment.
+func cliConfigDir(options *types.ClaudeAgentOptions) (string, error) {
+	if dir := options.Env["CLAUDE_CONFIG_DIR"]; dir != "" {
+		return expandHome(dir), nil
+	}
+	if options.Ephemeral {
+		tempDir := os.TempDir()
+		if options.TempDir != nil {
+			tempDir = *options.TempDir
+		}
+		return filepath.Join(tempDir, ".claude"), nil
+	}
+	if dir := os.Getenv("CLAUDE_CONFIG_DIR"); dir != "" {
+		return expandHome(dir), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("locate the CLI's configuration directory: %w", err)
+	}
+	return filepath.Join(home, ".claude"), nil
+}
+
+// readLockHolder returns the PID recorded in a lock file, or 0 if unknown.
+func readLockHolder(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
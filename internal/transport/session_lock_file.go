@@ -0,0 +1,31 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package transport
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+// tryLockFile creates path exclusively, recording the process ID in it, on
+// platforms without flock. The file is removed on release; a lock file left
+// behind by a process that died must be removed by hand.
+func tryLockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, errLockHeld
+		}
+		return nil, err
+	}
+	_, _ = f.WriteString(strconv.Itoa(os.Getpid()))
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	return func() error {
+		return os.Remove(path)
+	}, nil
+}
@@ -0,0 +1,38 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package transport
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// tryLockFile takes an exclusive flock on path, creating it, and records the
+// process ID in it. The lock is held by the open file, so it also excludes
+// other clients of this process, and the kernel releases it if the process
+// dies. The file is kept on release, since removing it would let a waiter
+// lock an unlinked file.
+func tryLockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errLockHeld
+		}
+		return nil, err
+	}
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+
+	return func() error {
+		_ = f.Truncate(0)
+		// Closing the file releases the lock
+		return f.Close()
+	}, nil
+}
@@ -0,0 +1,72 @@
+package transport
+
+import "sync"
+
+// lineDispatcher delivers stderr lines to a callback on its own goroutine so a
+// slow callback cannot hold up the stderr reader. Lines are queued without
+// limit and delivered in order; none are dropped.
+type lineDispatcher struct {
+	callback func(line string)
+
+	mu      sync.Mutex
+	queue   []string
+	closed  bool
+	pending chan struct{} // signalled when lines are queued or the dispatcher closes
+	done    chan struct{} // closed once every queued line has been delivered
+}
+
+// newLineDispatcher starts a dispatcher for callback.
+func newLineDispatcher(callback func(line string)) *lineDispatcher {
+	d := &lineDispatcher{
+		callback: callback,
+		pending:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// dispatch queues a line for the callback.
+func (d *lineDispatcher) dispatch(line string) {
+	d.mu.Lock()
+	d.queue = append(d.queue, line)
+	d.mu.Unlock()
+	d.signal()
+}
+
+// close stops the dispatcher once the queued lines have been delivered.
+func (d *lineDispatcher) close() {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.signal()
+}
+
+func (d *lineDispatcher) signal() {
+	select {
+	case d.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (d *lineDispatcher) run() {
+	defer close(d.done)
+	for range d.pending {
+		for {
+			d.mu.Lock()
+			lines, closed := d.queue, d.closed
+			d.queue = nil
+			d.mu.Unlock()
+
+			if len(lines) == 0 {
+				if closed {
+					return
+				}
+				break
+			}
+			for _, line := range lines {
+				d.callback(line)
+			}
+		}
+	}
+}
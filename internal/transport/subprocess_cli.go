@@ -2,11 +2,15 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
@@ -36,16 +40,31 @@ type SubprocessCLITransport struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
+	// Reaping the subprocess: Wait is called once, by Close or WaitExit
+	stderrDone chan struct{} // Closed when readStderr has returned
+	waitOnce   sync.Once
+	waitErr    error
+
 	// Message streaming
 	messages chan types.Message
 
 	// Writer for stdin
 	writer *JSONLineWriter
 
+	// Temporary --mcp-config file written from McpServers, removed on Close
+	mcpConfigPath string
+
+	// Redacted command of the started subprocess, for diagnostics
+	commandLine string
+
+	// Flags understood by the CLI, resolved on Connect; nil uses the 2.x profile
+	profile *cliProfile
+
 	// Error tracking
-	mu    sync.Mutex
-	err   error
-	ready bool
+	mu     sync.Mutex
+	err    error
+	ready  bool
+	reason ReadinessReason // Why ready is false; ReadinessReady while it is true
 }
 
 // NewSubprocessCLITransport creates a new transport instance.
@@ -64,7 +83,54 @@ func NewSubprocessCLITransport(cliPath, cwd string, env map[string]string, logge
 		resumeSessionID: resumeSessionID,
 		options:         options,
 		messages:        make(chan types.Message, 10), // Buffered channel for smooth streaming
+		reason:          ReadinessNeverConnected,
+	}
+}
+
+// ResolveCWD expands a leading ~ in cwd, makes a relative path absolute against
+// the current process directory, and checks that the result names an existing
+// directory, so a bad working directory is reported before the subprocess is
+// spawned. An empty cwd (the current directory) is returned unchanged. The error
+// is a *types.ValidationError naming the resolved path.
+func ResolveCWD(cwd string) (string, error) {
+	if cwd == "" {
+		return "", nil
+	}
+
+	resolved, err := resolvePath(cwd, "")
+	if err != nil {
+		return "", types.NewValidationErrorWithCause("cwd", fmt.Sprintf("cannot resolve working directory %s", cwd), err)
+	}
+	if err := checkDir(resolved); err != nil {
+		if os.IsNotExist(err) {
+			return "", types.NewValidationErrorWithCause("cwd", fmt.Sprintf("working directory %s does not exist", resolved), err)
+		}
+		return "", types.NewValidationErrorWithCause("cwd", fmt.Sprintf("working directory %s is not usable", resolved), err)
+	}
+	return resolved, nil
+}
+
+// resolvePath expands a leading ~ in path and makes it absolute. A relative
+// path is resolved against base, or against the current process directory when
+// base is empty.
+func resolvePath(path, base string) (string, error) {
+	path = expandHome(path)
+	if !filepath.IsAbs(path) && base != "" {
+		path = filepath.Join(base, path)
+	}
+	return filepath.Abs(path)
+}
+
+// checkDir returns an error unless path names an existing directory.
+func checkDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory")
 	}
+	return nil
 }
 
 // Connect starts the Claude Code CLI subprocess and establishes communication pipes.
@@ -79,14 +145,45 @@ func (t *SubprocessCLITransport) Connect(ctx context.Context) error {
 
 	t.logger.Debug("Starting Claude CLI subprocess: %s", t.cliPath)
 
+	// Normalize the working directory; relative paths and the other paths
+	// below are resolved against it
+	cwd, err := ResolveCWD(t.cwd)
+	if err != nil {
+		t.logger.Error("Invalid working directory: %v", err)
+		return err
+	}
+	t.cwd = cwd
+
+	// Select the flags the CLI understands
+	profile, err := t.resolveProfile()
+	if err != nil {
+		t.logger.Error("Invalid CLI options: %v", err)
+		return err
+	}
+	t.profile = profile
+
+	// Remove the temporary MCP config if the subprocess never starts, including
+	// when building the arguments fails after it was written
+	started := false
+	defer func() {
+		if !started {
+			t.removeMcpConfigFile()
+		}
+	}()
+
+	// Build command arguments and environment (validates options before anything is spawned)
+	args, envAdditions, err := t.buildCommandArgs()
+	if err != nil {
+		t.logger.Error("Invalid CLI options: %v", err)
+		return err
+	}
+
 	// Create cancellable context
 	t.ctx, t.cancel = context.WithCancel(ctx)
 
-	// Build command arguments
-	args := t.buildCommandArgs()
-
 	// Log the full command for debugging
-	t.logger.Debug("Claude CLI command: %s %v", t.cliPath, args)
+	t.commandLine = formatCommandLine(t.cliPath, args, envAdditions, t.unsetEnvKeys())
+	t.logger.Debug("Claude CLI command: %s", t.commandLine)
 
 	// Create command with arguments
 	t.cmd = exec.CommandContext(t.ctx, t.cliPath, args...)
@@ -97,59 +194,28 @@ func (t *SubprocessCLITransport) Connect(ctx context.Context) error {
 	}
 
 	// Set up environment variables
-	// Start with current environment
-	t.cmd.Env = os.Environ()
-
-	// Add SDK-specific variables
-	t.cmd.Env = append(t.cmd.Env, "CLAUDE_CODE_ENTRYPOINT=agent")
-	t.cmd.Env = append(t.cmd.Env, fmt.Sprintf("CLAUDE_AGENT_SDK_VERSION=%s", SDKVersion))
-
-	// Add model environment variable if specified in options (ANTHROPIC_MODEL)
-	// This is critical - both CLI flag and env var should be set for maximum compatibility
-	if t.options != nil && t.options.Model != nil {
-		t.cmd.Env = append(t.cmd.Env, fmt.Sprintf("ANTHROPIC_MODEL=%s", *t.options.Model))
-		t.logger.Debug("Setting ANTHROPIC_MODEL environment variable: %s", *t.options.Model)
-	} else {
-		t.logger.Debug("ANTHROPIC_MODEL not set (using CLI default)")
-	}
-
-	// Add base URL environment variable if specified in options (ANTHROPIC_BASE_URL)
-	// If not set, Claude CLI will use default Anthropic API endpoint
-	if t.options != nil && t.options.BaseURL != nil {
-		t.cmd.Env = append(t.cmd.Env, fmt.Sprintf("ANTHROPIC_BASE_URL=%s", *t.options.BaseURL))
-		t.logger.Debug("Setting ANTHROPIC_BASE_URL environment variable: %s", *t.options.BaseURL)
-	} else {
-		t.logger.Debug("ANTHROPIC_BASE_URL not set (using default Anthropic API)")
-	}
-
-	// Add custom environment variables (these can override the above if needed)
-	for key, value := range t.env {
-		t.cmd.Env = append(t.cmd.Env, fmt.Sprintf("%s=%s", key, value))
-		t.logger.Debug("Setting custom environment variable: %s=%s", key, value)
-	}
+	t.cmd.Env = t.buildEnv(envAdditions)
 
 	// Set up pipes
-	var err error
-
 	t.stdin, err = t.cmd.StdinPipe()
 	if err != nil {
-		return types.NewCLIConnectionErrorWithCause("failed to create stdin pipe", err)
+		return t.tagged(types.NewCLIConnectionErrorWithCause("failed to create stdin pipe", err))
 	}
 
 	t.stdout, err = t.cmd.StdoutPipe()
 	if err != nil {
-		return types.NewCLIConnectionErrorWithCause("failed to create stdout pipe", err)
+		return t.tagged(types.NewCLIConnectionErrorWithCause("failed to create stdout pipe", err))
 	}
 
 	t.stderr, err = t.cmd.StderrPipe()
 	if err != nil {
-		return types.NewCLIConnectionErrorWithCause("failed to create stderr pipe", err)
+		return t.tagged(types.NewCLIConnectionErrorWithCause("failed to create stderr pipe", err))
 	}
 
 	// Start the process
 	if err := t.cmd.Start(); err != nil {
 		t.logger.Error("Failed to start subprocess: %v", err)
-		return types.NewCLIConnectionErrorWithCause("failed to start subprocess", err)
+		return t.tagged(types.NewCLIConnectionErrorWithCause("failed to start subprocess", err))
 	}
 	t.logger.Debug("CLI subprocess started successfully (PID: %d)", t.cmd.Process.Pid)
 
@@ -160,22 +226,114 @@ func (t *SubprocessCLITransport) Connect(ctx context.Context) error {
 	go t.messageReaderLoop(t.ctx)
 
 	// Launch stderr reader for debugging
-	go t.readStderr(t.ctx)
+	t.stderrDone = make(chan struct{})
+	go func() {
+		defer close(t.stderrDone)
+		t.readStderr(t.ctx)
+	}()
 
 	// Mark as ready
+	started = true
 	t.ready = true
+	t.reason = ReadinessReady
 	t.logger.Debug("Transport ready for communication")
 
 	return nil
 }
 
+// buildEnv returns the environment for the CLI subprocess: the current
+// environment without the variables removed by the options (see
+// unsetEnvKeys), with the additions from buildCommandArgs applied on top.
+func (t *SubprocessCLITransport) buildEnv(additions []string) []string {
+	unset := t.unsetEnvKeys()
+	env := make([]string, 0, len(os.Environ())+len(additions))
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if !slices.Contains(unset, key) {
+			env = append(env, kv)
+		}
+	}
+	return append(env, additions...)
+}
+
+// envAdditions returns the environment variables implied by the options, as
+// KEY=VALUE pairs, with t.env applied last.
+func (t *SubprocessCLITransport) envAdditions() ([]string, error) {
+	// Add SDK-specific variables
+	env := []string{
+		"CLAUDE_CODE_ENTRYPOINT=agent",
+		fmt.Sprintf("CLAUDE_AGENT_SDK_VERSION=%s", SDKVersion),
+	}
+
+	// Add model environment variable if specified in options (ANTHROPIC_MODEL)
+	// This is critical - both CLI flag and env var should be set for maximum compatibility
+	if t.options != nil && t.options.Model != nil {
+		env = append(env, fmt.Sprintf("ANTHROPIC_MODEL=%s", *t.options.Model))
+		t.logger.Debug("Setting ANTHROPIC_MODEL environment variable: %s", *t.options.Model)
+	} else {
+		t.logger.Debug("ANTHROPIC_MODEL not set (using CLI default)")
+	}
+
+	// Add base URL environment variable if specified in options (ANTHROPIC_BASE_URL)
+	// If not set, Claude CLI will use default Anthropic API endpoint
+	if t.options != nil && t.options.BaseURL != nil {
+		env = append(env, fmt.Sprintf("ANTHROPIC_BASE_URL=%s", *t.options.BaseURL))
+		t.logger.Debug("Setting ANTHROPIC_BASE_URL environment variable: %s", *t.options.BaseURL)
+	} else {
+		t.logger.Debug("ANTHROPIC_BASE_URL not set (using default Anthropic API)")
+	}
+
+	// Add the user identifier so CLI sessions can be attributed to a tenant
+	if t.options != nil && t.options.User != nil && *t.options.User != "" {
+		env = append(env, fmt.Sprintf("CLAUDE_AGENT_SDK_USER=%s", *t.options.User))
+		t.logger.Info("Starting CLI session for user: %s", *t.options.User)
+	}
+
+	// Add proxy settings for the subprocess
+	if t.options != nil && t.options.Proxy != nil {
+		proxyEnv, err := t.proxyEnv(*t.options.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, proxyEnv...)
+	}
+
+	// Keep the CLI's configuration and session files out of the home directory
+	if t.options != nil && t.options.Ephemeral {
+		env = append(env, "CLAUDE_CONFIG_DIR="+filepath.Join(t.tempDir(), ".claude"))
+	}
+
+	// Add custom environment variables (these can override the above if needed),
+	// sorted by name for deterministic output
+	keys := make([]string, 0, len(t.env))
+	for key := range t.env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, fmt.Sprintf("%s=%s", key, t.env[key]))
+		t.logger.Debug("Setting custom environment variable: %s=%s", key, t.env[key])
+	}
+
+	return env, nil
+}
+
 // messageReaderLoop reads JSON lines from stdout and parses them into messages.
 // It runs in a goroutine and sends messages to the messages channel.
 // It respects context cancellation and closes the messages channel when done.
+// With options.ParserWorkers above 1 parsing is handed to a worker pool; see
+// parallelReaderLoop.
 func (t *SubprocessCLITransport) messageReaderLoop(ctx context.Context) {
+	// Without stdout the transport is unusable; the channel is closed first so
+	// consumers are not held up by a concurrent Close
+	defer t.markNotReady(ReadinessStdoutClosed)
 	defer close(t.messages)
 
 	t.logger.Debug("Message reader loop started")
+	if t.options != nil && t.options.ParserWorkers > 1 {
+		t.parallelReaderLoop(ctx, t.options.ParserWorkers)
+		return
+	}
 	reader := NewJSONLineReader(t.stdout)
 
 	for {
@@ -187,48 +345,84 @@ func (t *SubprocessCLITransport) messageReaderLoop(ctx context.Context) {
 		default:
 		}
 
-		// Read next JSON line
-		line, err := reader.ReadLine()
+		line, err := t.readLine(reader)
 		if err != nil {
-			if err == io.EOF {
-				t.logger.Debug("Message reader loop stopped: EOF from CLI")
-				// Normal end of stream
-				return
-			}
+			t.endOfOutput(ctx, err)
+			return
+		}
 
-			t.logger.Error("Failed to read from CLI stdout: %v", err)
-			// Store error and return
-			t.OnError(types.NewJSONDecodeErrorWithCause(
-				"failed to read JSON line from subprocess",
-				string(line),
-				err,
-			))
+		msg, err := types.UnmarshalMessage(line)
+		if !t.deliver(ctx, msg, err) {
 			return
 		}
+	}
+}
 
+// readLine returns the next non-empty line of CLI output, after passing it to
+// the protocol tracer. The line is only valid until the next call.
+func (t *SubprocessCLITransport) readLine(reader *JSONLineReader) ([]byte, error) {
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return line, err
+		}
 		// Skip empty lines
 		if len(line) == 0 {
 			continue
 		}
-
-		// Parse JSON into message
-		msg, err := types.UnmarshalMessage(line)
-		if err != nil {
-			t.logger.Warning("Failed to parse message from CLI: %v", err)
-			// Store parse error but continue reading
-			t.OnError(err)
-			continue
+		if t.options != nil && t.options.ProtocolTrace != nil {
+			t.options.ProtocolTrace.TraceReceived(line)
 		}
+		return line, nil
+	}
+}
+
+// endOfOutput handles the error that ended reading: io.EOF is the normal end
+// of the stream, anything else is stored and reported to consumers.
+func (t *SubprocessCLITransport) endOfOutput(ctx context.Context, err error) {
+	if err == io.EOF {
+		t.logger.Debug("Message reader loop stopped: EOF from CLI")
+		return
+	}
 
-		t.logger.Debug("Received message from CLI: type=%s", msg.GetMessageType())
+	t.logger.Error("Failed to read from CLI stdout: %v", err)
+	readErr := types.NewJSONDecodeErrorWithCause(
+		"failed to read JSON line from subprocess",
+		"",
+		err,
+	)
+	t.OnError(readErr)
+	select {
+	case t.messages <- types.NewErrorMessage(readErr):
+	case <-ctx.Done():
+	}
+}
 
-		// Send message to channel (respect context cancellation)
-		select {
-		case <-ctx.Done():
-			return
-		case t.messages <- msg:
-			// Message sent successfully
+// deliver sends a parsed line to the messages channel. A parse error is
+// stored, and malformed output is reported to consumers as an ErrorMessage in
+// its place; a message type this SDK does not know is dropped. It returns
+// false if ctx ended first.
+func (t *SubprocessCLITransport) deliver(ctx context.Context, msg types.Message, err error) bool {
+	if err != nil {
+		t.logger.Warning("Failed to parse message from CLI: %v", err)
+		// Store parse error but continue reading
+		t.OnError(err)
+		if !types.IsJSONDecodeError(err) {
+			// A message type this SDK does not know is not reported to consumers
+			return true
 		}
+		// Report malformed output where it occurred
+		msg = types.NewErrorMessage(err)
+	}
+
+	t.logger.Debug("Received message from CLI: type=%s", msg.GetMessageType())
+
+	// Send message to channel (respect context cancellation)
+	select {
+	case <-ctx.Done():
+		return false
+	case t.messages <- msg:
+		return true
 	}
 }
 
@@ -239,19 +433,26 @@ func (t *SubprocessCLITransport) Write(ctx context.Context, data string) error {
 	defer t.mu.Unlock()
 
 	if !t.ready {
-		return types.NewCLIConnectionError("transport is not ready for writing")
+		return t.tagged(types.NewCLIConnectionError(fmt.Sprintf("transport is not ready for writing (%s)", t.reason)))
 	}
 
 	if t.writer == nil {
-		return types.NewCLIConnectionError("stdin writer not initialized")
+		return t.tagged(types.NewCLIConnectionError("stdin writer not initialized"))
 	}
 
 	t.logger.Debug("Sending message to CLI stdin")
 
+	// Traced before writing: once written, the CLI's answer may be read and
+	// traced before WriteLine returns
+	if t.options != nil && t.options.ProtocolTrace != nil {
+		t.options.ProtocolTrace.TraceSent([]byte(data))
+	}
+
 	// Write JSON line (includes newline and flush)
 	if err := t.writer.WriteLine(data); err != nil {
 		t.ready = false
-		t.err = types.NewCLIConnectionErrorWithCause("failed to write to subprocess stdin", err)
+		t.reason = ReadinessStdinBroken
+		t.err = t.tagged(types.NewCLIConnectionErrorWithCause("failed to write to subprocess stdin", err))
 		t.logger.Error("Failed to write to CLI stdin: %v", err)
 		return t.err
 	}
@@ -265,24 +466,46 @@ func (t *SubprocessCLITransport) ReadMessages(ctx context.Context) <-chan types.
 	return t.messages
 }
 
-// buildCommandArgs builds the command line arguments for the CLI subprocess.
-// This is extracted into a separate method to allow for testing.
-func (t *SubprocessCLITransport) buildCommandArgs() []string {
+// buildCommandArgs builds the command line arguments for the CLI subprocess and
+// the environment variables the options imply (see envAdditions), so that both
+// halves of the command can be tested together.
+// It returns a ValidationError if an option cannot be translated into valid flags.
+func (t *SubprocessCLITransport) buildCommandArgs() ([]string, []string, error) {
 	args := []string{
 		"--input-format=stream-json",
 		"--output-format=stream-json",
 		"--verbose",
 	}
 
+	// Flags are passed through the profile of the CLI, which may rename them,
+	// move them to the environment, or reject options the CLI lacks
+	profile := t.profile
+	if profile == nil {
+		profile = profileV2
+	}
+	var profileEnv []string
+	var profileErr error
+	add := func(flag string, values ...string) {
+		flagArgs, flagEnv, err := profile.translate(flag, values...)
+		if err != nil {
+			if profileErr == nil {
+				profileErr = err
+			}
+			return
+		}
+		args = append(args, flagArgs...)
+		profileEnv = append(profileEnv, flagEnv...)
+	}
+
 	// Add permission prompt tool if specified
 	if t.options != nil && t.options.PermissionPromptToolName != nil {
-		args = append(args, "--permission-prompt-tool", *t.options.PermissionPromptToolName)
+		add("--permission-prompt-tool", *t.options.PermissionPromptToolName)
 		t.logger.Debug("Setting permission prompt tool: %s", *t.options.PermissionPromptToolName)
 	}
 
 	// Add permission mode if specified
 	if t.options != nil && t.options.PermissionMode != nil {
-		args = append(args, "--permission-mode", string(*t.options.PermissionMode))
+		add("--permission-mode", string(*t.options.PermissionMode))
 		t.logger.Debug("Setting permission mode: %s", string(*t.options.PermissionMode))
 	}
 
@@ -291,40 +514,70 @@ func (t *SubprocessCLITransport) buildCommandArgs() []string {
 	if t.options != nil {
 		if t.options.SystemPrompt == nil {
 			// Default to empty system prompt when not specified
-			args = append(args, "--system-prompt", "")
+			add("--system-prompt", "")
 			t.logger.Debug("Setting empty system prompt (default)")
 		} else if promptStr, ok := t.options.SystemPrompt.(string); ok {
 			// Handle string prompt
-			args = append(args, "--system-prompt", promptStr)
+			add("--system-prompt", promptStr)
 			t.logger.Debug("Setting system prompt: %s", promptStr)
-		} else if preset, ok := t.options.SystemPrompt.(types.SystemPromptPreset); ok {
-			// Handle preset case - append to default Claude Code prompt
+		} else if preset, ok := systemPromptPreset(t.options.SystemPrompt); ok {
+			// Handle preset case - no --system-prompt keeps the default Claude Code
+			// prompt, and Append is added to the end of it
+			if err := preset.Validate(); err != nil {
+				return nil, nil, err
+			}
 			if preset.Append != nil {
-				args = append(args, "--append-system-prompt", *preset.Append)
+				add("--append-system-prompt", *preset.Append)
 				t.logger.Debug("Appending to system prompt preset: %s", *preset.Append)
 			}
+		} else {
+			return nil, nil, types.NewValidationError("system_prompt", fmt.Sprintf("must be a string or SystemPromptPreset, got %T", t.options.SystemPrompt))
 		}
 	} else {
 		// No options provided, use empty system prompt
-		args = append(args, "--system-prompt", "")
+		add("--system-prompt", "")
 		t.logger.Debug("Setting empty system prompt (no options)")
 	}
 
 	// Add model if specified
 	if t.options != nil && t.options.Model != nil {
-		args = append(args, "--model", *t.options.Model)
+		add("--model", *t.options.Model)
 		t.logger.Debug("Setting model: %s", *t.options.Model)
 	}
 
+	// Add turn limit if specified
+	if t.options != nil && t.options.MaxTurns != nil {
+		if *t.options.MaxTurns < 0 {
+			return nil, nil, types.NewValidationError("max_turns", fmt.Sprintf("must not be negative, got %d", *t.options.MaxTurns))
+		}
+		add("--max-turns", fmt.Sprintf("%d", *t.options.MaxTurns))
+		t.logger.Debug("Setting max turns: %d", *t.options.MaxTurns)
+	}
+
+	// Add --continue flag to pick up the most recent conversation in the working directory
+	if t.options != nil && t.options.ContinueConversation {
+		if t.resumeSessionID != "" || t.options.Resume != nil {
+			return nil, nil, types.NewValidationError("continue_conversation", "cannot be combined with resume; use one or the other")
+		}
+		add("--continue")
+		t.logger.Debug("Continuing most recent conversation")
+	}
+
+	// Add partial message streaming (delivered as StreamEvent messages)
+	if t.options != nil && t.options.IncludePartialMessages {
+		add("--include-partial-messages")
+		t.logger.Debug("Including partial messages")
+	}
+
 	// Add --resume flag if resuming a conversation
 	if t.resumeSessionID != "" {
-		args = append(args, "--resume", t.resumeSessionID)
+		add("--resume", t.resumeSessionID)
 		t.logger.Debug("Resuming Claude CLI conversation with session ID: %s", t.resumeSessionID)
 	}
 
 	// Add --fork-session flag if forking a resumed session
 	if t.options != nil && t.options.ForkSession {
-		args = append(args, "--fork-session")
+		add("--fork-session")
 		t.logger.Debug("Forking resumed session to new session ID")
 	}
 
@@ -332,35 +585,107 @@ func (t *SubprocessCLITransport) buildCommandArgs() []string {
 	if t.options != nil {
 		// Must set allow flag first (acts as safety switch)
 		if t.options.AllowDangerouslySkipPermissions {
-			args = append(args, "--allow-dangerously-skip-permissions")
+			add("--allow-dangerously-skip-permissions")
 			t.logger.Debug("Allowing permission bypass (safety switch enabled)")
 
 			// Only add skip flag if allow flag is also set
 			if t.options.DangerouslySkipPermissions {
-				args = append(args, "--dangerously-skip-permissions")
+				add("--dangerously-skip-permissions")
 				t.logger.Debug("DANGER: Bypassing all permissions - use only in sandboxed environments!")
 			}
 		}
 	}
 
 	// Add extended thinking token limit if specified
+	// (0 is passed through explicitly and disables extended thinking)
 	if t.options != nil && t.options.MaxThinkingTokens != nil {
-		args = append(args, "--max-thinking-tokens", fmt.Sprintf("%d", *t.options.MaxThinkingTokens))
-		t.logger.Debug("Setting max thinking tokens: %d", *t.options.MaxThinkingTokens)
+		if *t.options.MaxThinkingTokens < 0 {
+			return nil, nil, types.NewValidationError("max_thinking_tokens", fmt.Sprintf("must not be negative, got %d", *t.options.MaxThinkingTokens))
+		}
+		add("--max-thinking-tokens", fmt.Sprintf("%d", *t.options.MaxThinkingTokens))
+		if *t.options.MaxThinkingTokens == 0 {
+			t.logger.Debug("Setting max thinking tokens: 0 (extended thinking disabled)")
+		} else {
+			t.logger.Debug("Setting max thinking tokens: %d", *t.options.MaxThinkingTokens)
+		}
 	}
 
 	// Add budget limit if specified
 	if t.options != nil && t.options.MaxBudgetUSD != nil {
-		args = append(args, "--max-budget-usd", fmt.Sprintf("%.2f", *t.options.MaxBudgetUSD))
+		add("--max-budget-usd", fmt.Sprintf("%.2f", *t.options.MaxBudgetUSD))
 		t.logger.Debug("Setting max budget: $%.2f USD", *t.options.MaxBudgetUSD)
 	}
 
+	// Add settings file, verifying it exists so a typo fails before spawning
+	if t.options != nil && t.options.Settings != nil && *t.options.Settings != "" {
+		settingsPath := *t.options.Settings
+		statPath := settingsPath
+		if !filepath.IsAbs(statPath) && t.cwd != "" {
+			// The CLI resolves relative paths against its working directory
+			statPath = filepath.Join(t.cwd, statPath)
+		}
+		if _, err := os.Stat(statPath); err != nil {
+			return nil, nil, types.NewValidationErrorWithCause("settings", fmt.Sprintf("settings file %s not found", statPath), err)
+		}
+		add("--settings", settingsPath)
+		t.logger.Debug("Using settings file: %s", settingsPath)
+	}
+
+	// Add setting sources (order preserved, duplicates dropped)
+	if t.options != nil && len(t.options.SettingSources) > 0 {
+		seen := make(map[types.SettingSource]bool, len(t.options.SettingSources))
+		sources := make([]string, 0, len(t.options.SettingSources))
+		for _, source := range t.options.SettingSources {
+			if !source.IsValid() {
+				return nil, nil, types.NewValidationError("setting_sources", fmt.Sprintf("unknown setting source %q (want user, project, or local)", source))
+			}
+			if seen[source] {
+				continue
+			}
+			seen[source] = true
+			sources = append(sources, string(source))
+		}
+		add("--setting-sources", strings.Join(sources, ","))
+		t.logger.Debug("Setting sources: %s", strings.Join(sources, ","))
+	}
+
+	// Add extra directories Claude may access
+	if t.options != nil {
+		for _, dir := range t.options.AddDirs {
+			resolved, err := resolvePath(dir, t.cwd)
+			if err == nil {
+				err = checkDir(resolved)
+			} else {
+				resolved = dir
+			}
+			if err != nil {
+				if t.options.SkipMissingAddDirs {
+					t.logger.Warning("Skipping additional directory %s: %v", resolved, err)
+					continue
+				}
+				return nil, nil, types.NewValidationErrorWithCause("add_dirs", fmt.Sprintf("directory %s is not accessible", resolved), err)
+			}
+			dir = resolved
+			add("--add-dir", dir)
+			t.logger.Debug("Adding directory: %s", dir)
+		}
+	}
+
 	// Add plugin directories
 	if t.options != nil && len(t.options.Plugins) > 0 {
 		for _, plugin := range t.options.Plugins {
 			if plugin.Type == "local" {
-				args = append(args, "--plugin-dir", plugin.Path)
-				t.logger.Debug("Adding plugin directory: %s", plugin.Path)
+				pluginDir, err := resolvePath(plugin.Path, t.cwd)
+				if err == nil {
+					err = checkDir(pluginDir)
+				} else {
+					pluginDir = plugin.Path
+				}
+				if err != nil {
+					return nil, nil, types.NewValidationErrorWithCause("plugins", fmt.Sprintf("plugin directory %s not found", pluginDir), err)
+				}
+				add("--plugin-dir", pluginDir)
+				t.logger.Debug("Adding plugin directory: %s", pluginDir)
 			} else {
 				// This shouldn't happen if NewPluginConfig is used, but handle it anyway
 				t.logger.Warning("Skipping unsupported plugin type: %s", plugin.Type)
@@ -368,7 +693,52 @@ func (t *SubprocessCLITransport) buildCommandArgs() []string {
 		}
 	}
 
-	return args
+	if profileErr != nil {
+		return nil, nil, profileErr
+	}
+
+	// Add extra flags the SDK doesn't model, sorted by name for deterministic output
+	if t.options != nil && len(t.options.ExtraArgs) > 0 {
+		flags := make([]string, 0, len(t.options.ExtraArgs))
+		for flag := range t.options.ExtraArgs {
+			if flag == "" || strings.HasPrefix(flag, "-") {
+				return nil, nil, types.NewValidationError("extra_args", fmt.Sprintf("flag name %q must be non-empty and given without leading dashes", flag))
+			}
+			flags = append(flags, flag)
+		}
+		sort.Strings(flags)
+
+		for _, flag := range flags {
+			if value := t.options.ExtraArgs[flag]; value != nil {
+				args = append(args, "--"+flag, *value)
+				t.logger.Debug("Adding extra flag: --%s %s", flag, *value)
+			} else {
+				args = append(args, "--"+flag)
+				t.logger.Debug("Adding extra flag: --%s", flag)
+			}
+		}
+	}
+
+	// Validate the environment before a map MCP config is written to a temp file
+	env, err := t.envAdditions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Add MCP server configuration last, since a map config is written to a temp file
+	if t.options != nil {
+		mcpConfig, err := t.mcpConfigArg()
+		if err != nil {
+			return nil, nil, err
+		}
+		if mcpConfig != "" {
+			args = append(args, "--mcp-config", mcpConfig)
+			t.logger.Debug("Using MCP config: %s", mcpConfig)
+		}
+	}
+
+	// Flags moved to the environment come first, so custom variables override them
+	return args, append(profileEnv, env...), nil
 }
 
 // Close terminates the subprocess and cleans up all resources.
@@ -377,12 +747,15 @@ func (t *SubprocessCLITransport) Close(ctx context.Context) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	defer t.removeMcpConfigFile()
+
 	if t.cmd == nil {
 		return nil // Not connected
 	}
 
 	t.logger.Debug("Closing CLI subprocess...")
 	t.ready = false
+	t.reason = ReadinessClosed
 
 	// Cancel the context to stop goroutines
 	if t.cancel != nil {
@@ -399,7 +772,7 @@ func (t *SubprocessCLITransport) Close(ctx context.Context) error {
 	// Wait for process to exit (with context timeout)
 	done := make(chan error, 1)
 	go func() {
-		done <- t.cmd.Wait()
+		done <- t.wait()
 	}()
 
 	select {
@@ -409,23 +782,91 @@ func (t *SubprocessCLITransport) Close(ctx context.Context) error {
 			_ = t.cmd.Process.Kill()
 		}
 		<-done // Wait for Wait() to return
-		return types.NewProcessError("subprocess did not exit gracefully, killed")
+		return t.tagged(types.NewProcessError("subprocess did not exit gracefully, killed"))
 
 	case err := <-done:
 		// Process exited
 		if err != nil {
 			if exitErr, ok := err.(*exec.ExitError); ok {
-				return types.NewProcessErrorWithCode(
+				return t.tagged(types.NewProcessErrorWithCode(
 					"subprocess exited with error",
 					exitErr.ExitCode(),
-				)
+				))
 			}
-			return types.NewProcessErrorWithCause("subprocess exited with error", err)
+			return t.tagged(types.NewProcessErrorWithCause("subprocess exited with error", err))
 		}
 		return nil
 	}
 }
 
+// wait reaps the subprocess, returning the result of its single Wait to
+// every caller.
+func (t *SubprocessCLITransport) wait() error {
+	t.waitOnce.Do(func() {
+		t.waitErr = t.cmd.Wait()
+	})
+	return t.waitErr
+}
+
+// WaitExit waits for the subprocess to exit after its output has ended, and
+// reports how it ended: nil for a zero exit status, otherwise a
+// *types.ProcessError with the exit code, or ctx's error if ctx ends first.
+// Call it once the messages channel has closed on its own; the stderr reader
+// is drained first, since reaping closes its pipe.
+func (t *SubprocessCLITransport) WaitExit(ctx context.Context) error {
+	t.mu.Lock()
+	cmd, stderrDone := t.cmd, t.stderrDone
+	t.mu.Unlock()
+	if cmd == nil {
+		return nil
+	}
+
+	select {
+	case <-stderrDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- t.wait()
+	}()
+	select {
+	case err := <-done:
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &exitErr) && exitErr.ExitCode() < 0:
+			// Killed by a signal; the state names it, e.g. "signal: killed"
+			return t.tagged(types.NewProcessErrorWithCode(fmt.Sprintf("CLI process terminated (%s)", exitErr.ProcessState), exitErr.ExitCode()))
+		case errors.As(err, &exitErr):
+			return t.tagged(types.NewProcessErrorWithCode("CLI process exited unexpectedly", exitErr.ExitCode()))
+		default:
+			return t.tagged(types.NewProcessErrorWithCause("CLI process exited unexpectedly", err))
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tagged records the connection in an error created by the transport, from
+// the "conn" field of its logger (see types.WithConnectionID).
+func (t *SubprocessCLITransport) tagged(err error) error {
+	if t.logger == nil {
+		return err
+	}
+	return types.WithConnectionID(err, t.logger.Field("conn"))
+}
+
+// tempDir returns the directory for files written while connected: the
+// TempDir option, else os.TempDir.
+func (t *SubprocessCLITransport) tempDir() string {
+	if t.options != nil && t.options.TempDir != nil {
+		return *t.options.TempDir
+	}
+	return os.TempDir()
+}
+
 // OnError stores an error that occurred during transport operation.
 // This allows errors from the reading loop to be retrieved later.
 func (t *SubprocessCLITransport) OnError(err error) {
@@ -445,6 +886,27 @@ func (t *SubprocessCLITransport) IsReady() bool {
 	return t.ready
 }
 
+// ReadinessReason explains the current readiness (see ReadinessReason).
+func (t *SubprocessCLITransport) ReadinessReason() ReadinessReason {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.reason
+}
+
+// markNotReady records that the transport stopped being ready for reason. A
+// transport that is already not ready keeps its first reason.
+func (t *SubprocessCLITransport) markNotReady(reason ReadinessReason) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.ready {
+		t.ready = false
+		t.reason = reason
+		t.logger.Debug("Transport no longer ready: %s", reason)
+	}
+}
+
 // GetError returns any error that occurred during transport operation.
 // This is useful for checking if an error occurred in the reading loop.
 func (t *SubprocessCLITransport) GetError() error {
@@ -462,50 +924,22 @@ func (t *SubprocessCLITransport) readStderr(ctx context.Context) {
 		return
 	}
 
-	// Determine if file logging is enabled via StderrLogFile option
-	var logFile *os.File
-	if t.options != nil && t.options.StderrLogFile != nil {
-		// Resolve log file path
-		logPath := *t.options.StderrLogFile
-		if logPath == "" {
-			// Use default location
-			homeDir, _ := os.UserHomeDir()
-			logPath = fmt.Sprintf("%s/.claude/agents_server/cli_stderr.log", homeDir)
-		}
-
-		// Create parent directory if it doesn't exist
-		logDir := filepath.Dir(logPath)
-		if err := os.MkdirAll(logDir, 0755); err != nil {
-			fmt.Fprintf(os.Stderr,
-				"[SDK] Failed to create stderr log directory %s: %v\n"+
-					"Stderr file logging disabled. To fix, create directory:\n"+
-					"  mkdir -p %s\n",
-				logDir, err, logDir)
-		} else {
-			// Try to open log file
-			var err error
-			logFile, err = os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-			if err != nil {
-				fmt.Fprintf(os.Stderr,
-					"[SDK] Failed to open stderr log file %s: %v\n"+
-						"Stderr file logging disabled. Possible fixes:\n"+
-						"  1. Ensure directory exists: mkdir -p %s\n"+
-						"  2. Check file permissions: chmod 644 %s\n"+
-						"  3. Use custom path: opts.WithCustomStderrLogFile(\"/path/to/file.log\")\n",
-					logPath, err, logDir, logPath)
-			} else {
-				t.logger.Debug("Stderr file logging enabled: %s", logPath)
-			}
-		}
-	}
-
-	// Ensure cleanup if file was opened
+	// Log stderr to a file if enabled via the StderrLogFile option
+	logFile := t.openStderrLogFile()
 	if logFile != nil {
 		defer func() {
 			_ = logFile.Close()
 		}()
 	}
 
+	// Deliver lines to the stderr callback on its own goroutine; it drains any
+	// queued lines after the reader stops
+	var callback *lineDispatcher
+	if t.options != nil && t.options.Stderr != nil {
+		callback = newLineDispatcher(t.options.Stderr)
+		defer callback.close()
+	}
+
 	reader := NewJSONLineReader(t.stderr)
 	for {
 		select {
@@ -529,9 +963,9 @@ func (t *SubprocessCLITransport) readStderr(ctx context.Context) {
 				_ = logFile.Sync() // Flush to disk immediately
 			}
 
-			// Call stderr callback if configured (for runtime control)
-			if t.options != nil && t.options.Stderr != nil {
-				t.options.Stderr(stderrText)
+			// Hand the line to the stderr callback if configured
+			if callback != nil {
+				callback.dispatch(stderrText)
 			}
 
 			// Parse known error patterns and create typed errors
@@ -540,6 +974,41 @@ func (t *SubprocessCLITransport) readStderr(ctx context.Context) {
 	}
 }
 
+// openStderrLogFile opens the file named by the StderrLogFile option for
+// appending: nil disables file logging, an empty path uses
+// ~/.claude/agents_server/cli_stderr.log, and any other path is used as is.
+// Missing parent directories are created. If the file cannot be opened, a
+// warning is logged and nil is returned; the session continues without it.
+func (t *SubprocessCLITransport) openStderrLogFile() *os.File {
+	if t.options == nil || t.options.StderrLogFile == nil {
+		return nil
+	}
+
+	logPath := *t.options.StderrLogFile
+	if logPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			t.logger.Warning("Stderr file logging disabled: cannot locate home directory for the default log file: %v", err)
+			return nil
+		}
+		logPath = filepath.Join(homeDir, ".claude", "agents_server", "cli_stderr.log")
+	}
+
+	logDir := filepath.Dir(logPath)
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		t.logger.Warning("Stderr file logging disabled: cannot create log directory %s: %v", logDir, err)
+		return nil
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.logger.Warning("Stderr file logging disabled: cannot open %s: %v (use WithCustomStderrLogFile to choose a writable path)", logPath, err)
+		return nil
+	}
+
+	t.logger.Debug("Stderr file logging enabled: %s", logPath)
+	return logFile
+}
+
 // parseStderrError parses stderr text for known error patterns and stores typed errors.
 func (t *SubprocessCLITransport) parseStderrError(stderrText string) {
 	// Check for "No conversation found with session ID:" error
@@ -614,3 +1083,17 @@ func trimWhitespace(s string) string {
 func isWhitespace(r rune) bool {
 	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
 }
+
+// systemPromptPreset returns the preset held by a SystemPrompt option, accepting
+// both the value and pointer forms. A nil pointer holds no preset.
+func systemPromptPreset(prompt interface{}) (types.SystemPromptPreset, bool) {
+	switch p := prompt.(type) {
+	case types.SystemPromptPreset:
+		return p, true
+	case *types.SystemPromptPreset:
+		if p != nil {
+			return *p, true
+		}
+	}
+	return types.SystemPromptPreset{}, false
+}
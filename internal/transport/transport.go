@@ -35,7 +35,22 @@ type Transport interface {
 	// Returns true if the subprocess is running and ready to send/receive messages.
 	IsReady() bool
 
+	// ReadinessReason explains the current readiness: ReadinessReady while
+	// IsReady is true, otherwise why the transport is not ready.
+	ReadinessReason() ReadinessReason
+
 	// GetError returns any error that occurred during transport operation.
 	// This is useful for checking if an error occurred in async operations (like stderr parsing).
 	GetError() error
 }
+
+// ReadinessReason describes why a transport is or is not ready.
+type ReadinessReason string
+
+const (
+	ReadinessNeverConnected ReadinessReason = "never connected" // Connect has not succeeded
+	ReadinessReady          ReadinessReason = "ready"           // Both directions are usable
+	ReadinessStdinBroken    ReadinessReason = "stdin broken"    // A write to the CLI failed
+	ReadinessStdoutClosed   ReadinessReason = "stdout closed"   // The CLI's output ended (EOF or read error)
+	ReadinessClosed         ReadinessReason = "closed"          // Close was called
+)
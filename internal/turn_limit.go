@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// sdkEnforcer is implemented by transports whose CLI cannot honor some flags,
+// which the SDK then enforces itself.
+type sdkEnforcer interface {
+	EnforcedBySDK(flag string) bool
+}
+
+// turnLimitAction tells routeMessage what to do with a message after the
+// turn limiter saw it.
+type turnLimitAction int
+
+const (
+	turnLimitDeliver  turnLimitAction = iota // Deliver the message as usual
+	turnLimitExceeded                        // The message starts a turn over the limit; end the turn instead
+	turnLimitDrop                            // The message belongs to a turn already ended by the limit
+)
+
+// turnLimiter enforces MaxTurns for CLIs that ignore --max-turns. A turn is
+// one model response, counted from the first top-level assistant message after
+// the prompt or after a tool result. It is only touched by the message loop.
+type turnLimiter struct {
+	maxTurns   int
+	turns      int  // Model responses in the current query
+	responding bool // The latest top-level message was an assistant message
+	draining   bool // The limit ended the query; waiting for the CLI's result
+}
+
+// newTurnLimiter returns nil, which never limits, when maxTurns is not positive.
+func newTurnLimiter(maxTurns int) *turnLimiter {
+	if maxTurns <= 0 {
+		return nil
+	}
+	return &turnLimiter{maxTurns: maxTurns}
+}
+
+// observe counts the turns of the current query. Once the limit is exceeded,
+// the rest of the query is dropped up to and including the CLI's result.
+func (l *turnLimiter) observe(msg types.Message) turnLimitAction {
+	if l == nil {
+		return turnLimitDeliver
+	}
+
+	if l.draining {
+		if _, ok := msg.(*types.ResultMessage); ok {
+			l.reset()
+		}
+		return turnLimitDrop
+	}
+
+	switch m := msg.(type) {
+	case *types.AssistantMessage:
+		if m.ParentToolUseID != nil || l.responding {
+			return turnLimitDeliver
+		}
+		l.responding = true
+		l.turns++
+		if l.turns > l.maxTurns {
+			l.draining = true
+			return turnLimitExceeded
+		}
+	case *types.UserMessage:
+		if m.ParentToolUseID == nil {
+			l.responding = false
+		}
+	case *types.ResultMessage:
+		l.reset()
+	}
+	return turnLimitDeliver
+}
+
+func (l *turnLimiter) reset() {
+	l.turns = 0
+	l.responding = false
+	l.draining = false
+}
+
+// result returns the error_max_turns result that ends a query over the limit,
+// like the one the CLI sends when it enforces --max-turns.
+func (l *turnLimiter) result(sessionID string) *types.ResultMessage {
+	text := fmt.Sprintf("Reached maximum number of turns (%d)", l.maxTurns)
+	return &types.ResultMessage{
+		Type:      "result",
+		Subtype:   "error_max_turns",
+		IsError:   true,
+		NumTurns:  l.maxTurns,
+		SessionID: sessionID,
+		Result:    &text,
+		Meta:      &types.ResultMeta{TurnLimitedBySDK: true},
+	}
+}
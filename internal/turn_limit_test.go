@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestTurnLimiter tests that a turn is one model response, that subagent
+// messages do not count, and that a query over the limit is drained up to the
+// CLI's result.
+func TestTurnLimiter(t *testing.T) {
+	if newTurnLimiter(0) != nil {
+		t.Error("a limit of 0 should disable the limiter")
+	}
+
+	parent := "task-1"
+	assistant := &types.AssistantMessage{Type: "assistant"}
+	subagent := &types.AssistantMessage{Type: "assistant", ParentToolUseID: &parent}
+	toolResult := &types.UserMessage{Type: "user", Content: []types.ContentBlock{&types.ToolResultBlock{Type: "tool_result", ToolUseID: "t1"}}}
+	result := &types.ResultMessage{Type: "result", Subtype: "success"}
+
+	limiter := newTurnLimiter(2)
+	steps := []struct {
+		msg  types.Message
+		want turnLimitAction
+	}{
+		{assistant, turnLimitDeliver}, // Turn 1
+		{assistant, turnLimitDeliver}, // Same response, split in two messages
+		{toolResult, turnLimitDeliver},
+		{subagent, turnLimitDeliver},
+		{assistant, turnLimitDeliver}, // Turn 2
+		{toolResult, turnLimitDeliver},
+		{assistant, turnLimitExceeded}, // Turn 3
+		{toolResult, turnLimitDrop},
+		{assistant, turnLimitDrop},
+		{result, turnLimitDrop},       // The CLI's result of the limited query
+		{assistant, turnLimitDeliver}, // The next query starts over
+		{toolResult, turnLimitDeliver},
+		{assistant, turnLimitDeliver},
+		{result, turnLimitDeliver},
+	}
+	for i, step := range steps {
+		if got := limiter.observe(step.msg); got != step.want {
+			t.Errorf("step %d (%s): observe() = %d, want %d", i, step.msg.GetMessageType(), got, step.want)
+		}
+	}
+
+	synthesized := limiter.result("s-1")
+	if synthesized.Subtype != "error_max_turns" || !synthesized.IsError || synthesized.NumTurns != 2 ||
+		synthesized.SessionID != "s-1" || !synthesized.Meta.TurnLimitedBySDK {
+		t.Errorf("result() = %+v", synthesized)
+	}
+}
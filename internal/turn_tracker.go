@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TurnTracker accumulates the assistant output of the current turn so that a
+// failed turn can report what was produced before the failure.
+//
+// Feed every message of a turn to Observe, then call Finish with the turn's
+// ResultMessage, or Incomplete if the stream ended without one. Both reset the
+// tracker for the next turn. A TurnTracker is not safe for concurrent use.
+type TurnTracker struct {
+	text        strings.Builder
+	lastToolUse *types.ToolUseBlock
+}
+
+// NewTurnTracker creates an empty TurnTracker.
+func NewTurnTracker() *TurnTracker {
+	return &TurnTracker{}
+}
+
+// Observe records the assistant text and tool uses of a message.
+func (t *TurnTracker) Observe(msg types.Message) {
+	assistant, ok := msg.(*types.AssistantMessage)
+	if !ok {
+		return
+	}
+	for _, block := range assistant.Content {
+		switch b := block.(type) {
+		case *types.TextBlock:
+			t.text.WriteString(b.Text)
+		case *types.ToolUseBlock:
+			t.lastToolUse = b
+		}
+	}
+}
+
+// Context returns the output recorded for the current turn.
+func (t *TurnTracker) Context() *types.ErrorContext {
+	return &types.ErrorContext{
+		AssistantText: t.text.String(),
+		LastToolUse:   t.lastToolUse,
+	}
+}
+
+// Finish ends the turn. It returns a *types.TurnInterruptedError when the
+// result is marked as interrupted by the user, a *types.ResultError when it is
+// an error result, and nil otherwise; errors carry the turn's context.
+func (t *TurnTracker) Finish(result *types.ResultMessage) error {
+	defer t.Reset()
+
+	if result != nil && result.IsInterrupted() {
+		err := types.NewTurnInterruptedError(result)
+		err.Context = t.Context()
+		if resultErr, ok := err.Cause.(*types.ResultError); ok {
+			resultErr.Context = err.Context
+		}
+		return err
+	}
+	if !IsErrorResult(result) {
+		return nil
+	}
+	err := types.NewResultError(result)
+	err.Context = t.Context()
+	return err
+}
+
+// Incomplete ends a turn whose stream stopped before its ResultMessage and
+// returns a *types.IncompleteStreamError carrying the turn's context.
+func (t *TurnTracker) Incomplete(message string, cause error) error {
+	defer t.Reset()
+
+	err := types.NewIncompleteStreamErrorWithCause(message, cause)
+	err.Context = t.Context()
+	return err
+}
+
+// Reset discards the output recorded for the current turn.
+func (t *TurnTracker) Reset() {
+	t.text.Reset()
+	t.lastToolUse = nil
+}
+
+// IsErrorResult reports whether a result ended its turn in failure.
+func IsErrorResult(result *types.ResultMessage) bool {
+	return result != nil && (result.IsError || strings.HasPrefix(result.Subtype, "error"))
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// failedToolLoop is a turn that fails with error_max_turns in the middle of a tool loop.
+func failedToolLoop() []types.Message {
+	failure := "Reached maximum number of turns"
+	return []types.Message{
+		&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.TextBlock{Type: "text", Text: "Running the tests. "},
+			&types.ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Bash", Input: map[string]interface{}{"command": "go test ./..."}},
+		}},
+		&types.UserMessage{Type: "user", Content: []types.ContentBlock{
+			&types.ToolResultBlock{Type: "tool_result", ToolUseID: "t1"},
+		}},
+		&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.TextBlock{Type: "text", Text: "Two failures; reading the file."},
+			&types.ToolUseBlock{Type: "tool_use", ID: "t2", Name: "Read", Input: map[string]interface{}{"file_path": "query.go"}},
+		}},
+		&types.ResultMessage{Type: "result", Subtype: "error_max_turns", IsError: true, Result: &failure, SessionID: "s-1"},
+	}
+}
+
+func TestTurnTrackerErrorResult(t *testing.T) {
+	tracker := NewTurnTracker()
+	messages := failedToolLoop()
+	for _, msg := range messages {
+		tracker.Observe(msg)
+	}
+
+	err := tracker.Finish(messages[len(messages)-1].(*types.ResultMessage))
+	var resultErr *types.ResultError
+	if !errors.As(err, &resultErr) {
+		t.Fatalf("Finish() = %v, want *types.ResultError", err)
+	}
+	if resultErr.Subtype != "error_max_turns" || resultErr.SessionID != "s-1" {
+		t.Errorf("unexpected result error: %+v", resultErr)
+	}
+	if resultErr.Context == nil {
+		t.Fatal("expected error context")
+	}
+	if got := resultErr.Context.AssistantText; got != "Running the tests. Two failures; reading the file." {
+		t.Errorf("AssistantText = %q", got)
+	}
+	if tool := resultErr.Context.LastToolUse; tool == nil || tool.Name != "Read" || tool.ID != "t2" {
+		t.Errorf("LastToolUse = %+v, want the Read call", tool)
+	}
+
+	// The next turn starts from scratch
+	if ctx := tracker.Context(); ctx.AssistantText != "" || ctx.LastToolUse != nil {
+		t.Errorf("tracker should reset after Finish, got %+v", ctx)
+	}
+}
+
+func TestTurnTrackerSuccessAndIncomplete(t *testing.T) {
+	tracker := NewTurnTracker()
+	tracker.Observe(&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+		&types.TextBlock{Type: "text", Text: "done"},
+	}})
+	if err := tracker.Finish(&types.ResultMessage{Type: "result", Subtype: "success"}); err != nil {
+		t.Errorf("Finish() on success = %v, want nil", err)
+	}
+
+	tracker.Observe(&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+		&types.ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Write"},
+	}})
+	err := tracker.Incomplete("stream ended", context.Canceled)
+	var incomplete *types.IncompleteStreamError
+	if !errors.As(err, &incomplete) {
+		t.Fatalf("Incomplete() = %v, want *types.IncompleteStreamError", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Error("expected the cause to be unwrappable")
+	}
+	if incomplete.Context.AssistantText != "" || incomplete.Context.LastToolUse.Name != "Write" {
+		t.Errorf("unexpected context: %+v", incomplete.Context)
+	}
+}
+
+func TestIsErrorResult(t *testing.T) {
+	tests := []struct {
+		result *types.ResultMessage
+		want   bool
+	}{
+		{nil, false},
+		{&types.ResultMessage{Subtype: "success"}, false},
+		{&types.ResultMessage{Subtype: "success", IsError: true}, true},
+		{&types.ResultMessage{Subtype: "error_during_execution"}, true},
+	}
+	for _, tt := range tests {
+		if got := IsErrorResult(tt.result); got != tt.want {
+			t.Errorf("IsErrorResult(%+v) = %v, want %v", tt.result, got, tt.want)
+		}
+	}
+}
+
+// TestBudgetExceededErrorContext tests that the budget error carries the output of the costly turn.
+func TestBudgetExceededErrorContext(t *testing.T) {
+	ctx := context.Background()
+	transport := newMockTransport()
+	query := NewQuery(ctx, transport, types.NewClaudeAgentOptions().WithMaxBudgetUSD(0.01), log.NewLogger(false), false)
+	if err := query.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() {
+		_ = query.Stop(ctx)
+	}()
+
+	cost := 0.02
+	transport.sendMessage(&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+		&types.TextBlock{Type: "text", Text: "Expensive answer"},
+	}})
+	transport.sendMessage(&types.ResultMessage{Type: "result", Subtype: "success", TotalCostUSD: &cost})
+
+	messages := query.GetMessages(ctx)
+	deadline := time.After(2 * time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-messages:
+		case <-deadline:
+			t.Fatal("timeout waiting for message channel to close")
+		}
+	}
+
+	var budgetErr *types.BudgetExceededError
+	if !errors.As(query.Err(), &budgetErr) {
+		t.Fatalf("Err() = %v, want BudgetExceededError", query.Err())
+	}
+	if budgetErr.Context == nil || budgetErr.Context.AssistantText != "Expensive answer" {
+		t.Errorf("Context = %+v, want the turn's assistant text", budgetErr.Context)
+	}
+}
@@ -0,0 +1,57 @@
+package internal
+
+import "encoding/json"
+
+// Outgoing messages are built from structs so that identical logical messages
+// always marshal to identical bytes with a stable field order. Map-valued
+// payloads are left to encoding/json, which writes map keys in sorted order.
+
+// controlRequestEnvelope is a control_request sent to the CLI.
+type controlRequestEnvelope struct {
+	Type      string                 `json:"type"`
+	RequestID string                 `json:"request_id"`
+	Request   map[string]interface{} `json:"request"`
+}
+
+// controlResponseEnvelope is a control_response sent to the CLI.
+type controlResponseEnvelope struct {
+	Type     string      `json:"type"`
+	Response interface{} `json:"response"`
+}
+
+// controlSuccessBody is the response of a successful control_response.
+type controlSuccessBody struct {
+	Subtype   string                 `json:"subtype"`
+	RequestID string                 `json:"request_id"`
+	Response  map[string]interface{} `json:"response"`
+}
+
+// controlErrorBody is the response of a failed control_response.
+type controlErrorBody struct {
+	Subtype   string `json:"subtype"`
+	RequestID string `json:"request_id"`
+	Error     string `json:"error"`
+}
+
+// userMessageEnvelope is a user turn sent to the CLI in stream-json input format.
+type userMessageEnvelope struct {
+	Type            string          `json:"type"`
+	Message         userMessageBody `json:"message"`
+	ParentToolUseID *string         `json:"parent_tool_use_id"`
+	SessionID       string          `json:"session_id"`
+}
+
+type userMessageBody struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // A string or a slice of content blocks
+}
+
+// MarshalUserMessage encodes a user turn with the given content (a prompt
+// string or content blocks) for the given session.
+func MarshalUserMessage(content interface{}, sessionID string) ([]byte, error) {
+	return json.Marshal(userMessageEnvelope{
+		Type:      "user",
+		Message:   userMessageBody{Role: "user", Content: content},
+		SessionID: sessionID,
+	})
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Golden tests for outgoing payloads. Each payload is produced twice and must
+// match the golden bytes both times.
+
+func TestMarshalUserMessage_Golden(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   interface{}
+		sessionID string
+		golden    string
+	}{
+		{
+			name:      "prompt",
+			content:   "What is 2 + 2?",
+			sessionID: "default",
+			golden:    `{"type":"user","message":{"role":"user","content":"What is 2 + 2?"},"parent_tool_use_id":null,"session_id":"default"}`,
+		},
+		{
+			name: "content blocks",
+			content: []map[string]interface{}{
+				{"type": "text", "text": "Describe this image."},
+				{"type": "image", "source": map[string]interface{}{"type": "base64", "media_type": "image/png", "data": "iVBOR"}},
+			},
+			sessionID: "s-1",
+			golden:    `{"type":"user","message":{"role":"user","content":[{"text":"Describe this image.","type":"text"},{"source":{"data":"iVBOR","media_type":"image/png","type":"base64"},"type":"image"}]},"parent_tool_use_id":null,"session_id":"s-1"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for run := 1; run <= 2; run++ {
+				data, err := MarshalUserMessage(tt.content, tt.sessionID)
+				if err != nil {
+					t.Fatalf("run %d: MarshalUserMessage failed: %v", run, err)
+				}
+				if string(data) != tt.golden {
+					t.Errorf("run %d:\n got %s\nwant %s", run, data, tt.golden)
+				}
+			}
+		})
+	}
+}
+
+func TestControlResponses_Golden(t *testing.T) {
+	tests := []struct {
+		name   string
+		send   func(q *Query)
+		golden string
+	}{
+		{
+			name: "success",
+			send: func(q *Query) {
+				q.sendSuccessResponse("req_7", map[string]interface{}{"behavior": "allow", "updatedInput": map[string]interface{}{"z": 1, "a": 2}})
+			},
+			golden: `{"type":"control_response","response":{"subtype":"success","request_id":"req_7","response":{"behavior":"allow","updatedInput":{"a":2,"z":1}}}}`,
+		},
+		{
+			name:   "error",
+			send:   func(q *Query) { q.sendErrorResponse("req_8", "unknown hook") },
+			golden: `{"type":"control_response","response":{"subtype":"error","request_id":"req_8","error":"unknown hook"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for run := 1; run <= 2; run++ {
+				transport := newMockTransport()
+				tt.send(NewQuery(context.Background(), transport, nil, log.NewLogger(false), true))
+
+				written := transport.getWrittenData()
+				if len(written) != 1 || written[0] != tt.golden {
+					t.Errorf("run %d:\n got %v\nwant %s", run, written, tt.golden)
+				}
+			}
+		})
+	}
+}
+
+func TestInitializeRequest_Golden(t *testing.T) {
+	noop := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		return nil, nil
+	}
+	bash := "Bash"
+	golden := `{"type":"control_request","request_id":"req_1","request":{"hooks":{` +
+		`"PostToolUse":[{"hookCallbackIds":["hook_1"]}],` +
+		`"PreCompact":[{"hookCallbackIds":["hook_2"]}],` +
+		`"PreToolUse":[{"hookCallbackIds":["hook_3","hook_4"],"matcher":"Bash|bash_tool"}],` +
+		`"Stop":[{"hookCallbackIds":["hook_5"]}],` +
+		`"UserPromptSubmit":[{"hookCallbackIds":["hook_6"]}]` +
+		`},"subtype":"initialize"}}`
+
+	for run := 1; run <= 2; run++ {
+		opts := types.NewClaudeAgentOptions().
+			WithHook(types.HookEventUserPromptSubmit, types.HookMatcher{Hooks: []types.HookCallbackFunc{noop}}).
+			WithHook(types.HookEventStop, types.HookMatcher{Hooks: []types.HookCallbackFunc{noop}}).
+			WithHook(types.HookEventPreToolUse, types.HookMatcher{Matcher: &bash, Hooks: []types.HookCallbackFunc{noop, noop}}).
+			WithHook(types.HookEventPreCompact, types.HookMatcher{Hooks: []types.HookCallbackFunc{noop}}).
+			WithHook(types.HookEventPostToolUse, types.HookMatcher{Hooks: []types.HookCallbackFunc{noop}})
+
+		transport := newMockTransport()
+		query := NewQuery(context.Background(), transport, opts, log.NewLogger(false), true)
+
+		// Nothing answers the request; only the bytes written matter here
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, _ = query.Initialize(ctx)
+		cancel()
+
+		written := transport.getWrittenData()
+		if len(written) != 1 || written[0] != golden {
+			t.Errorf("run %d:\n got %v\nwant %s", run, written, golden)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package claude
+
+import (
+	"context"
+	"iter"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// QuerySeq is Query as an iterator for range-over-func loops. Each message is
+// yielded with a nil error. Errors are yielded with a nil message instead:
+// failing to start, a *types.ErrorMessage in the stream (which is unwrapped),
+// or ctx ending before the stream does.
+//
+// Breaking out of the loop terminates the CLI and waits for it to be cleaned
+// up, so no drain or cancellation is needed. Each iteration runs a new query.
+//
+// Example:
+//
+//	for msg, err := range claude.QuerySeq(ctx, "What is 2+2?", opts) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    if result, ok := msg.(*types.ResultMessage); ok {
+//	        fmt.Println(*result.Result)
+//	    }
+//	}
+func QuerySeq(ctx context.Context, prompt string, options *types.ClaudeAgentOptions) iter.Seq2[types.Message, error] {
+	return func(yield func(types.Message, error) bool) {
+		queryCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		messages, err := Query(queryCtx, prompt, options)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		// On an early break the CLI is terminated and the stream closes once
+		// the query has cleaned up
+		defer func() {
+			cancel()
+			for range messages {
+			}
+		}()
+
+		for msg := range messages {
+			if !yieldMessage(yield, msg) {
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			yield(nil, ctx.Err())
+		}
+	}
+}
+
+// ResponseSeq is ReceiveResponse as an iterator for range-over-func loops,
+// yielding the messages of the current turn up to its ResultMessage, each
+// with a nil error. Errors are yielded with a nil message instead: the errors
+// of ReceiveResponseE, a *types.ErrorMessage in the stream (which is
+// unwrapped), and, when the turn ends without its result, ctx.Err(), the
+// error reported by Err, or else a *types.IncompleteStreamError. An error
+// ResultMessage is yielded as a message.
+//
+// Breaking out of the loop before the result interrupts the turn and
+// discards the rest of it, as Run does, so the client can take the next query
+// without DrainResponse. Cleanup is bounded and proceeds even after ctx is
+// cancelled.
+//
+// Example:
+//
+//	if err := client.Query(ctx, "Find the failing test"); err != nil {
+//	    return err
+//	}
+//	for msg, err := range client.ResponseSeq(ctx) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    if found(msg) {
+//	        break // The rest of the turn is interrupted and discarded
+//	    }
+//	}
+func (c *Client) ResponseSeq(ctx context.Context) iter.Seq2[types.Message, error] {
+	return func(yield func(types.Message, error) bool) {
+		messages, err := c.ReceiveResponseE(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		tracker := internal.NewTurnTracker()
+		var delivered error // Last error yielded from the stream
+		for msg := range messages {
+			tracker.Observe(msg)
+			if errMsg, ok := msg.(*types.ErrorMessage); ok {
+				delivered = errMsg.Err
+			}
+			_, isResult := msg.(*types.ResultMessage)
+			if !yieldMessage(yield, msg) {
+				if !isResult {
+					c.abandonTurn(ctx, messages)
+				}
+				return
+			}
+			if isResult {
+				return
+			}
+		}
+
+		if ctx.Err() != nil {
+			c.abandonTurn(ctx, messages)
+			yield(nil, ctx.Err())
+			return
+		}
+		err = c.Err()
+		if err == nil {
+			err = tracker.Incomplete("connection closed before the turn completed", nil)
+		}
+		if err != delivered {
+			yield(nil, err)
+		}
+	}
+}
+
+// yieldMessage yields msg, or the error of an ErrorMessage, reporting whether
+// the consumer wants more.
+func yieldMessage(yield func(types.Message, error) bool, msg types.Message) bool {
+	if errMsg, ok := msg.(*types.ErrorMessage); ok {
+		return yield(nil, errMsg.Err)
+	}
+	return yield(msg, nil)
+}
@@ -0,0 +1,164 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestClient_ResponseSeq tests consuming a turn with range-over-func: in full,
+// with an early break that interrupts and discards the turn, and with errors
+// delivered through the second value.
+func TestClient_ResponseSeq(t *testing.T) {
+	text := &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: "working"}}}
+	result := &types.ResultMessage{Type: "result", Subtype: "success"}
+	connect := func(t *testing.T, ctx context.Context) (*Client, *mockTransport) {
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			if subtype == "interrupt" {
+				mock.send(&types.ResultMessage{Type: "result", Subtype: "error_during_execution", IsError: true})
+			}
+			return map[string]interface{}{}, nil
+		}
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Query(ctx, "hi"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		return client, mock
+	}
+
+	t.Run("full consumption", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx)
+		mock.send(text)
+		mock.send(result)
+
+		var received []types.Message
+		for msg, err := range client.ResponseSeq(ctx) {
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			received = append(received, msg)
+		}
+		if len(received) != 2 || received[1] != result {
+			t.Errorf("received %v, want the assistant message and the result", received)
+		}
+	})
+
+	t.Run("early break", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx)
+		mock.send(text)
+
+		for msg, err := range client.ResponseSeq(ctx) {
+			if err != nil || msg != text {
+				t.Fatalf("got (%v, %v), want the assistant message", msg, err)
+			}
+			break
+		}
+		if !slices.Contains(mock.writtenTypes(), "interrupt") {
+			t.Errorf("written = %v, want an interrupt", mock.writtenTypes())
+		}
+		if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrNoPendingTurn) {
+			t.Errorf("ReceiveResponseE after the break = %v, want ErrNoPendingTurn", err)
+		}
+
+		// The next turn starts clean
+		if err := client.Query(ctx, "next"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		mock.send(result)
+		for msg, err := range client.ResponseSeq(ctx) {
+			if err != nil || msg != result {
+				t.Errorf("got (%v, %v), want the next turn's result", msg, err)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client, mock := connect(t, ctx)
+		malformed := types.NewJSONDecodeErrorWithRaw("bad line", "{")
+		mock.send(types.NewErrorMessage(malformed))
+		mock.send(text)
+		mock.mu.Lock()
+		close(mock.messages)
+		mock.closed = true
+		mock.mu.Unlock()
+
+		var messages []types.Message
+		var errs []error
+		for msg, err := range client.ResponseSeq(ctx) {
+			if err != nil {
+				if msg != nil {
+					t.Errorf("error %v yielded with message %v", err, msg)
+				}
+				errs = append(errs, err)
+				continue
+			}
+			messages = append(messages, msg)
+		}
+		if len(messages) != 1 || len(errs) != 2 {
+			t.Fatalf("got messages %v and errors %v, want one of the first and two of the second", messages, errs)
+		}
+		if !types.IsJSONDecodeError(errs[0]) || !types.IsCLIConnectionError(errs[1]) {
+			t.Errorf("errors = %v, want the malformed line and then the lost connection", errs)
+		}
+
+		unconnected := newMockClient(t, nil, newMockTransport())
+		for msg, err := range unconnected.ResponseSeq(ctx) {
+			if msg != nil || !types.IsCLIConnectionError(err) {
+				t.Errorf("got (%v, %v) before Connect, want a CLIConnectionError", msg, err)
+			}
+		}
+	})
+}
+
+// TestQuerySeq tests one-shot queries consumed with range-over-func.
+func TestQuerySeq(t *testing.T) {
+	ctx := testContext(t, 10*time.Second)
+	opts := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, brokenCLI))
+
+	var kinds []string
+	for msg, err := range QuerySeq(ctx, "garbled", opts) {
+		if err != nil {
+			kinds = append(kinds, "error")
+			if !types.IsJSONDecodeError(err) {
+				t.Errorf("error = %v, want a JSONDecodeError", err)
+			}
+			continue
+		}
+		kinds = append(kinds, msg.GetMessageType())
+	}
+	if want := []string{"error", "assistant", "result"}; !slices.Equal(kinds, want) {
+		t.Errorf("yielded %v, want %v", kinds, want)
+	}
+
+	for msg, err := range QuerySeq(ctx, "garbled", opts) {
+		if err == nil {
+			t.Errorf("got %v before the malformed line", msg)
+		}
+		break
+	}
+
+	var last error
+	for _, err := range QuerySeq(ctx, "crash", opts) {
+		last = err
+	}
+	if !types.IsCLIConnectionError(last) {
+		t.Errorf("last error = %v, want a CLIConnectionError", last)
+	}
+
+	for _, err := range QuerySeq(ctx, "", opts) {
+		if err == nil {
+			t.Error("empty prompt yielded no error")
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package claude
+
+import (
+	"context"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// settleLateMessages takes the messages waiting on the stream when the last
+// pending turn has completed and no consumer is receiving. The CLI sent them
+// after that turn's ResultMessage (some versions follow it with telemetry or
+// session info), so they belong to that turn and must not open the response
+// of the query about to be written. They go to subscribers and to
+// OnLateMessage.
+//
+// Messages the CLI sends later, until the next turn's first message, are
+// settled by the consumer as they arrive (see takeLateMessage). Multiplexed
+// connections (see QueryWithSession) are left to their router.
+func (c *Client) settleLateMessages() {
+	c.mu.Lock()
+	var late []types.Message
+	if c.connected && c.query != nil && c.turnFinished && !c.receiving && c.sessions == nil {
+		messages := c.messages(context.Background())
+	drain:
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					break drain
+				}
+				late = append(late, msg)
+			default:
+				break drain
+			}
+		}
+		c.settling = true
+	}
+	c.turnFinished = false
+	c.mu.Unlock()
+	if len(late) == 0 {
+		return
+	}
+
+	c.logger.Debug("Attributed %d message(s) received after the last result to the finished turn", len(late))
+	for _, msg := range late {
+		c.deliverLateMessage(msg)
+	}
+}
+
+// takeLateMessage reports whether msg, read by a consumer, belongs to the
+// turn finished before the current query was sent, and if so delivers it as a
+// late message. System messages are late until the next turn's first message:
+// any other message, its init message or a reconnection notice.
+func (c *Client) takeLateMessage(msg types.Message) bool {
+	c.mu.Lock()
+	if !c.settling {
+		c.mu.Unlock()
+		return false
+	}
+	system, ok := msg.(*types.SystemMessage)
+	late := ok && !system.IsInit() && system.Subtype != types.SystemSubtypeReconnected
+	c.settling = late
+	c.mu.Unlock()
+	if !late {
+		return false
+	}
+
+	c.logger.Debug("Attributed a %s message received after the query was sent to the finished turn", system.Subtype)
+	c.deliverLateMessage(msg)
+	return true
+}
+
+// deliverLateMessage hands a late message to subscribers and to OnLateMessage,
+// isolating the consumer from a panicking callback.
+func (c *Client) deliverLateMessage(msg types.Message) {
+	c.broadcast(msg)
+	if c.options.OnLateMessage != nil {
+		c.callListener(func() { c.options.OnLateMessage(msg) })
+	}
+}
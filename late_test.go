@@ -0,0 +1,189 @@
+package claude
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestClient_LateMessages tests that messages the CLI sends after a turn's
+// result are attributed to that turn instead of opening the next response,
+// unless a ReceiveMessages consumer is reading across turns.
+func TestClient_LateMessages(t *testing.T) {
+	assistant := func(text string) types.Message {
+		return &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: text}}}
+	}
+	result := func() types.Message { return &types.ResultMessage{Type: "result", Subtype: "success"} }
+	telemetry := &types.SystemMessage{Type: "system", Subtype: "telemetry"}
+	sessionInfo := &types.SystemMessage{Type: "system", Subtype: "session_info"}
+
+	// buffered waits until the client's stream holds n messages read from the
+	// transport, so they are there before the next query
+	buffered := func(t *testing.T, client *Client, n int) {
+		t.Helper()
+		messages := client.query.GetMessages(context.Background())
+		for deadline := time.Now().Add(5 * time.Second); len(messages) < n; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d messages buffered, want %d", len(messages), n)
+			}
+		}
+	}
+
+	t.Run("stragglers go to the finished turn", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		var mu sync.Mutex
+		var late []types.Message
+		opts := types.NewClaudeAgentOptions().WithOnLateMessage(func(msg types.Message) {
+			mu.Lock()
+			late = append(late, msg)
+			mu.Unlock()
+		})
+		mock := newMockTransport()
+		client := newMockClient(t, opts, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		observed, unsubscribe := client.Subscribe()
+		defer unsubscribe()
+
+		first := []types.Message{assistant("one"), result()}
+		if err := client.Query(ctx, "first"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, msg := range append(first, telemetry, sessionInfo) {
+			mock.send(msg)
+		}
+		if got := collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second); !slices.Equal(got, first) {
+			t.Fatalf("first response = %v, want %v", got, first)
+		}
+		buffered(t, client, 2)
+
+		second := []types.Message{assistant("two"), result()}
+		if err := client.Query(ctx, "second"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, msg := range second {
+			mock.send(msg)
+		}
+		if got := collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second); !slices.Equal(got, second) {
+			t.Errorf("second response = %v, want only its own %v", got, second)
+		}
+
+		mu.Lock()
+		if want := []types.Message{telemetry, sessionInfo}; !slices.Equal(late, want) {
+			t.Errorf("late messages = %v, want %v", late, want)
+		}
+		mu.Unlock()
+
+		// Subscribers see the stream in the order it arrived
+		want := slices.Concat(first, []types.Message{telemetry, sessionInfo}, second)
+		for i, w := range want {
+			select {
+			case msg := <-observed:
+				if msg != w {
+					t.Fatalf("subscriber message %d = %v, want %v", i, msg, w)
+				}
+			case <-ctx.Done():
+				t.Fatalf("subscriber got %d of %d messages", i, len(want))
+			}
+		}
+	})
+
+	t.Run("stragglers after the next query go to the finished turn", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		transcript := NewTranscript()
+		opts := types.NewClaudeAgentOptions().WithOnLateMessage(transcript.RecordLate)
+		mock := newMockTransport()
+		client := newMockClient(t, opts, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		first := []types.Message{assistant("one"), result()}
+		if err := client.Query(ctx, "first"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, msg := range first {
+			mock.send(msg)
+		}
+		got := collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second)
+		transcript.Record(TranscriptTurn{Prompt: "first", Messages: got})
+
+		// Sent only once the next query has been written
+		second := []types.Message{assistant("two"), result()}
+		if err := client.Query(ctx, "second"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, msg := range append([]types.Message{telemetry, sessionInfo}, second...) {
+			mock.send(msg)
+		}
+		if got := collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second); !slices.Equal(got, second) {
+			t.Errorf("second response = %v, want only its own %v", got, second)
+		}
+
+		turns := transcript.Turns()
+		if want := slices.Concat(first, []types.Message{telemetry, sessionInfo}); !slices.Equal(turns[0].Messages, want) {
+			t.Errorf("transcript turn = %v, want %v", turns[0].Messages, want)
+		}
+	})
+
+	t.Run("a panicking callback does not break the response", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		opts := types.NewClaudeAgentOptions().WithOnLateMessage(func(types.Message) { panic("late") })
+		mock := newMockTransport()
+		client := newMockClient(t, opts, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		if err := client.Query(ctx, "first"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		mock.send(result())
+		collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second)
+
+		second := []types.Message{assistant("two"), result()}
+		if err := client.Query(ctx, "second"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, msg := range append([]types.Message{telemetry}, second...) {
+			mock.send(msg)
+		}
+		if got := collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second); !slices.Equal(got, second) {
+			t.Errorf("second response = %v, want %v", got, second)
+		}
+	})
+
+	t.Run("ReceiveMessages keeps them", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		lateCalled := false
+		opts := types.NewClaudeAgentOptions().WithOnLateMessage(func(types.Message) { lateCalled = true })
+		mock := newMockTransport()
+		client := newMockClient(t, opts, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		all := client.ReceiveMessages(ctx)
+
+		if err := client.Query(ctx, "first"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		mock.send(result())
+		mock.send(telemetry)
+		if err := client.Query(ctx, "second"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, want := range []string{"result", "system"} {
+			if msg := <-all; msg.GetMessageType() != want {
+				t.Fatalf("ReceiveMessages got %s, want %s", msg.GetMessageType(), want)
+			}
+		}
+		if lateCalled {
+			t.Error("OnLateMessage called while ReceiveMessages reads across turns")
+		}
+	})
+}
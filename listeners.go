@@ -0,0 +1,206 @@
+package claude
+
+import (
+	"context"
+	"slices"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// listenerSet holds the callbacks registered with OnAssistantText and its
+// siblings. It is replaced, never modified, when a listener is added, so the
+// dispatcher can call a snapshot without holding Client.mu.
+type listenerSet struct {
+	assistantText []func(string)
+	toolUse       []func(*types.ToolUseBlock)
+	result        []func(*types.ResultMessage)
+	system        []func(*types.SystemMessage)
+	errors        []func(error)
+}
+
+// OnAssistantText registers fn to be called with the text of every text block
+// of Claude's messages, as an alternative to reading channels.
+//
+// Listeners are called from a single goroutine per connection, which consumes
+// every message of the client in order, like ReceiveMessages: results complete
+// their turns, so Query can be called from a listener or any other goroutine,
+// and Subscribe still observes the stream. The listeners of one message are
+// called in registration order, and a listener that panics is logged and
+// skipped without affecting the others.
+//
+// Listeners may be registered before Connect, and later from any goroutine,
+// including a listener; they apply from the next message and last across
+// reconnections.
+//
+// Listeners and channels are mutually exclusive on a client: once a listener
+// is registered, ReceiveResponse, ReceiveMessages and the calls built on them
+// (ReceiveText, Run, ResponseSeq, QueryWithSession, DrainResponse) fail with
+// types.ErrListenerConsumer, and registering a listener after one of them was
+// used returns types.ErrListenerConsumer.
+//
+// Example:
+//
+//	_ = client.OnAssistantText(func(text string) { fmt.Print(text) })
+//	_ = client.OnResult(func(result *types.ResultMessage) { close(done) })
+//	if err := client.Connect(ctx); err != nil {
+//	    return err
+//	}
+//	if err := client.Query(ctx, "Hello"); err != nil {
+//	    return err
+//	}
+//	<-done
+func (c *Client) OnAssistantText(fn func(text string)) error {
+	return c.addListener(func(l *listenerSet) {
+		l.assistantText = append(slices.Clip(l.assistantText), fn)
+	})
+}
+
+// OnToolUse registers fn to be called with every tool use block of Claude's
+// messages. See OnAssistantText for how listeners are called.
+func (c *Client) OnToolUse(fn func(block *types.ToolUseBlock)) error {
+	return c.addListener(func(l *listenerSet) {
+		l.toolUse = append(slices.Clip(l.toolUse), fn)
+	})
+}
+
+// OnResult registers fn to be called with the ResultMessage ending each turn.
+// The turn is complete when fn is called. See OnAssistantText for how
+// listeners are called.
+func (c *Client) OnResult(fn func(result *types.ResultMessage)) error {
+	return c.addListener(func(l *listenerSet) {
+		l.result = append(slices.Clip(l.result), fn)
+	})
+}
+
+// OnSystem registers fn to be called with every system message, such as the
+// session's init message. See OnAssistantText for how listeners are called.
+func (c *Client) OnSystem(fn func(msg *types.SystemMessage)) error {
+	return c.addListener(func(l *listenerSet) {
+		l.system = append(slices.Clip(l.system), fn)
+	})
+}
+
+// OnError registers fn to be called with the error of every
+// *types.ErrorMessage in the stream: a line of output that could not be
+// decoded, or the connection ending before the client was closed. See
+// OnAssistantText for how listeners are called.
+func (c *Client) OnError(fn func(err error)) error {
+	return c.addListener(func(l *listenerSet) {
+		l.errors = append(slices.Clip(l.errors), fn)
+	})
+}
+
+// addListener adds a listener with add, and starts dispatching to listeners if
+// the client is connected and no dispatcher is running yet.
+func (c *Client) addListener(add func(*listenerSet)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.channelConsumer {
+		return types.ErrListenerConsumer
+	}
+	next := &listenerSet{}
+	if c.listeners != nil {
+		*next = *c.listeners
+	}
+	add(next)
+	c.listeners = next
+
+	if c.connected && c.query != nil && !c.dispatching {
+		c.startListenersLocked()
+	}
+	return nil
+}
+
+// startListenersLocked takes the consumer slot for a dispatcher of the current
+// connection's messages to the listeners. A dispatcher left over from the
+// previous connection no longer releases the slot. The caller holds c.mu.
+func (c *Client) startListenersLocked() {
+	c.dispatchGen++
+	c.dispatching = true
+	c.receiving = true
+	go c.dispatchListeners(c.ctx, c.dispatchGen, c.messages(c.ctx))
+}
+
+// dispatchListeners calls the listeners with every message until ctx is done
+// or messagesChan closes, completing a turn at each ResultMessage.
+func (c *Client) dispatchListeners(ctx context.Context, gen uint64, messagesChan <-chan types.Message) {
+	defer func() {
+		c.mu.Lock()
+		if c.dispatchGen == gen {
+			c.dispatching = false
+			c.receiving = false
+		}
+		c.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messagesChan:
+			if !ok {
+				if err := c.endOfStreamError(); err != nil {
+					errMsg := types.NewErrorMessage(err)
+					c.broadcast(errMsg)
+					c.notifyListeners(errMsg)
+				}
+				return
+			}
+			c.touch()
+			c.broadcast(msg)
+			if _, isResult := msg.(*types.ResultMessage); isResult {
+				c.completeTurn()
+			}
+			c.notifyListeners(msg)
+		}
+	}
+}
+
+// notifyListeners calls the listeners registered for msg.
+func (c *Client) notifyListeners(msg types.Message) {
+	c.mu.Lock()
+	listeners := c.listeners
+	c.mu.Unlock()
+	if listeners == nil {
+		return
+	}
+
+	switch m := msg.(type) {
+	case *types.AssistantMessage:
+		for _, block := range m.Content {
+			switch block := block.(type) {
+			case *types.TextBlock:
+				for _, fn := range listeners.assistantText {
+					c.callListener(func() { fn(block.Text) })
+				}
+			case *types.ToolUseBlock:
+				for _, fn := range listeners.toolUse {
+					c.callListener(func() { fn(block) })
+				}
+			}
+		}
+	case *types.ResultMessage:
+		for _, fn := range listeners.result {
+			c.callListener(func() { fn(m) })
+		}
+	case *types.SystemMessage:
+		for _, fn := range listeners.system {
+			c.callListener(func() { fn(m) })
+		}
+	case *types.ErrorMessage:
+		for _, fn := range listeners.errors {
+			c.callListener(func() { fn(m.Err) })
+		}
+	}
+}
+
+// callListener calls a listener, isolating dispatch from its panics.
+func (c *Client) callListener(call func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Warning("Listener panicked: %v", r)
+		}
+	}()
+	call()
+}
@@ -0,0 +1,250 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// eventLog records the calls of listeners, which run on the dispatcher's goroutine.
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+	result chan struct{}
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{result: make(chan struct{}, 10)}
+}
+
+func (l *eventLog) add(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, fmt.Sprintf(format, args...))
+}
+
+func (l *eventLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.events)
+}
+
+// waitResult waits for the OnResult listener registered by register.
+func (l *eventLog) waitResult(t *testing.T) {
+	t.Helper()
+	select {
+	case <-l.result:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("result listener not called; events so far: %v", l.get())
+	}
+}
+
+// register adds a listener of every kind that records its call.
+func (l *eventLog) register(t *testing.T, client *Client) {
+	t.Helper()
+	for _, err := range []error{
+		client.OnSystem(func(msg *types.SystemMessage) { l.add("system:%s", msg.Subtype) }),
+		client.OnAssistantText(func(text string) { l.add("text:%s", text) }),
+		client.OnToolUse(func(block *types.ToolUseBlock) { l.add("tool:%s", block.Name) }),
+		client.OnResult(func(result *types.ResultMessage) {
+			l.add("result:%s", result.Subtype)
+			l.result <- struct{}{}
+		}),
+		client.OnError(func(err error) { l.add("error") }),
+	} {
+		if err != nil {
+			t.Fatalf("registering listener failed: %v", err)
+		}
+	}
+}
+
+// TestClient_Listeners tests that listeners are called in message order, turn
+// after turn, whether registered before or after Connect.
+func TestClient_Listeners(t *testing.T) {
+	turn := func(mock *mockTransport, n int) {
+		mock.send(&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.TextBlock{Type: "text", Text: fmt.Sprintf("a%d", n)},
+			&types.ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Bash", Input: map[string]interface{}{}},
+			&types.TextBlock{Type: "text", Text: fmt.Sprintf("b%d", n)},
+		}})
+		mock.send(&types.ResultMessage{Type: "result", Subtype: "success"})
+	}
+
+	for _, beforeConnect := range []bool{true, false} {
+		t.Run(fmt.Sprintf("registered before Connect %v", beforeConnect), func(t *testing.T) {
+			ctx := testContext(t, 5*time.Second)
+			mock := newMockTransport()
+			client := newMockClient(t, nil, mock)
+			log := newEventLog()
+			if beforeConnect {
+				log.register(t, client)
+			}
+			if err := client.Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+			if !beforeConnect {
+				log.register(t, client)
+			}
+
+			if err := client.Query(ctx, "first"); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			mock.send(&types.SystemMessage{Type: "system", Subtype: "init"})
+			turn(mock, 1)
+			log.waitResult(t)
+
+			// The result completed the turn, so the next query is accepted
+			if err := client.Query(ctx, "second"); err != nil {
+				t.Fatalf("second Query failed: %v", err)
+			}
+			turn(mock, 2)
+			log.waitResult(t)
+
+			want := []string{
+				"system:init", "text:a1", "tool:Bash", "text:b1", "result:success",
+				"text:a2", "tool:Bash", "text:b2", "result:success",
+			}
+			if got := log.get(); !slices.Equal(got, want) {
+				t.Errorf("events = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestClient_ListenerPanic tests that a panicking listener neither stops
+// dispatch nor keeps the other listeners of the message from being called.
+func TestClient_ListenerPanic(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	if err := client.OnAssistantText(func(text string) { panic("listener bug") }); err != nil {
+		t.Fatalf("OnAssistantText failed: %v", err)
+	}
+	log := newEventLog()
+	log.register(t, client)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	mock.send(&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: "one"}}})
+	mock.send(&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: "two"}}})
+	mock.send(&types.ResultMessage{Type: "result", Subtype: "success"})
+	log.waitResult(t)
+
+	if got, want := log.get(), []string{"text:one", "text:two", "result:success"}; !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+// TestClient_ListenerError tests that OnError is told when the connection
+// ends before the client is closed.
+func TestClient_ListenerError(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	errs := make(chan error, 1)
+	if err := client.OnError(func(err error) { errs <- err }); err != nil {
+		t.Fatalf("OnError failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	_ = mock.Close(ctx)
+
+	select {
+	case err := <-errs:
+		if !types.IsCLIConnectionError(err) {
+			t.Errorf("error = %v, want a CLIConnectionError", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("error listener not called")
+	}
+}
+
+// TestClient_ListenersExcludeChannels tests that a client's messages are
+// consumed either by listeners or through channels, never both.
+func TestClient_ListenersExcludeChannels(t *testing.T) {
+	t.Run("channels after listeners", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.OnResult(func(*types.ResultMessage) {}); err != nil {
+			t.Fatalf("OnResult failed: %v", err)
+		}
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Query(ctx, "hi"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+
+		if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrListenerConsumer) {
+			t.Errorf("ReceiveResponseE error = %v, want ErrListenerConsumer", err)
+		}
+		if msgs := collectMessages(t, client.ReceiveMessages(ctx), time.Second); len(msgs) != 0 {
+			t.Errorf("ReceiveMessages delivered %d messages to a listening client", len(msgs))
+		}
+		if err := client.QueryWithSession(ctx, "s-1", "hi"); !errors.Is(err, types.ErrListenerConsumer) {
+			t.Errorf("QueryWithSession error = %v, want ErrListenerConsumer", err)
+		}
+	})
+
+	t.Run("listeners after channels", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Query(ctx, "hi"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		mock.send(&types.ResultMessage{Type: "result", Subtype: "success"})
+		collectMessages(t, client.ReceiveResponse(ctx), 2*time.Second)
+
+		if err := client.OnResult(func(*types.ResultMessage) {}); !errors.Is(err, types.ErrListenerConsumer) {
+			t.Errorf("OnResult error = %v, want ErrListenerConsumer", err)
+		}
+	})
+}
+
+// TestClient_ListenersShutdown tests that Shutdown waits for the listeners to
+// receive the pending turn's result.
+func TestClient_ListenersShutdown(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	log := newEventLog()
+	log.register(t, client)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Shutdown(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	mock.send(&types.ResultMessage{Type: "result", Subtype: "success"})
+
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+	if got := log.get(); !slices.Contains(got, "result:success") {
+		t.Errorf("events = %v, want the result", got)
+	}
+}
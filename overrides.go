@@ -0,0 +1,278 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// QueryWithOptions sends a prompt like Query after changing session settings
+// for it: the permission mode, the model and the extended thinking limit.
+// Each change is a control request to the CLI (as sent by SetPermissionMode
+// and SetModel), made in that order before the user message is written.
+//
+// Without overrides.Restore the changes last for the rest of the session.
+// With it, the previous values are put back once the query's ResultMessage
+// has been received, and the next query waits for that to finish; queries
+// sent before the result arrives also run with the overrides. Settings the CLI
+// fixes at startup cannot be overridden (see types.QueryOverrides), and
+// IncludePartialMessages may only restate the client's option. A nil
+// overrides is Query.
+//
+// Invalid overrides are rejected with a *types.ValidationError before anything
+// is sent. If the CLI rejects a change, the changes already made are undone
+// and its error is returned without sending the prompt.
+//
+// Example:
+//
+//	overrides := types.NewQueryOverrides().
+//	    WithPermissionMode(types.PermissionModePlan).
+//	    WithMaxThinkingTokens(16000).
+//	    WithRestore()
+//	if err := client.QueryWithOptions(ctx, "Plan the migration", overrides); err != nil {
+//	    return err
+//	}
+func (c *Client) QueryWithOptions(ctx context.Context, prompt string, overrides *types.QueryOverrides) error {
+	if overrides == nil {
+		return c.Query(ctx, prompt)
+	}
+	if err := c.awaitWritable(ctx); err != nil {
+		return err
+	}
+	if prompt == "" {
+		return fmt.Errorf("prompt cannot be empty")
+	}
+	if err := overrides.Validate(); err != nil {
+		return err
+	}
+	if include := overrides.IncludePartialMessages; include != nil && *include != c.options.IncludePartialMessages {
+		return types.NewValidationError("include_partial_messages",
+			"is fixed when the CLI starts and cannot change mid-session; set it with WithIncludePartialMessages")
+	}
+	if err := c.awaitRestore(ctx); err != nil {
+		return err
+	}
+	if err := c.ensureInitialized(ctx); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	query := c.query
+	notConnected := c.notConnectedError()
+	c.mu.Unlock()
+	if query == nil {
+		return notConnected
+	}
+
+	changes := settingsOf(overrides)
+	previous := currentSettings(query, changes)
+	applied, err := c.applySettings(ctx, changes)
+	if err != nil {
+		c.restoreSettings(ctx, previous.only(applied))
+		return err
+	}
+
+	c.scheduleRestore(previous, overrides.Restore)
+	if err := c.sendPrompt(ctx, prompt, DefaultSessionID); err != nil {
+		if overrides.Restore {
+			c.mu.Lock()
+			pending := c.restore
+			c.restore = nil
+			c.mu.Unlock()
+			if pending != nil {
+				c.restoreSettings(ctx, pending.previous)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// sessionSettings are the session settings a query can override. Nil fields
+// are left alone.
+type sessionSettings struct {
+	permissionMode    *types.PermissionMode
+	model             *string
+	maxThinkingTokens *int // nil selects the CLI's default when setThinking
+	setThinking       bool
+}
+
+// settingsOf returns the settings overrides changes.
+func settingsOf(overrides *types.QueryOverrides) sessionSettings {
+	return sessionSettings{
+		permissionMode:    overrides.PermissionMode,
+		model:             overrides.Model,
+		maxThinkingTokens: overrides.MaxThinkingTokens,
+		setThinking:       overrides.MaxThinkingTokens != nil,
+	}
+}
+
+// currentSettings returns the session's current values of the settings in
+// fields.
+func currentSettings(query *internal.Query, fields sessionSettings) sessionSettings {
+	var current sessionSettings
+	if fields.permissionMode != nil {
+		mode := query.PermissionMode()
+		current.permissionMode = &mode
+	}
+	if fields.model != nil {
+		model := query.Model()
+		current.model = &model
+	}
+	if fields.setThinking {
+		current.maxThinkingTokens = query.MaxThinkingTokens()
+		current.setThinking = true
+	}
+	return current
+}
+
+// only returns the settings of s that are also in fields.
+func (s sessionSettings) only(fields sessionSettings) sessionSettings {
+	var kept sessionSettings
+	if fields.permissionMode != nil {
+		kept.permissionMode = s.permissionMode
+	}
+	if fields.model != nil {
+		kept.model = s.model
+	}
+	if fields.setThinking {
+		kept.maxThinkingTokens, kept.setThinking = s.maxThinkingTokens, s.setThinking
+	}
+	return kept
+}
+
+// without returns the settings of s that are not in fields.
+func (s sessionSettings) without(fields sessionSettings) sessionSettings {
+	if fields.permissionMode != nil {
+		s.permissionMode = nil
+	}
+	if fields.model != nil {
+		s.model = nil
+	}
+	if fields.setThinking {
+		s.maxThinkingTokens, s.setThinking = nil, false
+	}
+	return s
+}
+
+// merge returns s with the settings of other it lacks added.
+func (s sessionSettings) merge(other sessionSettings) sessionSettings {
+	if s.permissionMode == nil {
+		s.permissionMode = other.permissionMode
+	}
+	if s.model == nil {
+		s.model = other.model
+	}
+	if !s.setThinking {
+		s.maxThinkingTokens, s.setThinking = other.maxThinkingTokens, other.setThinking
+	}
+	return s
+}
+
+// applySettings changes the settings of s in turn, returning those changed
+// before any error.
+func (c *Client) applySettings(ctx context.Context, s sessionSettings) (sessionSettings, error) {
+	var applied sessionSettings
+	if s.permissionMode != nil {
+		if err := c.SetPermissionMode(ctx, *s.permissionMode); err != nil {
+			return applied, err
+		}
+		applied.permissionMode = s.permissionMode
+	}
+	if s.model != nil {
+		if err := c.SetModel(ctx, *s.model); err != nil {
+			return applied, err
+		}
+		applied.model = s.model
+	}
+	if s.setThinking {
+		err := c.sendControlRequest(ctx, "thinking limit change", func(ctx context.Context, query *internal.Query) error {
+			return query.SetMaxThinkingTokens(ctx, s.maxThinkingTokens)
+		})
+		if err != nil {
+			return applied, err
+		}
+		applied.maxThinkingTokens, applied.setThinking = s.maxThinkingTokens, true
+	}
+	return applied, nil
+}
+
+// restoreSettings puts back previous settings, logging failures. It works
+// after ctx has been cancelled.
+func (c *Client) restoreSettings(ctx context.Context, previous sessionSettings) {
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), runCleanupTimeout)
+	defer cancel()
+	if _, err := c.applySettings(cleanupCtx, previous); err != nil {
+		c.logger.Warning("Failed to restore settings overridden for a query: %v", err)
+	}
+}
+
+// settingsRestore is the restoration of settings overridden by
+// QueryWithOptions, made once the overriding turn completes.
+type settingsRestore struct {
+	previous sessionSettings
+	results  int // ResultMessages to receive before restoring
+}
+
+// scheduleRestore records the settings to restore once the turn about to be
+// sent completes, if restore is set. An earlier restoration still pending is
+// postponed to that turn, keeping its values; settings changed for good are
+// dropped from it.
+func (c *Client) scheduleRestore(previous sessionSettings, restore bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case restore && c.restore != nil:
+		c.restore.previous = c.restore.previous.merge(previous)
+		c.restore.results = c.pendingTurns + 1
+	case restore:
+		c.restore = &settingsRestore{previous: previous, results: c.pendingTurns + 1}
+	case c.restore != nil:
+		c.restore.previous = c.restore.previous.without(previous)
+	}
+}
+
+// restoreAfterResult counts a turn's ResultMessage toward the pending
+// restoration, starting it once the overriding turn has completed. The caller
+// holds c.mu.
+func (c *Client) restoreAfterResult() {
+	if c.restore == nil {
+		return
+	}
+	if c.restore.results--; c.restore.results > 0 {
+		return
+	}
+
+	previous, ctx := c.restore.previous, c.ctx
+	done := make(chan struct{})
+	c.restore, c.restoring = nil, done
+	go func() {
+		defer close(done)
+		c.restoreSettings(ctx, previous)
+
+		c.mu.Lock()
+		if c.restoring == done {
+			c.restoring = nil
+		}
+		c.mu.Unlock()
+	}()
+}
+
+// awaitRestore waits for a restoration of overridden settings in progress.
+func (c *Client) awaitRestore(ctx context.Context) error {
+	c.mu.Lock()
+	restoring := c.restoring
+	c.mu.Unlock()
+	if restoring == nil {
+		return nil
+	}
+	select {
+	case <-restoring:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,148 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestClient_QueryWithOptions tests that overrides are sent as control
+// requests before the user message, restored after the turn when asked, and
+// rejected when invalid or refused by the CLI.
+func TestClient_QueryWithOptions(t *testing.T) {
+	result := &types.ResultMessage{Type: "result", Subtype: "success"}
+	// written returns the requests (or message types) written after
+	// initialization, with the value each control request sets
+	written := func(mock *mockTransport) []string {
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		var lines []string
+		for _, data := range mock.written {
+			var msg struct {
+				Type    string                 `json:"type"`
+				Request map[string]interface{} `json:"request"`
+			}
+			_ = json.Unmarshal([]byte(data), &msg)
+			subtype, _ := msg.Request["subtype"].(string)
+			switch subtype {
+			case "":
+				lines = append(lines, msg.Type)
+			case "initialize":
+			default:
+				value, _ := json.Marshal(msg.Request[map[string]string{
+					"set_permission_mode":     "mode",
+					"set_model":               "model",
+					"set_max_thinking_tokens": "max_thinking_tokens",
+				}[subtype]])
+				lines = append(lines, subtype+"="+string(value))
+			}
+		}
+		return lines
+	}
+	connect := func(t *testing.T, opts *types.ClaudeAgentOptions, mock *mockTransport) *Client {
+		t.Helper()
+		client := newMockClient(t, opts, mock)
+		if err := client.Connect(testContext(t, 5*time.Second)); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		return client
+	}
+
+	t.Run("overrides precede the prompt and are restored", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := connect(t, types.NewClaudeAgentOptions().WithModel("sonnet"), mock)
+
+		overrides := types.NewQueryOverrides().
+			WithPermissionMode(types.PermissionModePlan).
+			WithModel("opus").
+			WithMaxThinkingTokens(8000).
+			WithRestore()
+		if err := client.QueryWithOptions(ctx, "plan it", overrides); err != nil {
+			t.Fatalf("QueryWithOptions failed: %v", err)
+		}
+		if got := client.PermissionMode(); got != types.PermissionModePlan {
+			t.Errorf("PermissionMode during the turn = %q, want plan", got)
+		}
+		mock.send(result)
+		collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second)
+
+		// The next query waits for the restoration
+		if err := client.Query(ctx, "next"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		want := []string{
+			`set_permission_mode="plan"`, `set_model="opus"`, `set_max_thinking_tokens=8000`, "user",
+			`set_permission_mode="default"`, `set_model="sonnet"`, `set_max_thinking_tokens=null`, "user",
+		}
+		if got := written(mock); !slices.Equal(got, want) {
+			t.Errorf("written = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("overrides kept without restore", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := connect(t, nil, mock)
+
+		if err := client.QueryWithOptions(ctx, "hi", types.NewQueryOverrides().WithModel("haiku")); err != nil {
+			t.Fatalf("QueryWithOptions failed: %v", err)
+		}
+		mock.send(result)
+		collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second)
+		if err := client.Query(ctx, "next"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if got, want := written(mock), []string{`set_model="haiku"`, "user", "user"}; !slices.Equal(got, want) {
+			t.Errorf("written = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("rejected change is undone", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		mock.respond = func(subtype string) (map[string]interface{}, error) {
+			if subtype == "set_model" {
+				return nil, errors.New("unknown model")
+			}
+			return map[string]interface{}{}, nil
+		}
+		client := connect(t, nil, mock)
+
+		overrides := types.NewQueryOverrides().WithPermissionMode(types.PermissionModeAcceptEdits).WithModel("nope")
+		if err := client.QueryWithOptions(ctx, "hi", overrides); !types.IsControlProtocolError(err) {
+			t.Fatalf("QueryWithOptions error = %v, want the CLI's ControlProtocolError", err)
+		}
+		want := []string{`set_permission_mode="acceptEdits"`, `set_model="nope"`, `set_permission_mode="default"`}
+		if got := written(mock); !slices.Equal(got, want) {
+			t.Errorf("written = %v, want %v and no user message", got, want)
+		}
+	})
+
+	t.Run("invalid overrides", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := connect(t, nil, mock)
+
+		for name, overrides := range map[string]*types.QueryOverrides{
+			"permission mode":  types.NewQueryOverrides().WithPermissionMode("yolo"),
+			"thinking tokens":  types.NewQueryOverrides().WithMaxThinkingTokens(-1),
+			"partial messages": types.NewQueryOverrides().WithIncludePartialMessages(true),
+		} {
+			if err := client.QueryWithOptions(ctx, "hi", overrides); !types.IsValidationError(err) {
+				t.Errorf("%s: error = %v, want ValidationError", name, err)
+			}
+		}
+		// Restating the client's option is allowed
+		if err := client.QueryWithOptions(ctx, "hi", types.NewQueryOverrides().WithIncludePartialMessages(false)); err != nil {
+			t.Errorf("restated IncludePartialMessages: %v", err)
+		}
+		if got := written(mock); !slices.Equal(got, []string{"user"}) {
+			t.Errorf("written = %v, want only the valid query", got)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package claude
+
+import (
+	"slices"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// acceptEditsTools are approved without asking in PermissionModeAcceptEdits.
+var acceptEditsTools = []string{"Edit", "MultiEdit", "NotebookEdit", "Write"}
+
+// PolicyReport describes the effective permission posture of a set of options.
+type PolicyReport struct {
+	PermissionMode       types.PermissionMode // Effective mode; PermissionModeDefault when unset
+	BypassActive         bool                 // Tool permission checks are skipped entirely
+	AllowedTools         []string             // Tools allowed without asking
+	DisallowedTools      []string             // Tools that are always denied
+	HasCanUseTool        bool                 // Permission requests are answered by a CanUseTool callback
+	PermissionPromptTool string               // MCP tool answering permission requests, "" if unset
+
+	// Contradictions among the settings, as reported by Validate
+	Contradictions []*types.ValidationError
+
+	toolAliases map[string]string
+}
+
+// AnalyzeOptions reports the permission posture of opts without starting the
+// CLI: whether permissions are bypassed, the allowed and disallowed tools,
+// how permission requests are answered, and any contradictions (e.g. a tool
+// both allowed and disallowed, or a CanUseTool callback that bypassed
+// permissions make unreachable). Nil opts are analyzed as the defaults.
+//
+// Example:
+//
+//	report := claude.AnalyzeOptions(opts)
+//	if n := report.ApprovalsNeeded("Read", "Edit", "Bash"); n > 0 {
+//	    fmt.Printf("this will likely require %d approvals\n", n)
+//	}
+func AnalyzeOptions(opts *types.ClaudeAgentOptions) PolicyReport {
+	if opts == nil {
+		opts = types.NewClaudeAgentOptions()
+	}
+
+	report := PolicyReport{
+		PermissionMode:  types.PermissionModeDefault,
+		BypassActive:    opts.BypassesPermissions(),
+		AllowedTools:    slices.Clone(opts.AllowedTools),
+		DisallowedTools: slices.Clone(opts.DisallowedTools),
+		HasCanUseTool:   opts.CanUseTool != nil,
+		Contradictions:  opts.PermissionConflicts(),
+		toolAliases:     opts.ToolAliases,
+	}
+	if opts.PermissionMode != nil {
+		report.PermissionMode = *opts.PermissionMode
+	}
+	if opts.PermissionPromptToolName != nil {
+		report.PermissionPromptTool = *opts.PermissionPromptToolName
+	}
+	return report
+}
+
+// RequiresApproval reports whether a use of toolName would be put to a
+// permission prompt or CanUseTool callback. Tools that are bypassed, allowed,
+// disallowed (denied without asking) or auto-approved by the permission mode do
+// not. Entries match canonical tool names exactly, or by prefix when they end
+// in "*", as in PermissionPolicy.
+func (r PolicyReport) RequiresApproval(toolName string) bool {
+	if r.BypassActive {
+		return false
+	}
+	toolName = types.NormalizeToolName(toolName, r.toolAliases)
+	if matchesToolPattern(r.DisallowedTools, toolName) || matchesToolPattern(r.AllowedTools, toolName) {
+		return false
+	}
+	if r.PermissionMode == types.PermissionModeAcceptEdits && slices.Contains(acceptEditsTools, toolName) {
+		return false
+	}
+	return true
+}
+
+// ApprovalsNeeded returns how many of the given tool uses require approval.
+func (r PolicyReport) ApprovalsNeeded(toolNames ...string) int {
+	n := 0
+	for _, name := range toolNames {
+		if r.RequiresApproval(name) {
+			n++
+		}
+	}
+	return n
+}
+
+// HasContradictions reports whether any settings contradict each other.
+func (r PolicyReport) HasContradictions() bool {
+	return len(r.Contradictions) > 0
+}
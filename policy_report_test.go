@@ -0,0 +1,100 @@
+package claude
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func allowAll(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+	return types.PermissionResultAllow{Behavior: "allow"}, nil
+}
+
+// TestAnalyzeOptions_Clean tests the report for configurations without contradictions.
+func TestAnalyzeOptions_Clean(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		report := AnalyzeOptions(nil)
+		if report.PermissionMode != types.PermissionModeDefault || report.BypassActive || report.HasCanUseTool || report.HasContradictions() {
+			t.Errorf("AnalyzeOptions(nil) = %+v, want the default posture", report)
+		}
+		if !report.RequiresApproval("Bash") {
+			t.Error("Bash should require approval by default")
+		}
+	})
+
+	t.Run("allowed tools and accept edits", func(t *testing.T) {
+		opts := types.NewClaudeAgentOptions().
+			WithAllowedTools("Read", "mcp__github__*").
+			WithDisallowedTools("Bash").
+			WithPermissionMode(types.PermissionModeAcceptEdits).
+			WithCanUseTool(allowAll)
+		report := AnalyzeOptions(opts)
+
+		if !report.HasCanUseTool || report.PermissionMode != types.PermissionModeAcceptEdits || report.HasContradictions() {
+			t.Errorf("report = %+v", report)
+		}
+		if !reflect.DeepEqual(report.AllowedTools, []string{"Read", "mcp__github__*"}) || !reflect.DeepEqual(report.DisallowedTools, []string{"Bash"}) {
+			t.Errorf("tool lists = %v / %v", report.AllowedTools, report.DisallowedTools)
+		}
+		for tool, want := range map[string]bool{
+			"Read":                    false, // allowed
+			"mcp__github__list_repos": false, // allowed by prefix
+			"Bash":                    false, // denied without asking
+			"Edit":                    false, // accepted by the mode
+			"create_file":             false, // alias of Write
+			"WebFetch":                true,
+		} {
+			if got := report.RequiresApproval(tool); got != want {
+				t.Errorf("RequiresApproval(%q) = %v, want %v", tool, got, want)
+			}
+		}
+		if n := report.ApprovalsNeeded("Read", "WebFetch", "Edit", "WebSearch"); n != 2 {
+			t.Errorf("ApprovalsNeeded = %d, want 2", n)
+		}
+	})
+
+	t.Run("bypass", func(t *testing.T) {
+		report := AnalyzeOptions(types.NewClaudeAgentOptions().WithAllowDangerouslySkipPermissions(true).WithDangerouslySkipPermissions(true))
+		if !report.BypassActive || report.ApprovalsNeeded("Bash", "Write") != 0 {
+			t.Errorf("bypass report = %+v, want no approvals", report)
+		}
+	})
+}
+
+// TestAnalyzeOptions_Contradictions tests that contradictory settings are
+// reported and rejected by Validate alike.
+func TestAnalyzeOptions_Contradictions(t *testing.T) {
+	for name, tt := range map[string]struct {
+		opts  *types.ClaudeAgentOptions
+		field string
+	}{
+		"tool allowed and disallowed": {
+			types.NewClaudeAgentOptions().WithAllowedTools("Read", "Bash").WithDisallowedTools("Bash"),
+			"allowed_tools",
+		},
+		"callback with bypass mode": {
+			types.NewClaudeAgentOptions().WithCanUseTool(allowAll).WithPermissionMode(types.PermissionModeBypassPermissions),
+			"can_use_tool",
+		},
+		"callback with prompt tool": {
+			types.NewClaudeAgentOptions().WithCanUseTool(allowAll).WithPermissionPromptToolName("mcp__auth__prompt"),
+			"can_use_tool",
+		},
+		"skip without safety switch": {
+			types.NewClaudeAgentOptions().WithDangerouslySkipPermissions(true),
+			"dangerously_skip_permissions",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			report := AnalyzeOptions(tt.opts)
+			if len(report.Contradictions) != 1 || report.Contradictions[0].Field != tt.field {
+				t.Fatalf("Contradictions = %v, want one for %s", report.Contradictions, tt.field)
+			}
+			if err := tt.opts.Validate(); !types.IsValidationError(err) || err.Error() != report.Contradictions[0].Error() {
+				t.Errorf("Validate() = %v, want %v", err, report.Contradictions[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ProjectOptionsFile is the path of the project config file that
+// LoadProjectOptions looks for, relative to a project directory.
+var ProjectOptionsFile = filepath.Join(".claude", "sdk.json")
+
+// LoadProjectOptions looks for a project config file (ProjectOptionsFile,
+// .claude/sdk.json by default) in dir and then in each parent directory, as
+// the CLI does for .claude/settings.json, and applies the first one found on
+// top of base with types.MergeOptionsFromFile. The file lets a project set SDK
+// options such as the model, allowed tools and plugins without loader code in
+// every application. Relative paths in the file are not rewritten.
+//
+// The path of the file used is recorded in the ConfigFile field of the
+// returned options and logged by clients built from them. Without a config
+// file, a copy of base is returned (NewClaudeAgentOptions for a nil base). A
+// file that cannot be read or is malformed is an error naming the file and
+// the offending key; the search does not continue past it.
+//
+// Example:
+//
+//	opts, err := claude.LoadProjectOptions(".", types.NewClaudeAgentOptions().WithModel("sonnet"))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	client, err := claude.NewClient(ctx, opts.WithCanUseTool(approve))
+func LoadProjectOptions(dir string, base *types.ClaudeAgentOptions) (*types.ClaudeAgentOptions, error) {
+	path, err := findProjectOptions(dir)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		if base == nil {
+			return types.NewClaudeAgentOptions(), nil
+		}
+		return base.Clone(), nil
+	}
+
+	opts, err := types.MergeOptionsFromFile(base, path)
+	if err != nil {
+		return nil, err
+	}
+	opts.ConfigFile = path
+	return opts, nil
+}
+
+// findProjectOptions returns the path of the project config file closest to
+// dir, or "" if there is none up to the filesystem root.
+func findProjectOptions(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", types.NewValidationErrorWithCause("config", fmt.Sprintf("cannot resolve %s", dir), err)
+	}
+	for {
+		path := filepath.Join(dir, ProjectOptionsFile)
+		_, err := os.Stat(path)
+		switch {
+		case err == nil:
+			return path, nil
+		case !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, syscall.ENOTDIR):
+			return "", types.NewValidationErrorWithCause("config", fmt.Sprintf("cannot read %s", path), err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,106 @@
+package claude
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestLoadProjectOptions tests finding the project config file from nested
+// directories, falling back to the base options without one, merge
+// precedence, and errors naming the file and key.
+func TestLoadProjectOptions(t *testing.T) {
+	writeConfig := func(t *testing.T, dir, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, ProjectOptionsFile)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	base := func() *types.ClaudeAgentOptions {
+		return types.NewClaudeAgentOptions().WithModel("sonnet").WithMaxTurns(5)
+	}
+
+	t.Run("nested directories", func(t *testing.T) {
+		root := t.TempDir()
+		outer := writeConfig(t, root, `{"model": "opus", "allowed_tools": ["Read"]}`)
+		inner := writeConfig(t, filepath.Join(root, "services", "api"), `{"model": "haiku"}`)
+		deep := filepath.Join(root, "services", "api", "internal", "handlers")
+		if err := os.MkdirAll(deep, 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		// The closest file wins and is not merged with the outer one
+		opts, err := LoadProjectOptions(deep, base())
+		if err != nil {
+			t.Fatalf("LoadProjectOptions failed: %v", err)
+		}
+		if opts.ConfigFile != inner || *opts.Model != "haiku" || len(opts.AllowedTools) != 0 {
+			t.Errorf("from %s: file %s, model %q, tools %v; want %s with model haiku", deep, opts.ConfigFile, *opts.Model, opts.AllowedTools, inner)
+		}
+
+		opts, err = LoadProjectOptions(filepath.Join(root, "services"), base())
+		if err != nil {
+			t.Fatalf("LoadProjectOptions failed: %v", err)
+		}
+		if opts.ConfigFile != outer || *opts.Model != "opus" {
+			t.Errorf("from services: file %s, model %q; want %s with model opus", opts.ConfigFile, *opts.Model, outer)
+		}
+	})
+
+	t.Run("merge precedence", func(t *testing.T) {
+		dir := t.TempDir()
+		writeConfig(t, dir, `{"model": "opus", "plugins": [{"type": "local", "path": "/plugins/lint"}]}`)
+
+		b := base()
+		opts, err := LoadProjectOptions(dir, b)
+		if err != nil {
+			t.Fatalf("LoadProjectOptions failed: %v", err)
+		}
+		if *opts.Model != "opus" || len(opts.Plugins) != 1 {
+			t.Errorf("file keys not applied: model %q, plugins %v", *opts.Model, opts.Plugins)
+		}
+		if opts.MaxTurns == nil || *opts.MaxTurns != 5 {
+			t.Errorf("MaxTurns = %v, want the base's 5", opts.MaxTurns)
+		}
+		if *b.Model != "sonnet" || b.ConfigFile != "" {
+			t.Error("base options were modified")
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		// Ignores any config file above the temporary directory
+		saved := ProjectOptionsFile
+		ProjectOptionsFile = filepath.Join(".claude", "sdk-test-missing.json")
+		t.Cleanup(func() { ProjectOptionsFile = saved })
+
+		b := base()
+		opts, err := LoadProjectOptions(t.TempDir(), b)
+		if err != nil {
+			t.Fatalf("LoadProjectOptions failed: %v", err)
+		}
+		if opts == b || opts.ConfigFile != "" || *opts.Model != "sonnet" {
+			t.Errorf("got file %q, model %q; want a copy of the base", opts.ConfigFile, *opts.Model)
+		}
+		if opts, err := LoadProjectOptions(t.TempDir(), nil); err != nil || opts == nil {
+			t.Errorf("nil base: got (%v, %v), want the defaults", opts, err)
+		}
+	})
+
+	t.Run("malformed file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := writeConfig(t, dir, `{"model": "opus", "max_turns": "ten"}`)
+
+		_, err := LoadProjectOptions(dir, base())
+		if !types.IsValidationError(err) || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), "max_turns") {
+			t.Errorf("error = %v, want a ValidationError naming %s and max_turns", err, path)
+		}
+	})
+}
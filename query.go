@@ -2,8 +2,10 @@ package claude
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/schlunsen/claude-agent-sdk-go/internal"
 	"github.com/schlunsen/claude-agent-sdk-go/internal/log"
@@ -11,12 +13,13 @@ import (
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
-// Query executes a single Claude query in non-streaming mode and returns a channel of messages.
+// Query executes a single Claude query and returns a channel of messages.
 // This is the simplest way to interact with Claude for one-off questions or batch processing.
 //
 // The function:
 //   - Finds and connects to Claude Code CLI
-//   - Sends the prompt in non-streaming mode (--print flag)
+//   - Starts the control protocol if callbacks are set (see below)
+//   - Sends the prompt
 //   - Streams response messages to the returned channel
 //   - Automatically cleans up resources when done
 //
@@ -24,12 +27,37 @@ import (
 //   - All messages have been received (including the final ResultMessage)
 //   - An error occurs
 //   - The context is cancelled
+//   - No message arrives within options.QueryTimeout (see WithQueryTimeout); the
+//     CLI is terminated and the channel closes without a ResultMessage
+//
+// Follow-up questions:
+//
+// With WithContinueConversation(true), Query continues the most recent conversation in
+// the working directory instead of starting a new one. The final ResultMessage carries
+// the session ID, which can be passed to WithResume to chain further queries onto that
+// exact session:
+//
+//	opts := types.NewClaudeAgentOptions().WithContinueConversation(true)
+//	messages, _ := Query(ctx, "What did you change in the last run?", opts)
+//	// ... result.SessionID identifies the continued session
 //
 // Error handling:
 //   - Connection errors are returned immediately
-//   - Parse errors during message reading are sent to options.OnError callback if provided
+//   - Combining ContinueConversation with Resume returns a ValidationError
+//   - A line of output that is not valid JSON is delivered as a *types.ErrorMessage
+//     in its place, and reading continues
+//   - If the CLI's output ends before the result, e.g. because the CLI died, a
+//     *types.ErrorMessage carrying a *types.CLIConnectionError is the last message
 //   - Context cancellation is respected throughout
 //
+// Permission callbacks and hooks:
+//
+// When options.CanUseTool or options.Hooks are set, Query starts the control
+// protocol before sending the prompt, as a Client does: hooks are registered
+// with the CLI, and its permission requests and hook callbacks are answered
+// while the response streams. The CLI is still closed after the ResultMessage.
+// Initialization failures are returned as a *types.ControlProtocolError.
+//
 // Example usage:
 //
 //	ctx := context.Background()
@@ -64,23 +92,103 @@ import (
 //   - A read-only channel of Message types
 //   - An error if connection or initialization fails
 func Query(ctx context.Context, prompt string, options *types.ClaudeAgentOptions) (<-chan types.Message, error) {
-	// Use default options if not provided
-	if options == nil {
-		options = types.NewClaudeAgentOptions()
-	}
-
 	// Validate prompt
 	if prompt == "" {
 		return nil, fmt.Errorf("prompt cannot be empty")
 	}
+	options, err := prepareOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := startOneShot(ctx, prompt, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create output channel for user
+	outputChan := make(chan types.Message, 10)
+
+	// Start goroutine to read messages and forward to output channel
+	go func() {
+		defer close(outputChan)
+		defer func() {
+			run.close()
+		}()
+
+		fallbacks := 0
+		for {
+			// An attempt that may be retried is held back until the model answers,
+			// so a failed one is never seen
+			run.holding = fallbacks < len(options.ModelFallbacks)
+			result := run.forward(ctx, outputChan, options.QueryTimeout)
+			if result == nil {
+				return
+			}
+
+			// Retry on the next fallback model if the model itself was the problem
+			if run.holding && isModelUnavailableResult(result) && ctx.Err() == nil {
+				next := options.ModelFallbacks[fallbacks]
+				fallbacks++
+				run.logger.Warning("Model unavailable, falling back to %s (%d/%d)", next, fallbacks, len(options.ModelFallbacks))
 
+				fallbackOpts := *options
+				fallbackOpts.Model = &next
+				// The failed attempt is closed first, releasing its session lock
+				run.close()
+				nextRun, err := startOneShot(ctx, prompt, &fallbackOpts)
+				if err == nil {
+					run = nextRun
+					continue
+				}
+				run.logger.Error("Failed to start fallback query with model %s: %v", next, err)
+			}
+			run.release(ctx, outputChan)
+
+			if len(options.ModelFallbacks) > 0 {
+				if result.Meta == nil {
+					result.Meta = &types.ResultMeta{}
+				}
+				result.Meta.Model = run.model
+				result.Meta.Fallbacks = fallbacks
+			}
+
+			select {
+			case outputChan <- result:
+			case <-ctx.Done():
+			}
+			return
+		}
+	}()
+
+	return outputChan, nil
+}
+
+// oneShotRun holds the transport and query handler of a single one-shot attempt.
+type oneShotRun struct {
+	transport *transport.SubprocessCLITransport
+	handler   *internal.Query
+	logger    *log.Logger
+	model     string
+	streaming bool                   // The CLI has a control channel
+	lock      *transport.SessionLock // Held until close; nil without session locking
+	closeOnce sync.Once
+
+	// While holding, forward keeps messages in held instead of delivering them,
+	// until the model's first output shows the attempt will not be retried
+	holding bool
+	held    []types.Message
+}
+
+// startOneShot spawns the CLI, starts message processing and sends the prompt.
+func startOneShot(ctx context.Context, prompt string, options *types.ClaudeAgentOptions) (*oneShotRun, error) {
 	// Find Claude CLI path
 	cliPath := ""
 	if options.CLIPath != nil {
 		cliPath = *options.CLIPath
 	} else {
 		var err error
-		cliPath, err = transport.FindCLI()
+		cliPath, err = transport.FindCLIWithOptions(transport.NewDiscoveryOptions(options, log.NewLogger(options.Verbose)))
 		if err != nil {
 			return nil, err
 		}
@@ -89,7 +197,10 @@ func Query(ctx context.Context, prompt string, options *types.ClaudeAgentOptions
 	// Determine working directory
 	cwd := ""
 	if options.CWD != nil {
-		cwd = *options.CWD
+		var err error
+		if cwd, err = transport.ResolveCWD(*options.CWD); err != nil {
+			return nil, err
+		}
 	}
 
 	// Create transport with --print flag for non-streaming mode
@@ -100,9 +211,9 @@ func Query(ctx context.Context, prompt string, options *types.ClaudeAgentOptions
 		}
 	}
 
-	// Create logger with verbosity from options
-	verbose := options != nil && options.Verbose
-	logger := log.NewLogger(verbose)
+	// Create logger with verbosity from options, and an ID telling this
+	// query apart from others in the process
+	logger := log.NewLogger(options.Verbose).WithField("conn", log.NewConnectionID())
 
 	// Determine resume session ID from options
 	resumeID := ""
@@ -110,23 +221,57 @@ func Query(ctx context.Context, prompt string, options *types.ClaudeAgentOptions
 		resumeID = *options.Resume
 	}
 
+	// Lock the resumed session against concurrent resumption, if enabled
+	lock, err := transport.LockSession(ctx, options, cwd, resumeID, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create subprocess transport with optional resume and options
 	transportInst := transport.NewSubprocessCLITransport(cliPath, cwd, env, logger, resumeID, options)
 
 	// Connect to CLI
 	if err := transportInst.Connect(ctx); err != nil {
-		return nil, types.NewCLIConnectionErrorWithCause("failed to connect to Claude CLI", err)
+		_ = lock.Release()
+		return nil, types.WithConnectionID(types.NewCLIConnectionErrorWithCause("failed to connect to Claude CLI", err), logger.Field("conn"))
 	}
 
-	// Create query handler (non-streaming mode)
-	queryHandler := internal.NewQuery(ctx, transportInst, options, logger, false)
+	// Callbacks are answered over the control protocol, which needs streaming
+	// mode; without them the query handler only reads messages
+	streaming := usesControlProtocol(options)
+	queryHandler := internal.NewQuery(ctx, transportInst, options, logger, streaming)
 
 	// Start message processing
 	if err := queryHandler.Start(ctx); err != nil {
-		_ = transportInst.Close(ctx)
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), queryCleanupTimeout)
+		_ = transportInst.Close(cleanupCtx)
+		cancel()
+		_ = lock.Release()
 		return nil, err
 	}
 
+	run := &oneShotRun{
+		transport: transportInst,
+		handler:   queryHandler,
+		logger:    logger,
+		streaming: streaming,
+		lock:      lock,
+	}
+	if options.Model != nil {
+		run.model = *options.Model
+	}
+
+	// Register hooks before the prompt, so they see its first tool use
+	if streaming {
+		initCtx, cancel := context.WithTimeout(ctx, initializeTimeout)
+		_, err := queryHandler.Initialize(initCtx)
+		cancel()
+		if err != nil {
+			run.close()
+			return nil, types.WithConnectionID(types.NewControlProtocolErrorWithCause("failed to initialize control protocol", err), logger.Field("conn"))
+		}
+	}
+
 	// Use resume ID as session ID, or default if not resuming
 	sessionID := "default-session"
 	if resumeID != "" {
@@ -135,66 +280,186 @@ func Query(ctx context.Context, prompt string, options *types.ClaudeAgentOptions
 
 	// Build the query message to send to CLI
 	// Format matches Python SDK: type, message{role,content}, parent_tool_use_id, session_id
-	queryMsg := map[string]interface{}{
-		"type": "user",
-		"message": map[string]interface{}{
-			"role":    "user",
-			"content": prompt,
-		},
-		"parent_tool_use_id": nil,
-		"session_id":         sessionID,
-	}
-
-	// Marshal and send
-	data, err := json.Marshal(queryMsg)
+	data, err := internal.MarshalUserMessage(prompt, sessionID)
 	if err != nil {
-		_ = queryHandler.Stop(ctx)
-		_ = transportInst.Close(ctx)
+		run.close()
 		return nil, types.NewControlProtocolErrorWithCause("failed to marshal query", err)
 	}
 
 	if err := transportInst.Write(ctx, string(data)); err != nil {
-		_ = queryHandler.Stop(ctx)
-		_ = transportInst.Close(ctx)
+		run.close()
 		return nil, err
 	}
+	queryHandler.BeginTurn(sessionID)
 
-	// Create output channel for user
-	outputChan := make(chan types.Message, 10)
+	return run, nil
+}
 
-	// Start goroutine to read messages and forward to output channel
-	go func() {
-		defer close(outputChan)
-		defer func() {
-			_ = queryHandler.Stop(ctx)
-			_ = transportInst.Close(ctx)
-		}()
+// usesControlProtocol reports whether a one-shot query with options has
+// callbacks for the CLI to call.
+func usesControlProtocol(options *types.ClaudeAgentOptions) bool {
+	return options.CanUseTool != nil || len(options.Hooks) > 0
+}
 
-		messagesChan := queryHandler.GetMessages(ctx)
+// forward delivers messages to out until a ResultMessage arrives, which is
+// returned without being delivered. It returns nil if the stream ends, the
+// context is cancelled or no message arrives within a positive timeout first;
+// a timeout is delivered as an ErrorMessage with a *types.TimeoutError. While
+// the run is holding, messages are kept until the model's first output, which
+// releases them and ends holding.
+func (r *oneShotRun) forward(ctx context.Context, out chan<- types.Message, timeout time.Duration) *types.ResultMessage {
+	messagesChan := r.handler.GetMessages(ctx)
+	idle := newIdleTimer(timeout)
+	defer idle.stop()
+	tracker := internal.NewTurnTracker()
 
-		for {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-idle.expired():
+			timeoutErr := types.NewTimeoutError(timeout)
+			timeoutErr.Context = tracker.Context()
+			r.logger.Warning("%v; terminating query", timeoutErr)
+			r.interrupt(ctx)
+			r.transport.OnError(timeoutErr)
+			r.release(ctx, out)
 			select {
+			case out <- types.NewErrorMessage(timeoutErr):
 			case <-ctx.Done():
-				return
-			case msg, ok := <-messagesChan:
-				if !ok {
-					// Messages channel closed
-					return
+			}
+			return nil
+		case msg, ok := <-messagesChan:
+			if !ok {
+				// Messages channel closed before the result
+				r.release(ctx, out)
+				if err := r.streamEndError(ctx); err != nil {
+					select {
+					case out <- types.NewErrorMessage(err):
+					case <-ctx.Done():
+					}
 				}
+				return nil
+			}
+			idle.reset()
+			tracker.Observe(msg)
 
-				// Forward message to output
-				select {
-				case outputChan <- msg:
-					// Check if this is a result message (end of query)
-					if _, isResult := msg.(*types.ResultMessage); isResult {
-						return
-					}
-				case <-ctx.Done():
-					return
+			// The result ends the attempt; the caller decides whether to deliver it
+			if result, isResult := msg.(*types.ResultMessage); isResult {
+				return result
+			}
+
+			if r.holding {
+				if !isModelOutput(msg) {
+					r.held = append(r.held, msg)
+					continue
 				}
+				r.release(ctx, out)
+			}
+
+			// Forward message to output
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return nil
 			}
 		}
-	}()
+	}
+}
 
-	return outputChan, nil
+// release delivers the held messages to out and ends holding.
+func (r *oneShotRun) release(ctx context.Context, out chan<- types.Message) {
+	held := r.held
+	r.holding, r.held = false, nil
+	for _, msg := range held {
+		select {
+		case out <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// isModelOutput reports whether msg was produced by the model, as opposed to
+// the CLI's own messages and the synthetic assistant message it reports an API
+// error with.
+func isModelOutput(msg types.Message) bool {
+	switch m := msg.(type) {
+	case *types.StreamEvent:
+		return true
+	case *types.AssistantMessage:
+		return m.Model != "<synthetic>"
+	}
+	return false
+}
+
+// interrupt asks the CLI to stop the turn before the run is closed, when it has
+// a control channel; without one the CLI is stopped by closing the run. It is
+// best effort and bounded by closeInterruptTimeout.
+func (r *oneShotRun) interrupt(ctx context.Context) {
+	if !r.streaming {
+		return
+	}
+	interruptCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), closeInterruptTimeout)
+	defer cancel()
+	if err := r.handler.Interrupt(interruptCtx); err != nil {
+		r.logger.Debug("Interrupting the timed out query failed: %v", err)
+	}
+}
+
+// streamEndError returns the error reported when the CLI's output ended before
+// the result (see the package-level streamEndError). It returns nil if ctx is
+// done or the handler stopped delivery itself.
+func (r *oneShotRun) streamEndError(ctx context.Context) error {
+	if ctx.Err() != nil || r.handler.Err() != nil {
+		return nil
+	}
+	err := streamEndError(r.transport, "the CLI's output ended before the query's result")
+	return types.WithConnectionID(err, r.logger.Field("conn"))
+}
+
+// queryCleanupTimeout bounds tearing down a one-shot attempt: waiting for its
+// message loop to exit and for the CLI to be reaped.
+var queryCleanupTimeout = 5 * time.Second
+
+// close stops the query handler and terminates the subprocess. The teardown
+// does not use the caller's context, which is often cancelled by now: with
+// it, the handler would stop waiting for its message loop and leave the
+// goroutines behind. It is bounded by queryCleanupTimeout instead.
+func (r *oneShotRun) close() {
+	r.closeOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), queryCleanupTimeout)
+		defer cancel()
+		if err := r.handler.Close(ctx); err != nil {
+			r.logger.Debug("Closing query: %v", err)
+		}
+		if err := r.lock.Release(); err != nil {
+			r.logger.Warning("Failed to release session lock: %v", err)
+		}
+	})
+}
+
+// modelUnavailableMarkers are substrings of error results caused by the model
+// being overloaded or unavailable rather than by the request itself. The API's
+// generic not_found_error counts only when it is about the model.
+var modelUnavailableMarkers = []string{
+	"overloaded",
+	"model_not_found",
+	"model not found",
+}
+
+// isModelUnavailableResult reports whether an error result was caused by the
+// model being overloaded or unavailable. Any other failure returns false.
+func isModelUnavailableResult(result *types.ResultMessage) bool {
+	if result == nil || !result.IsError || result.Result == nil {
+		return false
+	}
+
+	text := strings.ToLower(*result.Result)
+	for _, marker := range modelUnavailableMarkers {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return strings.Contains(text, "not_found_error") && strings.Contains(text, "model")
 }
@@ -2,6 +2,13 @@ package claude
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -54,6 +61,17 @@ func TestQuery_CLINotFound(t *testing.T) {
 	}
 }
 
+func TestQuery_MissingCWD(t *testing.T) {
+	missing := t.TempDir() + "/missing"
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, "exit 0")).
+		WithCWD(missing)
+
+	if _, err := Query(context.Background(), "test prompt", opts); !types.IsValidationError(err) {
+		t.Errorf("Query() error = %v, want ValidationError for the missing directory", err)
+	}
+}
+
 func TestQuery_ContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
@@ -161,3 +179,617 @@ func BenchmarkQuery(b *testing.B) {
 		_, _ = Query(ctx, "test", opts)
 	}
 }
+
+// fallbackCLI fails with an overload error for models prefixed "bad", with a
+// non-model error for "broken", and answers normally for everything else.
+const fallbackCLI = `
+model=""
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--model" ]; then model="$2"; fi
+  shift
+done
+read line
+overloaded='{"type":"result","subtype":"success","is_error":true,"result":"API Error: 529 {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}","session_id":"s-'$model'"}'
+echo '{"type":"system","subtype":"init","session_id":"s-'$model'","model":"'$model'"}'
+case "$model" in
+  bad*)
+    echo '{"type":"assistant","message":{"model":"<synthetic>","content":[{"type":"text","text":"API Error: 529 Overloaded"}]},"session_id":"s-'$model'"}'
+    echo "$overloaded"
+    ;;
+  late)
+    echo '{"type":"assistant","message":{"model":"late","content":[{"type":"text","text":"Let me check."}]},"session_id":"s-late"}'
+    echo "$overloaded"
+    ;;
+  broken)
+    echo '{"type":"result","subtype":"error_max_turns","is_error":true,"result":"Reached maximum number of turns","session_id":"s-broken"}'
+    ;;
+  *)
+    echo '{"type":"assistant","message":{"model":"'$model'","content":[{"type":"text","text":"4"}]}}'
+    echo '{"type":"result","subtype":"success","is_error":false,"result":"4","session_id":"s-'$model'"}'
+    ;;
+esac
+`
+
+func lastResult(t *testing.T, messages []types.Message) *types.ResultMessage {
+	t.Helper()
+
+	if len(messages) == 0 {
+		t.Fatal("expected at least one message")
+	}
+	result, ok := messages[len(messages)-1].(*types.ResultMessage)
+	if !ok {
+		t.Fatalf("expected last message to be ResultMessage, got %T", messages[len(messages)-1])
+	}
+	return result
+}
+
+func TestQuery_ModelFallback(t *testing.T) {
+	ctx := testContext(t, 10*time.Second)
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, fallbackCLI)).
+		WithModel("bad-primary").
+		WithModelFallbacks("backup")
+
+	messages, err := Query(ctx, "What is 2+2?", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	collected := collectMessages(t, messages, 5*time.Second)
+	for _, msg := range collected[:len(collected)-1] {
+		if _, ok := msg.(*types.ResultMessage); ok {
+			t.Error("failed attempt's ResultMessage should not be delivered")
+		}
+		if sessionID := types.MessageSessionID(msg); sessionID != "" && sessionID != "s-backup" {
+			t.Errorf("failed attempt's %s message of session %s was delivered", msg.GetMessageType(), sessionID)
+		}
+	}
+	var inits int
+	for _, msg := range collected {
+		if system, ok := msg.(*types.SystemMessage); ok && system.IsInit() {
+			inits++
+		}
+	}
+	if inits != 1 {
+		t.Errorf("got %d init messages, want 1", inits)
+	}
+
+	result := lastResult(t, collected)
+	if result.IsError {
+		t.Errorf("expected successful result after fallback, got error: %v", *result.Result)
+	}
+	if result.Meta == nil {
+		t.Fatal("expected result Meta to be populated")
+	}
+	if result.Meta.Model != "backup" {
+		t.Errorf("Meta.Model = %q, want %q", result.Meta.Model, "backup")
+	}
+	if result.Meta.Fallbacks != 1 {
+		t.Errorf("Meta.Fallbacks = %d, want 1", result.Meta.Fallbacks)
+	}
+}
+
+func TestQuery_ModelFallbackExhausted(t *testing.T) {
+	ctx := testContext(t, 10*time.Second)
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, fallbackCLI)).
+		WithModel("bad-primary").
+		WithModelFallbacks("bad-secondary", "bad-tertiary")
+
+	messages, err := Query(ctx, "What is 2+2?", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	result := lastResult(t, collectMessages(t, messages, 5*time.Second))
+	if !result.IsError {
+		t.Error("expected error result when every fallback fails")
+	}
+	if result.Meta == nil || result.Meta.Model != "bad-tertiary" || result.Meta.Fallbacks != 2 {
+		t.Errorf("unexpected Meta: %+v", result.Meta)
+	}
+}
+
+// TestQuery_ModelFallbackAfterOutput tests that a query is not retried once the
+// model has answered, even if it then becomes unavailable.
+func TestQuery_ModelFallbackAfterOutput(t *testing.T) {
+	ctx := testContext(t, 10*time.Second)
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, fallbackCLI)).
+		WithModel("late").
+		WithModelFallbacks("backup")
+
+	messages, err := Query(ctx, "What is 2+2?", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	collected := collectMessages(t, messages, 5*time.Second)
+	result := lastResult(t, collected)
+	if !result.IsError || result.Meta == nil || result.Meta.Model != "late" || result.Meta.Fallbacks != 0 {
+		t.Errorf("result = %+v with Meta %+v, want the late model's error without fallback", result, result.Meta)
+	}
+	var answered bool
+	for _, msg := range collected {
+		if assistant, ok := msg.(*types.AssistantMessage); ok && assistant.Model == "late" {
+			answered = true
+		}
+	}
+	if !answered {
+		t.Error("the model's answer before the error was not delivered")
+	}
+}
+
+func TestQuery_NonModelErrorDoesNotFallBack(t *testing.T) {
+	ctx := testContext(t, 10*time.Second)
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, fallbackCLI)).
+		WithModel("broken").
+		WithModelFallbacks("backup")
+
+	messages, err := Query(ctx, "What is 2+2?", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	result := lastResult(t, collectMessages(t, messages, 5*time.Second))
+	if result.Subtype != "error_max_turns" {
+		t.Errorf("Subtype = %q, want error_max_turns", result.Subtype)
+	}
+	if result.Meta == nil || result.Meta.Fallbacks != 0 || result.Meta.Model != "broken" {
+		t.Errorf("unexpected Meta: %+v", result.Meta)
+	}
+}
+
+func TestIsModelUnavailableResult(t *testing.T) {
+	text := func(s string) *string { return &s }
+
+	tests := []struct {
+		name   string
+		result *types.ResultMessage
+		want   bool
+	}{
+		{"nil result", nil, false},
+		{"success", &types.ResultMessage{Result: text("overloaded")}, false},
+		{"overloaded", &types.ResultMessage{IsError: true, Result: text(`API Error: 529 {"type":"overloaded_error"}`)}, true},
+		{"model not found", &types.ResultMessage{IsError: true, Result: text(`API Error: 404 {"type":"not_found_error","message":"model: claude-x"}`)}, true},
+		{"other not found", &types.ResultMessage{IsError: true, Result: text(`API Error: 404 {"type":"not_found_error","message":"file_abc not found"}`)}, false},
+		{"max turns", &types.ResultMessage{IsError: true, Result: text("Reached maximum number of turns")}, false},
+		{"no result text", &types.ResultMessage{IsError: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isModelUnavailableResult(tt.result); got != tt.want {
+				t.Errorf("isModelUnavailableResult() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// partialCLI emits a stream_event before the final messages only when started
+// with --include-partial-messages, like the real CLI.
+const partialCLI = `
+partial=""
+for arg in "$@"; do
+  if [ "$arg" = "--include-partial-messages" ]; then partial=1; fi
+done
+read line
+if [ -n "$partial" ]; then
+  echo '{"type":"stream_event","uuid":"u-1","session_id":"s-1","event":{"type":"content_block_delta","delta":{"type":"text_delta","text":"4"}}}'
+fi
+echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"4"}]}}'
+echo '{"type":"result","subtype":"success","is_error":false,"result":"4","session_id":"s-1"}'
+`
+
+func TestQuery_IncludePartialMessages(t *testing.T) {
+	for _, include := range []bool{true, false} {
+		ctx := testContext(t, 10*time.Second)
+		opts := types.NewClaudeAgentOptions().
+			WithCLIPath(writeMockCLI(t, partialCLI)).
+			WithIncludePartialMessages(include)
+
+		messages, err := Query(ctx, "What is 2+2?", opts)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+
+		var events []*types.StreamEvent
+		for _, msg := range collectMessages(t, messages, 5*time.Second) {
+			if event, ok := msg.(*types.StreamEvent); ok {
+				events = append(events, event)
+			}
+		}
+
+		if !include {
+			if len(events) != 0 {
+				t.Errorf("got %d stream events with partial messages disabled", len(events))
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Fatalf("got %d stream events, want 1", len(events))
+		}
+		if events[0].Event["type"] != "content_block_delta" || events[0].SessionID != "s-1" {
+			t.Errorf("unexpected stream event: %+v", events[0])
+		}
+	}
+}
+
+// continueCLI records the most recent session in the working directory, so
+// --continue picks it up the way the real CLI resolves the project's latest
+// conversation, and --resume selects an exact session.
+const continueCLI = `
+mode="new"
+session=""
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --continue) mode="continue" ;;
+    --resume) mode="resume"; session="$2" ;;
+  esac
+  shift
+done
+read line
+case "$mode" in
+  continue) session=$(cat last-session) ;;
+  new) session="s-$$" ;;
+esac
+echo "$session" > last-session
+echo '{"type":"result","subtype":"success","is_error":false,"result":"'$mode'","session_id":"'$session'"}'
+`
+
+func TestQuery_ContinueConversation(t *testing.T) {
+	ctx := testContext(t, 10*time.Second)
+	cli := writeMockCLI(t, continueCLI)
+	project := t.TempDir()
+
+	first, err := Query(ctx, "Write a haiku", types.NewClaudeAgentOptions().WithCLIPath(cli).WithCWD(project))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	started := lastResult(t, collectMessages(t, first, 5*time.Second))
+	if started.SessionID == "" {
+		t.Fatal("expected initial result to carry a session ID")
+	}
+
+	// A follow-up with --continue lands in the same session
+	followUp, err := Query(ctx, "Make it rhyme", types.NewClaudeAgentOptions().
+		WithCLIPath(cli).
+		WithCWD(project).
+		WithContinueConversation(true))
+	if err != nil {
+		t.Fatalf("continued Query failed: %v", err)
+	}
+	continued := lastResult(t, collectMessages(t, followUp, 5*time.Second))
+	if continued.Result == nil || *continued.Result != "continue" {
+		t.Fatalf("expected the CLI to receive --continue, got result %v", continued.Result)
+	}
+	if continued.SessionID != started.SessionID {
+		t.Errorf("continued SessionID = %q, want %q", continued.SessionID, started.SessionID)
+	}
+
+	// The continued session ID chains into an explicit resume
+	chained, err := Query(ctx, "Translate it", types.NewClaudeAgentOptions().
+		WithCLIPath(cli).
+		WithCWD(project).
+		WithResume(continued.SessionID))
+	if err != nil {
+		t.Fatalf("resumed Query failed: %v", err)
+	}
+	resumed := lastResult(t, collectMessages(t, chained, 5*time.Second))
+	if resumed.SessionID != started.SessionID {
+		t.Errorf("resumed SessionID = %q, want %q", resumed.SessionID, started.SessionID)
+	}
+}
+
+func TestQuery_ContinueConversationWithResume(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, continueCLI)).
+		WithContinueConversation(true).
+		WithResume("s-123")
+
+	_, err := Query(ctx, "hello", opts)
+	if !types.IsValidationError(err) {
+		t.Fatalf("Query error = %v, want ValidationError", err)
+	}
+}
+
+// sharedOptionsCLI reports the environment variable and extra flag it was
+// given, so each run can check it saw the shared options unchanged.
+const sharedOptionsCLI = `
+tag=""
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--tag" ]; then tag="$2"; fi
+  shift
+done
+read line
+echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"'$SHARED_VALUE'"}]}}'
+echo '{"type":"result","subtype":"success","is_error":false,"result":"'$tag'","session_id":"s-shared"}'
+`
+
+func TestQuery_ConcurrentSharedOptions(t *testing.T) {
+	ctx := testContext(t, 20*time.Second)
+	tag := "shared"
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, sharedOptionsCLI)).
+		WithEnvVar("SHARED_VALUE", "from-env").
+		WithExtraArg("tag", &tag).
+		WithModelFallbacks("backup")
+
+	const queries = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, queries)
+	for i := 0; i < queries; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			messages, err := Query(ctx, fmt.Sprintf("query %d", i), opts)
+			if err != nil {
+				errs <- fmt.Errorf("query %d: %w", i, err)
+				return
+			}
+			var text, result string
+			for msg := range messages {
+				switch m := msg.(type) {
+				case *types.AssistantMessage:
+					if tb, ok := m.Content[0].(*types.TextBlock); ok {
+						text = tb.Text
+					}
+				case *types.ResultMessage:
+					if m.Result != nil {
+						result = *m.Result
+					}
+				}
+			}
+			if text != "from-env" || result != "shared" {
+				errs <- fmt.Errorf("query %d: got text %q and result %q, want %q and %q", i, text, result, "from-env", "shared")
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if len(opts.Env) != 1 || len(opts.ExtraArgs) != 1 {
+		t.Errorf("shared options were modified: Env=%v ExtraArgs=%v", opts.Env, opts.ExtraArgs)
+	}
+}
+
+// TestQuery_StreamErrors tests that one-shot callers see malformed output and
+// the CLI dying mid-query as ErrorMessages.
+func TestQuery_StreamErrors(t *testing.T) {
+	ctx := testContext(t, 10*time.Second)
+	opts := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, brokenCLI))
+
+	messages, err := Query(ctx, "garbled", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	collected := collectMessages(t, messages, 5*time.Second)
+	if errMsg, ok := collected[0].(*types.ErrorMessage); !ok || !types.IsJSONDecodeError(errMsg) {
+		t.Errorf("first message = %#v, want an ErrorMessage wrapping a JSONDecodeError", collected[0])
+	}
+	lastResult(t, collected)
+
+	messages, err = Query(ctx, "crash", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	collected = collectMessages(t, messages, 5*time.Second)
+	if errMsg, ok := collected[len(collected)-1].(*types.ErrorMessage); !ok || !types.IsCLIConnectionError(errMsg) {
+		t.Errorf("last message = %#v, want an ErrorMessage wrapping a CLIConnectionError", collected[len(collected)-1])
+	}
+}
+
+// TestQuery_CancelledCleanup tests that a query cancelled mid-stream tears
+// down its goroutines and the CLI within queryCleanupTimeout, although the
+// cancelled context can no longer bound the teardown.
+func TestQuery_CancelledCleanup(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, `
+echo '{"type":"assistant","message":{"role":"assistant","model":"m","content":[{"type":"text","text":"working"}]}}'
+sleep 30
+`))
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		messages, err := Query(ctx, "hi", opts)
+		if err != nil {
+			cancel()
+			t.Fatalf("Query failed: %v", err)
+		}
+		<-messages
+		cancel()
+		collectMessages(t, messages, queryCleanupTimeout)
+	}
+
+	deadline := time.Now().Add(queryCleanupTimeout)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left behind, %d before:\n%s", runtime.NumGoroutine()-baseline, baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// callbackCLI answers one prompt after running the hook registered at
+// initialize and, when started with a permission prompt tool, asking to use
+// Bash. Its answer reports what the SDK replied.
+const callbackCLI = `
+hook="no hook"
+permission="not asked"
+while read line; do
+  case "$line" in
+    *'"subtype":"initialize"'*)
+      case "$line" in *hook_1*) hooked=yes ;; esac
+      id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+      echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+      ;;
+    *'"type":"user"'*)
+      if [ "$hooked" = yes ]; then
+        echo '{"type":"control_request","request_id":"cli-1","request":{"subtype":"hook_callback","callback_id":"hook_1","input":{"hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls"}}}}'
+        read reply
+        case "$reply" in *'"continue":true'*) hook="hook ran" ;; *) hook="hook failed" ;; esac
+      fi
+      case "$*" in *"--permission-prompt-tool stdio"*)
+        echo '{"type":"control_request","request_id":"cli-2","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"ls"}}}'
+        read reply
+        case "$reply" in *'"behavior":"allow"'*) permission="allowed" ;; *) permission="denied" ;; esac
+        ;;
+      esac
+      echo '{"type":"assistant","message":{"role":"assistant","model":"m","content":[{"type":"text","text":"'"$hook, $permission"'"}]}}'
+      echo '{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s-1"}'
+      ;;
+  esac
+done
+`
+
+// TestQuery_Callbacks tests that a one-shot query with hooks or a permission
+// callback starts the control protocol and answers the CLI's requests.
+func TestQuery_Callbacks(t *testing.T) {
+	cli := writeMockCLI(t, callbackCLI)
+	hookCalls := make(chan string, 1)
+	hook := types.HookMatcher{Hooks: []types.HookCallbackFunc{
+		func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+			hookCalls <- hookCtx.ToolName
+			return map[string]interface{}{"continue": true}, nil
+		},
+	}}
+	deny := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+		return types.PermissionResultDeny{Behavior: "deny", Message: "not in tests"}, nil
+	}
+
+	tests := []struct {
+		name     string
+		opts     *types.ClaudeAgentOptions
+		want     string
+		wantHook bool
+	}{
+		{"no callbacks", types.NewClaudeAgentOptions(), "no hook, not asked", false},
+		{"hook", types.NewClaudeAgentOptions().WithHook(types.HookEventPreToolUse, hook), "hook ran, not asked", true},
+		{"permission callback", types.NewClaudeAgentOptions().WithCanUseTool(deny), "no hook, denied", false},
+		{"both", types.NewClaudeAgentOptions().WithHook(types.HookEventPreToolUse, hook).WithCanUseTool(deny), "hook ran, denied", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext(t, 10*time.Second)
+			messages, err := Query(ctx, "list files", tt.opts.WithCLIPath(cli))
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			collected := collectMessages(t, messages, 5*time.Second)
+			lastResult(t, collected)
+
+			var text string
+			for _, msg := range collected {
+				if assistant, ok := msg.(*types.AssistantMessage); ok {
+					text += assistant.Content[0].(*types.TextBlock).Text
+				}
+			}
+			if text != tt.want {
+				t.Errorf("CLI answered %q, want %q", text, tt.want)
+			}
+
+			select {
+			case toolName := <-hookCalls:
+				if !tt.wantHook || toolName != "Bash" {
+					t.Errorf("hook called for %q, want a call: %v", toolName, tt.wantHook)
+				}
+			default:
+				if tt.wantHook {
+					t.Error("hook not called")
+				}
+			}
+		})
+	}
+}
+
+// TestQuery_CallbacksInitializeFailure tests that a one-shot query whose
+// control protocol cannot be initialized fails without sending the prompt.
+func TestQuery_CallbacksInitializeFailure(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, `
+read line
+id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+echo '{"type":"control_response","response":{"subtype":"error","request_id":"'$id'","error":"hooks are not supported"}}'
+read line
+echo '{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s-1"}'
+`)).WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+		return types.PermissionResultAllow{Behavior: "allow"}, nil
+	})
+
+	_, err := Query(testContext(t, 10*time.Second), "list files", opts)
+	if !types.IsControlProtocolError(err) {
+		t.Errorf("Query error = %v, want a ControlProtocolError", err)
+	}
+}
+
+// TestQuery_Timeout tests that a one-shot query that goes quiet for longer
+// than QueryTimeout ends with a TimeoutError, and that a CLI with a control
+// channel is interrupted first.
+func TestQuery_Timeout(t *testing.T) {
+	// The CLI answers control requests, logging them, but never the prompt
+	cli := writeMockCLI(t, `
+while read line; do
+  case "$line" in
+    *control_request*)
+      echo "$line" >> "$CLI_LOG"
+      id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+      echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+      ;;
+    *'"type":"user"'*)
+      echo '{"type":"assistant","message":{"role":"assistant","model":"m","content":[{"type":"text","text":"Thinking it over"}]}}'
+      ;;
+  esac
+done
+`)
+	allow := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+		return types.PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	options := func(t *testing.T) (*types.ClaudeAgentOptions, string) {
+		logPath := filepath.Join(t.TempDir(), "cli.log")
+		return types.NewClaudeAgentOptions().
+			WithCLIPath(cli).
+			WithEnvVar("CLI_LOG", logPath).
+			WithQueryTimeout(200 * time.Millisecond), logPath
+	}
+	interrupted := func(logPath string) bool {
+		data, _ := os.ReadFile(logPath)
+		return strings.Contains(string(data), `"subtype":"interrupt"`)
+	}
+
+	t.Run("QueryText", func(t *testing.T) {
+		opts, logPath := options(t)
+		_, result, err := QueryText(testContext(t, 10*time.Second), "take your time", opts)
+		var timeoutErr *types.TimeoutError
+		if !errors.As(err, &timeoutErr) {
+			t.Fatalf("QueryText error = %v, want a TimeoutError", err)
+		}
+		if result != nil {
+			t.Errorf("result = %+v, want none", result)
+		}
+		if timeoutErr.Timeout != 200*time.Millisecond || timeoutErr.Context == nil || timeoutErr.Context.AssistantText != "Thinking it over" {
+			t.Errorf("TimeoutError = %+v, want the timeout and partial output", timeoutErr)
+		}
+		if interrupted(logPath) {
+			t.Error("interrupt sent without a control channel")
+		}
+	})
+
+	t.Run("QueryCollect with callbacks", func(t *testing.T) {
+		opts, logPath := options(t)
+		collected, err := QueryCollect(testContext(t, 10*time.Second), "take your time", opts.WithCanUseTool(allow))
+		if !types.IsTimeoutError(err) {
+			t.Fatalf("QueryCollect error = %v, want a TimeoutError", err)
+		}
+		if collected.Text != "Thinking it over" || collected.Result != nil {
+			t.Errorf("collected %q %+v, want the partial text without a result", collected.Text, collected.Result)
+		}
+		if !interrupted(logPath) {
+			t.Error("CLI not interrupted before the query was torn down")
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// queuedPrompt is a prompt waiting in the queue of Client.Enqueue.
+type queuedPrompt struct {
+	ctx    context.Context
+	prompt string
+	onDone func(TurnResult)
+	stop   func() bool // Stops watching ctx for cancellation
+}
+
+// Enqueue appends prompt to the client's queue of prompts, which are sent one
+// turn at a time: each is sent once the previous one's ResultMessage has
+// arrived, like the turns of RunScript. It returns once the prompt is queued.
+//
+// onDone, which may be nil, is called once per prompt: with the completed
+// turn, from the queue's goroutine in queue order, or with the error of a
+// prompt that was never sent. A turn that failed has a non-nil Err, as
+// described for TurnResult. A prompt that is never sent gets a
+// *types.PromptAbandonedError:
+//   - when ctx ends while the prompt is queued; ctx also bounds the turn, along
+//     with ScriptTurnTimeout
+//   - for every queued prompt when CancelQueued is called
+//   - for every queued prompt when Interrupt is called; the turn in flight ends
+//     with its interrupted result as usual
+//   - for every queued prompt when the client is closed (Close, Shutdown, or
+//     the idle timeout), matching types.ErrClientClosed; Shutdown still lets the
+//     turn in flight finish
+//
+// The queue consumes the client's responses: do not call Query or
+// ReceiveResponse while prompts are queued or in flight. It fails with
+// types.ErrListenerConsumer when listeners are registered, and with a
+// *types.CLIConnectionError when the client is not connected.
+//
+// Example:
+//
+//	for _, prompt := range []string{"Run the tests", "Fix the failures", "Summarize the fixes"} {
+//	    err := client.Enqueue(ctx, prompt, func(turn claude.TurnResult) {
+//	        if turn.Err != nil {
+//	            log.Printf("%q failed: %v", turn.Prompt, turn.Err)
+//	            return
+//	        }
+//	        fmt.Println(turn.Text)
+//	    })
+//	    if err != nil {
+//	        log.Fatal(err)
+//	    }
+//	}
+func (c *Client) Enqueue(ctx context.Context, prompt string, onDone func(turn TurnResult)) error {
+	if prompt == "" {
+		return fmt.Errorf("prompt cannot be empty")
+	}
+
+	item := &queuedPrompt{ctx: ctx, prompt: prompt, onDone: onDone}
+	// A prompt cancelled before it is queued is abandoned by the queue itself
+	item.stop = context.AfterFunc(ctx, func() {
+		if c.removeQueued(item) {
+			c.finishQueued(item, TurnResult{Prompt: prompt, Err: types.NewPromptAbandonedError(prompt, "cancelled", ctx.Err())})
+		}
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected || c.query == nil {
+		item.stop()
+		return c.notConnectedError()
+	}
+	if c.listeners != nil {
+		item.stop()
+		return types.ErrListenerConsumer
+	}
+	c.channelConsumer = true
+	c.queue = append(c.queue, item)
+	if !c.queueRunning {
+		c.queueRunning = true
+		go c.runQueue()
+	}
+	return nil
+}
+
+// Pending returns the number of prompts waiting in the queue of Enqueue, not
+// counting the one whose turn is in flight.
+func (c *Client) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queue)
+}
+
+// CancelQueued abandons every prompt waiting in the queue of Enqueue, with a
+// *types.PromptAbandonedError matching context.Canceled, and returns how many
+// there were. The turn in flight, if any, is not affected; use Interrupt to
+// stop it too.
+func (c *Client) CancelQueued() int {
+	return c.abandonQueued("cancelled", context.Canceled)
+}
+
+// runQueue runs the queued prompts' turns in order until the queue is empty.
+func (c *Client) runQueue() {
+	for {
+		c.mu.Lock()
+		if len(c.queue) == 0 {
+			c.queueRunning = false
+			c.mu.Unlock()
+			return
+		}
+		item := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+
+		item.stop()
+		if err := item.ctx.Err(); err != nil {
+			c.finishQueued(item, TurnResult{Prompt: item.prompt, Err: types.NewPromptAbandonedError(item.prompt, "cancelled", err)})
+			continue
+		}
+		c.finishQueued(item, runScriptTurn(item.ctx, c, item.prompt, c.options))
+	}
+}
+
+// removeQueued removes item from the queue, reporting whether it was there.
+func (c *Client) removeQueued(item *queuedPrompt) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, queued := range c.queue {
+		if queued == item {
+			c.queue = append(c.queue[:i:i], c.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// abandonQueued empties the queue, calling each prompt's onDone with a
+// *types.PromptAbandonedError for reason and cause, and returns how many
+// prompts were abandoned.
+func (c *Client) abandonQueued(reason string, cause error) int {
+	c.mu.Lock()
+	abandoned := c.queue
+	c.queue = nil
+	c.mu.Unlock()
+
+	c.finishAbandoned(abandoned, reason, cause)
+	return len(abandoned)
+}
+
+// finishAbandoned calls the onDone of prompts taken off the queue with a
+// *types.PromptAbandonedError for reason and cause.
+func (c *Client) finishAbandoned(abandoned []*queuedPrompt, reason string, cause error) {
+	for _, item := range abandoned {
+		item.stop()
+		c.finishQueued(item, TurnResult{Prompt: item.prompt, Err: types.NewPromptAbandonedError(item.prompt, reason, cause)})
+	}
+}
+
+// finishQueued calls item's onDone with its turn, isolating the queue from its
+// panics.
+func (c *Client) finishQueued(item *queuedPrompt, turn TurnResult) {
+	if item.onDone != nil {
+		c.callListener(func() { item.onDone(turn) })
+	}
+}
@@ -0,0 +1,229 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// turnLog receives the turns of queued prompts from their onDone callbacks.
+type turnLog chan TurnResult
+
+func (l turnLog) onDone(turn TurnResult) { l <- turn }
+
+// next returns the next finished prompt.
+func (l turnLog) next(t *testing.T) TurnResult {
+	t.Helper()
+	select {
+	case turn := <-l:
+		return turn
+	case <-time.After(5 * time.Second):
+		t.Fatal("onDone not called")
+		return TurnResult{}
+	}
+}
+
+// waitPending waits until n prompts are waiting in the client's queue.
+func waitPending(t *testing.T, client *Client, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Pending() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Pending() = %d, want %d", client.Pending(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitWritten waits until n user messages have been written to mock.
+func waitWritten(t *testing.T, mock *mockTransport, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		written := 0
+		for _, kind := range mock.writtenTypes() {
+			if kind == "user" {
+				written++
+			}
+		}
+		if written == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d user messages written, want %d", written, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestClient_Enqueue tests that queued prompts are sent one turn at a time, in
+// order, and that a failed turn does not stop the queue.
+func TestClient_Enqueue(t *testing.T) {
+	ctx := testContext(t, 15*time.Second)
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, scriptCLI)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close(ctx)
+
+	log := make(turnLog, 3)
+	for _, prompt := range []string{"Remember 42.", "fail now", "What did I ask?"} {
+		if err := client.Enqueue(ctx, prompt, log.onDone); err != nil {
+			t.Fatalf("Enqueue(%q) failed: %v", prompt, err)
+		}
+	}
+
+	if turn := log.next(t); turn.Prompt != "Remember 42." || turn.Err != nil || turn.Text != "reply 1" {
+		t.Errorf("turn 1 = %q %q %v, want reply 1", turn.Prompt, turn.Text, turn.Err)
+	}
+	if turn := log.next(t); turn.Prompt != "fail now" || !types.IsResultError(turn.Err) {
+		t.Errorf("turn 2 = %q %v, want a ResultError", turn.Prompt, turn.Err)
+	}
+	if turn := log.next(t); turn.Prompt != "What did I ask?" || turn.Err != nil || turn.Text != "reply 3" {
+		t.Errorf("turn 3 = %q %q %v, want reply 3", turn.Prompt, turn.Text, turn.Err)
+	}
+	if n := client.Pending(); n != 0 {
+		t.Errorf("Pending() = %d after the queue ran, want 0", n)
+	}
+
+	// The queue starts again for later prompts
+	if err := client.Enqueue(ctx, "And now?", log.onDone); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if turn := log.next(t); turn.Text != "reply 4" {
+		t.Errorf("turn 4 = %q %v, want reply 4", turn.Text, turn.Err)
+	}
+
+	if err := client.Enqueue(ctx, "", log.onDone); err == nil {
+		t.Error("empty prompt: want an error")
+	}
+}
+
+// TestClient_EnqueueCancel tests cancelling prompts still in the queue, alone
+// through their context or all at once, while a turn is in flight.
+func TestClient_EnqueueCancel(t *testing.T) {
+	ctx := testContext(t, 15*time.Second)
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, scriptCLI)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	log := make(turnLog, 4)
+	secondCtx, cancelSecond := context.WithCancel(ctx)
+	defer cancelSecond()
+	for _, queued := range []struct {
+		ctx    context.Context
+		prompt string
+	}{{ctx, "hang on"}, {secondCtx, "second"}, {ctx, "third"}, {ctx, "fourth"}} {
+		if err := client.Enqueue(queued.ctx, queued.prompt, log.onDone); err != nil {
+			t.Fatalf("Enqueue(%q) failed: %v", queued.prompt, err)
+		}
+	}
+	// The first turn never ends, so the others wait
+	waitPending(t, client, 3)
+
+	cancelSecond()
+	turn := log.next(t)
+	if turn.Prompt != "second" || !types.IsPromptAbandonedError(turn.Err) || !errors.Is(turn.Err, context.Canceled) {
+		t.Errorf("cancelled prompt = %q %v, want second abandoned with context.Canceled", turn.Prompt, turn.Err)
+	}
+	if n := client.Pending(); n != 2 {
+		t.Errorf("Pending() = %d after cancelling one prompt, want 2", n)
+	}
+
+	if n := client.CancelQueued(); n != 2 {
+		t.Errorf("CancelQueued() = %d, want 2", n)
+	}
+	var prompts []string
+	for i := 0; i < 2; i++ {
+		turn := log.next(t)
+		prompts = append(prompts, turn.Prompt)
+		if !types.IsPromptAbandonedError(turn.Err) || !errors.Is(turn.Err, context.Canceled) {
+			t.Errorf("%q error = %v, want abandoned with context.Canceled", turn.Prompt, turn.Err)
+		}
+	}
+	if !slices.Equal(prompts, []string{"third", "fourth"}) {
+		t.Errorf("abandoned %v, want third and fourth in order", prompts)
+	}
+
+	// Closing ends the turn in flight
+	if err := client.Close(ctx); err != nil {
+		t.Logf("Close: %v", err)
+	}
+	if turn := log.next(t); turn.Prompt != "hang on" || turn.Err == nil || turn.Result != nil {
+		t.Errorf("turn in flight = %q %v, want an error without a result", turn.Prompt, turn.Err)
+	}
+	if err := client.Enqueue(ctx, "after close", log.onDone); !types.IsCLIConnectionError(err) {
+		t.Errorf("Enqueue after Close error = %v, want a CLIConnectionError", err)
+	}
+}
+
+// TestClient_EnqueueInterruptAndClose tests that Interrupt and Close abandon
+// the queued prompts, while the turn in flight ends as usual.
+func TestClient_EnqueueInterruptAndClose(t *testing.T) {
+	ctx := testContext(t, 15*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	log := make(turnLog, 5)
+	for _, prompt := range []string{"first", "second", "third"} {
+		if err := client.Enqueue(ctx, prompt, log.onDone); err != nil {
+			t.Fatalf("Enqueue(%q) failed: %v", prompt, err)
+		}
+	}
+	waitWritten(t, mock, 1)
+
+	if err := client.Interrupt(ctx); err != nil {
+		t.Fatalf("Interrupt failed: %v", err)
+	}
+	for _, want := range []string{"second", "third"} {
+		turn := log.next(t)
+		var abandoned *types.PromptAbandonedError
+		if turn.Prompt != want || !errors.As(turn.Err, &abandoned) || abandoned.Reason != "interrupted" {
+			t.Errorf("turn = %q %v, want %s abandoned as interrupted", turn.Prompt, turn.Err, want)
+		}
+	}
+	mock.send(&types.ResultMessage{Type: "result", Subtype: "error_during_execution", IsError: true})
+	if turn := log.next(t); turn.Prompt != "first" || !types.IsTurnInterruptedError(turn.Err) {
+		t.Errorf("interrupted turn = %q %v, want a TurnInterruptedError", turn.Prompt, turn.Err)
+	}
+
+	// The client takes new prompts after an interrupt
+	for _, prompt := range []string{"fourth", "fifth"} {
+		if err := client.Enqueue(ctx, prompt, log.onDone); err != nil {
+			t.Fatalf("Enqueue(%q) failed: %v", prompt, err)
+		}
+	}
+	waitWritten(t, mock, 2)
+
+	if err := client.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	turns := map[string]TurnResult{}
+	for i := 0; i < 2; i++ {
+		turn := log.next(t)
+		turns[turn.Prompt] = turn
+	}
+	if err := turns["fifth"].Err; !types.IsPromptAbandonedError(err) || !errors.Is(err, types.ErrClientClosed) {
+		t.Errorf("queued prompt error = %v, want abandoned with ErrClientClosed", err)
+	}
+	if turn := turns["fourth"]; turn.Err == nil || turn.Result != nil {
+		t.Errorf("turn in flight = %+v, want an error without a result", turn)
+	}
+	if n := client.Pending(); n != 0 {
+		t.Errorf("Pending() = %d after Close, want 0", n)
+	}
+}
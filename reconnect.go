@@ -0,0 +1,323 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// reconnectDetectTimeout bounds how long a query that found the CLI gone waits
+// for the loss to be detected and reconnection to begin.
+var reconnectDetectTimeout = 5 * time.Second
+
+// isReconnected reports whether msg announces a reconnection, which ends the
+// turn in progress.
+func isReconnected(msg types.Message) bool {
+	system, ok := msg.(*types.SystemMessage)
+	return ok && system.IsReconnected()
+}
+
+// superviseConnection copies the messages of each connection to out and, when
+// the CLI exits unexpectedly, replaces the connection (see WithAutoReconnect).
+// out is closed when the client is closed, when delivery ends for another
+// reason such as an exceeded budget, or when reconnecting fails.
+func (c *Client) superviseConnection(query *internal.Query, out chan<- types.Message) {
+	defer close(out)
+
+	for {
+		if !c.forwardConnection(query, out) {
+			return
+		}
+		next, notice, err := c.reconnect(query)
+		if err != nil {
+			return
+		}
+		select {
+		case out <- notice:
+		case <-c.ctx.Done():
+			return
+		}
+		query = next
+	}
+}
+
+// forwardConnection copies the messages of query to out. It reports whether
+// the connection was lost: the message loop ended while the client is open and
+// delivery had not been closed on purpose.
+func (c *Client) forwardConnection(query *internal.Query, out chan<- types.Message) bool {
+	messages := query.GetMessages(c.ctx)
+	forward := func(msg types.Message) bool {
+		select {
+		case out <- msg:
+			return true
+		case <-c.ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return false
+		case msg, ok := <-messages:
+			if !ok {
+				// Closed by the message loop when the transport's output ended
+				return c.ctx.Err() == nil && query.Err() == nil
+			}
+			if !forward(msg) {
+				return false
+			}
+		case <-query.Done():
+			// Deliver what the loop routed before it exited
+			for {
+				select {
+				case msg, ok := <-messages:
+					if !ok {
+						return c.ctx.Err() == nil && query.Err() == nil
+					}
+					if !forward(msg) {
+						return false
+					}
+				default:
+					return c.ctx.Err() == nil
+				}
+			}
+		}
+	}
+}
+
+// reconnect replaces the lost connection of query with a new CLI subprocess
+// resuming its session, initializing the control protocol again. It returns
+// the new query and the SystemMessage announcing it, or the *types.ProcessError
+// recorded for Err once every attempt has failed.
+func (c *Client) reconnect(query *internal.Query) (*internal.Query, *types.SystemMessage, error) {
+	c.mu.Lock()
+	lost := c.transport
+	sessionID := c.resumableSessionID(query)
+	c.setReconnecting(true, nil)
+	c.mu.Unlock()
+
+	reason := lost.ReadinessReason()
+	if cause := lost.GetError(); cause != nil {
+		c.logger.Warning("Connection to the CLI was lost (%s): %v", reason, cause)
+	} else {
+		c.logger.Warning("Connection to the CLI was lost (%s)", reason)
+	}
+	if sessionID == "" {
+		c.logger.Warning("Session ID unknown; reconnecting starts a new session")
+	}
+
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(c.ctx), runCleanupTimeout)
+	_ = query.Close(cleanupCtx)
+	cancel()
+
+	attempts := c.options.AutoReconnectAttempts
+	backoff := c.options.AutoReconnectBackoff
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err := sleepContext(c.ctx, backoff); err != nil {
+			lastErr = err
+			break
+		}
+		backoff *= 2
+
+		c.logger.Info("Reconnecting to the CLI (attempt %d/%d)", attempt, attempts)
+		tr := c.newTransport(sessionID)
+		next, state, err := c.startReconnectedQuery(tr)
+		if err != nil {
+			c.logger.Warning("Reconnect attempt %d/%d failed: %v", attempt, attempts, err)
+			lastErr = err
+			continue
+		}
+
+		c.mu.Lock()
+		if c.ctx.Err() != nil {
+			// Closed while reconnecting; Close did not see the new connection
+			c.mu.Unlock()
+			cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(c.ctx), runCleanupTimeout)
+			_ = next.Close(cleanupCtx)
+			cancel()
+			return nil, nil, c.ctx.Err()
+		}
+		c.transport, c.query, c.init = tr, next, state
+		c.pendingTurns = 0
+		c.turnFinished = false
+		c.settling = false
+		c.timeoutErr = nil
+		c.setReconnecting(false, nil)
+		c.mu.Unlock()
+
+		c.logger.Info("Reconnected to the CLI")
+		notice := &types.SystemMessage{
+			Type:    "system",
+			Subtype: types.SystemSubtypeReconnected,
+			Data: map[string]interface{}{
+				"attempt":    attempt,
+				"session_id": sessionID,
+				"reason":     string(reason),
+			},
+			SessionID: sessionID,
+		}
+		return next, notice, nil
+	}
+
+	if c.ctx.Err() != nil {
+		c.mu.Lock()
+		c.setReconnecting(false, nil)
+		c.mu.Unlock()
+		return nil, nil, c.ctx.Err()
+	}
+	processErr := &types.ProcessError{
+		Message: fmt.Sprintf("CLI subprocess was lost (%s) and reconnecting failed after %d attempts", reason, attempts),
+		Cause:   lastErr,
+	}
+	_ = c.tagged(processErr)
+	c.logger.Error("%v", processErr)
+	c.mu.Lock()
+	c.setReconnecting(false, processErr)
+	c.mu.Unlock()
+	return nil, nil, processErr
+}
+
+// Reconnect connects a client again after Close, with the options and callbacks
+// it was created with. A new CLI subprocess resumes the session of the closed
+// connection when its ID is known, otherwise the session in options.Resume, so
+// an application can suspend a conversation and pick it up on the same Client:
+//
+//	_ = client.Close(ctx)
+//	// ... later
+//	if err := client.Reconnect(ctx); err != nil {
+//	    log.Fatal(err)
+//	}
+//	err = client.Query(ctx, "Where were we?")
+//
+// Reconnect returns a *types.ControlProtocolError while the client is
+// connected. Like Connect, it initializes the control protocol before
+// returning unless WithLazyInitialize is set.
+func (c *Client) Reconnect(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connected {
+		return types.NewControlProtocolError("cannot reconnect: client already connected")
+	}
+
+	sessionID := c.lastSessionID
+	if sessionID == "" && c.options.Resume != nil {
+		sessionID = *c.options.Resume
+	}
+	if sessionID != "" {
+		c.logger.Info("Reconnecting to resume session %s", sessionID)
+	}
+
+	// Close cancelled the client context; keep its values for the new connection
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.ctx, c.cancel = context.WithCancel(context.WithoutCancel(c.ctx))
+	c.transport = c.newTransport(sessionID)
+	c.resumeID = sessionID
+	c.stream = nil
+	c.reconnecting = false
+	c.reconnectErr = nil
+	return c.connectLocked(ctx)
+}
+
+// resumableSessionID returns the session a new connection should resume: the
+// one announced on query, else the one of the last closed connection, else
+// options.Resume. It is "" when none is known. The caller holds c.mu.
+func (c *Client) resumableSessionID(query *internal.Query) string {
+	if init := query.InitMessage(); init != nil && init.SessionID != "" {
+		return init.SessionID
+	}
+	if c.lastSessionID != "" {
+		return c.lastSessionID
+	}
+	if c.options.Resume != nil {
+		return *c.options.Resume
+	}
+	return ""
+}
+
+// startReconnectedQuery connects tr and replays control protocol
+// initialization, so hooks and permission callbacks are registered with the
+// new CLI.
+func (c *Client) startReconnectedQuery(tr transport.Transport) (*internal.Query, *initState, error) {
+	query, err := c.startQuery(c.ctx, tr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state := &initState{started: true, done: make(chan struct{})}
+	initCtx, cancel := context.WithTimeout(c.ctx, initializeTimeout)
+	c.runInitialize(initCtx, query, state)
+	cancel()
+	if state.err != nil {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(c.ctx), runCleanupTimeout)
+		_ = query.Close(cleanupCtx)
+		cancel()
+		return nil, nil, state.err
+	}
+	return query, state, nil
+}
+
+// setReconnecting records reconnection progress and wakes awaitReconnect. The
+// caller holds c.mu.
+func (c *Client) setReconnecting(reconnecting bool, err error) {
+	c.reconnecting = reconnecting
+	c.reconnectErr = err
+	close(c.connChanged)
+	c.connChanged = make(chan struct{})
+}
+
+// awaitReconnect waits for the lost transport tr to be replaced. It returns
+// the *types.ProcessError if reconnecting failed, and a
+// *types.CLIConnectionError if reconnection has not begun within
+// reconnectDetectTimeout.
+func (c *Client) awaitReconnect(ctx context.Context, tr transport.Transport) error {
+	detect := time.NewTimer(reconnectDetectTimeout)
+	defer detect.Stop()
+
+	for {
+		c.mu.Lock()
+		current, reconnecting, err, changed := c.transport, c.reconnecting, c.reconnectErr, c.connChanged
+		c.mu.Unlock()
+		switch {
+		case err != nil:
+			return err
+		case current != tr:
+			return nil
+		}
+
+		expired := detect.C
+		if reconnecting {
+			expired = nil
+		}
+		select {
+		case <-changed:
+		case <-expired:
+			return c.tagged(types.NewCLIConnectionError(fmt.Sprintf("connection to the CLI was lost (%s)", tr.ReadinessReason())))
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// sleepContext waits for d, returning early with ctx.Err() if ctx ends first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
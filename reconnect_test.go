@@ -0,0 +1,216 @@
+package claude
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// reconnectingClient returns a connected client with automatic reconnection
+// whose replacement transports are taken from next in order. Resume IDs
+// passed to the transport factory are appended to resumed.
+func reconnectingClient(t *testing.T, attempts int, first *mockTransport, next ...*mockTransport) (*Client, *[]string) {
+	t.Helper()
+
+	client := newMockClient(t, types.NewClaudeAgentOptions().WithAutoReconnect(attempts, time.Millisecond), first)
+	var mu sync.Mutex
+	var resumed []string
+	client.newTransport = func(resumeID string) transport.Transport {
+		mu.Lock()
+		defer mu.Unlock()
+		resumed = append(resumed, resumeID)
+		if len(next) == 0 {
+			return &mockTransport{messages: make(chan types.Message), connectErr: errors.New("no more transports")}
+		}
+		tr := next[0]
+		next = next[1:]
+		return tr
+	}
+	if err := client.Connect(testContext(t, 5*time.Second)); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	return client, &resumed
+}
+
+// TestClient_AutoReconnect tests that a lost CLI is replaced by one resuming
+// the session, with a reconnected notice in the stream and the control
+// protocol initialized again.
+func TestClient_AutoReconnect(t *testing.T) {
+	first, second := newMockTransport(), newMockTransport()
+	client, resumed := reconnectingClient(t, 3, first, second)
+	ctx := testContext(t, 5*time.Second)
+
+	messages := client.ReceiveMessages(ctx)
+	first.send(&types.SystemMessage{Type: "system", Subtype: types.SystemSubtypeInit, SessionID: "session-1"})
+	if msg := <-messages; !msg.(*types.SystemMessage).IsInit() {
+		t.Fatalf("first message = %#v, want init", msg)
+	}
+
+	// The CLI dies
+	_ = first.Close(ctx)
+
+	var notice *types.SystemMessage
+	select {
+	case msg := <-messages:
+		notice, _ = msg.(*types.SystemMessage)
+	case <-ctx.Done():
+		t.Fatal("no message after the CLI was lost")
+	}
+	if notice == nil || !notice.IsReconnected() || notice.Data["session_id"] != "session-1" || notice.Data["attempt"] != 1 {
+		t.Fatalf("got %#v, want a reconnected notice for session-1", notice)
+	}
+	if !slices.Equal(*resumed, []string{"session-1"}) {
+		t.Errorf("resumed sessions = %v, want [session-1]", *resumed)
+	}
+	if !client.IsConnected() || client.Err() != nil {
+		t.Errorf("client should be usable after reconnecting: connected=%v err=%v", client.IsConnected(), client.Err())
+	}
+
+	// Messages of the new CLI are delivered on the same channel
+	if err := client.Query(ctx, "still there?"); err != nil {
+		t.Fatalf("Query after reconnecting failed: %v", err)
+	}
+	if got := second.writtenTypes(); !slices.Equal(got, []string{"initialize", "user"}) {
+		t.Errorf("new CLI got %v, want initialize then the query", got)
+	}
+	second.send(&types.ResultMessage{Type: "result", Subtype: "success", SessionID: "session-1"})
+	if msg := <-messages; msg.GetMessageType() != "result" {
+		t.Errorf("got %#v, want the new CLI's result", msg)
+	}
+}
+
+// TestClient_AutoReconnectEndsTurn tests that a response in progress when the
+// CLI is lost ends with the reconnected notice instead of waiting forever.
+func TestClient_AutoReconnectEndsTurn(t *testing.T) {
+	first, second := newMockTransport(), newMockTransport()
+	client, _ := reconnectingClient(t, 1, first, second)
+	ctx := testContext(t, 5*time.Second)
+
+	if err := client.Query(ctx, "long task"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	response := client.ReceiveResponse(ctx)
+	first.send(&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: "Working"}}})
+	_ = first.Close(ctx)
+
+	got := collectMessages(t, response, 2*time.Second)
+	if len(got) != 2 || !isReconnected(got[1]) {
+		t.Fatalf("response = %#v, want the partial answer then the reconnected notice", got)
+	}
+
+	// The lost turn no longer counts as pending
+	if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrNoPendingTurn) {
+		t.Errorf("ReceiveResponseE() error = %v, want ErrNoPendingTurn", err)
+	}
+}
+
+// TestClient_AutoReconnectFails tests that once every attempt fails the
+// channels close and Err reports a ProcessError.
+func TestClient_AutoReconnectFails(t *testing.T) {
+	first := newMockTransport()
+	client, resumed := reconnectingClient(t, 2, first)
+	ctx := testContext(t, 5*time.Second)
+
+	messages := client.ReceiveMessages(ctx)
+	_ = first.Close(ctx)
+	collectMessages(t, messages, 2*time.Second)
+
+	var processErr *types.ProcessError
+	if err := client.Err(); !errors.As(err, &processErr) || processErr.Cause == nil {
+		t.Fatalf("Err() = %v, want a ProcessError with the last attempt's cause", err)
+	}
+	if len(*resumed) != 2 {
+		t.Errorf("made %d attempts, want 2", len(*resumed))
+	}
+	if client.IsConnected() {
+		t.Error("IsConnected() should be false after reconnecting failed")
+	}
+	if err := client.Query(ctx, "hello?"); !types.IsProcessError(err) {
+		t.Errorf("Query() error = %v, want the ProcessError", err)
+	}
+}
+
+// resumingCLI announces the session it resumes, or a new one named after its
+// process ID when started without --resume, and replies to each user turn with the session ID and turn number.
+const resumingCLI = `
+session=s-$$
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--resume" ]; then session="$2"; fi
+  shift
+done
+echo '{"type":"system","subtype":"init","session_id":"'$session'"}'
+turn=0
+while read line; do
+  case "$line" in
+    *control_request*)
+      id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+      echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+      ;;
+    *'"type":"user"'*)
+      turn=$((turn+1))
+      echo '{"type":"result","subtype":"success","is_error":false,"result":"'$session' turn '$turn'","session_id":"'$session'"}'
+      ;;
+  esac
+done
+`
+
+// TestClient_Reconnect tests that a closed client connects again, resuming
+// its session, and that Reconnect is refused while connected.
+func TestClient_Reconnect(t *testing.T) {
+	ctx := testContext(t, 15*time.Second)
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, resumingCLI)))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(ctx)
+
+	ask := func(prompt string) string {
+		t.Helper()
+		if err := client.Query(ctx, prompt); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		result := lastResult(t, collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second))
+		return *result.Result
+	}
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.WaitForInit(ctx); err != nil {
+		t.Fatalf("WaitForInit failed: %v", err)
+	}
+	if err := client.Reconnect(ctx); !types.IsControlProtocolError(err) {
+		t.Errorf("Reconnect while connected: error = %v, want ControlProtocolError", err)
+	}
+	session := client.SessionID()
+	if got := ask("hello"); got != session+" turn 1" {
+		t.Errorf("first answer = %q, want the first turn of %s", got, session)
+	}
+
+	// Closing again is a no-op
+	_ = client.Close(ctx)
+	if err := client.Close(ctx); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+	if err := client.Query(ctx, "closed"); err == nil {
+		t.Error("Query on a closed client should fail")
+	}
+
+	if err := client.Reconnect(ctx); err != nil {
+		t.Fatalf("Reconnect failed: %v", err)
+	}
+	if err := client.WaitForInit(ctx); err != nil {
+		t.Fatalf("WaitForInit failed: %v", err)
+	}
+	if got := client.SessionID(); got != session {
+		t.Errorf("SessionID() = %q, want the resumed %s", got, session)
+	}
+	if got := ask("where were we?"); got != session+" turn 1" {
+		t.Errorf("answer after Reconnect = %q, want the first turn of the resumed CLI", got)
+	}
+}
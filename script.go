@@ -0,0 +1,141 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TurnResult holds the outcome of one turn of a RunScript conversation, of
+// Agent.Run, or of a prompt queued with Client.Enqueue.
+type TurnResult struct {
+	Prompt   string               // Prompt sent for this turn
+	Messages []types.Message      // Every message received for this turn, including the result
+	Result   *types.ResultMessage // Result that ended the turn (nil if the turn did not complete)
+	Text     string               // Concatenated assistant text
+	CostUSD  float64              // Cost reported by the result (0 when not reported)
+	Refused  bool                 // The model declined the request (see types.DetectRefusal)
+	Err      error                // Non-nil if the turn failed or did not complete (see below)
+}
+
+// A failed turn's Err is a *types.ResultError for an error result, a
+// *types.IncompleteStreamError when no result arrived, or a *types.BudgetExceededError.
+// With FailOnRefusal, a refused turn's Err is a *types.RefusalError. All but the
+// budget error carry a types.ErrorContext with the turn's partial output. A
+// prompt queued with Client.Enqueue that was never sent has a
+// *types.PromptAbandonedError.
+
+// RunScript runs a fixed multi-turn conversation over a single streaming connection.
+//
+// Each prompt is sent only after the previous turn's ResultMessage has arrived, so the
+// conversation behaves like a user typing turn by turn. The connection is closed
+// before RunScript returns.
+//
+// Turn behavior is configured on the options:
+//   - ScriptTurnTimeout bounds each turn; a timed-out turn always ends the script.
+//   - AbortScriptOnError stops the script at the first error result. Otherwise the
+//     error is recorded in that turn's Err and the next prompt is sent.
+//
+// The returned slice holds a TurnResult for every turn that was attempted. The error
+// is non-nil if the script could not run to completion; earlier turns are still
+// returned in that case.
+//
+// Example:
+//
+//	turns, err := claude.RunScript(ctx, []string{
+//	    "Remember the number 42.",
+//	    "What number did I ask you to remember?",
+//	}, types.NewClaudeAgentOptions().WithScriptTurnTimeout(time.Minute))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, turn := range turns {
+//	    fmt.Printf("%s -> %s ($%.4f)\n", turn.Prompt, turn.Text, turn.CostUSD)
+//	}
+func RunScript(ctx context.Context, turns []string, options *types.ClaudeAgentOptions) ([]TurnResult, error) {
+	if len(turns) == 0 {
+		return nil, fmt.Errorf("script has no turns")
+	}
+	if options == nil {
+		options = types.NewClaudeAgentOptions()
+	}
+
+	client, err := NewClient(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Connect(ctx); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+
+	results := make([]TurnResult, 0, len(turns))
+	for i, prompt := range turns {
+		turn := runScriptTurn(ctx, client, prompt, options)
+		results = append(results, turn)
+
+		if turn.Err == nil {
+			continue
+		}
+		// A turn without a result leaves the connection mid-response, and an exceeded
+		// budget stops delivery, so neither can continue
+		if turn.Result == nil || client.Err() != nil || options.AbortScriptOnError {
+			return results, fmt.Errorf("script turn %d: %w", i+1, turn.Err)
+		}
+	}
+	return results, nil
+}
+
+// runScriptTurn sends one prompt and collects messages up to its ResultMessage.
+func runScriptTurn(ctx context.Context, client *Client, prompt string, options *types.ClaudeAgentOptions) TurnResult {
+	turn := TurnResult{Prompt: prompt}
+
+	turnCtx := ctx
+	if options.ScriptTurnTimeout > 0 {
+		var cancel context.CancelFunc
+		turnCtx, cancel = context.WithTimeout(ctx, options.ScriptTurnTimeout)
+		defer cancel()
+	}
+
+	if err := client.Query(turnCtx, prompt); err != nil {
+		turn.Err = err
+		return turn
+	}
+
+	tracker := internal.NewTurnTracker()
+	for msg := range client.ReceiveResponse(turnCtx) {
+		turn.Messages = append(turn.Messages, msg)
+		tracker.Observe(msg)
+		if result, ok := msg.(*types.ResultMessage); ok {
+			turn.Result = result
+		}
+	}
+	turn.Text = tracker.Context().AssistantText
+
+	switch {
+	case turn.Result != nil:
+		if turn.Result.TotalCostUSD != nil {
+			turn.CostUSD = *turn.Result.TotalCostUSD
+		}
+		turn.Err = tracker.Finish(turn.Result)
+		if refusal := types.DetectRefusal(turn.Messages, options.RefusalClassifier); refusal != nil {
+			turn.Refused = true
+			if turn.Err == nil && options.FailOnRefusal {
+				refusal.Context = tracker.Context()
+				turn.Err = refusal
+			}
+		}
+	case turnCtx.Err() != nil:
+		turn.Err = tracker.Incomplete("no result before deadline", turnCtx.Err())
+	default:
+		turn.Err = tracker.Incomplete("connection closed before the turn completed", client.Err())
+	}
+	if err := client.Err(); err != nil && turn.Err == nil {
+		turn.Err = err
+	}
+	return turn
+}
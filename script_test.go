@@ -0,0 +1,258 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// scriptCLI answers control requests and replies to each user turn with
+// "reply N" at a cost of $0.01 per turn. Prompts containing "fail" get an
+// error result, prompts containing "loop" fail with error_max_turns midway
+// through a tool loop, prompts containing "refuse" are declined with the
+// refusal stop reason, and prompts containing "hang" are never answered.
+const scriptCLI = `
+turn=0
+while read line; do
+  case "$line" in
+    *control_request*)
+      id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+      echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+      ;;
+    *'"type":"user"'*)
+      turn=$((turn+1))
+      case "$line" in
+        *hang*) ;;
+        *refuse*)
+          echo '{"type":"assistant","message":{"model":"m","stop_reason":"refusal","content":[{"type":"text","text":"I can'"'"'t help with that."}]}}'
+          echo '{"type":"result","subtype":"success","is_error":false,"result":"I can'"'"'t help with that.","session_id":"s-script","total_cost_usd":0.01}'
+          ;;
+        *loop*)
+          echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"Running tests. "},{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"go test"}}]}}'
+          echo '{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"t1","content":"FAIL"}]}}'
+          echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"Reading the failure."},{"type":"tool_use","id":"t2","name":"Read","input":{"file_path":"a.go"}}]}}'
+          echo '{"type":"result","subtype":"error_max_turns","is_error":true,"result":"Reached maximum number of turns","session_id":"s-script"}'
+          ;;
+        *fail*)
+          echo '{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"s-script","total_cost_usd":0.01}'
+          ;;
+        *)
+          echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"reply '$turn'"}]}}'
+          echo '{"type":"result","subtype":"success","is_error":false,"result":"reply '$turn'","session_id":"s-script","total_cost_usd":0.0'$turn'}'
+          ;;
+      esac
+      ;;
+  esac
+done
+`
+
+func TestRunScript(t *testing.T) {
+	ctx := testContext(t, 15*time.Second)
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, scriptCLI)).
+		WithScriptTurnTimeout(5 * time.Second)
+
+	turns, err := RunScript(ctx, []string{"Remember 42.", "What did I ask you to remember?"}, opts)
+	if err != nil {
+		t.Fatalf("RunScript failed: %v", err)
+	}
+	if len(turns) != 2 {
+		t.Fatalf("got %d turns, want 2", len(turns))
+	}
+
+	for i, turn := range turns {
+		wantText := []string{"reply 1", "reply 2"}[i]
+		wantCost := []float64{0.01, 0.02}[i]
+		if turn.Err != nil {
+			t.Errorf("turn %d: unexpected error: %v", i+1, turn.Err)
+		}
+		if turn.Text != wantText {
+			t.Errorf("turn %d: Text = %q, want %q", i+1, turn.Text, wantText)
+		}
+		if turn.CostUSD != wantCost {
+			t.Errorf("turn %d: CostUSD = %v, want %v", i+1, turn.CostUSD, wantCost)
+		}
+		if turn.Result == nil || turn.Messages[len(turn.Messages)-1] != turn.Result {
+			t.Errorf("turn %d: messages should end with the turn's result", i+1)
+		}
+	}
+	if turns[0].Prompt != "Remember 42." {
+		t.Errorf("Prompt = %q, want the first script line", turns[0].Prompt)
+	}
+}
+
+func TestRunScript_ErrorResult(t *testing.T) {
+	script := []string{"first", "please fail", "third"}
+
+	t.Run("continues by default", func(t *testing.T) {
+		ctx := testContext(t, 15*time.Second)
+		opts := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, scriptCLI))
+
+		turns, err := RunScript(ctx, script, opts)
+		if err != nil {
+			t.Fatalf("RunScript failed: %v", err)
+		}
+		if len(turns) != 3 {
+			t.Fatalf("got %d turns, want 3", len(turns))
+		}
+		if turns[1].Err == nil || turns[1].Result == nil || !turns[1].Result.IsError {
+			t.Errorf("turn 2 should record the error result, got %+v", turns[1])
+		}
+		if turns[2].Err != nil || turns[2].Text != "reply 3" {
+			t.Errorf("turn 3 should run after the failure, got %+v", turns[2])
+		}
+	})
+
+	t.Run("aborts when configured", func(t *testing.T) {
+		ctx := testContext(t, 15*time.Second)
+		opts := types.NewClaudeAgentOptions().
+			WithCLIPath(writeMockCLI(t, scriptCLI)).
+			WithAbortScriptOnError(true)
+
+		turns, err := RunScript(ctx, script, opts)
+		if err == nil || !strings.Contains(err.Error(), "turn 2") {
+			t.Fatalf("expected error for turn 2, got %v", err)
+		}
+		if len(turns) != 2 {
+			t.Errorf("got %d turns, want 2 (third turn should not run)", len(turns))
+		}
+	})
+}
+
+func TestRunScript_Refusal(t *testing.T) {
+	script := []string{"please refuse", "second"}
+
+	t.Run("flagged by default", func(t *testing.T) {
+		ctx := testContext(t, 15*time.Second)
+		opts := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, scriptCLI))
+
+		turns, err := RunScript(ctx, script, opts)
+		if err != nil {
+			t.Fatalf("RunScript failed: %v", err)
+		}
+		if !turns[0].Refused || turns[0].Err != nil {
+			t.Errorf("turn 1: Refused = %v, Err = %v; want a refusal without error", turns[0].Refused, turns[0].Err)
+		}
+		if turns[1].Refused {
+			t.Error("turn 2 is a normal answer, not a refusal")
+		}
+	})
+
+	t.Run("fails when configured", func(t *testing.T) {
+		ctx := testContext(t, 15*time.Second)
+		opts := types.NewClaudeAgentOptions().
+			WithCLIPath(writeMockCLI(t, scriptCLI)).
+			WithFailOnRefusal(true).
+			WithAbortScriptOnError(true)
+
+		turns, err := RunScript(ctx, script, opts)
+		if !types.IsRefusalError(err) || len(turns) != 1 {
+			t.Fatalf("RunScript = %d turns, %v; want to stop at the refusal", len(turns), err)
+		}
+		var refusal *types.RefusalError
+		if !errors.As(turns[0].Err, &refusal) {
+			t.Fatalf("turn Err = %v, want RefusalError", turns[0].Err)
+		}
+		if refusal.Source != types.RefusalByStopReason || refusal.SessionID != "s-script" || refusal.Context == nil {
+			t.Errorf("unexpected refusal: %+v", refusal)
+		}
+	})
+}
+
+func TestRunScript_FailureMidToolLoop(t *testing.T) {
+	ctx := testContext(t, 15*time.Second)
+	opts := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, scriptCLI))
+
+	turns, err := RunScript(ctx, []string{"fix the loop"}, opts)
+	if err != nil {
+		t.Fatalf("RunScript failed: %v", err)
+	}
+
+	var resultErr *types.ResultError
+	if !errors.As(turns[0].Err, &resultErr) {
+		t.Fatalf("Err = %v, want *types.ResultError", turns[0].Err)
+	}
+	if resultErr.Subtype != "error_max_turns" || resultErr.Message != "Reached maximum number of turns" {
+		t.Errorf("unexpected result error: %+v", resultErr)
+	}
+	if resultErr.Context == nil {
+		t.Fatal("expected error context")
+	}
+	if resultErr.Context.AssistantText != "Running tests. Reading the failure." {
+		t.Errorf("AssistantText = %q", resultErr.Context.AssistantText)
+	}
+	if tool := resultErr.Context.LastToolUse; tool == nil || tool.Name != "Read" || tool.Input["file_path"] != "a.go" {
+		t.Errorf("LastToolUse = %+v, want the Read call", tool)
+	}
+}
+
+func TestRunScript_TurnTimeout(t *testing.T) {
+	ctx := testContext(t, 15*time.Second)
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, scriptCLI)).
+		WithScriptTurnTimeout(300 * time.Millisecond)
+
+	turns, err := RunScript(ctx, []string{"first", "now hang", "never sent"}, opts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if len(turns) != 2 {
+		t.Fatalf("got %d turns, want 2", len(turns))
+	}
+	if turns[0].Err != nil || turns[1].Result != nil {
+		t.Errorf("unexpected turns: %+v", turns)
+	}
+	if !types.IsIncompleteStreamError(turns[1].Err) {
+		t.Errorf("timed-out turn Err = %v, want IncompleteStreamError", turns[1].Err)
+	}
+}
+
+func TestRunScript_NoTurns(t *testing.T) {
+	if _, err := RunScript(context.Background(), nil, nil); err == nil {
+		t.Error("expected an error for an empty script")
+	}
+}
+
+// syncBuffer is a strings.Builder safe for the message loop to write while a test reads.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRunScript_StdoutMirror(t *testing.T) {
+	ctx := testContext(t, 15*time.Second)
+	var out syncBuffer
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMockCLI(t, scriptCLI)).
+		WithStdoutMirror(&out)
+
+	turns, err := RunScript(ctx, []string{"hello", "fix the loop", "again"}, opts)
+	if err != nil {
+		t.Fatalf("RunScript failed: %v", err)
+	}
+
+	var want strings.Builder
+	for _, turn := range turns {
+		want.WriteString(turn.Text + "\n")
+	}
+	if got := out.String(); got != want.String() {
+		t.Errorf("mirrored output = %q, want delivered text %q", got, want.String())
+	}
+}
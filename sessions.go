@@ -0,0 +1,333 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// DefaultSessionID is the session ID Query and QueryWithContent send prompts
+// under. Use it with ReceiveResponseForSession to receive their responses once
+// the connection is multiplexed.
+const DefaultSessionID = "default"
+
+// maxUnclaimedMessages bounds the messages kept for a session ID that no
+// prompt awaits, such as late output of a turn already received.
+const maxUnclaimedMessages = 100
+
+// sessionRouter demultiplexes a connection's messages by session ID, so several
+// conversations can share one CLI process. It reads the client's message stream
+// for the rest of the connection and queues each message for its session until
+// a receiver for that session takes it.
+type sessionRouter struct {
+	mu        sync.Mutex
+	queues    map[string][]types.Message // Session ID -> messages not yet received
+	turns     map[string]int             // Session ID -> results not yet received
+	receiving map[string]bool            // Session ID -> a receiver is active
+	prompts   []string                   // Session IDs of the prompts whose result has not arrived, oldest first
+	dropped   map[string]int             // Session ID -> unclaimed messages dropped
+	ended     bool                       // The message stream has ended
+	changed   chan struct{}              // Closed and replaced when the above change
+}
+
+func newSessionRouter() *sessionRouter {
+	return &sessionRouter{
+		queues:    make(map[string][]types.Message),
+		turns:     make(map[string]int),
+		receiving: make(map[string]bool),
+		dropped:   make(map[string]int),
+		changed:   make(chan struct{}),
+	}
+}
+
+// notify wakes the receivers. The caller holds r.mu.
+func (r *sessionRouter) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// route queues messages until the stream ends. A message is queued for the
+// session it names when that session awaits a response, and otherwise for the
+// session of the oldest prompt whose result has not arrived: the CLI answers
+// prompts in order, and may name its own session rather than the prompt's.
+// Messages no prompt awaits are kept for the session they name, up to
+// maxUnclaimedMessages, and dropped with a warning beyond. Messages without a
+// session ID, such as a reconnection notice, are queued for every session with
+// a turn in progress.
+func (r *sessionRouter) route(c *Client, messages <-chan types.Message) {
+	defer func() {
+		c.mu.Lock()
+		if c.sessions == r {
+			c.receiving = false
+		}
+		c.mu.Unlock()
+
+		r.mu.Lock()
+		r.ended = true
+		r.notify()
+		r.mu.Unlock()
+	}()
+
+	for msg := range messages {
+		c.broadcast(msg)
+		if _, isResult := msg.(*types.ResultMessage); isResult {
+			c.completeTurn()
+		}
+
+		r.mu.Lock()
+		if sessionID := types.MessageSessionID(msg); sessionID != "" {
+			r.queue(c, sessionID, msg)
+		} else {
+			for sessionID, turns := range r.turns {
+				if turns > 0 {
+					r.queues[sessionID] = append(r.queues[sessionID], msg)
+				}
+			}
+		}
+		r.notify()
+		r.mu.Unlock()
+	}
+}
+
+// queue queues msg, which names sessionID, for its session. The caller holds
+// r.mu.
+func (r *sessionRouter) queue(c *Client, sessionID string, msg types.Message) {
+	owner := ""
+	switch {
+	case r.turns[sessionID] > 0 || r.receiving[sessionID]:
+		owner = sessionID
+	case len(r.prompts) > 0:
+		owner = r.prompts[0]
+	}
+
+	if owner == "" {
+		if len(r.queues[sessionID]) >= maxUnclaimedMessages {
+			if r.dropped[sessionID] == 0 {
+				c.logger.Warning("Dropping messages of session %s: no prompt awaits them and %d are already queued", sessionID, maxUnclaimedMessages)
+			}
+			r.dropped[sessionID]++
+			return
+		}
+		owner = sessionID
+	}
+	r.queues[owner] = append(r.queues[owner], msg)
+
+	if _, isResult := msg.(*types.ResultMessage); isResult {
+		for i, prompt := range r.prompts {
+			if prompt == owner {
+				r.prompts = append(r.prompts[:i], r.prompts[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// expect records a turn sent for sessionID, forget one that could not be
+// sent, and done one whose response ended.
+func (r *sessionRouter) expect(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.turns[sessionID]++
+	r.prompts = append(r.prompts, sessionID)
+}
+
+func (r *sessionRouter) forget(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.turns[sessionID] > 0 {
+		r.turns[sessionID]--
+	}
+	for i := len(r.prompts) - 1; i >= 0; i-- {
+		if r.prompts[i] == sessionID {
+			r.prompts = append(r.prompts[:i], r.prompts[i+1:]...)
+			break
+		}
+	}
+}
+
+func (r *sessionRouter) done(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.turns[sessionID] > 0 {
+		r.turns[sessionID]--
+	}
+}
+
+// receive claims the receiver slot of sessionID.
+func (r *sessionRouter) receive(sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.turns[sessionID] == 0:
+		return types.ErrNoPendingTurn
+	case r.receiving[sessionID]:
+		return types.ErrConcurrentReceive
+	}
+	r.receiving[sessionID] = true
+	return nil
+}
+
+// forward copies the queued messages of sessionID to outputChan up to and
+// including the result of its turn.
+func (r *sessionRouter) forward(ctx context.Context, sessionID string, outputChan chan<- types.Message) {
+	defer close(outputChan)
+	defer func() {
+		r.mu.Lock()
+		r.receiving[sessionID] = false
+		r.mu.Unlock()
+	}()
+
+	for {
+		r.mu.Lock()
+		queue, ended, changed := r.queues[sessionID], r.ended, r.changed
+		var msg types.Message
+		if len(queue) > 0 {
+			msg = queue[0]
+			queue[0] = nil
+			if len(queue) == 1 {
+				delete(r.queues, sessionID)
+			} else {
+				r.queues[sessionID] = queue[1:]
+			}
+		}
+		r.mu.Unlock()
+
+		if msg == nil {
+			if ended {
+				return
+			}
+			select {
+			case <-changed:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// The turn is complete once its result has been taken, even if the
+		// consumer stops before reading it
+		_, isResult := msg.(*types.ResultMessage)
+		if isResult || isReconnected(msg) {
+			r.done(sessionID)
+		}
+		select {
+		case outputChan <- msg:
+			if isResult || isReconnected(msg) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sessionRouter returns the connection's router, starting it on first use. It
+// takes the single consumer slot for the rest of the connection.
+func (c *Client) sessionRouter() (*sessionRouter, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected || c.query == nil {
+		return nil, c.notConnectedError()
+	}
+	if c.sessions != nil {
+		return c.sessions, nil
+	}
+	if c.listeners != nil {
+		return nil, types.ErrListenerConsumer
+	}
+	if c.receiving {
+		return nil, types.ErrConcurrentReceive
+	}
+	c.receiving = true
+	c.channelConsumer = true
+	c.sessions = newSessionRouter()
+
+	// Turns sent before the connection was multiplexed belong to the default session
+	c.sessions.turns[DefaultSessionID] = c.pendingTurns
+	for i := 0; i < c.pendingTurns; i++ {
+		c.sessions.prompts = append(c.sessions.prompts, DefaultSessionID)
+	}
+	go c.sessions.route(c, c.messages(c.ctx))
+	return c.sessions, nil
+}
+
+// QueryWithSession sends a prompt to Claude in the given session of the
+// connection, so several conversations can be multiplexed over one CLI process.
+// Receive the response with ReceiveResponseForSession.
+//
+// The first session-scoped call switches the connection to multiplexed
+// delivery: from then on every message is queued for a session, and responses
+// are only received with ReceiveResponseForSession (ReceiveResponse and
+// ReceiveMessages report types.ErrConcurrentReceive). Responses to Query belong
+// to DefaultSessionID. Messages of one session are never dropped while another
+// is being received.
+//
+// sessionID only names the SDK's queue; the messages keep the session_id the
+// CLI gives them. A message goes to the session its session_id names when that
+// session awaits a response, so a CLI that echoes the prompt's session ID is
+// routed by it. Otherwise, as when the CLI reports its own session UUID, the
+// message goes to the session of the oldest prompt whose result has not
+// arrived, since the CLI answers prompts in order. Messages that no prompt
+// awaits are kept for the session_id they carry, at most 100 of them, and
+// later ones are dropped with a warning.
+//
+// It returns an error if sessionID or prompt is empty, and otherwise like Query.
+//
+// Example:
+//
+//	for _, user := range users {
+//	    if err := client.QueryWithSession(ctx, user.Prompt, user.SessionID); err != nil {
+//	        log.Fatal(err)
+//	    }
+//	}
+//	for _, user := range users {
+//	    go func() {
+//	        for msg := range client.ReceiveResponseForSession(ctx, user.SessionID) {
+//	            user.Send(msg)
+//	        }
+//	    }()
+//	}
+func (c *Client) QueryWithSession(ctx context.Context, prompt, sessionID string) error {
+	if sessionID == "" {
+		return fmt.Errorf("session ID cannot be empty")
+	}
+	if err := c.awaitWritable(ctx); err != nil {
+		return err
+	}
+	if prompt == "" {
+		return fmt.Errorf("prompt cannot be empty")
+	}
+	if _, err := c.sessionRouter(); err != nil {
+		return err
+	}
+	return c.sendPrompt(ctx, prompt, sessionID)
+}
+
+// ReceiveResponseForSession returns a channel of the messages of sessionID's
+// current turn, up to and including its ResultMessage, like ReceiveResponse
+// does for an unmultiplexed connection. Messages of other sessions stay queued
+// for their own receivers, and receivers of different sessions may run
+// concurrently. The response is not bounded by QueryTimeout.
+//
+// If sessionID has no turn awaiting its response, another receiver is active
+// for it, or the client is not connected, the returned channel is closed
+// immediately and a warning is logged.
+func (c *Client) ReceiveResponseForSession(ctx context.Context, sessionID string) <-chan types.Message {
+	router, err := c.sessionRouter()
+	if err == nil {
+		err = router.receive(sessionID)
+	}
+	if err != nil {
+		c.logger.Warning("ReceiveResponseForSession(%s): %v", sessionID, err)
+		closed := make(chan types.Message)
+		close(closed)
+		return closed
+	}
+
+	outputChan := make(chan types.Message, 10)
+	go router.forward(ctx, sessionID, outputChan)
+	return outputChan
+}
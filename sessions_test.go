@@ -0,0 +1,206 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestClient_QueryWithSession tests that interleaved responses of two sessions
+// sharing a connection each reach their own receiver, whatever the order the
+// receivers start in.
+func TestClient_QueryWithSession(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	if err := client.QueryWithSession(ctx, "hi", ""); err == nil {
+		t.Error("QueryWithSession with an empty session ID succeeded")
+	}
+	for _, sessionID := range []string{"a", "b"} {
+		if err := client.QueryWithSession(ctx, "hello "+sessionID, sessionID); err != nil {
+			t.Fatalf("QueryWithSession(%s) failed: %v", sessionID, err)
+		}
+	}
+
+	// The prompts are sent in their sessions
+	var sent []string
+	mock.mu.Lock()
+	written := append([]string(nil), mock.written...)
+	mock.mu.Unlock()
+	for _, data := range written {
+		var msg struct {
+			Type      string `json:"type"`
+			SessionID string `json:"session_id"`
+		}
+		if err := json.Unmarshal([]byte(data), &msg); err == nil && msg.Type == "user" {
+			sent = append(sent, msg.SessionID)
+		}
+	}
+	if len(sent) != 2 || sent[0] != "a" || sent[1] != "b" {
+		t.Errorf("prompts sent in sessions %v, want [a b]", sent)
+	}
+
+	text := func(sessionID, text string) *types.AssistantMessage {
+		return &types.AssistantMessage{Type: "assistant", SessionID: sessionID, Content: []types.ContentBlock{
+			&types.TextBlock{Type: "text", Text: text},
+		}}
+	}
+	mock.send(text("a", "a1"))
+	mock.send(text("b", "b1"))
+	mock.send(&types.ResultMessage{Type: "result", Subtype: "success", SessionID: "b", Result: ptrString("b done")})
+	mock.send(text("a", "a2"))
+	mock.send(&types.ResultMessage{Type: "result", Subtype: "success", SessionID: "a", Result: ptrString("a done")})
+
+	// Plain receivers cannot take messages from a multiplexed connection
+	if _, err := client.ReceiveResponseE(ctx); !errors.Is(err, types.ErrConcurrentReceive) {
+		t.Errorf("ReceiveResponseE error = %v, want ErrConcurrentReceive", err)
+	}
+	if msgs := collectMessages(t, client.ReceiveResponseForSession(ctx, "c"), time.Second); len(msgs) != 0 {
+		t.Errorf("session without a turn received %d messages", len(msgs))
+	}
+
+	describe := func(msgs []types.Message) []string {
+		var got []string
+		for _, msg := range msgs {
+			switch m := msg.(type) {
+			case *types.AssistantMessage:
+				got = append(got, m.Content[0].(*types.TextBlock).Text)
+			case *types.ResultMessage:
+				got = append(got, *m.Result)
+			}
+		}
+		return got
+	}
+	b := describe(collectMessages(t, client.ReceiveResponseForSession(ctx, "b"), 2*time.Second))
+	a := describe(collectMessages(t, client.ReceiveResponseForSession(ctx, "a"), 2*time.Second))
+	if len(b) != 2 || b[0] != "b1" || b[1] != "b done" {
+		t.Errorf("session b received %v, want [b1 b done]", b)
+	}
+	if len(a) != 3 || a[0] != "a1" || a[1] != "a2" || a[2] != "a done" {
+		t.Errorf("session a received %v, want [a1 a2 a done]", a)
+	}
+
+	// Both turns are complete
+	if msgs := collectMessages(t, client.ReceiveResponseForSession(ctx, "a"), time.Second); len(msgs) != 0 {
+		t.Errorf("completed session received %d more messages", len(msgs))
+	}
+}
+
+// TestClient_QueryWithSession_Default tests that a turn sent with Query before
+// the connection is multiplexed is received as the default session.
+func TestClient_QueryWithSession_Default(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	if err := client.Query(ctx, "first"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if err := client.QueryWithSession(ctx, "second", "other"); err != nil {
+		t.Fatalf("QueryWithSession failed: %v", err)
+	}
+	mock.send(&types.ResultMessage{Type: "result", Subtype: "success", SessionID: "other"})
+	mock.send(&types.ResultMessage{Type: "result", Subtype: "success", SessionID: DefaultSessionID})
+
+	msgs := collectMessages(t, client.ReceiveResponseForSession(ctx, DefaultSessionID), 2*time.Second)
+	if len(msgs) != 1 || types.MessageSessionID(msgs[0]) != DefaultSessionID {
+		t.Errorf("default session received %v", msgs)
+	}
+	msgs = collectMessages(t, client.ReceiveResponseForSession(ctx, "other"), 2*time.Second)
+	if len(msgs) != 1 || types.MessageSessionID(msgs[0]) != "other" {
+		t.Errorf("other session received %v", msgs)
+	}
+}
+
+// TestClient_QueryWithSession_CLISessionID tests that when the CLI reports its
+// own session ID instead of the prompt's, responses reach the sessions of the
+// prompts in the order they were sent, and that messages no prompt awaits are
+// kept only up to a bound.
+func TestClient_QueryWithSession_CLISessionID(t *testing.T) {
+	ctx := testContext(t, 5*time.Second)
+	mock := newMockTransport()
+	client := newMockClient(t, nil, mock)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	const cliSession = "0b6f7c1e-cli-session"
+	text := func(text string) *types.AssistantMessage {
+		return &types.AssistantMessage{Type: "assistant", SessionID: cliSession, Content: []types.ContentBlock{
+			&types.TextBlock{Type: "text", Text: text},
+		}}
+	}
+	result := func(text string) *types.ResultMessage {
+		return &types.ResultMessage{Type: "result", Subtype: "success", SessionID: cliSession, Result: ptrString(text)}
+	}
+	describe := func(msgs []types.Message) string {
+		var got []string
+		for _, msg := range msgs {
+			switch m := msg.(type) {
+			case *types.AssistantMessage:
+				got = append(got, m.Content[0].(*types.TextBlock).Text)
+			case *types.ResultMessage:
+				got = append(got, *m.Result)
+			}
+		}
+		return strings.Join(got, ",")
+	}
+
+	for _, sessionID := range []string{"a", "b"} {
+		if err := client.QueryWithSession(ctx, "hello "+sessionID, sessionID); err != nil {
+			t.Fatalf("QueryWithSession(%s) failed: %v", sessionID, err)
+		}
+	}
+	mock.send(text("a1"))
+	mock.send(result("a done"))
+	mock.send(text("b1"))
+	mock.send(result("b done"))
+
+	if got := describe(collectMessages(t, client.ReceiveResponseForSession(ctx, "b"), 2*time.Second)); got != "b1,b done" {
+		t.Errorf("session b received %q, want %q", got, "b1,b done")
+	}
+	if got := describe(collectMessages(t, client.ReceiveResponseForSession(ctx, "a"), 2*time.Second)); got != "a1,a done" {
+		t.Errorf("session a received %q, want %q", got, "a1,a done")
+	}
+
+	// Messages no prompt awaits are bounded
+	for i := 0; i < 2*maxUnclaimedMessages; i++ {
+		mock.send(text("late"))
+	}
+	router := client.sessions
+	for {
+		router.mu.Lock()
+		queued, dropped := len(router.queues[cliSession]), router.dropped[cliSession]
+		router.mu.Unlock()
+		if queued+dropped == 2*maxUnclaimedMessages {
+			if queued != maxUnclaimedMessages {
+				t.Errorf("%d unclaimed messages queued, want %d", queued, maxUnclaimedMessages)
+			}
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("router took %d of %d unclaimed messages", queued+dropped, 2*maxUnclaimedMessages)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The next turn of a session only gets its own response
+	if err := client.QueryWithSession(ctx, "again", "a"); err != nil {
+		t.Fatalf("QueryWithSession failed: %v", err)
+	}
+	mock.send(result("a again"))
+	if got := describe(collectMessages(t, client.ReceiveResponseForSession(ctx, "a"), 2*time.Second)); got != "a again" {
+		t.Errorf("session a received %q, want %q", got, "a again")
+	}
+}
@@ -0,0 +1,95 @@
+package claude
+
+import (
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// defaultSubscriberBuffer is how many messages a subscription holds for its
+// reader when options.SubscriberBuffer is not set.
+const defaultSubscriberBuffer = 256
+
+// Subscribe returns an independent copy of the client's message stream, for
+// observers such as a logger or a UI that watch alongside the consumer. Every
+// message taken from the connection is broadcast to all subscriptions in
+// order: messages read with ReceiveResponse, ReceiveMessages, Run or
+// ResponseSeq, those of the QueryWithSession router, those of abandoned turns
+// discarded by the SDK, and the *types.ErrorMessage reporting a lost
+// connection. Subscribing does not consume messages, so a consumer is still
+// needed for the stream to advance.
+//
+// A subscription lasts until unsubscribe is called or the client is closed;
+// either closes the channel. It survives automatic reconnections (see
+// WithAutoReconnect), but not Close: subscribe again after Reconnect.
+// Broadcasting never blocks the client: a subscriber that falls more than
+// options.SubscriberBuffer messages behind (see WithSubscriberBuffer) is
+// dropped and its channel closed, so a closed channel before unsubscribe or
+// Close means messages were missed. unsubscribe may be called more than once.
+//
+// Example:
+//
+//	events, unsubscribe := client.Subscribe()
+//	defer unsubscribe()
+//	go func() {
+//	    for msg := range events {
+//	        logger.Log(msg)
+//	    }
+//	}()
+//	for msg := range client.ReceiveResponse(ctx) {
+//	    ui.Render(msg)
+//	}
+func (c *Client) Subscribe() (<-chan types.Message, func()) {
+	sub := make(chan types.Message, c.subscriberBuffer())
+
+	c.subsMu.Lock()
+	if c.subscribers == nil {
+		c.subscribers = make(map[chan types.Message]struct{})
+	}
+	c.subscribers[sub] = struct{}{}
+	c.subsMu.Unlock()
+
+	return sub, sync.OnceFunc(func() {
+		c.subsMu.Lock()
+		defer c.subsMu.Unlock()
+		if _, ok := c.subscribers[sub]; ok {
+			delete(c.subscribers, sub)
+			close(sub)
+		}
+	})
+}
+
+// subscriberBuffer returns how many messages a new subscription holds.
+func (c *Client) subscriberBuffer() int {
+	if c.options != nil && c.options.SubscriberBuffer > 0 {
+		return c.options.SubscriberBuffer
+	}
+	return defaultSubscriberBuffer
+}
+
+// broadcast sends msg to every subscription, dropping those that are full.
+func (c *Client) broadcast(msg types.Message) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	for sub := range c.subscribers {
+		select {
+		case sub <- msg:
+		default:
+			c.logger.Warning("Dropping a subscriber that fell %d messages behind", cap(sub))
+			delete(c.subscribers, sub)
+			close(sub)
+		}
+	}
+}
+
+// closeSubscribers ends every subscription.
+func (c *Client) closeSubscribers() {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	for sub := range c.subscribers {
+		close(sub)
+	}
+	clear(c.subscribers)
+}
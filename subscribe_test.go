@@ -0,0 +1,115 @@
+package claude
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestClient_Subscribe tests observing the message stream: every subscriber
+// sees the whole stream in order alongside the consumer, a subscriber that
+// falls behind is dropped, and unsubscribing or closing ends subscriptions.
+func TestClient_Subscribe(t *testing.T) {
+	turn := func(n int) []types.Message {
+		var messages []types.Message
+		for i := 0; i < n; i++ {
+			text := fmt.Sprintf("part %d", i)
+			messages = append(messages, &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: text}}})
+		}
+		return append(messages, &types.ResultMessage{Type: "result", Subtype: "success"})
+	}
+
+	t.Run("subscribers see the full stream", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+
+		// Subscribing before Connect is allowed
+		first, unsubscribeFirst := client.Subscribe()
+		defer unsubscribeFirst()
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		second, unsubscribeSecond := client.Subscribe()
+		defer unsubscribeSecond()
+
+		sent := turn(20)
+		if err := client.Query(ctx, "hi"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, msg := range sent {
+			mock.send(msg)
+		}
+		received := collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second)
+		if len(received) != len(sent) {
+			t.Fatalf("consumer received %d messages, want %d", len(received), len(sent))
+		}
+
+		for name, sub := range map[string]<-chan types.Message{"first": first, "second": second} {
+			for i, want := range sent {
+				select {
+				case msg := <-sub:
+					if msg != want {
+						t.Fatalf("%s subscriber message %d = %v, want %v", name, i, msg, want)
+					}
+				case <-ctx.Done():
+					t.Fatalf("%s subscriber got %d of %d messages", name, i, len(sent))
+				}
+			}
+		}
+	})
+
+	t.Run("slow subscriber is dropped", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		mock := newMockTransport()
+		client := newMockClient(t, types.NewClaudeAgentOptions().WithSubscriberBuffer(4), mock)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		slow, unsubscribe := client.Subscribe()
+		defer unsubscribe()
+
+		if err := client.Query(ctx, "hi"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		sent := turn(10)
+		for _, msg := range sent {
+			mock.send(msg)
+		}
+		// The consumer is not held up by the subscriber
+		if received := collectMessages(t, client.ReceiveResponse(ctx), 5*time.Second); len(received) != len(sent) {
+			t.Fatalf("consumer received %d messages, want %d", len(received), len(sent))
+		}
+
+		observed := collectMessages(t, slow, time.Second)
+		if len(observed) != 4 {
+			t.Errorf("slow subscriber got %d messages before being dropped, want 4", len(observed))
+		}
+	})
+
+	t.Run("unsubscribe and close", func(t *testing.T) {
+		ctx := testContext(t, 5*time.Second)
+		client := newMockClient(t, nil, newMockTransport())
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		first, unsubscribe := client.Subscribe()
+		unsubscribe()
+		unsubscribe() // Idempotent
+		if _, ok := <-first; ok {
+			t.Error("subscription still open after unsubscribe")
+		}
+
+		second, unsubscribeSecond := client.Subscribe()
+		if err := client.Close(ctx); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if _, ok := <-second; ok {
+			t.Error("subscription still open after Close")
+		}
+		unsubscribeSecond() // Safe after Close
+	})
+}
@@ -0,0 +1,177 @@
+package claude
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TurnSummary describes the messages of one query/response turn.
+//
+// It is built by Summarize and is intended for end-of-turn footers, logging,
+// and lightweight metrics.
+type TurnSummary struct {
+	MessageCounts map[string]int // Number of messages by message type
+	ToolUses      map[string]int // Number of tool calls by tool name
+	TextLength    int            // Total characters of assistant text
+	AutoContinues int            // Truncated answers continued by the SDK (see WithAutoContinueOnTruncation)
+
+	// Fields taken from the ResultMessage(s)
+	Duration  time.Duration // Wall-clock duration reported by the CLI
+	CostUSD   float64       // Total cost reported by the CLI (0 when not reported)
+	NumTurns  int           // Number of agent turns reported by the CLI
+	SessionID string        // Session ID of the last result
+	IsError   bool          // True if any result reported an error
+	Subtype   string        // Subtype of the last result (e.g. "success", "error_max_turns")
+
+	// Cache holds prompt cache use and model request counts from the results' usage
+	Cache types.CacheEfficiency
+
+	// Thinking splits the results' output tokens between visible output and
+	// extended thinking, estimated from the ThinkingBlocks when not reported
+	Thinking types.ThinkingUsage
+
+	Interrupted bool // True if a result ended a turn interrupted by the user
+	Refused     bool // True if the model declined the request (see types.DetectRefusal)
+
+	err error // Error of the last failed result, see Err
+}
+
+// Summarize builds a TurnSummary from the messages received for a turn, such as
+// those collected from Query or Client.ReceiveResponse.
+//
+// Error results are summarized like any other (with IsError set). An error is
+// returned only when messages contain no ResultMessage, i.e. the turn did not
+// complete; it is a *types.IncompleteStreamError carrying the partial output,
+// and the returned summary still covers the messages that were received.
+//
+// Refused is detected with types.DefaultRefusalClassifier; call
+// types.DetectRefusal directly to use another classifier.
+//
+// Example:
+//
+//	var received []types.Message
+//	for msg := range messages {
+//	    received = append(received, msg)
+//	}
+//	if summary, err := claude.Summarize(received); err == nil {
+//	    fmt.Println(summary)
+//	}
+func Summarize(messages []types.Message) (TurnSummary, error) {
+	summary := TurnSummary{
+		MessageCounts: make(map[string]int),
+		ToolUses:      make(map[string]int),
+	}
+
+	results := 0
+	thinkingChars := 0
+	tracker := internal.NewTurnTracker()
+	for _, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		summary.MessageCounts[msg.GetMessageType()]++
+		tracker.Observe(msg)
+		thinkingChars += types.ThinkingChars(msg)
+
+		switch m := msg.(type) {
+		case *types.AssistantMessage:
+			for _, block := range m.Content {
+				switch b := block.(type) {
+				case *types.TextBlock:
+					summary.TextLength += len(b.Text)
+				case *types.ToolUseBlock:
+					summary.ToolUses[b.Name]++
+				}
+			}
+		case *types.SystemMessage:
+			if m.IsAutoContinue() {
+				summary.AutoContinues++
+			}
+		case *types.ResultMessage:
+			results++
+			if err := tracker.Finish(m); err != nil {
+				summary.err = err
+			}
+			summary.Interrupted = summary.Interrupted || m.IsInterrupted()
+			summary.Duration += time.Duration(m.DurationMs) * time.Millisecond
+			summary.NumTurns += m.NumTurns
+			if m.TotalCostUSD != nil {
+				summary.CostUSD += *m.TotalCostUSD
+			}
+			summary.SessionID = m.SessionID
+			summary.Subtype = m.Subtype
+			summary.IsError = summary.IsError || m.IsError
+			summary.Cache = summary.Cache.Add(types.CacheEfficiencyFromResult(m))
+			summary.Thinking = summary.Thinking.Add(types.ThinkingUsageFromResult(m, thinkingChars))
+			thinkingChars = 0
+		}
+	}
+
+	summary.Refused = types.DetectRefusal(messages, nil) != nil
+
+	if results == 0 {
+		return summary, tracker.Incomplete(fmt.Sprintf("no ResultMessage in %d messages: turn did not complete", len(messages)), nil)
+	}
+	return summary, nil
+}
+
+// Err returns the error of the last failed result: a *types.TurnInterruptedError
+// if the turn was interrupted by the user, a *types.ResultError if it ended with
+// an error result, or nil if every result succeeded. Errors carry the output of
+// their turn.
+func (s TurnSummary) Err() error {
+	return s.err
+}
+
+// String renders the summary as a single line suitable for a CLI footer, e.g.
+//
+//	Done in 1.2s | 2 turns | $0.0123 | tools: Bash x2, Read x1 | 84 chars
+func (s TurnSummary) String() string {
+	status := "Done"
+	switch {
+	case s.Interrupted:
+		status = "Interrupted"
+	case s.Refused && !s.IsError:
+		status = "Refused"
+	case s.IsError:
+		status = "Failed"
+		if s.Subtype != "" {
+			status = fmt.Sprintf("Failed (%s)", s.Subtype)
+		}
+	}
+
+	parts := []string{
+		fmt.Sprintf("%s in %s", status, s.Duration.Round(100*time.Millisecond)),
+		pluralize(s.NumTurns, "turn"),
+		fmt.Sprintf("$%.4f", s.CostUSD),
+	}
+	if len(s.ToolUses) > 0 {
+		names := make([]string, 0, len(s.ToolUses))
+		for name := range s.ToolUses {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		tools := make([]string, 0, len(names))
+		for _, name := range names {
+			tools = append(tools, fmt.Sprintf("%s x%d", name, s.ToolUses[name]))
+		}
+		parts = append(parts, "tools: "+strings.Join(tools, ", "))
+	}
+	parts = append(parts, pluralize(s.TextLength, "char"))
+
+	return strings.Join(parts, " | ")
+}
+
+// pluralize formats a count with a naively pluralized noun.
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,212 @@
+package claude
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func ptrFloat(f float64) *float64 { return &f }
+
+func ptrString(s string) *string { return &s }
+
+func TestSummarize(t *testing.T) {
+	messages := []types.Message{
+		&types.SystemMessage{Type: "system", Subtype: "init"},
+		&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.TextBlock{Type: "text", Text: "Let me look."},
+			&types.ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Bash"},
+			&types.ToolUseBlock{Type: "tool_use", ID: "t2", Name: "Read"},
+		}},
+		&types.UserMessage{Type: "user", Content: []types.ContentBlock{
+			&types.ToolResultBlock{Type: "tool_result", ToolUseID: "t1"},
+		}},
+		&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.ToolUseBlock{Type: "tool_use", ID: "t3", Name: "Bash"},
+			&types.TextBlock{Type: "text", Text: "Done."},
+		}},
+		&types.ResultMessage{
+			Type:         "result",
+			Subtype:      "success",
+			DurationMs:   1234,
+			NumTurns:     2,
+			SessionID:    "s-1",
+			TotalCostUSD: ptrFloat(0.0123),
+			Result:       ptrString("Done."),
+		},
+	}
+
+	summary, err := Summarize(messages)
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+
+	wantCounts := map[string]int{"system": 1, "assistant": 2, "user": 1, "result": 1}
+	for msgType, want := range wantCounts {
+		if got := summary.MessageCounts[msgType]; got != want {
+			t.Errorf("MessageCounts[%s] = %d, want %d", msgType, got, want)
+		}
+	}
+	if summary.ToolUses["Bash"] != 2 || summary.ToolUses["Read"] != 1 {
+		t.Errorf("ToolUses = %v, want Bash:2 Read:1", summary.ToolUses)
+	}
+	if summary.TextLength != len("Let me look.")+len("Done.") {
+		t.Errorf("TextLength = %d, want %d", summary.TextLength, len("Let me look.")+len("Done."))
+	}
+	if summary.Duration != 1234*time.Millisecond {
+		t.Errorf("Duration = %v, want 1.234s", summary.Duration)
+	}
+	if summary.CostUSD != 0.0123 {
+		t.Errorf("CostUSD = %v, want 0.0123", summary.CostUSD)
+	}
+	if summary.NumTurns != 2 || summary.SessionID != "s-1" || summary.IsError {
+		t.Errorf("unexpected result fields: %+v", summary)
+	}
+
+	want := "Done in 1.2s | 2 turns | $0.0123 | tools: Bash x2, Read x1 | 17 chars"
+	if got := summary.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestSummarize_Refused(t *testing.T) {
+	messages := []types.Message{
+		&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.TextBlock{Type: "text", Text: "I can't help with bypassing the license check."},
+		}},
+		&types.ResultMessage{Type: "result", Subtype: "success", DurationMs: 800, NumTurns: 1, SessionID: "s-1"},
+	}
+
+	summary, err := Summarize(messages)
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if !summary.Refused || summary.IsError || summary.Err() != nil {
+		t.Errorf("Refused = %v, IsError = %v, Err = %v; want a refusal that is not an error", summary.Refused, summary.IsError, summary.Err())
+	}
+	if got := summary.String(); !strings.HasPrefix(got, "Refused in 800ms") {
+		t.Errorf("String() = %q, want it to report the refusal", got)
+	}
+}
+
+func TestSummarize_ErrorResult(t *testing.T) {
+	messages := []types.Message{
+		&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.TextBlock{Type: "text", Text: "x"},
+		}},
+		&types.ResultMessage{
+			Type:       "result",
+			Subtype:    "error_max_turns",
+			IsError:    true,
+			DurationMs: 500,
+			NumTurns:   1,
+		},
+	}
+
+	summary, err := Summarize(messages)
+	if err != nil {
+		t.Fatalf("error results should still summarize, got: %v", err)
+	}
+	if !summary.IsError || summary.Subtype != "error_max_turns" {
+		t.Errorf("expected error result to be reflected, got %+v", summary)
+	}
+	if summary.CostUSD != 0 {
+		t.Errorf("CostUSD = %v, want 0 when not reported", summary.CostUSD)
+	}
+
+	want := "Failed (error_max_turns) in 500ms | 1 turn | $0.0000 | 1 char"
+	if got := summary.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestSummarize_Incomplete(t *testing.T) {
+	messages := []types.Message{
+		&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.ToolUseBlock{Type: "tool_use", Name: "Write"},
+		}},
+	}
+
+	summary, err := Summarize(messages)
+	if err == nil {
+		t.Fatal("expected an error when no ResultMessage is present")
+	}
+	if !strings.Contains(err.Error(), "did not complete") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	var incomplete *types.IncompleteStreamError
+	if !errors.As(err, &incomplete) || incomplete.Context.LastToolUse == nil || incomplete.Context.LastToolUse.Name != "Write" {
+		t.Errorf("expected IncompleteStreamError with the last tool use, got %v", err)
+	}
+	if summary.ToolUses["Write"] != 1 {
+		t.Errorf("partial summary should still count tool uses, got %v", summary.ToolUses)
+	}
+}
+
+func TestSummarize_MultipleResults(t *testing.T) {
+	messages := []types.Message{
+		&types.ResultMessage{Type: "result", Subtype: "success", DurationMs: 1000, NumTurns: 1, TotalCostUSD: ptrFloat(0.01), SessionID: "s-1"},
+		&types.ResultMessage{Type: "result", Subtype: "success", DurationMs: 2000, NumTurns: 3, TotalCostUSD: ptrFloat(0.02), SessionID: "s-2"},
+	}
+
+	summary, err := Summarize(messages)
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if summary.Duration != 3*time.Second || summary.NumTurns != 4 || summary.SessionID != "s-2" {
+		t.Errorf("results should accumulate, got %+v", summary)
+	}
+	if summary.CostUSD < 0.0299 || summary.CostUSD > 0.0301 {
+		t.Errorf("CostUSD = %v, want 0.03", summary.CostUSD)
+	}
+}
+
+func TestSummarize_CacheEfficiency(t *testing.T) {
+	messages := []types.Message{
+		&types.ResultMessage{Type: "result", Subtype: "success", NumTurns: 3, Usage: map[string]interface{}{
+			"input_tokens":                float64(50),
+			"cache_read_input_tokens":     float64(900),
+			"cache_creation_input_tokens": float64(50),
+			"server_tool_use":             map[string]interface{}{"web_search_requests": float64(2)},
+		}},
+	}
+
+	summary, err := Summarize(messages)
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if summary.Cache.HitRatio() != 0.9 || summary.Cache.ModelRequests != 3 || summary.Cache.ServerToolRequests != 2 {
+		t.Errorf("unexpected cache efficiency: %+v (hit ratio %v)", summary.Cache, summary.Cache.HitRatio())
+	}
+}
+
+func TestSummarize_Thinking(t *testing.T) {
+	thinking := func(n int) *types.AssistantMessage {
+		return &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.ThinkingBlock{Type: "thinking", Thinking: strings.Repeat("x", n)},
+			&types.TextBlock{Type: "text", Text: "answer"},
+		}}
+	}
+	messages := []types.Message{
+		thinking(400),
+		&types.ResultMessage{Type: "result", Subtype: "success", Usage: map[string]interface{}{
+			"output_tokens":         float64(500),
+			"output_tokens_details": map[string]interface{}{"thinking_tokens": float64(300)},
+		}},
+		thinking(800),
+		&types.ResultMessage{Type: "result", Subtype: "success", Usage: map[string]interface{}{"output_tokens": float64(400)}},
+	}
+
+	summary, err := Summarize(messages)
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	// The second turn's 800 thinking characters are estimated as 200 tokens
+	want := types.ThinkingUsage{OutputTokens: 900, ThinkingTokens: 500, Estimated: true}
+	if summary.Thinking != want {
+		t.Errorf("Thinking = %+v, want %+v", summary.Thinking, want)
+	}
+}
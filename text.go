@@ -0,0 +1,185 @@
+package claude
+
+import (
+	"context"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ReceiveText receives the current turn's response like ReceiveResponse and
+// returns its assistant text: the TextBlocks of every AssistantMessage,
+// concatenated in order. Tool use and thinking blocks are skipped; their
+// counts are recorded in the result's Meta (ToolUses, ThinkingBlocks).
+//
+// The error is a *types.ResultError (or *types.TurnInterruptedError) when the
+// turn ended with an error result, a *types.RefusalError for a refused turn
+// with FailOnRefusal, ctx.Err() when ctx ends first, and the connection's
+// error (see Err) or a *types.IncompleteStreamError when the stream ends
+// before the result; ReceiveResponseE's errors are returned as they are. The
+// text received so far is returned with any error, and the result with any
+// error that follows it.
+//
+// Example:
+//
+//	if err := client.Query(ctx, "Summarize README.md in one sentence"); err != nil {
+//	    log.Fatal(err)
+//	}
+//	text, result, err := client.ReceiveText(ctx)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("%s\n($%.4f)\n", text, *result.TotalCostUSD)
+func (c *Client) ReceiveText(ctx context.Context) (string, *types.ResultMessage, error) {
+	messages, err := c.ReceiveResponseE(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	collected, err := collectTurn(ctx, messages, c.options, c.Err)
+	return collected.Text, collected.Result, err
+}
+
+// QueryText runs a one-shot query like Query and returns the assistant text
+// of its response, the final ResultMessage and an error, as
+// Client.ReceiveText does.
+//
+// Example:
+//
+//	text, _, err := claude.QueryText(ctx, "What is 2 + 2?", nil)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Println(text)
+func QueryText(ctx context.Context, prompt string, options *types.ClaudeAgentOptions) (string, *types.ResultMessage, error) {
+	if options == nil {
+		options = types.NewClaudeAgentOptions()
+	}
+	messages, err := Query(ctx, prompt, options)
+	if err != nil {
+		return "", nil, err
+	}
+	collected, err := collectTurn(ctx, messages, options, nil)
+	return collected.Text, collected.Result, err
+}
+
+// QueryCollect runs a one-shot query like Query and returns its whole
+// response: every message in order, the assistant text as QueryText returns
+// it, and the final result with its cost and session ID.
+//
+// When the query ends without its result for any reason but ctx ending, e.g.
+// because the CLI crashed, exited mid-turn or went quiet for longer than
+// QueryTimeout, the error is a *types.ProcessError wrapping the cause, which
+// errors.As still finds (a *types.TimeoutError, for instance). Otherwise the
+// errors are those of QueryText. The messages collected so far are returned
+// with any error that follows the start of the query.
+//
+// Example:
+//
+//	collected, err := claude.QueryCollect(ctx, "List the TODOs in main.go", nil)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("%s\n(session %s, $%.4f)\n", collected.Text, collected.SessionID, collected.TotalCostUSD)
+func QueryCollect(ctx context.Context, prompt string, options *types.ClaudeAgentOptions) (*types.QueryResult, error) {
+	if options == nil {
+		options = types.NewClaudeAgentOptions()
+	}
+	messages, err := Query(ctx, prompt, options)
+	if err != nil {
+		return nil, err
+	}
+	collected, err := collectTurn(ctx, messages, options, nil)
+	if collected.Result == nil && err != nil && ctx.Err() == nil && !types.IsProcessError(err) {
+		err = types.NewProcessErrorWithCause("query ended before its result", err)
+	}
+	return collected, err
+}
+
+// collectTurn reads a turn's messages until the channel closes, returning
+// them with their assistant text and result, and the error ReceiveText
+// describes. connErr, if not nil, reports why the stream ended early when no
+// ErrorMessage says so. The returned QueryResult is never nil.
+func collectTurn(ctx context.Context, messages <-chan types.Message, options *types.ClaudeAgentOptions, connErr func() error) (*types.QueryResult, error) {
+	var (
+		text           strings.Builder
+		received       []types.Message
+		result         *types.ResultMessage
+		streamErr      error
+		toolUses       int
+		thinkingBlocks int
+	)
+	collected := func() *types.QueryResult {
+		return newQueryResult(received, text.String(), result)
+	}
+	tracker := internal.NewTurnTracker()
+	for msg := range messages {
+		received = append(received, msg)
+		tracker.Observe(msg)
+		switch m := msg.(type) {
+		case *types.AssistantMessage:
+			for _, block := range m.Content {
+				switch b := block.(type) {
+				case *types.TextBlock:
+					text.WriteString(b.Text)
+				case *types.ToolUseBlock:
+					toolUses++
+				case *types.ThinkingBlock:
+					thinkingBlocks++
+				}
+			}
+		case *types.ResultMessage:
+			result = m
+		case *types.ErrorMessage:
+			streamErr = m.Err
+		}
+	}
+
+	if result == nil {
+		switch {
+		case ctx.Err() != nil:
+			return collected(), ctx.Err()
+		case streamErr != nil:
+			return collected(), streamErr
+		}
+		if connErr != nil {
+			if err := connErr(); err != nil {
+				return collected(), err
+			}
+		}
+		return collected(), tracker.Incomplete("stream ended before the turn's result", nil)
+	}
+
+	if result.Meta == nil {
+		result.Meta = &types.ResultMeta{}
+	}
+	result.Meta.ToolUses, result.Meta.ThinkingBlocks = toolUses, thinkingBlocks
+
+	turnContext := tracker.Context()
+	if err := tracker.Finish(result); err != nil {
+		return collected(), err
+	}
+	if options.FailOnRefusal {
+		if refusal := types.DetectRefusal(received, options.RefusalClassifier); refusal != nil {
+			refusal.Context = turnContext
+			return collected(), refusal
+		}
+	}
+	return collected(), nil
+}
+
+// newQueryResult builds the QueryResult of the received messages, their
+// assistant text and their result, which may be nil.
+func newQueryResult(messages []types.Message, text string, result *types.ResultMessage) *types.QueryResult {
+	collected := &types.QueryResult{Messages: messages, Text: text, Result: result}
+	if result != nil {
+		if result.TotalCostUSD != nil {
+			collected.TotalCostUSD = *result.TotalCostUSD
+		}
+		collected.SessionID = result.SessionID
+	}
+	for i := len(messages) - 1; i >= 0 && collected.SessionID == ""; i-- {
+		collected.SessionID = types.MessageSessionID(messages[i])
+	}
+	return collected
+}
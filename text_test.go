@@ -0,0 +1,226 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestClient_ReceiveText tests aggregating a turn's text across blocks and
+// messages, the skipped block counts, and the errors of failed, refused and
+// cut-off turns.
+func TestClient_ReceiveText(t *testing.T) {
+	assistant := func(blocks ...types.ContentBlock) types.Message {
+		return &types.AssistantMessage{Type: "assistant", Content: blocks}
+	}
+	text := func(s string) types.ContentBlock { return &types.TextBlock{Type: "text", Text: s} }
+	connect := func(t *testing.T, opts *types.ClaudeAgentOptions) (*Client, *mockTransport) {
+		t.Helper()
+		mock := newMockTransport()
+		client := newMockClient(t, opts, mock)
+		if err := client.Connect(testContext(t, 5*time.Second)); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if err := client.Query(testContext(t, 5*time.Second), "hi"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		return client, mock
+	}
+
+	t.Run("multi-block and multi-message turn", func(t *testing.T) {
+		client, mock := connect(t, nil)
+		mock.send(assistant(
+			&types.ThinkingBlock{Type: "thinking", Thinking: "Look at the file first."},
+			text("Let me check. "),
+			&types.ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Read", Input: map[string]interface{}{"file_path": "go.mod"}},
+		))
+		mock.send(&types.UserMessage{Type: "user", Content: []types.ContentBlock{&types.ToolResultBlock{Type: "tool_result", ToolUseID: "t1", Content: "module x"}}})
+		mock.send(assistant(text("The module "), text("is x.")))
+		sent := &types.ResultMessage{Type: "result", Subtype: "success"}
+		mock.send(sent)
+
+		got, result, err := client.ReceiveText(testContext(t, 5*time.Second))
+		if err != nil {
+			t.Fatalf("ReceiveText failed: %v", err)
+		}
+		if got != "Let me check. The module is x." {
+			t.Errorf("text = %q", got)
+		}
+		if result != sent || result.Meta == nil || result.Meta.ToolUses != 1 || result.Meta.ThinkingBlocks != 1 {
+			t.Errorf("result = %+v, want the turn's result counting 1 tool use and 1 thinking block", result)
+		}
+	})
+
+	t.Run("error result", func(t *testing.T) {
+		client, mock := connect(t, nil)
+		mock.send(assistant(text("Partial answer")))
+		mock.send(&types.ResultMessage{Type: "result", Subtype: "error_max_turns", IsError: true})
+
+		got, result, err := client.ReceiveText(testContext(t, 5*time.Second))
+		if !types.IsResultError(err) || result == nil || got != "Partial answer" {
+			t.Errorf("got (%q, %v, %v), want the text and result with a ResultError", got, result, err)
+		}
+	})
+
+	t.Run("refusal", func(t *testing.T) {
+		client, mock := connect(t, types.NewClaudeAgentOptions().WithFailOnRefusal(true))
+		mock.send(assistant(text("I can't help with that request.")))
+		mock.send(&types.ResultMessage{Type: "result", Subtype: "success"})
+
+		if _, result, err := client.ReceiveText(testContext(t, 5*time.Second)); !types.IsRefusalError(err) || result == nil {
+			t.Errorf("got (%v, %v), want the result with a RefusalError", result, err)
+		}
+	})
+
+	t.Run("stream ends before the result", func(t *testing.T) {
+		client, mock := connect(t, nil)
+		mock.send(assistant(text("Working on")))
+		mock.Close(testContext(t, time.Second))
+
+		got, result, err := client.ReceiveText(testContext(t, 5*time.Second))
+		if err == nil || result != nil || got != "Working on" {
+			t.Errorf("got (%q, %v, %v), want the partial text and the connection error", got, result, err)
+		}
+	})
+
+	t.Run("no pending turn", func(t *testing.T) {
+		mock := newMockTransport()
+		client := newMockClient(t, nil, mock)
+		ctx := testContext(t, 5*time.Second)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if _, _, err := client.ReceiveText(ctx); err != types.ErrNoPendingTurn {
+			t.Errorf("error = %v, want ErrNoPendingTurn", err)
+		}
+	})
+}
+
+// TestQueryText tests the one-shot path against a mock CLI.
+func TestQueryText(t *testing.T) {
+	ctx := testContext(t, 10*time.Second)
+	cli := writeMockCLI(t, `
+read line
+echo '{"type":"assistant","message":{"model":"m","content":[{"type":"thinking","thinking":"Easy.","signature":"s"},{"type":"text","text":"2 + 2 "}]}}'
+echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"is 4."}]}}'
+echo '{"type":"result","subtype":"success","is_error":false,"result":"2 + 2 is 4.","session_id":"s-1"}'
+`)
+
+	text, result, err := QueryText(ctx, "What is 2 + 2?", types.NewClaudeAgentOptions().WithCLIPath(cli))
+	if err != nil {
+		t.Fatalf("QueryText failed: %v", err)
+	}
+	if text != "2 + 2 is 4." {
+		t.Errorf("text = %q", text)
+	}
+	if result == nil || result.SessionID != "s-1" || result.Meta.ThinkingBlocks != 1 || result.Meta.ToolUses != 0 {
+		t.Errorf("result = %+v, want s-1 counting 1 thinking block", result)
+	}
+
+	if _, _, err := QueryText(ctx, "", nil); err == nil {
+		t.Error("empty prompt: want an error")
+	}
+}
+
+// TestQueryCollect tests collecting a whole response, and what is returned
+// when the CLI crashes or the caller gives up first.
+func TestQueryCollect(t *testing.T) {
+	t.Run("complete", func(t *testing.T) {
+		ctx := testContext(t, 10*time.Second)
+		cli := writeMockCLI(t, `
+read line
+echo '{"type":"system","subtype":"init","session_id":"s-1"}'
+echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"2 + 2 "},{"type":"tool_use","id":"t1","name":"Bash","input":{}}]}}'
+echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"is 4."}]}}'
+echo '{"type":"result","subtype":"success","is_error":false,"result":"2 + 2 is 4.","session_id":"s-1","total_cost_usd":0.25}'
+`)
+
+		collected, err := QueryCollect(ctx, "What is 2 + 2?", types.NewClaudeAgentOptions().WithCLIPath(cli))
+		if err != nil {
+			t.Fatalf("QueryCollect failed: %v", err)
+		}
+		if len(collected.Messages) != 4 || collected.Messages[3] != collected.Result {
+			t.Errorf("messages = %v, want 4 ending with the result", collected.Messages)
+		}
+		if collected.Text != "2 + 2 is 4." || collected.TotalCostUSD != 0.25 || collected.SessionID != "s-1" {
+			t.Errorf("collected = %+v, want the text, cost and session", collected)
+		}
+	})
+
+	t.Run("CLI crash", func(t *testing.T) {
+		ctx := testContext(t, 10*time.Second)
+		collected, err := QueryCollect(ctx, "crash", types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, brokenCLI)))
+		if !types.IsProcessError(err) {
+			t.Errorf("error = %v, want a ProcessError", err)
+		}
+		if collected == nil || collected.Result != nil || collected.Text != "partial" {
+			t.Fatalf("collected = %+v, want the partial text without a result", collected)
+		}
+		if _, ok := collected.Messages[len(collected.Messages)-1].(*types.ErrorMessage); !ok {
+			t.Errorf("last message = %#v, want the ErrorMessage", collected.Messages[len(collected.Messages)-1])
+		}
+	})
+
+	t.Run("CLI exits mid-turn", func(t *testing.T) {
+		ctx := testContext(t, 10*time.Second)
+		cli := writeMockCLI(t, `
+read line
+echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"partial"}]}}'
+exit 0
+`)
+		collected, err := QueryCollect(ctx, "hi", types.NewClaudeAgentOptions().WithCLIPath(cli))
+		if !types.IsProcessError(err) {
+			t.Errorf("error = %v, want a ProcessError", err)
+		}
+		if collected == nil || collected.Result != nil || collected.Text != "partial" {
+			t.Errorf("collected = %+v, want the partial text without a result", collected)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx := testContext(t, 10*time.Second)
+		cli := writeMockCLI(t, `
+read line
+echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"partial"}]}}'
+sleep 30
+`)
+		collected, err := QueryCollect(ctx, "hi", types.NewClaudeAgentOptions().WithCLIPath(cli).WithQueryTimeout(200*time.Millisecond))
+		if !types.IsProcessError(err) || !types.IsTimeoutError(err) {
+			t.Errorf("error = %v, want a ProcessError wrapping a TimeoutError", err)
+		}
+		if collected == nil || collected.Result != nil || collected.Text != "partial" {
+			t.Errorf("collected = %+v, want the partial text without a result", collected)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(testContext(t, 10*time.Second))
+		cli := writeMockCLI(t, `
+read line
+echo '{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"working"}]}}'
+sleep 30
+`)
+		done := make(chan *types.QueryResult, 1)
+		go func() {
+			collected, err := QueryCollect(ctx, "hi", types.NewClaudeAgentOptions().WithCLIPath(cli))
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("error = %v, want context.Canceled", err)
+			}
+			done <- collected
+		}()
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+
+		select {
+		case collected := <-done:
+			if collected == nil || collected.Result != nil {
+				t.Errorf("collected = %+v, want messages without a result", collected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("QueryCollect did not return after cancellation")
+		}
+	})
+}
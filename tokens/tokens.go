@@ -0,0 +1,150 @@
+// Package tokens estimates the token counts of prompts before they are sent,
+// so budget-conscious callers can check a prompt's size without a network
+// call.
+//
+// The estimates are heuristics, not a tokenizer: for English prose and source
+// code they are typically within 25% of the count the API reports, and less
+// accurate for unusual text such as long runs of digits, minified data or
+// mixed scripts. Use them for budgeting and guards, not billing.
+//
+// Example:
+//
+//	if tokens.EstimateTokens(prompt) > 50_000 {
+//	    return errors.New("prompt too large")
+//	}
+package tokens
+
+import (
+	"encoding/base64"
+	"image"
+	_ "image/gif" // Register decoders for image sizing
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+const (
+	// proseCharsPerToken and codeCharsPerToken are the typical ratios of
+	// ASCII characters per token for English prose and for source code.
+	proseCharsPerToken = 4.0
+	codeCharsPerToken  = 3.0
+
+	// codeSymbolDensity is the share of symbols among non-space ASCII
+	// characters at which text is estimated entirely as code.
+	codeSymbolDensity = 0.15
+
+	// codeSymbols are the characters that are much more frequent in code
+	// than in prose.
+	codeSymbols = "{}[]()<>;=+*/\\|&^%$#@~`_:"
+)
+
+// Image sizing rules of the API: images are scaled down to fit ImageLongEdge
+// and ImageMaxPixels, then cost about one token per PixelsPerToken pixels.
+const (
+	ImageLongEdge  = 1568
+	ImageMaxPixels = 1_150_000
+	PixelsPerToken = 750
+
+	// MaxImageTokens is the estimate for an image whose size is unknown,
+	// such as a URL image: the most any image costs after scaling.
+	MaxImageTokens = (ImageMaxPixels + PixelsPerToken - 1) / PixelsPerToken
+)
+
+// EstimateTokens returns the estimated number of tokens of text.
+//
+// ASCII text is counted at 4 characters per token for prose, down to 3 for
+// code as the share of symbols such as braces and operators grows; runs of
+// whitespace count as one character, since indentation is cheap. CJK
+// characters count as a token each, and other non-ASCII characters as half a
+// token each.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	var ascii, symbols, spaceRuns float64
+	var cjk, otherNonASCII float64
+	inSpace := false
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			if !inSpace {
+				spaceRuns++
+			}
+			inSpace = true
+			continue
+		}
+		inSpace = false
+
+		switch {
+		case r <= unicode.MaxASCII:
+			ascii++
+			if strings.ContainsRune(codeSymbols, r) {
+				symbols++
+			}
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			cjk++
+		default:
+			otherNonASCII++
+		}
+	}
+
+	charsPerToken := proseCharsPerToken
+	if ascii > 0 {
+		codeShare := math.Min(symbols/ascii/codeSymbolDensity, 1)
+		charsPerToken -= (proseCharsPerToken - codeCharsPerToken) * codeShare
+	}
+	estimate := (ascii+spaceRuns)/charsPerToken + cjk + otherNonASCII/2
+	return max(int(math.Ceil(estimate)), 1)
+}
+
+// EstimateImageTokens returns the estimated tokens of an image of the given
+// size, after the API scales it down to fit ImageLongEdge and ImageMaxPixels.
+// It returns MaxImageTokens when the size is unknown (not positive).
+func EstimateImageTokens(width, height int) int {
+	if width <= 0 || height <= 0 {
+		return MaxImageTokens
+	}
+	w, h := float64(width), float64(height)
+	if long := math.Max(w, h); long > ImageLongEdge {
+		w, h = w*ImageLongEdge/long, h*ImageLongEdge/long
+	}
+	if pixels := w * h; pixels > ImageMaxPixels {
+		scale := math.Sqrt(ImageMaxPixels / pixels)
+		w, h = w*scale, h*scale
+	}
+	return max(int(math.Ceil(w*h/PixelsPerToken)), 1)
+}
+
+// EstimateContentTokens returns the estimated tokens of a prompt's content
+// blocks. Base64 images are sized from their header (PNG, JPEG and GIF); other
+// images, including URL images, are estimated at MaxImageTokens.
+func EstimateContentTokens(blocks []types.UserContentBlock) int {
+	total := 0
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case *types.TextContent:
+			total += EstimateTokens(b.Text)
+		case *types.ImageContent:
+			width, height := imageSize(b.Source)
+			total += EstimateImageTokens(width, height)
+		}
+	}
+	return total
+}
+
+// imageSize returns the dimensions of a base64 image, or zeros when they
+// cannot be read.
+func imageSize(source types.ImageSource) (int, int) {
+	if source.Type != "base64" {
+		return 0, 0
+	}
+	config, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(source.Data)))
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
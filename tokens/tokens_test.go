@@ -0,0 +1,116 @@
+package tokens
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+const prose = `The quick brown fox jumps over the lazy dog while the farmer watches from
+the porch. Later that afternoon, the rain started falling over the hills, and
+everyone hurried inside to wait for the storm to pass. By evening the sky had
+cleared again, and the children went back outside to look for frogs near the
+pond behind the old barn.`
+
+const code = `func (c *Client) Query(ctx context.Context, prompt string) error {
+	if err := c.awaitWritable(ctx); err != nil {
+		return err
+	}
+	if prompt == "" {
+		return fmt.Errorf("prompt cannot be empty")
+	}
+	return c.sendPrompt(ctx, prompt, DefaultSessionID)
+}`
+
+// within reports whether got is within tolerance (a fraction) of want.
+func within(got, want int, tolerance float64) bool {
+	diff := float64(got - want)
+	return diff >= -tolerance*float64(want) && diff <= tolerance*float64(want)
+}
+
+// TestEstimateTokens compares estimates with reference counts: English prose
+// against the rule of thumb of 3 words per 4 tokens, code against its
+// character count at 3 characters per token, and CJK text against one token
+// per character, each within the documented 25%.
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"prose", prose, len(strings.Fields(prose)) * 4 / 3},
+		{"code", code, len(strings.Join(strings.Fields(code), " ")) / 3},
+		{"cjk", "今日は良い天気ですね。散歩に行きましょう。", 21},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateTokens(tt.text); !within(got, tt.want, 0.25) {
+				t.Errorf("EstimateTokens() = %d, want %d ± 25%%", got, tt.want)
+			}
+		})
+	}
+
+	if got := EstimateTokens(""); got != 0 {
+		t.Errorf("EstimateTokens(\"\") = %d, want 0", got)
+	}
+	if got := EstimateTokens("a"); got != 1 {
+		t.Errorf("EstimateTokens(\"a\") = %d, want 1", got)
+	}
+	// Code is denser in tokens than prose of the same length
+	if perChar := func(s string) float64 { return float64(EstimateTokens(s)) / float64(len(s)) }; perChar(code) <= perChar(prose) {
+		t.Errorf("code estimated at %.3f tokens per byte, prose at %.3f", perChar(code), perChar(prose))
+	}
+	// Indentation is cheap
+	if indented := strings.ReplaceAll(code, "\t", "        "); EstimateTokens(indented) != EstimateTokens(code) {
+		t.Errorf("indenting with spaces changed the estimate from %d to %d", EstimateTokens(code), EstimateTokens(indented))
+	}
+}
+
+// TestEstimateImageTokens tests the API's image sizing rules.
+func TestEstimateImageTokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		want          int
+	}{
+		{"small", 200, 200, 54},                     // 40000 / 750
+		{"fits", 1000, 1000, 1334},                  // 1000000 / 750
+		{"scaled to the long edge", 3136, 400, 419}, // 1568 x 200
+		{"scaled to the pixel limit", 4000, 3000, MaxImageTokens},
+		{"unknown size", 0, 0, MaxImageTokens},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateImageTokens(tt.width, tt.height); got != tt.want {
+				t.Errorf("EstimateImageTokens(%d, %d) = %d, want %d", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEstimateContentTokens tests that base64 images are sized from their
+// header and URL images are estimated at the maximum.
+func TestEstimateContentTokens(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 300, 150))); err != nil {
+		t.Fatal(err)
+	}
+	blocks := []types.UserContentBlock{
+		types.NewTextContent(prose),
+		types.NewImageContentBase64("image/png", base64.StdEncoding.EncodeToString(buf.Bytes())),
+		types.NewImageContentURL("https://example.com/cat.jpg"),
+		types.NewImageContentBase64("image/webp", "UklGRg=="),
+	}
+	want := EstimateTokens(prose) + EstimateImageTokens(300, 150) + 2*MaxImageTokens
+	if got := EstimateContentTokens(blocks); got != want {
+		t.Errorf("EstimateContentTokens() = %d, want %d", got, want)
+	}
+	if got := EstimateContentTokens(nil); got != 0 {
+		t.Errorf("EstimateContentTokens(nil) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,252 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TraceDirection tells whether a TraceEntry was written to or read from the CLI.
+type TraceDirection string
+
+const (
+	TraceSent     TraceDirection = "sent"     // Written to the CLI's stdin
+	TraceReceived TraceDirection = "received" // Read from the CLI's stdout
+)
+
+// TraceEntry is one message of a protocol trace. A trace is stored as one
+// JSON object per line, oldest first, for replaying conversations in tools
+// outside the SDK and with NewReplayClient.
+type TraceEntry struct {
+	Direction TraceDirection  `json:"direction"`
+	Timestamp time.Time       `json:"timestamp"`
+	Payload   json.RawMessage `json:"payload"` // The message as exchanged with the CLI
+}
+
+// TraceOptions configures a TraceRecorder and Transcript.ExportTrace.
+type TraceOptions struct {
+	// Redact, when set, is applied to every string value of every payload,
+	// at any depth, before it is stored or written. Object keys are kept.
+	Redact func(string) string
+}
+
+// TraceRecorder records the messages exchanged with the CLI as a protocol
+// trace. Attach it with types.ClaudeAgentOptions.WithProtocolTrace; unlike a
+// Transcript, it also sees the control traffic, so its trace can be replayed
+// by NewReplayClient. It is safe for concurrent use.
+//
+// Example:
+//
+//	recorder := claude.NewTraceRecorder(claude.TraceOptions{})
+//	client, err := claude.NewClient(ctx, types.NewClaudeAgentOptions().WithProtocolTrace(recorder))
+//	// ... run the session ...
+//	err = recorder.Export(f)
+type TraceRecorder struct {
+	opts TraceOptions
+
+	mu      sync.Mutex
+	entries []TraceEntry
+}
+
+// NewTraceRecorder creates an empty recorder.
+func NewTraceRecorder(opts TraceOptions) *TraceRecorder {
+	return &TraceRecorder{opts: opts}
+}
+
+// TraceSent records a line written to the CLI. It implements types.ProtocolTracer.
+func (r *TraceRecorder) TraceSent(line []byte) {
+	r.record(TraceSent, line)
+}
+
+// TraceReceived records a line read from the CLI. It implements types.ProtocolTracer.
+func (r *TraceRecorder) TraceReceived(line []byte) {
+	r.record(TraceReceived, line)
+}
+
+func (r *TraceRecorder) record(direction TraceDirection, line []byte) {
+	entry := TraceEntry{
+		Direction: direction,
+		Timestamp: time.Now().UTC(),
+		Payload:   tracePayload(line, r.opts.Redact),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// Entries returns a copy of the recorded entries, oldest first.
+func (r *TraceRecorder) Entries() []TraceEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]TraceEntry(nil), r.entries...)
+}
+
+// Export writes the recorded entries as a trace (see WriteTrace).
+func (r *TraceRecorder) Export(w io.Writer) error {
+	return WriteTrace(w, r.Entries())
+}
+
+// ExportTrace writes the recorded turns as a trace: each prompt as a sent
+// user message followed by the messages received for it. A Transcript holds
+// neither control traffic nor the time of each message, so every entry of a
+// turn carries the turn's start time; NewReplayClient answers the control
+// requests a replay makes without recorded responses.
+func (t *Transcript) ExportTrace(w io.Writer, opts TraceOptions) error {
+	turns, _ := t.snapshot()
+
+	var entries []TraceEntry
+	for i, turn := range turns {
+		prompt, err := internal.MarshalUserMessage(turn.Prompt, DefaultSessionID)
+		if err != nil {
+			return fmt.Errorf("export turn %d: %w", i+1, err)
+		}
+		entries = append(entries, TraceEntry{Direction: TraceSent, Timestamp: turn.Started.UTC(), Payload: tracePayload(prompt, opts.Redact)})
+		for _, msg := range turn.Messages {
+			if _, ok := msg.(*types.ErrorMessage); ok {
+				// Created by the SDK, not received from the CLI
+				continue
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return fmt.Errorf("export turn %d: %w", i+1, err)
+			}
+			entries = append(entries, TraceEntry{Direction: TraceReceived, Timestamp: turn.Started.UTC(), Payload: tracePayload(data, opts.Redact)})
+		}
+	}
+	return WriteTrace(w, entries)
+}
+
+// WriteTrace writes entries as one JSON object per line.
+func WriteTrace(w io.Writer, entries []TraceEntry) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for i, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("write trace entry %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// LoadTrace reads a trace written by WriteTrace, TraceRecorder.Export or
+// Transcript.ExportTrace.
+func LoadTrace(r io.Reader) ([]TraceEntry, error) {
+	decoder := json.NewDecoder(r)
+	var entries []TraceEntry
+	for {
+		var entry TraceEntry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read trace entry %d: %w", len(entries)+1, err)
+		}
+		if entry.Direction != TraceSent && entry.Direction != TraceReceived {
+			return nil, fmt.Errorf("read trace entry %d: unknown direction %q", len(entries)+1, entry.Direction)
+		}
+		if len(entry.Payload) == 0 {
+			return nil, fmt.Errorf("read trace entry %d: no payload", len(entries)+1)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// NewReplayClient creates a Client that plays back trace in place of the
+// CLI, for reproducing a recorded conversation in tests or when debugging
+// prompt behavior. Each prompt, control request or control response the
+// client writes stands in for the next one recorded as sent, and releases the
+// messages recorded after it; the prompts themselves are not compared. No CLI
+// is needed, and reconnecting starts the trace over.
+//
+// Example:
+//
+//	trace, err := claude.LoadTrace(f)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	client, err := claude.NewReplayClient(ctx, trace, nil)
+func NewReplayClient(ctx context.Context, trace []TraceEntry, options *types.ClaudeAgentOptions) (*Client, error) {
+	if options == nil {
+		options = types.NewClaudeAgentOptions()
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	options = options.Clone()
+
+	entries := make([]transport.ReplayEntry, len(trace))
+	for i, entry := range trace {
+		line := []byte(entry.Payload)
+		var text string
+		if json.Unmarshal(entry.Payload, &text) == nil {
+			// A line that was not JSON is stored as a string
+			line = []byte(text)
+		}
+		entries[i] = transport.ReplayEntry{Sent: entry.Direction == TraceSent, Line: line}
+	}
+
+	logger := newClientLogger(options)
+	newTransport := func(string) transport.Transport {
+		return transport.NewReplayTransport(entries, logger)
+	}
+	return newClient(ctx, options, logger, newTransport(""), newTransport), nil
+}
+
+// tracePayload turns a line exchanged with the CLI into a payload, applying
+// redact to its strings. A line that is not JSON is stored as a JSON string.
+func tracePayload(line []byte, redact func(string) string) json.RawMessage {
+	if !json.Valid(line) {
+		if redact != nil {
+			line = []byte(redact(string(line)))
+		}
+		data, _ := json.Marshal(string(line))
+		return data
+	}
+	if redact == nil {
+		var compact bytes.Buffer
+		_ = json.Compact(&compact, line)
+		return compact.Bytes()
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return append(json.RawMessage(nil), line...)
+	}
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(redactStrings(value, redact)); err != nil {
+		return append(json.RawMessage(nil), line...)
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n"))
+}
+
+// redactStrings applies redact to every string within a decoded JSON value.
+func redactStrings(value interface{}, redact func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return redact(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = redactStrings(item, redact)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactStrings(item, redact)
+		}
+	}
+	return value
+}
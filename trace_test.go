@@ -0,0 +1,142 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// runTraceSession runs two turns on client and returns the JSON encoding of
+// every message received.
+func runTraceSession(t *testing.T, client *Client) []string {
+	t.Helper()
+
+	ctx := testContext(t, 10*time.Second)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close(ctx)
+
+	var stream []string
+	for _, prompt := range []string{"first", "second"} {
+		if err := client.Query(ctx, prompt); err != nil {
+			t.Fatalf("Query(%q) failed: %v", prompt, err)
+		}
+		for msg := range client.ReceiveResponse(ctx) {
+			data, err := json.Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stream = append(stream, string(data))
+		}
+	}
+	return stream
+}
+
+// TestTraceRecorder_RoundTrip tests that a recorded session, exported and
+// loaded again, replays the same message stream without a CLI.
+func TestTraceRecorder_RoundTrip(t *testing.T) {
+	recorder := NewTraceRecorder(TraceOptions{})
+	opts := types.NewClaudeAgentOptions().WithCLIPath(writeMockCLI(t, scriptCLI)).WithProtocolTrace(recorder)
+	client, err := NewClient(testContext(t, 5*time.Second), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := runTraceSession(t, client)
+	if len(recorded) != 4 {
+		t.Fatalf("recorded %d messages, want 4: %v", len(recorded), recorded)
+	}
+
+	var buf bytes.Buffer
+	if err := recorder.Export(&buf); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	trace, err := LoadTrace(&buf)
+	if err != nil {
+		t.Fatalf("LoadTrace failed: %v", err)
+	}
+	if !reflect.DeepEqual(trace, recorder.Entries()) {
+		t.Errorf("loaded trace differs from the recorded one")
+	}
+	if trace[0].Direction != TraceSent || !strings.Contains(string(trace[0].Payload), `"subtype":"initialize"`) {
+		t.Errorf("first entry = %s %s, want the sent initialize request", trace[0].Direction, trace[0].Payload)
+	}
+
+	replay, err := NewReplayClient(testContext(t, 5*time.Second), trace, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed := runTraceSession(t, replay); !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed stream differs:\n got %v\nwant %v", replayed, recorded)
+	}
+}
+
+// TestTranscript_ExportTrace tests that an exported transcript is redacted
+// and replays its turns, with the control requests answered by the replay.
+func TestTranscript_ExportTrace(t *testing.T) {
+	cost := 0.01
+	transcript := NewTranscript()
+	for i, prompt := range []string{"first sk-secret", "second"} {
+		text := []string{"reply 1 sk-secret", "reply 2"}[i]
+		transcript.Record(TranscriptTurn{
+			Prompt: prompt,
+			Messages: []types.Message{
+				&types.AssistantMessage{Type: "assistant", Model: "m", Content: []types.ContentBlock{&types.TextBlock{Type: "text", Text: text}}},
+				&types.ResultMessage{Type: "result", Subtype: "success", Result: &text, SessionID: "s", TotalCostUSD: &cost},
+			},
+			Started: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		})
+	}
+
+	var buf bytes.Buffer
+	redact := func(s string) string { return strings.ReplaceAll(s, "sk-secret", "[REDACTED]") }
+	if err := transcript.ExportTrace(&buf, TraceOptions{Redact: redact}); err != nil {
+		t.Fatalf("ExportTrace failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "sk-secret") {
+		t.Errorf("trace was not redacted:\n%s", buf.String())
+	}
+
+	trace, err := LoadTrace(&buf)
+	if err != nil {
+		t.Fatalf("LoadTrace failed: %v", err)
+	}
+	var directions []TraceDirection
+	for _, entry := range trace {
+		directions = append(directions, entry.Direction)
+		if !entry.Timestamp.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+			t.Errorf("Timestamp = %v, want the turn's start", entry.Timestamp)
+		}
+	}
+	want := []TraceDirection{TraceSent, TraceReceived, TraceReceived, TraceSent, TraceReceived, TraceReceived}
+	if !reflect.DeepEqual(directions, want) {
+		t.Errorf("directions = %v, want %v", directions, want)
+	}
+
+	replay, err := NewReplayClient(testContext(t, 5*time.Second), trace, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := runTraceSession(t, replay)
+	if len(stream) != 4 || !strings.Contains(stream[0], "reply 1 [REDACTED]") || !strings.Contains(stream[2], "reply 2") {
+		t.Errorf("replayed stream = %v", stream)
+	}
+}
+
+// TestLoadTrace_Invalid tests that malformed traces are rejected.
+func TestLoadTrace_Invalid(t *testing.T) {
+	for _, input := range []string{
+		`{"direction":"sideways","timestamp":"2026-01-02T03:04:05Z","payload":{}}`,
+		`{"direction":"sent","timestamp":"2026-01-02T03:04:05Z"}`,
+		`{"direction":"sent"`,
+	} {
+		if _, err := LoadTrace(strings.NewReader(input)); err == nil {
+			t.Errorf("LoadTrace(%s) succeeded", input)
+		}
+	}
+}
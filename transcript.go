@@ -0,0 +1,398 @@
+package claude
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TranscriptTurn is one recorded query/response turn.
+type TranscriptTurn struct {
+	Agent    string          // Name of the agent that ran the turn, if any
+	Prompt   string          // Prompt sent for the turn
+	Messages []types.Message // Messages received for the turn, ending with the result when it completed, then any late ones
+	Started  time.Time       // When the prompt was sent
+}
+
+// TranscriptLimit bounds the memory held by a Transcript. Zero fields are unlimited.
+type TranscriptLimit struct {
+	MaxMessages int // Messages kept across all turns
+	MaxBytes    int // Approximate size of the kept prompts and JSON-encoded messages
+}
+
+// TranscriptEvicted summarizes the turns a limited Transcript has dropped.
+type TranscriptEvicted struct {
+	Turns    int     `json:"turns"`
+	Messages int     `json:"messages"`
+	Bytes    int     `json:"bytes"`    // Only counted while MaxBytes is set
+	CostUSD  float64 `json:"cost_usd"` // Sum of the evicted turns' result costs
+}
+
+// Transcript records conversation turns. It is safe for concurrent use, so a
+// single Transcript can be shared by several agents or runs.
+type Transcript struct {
+	mu       sync.Mutex
+	turns    []TranscriptTurn
+	messages int   // Messages across turns
+	sizes    []int // Approximate size of each turn, tracked when MaxBytes is set
+	bytes    int   // Sum of sizes
+	limit    TranscriptLimit
+	evicted  TranscriptEvicted
+}
+
+// NewTranscript creates an empty Transcript.
+func NewTranscript() *Transcript {
+	return &Transcript{}
+}
+
+// WithLimit bounds the transcript for long-lived agents, turning it into a
+// ring buffer: when a recorded turn takes it past the limit, the oldest turns
+// are evicted whole until it fits again. The newest turn is always kept, even
+// if it exceeds the limit on its own. Evicted turns are summarized by Evicted,
+// and exports mark the transcript as truncated.
+//
+// Example:
+//
+//	transcript := claude.NewTranscript().WithLimit(claude.TranscriptLimit{MaxMessages: 10000})
+func (t *Transcript) WithLimit(limit TranscriptLimit) *Transcript {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if limit.MaxBytes > 0 && t.limit.MaxBytes <= 0 {
+		// Sizes were not tracked while unlimited
+		t.sizes = make([]int, len(t.turns))
+		t.bytes = 0
+		for i, turn := range t.turns {
+			t.sizes[i] = turnSize(turn)
+			t.bytes += t.sizes[i]
+		}
+	}
+	t.limit = limit
+	t.evict()
+	return t
+}
+
+// Record appends a turn to the transcript, evicting the oldest turns if a
+// limit is set and exceeded.
+func (t *Transcript) Record(turn TranscriptTurn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	turn.Messages = append([]types.Message(nil), turn.Messages...)
+	t.turns = append(t.turns, turn)
+	t.messages += len(turn.Messages)
+	if t.limit.MaxBytes > 0 {
+		size := turnSize(turn)
+		t.sizes = append(t.sizes, size)
+		t.bytes += size
+	}
+	t.evict()
+}
+
+// RecordLate appends a message the CLI sent after the newest turn's result to
+// that turn. It has the signature of types.LateMessageFunc, so a Client's late
+// messages can be recorded with
+// options.WithOnLateMessage(transcript.RecordLate). Without a turn, msg is
+// dropped.
+func (t *Transcript) RecordLate(msg types.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.turns) == 0 {
+		return
+	}
+	last := len(t.turns) - 1
+	t.turns[last].Messages = append(t.turns[last].Messages, msg)
+	t.messages++
+	if t.limit.MaxBytes > 0 {
+		if data, err := json.Marshal(msg); err == nil {
+			t.sizes[last] += len(data)
+			t.bytes += len(data)
+		}
+	}
+	t.evict()
+}
+
+// evict drops the oldest turns while the transcript exceeds its limit,
+// keeping at least the newest turn. The caller holds t.mu.
+func (t *Transcript) evict() {
+	over := func() bool {
+		return (t.limit.MaxMessages > 0 && t.messages > t.limit.MaxMessages) ||
+			(t.limit.MaxBytes > 0 && t.bytes > t.limit.MaxBytes)
+	}
+
+	for len(t.turns) > 1 && over() {
+		oldest := t.turns[0]
+		t.evicted.Turns++
+		t.evicted.Messages += len(oldest.Messages)
+		t.evicted.CostUSD += turnCost(oldest)
+		t.messages -= len(oldest.Messages)
+		if t.limit.MaxBytes > 0 {
+			t.evicted.Bytes += t.sizes[0]
+			t.bytes -= t.sizes[0]
+			t.sizes = t.sizes[1:]
+		}
+		// Clear the slot so the evicted messages can be collected
+		t.turns[0] = TranscriptTurn{}
+		t.turns = t.turns[1:]
+	}
+}
+
+// turnSize approximates the memory held by a turn as the length of its prompt
+// and JSON-encoded messages.
+func turnSize(turn TranscriptTurn) int {
+	size := len(turn.Prompt)
+	for _, msg := range turn.Messages {
+		if data, err := json.Marshal(msg); err == nil {
+			size += len(data)
+		}
+	}
+	return size
+}
+
+// turnCost returns the cost reported by a turn's result, or 0 without one.
+func turnCost(turn TranscriptTurn) float64 {
+	for _, msg := range turn.Messages {
+		if result, ok := msg.(*types.ResultMessage); ok && result.TotalCostUSD != nil {
+			return *result.TotalCostUSD
+		}
+	}
+	return 0
+}
+
+// Turns returns a copy of the recorded turns, oldest first.
+func (t *Transcript) Turns() []TranscriptTurn {
+	turns, _ := t.snapshot()
+	return turns
+}
+
+// snapshot returns a copy of the recorded turns together with the summary of
+// those evicted before them, taken at the same instant.
+func (t *Transcript) snapshot() ([]TranscriptTurn, TranscriptEvicted) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	turns := make([]TranscriptTurn, len(t.turns))
+	copy(turns, t.turns)
+	return turns, t.evicted
+}
+
+// Evicted summarizes the turns dropped by the transcript's limit.
+func (t *Transcript) Evicted() TranscriptEvicted {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.evicted
+}
+
+// Truncated reports whether any turns have been evicted.
+func (t *Transcript) Truncated() bool {
+	return t.Evicted().Turns > 0
+}
+
+// Len returns the number of recorded turns.
+func (t *Transcript) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.turns)
+}
+
+// EvalExportOptions configures Transcript.ExportEvalJSONL.
+type EvalExportOptions struct {
+	IncludeThinking    bool // Include the assistant's thinking text
+	IncludeToolOutputs bool // Include the full output of each tool call
+
+	// Redact, when set, is applied to every exported string taken from the
+	// conversation: prompt, response, thinking and tool outputs.
+	Redact func(string) string
+}
+
+// EvalRecord is one turn as written by ExportEvalJSONL.
+type EvalRecord struct {
+	Agent      string         `json:"agent,omitempty"`
+	Started    string         `json:"started,omitempty"` // RFC 3339, UTC
+	Prompt     string         `json:"prompt"`
+	Response   string         `json:"response"` // Text of the last assistant answer, including continuations of a truncated one
+	Thinking   string         `json:"thinking,omitempty"`
+	ToolCalls  []EvalToolCall `json:"tool_calls"`
+	Outcome    string         `json:"outcome"` // Result subtype, or "incomplete" if the turn had no result
+	IsError    bool           `json:"is_error"`
+	CostUSD    float64        `json:"cost_usd"`
+	DurationMs int            `json:"duration_ms"`
+
+	// Truncated is set on the first record when a limited transcript evicted
+	// older turns, summarizing what is missing from the export
+	Truncated *TranscriptEvicted `json:"truncated,omitempty"`
+}
+
+// EvalToolCall is one tool invocation within an EvalRecord, in call order.
+type EvalToolCall struct {
+	Name        string `json:"name"`
+	InputDigest string `json:"input_digest"`      // "sha256:" and the hex digest of the JSON-encoded input
+	Success     *bool  `json:"success,omitempty"` // Nil when no tool result was received
+	Output      string `json:"output,omitempty"`  // Only with IncludeToolOutputs
+}
+
+// ExportEvalJSONL writes each recorded turn as one JSON object per line, in the
+// format of EvalRecord, for building offline evaluation or fine-tuning datasets.
+// If turns were evicted by the transcript's limit, the first record carries a
+// summary of them in its truncated field.
+//
+// Example:
+//
+//	f, err := os.Create("evals.jsonl")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer f.Close()
+//	err = transcript.ExportEvalJSONL(f, claude.EvalExportOptions{
+//	    Redact: func(s string) string { return apiKeyPattern.ReplaceAllString(s, "[REDACTED]") },
+//	})
+func (t *Transcript) ExportEvalJSONL(w io.Writer, opts EvalExportOptions) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	turns, evicted := t.snapshot()
+	for i, turn := range turns {
+		record := evalRecord(turn, opts)
+		if i == 0 && evicted.Turns > 0 {
+			record.Truncated = &evicted
+		}
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("export turn %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// evalRecord flattens one turn into an EvalRecord.
+func evalRecord(turn TranscriptTurn, opts EvalExportOptions) EvalRecord {
+	redact := opts.Redact
+	if redact == nil {
+		redact = func(s string) string { return s }
+	}
+
+	record := EvalRecord{
+		Agent:     turn.Agent,
+		Prompt:    redact(turn.Prompt),
+		ToolCalls: []EvalToolCall{},
+		Outcome:   "incomplete",
+	}
+	if !turn.Started.IsZero() {
+		record.Started = turn.Started.UTC().Format(time.RFC3339Nano)
+	}
+
+	var thinking []string
+	var response string
+	continuing := false               // The previous answer was truncated, so the next one continues it
+	callIndex := make(map[string]int) // tool use ID -> index in ToolCalls
+	for _, msg := range turn.Messages {
+		switch m := msg.(type) {
+		case *types.AssistantMessage:
+			var text strings.Builder
+			for _, block := range m.Content {
+				switch b := block.(type) {
+				case *types.TextBlock:
+					text.WriteString(b.Text)
+				case *types.ThinkingBlock:
+					thinking = append(thinking, b.Thinking)
+				case *types.ToolUseBlock:
+					callIndex[b.ID] = len(record.ToolCalls)
+					record.ToolCalls = append(record.ToolCalls, EvalToolCall{Name: b.Name, InputDigest: inputDigest(b.Input)})
+				}
+			}
+			if text.Len() > 0 {
+				if continuing {
+					response += text.String()
+				} else {
+					response = text.String()
+				}
+			}
+			if m.ParentToolUseID == nil {
+				continuing = m.IsTruncated()
+			}
+		case *types.UserMessage:
+			blocks, _ := m.Content.([]types.ContentBlock)
+			for _, block := range blocks {
+				result, ok := block.(*types.ToolResultBlock)
+				if !ok {
+					continue
+				}
+				i, ok := callIndex[result.ToolUseID]
+				if !ok {
+					continue
+				}
+				success := result.IsError == nil || !*result.IsError
+				record.ToolCalls[i].Success = &success
+				if opts.IncludeToolOutputs {
+					record.ToolCalls[i].Output = redact(toolOutputText(result.Content))
+				}
+			}
+		case *types.ResultMessage:
+			record.Outcome = m.Subtype
+			record.IsError = m.IsError
+			record.DurationMs = m.DurationMs
+			if m.TotalCostUSD != nil {
+				record.CostUSD = *m.TotalCostUSD
+			}
+		}
+	}
+
+	if response != "" {
+		record.Response = redact(response)
+	}
+	if opts.IncludeThinking && len(thinking) > 0 {
+		record.Thinking = redact(strings.Join(thinking, "\n"))
+	}
+	return record
+}
+
+// inputDigest identifies a tool input without exporting it. Map keys are
+// encoded in sorted order, so equal inputs give equal digests.
+func inputDigest(input map[string]interface{}) string {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// toolOutputText renders tool result content as text. String content is used
+// as is; the text of content blocks is joined; anything else is JSON-encoded.
+func toolOutputText(content interface{}) string {
+	switch c := content.(type) {
+	case nil:
+		return ""
+	case string:
+		return c
+	case []interface{}:
+		var texts []string
+		for _, item := range c {
+			block, ok := item.(map[string]interface{})
+			if !ok {
+				texts = nil
+				break
+			}
+			text, ok := block["text"].(string)
+			if !ok {
+				texts = nil
+				break
+			}
+			texts = append(texts, text)
+		}
+		if texts != nil {
+			return strings.Join(texts, "\n")
+		}
+	}
+	data, _ := json.Marshal(content)
+	return string(data)
+}
@@ -0,0 +1,286 @@
+package claude
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestTranscript(t *testing.T) {
+	transcript := NewTranscript()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			transcript.Record(TranscriptTurn{Prompt: "p"})
+		}()
+	}
+	wg.Wait()
+
+	if transcript.Len() != 10 {
+		t.Fatalf("Len() = %d, want 10", transcript.Len())
+	}
+
+	messages := []types.Message{&types.ResultMessage{Subtype: "success"}}
+	transcript.Record(TranscriptTurn{Prompt: "last", Messages: messages})
+	messages[0] = nil
+
+	turns := transcript.Turns()
+	turns[0].Prompt = "changed"
+	if got := transcript.Turns(); got[0].Prompt != "p" || got[10].Messages[0] == nil {
+		t.Error("transcript should not share storage with callers")
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// evalFixtureTranscript holds a successful turn with tool use and an error turn.
+func evalFixtureTranscript() *Transcript {
+	isError := true
+	started := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	transcript := NewTranscript()
+	transcript.Record(TranscriptTurn{
+		Agent:   "reviewer",
+		Prompt:  "Check config.go; the key is sk-secret-123.",
+		Started: started,
+		Messages: []types.Message{
+			&types.SystemMessage{Type: "system", Subtype: "init"},
+			&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+				&types.ThinkingBlock{Type: "thinking", Thinking: "I should read the file first."},
+				&types.TextBlock{Type: "text", Text: "Reading the file."},
+				&types.ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Read", Input: map[string]interface{}{"file_path": "config.go"}},
+				&types.ToolUseBlock{Type: "tool_use", ID: "t2", Name: "Bash", Input: map[string]interface{}{"command": "go vet", "timeout": float64(60)}},
+			}},
+			&types.UserMessage{Type: "user", Content: []types.ContentBlock{
+				&types.ToolResultBlock{Type: "tool_result", ToolUseID: "t1", Content: "const key = \"sk-secret-123\""},
+				&types.ToolResultBlock{Type: "tool_result", ToolUseID: "t2", Content: []interface{}{map[string]interface{}{"type": "text", "text": "vet: exit status 1"}}, IsError: &isError},
+			}},
+			&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+				&types.TextBlock{Type: "text", Text: "The key sk-secret-123 is hardcoded & vet fails."},
+			}},
+			&types.ResultMessage{Type: "result", Subtype: "success", DurationMs: 4200, TotalCostUSD: ptrFloat(0.0123)},
+		},
+	})
+	transcript.Record(TranscriptTurn{
+		Agent:   "reviewer",
+		Prompt:  "Fix it.",
+		Started: started.Add(time.Minute),
+		Messages: []types.Message{
+			&types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+				&types.ToolUseBlock{Type: "tool_use", ID: "t3", Name: "Edit", Input: map[string]interface{}{"file_path": "config.go"}},
+			}},
+			&types.ResultMessage{Type: "result", Subtype: "error_max_turns", IsError: true, DurationMs: 900, TotalCostUSD: ptrFloat(0.004)},
+		},
+	})
+	transcript.Record(TranscriptTurn{Prompt: "Never answered."})
+	return transcript
+}
+
+func TestTranscript_ExportEvalJSONL(t *testing.T) {
+	redact := func(s string) string { return strings.ReplaceAll(s, "sk-secret-123", "[REDACTED]") }
+
+	tests := []struct {
+		golden string
+		opts   EvalExportOptions
+	}{
+		{"eval_export.jsonl", EvalExportOptions{Redact: redact}},
+		{"eval_export_full.jsonl", EvalExportOptions{Redact: redact, IncludeThinking: true, IncludeToolOutputs: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := evalFixtureTranscript().ExportEvalJSONL(&buf, tt.opts); err != nil {
+				t.Fatalf("ExportEvalJSONL failed: %v", err)
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read golden file (run with -update to create it): %v", err)
+			}
+			if buf.String() != string(want) {
+				t.Errorf("export does not match %s:\n got:\n%s\nwant:\n%s", path, buf.String(), want)
+			}
+			if strings.Contains(buf.String(), "sk-secret-123") {
+				t.Error("export contains unredacted text")
+			}
+		})
+	}
+}
+
+// limitFixtureTurn returns a turn with n messages, the last a result costing cost.
+func limitFixtureTurn(prompt string, n int, cost float64) TranscriptTurn {
+	turn := TranscriptTurn{Prompt: prompt}
+	for i := 1; i < n; i++ {
+		turn.Messages = append(turn.Messages, &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{
+			&types.TextBlock{Type: "text", Text: strings.Repeat("x", 100)},
+		}})
+	}
+	turn.Messages = append(turn.Messages, &types.ResultMessage{Type: "result", Subtype: "success", TotalCostUSD: ptrFloat(cost)})
+	return turn
+}
+
+func TestTranscript_LimitMessages(t *testing.T) {
+	transcript := NewTranscript().WithLimit(TranscriptLimit{MaxMessages: 5})
+
+	transcript.Record(limitFixtureTurn("one", 2, 0.01))
+	transcript.Record(limitFixtureTurn("two", 3, 0.02))
+	if transcript.Truncated() {
+		t.Fatal("transcript at its limit should not be truncated")
+	}
+
+	// Five messages are kept at most, so "three" evicts "one" and "two" whole
+	transcript.Record(limitFixtureTurn("three", 3, 0.04))
+	var prompts []string
+	for _, turn := range transcript.Turns() {
+		prompts = append(prompts, turn.Prompt)
+	}
+	if strings.Join(prompts, ",") != "three" {
+		t.Errorf("kept turns = %v, want [three]", prompts)
+	}
+	evicted := transcript.Evicted()
+	if evicted.Turns != 2 || evicted.Messages != 5 || evicted.CostUSD < 0.0299 || evicted.CostUSD > 0.0301 {
+		t.Errorf("Evicted() = %+v, want 2 turns, 5 messages, $0.03", evicted)
+	}
+
+	// A turn over the limit on its own is kept
+	transcript.Record(limitFixtureTurn("huge", 8, 0))
+	if turns := transcript.Turns(); len(turns) != 1 || turns[0].Prompt != "huge" || len(turns[0].Messages) != 8 {
+		t.Errorf("oversized turn should be kept whole, got %d turns", len(turns))
+	}
+	if got := transcript.Evicted(); got.Turns != 3 || got.Messages != 8 {
+		t.Errorf("Evicted() = %+v, want 3 turns and 8 messages", got)
+	}
+}
+
+func TestTranscript_LimitBytes(t *testing.T) {
+	transcript := NewTranscript()
+	for _, prompt := range []string{"a", "b", "c", "d"} {
+		transcript.Record(limitFixtureTurn(prompt, 2, 0.01))
+	}
+	size := turnSize(transcript.Turns()[0])
+
+	// Applying a limit evicts what was recorded while unlimited
+	transcript.WithLimit(TranscriptLimit{MaxBytes: 2*size + size/2})
+	if got := transcript.Len(); got != 2 {
+		t.Fatalf("Len() = %d, want 2", got)
+	}
+	transcript.Record(limitFixtureTurn("e", 2, 0.01))
+	if turns := transcript.Turns(); turns[0].Prompt != "d" || turns[1].Prompt != "e" {
+		t.Errorf("kept turns %q, %q; want d, e", turns[0].Prompt, turns[1].Prompt)
+	}
+	if got := transcript.Evicted(); got.Turns != 3 || got.Bytes != 3*size {
+		t.Errorf("Evicted() = %+v, want 3 turns of %d bytes", got, 3*size)
+	}
+}
+
+func TestTranscript_RecordLate(t *testing.T) {
+	telemetry := &types.SystemMessage{Type: "system", Subtype: "telemetry"}
+	transcript := NewTranscript().WithLimit(TranscriptLimit{MaxMessages: 4})
+
+	// Without a turn there is nothing to attribute it to
+	transcript.RecordLate(telemetry)
+	if got := transcript.Len(); got != 0 {
+		t.Fatalf("Len() = %d after a late message without turns, want 0", got)
+	}
+
+	transcript.Record(limitFixtureTurn("one", 2, 0.01))
+	transcript.Record(limitFixtureTurn("two", 1, 0.01))
+	transcript.RecordLate(telemetry)
+	turns := transcript.Turns()
+	if len(turns) != 2 || len(turns[1].Messages) != 2 || turns[1].Messages[1] != telemetry {
+		t.Fatalf("late message should end the newest turn, got %+v", turns)
+	}
+
+	// Late messages count toward the limit
+	transcript.RecordLate(telemetry)
+	if got := transcript.Evicted(); got.Turns != 1 || got.Messages != 2 {
+		t.Errorf("Evicted() = %+v, want the first turn's 2 messages", got)
+	}
+}
+
+func TestTranscript_ExportTruncated(t *testing.T) {
+	transcript := NewTranscript().WithLimit(TranscriptLimit{MaxMessages: 4})
+	for _, prompt := range []string{"one", "two", "three"} {
+		transcript.Record(limitFixtureTurn(prompt, 2, 0.5))
+	}
+
+	var buf bytes.Buffer
+	if err := transcript.ExportEvalJSONL(&buf, EvalExportOptions{}); err != nil {
+		t.Fatalf("ExportEvalJSONL failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("exported %d records, want 2:\n%s", len(lines), buf.String())
+	}
+	want := `"truncated":{"turns":1,"messages":2,"bytes":0,"cost_usd":0.5}`
+	if !strings.Contains(lines[0], `"prompt":"two"`) || !strings.Contains(lines[0], want) {
+		t.Errorf("first record should mark the truncation with %s, got %s", want, lines[0])
+	}
+	if strings.Contains(lines[1], "truncated") {
+		t.Errorf("only the first record is marked, got %s", lines[1])
+	}
+
+	// Unlimited transcripts are never marked
+	buf.Reset()
+	if err := evalFixtureTranscript().ExportEvalJSONL(&buf, EvalExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "truncated") {
+		t.Error("export of an unlimited transcript should not be marked truncated")
+	}
+}
+
+// TestTranscript_LimitConcurrentExport tests eviction racing with exports; each
+// export must be a consistent snapshot.
+func TestTranscript_LimitConcurrentExport(t *testing.T) {
+	transcript := NewTranscript().WithLimit(TranscriptLimit{MaxMessages: 6})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				transcript.Record(limitFixtureTurn("p", 2, 0.01))
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				var buf bytes.Buffer
+				if err := transcript.ExportEvalJSONL(&buf, EvalExportOptions{}); err != nil {
+					t.Error(err)
+					return
+				}
+				if n := strings.Count(buf.String(), "\n"); n > 3 {
+					t.Errorf("export holds %d turns, limit allows 3", n)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := transcript.Len() + transcript.Evicted().Turns; got != 200 {
+		t.Errorf("kept + evicted turns = %d, want 200", got)
+	}
+}
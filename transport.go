@@ -0,0 +1,21 @@
+package claude
+
+import "github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+
+// Transport is the connection between a Client and the CLI: it starts the
+// CLI, writes the SDK's JSON lines to it and delivers the messages it reads.
+// Clients built with NewClient use a CLI subprocess; NewClientWithTransport
+// takes any implementation, such as a *claudetest.Transport.
+type Transport = transport.Transport
+
+// ReadinessReason describes why a Transport is or is not ready.
+type ReadinessReason = transport.ReadinessReason
+
+// The readiness reasons a Transport reports.
+const (
+	ReadinessNeverConnected = transport.ReadinessNeverConnected // Connect has not succeeded
+	ReadinessReady          = transport.ReadinessReady          // Both directions are usable
+	ReadinessStdinBroken    = transport.ReadinessStdinBroken    // A write to the CLI failed
+	ReadinessStdoutClosed   = transport.ReadinessStdoutClosed   // The CLI's output ended (EOF or read error)
+	ReadinessClosed         = transport.ReadinessClosed         // Close was called
+)
@@ -0,0 +1,219 @@
+package types
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Models an AgentDefinition can run on. AgentModelInherit uses the model of
+// the main conversation.
+const (
+	AgentModelSonnet  = "sonnet"
+	AgentModelOpus    = "opus"
+	AgentModelHaiku   = "haiku"
+	AgentModelInherit = "inherit"
+)
+
+var agentModels = []string{AgentModelSonnet, AgentModelOpus, AgentModelHaiku, AgentModelInherit}
+
+// NewAgentDefinition returns an agent definition with the given description,
+// which tells Claude when to use the agent, and system prompt. Refine it with
+// the With* methods and check it with Validate.
+//
+// Example:
+//
+//	reviewer := types.NewAgentDefinition("Reviews Go code for bugs", "You are a careful Go reviewer.").
+//	    WithTools("Read", "Grep").
+//	    WithModel(types.AgentModelSonnet)
+//	opts := types.NewClaudeAgentOptions().WithAgent("reviewer", reviewer)
+func NewAgentDefinition(description, prompt string) AgentDefinition {
+	return AgentDefinition{Description: description, Prompt: prompt}
+}
+
+// WithTools returns a copy of the definition restricted to the given tools.
+// Without tools the agent inherits every tool of the main conversation.
+func (a AgentDefinition) WithTools(tools ...string) AgentDefinition {
+	a.Tools = slices.Clone(tools)
+	return a
+}
+
+// WithModel returns a copy of the definition running on model, one of the
+// AgentModel constants.
+func (a AgentDefinition) WithModel(model string) AgentDefinition {
+	a.Model = &model
+	return a
+}
+
+// Validate reports the first problem with the definition: an empty description
+// or prompt, or a model that is not one of the AgentModel constants. Unknown
+// tool names are not an error, since MCP servers and newer CLIs add tools; see
+// UnknownTools.
+func (a AgentDefinition) Validate() error {
+	if violations := a.violations(""); len(violations) > 0 {
+		return violations[0]
+	}
+	return nil
+}
+
+// violations returns every problem with the definition, with fields prefixed
+// by prefix.
+func (a AgentDefinition) violations(prefix string) []*ValidationError {
+	var violations []*ValidationError
+	if strings.TrimSpace(a.Description) == "" {
+		violations = append(violations, NewValidationError(prefix+"description", "must not be empty"))
+	}
+	if strings.TrimSpace(a.Prompt) == "" {
+		violations = append(violations, NewValidationError(prefix+"prompt", "must not be empty"))
+	}
+	if a.Model != nil && !slices.Contains(agentModels, *a.Model) {
+		violations = append(violations, NewValidationError(prefix+"model", fmt.Sprintf("unknown agent model %q (want one of %s)", *a.Model, strings.Join(agentModels, ", "))))
+	}
+	for _, tool := range a.Tools {
+		if strings.TrimSpace(tool) == "" {
+			violations = append(violations, NewValidationError(prefix+"tools", "must not contain an empty tool name"))
+			break
+		}
+	}
+	return violations
+}
+
+// UnknownTools returns the tools of the definition that are neither built-in
+// tools (after NormalizeToolName) nor MCP tools ("mcp__server__tool"). They
+// are likely typos; the SDK logs a warning for each when connecting.
+func (a AgentDefinition) UnknownTools() []string {
+	var unknown []string
+	for _, tool := range a.Tools {
+		name := NormalizeToolName(tool, nil)
+		if strings.HasPrefix(name, "mcp__") || slices.Contains(canonicalToolNames, name) {
+			continue
+		}
+		unknown = append(unknown, tool)
+	}
+	return unknown
+}
+
+// LoadAgentDefinitions reads the agent definitions of a directory in the
+// Claude Code agent format (such as .claude/agents), keyed by agent name. Each
+// .md file holds one agent: a front matter block with name, description and
+// the optional tools (comma-separated or a list) and model, followed by the
+// system prompt. The name defaults to the file name without its extension.
+// Other files are ignored.
+//
+// Example file reviewer.md:
+//
+//	---
+//	name: reviewer
+//	description: Reviews Go code for bugs
+//	tools: Read, Grep
+//	model: sonnet
+//	---
+//	You are a careful Go reviewer.
+//
+// Every definition is validated; the error names the offending file.
+func LoadAgentDefinitions(dir string) (map[string]AgentDefinition, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, NewValidationErrorWithCause("agents", "cannot read agent directory", err)
+	}
+
+	agents := make(map[string]AgentDefinition)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".md") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		name, agent, err := parseAgentFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := agents[name]; dup {
+			return nil, NewValidationError("agents", fmt.Sprintf("%s: agent %q is defined twice", path, name))
+		}
+		if err := agent.Validate(); err != nil {
+			return nil, NewValidationErrorWithCause("agents", path, err)
+		}
+		agents[name] = agent
+	}
+	return agents, nil
+}
+
+// parseAgentFile parses one agent markdown file.
+func parseAgentFile(path string) (string, AgentDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", AgentDefinition{}, NewValidationErrorWithCause("agents", "cannot read agent file", err)
+	}
+	fail := func(msg string) (string, AgentDefinition, error) {
+		return "", AgentDefinition{}, NewValidationError("agents", fmt.Sprintf("%s: %s", path, msg))
+	}
+
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if !strings.HasPrefix(content, "---\n") {
+		return fail("missing front matter (a block between --- lines)")
+	}
+	frontMatter, prompt, found := strings.Cut(content[len("---\n"):], "\n---")
+	if !found {
+		return fail("front matter is not closed with ---")
+	}
+	// Drop the rest of the closing line
+	if _, rest, ok := strings.Cut(prompt, "\n"); ok {
+		prompt = rest
+	} else {
+		prompt = ""
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	agent := AgentDefinition{Prompt: strings.TrimSpace(prompt)}
+	listKey := "" // Key whose "- item" lines follow
+	scanner := bufio.NewScanner(strings.NewReader(frontMatter))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if item, ok := strings.CutPrefix(line, "- "); ok && listKey == "tools" {
+			agent.Tools = append(agent.Tools, unquoteFrontMatter(item))
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fail(fmt.Sprintf("invalid front matter line %q", line))
+		}
+		key, value = strings.TrimSpace(key), unquoteFrontMatter(strings.TrimSpace(value))
+		listKey = ""
+		switch key {
+		case "name":
+			name = value
+		case "description":
+			agent.Description = value
+		case "model":
+			agent.Model = &value
+		case "tools":
+			if value == "" {
+				listKey = key
+				continue
+			}
+			for _, tool := range strings.Split(strings.Trim(value, "[]"), ",") {
+				if tool = unquoteFrontMatter(strings.TrimSpace(tool)); tool != "" {
+					agent.Tools = append(agent.Tools, tool)
+				}
+			}
+		}
+	}
+	if name == "" {
+		return fail("agent name must not be empty")
+	}
+	return name, agent, nil
+}
+
+// unquoteFrontMatter strips matching single or double quotes around a front matter value.
+func unquoteFrontMatter(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestAgentDefinition_Validate tests the builder and the problems Validate and
+// Options.Validate report.
+func TestAgentDefinition_Validate(t *testing.T) {
+	valid := NewAgentDefinition("Reviews code", "You review code.").WithTools("Read", "Grep").WithModel(AgentModelSonnet)
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if valid.Model == nil || *valid.Model != "sonnet" || !reflect.DeepEqual(valid.Tools, []string{"Read", "Grep"}) {
+		t.Errorf("builder produced %+v", valid)
+	}
+
+	tests := []struct {
+		name  string
+		agent AgentDefinition
+		field string
+	}{
+		{"empty description", NewAgentDefinition(" ", "prompt"), "description"},
+		{"empty prompt", NewAgentDefinition("description", ""), "prompt"},
+		{"unknown model", NewAgentDefinition("description", "prompt").WithModel("gpt-4"), "model"},
+		{"empty tool", NewAgentDefinition("description", "prompt").WithTools("Read", ""), "tools"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v *ValidationError
+			if err := tt.agent.Validate(); !errors.As(err, &v) || v.Field != tt.field {
+				t.Errorf("Validate() = %v, want a violation of %s", err, tt.field)
+			}
+
+			err := NewClaudeAgentOptions().WithAgent("bad", tt.agent).Validate()
+			if err == nil || !strings.Contains(err.Error(), "agents[bad]."+tt.field) {
+				t.Errorf("Options.Validate() = %v, want a violation of agents[bad].%s", err, tt.field)
+			}
+		})
+	}
+
+	// Unknown tools are reported, not rejected
+	agent := NewAgentDefinition("description", "prompt").WithTools("read", "Grpe", "mcp__github__search", "view")
+	if err := agent.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	if unknown := agent.UnknownTools(); !reflect.DeepEqual(unknown, []string{"Grpe"}) {
+		t.Errorf("UnknownTools() = %v, want [Grpe]", unknown)
+	}
+}
+
+// TestLoadAgentDefinitions tests loading the agent markdown fixtures.
+func TestLoadAgentDefinitions(t *testing.T) {
+	agents, err := LoadAgentDefinitions(filepath.Join("testdata", "agents"))
+	if err != nil {
+		t.Fatalf("LoadAgentDefinitions failed: %v", err)
+	}
+	sonnet := AgentModelSonnet
+	want := map[string]AgentDefinition{
+		"code-reviewer": {
+			Description: "Reviews Go code for bugs",
+			Prompt:      "You are a careful Go reviewer.\n\nPoint out bugs before style issues.",
+			Tools:       []string{"Read", "Grep", "Glob"},
+			Model:       &sonnet,
+		},
+		// Named after its file
+		"planner": {
+			Description: "Plans multi-step changes",
+			Prompt:      "You break work into small steps.",
+			Tools:       []string{"Read", "mcp__tracker__create_issue"},
+		},
+	}
+	if !reflect.DeepEqual(agents, want) {
+		t.Errorf("LoadAgentDefinitions() = %+v, want %+v", agents, want)
+	}
+
+	_, err = LoadAgentDefinitions(filepath.Join("testdata", "agents_invalid"))
+	if !IsValidationError(err) || !strings.Contains(err.Error(), "writer.md") || !strings.Contains(err.Error(), "gpt-4") {
+		t.Errorf("invalid agent error = %v, want a ValidationError naming writer.md and its model", err)
+	}
+	if _, err := LoadAgentDefinitions(filepath.Join("testdata", "missing")); !IsValidationError(err) {
+		t.Errorf("missing directory error = %v, want a ValidationError", err)
+	}
+}
@@ -0,0 +1,141 @@
+package types
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// MaxImageBytes is the largest image, after base64 decoding, the API accepts
+// in a content block.
+const MaxImageBytes = 5 * 1024 * 1024
+
+// ImageMediaTypes lists the media types of images the API accepts.
+var ImageMediaTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// UserContentBlock is a content block of a prompt sent with
+// Client.QueryWithContent as a []UserContentBlock. Create blocks with
+// NewTextContent, NewImageContent, NewImageContentBase64 and
+// NewImageContentURL; they are checked with ValidateUserContent before
+// anything is sent.
+type UserContentBlock interface {
+	GetType() string
+	validate() error
+}
+
+// TextContent is a text block of a prompt.
+type TextContent struct {
+	Type string `json:"type"` // Always "text"
+	Text string `json:"text"`
+}
+
+// ImageContent is an image block of a prompt.
+type ImageContent struct {
+	Type   string      `json:"type"` // Always "image"
+	Source ImageSource `json:"source"`
+}
+
+// ImageSource is where the data of an ImageContent comes from: inline base64
+// data with its media type, or a URL the API fetches.
+type ImageSource struct {
+	Type      string `json:"type"` // "base64" or "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// NewTextContent returns a text block.
+func NewTextContent(text string) UserContentBlock {
+	return &TextContent{Type: "text", Text: text}
+}
+
+// NewImageContentBase64 returns an image block holding base64-encoded data of
+// one of the ImageMediaTypes, such as "image/png".
+func NewImageContentBase64(mediaType, data string) UserContentBlock {
+	return &ImageContent{Type: "image", Source: ImageSource{Type: "base64", MediaType: mediaType, Data: data}}
+}
+
+// NewImageContentURL returns an image block the API fetches from an http or
+// https URL.
+func NewImageContentURL(imageURL string) UserContentBlock {
+	return &ImageContent{Type: "image", Source: ImageSource{Type: "url", URL: imageURL}}
+}
+
+// GetType returns the type of the content block.
+func (t *TextContent) GetType() string {
+	return t.Type
+}
+
+// GetType returns the type of the content block.
+func (i *ImageContent) GetType() string {
+	return i.Type
+}
+
+func (t *TextContent) validate() error {
+	if strings.TrimSpace(t.Text) == "" {
+		return NewValidationError("text", "must not be empty")
+	}
+	return nil
+}
+
+func (i *ImageContent) validate() error {
+	switch i.Source.Type {
+	case "base64":
+		if !slices.Contains(ImageMediaTypes, i.Source.MediaType) {
+			return NewValidationError("source.media_type", fmt.Sprintf("unsupported image media type %q (want one of %s)", i.Source.MediaType, strings.Join(ImageMediaTypes, ", ")))
+		}
+		if i.Source.Data == "" {
+			return NewValidationError("source.data", "must not be empty")
+		}
+		// Checking the encoded length first avoids decoding oversized payloads
+		if base64.StdEncoding.DecodedLen(len(i.Source.Data)) > MaxImageBytes+2 {
+			return NewValidationError("source.data", fmt.Sprintf("image is larger than %d bytes", MaxImageBytes))
+		}
+		decoded, err := base64.StdEncoding.DecodeString(i.Source.Data)
+		if err != nil {
+			return NewValidationErrorWithCause("source.data", "is not valid base64", err)
+		}
+		if len(decoded) > MaxImageBytes {
+			return NewValidationError("source.data", fmt.Sprintf("image is %d bytes, larger than %d", len(decoded), MaxImageBytes))
+		}
+		// Only the header is read; webp, which has no decoder, is not checked
+		if config, _, err := image.DecodeConfig(bytes.NewReader(decoded)); err == nil && max(config.Width, config.Height) > MaxImageDimension {
+			return NewValidationError("source.data", fmt.Sprintf("image is %dx%d pixels, larger than %d on a side", config.Width, config.Height, MaxImageDimension))
+		}
+	case "url":
+		u, err := url.Parse(i.Source.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return NewValidationError("source.url", fmt.Sprintf("%q is not an http or https URL", i.Source.URL))
+		}
+	default:
+		return NewValidationError("source.type", fmt.Sprintf("unknown image source type %q (want base64 or url)", i.Source.Type))
+	}
+	return nil
+}
+
+// ValidateUserContent reports the first problem with a prompt's content
+// blocks: no blocks, empty text, an unsupported image media type, invalid or
+// oversized base64 data (in bytes or pixels), or a URL that is not http or
+// https. The error is a *ValidationError whose field names the block, e.g.
+// "content[1].source.data".
+func ValidateUserContent(blocks []UserContentBlock) error {
+	if len(blocks) == 0 {
+		return NewValidationError("content", "must contain at least one block")
+	}
+	for i, block := range blocks {
+		if block == nil {
+			return NewValidationError(fmt.Sprintf("content[%d]", i), "must not be nil")
+		}
+		if err := block.validate(); err != nil {
+			if v, ok := err.(*ValidationError); ok {
+				return NewValidationErrorWithCause(fmt.Sprintf("content[%d].%s", i, v.Field), v.Message, v.Cause)
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestUserContentBlock_JSON tests that the builders marshal to the content
+// blocks the CLI expects.
+func TestUserContentBlock_JSON(t *testing.T) {
+	blocks := []UserContentBlock{
+		NewTextContent("Describe these"),
+		NewImageContentBase64("image/png", "iVBORw0KGgo="),
+		NewImageContentURL("https://example.com/cat.jpg"),
+	}
+	data, err := json.Marshal(blocks)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `[{"type":"text","text":"Describe these"},` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo="}},` +
+		`{"type":"image","source":{"type":"url","url":"https://example.com/cat.jpg"}}]`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s\nwant %s", data, want)
+	}
+	if err := ValidateUserContent(blocks); err != nil {
+		t.Errorf("ValidateUserContent failed: %v", err)
+	}
+}
+
+// TestValidateUserContent tests the problems found before sending.
+func TestValidateUserContent(t *testing.T) {
+	oversized := base64.StdEncoding.EncodeToString(make([]byte, MaxImageBytes+1))
+	wide := base64.StdEncoding.EncodeToString(noisyPNG(t, MaxImageDimension+1, 1))
+	tests := []struct {
+		name   string
+		blocks []UserContentBlock
+		field  string
+	}{
+		{"no blocks", nil, "content"},
+		{"nil block", []UserContentBlock{nil}, "content[0]"},
+		{"empty text", []UserContentBlock{NewTextContent("  ")}, "content[0].text"},
+		{"media type typo", []UserContentBlock{NewTextContent("hi"), NewImageContentBase64("image/jpg", "aGk=")}, "content[1].source.media_type"},
+		{"empty data", []UserContentBlock{NewImageContentBase64("image/png", "")}, "content[0].source.data"},
+		{"invalid base64", []UserContentBlock{NewImageContentBase64("image/png", "not base64!")}, "content[0].source.data"},
+		{"oversized", []UserContentBlock{NewImageContentBase64("image/gif", oversized)}, "content[0].source.data"},
+		{"too many pixels", []UserContentBlock{NewImageContentBase64("image/png", wide)}, "content[0].source.data"},
+		{"relative URL", []UserContentBlock{NewImageContentURL("cat.jpg")}, "content[0].source.url"},
+		{"file URL", []UserContentBlock{NewImageContentURL("file:///tmp/cat.jpg")}, "content[0].source.url"},
+		{"unknown source", []UserContentBlock{&ImageContent{Type: "image", Source: ImageSource{Type: "file"}}}, "content[0].source.type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateUserContent(tt.blocks)
+			var v *ValidationError
+			if !errors.As(err, &v) || v.Field != tt.field {
+				t.Fatalf("ValidateUserContent() = %v, want a violation of %s", err, tt.field)
+			}
+			if !strings.Contains(err.Error(), tt.field) {
+				t.Errorf("error %q does not name %s", err, tt.field)
+			}
+		})
+	}
+}
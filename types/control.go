@@ -1,6 +1,11 @@
 package types
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+)
 
 // PermissionMode represents the permission mode for Claude.
 type PermissionMode string
@@ -12,6 +17,23 @@ const (
 	PermissionModeBypassPermissions PermissionMode = "bypassPermissions"
 )
 
+// IsValid reports whether m is one of the permission modes the CLI accepts.
+func (m PermissionMode) IsValid() bool {
+	switch m {
+	case PermissionModeDefault, PermissionModeAcceptEdits, PermissionModePlan, PermissionModeBypassPermissions:
+		return true
+	}
+	return false
+}
+
+// Direction identifies which side sent a control protocol message.
+type Direction string
+
+const (
+	DirectionOutbound Direction = "outbound" // Sent by the SDK to the CLI
+	DirectionInbound  Direction = "inbound"  // Sent by the CLI to the SDK
+)
+
 // PermissionBehavior represents the behavior for a permission rule.
 type PermissionBehavior string
 
@@ -65,6 +87,21 @@ type PermissionResultDeny struct {
 type ToolPermissionContext struct {
 	Signal      interface{}        `json:"signal,omitempty"` // Future: abort signal support
 	Suggestions []PermissionUpdate `json:"suggestions,omitempty"`
+	RawToolName string             `json:"raw_tool_name,omitempty"` // Tool name as sent by the CLI, before normalization
+
+	// PermissionMode is the session's permission mode when the request was
+	// made. It starts from the configured mode and follows changes reported
+	// by the CLI or requested through permission updates.
+	PermissionMode PermissionMode `json:"permission_mode,omitempty"`
+	SessionID      string         `json:"session_id,omitempty"` // Empty until the CLI reports the session
+	AgentName      string         `json:"agent_name,omitempty"` // Subagent type when a subagent requested the tool, otherwise empty
+
+	// RawRequest is a deep copy of the can_use_tool request as the CLI sent
+	// it, including fields the SDK does not model yet, such as blocked_path.
+	// It is an unstable escape hatch: its keys are the CLI's and may change
+	// between CLI versions, and fields the SDK comes to model should be read
+	// from their typed counterparts. It is never nil.
+	RawRequest map[string]interface{} `json:"raw_request,omitempty"`
 }
 
 // HookEvent represents a hook event type.
@@ -197,7 +234,15 @@ type SyncHookJSONOutput struct {
 
 // HookContext provides context information for hook callbacks.
 type HookContext struct {
-	Signal interface{} `json:"signal,omitempty"` // Future: abort signal support
+	Signal      interface{} `json:"signal,omitempty"`        // Future: abort signal support
+	ToolName    string      `json:"tool_name,omitempty"`     // Canonical tool name (see NormalizeToolName), if the event concerns a tool
+	RawToolName string      `json:"raw_tool_name,omitempty"` // Tool name as sent by the CLI
+
+	// RawInput is a deep copy of the hook's input as the CLI sent it,
+	// including fields the typed hook inputs do not model yet. Like
+	// ToolPermissionContext.RawRequest, it is an unstable escape hatch. It is
+	// never nil, and empty when the input is not a JSON object.
+	RawInput map[string]interface{} `json:"raw_input,omitempty"`
 }
 
 // SDKControlInterruptRequest represents an interrupt request.
@@ -268,6 +313,80 @@ type SDKControlResponse struct {
 	Response json.RawMessage `json:"response"` // Union type - needs custom unmarshaling
 }
 
+// ServerInfo describes the CLI as reported in its response to the initialize
+// control request, so applications can feature-detect before wiring up
+// callbacks.
+type ServerInfo struct {
+	Capabilities  []string               // Features the CLI advertises, e.g. "hooks", "permissions"
+	Commands      []string               // Names of the slash commands available in the session
+	SlashCommands []SlashCommand         // The same commands with their descriptions
+	Raw           map[string]interface{} // The full initialize response
+}
+
+// SlashCommand is a slash command available in the session, built in (such
+// as /compact) or provided by a plugin.
+type SlashCommand struct {
+	Name         string // Without the leading slash
+	Description  string // Empty when the CLI only advertises the name
+	ArgumentHint string // Arguments the command takes, e.g. "<file>"; empty if none or unknown
+}
+
+// NewServerInfo builds a ServerInfo from an initialize response. Capabilities
+// may be listed by name or as an object of enabled flags; commands by name or
+// as objects with a "name" field. Entries of other shapes are skipped.
+func NewServerInfo(response map[string]interface{}) *ServerInfo {
+	info := &ServerInfo{
+		Capabilities:  []string{},
+		Commands:      []string{},
+		SlashCommands: []SlashCommand{},
+		Raw:           maps.Clone(response),
+	}
+	if info.Raw == nil {
+		info.Raw = map[string]interface{}{}
+	}
+
+	switch capabilities := response["capabilities"].(type) {
+	case []interface{}:
+		for _, c := range capabilities {
+			if name, ok := c.(string); ok {
+				info.Capabilities = append(info.Capabilities, name)
+			}
+		}
+	case []string:
+		info.Capabilities = append(info.Capabilities, capabilities...)
+	case map[string]interface{}:
+		for _, name := range slices.Sorted(maps.Keys(capabilities)) {
+			if enabled, ok := capabilities[name].(bool); !ok || enabled {
+				info.Capabilities = append(info.Capabilities, name)
+			}
+		}
+	}
+
+	commands, _ := response["commands"].([]interface{})
+	for _, c := range commands {
+		var command SlashCommand
+		switch c := c.(type) {
+		case string:
+			command.Name = c
+		case map[string]interface{}:
+			command.Name, _ = c["name"].(string)
+			command.Description, _ = c["description"].(string)
+			command.ArgumentHint, _ = c["argumentHint"].(string)
+		}
+		command.Name = strings.TrimPrefix(command.Name, "/")
+		if command.Name != "" {
+			info.Commands = append(info.Commands, command.Name)
+			info.SlashCommands = append(info.SlashCommands, command)
+		}
+	}
+	return info
+}
+
+// HasCapability reports whether the CLI advertised the named capability.
+func (s *ServerInfo) HasCapability(name string) bool {
+	return s != nil && slices.Contains(s.Capabilities, name)
+}
+
 // MCPServer represents an MCP server interface for handling MCP messages.
 // This is a minimal interface for routing MCP JSONRPC messages.
 // Concrete implementations can use the MCP SDK or custom logic.
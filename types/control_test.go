@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -130,3 +131,48 @@ func TestPreToolUseHookInput(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+// TestPermissionModeIsValid tests that only the CLI's permission modes are valid.
+func TestPermissionModeIsValid(t *testing.T) {
+	for mode, want := range map[PermissionMode]bool{
+		PermissionModeDefault:           true,
+		PermissionModeAcceptEdits:       true,
+		PermissionModePlan:              true,
+		PermissionModeBypassPermissions: true,
+		"":                              false,
+		"AcceptEdits":                   false,
+		"yolo":                          false,
+	} {
+		if got := mode.IsValid(); got != want {
+			t.Errorf("PermissionMode(%q).IsValid() = %v, want %v", mode, got, want)
+		}
+	}
+}
+
+// TestNewServerInfo tests the accepted shapes of capabilities and commands.
+func TestNewServerInfo(t *testing.T) {
+	info := NewServerInfo(map[string]interface{}{
+		"capabilities": map[string]interface{}{"permissions": true, "hooks": true, "mcp": false},
+		"commands": []interface{}{"compact", map[string]interface{}{"name": "/greet", "description": "Say hello", "argumentHint": "<name>"},
+			42, map[string]interface{}{"description": "no name"}},
+	})
+	if !reflect.DeepEqual(info.Capabilities, []string{"hooks", "permissions"}) {
+		t.Errorf("Capabilities = %v, want the enabled flags sorted", info.Capabilities)
+	}
+	if !reflect.DeepEqual(info.Commands, []string{"compact", "greet"}) {
+		t.Errorf("Commands = %v", info.Commands)
+	}
+	want := []SlashCommand{{Name: "compact"}, {Name: "greet", Description: "Say hello", ArgumentHint: "<name>"}}
+	if !reflect.DeepEqual(info.SlashCommands, want) {
+		t.Errorf("SlashCommands = %+v, want %+v", info.SlashCommands, want)
+	}
+
+	empty := NewServerInfo(nil)
+	if empty.Capabilities == nil || empty.Commands == nil || empty.SlashCommands == nil || empty.Raw == nil || empty.HasCapability("hooks") {
+		t.Errorf("an empty response should give empty, non-nil fields: %+v", empty)
+	}
+	var missing *ServerInfo
+	if missing.HasCapability("hooks") {
+		t.Error("a nil ServerInfo has no capabilities")
+	}
+}
@@ -48,6 +48,21 @@
 //   - MessageParseError: Valid JSON but invalid message structure
 //   - ControlProtocolError: Control protocol violations
 //   - PermissionDeniedError: Permission request denied
+//   - ValidationError: Invalid option value detected before spawning the CLI
+//   - BudgetExceededError: Accumulated cost exceeded MaxBudgetUSD
+//   - ResultError: A turn ended with an error result (max turns, API error, ...)
+//   - IncompleteStreamError: The message stream ended before the turn's result
+//   - TimeoutError: No message arrived within QueryTimeout
+//   - TurnInterruptedError: A turn was ended by a user interrupt
+//
+// ResultError, IncompleteStreamError, BudgetExceededError, TimeoutError and
+// TurnInterruptedError carry an ErrorContext with the assistant text and last
+// tool use of the failed turn.
+//
+// ErrNotInitialized is a sentinel returned when a query cannot be sent because
+// the control protocol has not finished initializing; check it with errors.Is.
+// So is ErrClientClosed, matched by the errors of calls on a Client closed by
+// its idle timeout.
 //
 // Use the Is* helper functions for error checking:
 //
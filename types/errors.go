@@ -3,8 +3,34 @@ package types
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// ErrNotInitialized is returned when a query is sent before the control protocol
+// finished initializing within the allowed time.
+var ErrNotInitialized = errors.New("control protocol not initialized")
+
+// ErrNoPendingTurn is returned by Client.ReceiveResponseE when no query has been
+// sent whose response is still outstanding.
+var ErrNoPendingTurn = errors.New("no pending turn: call Query before ReceiveResponse")
+
+// ErrConcurrentReceive is returned by Client.ReceiveResponseE when another
+// consumer is already receiving the current turn.
+var ErrConcurrentReceive = errors.New("response is already being received by another consumer")
+
+// ErrListenerConsumer is returned when a Client's messages are consumed both
+// by listeners (OnAssistantText and its siblings) and through channels
+// (ReceiveResponse, ReceiveMessages, QueryWithSession): registering a listener
+// after a channel was used, or receiving on a channel once a listener is
+// registered.
+var ErrListenerConsumer = errors.New("messages are delivered to listeners, not channels, on this client")
+
+// ErrClientClosed is matched (errors.Is) by the errors of calls on a Client
+// that closed itself after its idle timeout (see WithIdleTimeout), and of
+// prompts a Client abandoned when it was closed (see PromptAbandonedError).
+var ErrClientClosed = errors.New("client closed")
+
 // CLINotFoundError indicates that the Claude Code CLI binary could not be found.
 // This typically occurs when the CLI is not installed or not in PATH.
 type CLINotFoundError struct {
@@ -45,16 +71,18 @@ func NewCLINotFoundErrorWithCause(message string, cause error) *CLINotFoundError
 // This can occur due to subprocess startup failures, pipe creation errors, or
 // communication protocol issues.
 type CLIConnectionError struct {
-	Message string
-	Cause   error
+	Message      string
+	Cause        error
+	ConnectionID string // Connection the error originated from, as in the SDK's log lines (see WithConnectionID)
 }
 
 // Error returns the error message, implementing the error interface.
 func (e *CLIConnectionError) Error() string {
+	msg := e.Message
 	if e.Cause != nil {
-		return e.Message + ": " + e.Cause.Error()
+		msg = msg + ": " + e.Cause.Error()
 	}
-	return e.Message
+	return msg + connectionSuffix(e.ConnectionID)
 }
 
 // Is checks if the target error is a CLIConnectionError.
@@ -81,9 +109,10 @@ func NewCLIConnectionErrorWithCause(message string, cause error) *CLIConnectionE
 // ProcessError indicates an error with the Claude Code CLI subprocess.
 // This includes unexpected termination, non-zero exit codes, or signal interruption.
 type ProcessError struct {
-	Message  string
-	ExitCode int
-	Cause    error
+	Message      string
+	ExitCode     int
+	Cause        error
+	ConnectionID string // Connection the error originated from, as in the SDK's log lines (see WithConnectionID)
 }
 
 // Error returns the error message, implementing the error interface.
@@ -95,7 +124,7 @@ func (e *ProcessError) Error() string {
 	if e.Cause != nil {
 		msg = msg + ": " + e.Cause.Error()
 	}
-	return msg
+	return msg + connectionSuffix(e.ConnectionID)
 }
 
 // Is checks if the target error is a ProcessError.
@@ -124,6 +153,50 @@ func NewProcessErrorWithCause(message string, cause error) *ProcessError {
 	return &ProcessError{Message: message, Cause: cause}
 }
 
+// WithConnectionID records the connection an error originated from on the
+// first *CLIConnectionError or *ProcessError in its chain, so it appears in the
+// message, unless an error in the chain already names a connection. It returns
+// err, which is left alone when it has neither type or id is empty.
+func WithConnectionID(err error, id string) error {
+	if id == "" {
+		return err
+	}
+	var first interface{}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch typed := e.(type) {
+		case *CLIConnectionError:
+			if typed.ConnectionID != "" {
+				return err
+			}
+			if first == nil {
+				first = typed
+			}
+		case *ProcessError:
+			if typed.ConnectionID != "" {
+				return err
+			}
+			if first == nil {
+				first = typed
+			}
+		}
+	}
+	switch typed := first.(type) {
+	case *CLIConnectionError:
+		typed.ConnectionID = id
+	case *ProcessError:
+		typed.ConnectionID = id
+	}
+	return err
+}
+
+// connectionSuffix names a connection at the end of an error message.
+func connectionSuffix(id string) string {
+	if id == "" {
+		return ""
+	}
+	return " (connection " + id + ")"
+}
+
 // JSONDecodeError indicates a failure to parse JSON data from the CLI.
 // This can occur when the CLI sends malformed JSON or when the JSON structure
 // doesn't match the expected schema.
@@ -316,48 +389,395 @@ func NewPermissionDeniedErrorWithCause(message string, cause error) *PermissionD
 	return &PermissionDeniedError{Message: message, Cause: cause}
 }
 
-// Helper functions for error checking
+// ValidationError indicates that an option value is invalid.
+// It is returned before the CLI subprocess is spawned so that misconfiguration
+// is reported with the offending option instead of a generic process failure.
+type ValidationError struct {
+	Field   string // The option that failed validation (e.g. "max_turns")
+	Message string
+	Cause   error
+}
 
-// IsCLINotFoundError checks if an error is or wraps a CLINotFoundError.
-func IsCLINotFoundError(err error) bool {
-	var e *CLINotFoundError
-	return errors.As(err, &e)
+// Error returns the error message, implementing the error interface.
+func (e *ValidationError) Error() string {
+	msg := e.Message
+	if e.Field != "" {
+		msg = fmt.Sprintf("invalid %s: %s", e.Field, msg)
+	}
+	if e.Cause != nil {
+		msg = msg + ": " + e.Cause.Error()
+	}
+	return msg
 }
 
-// IsCLIConnectionError checks if an error is or wraps a CLIConnectionError.
-func IsCLIConnectionError(err error) bool {
-	var e *CLIConnectionError
-	return errors.As(err, &e)
+// Is checks if the target error is a ValidationError.
+func (e *ValidationError) Is(target error) bool {
+	_, ok := target.(*ValidationError)
+	return ok
 }
 
-// IsProcessError checks if an error is or wraps a ProcessError.
-func IsProcessError(err error) bool {
-	var e *ProcessError
-	return errors.As(err, &e)
+// Unwrap returns the wrapped error.
+func (e *ValidationError) Unwrap() error {
+	return e.Cause
 }
 
-// IsJSONDecodeError checks if an error is or wraps a JSONDecodeError.
-func IsJSONDecodeError(err error) bool {
-	var e *JSONDecodeError
-	return errors.As(err, &e)
+// NewValidationError creates a new ValidationError for the given option field.
+func NewValidationError(field, message string) *ValidationError {
+	return &ValidationError{Field: field, Message: message}
 }
 
-// IsMessageParseError checks if an error is or wraps a MessageParseError.
-func IsMessageParseError(err error) bool {
-	var e *MessageParseError
-	return errors.As(err, &e)
+// NewValidationErrorWithCause creates a new ValidationError for the given option field with a cause.
+func NewValidationErrorWithCause(field, message string, cause error) *ValidationError {
+	return &ValidationError{Field: field, Message: message, Cause: cause}
 }
 
-// IsControlProtocolError checks if an error is or wraps a ControlProtocolError.
-func IsControlProtocolError(err error) bool {
-	var e *ControlProtocolError
-	return errors.As(err, &e)
+// OptionsValidationError reports every problem found by ClaudeAgentOptions.Validate.
+// errors.As finds the individual *ValidationError values, so IsValidationError
+// also reports true for it.
+type OptionsValidationError struct {
+	Violations []*ValidationError // In the order the options were checked
 }
 
-// IsPermissionDeniedError checks if an error is or wraps a PermissionDeniedError.
-func IsPermissionDeniedError(err error) bool {
-	var e *PermissionDeniedError
-	return errors.As(err, &e)
+// Error returns the error message, implementing the error interface.
+func (e *OptionsValidationError) Error() string {
+	if len(e.Violations) == 1 {
+		return e.Violations[0].Error()
+	}
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Error()
+	}
+	return fmt.Sprintf("%d invalid options: %s", len(e.Violations), strings.Join(msgs, "; "))
+}
+
+// Is checks if the target error is an OptionsValidationError.
+func (e *OptionsValidationError) Is(target error) bool {
+	_, ok := target.(*OptionsValidationError)
+	return ok
+}
+
+// Unwrap returns the individual violations.
+func (e *OptionsValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Violations))
+	for i, v := range e.Violations {
+		errs[i] = v
+	}
+	return errs
+}
+
+// Fields returns the option fields that failed validation, in order.
+func (e *OptionsValidationError) Fields() []string {
+	fields := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		fields[i] = v.Field
+	}
+	return fields
+}
+
+// ErrorContext captures what the assistant produced during a failed turn, so an
+// error carries the partial output instead of only the failure reason.
+type ErrorContext struct {
+	AssistantText string        // Concatenated assistant text of the failed turn
+	LastToolUse   *ToolUseBlock // Last tool use attempted in the turn, nil if none
+}
+
+// BudgetExceededError indicates that the accumulated cost of a session exceeded
+// the configured MaxBudgetUSD. The SDK interrupts the CLI and stops delivering
+// messages once this happens.
+type BudgetExceededError struct {
+	BudgetUSD float64       // The configured budget
+	SpentUSD  float64       // The accumulated cost when the budget was exceeded
+	Context   *ErrorContext // Output of the turn that exceeded the budget, if tracked
+	Cause     error         // Optional underlying error
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *BudgetExceededError) Error() string {
+	msg := fmt.Sprintf("budget exceeded: spent $%.4f of $%.4f", e.SpentUSD, e.BudgetUSD)
+	if e.Cause != nil {
+		msg = msg + ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Is checks if the target error is a BudgetExceededError.
+func (e *BudgetExceededError) Is(target error) bool {
+	_, ok := target.(*BudgetExceededError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *BudgetExceededError) Unwrap() error {
+	return e.Cause
+}
+
+// NewBudgetExceededError creates a new BudgetExceededError for the given budget and spend.
+func NewBudgetExceededError(budgetUSD, spentUSD float64) *BudgetExceededError {
+	return &BudgetExceededError{BudgetUSD: budgetUSD, SpentUSD: spentUSD}
+}
+
+// ResultError indicates that a turn ended with an error result, such as
+// error_max_turns, error_during_execution, or an API error reported by the CLI.
+type ResultError struct {
+	Subtype   string        // Result subtype (e.g. "error_max_turns")
+	Message   string        // Result text, if the CLI reported one
+	SessionID string        // Session the turn belonged to
+	Context   *ErrorContext // Partial output of the failed turn, if tracked
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *ResultError) Error() string {
+	msg := fmt.Sprintf("turn failed (%s)", e.Subtype)
+	if e.Message != "" {
+		msg = msg + ": " + e.Message
+	}
+	return msg
+}
+
+// Is checks if the target error is a ResultError.
+func (e *ResultError) Is(target error) bool {
+	_, ok := target.(*ResultError)
+	return ok
+}
+
+// NewResultError creates a new ResultError from an error result.
+func NewResultError(result *ResultMessage) *ResultError {
+	e := &ResultError{Subtype: result.Subtype, SessionID: result.SessionID}
+	if result.Result != nil {
+		e.Message = *result.Result
+	}
+	return e
+}
+
+// TurnInterruptedError indicates that a turn was ended by an interrupt, from
+// Client.Interrupt or another surface such as an IDE, rather than failing on
+// its own. Its Cause is the *ResultError of the turn's result, so IsResultError
+// also matches it.
+type TurnInterruptedError struct {
+	SessionID string        // Session the turn belonged to
+	Context   *ErrorContext // Output of the turn up to the interrupt, if tracked
+	Cause     error         // The turn's *ResultError, if it ended with an error result
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *TurnInterruptedError) Error() string {
+	msg := "turn interrupted by user"
+	if e.Cause != nil {
+		msg = msg + ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Is checks if the target error is a TurnInterruptedError.
+func (e *TurnInterruptedError) Is(target error) bool {
+	_, ok := target.(*TurnInterruptedError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *TurnInterruptedError) Unwrap() error {
+	return e.Cause
+}
+
+// NewTurnInterruptedError creates a new TurnInterruptedError for the result of
+// an interrupted turn.
+func NewTurnInterruptedError(result *ResultMessage) *TurnInterruptedError {
+	e := &TurnInterruptedError{SessionID: result.SessionID}
+	if result.IsError || strings.HasPrefix(result.Subtype, "error") {
+		e.Cause = NewResultError(result)
+	}
+	return e
+}
+
+// RefusalSource tells how a refusal was detected.
+type RefusalSource string
+
+const (
+	RefusalByStopReason RefusalSource = "stop_reason" // The model reported the refusal stop reason
+	RefusalByClassifier RefusalSource = "classifier"  // The refusal classifier matched the answer's text
+)
+
+// RefusalError indicates that the model declined the request. The turn
+// completed without an error result, but its answer is a refusal rather than
+// the requested work (see DetectRefusal and ClaudeAgentOptions.FailOnRefusal).
+type RefusalError struct {
+	Source    RefusalSource // How the refusal was detected
+	Text      string        // Text of the refusing answer
+	SessionID string        // Session the turn belonged to
+	Context   *ErrorContext // Output of the refused turn, if tracked
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *RefusalError) Error() string {
+	msg := fmt.Sprintf("request refused by the model (%s)", e.Source)
+	if text := strings.TrimSpace(e.Text); text != "" {
+		if runes := []rune(text); len(runes) > 120 {
+			text = string(runes[:120]) + "..."
+		}
+		msg = msg + ": " + text
+	}
+	return msg
+}
+
+// Is checks if the target error is a RefusalError.
+func (e *RefusalError) Is(target error) bool {
+	_, ok := target.(*RefusalError)
+	return ok
+}
+
+// NewRefusalError creates a new RefusalError for the given source and answer text.
+func NewRefusalError(source RefusalSource, text string) *RefusalError {
+	return &RefusalError{Source: source, Text: text}
+}
+
+// ImageTooLargeError indicates that an image is larger than the limits for
+// prompts (see ClaudeAgentOptions.MaxImageSize and MaxImageDimension), so it
+// was not sent.
+type ImageTooLargeError struct {
+	Path  string // The image file; empty for data given to NewImageContent
+	Size  int64  // Size of the image in bytes
+	Limit int64  // The byte limit
+
+	// Set when the image's dimensions exceed the limit, whatever its size
+	Width        int
+	Height       int
+	MaxDimension int
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *ImageTooLargeError) Error() string {
+	name := "image"
+	if e.Path != "" {
+		name += " " + e.Path
+	}
+	if e.MaxDimension > 0 {
+		return fmt.Sprintf("%s is %dx%d pixels, larger than the limit of %d on a side", name, e.Width, e.Height, e.MaxDimension)
+	}
+	return fmt.Sprintf("%s is %d bytes, larger than the limit of %d bytes", name, e.Size, e.Limit)
+}
+
+// Is checks if the target error is an ImageTooLargeError.
+func (e *ImageTooLargeError) Is(target error) bool {
+	_, ok := target.(*ImageTooLargeError)
+	return ok
+}
+
+// NewImageTooLargeError creates a new ImageTooLargeError for the given file.
+func NewImageTooLargeError(path string, size, limit int64) *ImageTooLargeError {
+	return &ImageTooLargeError{Path: path, Size: size, Limit: limit}
+}
+
+// ImageFormatError indicates that an image cannot be sent as given: its
+// format is not one the API accepts, its data cannot be decoded, or it needs
+// re-encoding the standard library cannot do.
+type ImageFormatError struct {
+	Path      string // The image file; empty for data given to NewImageContent
+	MediaType string // The image's media type, "" when unrecognized
+	Reason    string
+	Cause     error // Optional underlying error
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *ImageFormatError) Error() string {
+	name := "image"
+	if e.Path != "" {
+		name += " " + e.Path
+	}
+	if e.MediaType != "" {
+		name += " (" + e.MediaType + ")"
+	}
+	msg := name + ": " + e.Reason
+	if e.Cause != nil {
+		msg = msg + ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *ImageFormatError) Unwrap() error {
+	return e.Cause
+}
+
+// Is checks if the target error is an ImageFormatError.
+func (e *ImageFormatError) Is(target error) bool {
+	_, ok := target.(*ImageFormatError)
+	return ok
+}
+
+// NewImageFormatError creates a new ImageFormatError.
+func NewImageFormatError(mediaType, reason string, cause error) *ImageFormatError {
+	return &ImageFormatError{MediaType: mediaType, Reason: reason, Cause: cause}
+}
+
+// TimeoutError indicates that a response was abandoned because no message
+// arrived within the configured QueryTimeout. The SDK interrupts the turn and
+// closes the response channel when this happens.
+type TimeoutError struct {
+	Timeout time.Duration // The configured idle timeout
+	Context *ErrorContext // Partial output of the abandoned turn, if tracked
+	Cause   error         // Optional underlying error
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *TimeoutError) Error() string {
+	msg := fmt.Sprintf("query timed out: no message received for %s", e.Timeout)
+	if e.Cause != nil {
+		msg = msg + ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Is checks if the target error is a TimeoutError.
+func (e *TimeoutError) Is(target error) bool {
+	_, ok := target.(*TimeoutError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *TimeoutError) Unwrap() error {
+	return e.Cause
+}
+
+// NewTimeoutError creates a new TimeoutError for the given timeout.
+func NewTimeoutError(timeout time.Duration) *TimeoutError {
+	return &TimeoutError{Timeout: timeout}
+}
+
+// IncompleteStreamError indicates that the message stream ended before the
+// current turn's ResultMessage arrived (e.g. the CLI exited or the context ended).
+type IncompleteStreamError struct {
+	Message string        // Human-readable error message
+	Context *ErrorContext // Partial output of the interrupted turn, if tracked
+	Cause   error         // Optional underlying error
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *IncompleteStreamError) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+// Is checks if the target error is an IncompleteStreamError.
+func (e *IncompleteStreamError) Is(target error) bool {
+	_, ok := target.(*IncompleteStreamError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *IncompleteStreamError) Unwrap() error {
+	return e.Cause
+}
+
+// NewIncompleteStreamError creates a new IncompleteStreamError with the given message.
+func NewIncompleteStreamError(message string) *IncompleteStreamError {
+	return &IncompleteStreamError{Message: message}
+}
+
+// NewIncompleteStreamErrorWithCause creates a new IncompleteStreamError with the given message and cause.
+func NewIncompleteStreamErrorWithCause(message string, cause error) *IncompleteStreamError {
+	return &IncompleteStreamError{Message: message, Cause: cause}
 }
 
 // SessionNotFoundError indicates that a Claude session could not be found.
@@ -410,8 +830,233 @@ func NewSessionNotFoundErrorWithCause(sessionID, message string, cause error) *S
 	}
 }
 
+// HealthCheckReason describes why a connection failed a health check.
+type HealthCheckReason string
+
+const (
+	HealthNotConnected   HealthCheckReason = "not connected"   // Connect was not called or Close was
+	HealthProcessExited  HealthCheckReason = "process exited"  // The CLI's output ended, so it exited or crashed
+	HealthStdinClosed    HealthCheckReason = "stdin closed"    // Writes to the CLI fail
+	HealthControlTimeout HealthCheckReason = "control timeout" // The CLI did not answer a control request in time
+)
+
+// HealthCheckError indicates that Client.Ping found the connection to the CLI
+// unusable. Reason says what is wrong; Cause holds the underlying error, if any.
+type HealthCheckError struct {
+	Reason HealthCheckReason // What is wrong with the connection
+	Cause  error             // Optional underlying error
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *HealthCheckError) Error() string {
+	msg := fmt.Sprintf("health check failed: %s", e.Reason)
+	if e.Cause != nil {
+		msg = msg + ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Is checks if the target error is a HealthCheckError.
+func (e *HealthCheckError) Is(target error) bool {
+	_, ok := target.(*HealthCheckError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *HealthCheckError) Unwrap() error {
+	return e.Cause
+}
+
+// NewHealthCheckError creates a new HealthCheckError with the given reason and optional cause.
+func NewHealthCheckError(reason HealthCheckReason, cause error) *HealthCheckError {
+	return &HealthCheckError{Reason: reason, Cause: cause}
+}
+
+// SessionLockedError indicates that a session could not be resumed because
+// another client holds its lock (see ClaudeAgentOptions.WithSessionLocking).
+type SessionLockedError struct {
+	SessionID string // The session being resumed
+	Path      string // The lock file
+	HolderPID int    // Process holding the lock, or 0 if unknown
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *SessionLockedError) Error() string {
+	if e.HolderPID > 0 {
+		return fmt.Sprintf("session %s is locked by process %d (%s)", e.SessionID, e.HolderPID, e.Path)
+	}
+	return fmt.Sprintf("session %s is locked by another client (%s)", e.SessionID, e.Path)
+}
+
+// Is checks if the target error is a SessionLockedError.
+func (e *SessionLockedError) Is(target error) bool {
+	_, ok := target.(*SessionLockedError)
+	return ok
+}
+
+// NewSessionLockedError creates a new SessionLockedError; holderPID is 0 when unknown.
+func NewSessionLockedError(sessionID, path string, holderPID int) *SessionLockedError {
+	return &SessionLockedError{SessionID: sessionID, Path: path, HolderPID: holderPID}
+}
+
+// PromptAbandonedError is the error of a prompt queued with Client.Enqueue
+// that was never sent: it was cancelled, or the turn before it was
+// interrupted, or the client was closed first.
+type PromptAbandonedError struct {
+	Prompt string // The abandoned prompt
+	Reason string // Why it was abandoned: "cancelled", "interrupted" or "client closed"
+	Cause  error  // context.Canceled or the prompt's context error when cancelled, ErrClientClosed when closed
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *PromptAbandonedError) Error() string {
+	msg := "queued prompt abandoned: " + e.Reason
+	if e.Cause != nil && e.Cause.Error() != e.Reason {
+		msg = msg + ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Is checks if the target error is a PromptAbandonedError.
+func (e *PromptAbandonedError) Is(target error) bool {
+	_, ok := target.(*PromptAbandonedError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *PromptAbandonedError) Unwrap() error {
+	return e.Cause
+}
+
+// NewPromptAbandonedError creates a new PromptAbandonedError.
+func NewPromptAbandonedError(prompt, reason string, cause error) *PromptAbandonedError {
+	return &PromptAbandonedError{Prompt: prompt, Reason: reason, Cause: cause}
+}
+
+// Helper functions for error checking
+
+// IsCLINotFoundError checks if an error is or wraps a CLINotFoundError.
+func IsCLINotFoundError(err error) bool {
+	var e *CLINotFoundError
+	return errors.As(err, &e)
+}
+
+// IsCLIConnectionError checks if an error is or wraps a CLIConnectionError.
+func IsCLIConnectionError(err error) bool {
+	var e *CLIConnectionError
+	return errors.As(err, &e)
+}
+
+// IsProcessError checks if an error is or wraps a ProcessError.
+func IsProcessError(err error) bool {
+	var e *ProcessError
+	return errors.As(err, &e)
+}
+
+// IsJSONDecodeError checks if an error is or wraps a JSONDecodeError.
+func IsJSONDecodeError(err error) bool {
+	var e *JSONDecodeError
+	return errors.As(err, &e)
+}
+
+// IsMessageParseError checks if an error is or wraps a MessageParseError.
+func IsMessageParseError(err error) bool {
+	var e *MessageParseError
+	return errors.As(err, &e)
+}
+
+// IsControlProtocolError checks if an error is or wraps a ControlProtocolError.
+func IsControlProtocolError(err error) bool {
+	var e *ControlProtocolError
+	return errors.As(err, &e)
+}
+
+// IsValidationError checks if an error is or wraps a ValidationError.
+func IsValidationError(err error) bool {
+	var e *ValidationError
+	return errors.As(err, &e)
+}
+
+// IsOptionsValidationError checks if an error is or wraps an OptionsValidationError.
+func IsOptionsValidationError(err error) bool {
+	var e *OptionsValidationError
+	return errors.As(err, &e)
+}
+
+// IsBudgetExceededError checks if an error is or wraps a BudgetExceededError.
+func IsBudgetExceededError(err error) bool {
+	var e *BudgetExceededError
+	return errors.As(err, &e)
+}
+
+// IsResultError checks if an error is or wraps a ResultError.
+func IsResultError(err error) bool {
+	var e *ResultError
+	return errors.As(err, &e)
+}
+
+// IsIncompleteStreamError checks if an error is or wraps an IncompleteStreamError.
+func IsIncompleteStreamError(err error) bool {
+	var e *IncompleteStreamError
+	return errors.As(err, &e)
+}
+
+// IsTurnInterruptedError checks if an error is or wraps a TurnInterruptedError.
+func IsTurnInterruptedError(err error) bool {
+	var e *TurnInterruptedError
+	return errors.As(err, &e)
+}
+
+// IsRefusalError checks if an error is or wraps a RefusalError.
+func IsRefusalError(err error) bool {
+	var e *RefusalError
+	return errors.As(err, &e)
+}
+
+// IsImageTooLargeError checks if an error is or wraps an ImageTooLargeError.
+func IsImageTooLargeError(err error) bool {
+	var e *ImageTooLargeError
+	return errors.As(err, &e)
+}
+
+// IsImageFormatError checks if an error is or wraps an ImageFormatError.
+func IsImageFormatError(err error) bool {
+	var e *ImageFormatError
+	return errors.As(err, &e)
+}
+
+// IsTimeoutError checks if an error is or wraps a TimeoutError.
+func IsTimeoutError(err error) bool {
+	var e *TimeoutError
+	return errors.As(err, &e)
+}
+
+// IsPermissionDeniedError checks if an error is or wraps a PermissionDeniedError.
+func IsPermissionDeniedError(err error) bool {
+	var e *PermissionDeniedError
+	return errors.As(err, &e)
+}
+
 // IsSessionNotFoundError checks if an error is or wraps a SessionNotFoundError.
 func IsSessionNotFoundError(err error) bool {
 	var e *SessionNotFoundError
 	return errors.As(err, &e)
 }
+
+// IsHealthCheckError checks if an error is or wraps a HealthCheckError.
+func IsHealthCheckError(err error) bool {
+	var e *HealthCheckError
+	return errors.As(err, &e)
+}
+
+// IsSessionLockedError checks if an error is or wraps a SessionLockedError.
+func IsSessionLockedError(err error) bool {
+	var e *SessionLockedError
+	return errors.As(err, &e)
+}
+
+// IsPromptAbandonedError checks if an error is or wraps a PromptAbandonedError.
+func IsPromptAbandonedError(err error) bool {
+	var e *PromptAbandonedError
+	return errors.As(err, &e)
+}
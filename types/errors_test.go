@@ -2,7 +2,10 @@ package types
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestCLINotFoundError tests CLINotFoundError creation and methods.
@@ -160,6 +163,175 @@ func TestSessionNotFoundError(t *testing.T) {
 	})
 }
 
+// TestValidationError tests ValidationError creation and methods.
+func TestValidationError(t *testing.T) {
+	t.Run("error names field", func(t *testing.T) {
+		err := NewValidationError("max_turns", "must not be negative")
+		if err.Error() != "invalid max_turns: must not be negative" {
+			t.Errorf("unexpected error message: %s", err.Error())
+		}
+	})
+
+	t.Run("error with cause", func(t *testing.T) {
+		cause := errors.New("stat failed")
+		err := NewValidationErrorWithCause("cwd", "directory does not exist", cause)
+		if err.Unwrap() != cause {
+			t.Error("expected unwrap to return cause")
+		}
+		if !containsSubstring(err.Error(), "stat failed") {
+			t.Error("expected error message to contain cause")
+		}
+	})
+
+	t.Run("IsValidationError helper", func(t *testing.T) {
+		wrapped := NewCLIConnectionErrorWithCause("failed to connect", NewValidationError("max_turns", "bad"))
+		if !IsValidationError(wrapped) {
+			t.Error("expected IsValidationError to see through wrapping")
+		}
+		if IsValidationError(NewCLINotFoundError("other error")) {
+			t.Error("expected IsValidationError to return false for different error type")
+		}
+	})
+}
+
+func TestBudgetExceededError(t *testing.T) {
+	err := NewBudgetExceededError(0.05, 0.06)
+	if err.Error() != "budget exceeded: spent $0.0600 of $0.0500" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+
+	wrapped := NewControlProtocolErrorWithCause("session stopped", err)
+	if !IsBudgetExceededError(wrapped) {
+		t.Error("expected IsBudgetExceededError to see through wrapping")
+	}
+	if IsBudgetExceededError(NewValidationError("max_budget_usd", "bad")) {
+		t.Error("expected IsBudgetExceededError to return false for different error type")
+	}
+}
+
+func TestResultError(t *testing.T) {
+	text := "Reached maximum number of turns"
+	err := NewResultError(&ResultMessage{Subtype: "error_max_turns", IsError: true, Result: &text, SessionID: "s-1"})
+	if err.Error() != "turn failed (error_max_turns): Reached maximum number of turns" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if err.SessionID != "s-1" {
+		t.Errorf("SessionID = %q, want s-1", err.SessionID)
+	}
+	if got := NewResultError(&ResultMessage{Subtype: "error_during_execution"}).Error(); got != "turn failed (error_during_execution)" {
+		t.Errorf("unexpected error message without result text: %s", got)
+	}
+
+	wrapped := fmt.Errorf("script turn 2: %w", err)
+	if !IsResultError(wrapped) {
+		t.Error("expected IsResultError to see through wrapping")
+	}
+	if IsResultError(NewIncompleteStreamError("ended")) {
+		t.Error("expected IsResultError to return false for different error type")
+	}
+}
+
+func TestIncompleteStreamError(t *testing.T) {
+	cause := errors.New("context deadline exceeded")
+	err := NewIncompleteStreamErrorWithCause("no result before deadline", cause)
+	if err.Error() != "no result before deadline: context deadline exceeded" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !errors.Is(err, cause) {
+		t.Error("expected cause to be unwrappable")
+	}
+	if !IsIncompleteStreamError(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("expected IsIncompleteStreamError to see through wrapping")
+	}
+	if IsIncompleteStreamError(NewBudgetExceededError(1, 2)) {
+		t.Error("expected IsIncompleteStreamError to return false for different error type")
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	err := NewTimeoutError(30 * time.Second)
+	if err.Error() != "query timed out: no message received for 30s" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !IsTimeoutError(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("expected IsTimeoutError to see through wrapping")
+	}
+	if IsTimeoutError(NewIncompleteStreamError("ended")) {
+		t.Error("expected IsTimeoutError to return false for different error type")
+	}
+}
+
+func TestWithConnectionID(t *testing.T) {
+	inner := NewProcessErrorWithCode("subprocess exited with error", 1)
+	outer := NewCLIConnectionErrorWithCause("failed to connect to Claude CLI", inner)
+	if err := WithConnectionID(outer, "a1b2c3"); err.Error() != "failed to connect to Claude CLI: subprocess exited with error (exit code: 1) (connection a1b2c3)" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if inner.ConnectionID != "" {
+		t.Error("expected only the outermost error to be tagged")
+	}
+
+	// A connection already named in the chain is kept
+	tagged := fmt.Errorf("query failed: %w", NewCLIConnectionErrorWithCause("lost", WithConnectionID(NewProcessError("exited"), "d4e5f6")))
+	if err := WithConnectionID(tagged, "a1b2c3"); strings.Contains(err.Error(), "a1b2c3") || !strings.Contains(err.Error(), "d4e5f6") {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+
+	plain := errors.New("plain")
+	if err := WithConnectionID(plain, "a1b2c3"); err != plain || err.Error() != "plain" {
+		t.Errorf("WithConnectionID changed an untyped error: %v", err)
+	}
+}
+
+func TestHealthCheckError(t *testing.T) {
+	cause := errors.New("context deadline exceeded")
+	err := NewHealthCheckError(HealthControlTimeout, cause)
+	if err.Error() != "health check failed: control timeout: context deadline exceeded" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !errors.Is(err, cause) {
+		t.Error("expected cause to be unwrappable")
+	}
+	if !IsHealthCheckError(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("expected IsHealthCheckError to see through wrapping")
+	}
+	if IsHealthCheckError(NewCLIConnectionError("not connected")) {
+		t.Error("expected IsHealthCheckError to return false for different error type")
+	}
+}
+
+func TestSessionLockedError(t *testing.T) {
+	err := NewSessionLockedError("s-1", "/c/s-1.jsonl.lock", 42)
+	if err.Error() != "session s-1 is locked by process 42 (/c/s-1.jsonl.lock)" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if got := NewSessionLockedError("s-1", "/c/s-1.jsonl.lock", 0).Error(); got != "session s-1 is locked by another client (/c/s-1.jsonl.lock)" {
+		t.Errorf("unexpected error message without a PID: %s", got)
+	}
+	if !IsSessionLockedError(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("expected IsSessionLockedError to see through wrapping")
+	}
+	if IsSessionLockedError(NewCLIConnectionError("not connected")) {
+		t.Error("expected IsSessionLockedError to return false for different error type")
+	}
+}
+
+func TestPromptAbandonedError(t *testing.T) {
+	err := NewPromptAbandonedError("next", "client closed", ErrClientClosed)
+	if err.Error() != "queued prompt abandoned: client closed" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if got := NewPromptAbandonedError("next", "interrupted", nil).Error(); got != "queued prompt abandoned: interrupted" {
+		t.Errorf("unexpected error message without a cause: %s", got)
+	}
+	if !IsPromptAbandonedError(fmt.Errorf("wrapped: %w", err)) || !errors.Is(err, ErrClientClosed) {
+		t.Error("expected IsPromptAbandonedError and errors.Is to see through wrapping")
+	}
+	if IsPromptAbandonedError(NewCLIConnectionError("not connected")) {
+		t.Error("expected IsPromptAbandonedError to return false for different error type")
+	}
+}
+
 // Helper function to check if a string contains a substring.
 func containsSubstring(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && stringContains(s, substr))
@@ -173,3 +345,21 @@ func stringContains(s, substr string) bool {
 	}
 	return false
 }
+
+// TestTurnInterruptedError tests TurnInterruptedError creation and wrapping.
+func TestTurnInterruptedError(t *testing.T) {
+	text := "stopped"
+	err := NewTurnInterruptedError(&ResultMessage{Subtype: "error_during_execution", IsError: true, SessionID: "s-1", Result: &text})
+	if !IsTurnInterruptedError(err) || !IsResultError(err) {
+		t.Errorf("error result: IsTurnInterruptedError = %v, IsResultError = %v", IsTurnInterruptedError(err), IsResultError(err))
+	}
+	if err.Error() != "turn interrupted by user: turn failed (error_during_execution): stopped" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+
+	// A turn can be interrupted right as it succeeds
+	err = NewTurnInterruptedError(&ResultMessage{Subtype: "success"})
+	if err.Cause != nil || IsResultError(err) || err.Error() != "turn interrupted by user" {
+		t.Errorf("success result: %v (cause %v)", err, err.Cause)
+	}
+}
@@ -0,0 +1,246 @@
+package types
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Registers the GIF decoder for image.Decode
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"strings"
+)
+
+// MaxImageDimension is the longest side, in pixels, of an image the API
+// accepts.
+const MaxImageDimension = 8000
+
+// DefaultJPEGQuality is the quality of images re-encoded by NewImageContent
+// when ImageOptions.JPEGQuality is 0.
+const DefaultJPEGQuality = 85
+
+// maxDecodePixels bounds the pixels of an image NewImageContent decodes to
+// scale it down, and with them the memory decoding takes: a small, highly
+// compressed file can describe an image of billions of pixels.
+const maxDecodePixels = 100_000_000
+
+// maxShrinkAttempts bounds how many times NewImageContent scales an image
+// down by a quarter to get it under the byte limit.
+const maxShrinkAttempts = 8
+
+// ImageOptions are the limits NewImageContent enforces, and whether images
+// over them are shrunk to fit instead of rejected.
+type ImageOptions struct {
+	MaxBytes     int64 // Limit on the image data; 0 or more than MaxImageBytes means MaxImageBytes
+	MaxDimension int   // Limit on the longest side in pixels; 0 or more than MaxImageDimension means MaxImageDimension
+	Downscale    bool  // Scale down and re-encode images over a limit
+	JPEGQuality  int   // Quality of re-encoded JPEGs, 1-100; 0 means DefaultJPEGQuality
+}
+
+// limits returns the byte and dimension limits of o with defaults applied.
+func (o ImageOptions) limits() (maxBytes int64, maxDimension int) {
+	maxBytes, maxDimension = o.MaxBytes, o.MaxDimension
+	if maxBytes <= 0 || maxBytes > MaxImageBytes {
+		maxBytes = MaxImageBytes
+	}
+	if maxDimension <= 0 || maxDimension > MaxImageDimension {
+		maxDimension = MaxImageDimension
+	}
+	return maxBytes, maxDimension
+}
+
+// ImageInfo describes the image in a block built by NewImageContent and the
+// transformation applied to it, if any.
+type ImageInfo struct {
+	MediaType string // Of the image sent
+	Width     int    // Of the image sent; 0 for image/webp, which is not decoded
+	Height    int
+	Bytes     int // Size of the image sent, before base64 encoding
+
+	OriginalMediaType string
+	OriginalWidth     int
+	OriginalHeight    int
+	OriginalBytes     int
+
+	Resized   bool // Scaled down to fit MaxDimension or MaxBytes
+	Reencoded bool // Re-encoded as MediaType, possibly losing quality or animation
+}
+
+// Transformed reports whether the image sent differs from the original.
+func (i *ImageInfo) Transformed() bool {
+	return i.Resized || i.Reencoded
+}
+
+// NewImageContent returns a base64 image block for encoded image data,
+// checking it against the limits of opts. An empty mediaType is detected
+// from the data's magic bytes; it must be one of ImageMediaTypes.
+//
+// Images over a limit fail with an *ImageTooLargeError unless opts.Downscale
+// is set. Then they are decoded with the standard library, scaled down to fit
+// MaxDimension, and re-encoded: PNG and GIF images as PNG while that fits
+// MaxBytes, anything else as JPEG at opts.JPEGQuality, shrinking further until
+// the data fits. Only the first frame of an animated GIF is kept. The
+// returned ImageInfo reports what was done. Images of more than 100 megapixels
+// are not decoded and fail with an *ImageTooLargeError even then.
+//
+// Data that cannot be decoded, and image/webp (which the standard library
+// cannot decode) when it would need shrinking, fail with an
+// *ImageFormatError. Only the byte limit applies to image/webp.
+func NewImageContent(mediaType string, data []byte, opts ImageOptions) (UserContentBlock, *ImageInfo, error) {
+	if mediaType == "" {
+		mediaType = sniffImageMediaType(data)
+	}
+	if !slices.Contains(ImageMediaTypes, mediaType) {
+		return nil, nil, NewImageFormatError(mediaType, fmt.Sprintf("not a supported image (want one of %s)", strings.Join(ImageMediaTypes, ", ")), nil)
+	}
+	if opts.JPEGQuality < 0 || opts.JPEGQuality > 100 {
+		return nil, nil, NewValidationError("jpeg_quality", fmt.Sprintf("must be between 1 and 100, got %d", opts.JPEGQuality))
+	}
+
+	maxBytes, maxDimension := opts.limits()
+	info := &ImageInfo{MediaType: mediaType, Bytes: len(data), OriginalMediaType: mediaType, OriginalBytes: len(data)}
+	tooLarge := NewImageTooLargeError("", int64(len(data)), maxBytes)
+
+	if mediaType == "image/webp" {
+		if int64(len(data)) <= maxBytes {
+			return newImageBlock(mediaType, data), info, nil
+		}
+		if opts.Downscale {
+			return nil, nil, NewImageFormatError(mediaType, "cannot be downscaled: the standard library has no decoder for it", nil)
+		}
+		return nil, nil, tooLarge
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, NewImageFormatError(mediaType, "cannot be decoded", err)
+	}
+	info.Width, info.Height = config.Width, config.Height
+	info.OriginalWidth, info.OriginalHeight = config.Width, config.Height
+	if max(config.Width, config.Height) > maxDimension {
+		tooLarge.Width, tooLarge.Height, tooLarge.MaxDimension = config.Width, config.Height, maxDimension
+	} else if int64(len(data)) <= maxBytes {
+		return newImageBlock(mediaType, data), info, nil
+	}
+	if !opts.Downscale || int64(config.Width)*int64(config.Height) > maxDecodePixels {
+		return nil, nil, tooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, NewImageFormatError(mediaType, "cannot be decoded", err)
+	}
+	quality := opts.JPEGQuality
+	if quality == 0 {
+		quality = DefaultJPEGQuality
+	}
+	width, height := fitDimensions(config.Width, config.Height, maxDimension)
+	for range maxShrinkAttempts {
+		scaled := img
+		if width != config.Width || height != config.Height {
+			scaled = scaleImage(img, width, height)
+		}
+		encoded, encodedType, err := encodeImage(scaled, mediaType, quality, maxBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if int64(len(encoded)) <= maxBytes {
+			info.MediaType, info.Bytes = encodedType, len(encoded)
+			info.Width, info.Height = width, height
+			info.Resized = width != config.Width || height != config.Height
+			info.Reencoded = true
+			return newImageBlock(encodedType, encoded), info, nil
+		}
+		width, height = max(width*3/4, 1), max(height*3/4, 1)
+	}
+	return nil, nil, tooLarge
+}
+
+// newImageBlock returns a base64 image block for data.
+func newImageBlock(mediaType string, data []byte) UserContentBlock {
+	return NewImageContentBase64(mediaType, base64.StdEncoding.EncodeToString(data))
+}
+
+// sniffImageMediaType returns the media type of image data from its magic
+// bytes, or "" when it is not one of ImageMediaTypes.
+func sniffImageMediaType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "image/gif"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "image/webp"
+	}
+	return ""
+}
+
+// fitDimensions scales width and height down, keeping the aspect ratio, so
+// that neither exceeds maxDimension.
+func fitDimensions(width, height, maxDimension int) (int, int) {
+	longest := max(width, height)
+	if longest <= maxDimension {
+		return width, height
+	}
+	return max(width*maxDimension/longest, 1), max(height*maxDimension/longest, 1)
+}
+
+// scaleImage scales img down to width by height pixels, averaging the source
+// pixels each destination pixel covers. The source is converted to RGBA one
+// band of rows at a time, which the draw package does quickly for the types
+// the decoders return, and averaged from the converted pixels.
+func scaleImage(img image.Image, width, height int) *image.RGBA {
+	src := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	band := image.NewRGBA(image.Rect(0, 0, src.Dx(), src.Dy()/height+1))
+	for y := range height {
+		y0 := y * src.Dy() / height
+		y1 := max((y+1)*src.Dy()/height, y0+1)
+		draw.Draw(band, image.Rect(0, 0, src.Dx(), y1-y0), img, image.Pt(src.Min.X, src.Min.Y+y0), draw.Src)
+		for x := range width {
+			x0 := x * src.Dx() / width
+			x1 := max((x+1)*src.Dx()/width, x0+1)
+
+			var r, g, b, a, n uint64
+			for by := range y1 - y0 {
+				row := band.Pix[by*band.Stride:]
+				for bx := x0; bx < x1; bx++ {
+					p := row[bx*4 : bx*4+4 : bx*4+4]
+					r, g, b, a = r+uint64(p[0]), g+uint64(p[1]), b+uint64(p[2]), a+uint64(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// encodeImage re-encodes img, as PNG when it was a PNG or GIF and the result
+// fits maxBytes, else as JPEG at quality with any transparency flattened onto
+// white.
+func encodeImage(img image.Image, mediaType string, quality int, maxBytes int64) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if mediaType == "image/png" || mediaType == "image/gif" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", NewImageFormatError("image/png", "cannot be encoded", err)
+		}
+		if int64(buf.Len()) <= maxBytes {
+			return buf.Bytes(), "image/png", nil
+		}
+		buf.Reset()
+	}
+
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, "", NewImageFormatError("image/jpeg", "cannot be encoded", err)
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
@@ -0,0 +1,201 @@
+package types
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// noisyPNG encodes a width by height PNG of random pixels, which compresses
+// poorly and so is large for its dimensions.
+func noisyPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.UintN(256))
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sentImage decodes the image in a block built by NewImageContent.
+func sentImage(t *testing.T, block UserContentBlock) (image.Image, string) {
+	t.Helper()
+	source := block.(*ImageContent).Source
+	data, err := base64.StdEncoding.DecodeString(source.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("sent image does not decode: %v", err)
+	}
+	if "image/"+format != source.MediaType {
+		t.Errorf("sent %s data labeled %s", format, source.MediaType)
+	}
+	return img, source.MediaType
+}
+
+// hugePNG returns a PNG whose header claims width by height pixels, with the
+// pixel data of a 1x1 image: enough for image.DecodeConfig, but not for
+// image.Decode.
+func hugePNG(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// The IHDR chunk follows the 8-byte signature: length, type, data, CRC
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+// TestNewImageContent tests the limits on image data, downscaling and
+// re-encoding images over them, and the errors for unsupported formats.
+func TestNewImageContent(t *testing.T) {
+	oversized := noisyPNG(t, 1200, 900)
+
+	t.Run("within limits", func(t *testing.T) {
+		data := noisyPNG(t, 40, 30)
+		block, info, err := NewImageContent("", data, ImageOptions{Downscale: true})
+		if err != nil {
+			t.Fatalf("NewImageContent failed: %v", err)
+		}
+		if block.(*ImageContent).Source.Data != base64.StdEncoding.EncodeToString(data) {
+			t.Error("image within the limits was changed")
+		}
+		if info.Transformed() || info.MediaType != "image/png" || info.Width != 40 || info.Height != 30 || info.Bytes != len(data) {
+			t.Errorf("info = %+v, want the untouched 40x30 PNG", info)
+		}
+	})
+
+	t.Run("oversized without downscaling", func(t *testing.T) {
+		_, _, err := NewImageContent("image/png", oversized, ImageOptions{MaxDimension: 500})
+		tooLarge, ok := err.(*ImageTooLargeError)
+		if !ok || tooLarge.Width != 1200 || tooLarge.Height != 900 || tooLarge.MaxDimension != 500 {
+			t.Fatalf("error = %v, want an ImageTooLargeError for 1200x900 pixels", err)
+		}
+		if !strings.Contains(err.Error(), "1200x900 pixels") {
+			t.Errorf("error %q does not give the dimensions", err)
+		}
+
+		_, _, err = NewImageContent("image/png", oversized, ImageOptions{MaxBytes: 100_000})
+		if tooLarge, ok := err.(*ImageTooLargeError); !ok || tooLarge.Size != int64(len(oversized)) || tooLarge.Limit != 100_000 || tooLarge.MaxDimension != 0 {
+			t.Errorf("error = %v, want an ImageTooLargeError for %d bytes", err, len(oversized))
+		}
+	})
+
+	t.Run("downscaled to fit the dimension limit", func(t *testing.T) {
+		block, info, err := NewImageContent("image/png", oversized, ImageOptions{MaxDimension: 300, Downscale: true})
+		if err != nil {
+			t.Fatalf("NewImageContent failed: %v", err)
+		}
+		img, mediaType := sentImage(t, block)
+		if size := img.Bounds().Size(); size.X != 300 || size.Y != 225 || mediaType != "image/png" {
+			t.Errorf("sent %dx%d %s, want a 300x225 PNG", size.X, size.Y, mediaType)
+		}
+		want := ImageInfo{
+			MediaType: "image/png", Width: 300, Height: 225, Bytes: info.Bytes,
+			OriginalMediaType: "image/png", OriginalWidth: 1200, OriginalHeight: 900, OriginalBytes: len(oversized),
+			Resized: true, Reencoded: true,
+		}
+		if *info != want {
+			t.Errorf("info = %+v, want %+v", *info, want)
+		}
+	})
+
+	t.Run("re-encoded as JPEG to fit the byte limit", func(t *testing.T) {
+		block, info, err := NewImageContent("image/png", oversized, ImageOptions{MaxBytes: 100_000, Downscale: true, JPEGQuality: 60})
+		if err != nil {
+			t.Fatalf("NewImageContent failed: %v", err)
+		}
+		_, mediaType := sentImage(t, block)
+		if mediaType != "image/jpeg" || info.MediaType != "image/jpeg" || info.Bytes > 100_000 || !info.Reencoded {
+			t.Errorf("sent %s, info %+v; want a JPEG of at most 100000 bytes", mediaType, info)
+		}
+	})
+
+	t.Run("transparency flattened onto white", func(t *testing.T) {
+		img := image.NewNRGBA(image.Rect(0, 0, 64, 64)) // Fully transparent
+		encoded, mediaType, err := encodeImage(img, "image/png", DefaultJPEGQuality, 1)
+		if err != nil || mediaType != "image/jpeg" {
+			t.Fatalf("encodeImage = %s, %v; want a JPEG", mediaType, err)
+		}
+		decoded, _, err := image.Decode(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, g, b, _ := decoded.At(32, 32).RGBA(); min(r, g, b) < 0xf000 {
+			t.Errorf("transparent pixel encoded as %v, want white", decoded.At(32, 32))
+		}
+	})
+
+	t.Run("too many pixels to downscale", func(t *testing.T) {
+		data := hugePNG(t, 100_000, 100_000)
+		_, _, err := NewImageContent("", data, ImageOptions{Downscale: true})
+		var tooLarge *ImageTooLargeError
+		if !errors.As(err, &tooLarge) || tooLarge.Width != 100_000 || tooLarge.Height != 100_000 {
+			t.Errorf("error = %v, want an ImageTooLargeError for 100000x100000 pixels", err)
+		}
+	})
+
+	t.Run("scaling averages the covered pixels", func(t *testing.T) {
+		// A gray image whose bounds do not start at the origin
+		src := image.NewGray(image.Rect(10, 20, 14, 22))
+		copy(src.Pix, []uint8{0, 100, 200, 200, 50, 150, 0, 0})
+		scaled := scaleImage(src, 2, 1)
+		for x, want := range []uint8{75, 100} {
+			if got := scaled.RGBAAt(x, 0); got.R != want || got.G != want || got.B != want || got.A != 0xff {
+				t.Errorf("pixel %d = %v, want gray %d", x, got, want)
+			}
+		}
+	})
+
+	t.Run("unsupported formats", func(t *testing.T) {
+		webp := append([]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), make([]byte, 200)...)
+		tests := []struct {
+			name      string
+			mediaType string
+			data      []byte
+			opts      ImageOptions
+		}{
+			{"not an image", "", []byte("plain text"), ImageOptions{}},
+			{"unsupported media type", "image/bmp", []byte("BM"), ImageOptions{}},
+			{"corrupt PNG", "", []byte("\x89PNG\r\n\x1a\nnot really"), ImageOptions{}},
+			{"webp needing downscaling", "", webp, ImageOptions{MaxBytes: 100, Downscale: true}},
+		}
+		for _, tt := range tests {
+			if _, _, err := NewImageContent(tt.mediaType, tt.data, tt.opts); !IsImageFormatError(err) {
+				t.Errorf("%s: error = %v, want ImageFormatError", tt.name, err)
+			}
+		}
+
+		// Only the byte limit applies to webp otherwise
+		if _, info, err := NewImageContent("", webp, ImageOptions{}); err != nil || info.MediaType != "image/webp" {
+			t.Errorf("small webp: got %+v, %v; want it sent as is", info, err)
+		}
+		if _, _, err := NewImageContent("", webp, ImageOptions{MaxBytes: 100}); !IsImageTooLargeError(err) {
+			t.Errorf("large webp without downscaling: error = %v, want ImageTooLargeError", err)
+		}
+		if _, _, err := NewImageContent("image/png", oversized, ImageOptions{JPEGQuality: 101}); !IsValidationError(err) {
+			t.Errorf("JPEG quality 101: error = %v, want ValidationError", err)
+		}
+	})
+}
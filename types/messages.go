@@ -1,6 +1,7 @@
 package types
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
@@ -14,6 +15,27 @@ const (
 	SystemSubtypeDebug       = "debug"
 	SystemSubtypeSessionEnd  = "session_end"
 	SystemSubtypeSessionInfo = "session_info"
+
+	// SystemSubtypeAutoContinue is emitted by the SDK, not the CLI, each time it
+	// continues a truncated answer (see ClaudeAgentOptions.AutoContinueOnTruncation).
+	// Data holds "attempt", "max_continues" and "session_id".
+	SystemSubtypeAutoContinue = "auto_continue"
+
+	// SystemSubtypeReconnected is emitted by the SDK, not the CLI, when it
+	// replaced a CLI subprocess that exited unexpectedly (see
+	// ClaudeAgentOptions.AutoReconnectAttempts). Messages of the turn in
+	// progress may have been lost. Data holds "attempt", "session_id" and "reason".
+	SystemSubtypeReconnected = "reconnected"
+)
+
+const (
+	// StopReasonMaxTokens is the stop reason of an assistant message whose
+	// answer was cut off by the output token limit.
+	StopReasonMaxTokens = "max_tokens"
+
+	// StopReasonRefusal is the stop reason of an assistant message in which the
+	// model declined the request for safety reasons.
+	StopReasonRefusal = "refusal"
 )
 
 // ContentBlock is an interface for all content block types.
@@ -132,6 +154,7 @@ type UserMessage struct {
 	Type            string      `json:"type"`
 	Content         interface{} `json:"content"` // Can be string or []ContentBlock
 	ParentToolUseID *string     `json:"parent_tool_use_id,omitempty"`
+	SessionID       string      `json:"session_id,omitempty"`
 }
 
 // GetMessageType returns the type of the message.
@@ -139,6 +162,12 @@ func (m *UserMessage) GetMessageType() string {
 	return m.Type
 }
 
+// IsReconnected returns true if the SDK emitted this message after reconnecting
+// to a new CLI subprocess.
+func (m *SystemMessage) IsReconnected() bool {
+	return m.Subtype == SystemSubtypeReconnected
+}
+
 // ShouldDisplayToUser returns true for user messages (always display).
 func (m *UserMessage) ShouldDisplayToUser() bool {
 	return true
@@ -146,6 +175,21 @@ func (m *UserMessage) ShouldDisplayToUser() bool {
 
 func (m *UserMessage) isMessage() {}
 
+// HasToolResults returns true if the message content contains at least one tool result block.
+// Plain echoes of a text prompt return false.
+func (m *UserMessage) HasToolResults() bool {
+	blocks, ok := m.Content.([]ContentBlock)
+	if !ok {
+		return false
+	}
+	for _, block := range blocks {
+		if _, isResult := block.(*ToolResultBlock); isResult {
+			return true
+		}
+	}
+	return false
+}
+
 // UnmarshalJSON implements custom unmarshaling for UserMessage to handle content union type.
 func (m *UserMessage) UnmarshalJSON(data []byte) error {
 	type Alias UserMessage
@@ -218,6 +262,13 @@ type AssistantMessage struct {
 	Content         []ContentBlock `json:"content"`
 	Model           string         `json:"model"`
 	ParentToolUseID *string        `json:"parent_tool_use_id,omitempty"`
+	StopReason      string         `json:"stop_reason,omitempty"` // e.g. "end_turn", "tool_use", "max_tokens"
+	SessionID       string         `json:"session_id,omitempty"`
+
+	// envelope holds the fields of the CLI format's nested "message" object
+	// other than those above, such as id and usage, so that MarshalJSON can
+	// reproduce it. It is nil for messages in the flat SDK form.
+	envelope map[string]json.RawMessage
 }
 
 // GetMessageType returns the type of the message.
@@ -250,20 +301,38 @@ func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
 	var contentBlocks []json.RawMessage
 
 	// Check if content is in nested message.content (Claude CLI format)
+	m.envelope = nil
 	if aux.Message != nil {
+		m.envelope = make(map[string]json.RawMessage, len(aux.Message))
+		for key, raw := range aux.Message {
+			if key == "content" || key == "model" || key == "stop_reason" {
+				continue // Held in the struct fields
+			}
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, raw); err != nil {
+				return err
+			}
+			m.envelope[key] = compacted.Bytes()
+		}
 		if contentRaw, ok := aux.Message["content"]; ok {
 			var nested []json.RawMessage
 			if err := json.Unmarshal(contentRaw, &nested); err == nil {
 				contentBlocks = nested
 			}
 		}
-		// Also extract model from nested message if present
+		// Also extract model and stop reason from nested message if present
 		if modelRaw, ok := aux.Message["model"]; ok {
 			var model string
 			if err := json.Unmarshal(modelRaw, &model); err == nil {
 				m.Model = model
 			}
 		}
+		if stopRaw, ok := aux.Message["stop_reason"]; ok {
+			var stopReason string
+			if err := json.Unmarshal(stopRaw, &stopReason); err == nil {
+				m.StopReason = stopReason
+			}
+		}
 	}
 
 	// Fall back to top-level content if nested not found
@@ -284,13 +353,65 @@ func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// IsTruncated returns true if the answer was cut off by the output token limit.
+func (m *AssistantMessage) IsTruncated() bool {
+	return m.StopReason == StopReasonMaxTokens
+}
+
+// IsRefusal returns true if the model stopped because it declined the request.
+// Refusals without this stop reason are found by DetectRefusal.
+func (m *AssistantMessage) IsRefusal() bool {
+	return m.StopReason == StopReasonRefusal
+}
+
+// Usage returns the token usage of the model response (input_tokens,
+// output_tokens, ...) from the CLI's nested message format, or nil when the
+// message does not carry it.
+func (m *AssistantMessage) Usage() map[string]interface{} {
+	raw, ok := m.envelope["usage"]
+	if !ok {
+		return nil
+	}
+	var usage map[string]interface{}
+	if err := json.Unmarshal(raw, &usage); err != nil {
+		return nil
+	}
+	return usage
+}
+
 // MarshalJSON implements custom marshaling for AssistantMessage to handle content blocks.
+// A message parsed from the CLI's nested format is marshaled back into it, with
+// the content, model and stop reason taken from the struct and the remaining
+// envelope fields as they were received; otherwise the flat SDK form is used.
 func (m *AssistantMessage) MarshalJSON() ([]byte, error) {
 	type Alias AssistantMessage
+	if m.envelope == nil {
+		return json.Marshal(&struct {
+			*Alias
+		}{
+			Alias: (*Alias)(m),
+		})
+	}
+
+	message := make(map[string]interface{}, len(m.envelope)+3)
+	for key, raw := range m.envelope {
+		message[key] = raw
+	}
+	message["content"] = m.Content
+	message["model"] = m.Model
+	if m.StopReason != "" {
+		message["stop_reason"] = m.StopReason
+	}
 	return json.Marshal(&struct {
-		*Alias
+		Type            string                 `json:"type"`
+		Message         map[string]interface{} `json:"message"`
+		ParentToolUseID *string                `json:"parent_tool_use_id,omitempty"`
+		SessionID       string                 `json:"session_id,omitempty"`
 	}{
-		Alias: (*Alias)(m),
+		Type:            m.Type,
+		Message:         message,
+		ParentToolUseID: m.ParentToolUseID,
+		SessionID:       m.SessionID,
 	})
 }
 
@@ -302,6 +423,10 @@ type SystemMessage struct {
 	Response  map[string]interface{} `json:"response,omitempty"`   // For control_response messages
 	Request   map[string]interface{} `json:"request,omitempty"`    // For control_request messages
 	RequestID string                 `json:"request_id,omitempty"` // For control_request/control_response messages (top-level field)
+	SessionID string                 `json:"session_id,omitempty"` // Set on init messages
+
+	PermissionMode PermissionMode `json:"permissionMode,omitempty"` // Set on init messages
+	SlashCommands  []string       `json:"slash_commands,omitempty"` // Set on init messages: the names of the available slash commands
 }
 
 // GetMessageType returns the type of the message.
@@ -336,6 +461,12 @@ func (m *SystemMessage) IsDebug() bool {
 	return m.Subtype == SystemSubtypeDebug
 }
 
+// IsAutoContinue returns true if the SDK emitted this message when it continued a
+// truncated answer.
+func (m *SystemMessage) IsAutoContinue() bool {
+	return m.Subtype == SystemSubtypeAutoContinue
+}
+
 // ShouldDisplayToUser returns true if this system message should be shown to the user.
 // By default, init and debug messages are not shown to users.
 func (m *SystemMessage) ShouldDisplayToUser() bool {
@@ -354,6 +485,46 @@ type ResultMessage struct {
 	TotalCostUSD  *float64               `json:"total_cost_usd,omitempty"`
 	Usage         map[string]interface{} `json:"usage,omitempty"`
 	Result        *string                `json:"result,omitempty"`
+
+	// Meta holds SDK-side annotations about how this result was produced.
+	// It is never sent by the CLI and is not marshaled.
+	Meta *ResultMeta `json:"-"`
+}
+
+// ResultMeta carries SDK-side annotations attached to a ResultMessage.
+type ResultMeta struct {
+	Model     string // Model that produced the result (set when model fallbacks are configured)
+	Fallbacks int    // Number of fallback models tried before this result
+
+	// InterruptedByUser is set when an interrupt control request, sent by
+	// Client.Interrupt or by the CLI on behalf of another surface such as an
+	// IDE, preceded the result: the turn ended because it was interrupted.
+	InterruptedByUser bool
+
+	// TurnLimitedBySDK is set on an error_max_turns result synthesized by the
+	// SDK, which enforces MaxTurns itself for CLIs that cannot (see CLIProfile).
+	TurnLimitedBySDK bool
+
+	// Blocks of the turn's assistant messages left out of the text returned
+	// by Client.ReceiveText and QueryText, which set these counts
+	ToolUses       int
+	ThinkingBlocks int
+}
+
+// QueryResult is the whole response to a one-shot query, as returned by
+// claude.QueryCollect.
+type QueryResult struct {
+	Messages     []Message      // Every message received, in order, the result included
+	Text         string         // The TextBlocks of every AssistantMessage, concatenated
+	Result       *ResultMessage // The final result; nil if the stream ended before it
+	TotalCostUSD float64        // The result's cost; 0 without a result or when the CLI reports none
+	SessionID    string         // The result's session, or else that of the last message naming one
+}
+
+// IsInterrupted reports whether the result ended a turn that was interrupted
+// by the user. See ResultMeta.InterruptedByUser.
+func (m *ResultMessage) IsInterrupted() bool {
+	return m.Meta != nil && m.Meta.InterruptedByUser
 }
 
 // GetMessageType returns the type of the message.
@@ -389,6 +560,60 @@ func (m *StreamEvent) ShouldDisplayToUser() bool {
 
 func (m *StreamEvent) isMessage() {}
 
+// ErrorMessage reports an error reading the CLI's output in the message stream
+// itself, so that a consumer ranging over a channel sees it where it happened.
+// It is created by the SDK, never sent by the CLI, and is delivered:
+//   - in place of a line that is not valid JSON; the stream continues
+//   - when the CLI's output cannot be read any further, e.g. a line exceeds
+//     the buffer size
+//   - as the last message when the CLI's output ends before the turn's result,
+//     e.g. because the CLI died; Err is then a *CLIConnectionError wrapping the
+//     transport's error, if any
+//
+// An ErrorMessage is itself an error wrapping Err, so errors.As works on it.
+type ErrorMessage struct {
+	Type string `json:"type"` // Always "error"
+	Err  error  `json:"-"`
+}
+
+// NewErrorMessage creates an ErrorMessage carrying err.
+func NewErrorMessage(err error) *ErrorMessage {
+	return &ErrorMessage{Type: "error", Err: err}
+}
+
+// GetMessageType returns the type of the message.
+func (m *ErrorMessage) GetMessageType() string {
+	return m.Type
+}
+
+// ShouldDisplayToUser returns false for error messages (not conversation content).
+func (m *ErrorMessage) ShouldDisplayToUser() bool {
+	return false
+}
+
+func (m *ErrorMessage) isMessage() {}
+
+// Error returns the message of Err.
+func (m *ErrorMessage) Error() string {
+	if m.Err == nil {
+		return "unknown error"
+	}
+	return m.Err.Error()
+}
+
+// Unwrap returns Err.
+func (m *ErrorMessage) Unwrap() error {
+	return m.Err
+}
+
+// MarshalJSON encodes the message with Err as its text, for logs and transcripts.
+func (m *ErrorMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string `json:"type"`
+		Error string `json:"error"`
+	}{Type: m.Type, Error: m.Error()})
+}
+
 // UnmarshalMessage unmarshals a JSON message into the appropriate message type.
 func UnmarshalMessage(data []byte) (Message, error) {
 	var typeCheck struct {
@@ -434,3 +659,25 @@ func UnmarshalMessage(data []byte) (Message, error) {
 		return nil, NewMessageParseErrorWithType("unknown message type", typeCheck.Type)
 	}
 }
+
+// MessageSessionID returns the session a message belongs to, or "" if it
+// carries no session ID, as with some system messages.
+func MessageSessionID(msg Message) string {
+	switch m := msg.(type) {
+	case *AssistantMessage:
+		return m.SessionID
+	case *UserMessage:
+		return m.SessionID
+	case *SystemMessage:
+		if m.SessionID != "" {
+			return m.SessionID
+		}
+		id, _ := m.Data["session_id"].(string)
+		return id
+	case *ResultMessage:
+		return m.SessionID
+	case *StreamEvent:
+		return m.SessionID
+	}
+	return ""
+}
@@ -2,6 +2,8 @@ package types
 
 import (
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -191,6 +193,32 @@ func TestUserMessageMarshaling(t *testing.T) {
 	})
 }
 
+// TestUserMessageHasToolResults tests classification of echoed user messages.
+func TestUserMessageHasToolResults(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want bool
+	}{
+		{"string content", `{"type":"user","content":"hello"}`, false},
+		{"text blocks only", `{"type":"user","content":[{"type":"text","text":"hi"}]}`, false},
+		{"tool result", `{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"ok"}]}}`, true},
+		{"mixed blocks", `{"type":"user","content":[{"type":"text","text":"see"},{"type":"tool_result","tool_use_id":"toolu_2"}]}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := UnmarshalMessage([]byte(tt.json))
+			if err != nil {
+				t.Fatalf("UnmarshalMessage failed: %v", err)
+			}
+			if got := msg.(*UserMessage).HasToolResults(); got != tt.want {
+				t.Errorf("HasToolResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 // TestResultMessageMarshaling tests JSON marshaling/unmarshaling of ResultMessage.
 func TestResultMessageMarshaling(t *testing.T) {
 	costUSD := 0.05
@@ -224,3 +252,90 @@ func TestResultMessageMarshaling(t *testing.T) {
 		t.Errorf("total cost doesn't match")
 	}
 }
+
+// TestSystemMessageInitSessionID tests that the session ID of an init message is captured.
+func TestSystemMessageInitSessionID(t *testing.T) {
+	msg, err := UnmarshalMessage([]byte(`{"type":"system","subtype":"init","session_id":"s-123","tools":["Bash"]}`))
+	if err != nil {
+		t.Fatalf("UnmarshalMessage failed: %v", err)
+	}
+	sys, ok := msg.(*SystemMessage)
+	if !ok || !sys.IsInit() {
+		t.Fatalf("expected init SystemMessage, got %#v", msg)
+	}
+	if sys.SessionID != "s-123" {
+		t.Errorf("SessionID = %q, want s-123", sys.SessionID)
+	}
+}
+
+// TestAssistantMessageStopReason tests that the stop reason is read from the
+// CLI's nested message format and marks truncated answers.
+func TestAssistantMessageStopReason(t *testing.T) {
+	for stopReason, truncated := range map[string]bool{"max_tokens": true, "end_turn": false, "": false} {
+		data := `{"type":"assistant","message":{"model":"m","stop_reason":"` + stopReason + `","content":[{"type":"text","text":"hi"}]}}`
+		var msg AssistantMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if msg.StopReason != stopReason || msg.IsTruncated() != truncated {
+			t.Errorf("stop_reason %q: got StopReason %q, IsTruncated %v", stopReason, msg.StopReason, msg.IsTruncated())
+		}
+	}
+}
+
+// TestAssistantMessageRoundTrip tests that marshaled assistant messages parse
+// back unchanged in both the CLI's nested format and the flat SDK form.
+func TestAssistantMessageRoundTrip(t *testing.T) {
+	for name, data := range map[string]string{
+		"nested": `{"type":"assistant","parent_tool_use_id":"toolu_0","message":{"id":"msg_01","type":"message","role":"assistant",` +
+			`"model":"claude-sonnet-4-5","stop_reason":"tool_use","usage":{"input_tokens":12,"output_tokens":30},` +
+			`"content":[{"type":"thinking","thinking":"check","signature":"sig"},{"type":"text","text":"Reading."},` +
+			`{"type":"tool_use","id":"toolu_1","name":"Read","input":{"file_path":"go.mod"}}]}}`,
+		"flat": `{"type":"assistant","model":"claude-sonnet-4-5","stop_reason":"end_turn","content":[{"type":"text","text":"Done."}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := UnmarshalMessage([]byte(data))
+			if err != nil {
+				t.Fatalf("UnmarshalMessage failed: %v", err)
+			}
+			marshaled, err := json.Marshal(parsed)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			reparsed, err := UnmarshalMessage(marshaled)
+			if err != nil {
+				t.Fatalf("UnmarshalMessage of marshaled message failed: %v\n%s", err, marshaled)
+			}
+			if !reflect.DeepEqual(parsed, reparsed) {
+				t.Errorf("round trip changed the message:\nparsed:   %+v\nreparsed: %+v", parsed, reparsed)
+			}
+
+			var shape map[string]json.RawMessage
+			if err := json.Unmarshal(marshaled, &shape); err != nil {
+				t.Fatal(err)
+			}
+			_, nested := shape["message"]
+			if nested != (name == "nested") {
+				t.Errorf("marshaled shape changed: %s", marshaled)
+			}
+		})
+	}
+
+	t.Run("envelope fields kept", func(t *testing.T) {
+		var msg AssistantMessage
+		data := `{"type":"assistant","message":{"id":"msg_01","usage":{"output_tokens":30},"model":"m","content":[]}}`
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatal(err)
+		}
+		msg.StopReason = StopReasonMaxTokens
+		marshaled, err := json.Marshal(&msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{`"id":"msg_01"`, `"usage":{"output_tokens":30}`, `"stop_reason":"max_tokens"`} {
+			if !strings.Contains(string(marshaled), want) {
+				t.Errorf("marshaled message %s is missing %s", marshaled, want)
+			}
+		}
+	})
+}
@@ -2,7 +2,13 @@ package types
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+	"unicode"
 )
 
 // SettingSource represents where settings are loaded from.
@@ -14,6 +20,79 @@ const (
 	SettingSourceLocal   SettingSource = "local"
 )
 
+// IsValid reports whether s is one of the setting sources known to the CLI.
+func (s SettingSource) IsValid() bool {
+	switch s {
+	case SettingSourceUser, SettingSourceProject, SettingSourceLocal:
+		return true
+	}
+	return false
+}
+
+// EchoedUserMessagePolicy controls which UserMessages echoed back by the CLI are delivered.
+type EchoedUserMessagePolicy string
+
+const (
+	// EchoedUserMessagesInclude delivers every echoed UserMessage (default).
+	EchoedUserMessagesInclude EchoedUserMessagePolicy = "include"
+	// EchoedUserMessagesToolResultsOnly delivers only UserMessages carrying tool results.
+	EchoedUserMessagesToolResultsOnly EchoedUserMessagePolicy = "tool_results_only"
+	// EchoedUserMessagesExclude drops every echoed UserMessage.
+	EchoedUserMessagesExclude EchoedUserMessagePolicy = "exclude"
+)
+
+// IsValid reports whether p is a known policy or empty, the default.
+func (p EchoedUserMessagePolicy) IsValid() bool {
+	switch p {
+	case "", EchoedUserMessagesInclude, EchoedUserMessagesToolResultsOnly, EchoedUserMessagesExclude:
+		return true
+	}
+	return false
+}
+
+// CLIProfile selects the command-line flags the SDK uses for a CLI major version.
+type CLIProfile string
+
+const (
+	// CLIProfileAuto selects the profile from the CLI version detected during discovery (default).
+	CLIProfileAuto CLIProfile = ""
+	// CLIProfileV1 targets 1.x CLIs, which lack several flags the SDK emits.
+	CLIProfileV1 CLIProfile = "1.x"
+	// CLIProfileV2 targets 2.x CLIs.
+	CLIProfileV2 CLIProfile = "2.x"
+)
+
+// IsValid reports whether p is a known profile or CLIProfileAuto.
+func (p CLIProfile) IsValid() bool {
+	switch p {
+	case CLIProfileAuto, CLIProfileV1, CLIProfileV2:
+		return true
+	}
+	return false
+}
+
+// SessionLockMode selects how a resumed session is protected against being
+// resumed by another client at the same time. See WithSessionLocking.
+type SessionLockMode string
+
+const (
+	// SessionLockOff takes no lock (default).
+	SessionLockOff SessionLockMode = ""
+	// SessionLockBlock waits for the session to be released.
+	SessionLockBlock SessionLockMode = "block"
+	// SessionLockFail fails with a *SessionLockedError while another client holds the session.
+	SessionLockFail SessionLockMode = "fail"
+)
+
+// IsValid reports whether m is a known mode or SessionLockOff.
+func (m SessionLockMode) IsValid() bool {
+	switch m {
+	case SessionLockOff, SessionLockBlock, SessionLockFail:
+		return true
+	}
+	return false
+}
+
 // SystemPromptPreset represents a preset system prompt configuration.
 type SystemPromptPreset struct {
 	Type   string  `json:"type"`   // "preset"
@@ -21,12 +100,25 @@ type SystemPromptPreset struct {
 	Append *string `json:"append,omitempty"`
 }
 
-// AgentDefinition represents a custom agent definition.
+// Validate reports whether the preset is one the CLI supports. Only the
+// "claude_code" preset exists; Type may be left empty.
+func (p SystemPromptPreset) Validate() error {
+	if p.Type != "" && p.Type != "preset" {
+		return NewValidationError("system_prompt", fmt.Sprintf("preset type must be %q, got %q", "preset", p.Type))
+	}
+	if p.Preset != "claude_code" {
+		return NewValidationError("system_prompt", fmt.Sprintf("unknown preset %q; only %q is supported", p.Preset, "claude_code"))
+	}
+	return nil
+}
+
+// AgentDefinition represents a custom agent definition. Build one with
+// NewAgentDefinition or load them with LoadAgentDefinitions.
 type AgentDefinition struct {
 	Description string   `json:"description"`
 	Prompt      string   `json:"prompt"`
 	Tools       []string `json:"tools,omitempty"`
-	Model       *string  `json:"model,omitempty"` // "sonnet", "opus", "haiku", "inherit"
+	Model       *string  `json:"model,omitempty"` // One of the AgentModel constants
 }
 
 // PluginConfig represents a Claude Code plugin configuration.
@@ -36,6 +128,20 @@ type PluginConfig struct {
 	Path string `json:"path"` // Absolute or relative path to plugin directory
 }
 
+// ProxyConfig routes the CLI subprocess through a proxy. It only affects the
+// subprocess environment, never that of the calling process.
+type ProxyConfig struct {
+	HTTPProxy       string `json:"http_proxy,omitempty"`         // HTTP_PROXY
+	HTTPSProxy      string `json:"https_proxy,omitempty"`        // HTTPS_PROXY
+	NoProxy         string `json:"no_proxy,omitempty"`           // NO_PROXY
+	ExtraCACertPath string `json:"extra_ca_cert_path,omitempty"` // PEM file of extra trusted CAs (NODE_EXTRA_CA_CERTS)
+
+	// KeepInherited keeps proxy and CA variables of the parent environment
+	// that are not set here. By default they are removed, so the subprocess
+	// sees exactly this configuration.
+	KeepInherited bool `json:"keep_inherited,omitempty"`
+}
+
 // NewPluginConfig creates a new PluginConfig with validation.
 // Returns an error if the plugin type is not supported or path is empty.
 func NewPluginConfig(pluginType, path string) (*PluginConfig, error) {
@@ -106,16 +212,74 @@ type HookMatcher struct {
 // StderrCallbackFunc is a callback function for stderr output from the CLI.
 type StderrCallbackFunc func(line string)
 
+// DisconnectCallbackFunc is called when a Client's connection to the CLI ends
+// other than by Close. err is nil when the CLI exited cleanly, and otherwise
+// says how it ended, typically a *ProcessError with the exit code.
+type DisconnectCallbackFunc func(err error)
+
+// LateMessageFunc receives a message the CLI sent after a Client turn's
+// ResultMessage but before the next turn's first message, such as trailing
+// telemetry or session info. Such messages belong to the finished turn, so
+// they are handed here instead of opening the next turn's response.
+type LateMessageFunc func(msg Message)
+
+// ControlObserverFunc observes control protocol traffic in both directions.
+// The subtype is the request subtype (e.g. "initialize", "can_use_tool") for requests
+// and "success" or "error" for responses. The payload is a deep copy of the full
+// control message, so observers may keep or modify it freely.
+//
+// Observers run on a dedicated goroutine fed by a bounded queue; events are dropped
+// rather than blocking message routing when the observer falls behind, and
+// counted by Client.DroppedControlEvents.
+type ControlObserverFunc func(direction Direction, subtype string, payload map[string]interface{})
+
+// SubagentEventKind distinguishes the events of a subagent's lifecycle.
+type SubagentEventKind string
+
+const (
+	SubagentStarted  SubagentEventKind = "started"  // The Task tool was called
+	SubagentFinished SubagentEventKind = "finished" // The Task tool returned, or the turn ended first
+)
+
+// SubagentEvent describes a subagent started through the Task tool starting or
+// finishing. Events are derived from the message stream: the Task tool use
+// starts a subagent, messages with its tool use ID as parent_tool_use_id are
+// its own output, and the matching tool result finishes it.
+type SubagentEvent struct {
+	Kind        SubagentEventKind
+	ToolUseID   string // ID of the Task tool use, the parent_tool_use_id of the subagent's messages
+	AgentType   string // subagent_type from the Task input
+	Description string // description from the Task input
+	Prompt      string // prompt from the Task input
+	StartedAt   time.Time
+
+	// Set on SubagentFinished only
+	Duration     time.Duration
+	Result       *ToolResultBlock // The Task tool result; nil if the turn ended before it arrived
+	IsError      bool             // The result is an error, or never arrived
+	Messages     int              // Assistant messages produced by the subagent
+	InputTokens  int              // Input tokens of the subagent's messages, when the CLI reports usage
+	OutputTokens int              // Output tokens of the subagent's messages, when the CLI reports usage
+}
+
+// SubagentObserverFunc receives subagent lifecycle events. It is called on the
+// message routing goroutine, in stream order and before the triggering message
+// is delivered, so it must return quickly.
+type SubagentObserverFunc func(event SubagentEvent)
+
 // ClaudeAgentOptions represents configuration options for the Claude SDK.
 type ClaudeAgentOptions struct {
 	// Tool configuration
-	AllowedTools    []string `json:"allowed_tools,omitempty"`
-	DisallowedTools []string `json:"disallowed_tools,omitempty"`
+	AllowedTools    []string          `json:"allowed_tools,omitempty"`
+	DisallowedTools []string          `json:"disallowed_tools,omitempty"`
+	ToolAliases     map[string]string `json:"tool_aliases,omitempty"` // Alias -> canonical tool name, applied on top of DefaultToolAliases
 
-	// System prompt - can be string or SystemPromptPreset
+	// System prompt - can be string, SystemPromptPreset or *SystemPromptPreset
 	SystemPrompt interface{} `json:"system_prompt,omitempty"`
 
-	// MCP servers - can be map[string]interface{} (config), string (path), or actual path
+	// MCP servers - a path to an MCP config file (string), or a map[string]interface{}
+	// of server name to McpStdioServerConfig, McpSSEServerConfig, McpHTTPServerConfig,
+	// McpSdkServerConfig, or a raw config map
 	McpServers interface{} `json:"mcp_servers,omitempty"`
 
 	// Permission configuration
@@ -137,8 +301,11 @@ type ClaudeAgentOptions struct {
 	Resume               *string `json:"resume,omitempty"`
 	ForkSession          bool    `json:"fork_session,omitempty"`
 
+	SessionLocking SessionLockMode `json:"session_locking,omitempty"` // Lock a resumed session against concurrent resumption
+
 	// Model and execution limits
 	Model             *string  `json:"model,omitempty"`
+	ModelFallbacks    []string `json:"model_fallbacks,omitempty"` // Models to retry with when the model is overloaded or unavailable
 	MaxTurns          *int     `json:"max_turns,omitempty"`
 	MaxThinkingTokens *int     `json:"max_thinking_tokens,omitempty"` // Maximum tokens for extended thinking
 	MaxBudgetUSD      *float64 `json:"max_budget_usd,omitempty"`      // Maximum budget in USD for this query
@@ -146,14 +313,26 @@ type ClaudeAgentOptions struct {
 	// API configuration
 	BaseURL *string `json:"base_url,omitempty"` // Custom Anthropic API base URL (ANTHROPIC_BASE_URL)
 
+	// Proxy for the CLI subprocess only; nil leaves the inherited environment alone
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+
 	// Working directory and CLI path
-	CWD     *string `json:"cwd,omitempty"`
-	CLIPath *string `json:"cli_path,omitempty"`
+	CWD               *string    `json:"cwd,omitempty"`
+	CLIPath           *string    `json:"cli_path,omitempty"`
+	SkipVersionCheck  bool       `json:"skip_version_check,omitempty"`  // Skip the CLI version check during discovery
+	MinimumCLIVersion *string    `json:"minimum_cli_version,omitempty"` // Required CLI version (default "2.0.0")
+	CLIProfile        CLIProfile `json:"cli_profile,omitempty"`         // Empty selects the profile from the detected version
+
+	// Short-lived environments such as AWS Lambda: Ephemeral keeps every file
+	// the SDK and the CLI write under TempDir (os.TempDir when nil)
+	Ephemeral bool    `json:"ephemeral,omitempty"`
+	TempDir   *string `json:"temp_dir,omitempty"`
 
 	// Settings
-	Settings       *string         `json:"settings,omitempty"`
-	SettingSources []SettingSource `json:"setting_sources,omitempty"`
-	AddDirs        []string        `json:"add_dirs,omitempty"`
+	Settings           *string         `json:"settings,omitempty"`
+	SettingSources     []SettingSource `json:"setting_sources,omitempty"`
+	AddDirs            []string        `json:"add_dirs,omitempty"`
+	SkipMissingAddDirs bool            `json:"skip_missing_add_dirs,omitempty"` // Skip missing AddDirs instead of failing to connect
 
 	// Environment and extra arguments
 	Env       map[string]string  `json:"env,omitempty"`
@@ -162,8 +341,31 @@ type ClaudeAgentOptions struct {
 	// Buffer configuration
 	MaxBufferSize *int `json:"max_buffer_size,omitempty"` // Max bytes when buffering CLI stdout
 
+	// ParserWorkers parses CLI output on this many goroutines, keeping the
+	// original order. 0 or 1 parses on the goroutine reading the output.
+	ParserWorkers int `json:"parser_workers,omitempty"`
+
+	// MaxImageSize limits image files sent with Client.QueryWithImage, in bytes.
+	// 0 means MaxImageBytes, the API's limit.
+	MaxImageSize int64 `json:"max_image_size,omitempty"`
+
+	// MaxImageDimension limits the longest side of those images, in pixels.
+	// 0 means MaxImageDimension, the API's limit.
+	MaxImageDimension int `json:"max_image_dimension,omitempty"`
+
+	// DownscaleImages scales down and re-encodes images over either limit
+	// instead of rejecting them (see NewImageContent), JPEGs at
+	// ImageJPEGQuality (0 means DefaultJPEGQuality).
+	DownscaleImages  bool `json:"downscale_images,omitempty"`
+	ImageJPEGQuality int  `json:"image_jpeg_quality,omitempty"`
+
 	// Streaming configuration
-	IncludePartialMessages bool `json:"include_partial_messages,omitempty"`
+	IncludePartialMessages bool                    `json:"include_partial_messages,omitempty"`
+	EchoedUserMessages     EchoedUserMessagePolicy `json:"echoed_user_messages,omitempty"` // Empty means EchoedUserMessagesInclude
+
+	// Output mirroring
+	StdoutMirror     io.Writer `json:"-"`                            // Receives assistant text as it arrives (nil disables)
+	MirrorToolStatus bool      `json:"mirror_tool_status,omitempty"` // Also write a line per tool call to StdoutMirror
 
 	// User identifier
 	User *string `json:"user,omitempty"`
@@ -174,13 +376,52 @@ type ClaudeAgentOptions struct {
 	// Plugin configurations for custom plugins
 	Plugins []PluginConfig `json:"plugins,omitempty"`
 
+	// Client lifecycle
+	LazyInitialize bool `json:"lazy_initialize,omitempty"` // Defer control protocol initialization to the first query
+	WaitForInit    bool `json:"wait_for_init,omitempty"`   // Make Connect wait for the CLI's system init message
+
+	// Reconnection when the CLI subprocess exits unexpectedly: up to this many
+	// attempts to resume the session in a new subprocess (0 disables), the first
+	// after AutoReconnectBackoff, which doubles after each failed attempt
+	AutoReconnectAttempts int           `json:"auto_reconnect_attempts,omitempty"`
+	AutoReconnectBackoff  time.Duration `json:"auto_reconnect_backoff,omitempty"`
+
+	// Truncated answers: continue an answer cut off by the output token limit
+	// up to this many times per turn (0 disables)
+	AutoContinueOnTruncation int `json:"auto_continue_on_truncation,omitempty"`
+
+	// Response timeout: abort a response after this long without a message (0 disables)
+	QueryTimeout time.Duration `json:"query_timeout,omitempty"`
+
+	// Idle timeout: close a Client unused for this long (0 disables)
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+
+	// Subscriptions: messages a Client.Subscribe channel holds for a reader
+	// that falls behind before it is dropped (0 means 256)
+	SubscriberBuffer int `json:"subscriber_buffer,omitempty"`
+
+	// Scripted conversations (RunScript)
+	ScriptTurnTimeout  time.Duration `json:"script_turn_timeout,omitempty"`   // Per-turn timeout; 0 means no limit
+	AbortScriptOnError bool          `json:"abort_script_on_error,omitempty"` // Stop the script at the first error result
+
+	// Refusal detection (see DetectRefusal)
+	RefusalClassifier RefusalClassifierFunc `json:"-"`                         // Text classifier; nil uses DefaultRefusalClassifier
+	FailOnRefusal     bool                  `json:"fail_on_refusal,omitempty"` // Report refused turns as a *RefusalError
+
 	// Debug and diagnostics
-	Verbose bool `json:"-"` // Enable verbose debug logging
+	Verbose    bool   `json:"-"` // Enable verbose debug logging
+	ConfigFile string `json:"-"` // Project config file applied by claude.LoadProjectOptions, empty if none
 
 	// Callbacks (not marshaled to JSON)
-	CanUseTool CanUseToolFunc              `json:"-"`
-	Hooks      map[HookEvent][]HookMatcher `json:"-"`
-	Stderr     StderrCallbackFunc          `json:"-"`
+	CanUseTool       CanUseToolFunc              `json:"-"`
+	Hooks            map[HookEvent][]HookMatcher `json:"-"`
+	Stderr           StderrCallbackFunc          `json:"-"`
+	OnDisconnect     DisconnectCallbackFunc      `json:"-"` // Called when the CLI exits or its output ends, but not on Close
+	OnLateMessage    LateMessageFunc             `json:"-"` // Receives messages sent after a turn's result (nil drops them)
+	ControlObserver  ControlObserverFunc         `json:"-"` // Observes raw control protocol traffic
+	SubagentObserver SubagentObserverFunc        `json:"-"` // Observes Task-tool subagents starting and finishing
+	SpanSink         SpanSink                    `json:"-"` // Receives tracing spans for turns, tool uses and callbacks
+	ProtocolTrace    ProtocolTracer              `json:"-"` // Receives every raw line exchanged with the CLI
 
 	// Stderr file logging (SDK-managed, configuration-time only)
 	// - nil (default): No file logging
@@ -204,6 +445,210 @@ func NewClaudeAgentOptions() *ClaudeAgentOptions {
 	}
 }
 
+// Clone returns a copy of the options that can be modified without affecting o.
+//
+// Slices and maps are copied (Hooks one level deep, McpServers when it is a map).
+// Pointer fields and callbacks are shared; the With* builders replace pointers
+// rather than writing through them, so builder calls on the clone never affect o.
+func (o *ClaudeAgentOptions) Clone() *ClaudeAgentOptions {
+	if o == nil {
+		return nil
+	}
+
+	c := *o
+	c.AllowedTools = slices.Clone(o.AllowedTools)
+	c.DisallowedTools = slices.Clone(o.DisallowedTools)
+	c.ToolAliases = maps.Clone(o.ToolAliases)
+	c.ModelFallbacks = slices.Clone(o.ModelFallbacks)
+	c.SettingSources = slices.Clone(o.SettingSources)
+	c.AddDirs = slices.Clone(o.AddDirs)
+	c.Env = maps.Clone(o.Env)
+	c.ExtraArgs = maps.Clone(o.ExtraArgs)
+	c.Agents = maps.Clone(o.Agents)
+	c.Plugins = slices.Clone(o.Plugins)
+
+	if servers, ok := o.McpServers.(map[string]interface{}); ok {
+		c.McpServers = maps.Clone(servers)
+	}
+	if o.Hooks != nil {
+		c.Hooks = make(map[HookEvent][]HookMatcher, len(o.Hooks))
+		for event, matchers := range o.Hooks {
+			c.Hooks[event] = slices.Clone(matchers)
+		}
+	}
+	return &c
+}
+
+// BypassesPermissions reports whether tool permission checks are skipped
+// entirely, either by the bypassPermissions mode or by
+// DangerouslySkipPermissions together with its safety switch.
+func (o *ClaudeAgentOptions) BypassesPermissions() bool {
+	if o.PermissionMode != nil && *o.PermissionMode == PermissionModeBypassPermissions {
+		return true
+	}
+	return o.DangerouslySkipPermissions && o.AllowDangerouslySkipPermissions
+}
+
+// PermissionConflicts returns the contradictions among the permission
+// settings, one *ValidationError each: a CanUseTool callback combined with
+// another prompt tool or with bypassed permissions (where it is never
+// consulted), DangerouslySkipPermissions without its safety switch, and tools
+// that are both allowed and disallowed. Validate reports them as violations.
+func (o *ClaudeAgentOptions) PermissionConflicts() []*ValidationError {
+	var conflicts []*ValidationError
+
+	// NewClient sets the prompt tool to "stdio" for CanUseTool, so that value is not a conflict
+	if o.CanUseTool != nil && o.PermissionPromptToolName != nil && *o.PermissionPromptToolName != "stdio" {
+		conflicts = append(conflicts, NewValidationError("can_use_tool", "cannot be combined with permission_prompt_tool_name"))
+	}
+	if o.CanUseTool != nil && o.BypassesPermissions() {
+		conflicts = append(conflicts, NewValidationError("can_use_tool", "is never consulted while permissions are bypassed"))
+	}
+	if o.DangerouslySkipPermissions && !o.AllowDangerouslySkipPermissions {
+		conflicts = append(conflicts, NewValidationError("dangerously_skip_permissions", "requires allow_dangerously_skip_permissions"))
+	}
+	for _, tool := range o.AllowedTools {
+		if slices.Contains(o.DisallowedTools, tool) {
+			conflicts = append(conflicts, NewValidationError("allowed_tools", fmt.Sprintf("%q is also disallowed", tool)))
+		}
+	}
+	return conflicts
+}
+
+// Validate reports configuration errors that can be detected without starting
+// the CLI. NewClient and Query call it before connecting; callers can also use
+// it to check configuration at startup.
+//
+// Every problem found is reported: the error is an *OptionsValidationError
+// holding one *ValidationError per violation, or nil when the options are valid.
+func (o *ClaudeAgentOptions) Validate() error {
+	var violations []*ValidationError
+	add := func(err error) {
+		if err == nil {
+			return
+		}
+		var v *ValidationError
+		if !errors.As(err, &v) {
+			v = NewValidationErrorWithCause("", "invalid option", err)
+		}
+		violations = append(violations, v)
+	}
+
+	switch prompt := o.SystemPrompt.(type) {
+	case nil, string:
+	case SystemPromptPreset:
+		add(prompt.Validate())
+	case *SystemPromptPreset:
+		if prompt == nil {
+			add(NewValidationError("system_prompt", "must not be a nil *SystemPromptPreset"))
+		} else {
+			add(prompt.Validate())
+		}
+	default:
+		add(NewValidationError("system_prompt", fmt.Sprintf("must be a string or SystemPromptPreset, got %T", o.SystemPrompt)))
+	}
+
+	for _, conflict := range o.PermissionConflicts() {
+		add(conflict)
+	}
+	if o.ContinueConversation && o.Resume != nil {
+		add(NewValidationError("continue_conversation", "cannot be combined with resume; use one or the other"))
+	}
+	if o.MaxTurns != nil && *o.MaxTurns < 0 {
+		add(NewValidationError("max_turns", fmt.Sprintf("must not be negative, got %d", *o.MaxTurns)))
+	}
+	if o.AutoContinueOnTruncation < 0 {
+		add(NewValidationError("auto_continue_on_truncation", fmt.Sprintf("must not be negative, got %d", o.AutoContinueOnTruncation)))
+	}
+	if o.AutoReconnectAttempts < 0 {
+		add(NewValidationError("auto_reconnect_attempts", fmt.Sprintf("must not be negative, got %d", o.AutoReconnectAttempts)))
+	}
+	if o.AutoReconnectBackoff < 0 {
+		add(NewValidationError("auto_reconnect_backoff", fmt.Sprintf("must not be negative, got %s", o.AutoReconnectBackoff)))
+	}
+	if o.MaxImageSize < 0 {
+		add(NewValidationError("max_image_size", fmt.Sprintf("must not be negative, got %d", o.MaxImageSize)))
+	}
+	if o.MaxImageDimension < 0 {
+		add(NewValidationError("max_image_dimension", fmt.Sprintf("must not be negative, got %d", o.MaxImageDimension)))
+	}
+	if o.ImageJPEGQuality < 0 || o.ImageJPEGQuality > 100 {
+		add(NewValidationError("image_jpeg_quality", fmt.Sprintf("must be between 1 and 100, got %d", o.ImageJPEGQuality)))
+	}
+	if o.ParserWorkers < 0 {
+		add(NewValidationError("parser_workers", fmt.Sprintf("must not be negative, got %d", o.ParserWorkers)))
+	}
+	if o.QueryTimeout < 0 {
+		add(NewValidationError("query_timeout", fmt.Sprintf("must not be negative, got %s", o.QueryTimeout)))
+	}
+	if o.IdleTimeout < 0 {
+		add(NewValidationError("idle_timeout", fmt.Sprintf("must not be negative, got %s", o.IdleTimeout)))
+	}
+	if o.SubscriberBuffer < 0 {
+		add(NewValidationError("subscriber_buffer", fmt.Sprintf("must not be negative, got %d", o.SubscriberBuffer)))
+	}
+	if o.MaxThinkingTokens != nil && *o.MaxThinkingTokens < 0 {
+		add(NewValidationError("max_thinking_tokens", fmt.Sprintf("must not be negative, got %d", *o.MaxThinkingTokens)))
+	}
+	if o.MaxBudgetUSD != nil && *o.MaxBudgetUSD < 0 {
+		add(NewValidationError("max_budget_usd", fmt.Sprintf("must not be negative, got %g", *o.MaxBudgetUSD)))
+	}
+	if o.Model != nil {
+		add(validateModelName("model", *o.Model))
+	}
+	for i, model := range o.ModelFallbacks {
+		add(validateModelName(fmt.Sprintf("model_fallbacks[%d]", i), model))
+	}
+	for _, name := range slices.Sorted(maps.Keys(o.Agents)) {
+		if name == "" {
+			add(NewValidationError("agents", "agent name must not be empty"))
+			continue
+		}
+		for _, v := range o.Agents[name].violations(fmt.Sprintf("agents[%s].", name)) {
+			add(v)
+		}
+	}
+	if o.Ephemeral && o.StderrLogFile != nil && *o.StderrLogFile == "" {
+		add(NewValidationError("stderr_log_file", "the default log file is in the home directory, which ephemeral mode does not write to; use WithCustomStderrLogFile"))
+	}
+	if o.TempDir != nil && *o.TempDir == "" {
+		add(NewValidationError("temp_dir", "must not be empty"))
+	}
+	if !o.CLIProfile.IsValid() {
+		add(NewValidationError("cli_profile", fmt.Sprintf("unknown profile %q (want 1.x or 2.x)", o.CLIProfile)))
+	}
+	if !o.SessionLocking.IsValid() {
+		add(NewValidationError("session_locking", fmt.Sprintf("unknown mode %q (want block or fail)", o.SessionLocking)))
+	}
+	if !o.EchoedUserMessages.IsValid() {
+		add(NewValidationError("echoed_user_messages", fmt.Sprintf("unknown policy %q (want include, tool_results_only or exclude)", o.EchoedUserMessages)))
+	}
+	for _, source := range o.SettingSources {
+		if !source.IsValid() {
+			add(NewValidationError("setting_sources", fmt.Sprintf("unknown setting source %q (want user, project, or local)", source)))
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return &OptionsValidationError{Violations: violations}
+}
+
+// validateModelName checks that a model is a non-empty name or alias without
+// whitespace or control characters, such as "sonnet" or "claude-sonnet-4-5".
+func validateModelName(field, model string) error {
+	if model == "" {
+		return NewValidationError(field, "must not be empty")
+	}
+	for _, r := range model {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return NewValidationError(field, fmt.Sprintf("%q is not a model name: it contains whitespace or control characters", model))
+		}
+	}
+	return nil
+}
+
 // WithAllowedTools sets the allowed tools.
 func (o *ClaudeAgentOptions) WithAllowedTools(tools ...string) *ClaudeAgentOptions {
 	o.AllowedTools = tools
@@ -216,7 +661,16 @@ func (o *ClaudeAgentOptions) WithDisallowedTools(tools ...string) *ClaudeAgentOp
 	return o
 }
 
-// WithSystemPrompt sets the system prompt (can be string or SystemPromptPreset).
+// WithToolAliases sets tool name aliases (alias -> canonical name) used to normalize
+// tool names reported by the CLI before permission callbacks and hook matchers see them.
+// Entries override DefaultToolAliases; mapping an alias to "" disables a built-in alias.
+func (o *ClaudeAgentOptions) WithToolAliases(aliases map[string]string) *ClaudeAgentOptions {
+	o.ToolAliases = aliases
+	return o
+}
+
+// WithSystemPrompt sets the system prompt. It must be a string, a SystemPromptPreset
+// or a *SystemPromptPreset; other types are reported by Validate.
 func (o *ClaudeAgentOptions) WithSystemPrompt(prompt interface{}) *ClaudeAgentOptions {
 	o.SystemPrompt = prompt
 	return o
@@ -234,7 +688,29 @@ func (o *ClaudeAgentOptions) WithSystemPromptPreset(preset SystemPromptPreset) *
 	return o
 }
 
+// WithSystemPromptPresetClaude uses the claude_code preset system prompt, with
+// appendPrompt added to the end of it. An empty appendPrompt uses the preset as is.
+func (o *ClaudeAgentOptions) WithSystemPromptPresetClaude(appendPrompt string) *ClaudeAgentOptions {
+	preset := SystemPromptPreset{Type: "preset", Preset: "claude_code"}
+	if appendPrompt != "" {
+		preset.Append = &appendPrompt
+	}
+	o.SystemPrompt = preset
+	return o
+}
+
 // WithMcpServers sets the MCP servers configuration.
+//
+// A string is passed to the CLI as --mcp-config unchanged. A map of server configs
+// is written to a temporary JSON file for the lifetime of the connection. SDK servers
+// (McpSdkServerConfig) whose Instance implements MCPServer are served in-process.
+//
+// Example:
+//
+//	opts := types.NewClaudeAgentOptions().WithMcpServers(map[string]interface{}{
+//	    "files": types.McpStdioServerConfig{Command: "mcp-files", Args: []string{"--root", "."}},
+//	    "docs":  types.McpHTTPServerConfig{URL: "https://example.com/mcp"},
+//	})
 func (o *ClaudeAgentOptions) WithMcpServers(servers interface{}) *ClaudeAgentOptions {
 	o.McpServers = servers
 	return o
@@ -252,7 +728,9 @@ func (o *ClaudeAgentOptions) WithPermissionPromptToolName(toolName string) *Clau
 	return o
 }
 
-// WithContinueConversation sets whether to continue the conversation.
+// WithContinueConversation sets whether to continue the most recent conversation,
+// passed to the CLI as --continue. The CLI picks the conversation from the project
+// of the working directory (CWD). It cannot be combined with WithResume.
 func (o *ClaudeAgentOptions) WithContinueConversation(continue_ bool) *ClaudeAgentOptions {
 	o.ContinueConversation = continue_
 	return o
@@ -270,13 +748,46 @@ func (o *ClaudeAgentOptions) WithForkSession(fork bool) *ClaudeAgentOptions {
 	return o
 }
 
+// WithSessionLocking guards against two clients resuming the same session at
+// once, which corrupts the CLI's session file or interleaves the histories.
+// With SessionLockBlock or SessionLockFail, a client resuming a session (see
+// WithResume) takes an advisory lock on the session file when it connects,
+// and releases it on Close; a one-shot Query holds it until its channel
+// closes. SessionLockBlock waits for the lock for as long as the connecting
+// context allows; SessionLockFail returns a *SessionLockedError at once.
+// Forked sessions (WithForkSession) are not locked, since the original is
+// only read.
+//
+// The lock only excludes other SDK clients that also lock, in this or another
+// process; it is ignored by the CLI itself.
+func (o *ClaudeAgentOptions) WithSessionLocking(mode SessionLockMode) *ClaudeAgentOptions {
+	o.SessionLocking = mode
+	return o
+}
+
 // WithModel sets the model to use.
 func (o *ClaudeAgentOptions) WithModel(model string) *ClaudeAgentOptions {
 	o.Model = &model
 	return o
 }
 
-// WithMaxTurns sets the maximum number of turns.
+// WithModelFallbacks sets the models to fall back to, in order, when a query fails
+// because the current model is overloaded or unavailable.
+// Other failures never trigger a fallback.
+//
+// While a fallback remains, an attempt's messages are held back until the
+// model's first output, so those of a failed attempt (its init message and the
+// CLI's API error) are never delivered. Once the model has answered, the query
+// is not retried, since its tools may already have run.
+func (o *ClaudeAgentOptions) WithModelFallbacks(models ...string) *ClaudeAgentOptions {
+	o.ModelFallbacks = models
+	return o
+}
+
+// WithMaxTurns sets the maximum number of turns (model responses) per query,
+// passed to the CLI as --max-turns. For CLI profiles that cannot honor the
+// flag the SDK enforces the limit itself: it interrupts the query and ends it
+// with an error_max_turns result marked with ResultMeta.TurnLimitedBySDK.
 func (o *ClaudeAgentOptions) WithMaxTurns(maxTurns int) *ClaudeAgentOptions {
 	o.MaxTurns = &maxTurns
 	return o
@@ -284,6 +795,8 @@ func (o *ClaudeAgentOptions) WithMaxTurns(maxTurns int) *ClaudeAgentOptions {
 
 // WithMaxThinkingTokens sets the maximum tokens for extended thinking.
 // This limits how many tokens Claude can use for internal reasoning before responding.
+// It is passed to the CLI as --max-thinking-tokens; 0 is sent explicitly and disables
+// extended thinking, while leaving it unset uses the CLI default.
 func (o *ClaudeAgentOptions) WithMaxThinkingTokens(maxTokens int) *ClaudeAgentOptions {
 	o.MaxThinkingTokens = &maxTokens
 	return o
@@ -291,6 +804,9 @@ func (o *ClaudeAgentOptions) WithMaxThinkingTokens(maxTokens int) *ClaudeAgentOp
 
 // WithMaxBudgetUSD sets the maximum budget in USD for this query.
 // This helps prevent unexpectedly high API costs by stopping execution when the limit is reached.
+// The limit is passed to the CLI and also enforced by the SDK: once the accumulated
+// TotalCostUSD of received ResultMessages exceeds it, the session is interrupted and
+// a BudgetExceededError is reported.
 func (o *ClaudeAgentOptions) WithMaxBudgetUSD(maxBudget float64) *ClaudeAgentOptions {
 	o.MaxBudgetUSD = &maxBudget
 	return o
@@ -302,7 +818,29 @@ func (o *ClaudeAgentOptions) WithBaseURL(baseURL string) *ClaudeAgentOptions {
 	return o
 }
 
-// WithCWD sets the working directory.
+// WithProxy routes the CLI subprocess through an HTTPS proxy. httpsProxy and
+// noProxy are set as HTTPS_PROXY and NO_PROXY (and their lowercase forms) in
+// the subprocess environment only, overriding inherited values; an empty
+// argument leaves the inherited value alone. Use WithProxyConfig to replace
+// the inherited proxy settings entirely.
+func (o *ClaudeAgentOptions) WithProxy(httpsProxy, noProxy string) *ClaudeAgentOptions {
+	o.Proxy = &ProxyConfig{HTTPSProxy: httpsProxy, NoProxy: noProxy, KeepInherited: true}
+	return o
+}
+
+// WithProxyConfig sets the proxy configuration of the CLI subprocess. Unless
+// KeepInherited is set, inherited HTTP_PROXY, HTTPS_PROXY, NO_PROXY, ALL_PROXY
+// and NODE_EXTRA_CA_CERTS values are removed, so the subprocess environment is
+// the same wherever the SDK runs. Connect fails with a ValidationError if
+// ExtraCACertPath does not name a readable file.
+func (o *ClaudeAgentOptions) WithProxyConfig(proxy ProxyConfig) *ClaudeAgentOptions {
+	o.Proxy = &proxy
+	return o
+}
+
+// WithCWD sets the working directory. A leading ~ is expanded and a relative
+// path is resolved against the current process directory when connecting; the
+// result must be an existing directory.
 func (o *ClaudeAgentOptions) WithCWD(cwd string) *ClaudeAgentOptions {
 	o.CWD = &cwd
 	return o
@@ -314,24 +852,83 @@ func (o *ClaudeAgentOptions) WithCLIPath(cliPath string) *ClaudeAgentOptions {
 	return o
 }
 
-// WithSettings sets the settings file path.
+// WithSkipVersionCheck skips the CLI version check performed when the CLI is
+// discovered automatically. The CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK environment
+// variable skips the check regardless of this option.
+func (o *ClaudeAgentOptions) WithSkipVersionCheck(skip bool) *ClaudeAgentOptions {
+	o.SkipVersionCheck = skip
+	return o
+}
+
+// WithEphemeral keeps the SDK and the CLI from writing outside TempDir, for
+// environments whose home directory is read-only or shared between runs:
+//   - the CLI's configuration and session files go to TempDir/.claude
+//     (CLAUDE_CONFIG_DIR), unless Env sets CLAUDE_CONFIG_DIR
+//   - the default stderr log file in the home directory is rejected by
+//     Validate; a custom path is still allowed
+//
+// See claude.NewEphemeralOptions for a complete preset.
+func (o *ClaudeAgentOptions) WithEphemeral(ephemeral bool) *ClaudeAgentOptions {
+	o.Ephemeral = ephemeral
+	return o
+}
+
+// WithTempDir sets the directory for files the SDK writes while connected,
+// such as the MCP config file, and the CLI's files in ephemeral mode. The
+// default is os.TempDir.
+func (o *ClaudeAgentOptions) WithTempDir(dir string) *ClaudeAgentOptions {
+	o.TempDir = &dir
+	return o
+}
+
+// WithMinimumCLIVersion sets the CLI version required during discovery (e.g. "2.1.0").
+// Raising it lets deployments require newer CLIs; lowering it below the SDK default
+// is allowed but logs a warning.
+func (o *ClaudeAgentOptions) WithMinimumCLIVersion(version string) *ClaudeAgentOptions {
+	o.MinimumCLIVersion = &version
+	return o
+}
+
+// WithCLIProfile forces the command-line flags used for a CLI major version
+// instead of selecting them from the version detected during discovery. Options
+// the profile's CLI does not support fail to connect with a ValidationError.
+// Older CLIs are also rejected by the version check unless WithMinimumCLIVersion
+// lowers it or WithCLIPath bypasses discovery.
+func (o *ClaudeAgentOptions) WithCLIProfile(profile CLIProfile) *ClaudeAgentOptions {
+	o.CLIProfile = profile
+	return o
+}
+
+// WithSettings sets the settings file path, passed to the CLI as --settings.
+// Relative paths are resolved against CWD. The file must exist when connecting.
 func (o *ClaudeAgentOptions) WithSettings(settings string) *ClaudeAgentOptions {
 	o.Settings = &settings
 	return o
 }
 
-// WithSettingSources sets the setting sources to load.
+// WithSettingSources sets the setting sources to load, passed to the CLI as a
+// comma-separated --setting-sources list. Order is preserved and duplicates are
+// dropped; unknown sources are rejected when connecting.
 func (o *ClaudeAgentOptions) WithSettingSources(sources ...SettingSource) *ClaudeAgentOptions {
 	o.SettingSources = sources
 	return o
 }
 
-// WithAddDirs sets the directories to add.
+// WithAddDirs sets additional directories Claude may access, passed to the CLI as one
+// --add-dir flag each. A leading ~ is expanded and relative paths are resolved against CWD.
+// Directories must exist unless WithSkipMissingAddDirs is enabled.
 func (o *ClaudeAgentOptions) WithAddDirs(dirs ...string) *ClaudeAgentOptions {
 	o.AddDirs = dirs
 	return o
 }
 
+// WithSkipMissingAddDirs controls whether AddDirs entries that do not exist are skipped
+// with a warning (true) or cause Connect to fail with a ValidationError (false, the default).
+func (o *ClaudeAgentOptions) WithSkipMissingAddDirs(skip bool) *ClaudeAgentOptions {
+	o.SkipMissingAddDirs = skip
+	return o
+}
+
 // WithEnv sets environment variables.
 func (o *ClaudeAgentOptions) WithEnv(env map[string]string) *ClaudeAgentOptions {
 	o.Env = env
@@ -347,13 +944,20 @@ func (o *ClaudeAgentOptions) WithEnvVar(key, value string) *ClaudeAgentOptions {
 	return o
 }
 
-// WithExtraArgs sets extra CLI arguments.
+// WithExtraArgs sets extra CLI arguments, for flags the SDK doesn't model yet.
+// Keys are flag names without leading dashes. A nil value emits a bare --flag;
+// otherwise --flag value is emitted. Flags are passed in sorted order.
 func (o *ClaudeAgentOptions) WithExtraArgs(args map[string]*string) *ClaudeAgentOptions {
 	o.ExtraArgs = args
 	return o
 }
 
-// WithExtraArg sets a single extra CLI argument.
+// WithExtraArg sets a single extra CLI argument (see WithExtraArgs).
+//
+// Example:
+//
+//	debug := "api"
+//	opts.WithExtraArg("strict-mcp-config", nil).WithExtraArg("debug", &debug)
 func (o *ClaudeAgentOptions) WithExtraArg(key string, value *string) *ClaudeAgentOptions {
 	if o.ExtraArgs == nil {
 		o.ExtraArgs = make(map[string]*string)
@@ -368,13 +972,86 @@ func (o *ClaudeAgentOptions) WithMaxBufferSize(size int) *ClaudeAgentOptions {
 	return o
 }
 
+// WithParserWorkers parses the CLI's output on n goroutines instead of the
+// one reading it, which raises throughput for heavy streams, such as partial
+// messages or large tool results, on machines with several cores. Messages are
+// still delivered in the order the CLI wrote them. 0 or 1 disables it.
+func (o *ClaudeAgentOptions) WithParserWorkers(n int) *ClaudeAgentOptions {
+	o.ParserWorkers = n
+	return o
+}
+
+// WithMaxImageSize limits the size of image files sent with
+// Client.QueryWithImage. Larger files fail with an *ImageTooLargeError before
+// anything is sent, unless downscaling is enabled (see WithImageDownscaling).
+// Limits above MaxImageBytes have no effect.
+func (o *ClaudeAgentOptions) WithMaxImageSize(bytes int64) *ClaudeAgentOptions {
+	o.MaxImageSize = bytes
+	return o
+}
+
+// WithMaxImageDimension limits the longest side, in pixels, of image files
+// sent with Client.QueryWithImage. Larger images fail with an
+// *ImageTooLargeError unless downscaling is enabled. Limits above
+// MaxImageDimension have no effect.
+func (o *ClaudeAgentOptions) WithMaxImageDimension(pixels int) *ClaudeAgentOptions {
+	o.MaxImageDimension = pixels
+	return o
+}
+
+// WithImageDownscaling makes Client.QueryWithImage scale down and re-encode
+// images over MaxImageSize or MaxImageDimension instead of rejecting them,
+// re-encoding JPEGs at jpegQuality (1-100, or 0 for DefaultJPEGQuality).
+func (o *ClaudeAgentOptions) WithImageDownscaling(jpegQuality int) *ClaudeAgentOptions {
+	o.DownscaleImages = true
+	o.ImageJPEGQuality = jpegQuality
+	return o
+}
+
 // WithIncludePartialMessages sets whether to include partial messages.
+// When enabled, the CLI is started with --include-partial-messages and streams
+// incremental updates as *StreamEvent messages alongside the complete messages.
 func (o *ClaudeAgentOptions) WithIncludePartialMessages(include bool) *ClaudeAgentOptions {
 	o.IncludePartialMessages = include
 	return o
 }
 
-// WithUser sets the user identifier.
+// WithEchoedUserMessages sets which UserMessages echoed by the CLI are delivered to consumers.
+// Excluded messages are counted rather than silently lost; see Client.ExcludedUserMessages.
+func (o *ClaudeAgentOptions) WithEchoedUserMessages(policy EchoedUserMessagePolicy) *ClaudeAgentOptions {
+	o.EchoedUserMessages = policy
+	return o
+}
+
+// WithStdoutMirror writes assistant text to w as each message is routed, so a
+// script can print Claude's output without a message loop of its own:
+//
+//	messages, err := claude.Query(ctx, prompt, types.NewClaudeAgentOptions().WithStdoutMirror(os.Stdout))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for range messages {
+//	}
+//
+// Text is written as delivered, with a newline added at the end of each turn if
+// needed. Thinking blocks are never mirrored. If a write fails the mirror is
+// disabled and a warning is logged; message delivery is unaffected.
+func (o *ClaudeAgentOptions) WithStdoutMirror(w io.Writer) *ClaudeAgentOptions {
+	o.StdoutMirror = w
+	return o
+}
+
+// WithMirrorToolStatus sets whether a "[tool: Name]" line is written to the
+// StdoutMirror for each tool call.
+func (o *ClaudeAgentOptions) WithMirrorToolStatus(enabled bool) *ClaudeAgentOptions {
+	o.MirrorToolStatus = enabled
+	return o
+}
+
+// WithUser sets the user identifier used to attribute requests.
+// The CLI has no flag for it, so it is passed to the subprocess as the
+// CLAUDE_AGENT_SDK_USER environment variable, and logged in verbose mode
+// when the session starts.
 func (o *ClaudeAgentOptions) WithUser(user string) *ClaudeAgentOptions {
 	o.User = &user
 	return o
@@ -408,7 +1085,8 @@ func (o *ClaudeAgentOptions) WithPlugin(plugin PluginConfig) *ClaudeAgentOptions
 }
 
 // WithLocalPlugin adds a local plugin by path (convenience method).
-// This is the most common way to add plugins.
+// This is the most common way to add plugins. Each plugin is passed to the CLI as
+// --plugin-dir; relative paths are resolved against CWD and the directory must exist.
 func (o *ClaudeAgentOptions) WithLocalPlugin(path string) *ClaudeAgentOptions {
 	o.Plugins = append(o.Plugins, *NewLocalPluginConfig(path))
 	return o
@@ -435,12 +1113,46 @@ func (o *ClaudeAgentOptions) WithHook(event HookEvent, matcher HookMatcher) *Cla
 	return o
 }
 
-// WithStderr sets the stderr callback.
+// WithStderr sets a callback that receives each line the CLI writes to stderr.
+// Lines are delivered in order on a dedicated goroutine, one call at a time, so
+// a slow callback delays only later callbacks and never the SDK itself.
 func (o *ClaudeAgentOptions) WithStderr(callback StderrCallbackFunc) *ClaudeAgentOptions {
 	o.Stderr = callback
 	return o
 }
 
+// WithOnDisconnect sets a callback invoked once per Client connection when
+// the connection ends other than by Close: the CLI exited or crashed, or its
+// output ended. It is not invoked for Close, nor for connections that fail
+// while connecting, and one-shot Query does not invoke it. err is nil for a
+// clean exit and a *ProcessError for a crash; see DisconnectCallbackFunc.
+//
+// The callback runs on its own goroutine and may call Client methods, such as
+// Reconnect. With WithAutoReconnect it is invoked for each lost connection.
+//
+// Example:
+//
+//	opts := types.NewClaudeAgentOptions().WithOnDisconnect(func(err error) {
+//	    alert("claude CLI disconnected", err)
+//	})
+func (o *ClaudeAgentOptions) WithOnDisconnect(callback DisconnectCallbackFunc) *ClaudeAgentOptions {
+	o.OnDisconnect = callback
+	return o
+}
+
+// WithOnLateMessage sets a callback for messages the CLI sends after a
+// turn's ResultMessage, which the Client removes from the stream so the next
+// query's response starts with its own messages. Messages received before the
+// next query are handed over on the goroutine sending it, before the prompt is
+// written; system messages received after it, until the next turn's first
+// message, on the goroutine receiving the response. A panicking callback is
+// recovered and logged. Pass a claude.Transcript's RecordLate to keep them
+// with the turn they belong to. See LateMessageFunc.
+func (o *ClaudeAgentOptions) WithOnLateMessage(callback LateMessageFunc) *ClaudeAgentOptions {
+	o.OnLateMessage = callback
+	return o
+}
+
 // WithStderrLogFile enables SDK-managed stderr file logging.
 // Pass nil to disable (default), empty string for default location, or custom path.
 func (o *ClaudeAgentOptions) WithStderrLogFile(path *string) *ClaudeAgentOptions {
@@ -462,6 +1174,157 @@ func (o *ClaudeAgentOptions) WithCustomStderrLogFile(path string) *ClaudeAgentOp
 	return o
 }
 
+// WithControlObserver sets a callback invoked for every control request and response,
+// in both directions. See ControlObserverFunc for delivery guarantees.
+func (o *ClaudeAgentOptions) WithControlObserver(observer ControlObserverFunc) *ClaudeAgentOptions {
+	o.ControlObserver = observer
+	return o
+}
+
+// WithSubagentObserver sets a callback invoked when a Task-tool subagent starts
+// and finishes, for rendering nested progress. See SubagentObserverFunc.
+func (o *ClaudeAgentOptions) WithSubagentObserver(observer SubagentObserverFunc) *ClaudeAgentOptions {
+	o.SubagentObserver = observer
+	return o
+}
+
+// WithSpanSink sets the sink that receives tracing spans for each turn, tool use,
+// permission request, hook callback and control request. See SpanSink.
+func (o *ClaudeAgentOptions) WithSpanSink(sink SpanSink) *ClaudeAgentOptions {
+	o.SpanSink = sink
+	return o
+}
+
+// WithProtocolTrace sets the tracer that receives every JSON line written to
+// and read from the CLI, such as a claude.TraceRecorder. See ProtocolTracer.
+func (o *ClaudeAgentOptions) WithProtocolTrace(tracer ProtocolTracer) *ClaudeAgentOptions {
+	o.ProtocolTrace = tracer
+	return o
+}
+
+// WithLazyInitialize defers control protocol initialization from Client.Connect to the
+// first Client.Query. Connect returns as soon as the CLI is running; the first query
+// then waits for initialization to finish before it is sent.
+func (o *ClaudeAgentOptions) WithLazyInitialize(lazy bool) *ClaudeAgentOptions {
+	o.LazyInitialize = lazy
+	return o
+}
+
+// WithWaitForInit makes Client.Connect block until the CLI's system init message has
+// been received, so the session ID is available as soon as Connect returns.
+// Some CLI versions only send init after the first prompt; in that case leave this
+// disabled and call Client.WaitForInit after Client.Query instead.
+func (o *ClaudeAgentOptions) WithWaitForInit(wait bool) *ClaudeAgentOptions {
+	o.WaitForInit = wait
+	return o
+}
+
+// WithAutoReconnect makes a Client recover when its CLI subprocess exits
+// unexpectedly (crash, OOM kill, laptop sleep): it starts a new subprocess
+// resuming the session, initializes the control protocol again so hooks and
+// permission callbacks keep working, and continues delivering messages after a
+// SystemMessage of subtype SystemSubtypeReconnected. The turn in progress is
+// lost. Up to maxAttempts are made, the first after backoff, which doubles
+// after each failure; if all fail, message channels close and Client.Err
+// returns a *ProcessError. Zero maxAttempts disables reconnection.
+//
+// Example:
+//
+//	opts := types.NewClaudeAgentOptions().WithAutoReconnect(3, time.Second)
+func (o *ClaudeAgentOptions) WithAutoReconnect(maxAttempts int, backoff time.Duration) *ClaudeAgentOptions {
+	o.AutoReconnectAttempts = maxAttempts
+	o.AutoReconnectBackoff = backoff
+	return o
+}
+
+// WithAutoContinueOnTruncation makes a Client continue answers cut off by the
+// output token limit. When a turn's last assistant message stops with
+// StopReasonMaxTokens, the SDK withholds the turn's result, sends
+// ContinuationPrompt and keeps the response open, up to maxContinues times per
+// turn. Each continuation is announced with a SystemMessage of subtype
+// SystemSubtypeAutoContinue. Zero disables it; one-shot Query is not affected.
+func (o *ClaudeAgentOptions) WithAutoContinueOnTruncation(maxContinues int) *ClaudeAgentOptions {
+	o.AutoContinueOnTruncation = maxContinues
+	return o
+}
+
+// ContinuationPrompt is sent to continue a truncated answer (see
+// WithAutoContinueOnTruncation).
+const ContinuationPrompt = "Continue exactly where you left off. Do not repeat anything you already wrote."
+
+// WithQueryTimeout aborts a response that goes quiet. The timeout is an idle
+// timeout: it restarts with every message received, so a long turn that keeps
+// streaming is never cut off, while one that receives nothing for the whole
+// window is. It applies to Query and to each Client.ReceiveResponse, and is
+// independent of the caller's context.
+//
+// On expiry the SDK interrupts the turn (one-shot Query terminates the CLI
+// instead), closes the response channel without a ResultMessage and records a
+// *types.TimeoutError, which Client.Err returns. Zero (the default) disables it.
+func (o *ClaudeAgentOptions) WithQueryTimeout(timeout time.Duration) *ClaudeAgentOptions {
+	o.QueryTimeout = timeout
+	return o
+}
+
+// WithIdleTimeout closes a Client, terminating the CLI subprocess, once it has
+// been unused for timeout: no Query, no message read from ReceiveResponse or
+// ReceiveMessages, and no control request such as Interrupt, SetModel or Ping.
+// A turn whose response is being received is never idle, however long the CLI
+// takes. This keeps pooled clients whose users walked away from leaking
+// subprocesses.
+//
+// Calls on a client closed this way return an error matching
+// types.ErrClientClosed (errors.Is), so a pool can recreate the client lazily.
+// Zero (the default) disables it.
+//
+// Example:
+//
+//	if err := client.Query(ctx, prompt); errors.Is(err, types.ErrClientClosed) {
+//	    client, err = pool.Recreate(ctx, user)
+//	}
+func (o *ClaudeAgentOptions) WithIdleTimeout(timeout time.Duration) *ClaudeAgentOptions {
+	o.IdleTimeout = timeout
+	return o
+}
+
+// WithSubscriberBuffer sets how many messages each Client.Subscribe channel
+// holds for its reader; a subscriber that falls further behind is dropped.
+// Zero (the default) means 256.
+func (o *ClaudeAgentOptions) WithSubscriberBuffer(n int) *ClaudeAgentOptions {
+	o.SubscriberBuffer = n
+	return o
+}
+
+// WithScriptTurnTimeout bounds how long RunScript waits for each turn's result.
+// A turn that times out always ends the script. Zero (the default) means no limit.
+func (o *ClaudeAgentOptions) WithScriptTurnTimeout(timeout time.Duration) *ClaudeAgentOptions {
+	o.ScriptTurnTimeout = timeout
+	return o
+}
+
+// WithAbortScriptOnError makes RunScript stop at the first turn whose result is an
+// error, instead of recording it and sending the next prompt.
+func (o *ClaudeAgentOptions) WithAbortScriptOnError(abort bool) *ClaudeAgentOptions {
+	o.AbortScriptOnError = abort
+	return o
+}
+
+// WithRefusalClassifier sets the classifier that recognizes refusals from the text
+// of a turn's answer, replacing DefaultRefusalClassifier. Use it to tune refusal
+// detection for a domain, or return false to rely on the refusal stop reason alone.
+func (o *ClaudeAgentOptions) WithRefusalClassifier(classifier RefusalClassifierFunc) *ClaudeAgentOptions {
+	o.RefusalClassifier = classifier
+	return o
+}
+
+// WithFailOnRefusal makes RunScript and Agent.Run report a turn in which the model
+// declined the request as failed, with a *RefusalError as the turn's Err. Without
+// it refusals are only flagged in TurnResult.Refused and TurnSummary.Refused.
+func (o *ClaudeAgentOptions) WithFailOnRefusal(fail bool) *ClaudeAgentOptions {
+	o.FailOnRefusal = fail
+	return o
+}
+
 // WithVerbose enables or disables verbose debug logging.
 func (o *ClaudeAgentOptions) WithVerbose(enabled bool) *ClaudeAgentOptions {
 	o.Verbose = enabled
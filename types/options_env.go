@@ -0,0 +1,93 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variables read by OptionsFromEnv.
+const (
+	EnvModel          = "CLAUDE_AGENT_MODEL"
+	EnvCLIPath        = "CLAUDE_AGENT_CLI_PATH"
+	EnvPermissionMode = "CLAUDE_AGENT_PERMISSION_MODE"
+	EnvMaxTurns       = "CLAUDE_AGENT_MAX_TURNS"
+	EnvCWD            = "CLAUDE_AGENT_CWD"
+	EnvVerbose        = "CLAUDE_AGENT_VERBOSE"
+)
+
+// OptionsFromEnv creates options from environment variables, for deployments
+// configured through the environment:
+//
+//   - CLAUDE_AGENT_MODEL: model name or alias
+//   - CLAUDE_AGENT_CLI_PATH: path to the Claude Code CLI
+//   - CLAUDE_AGENT_PERMISSION_MODE: default, acceptEdits, plan or bypassPermissions
+//   - CLAUDE_AGENT_MAX_TURNS: non-negative integer
+//   - CLAUDE_AGENT_CWD: working directory
+//   - CLAUDE_AGENT_VERBOSE: boolean, as accepted by strconv.ParseBool
+//
+// Unset or empty variables leave the defaults of NewClaudeAgentOptions. The
+// result is an ordinary options value, so the With* builders can override
+// what came from the environment.
+//
+// Values that cannot be parsed are reported together in an
+// *OptionsValidationError with one violation per variable, named by the
+// variable; no options are returned in that case.
+//
+// Example:
+//
+//	opts, err := types.OptionsFromEnv()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	opts.WithAllowedTools("Read", "Grep")
+func OptionsFromEnv() (*ClaudeAgentOptions, error) {
+	opts := NewClaudeAgentOptions()
+	var violations []*ValidationError
+
+	if model := os.Getenv(EnvModel); model != "" {
+		if err := validateModelName(EnvModel, model); err != nil {
+			violations = append(violations, err.(*ValidationError))
+		} else {
+			opts.WithModel(model)
+		}
+	}
+	if cliPath := os.Getenv(EnvCLIPath); cliPath != "" {
+		opts.WithCLIPath(cliPath)
+	}
+	if mode := os.Getenv(EnvPermissionMode); mode != "" {
+		if PermissionMode(mode).IsValid() {
+			opts.WithPermissionMode(PermissionMode(mode))
+		} else {
+			violations = append(violations, NewValidationError(EnvPermissionMode,
+				fmt.Sprintf("%q is not a permission mode (default, acceptEdits, plan, bypassPermissions)", mode)))
+		}
+	}
+	if value := os.Getenv(EnvMaxTurns); value != "" {
+		maxTurns, err := strconv.Atoi(value)
+		switch {
+		case err != nil:
+			violations = append(violations, NewValidationErrorWithCause(EnvMaxTurns, fmt.Sprintf("%q is not an integer", value), err))
+		case maxTurns < 0:
+			violations = append(violations, NewValidationError(EnvMaxTurns, fmt.Sprintf("must not be negative, got %d", maxTurns)))
+		default:
+			opts.WithMaxTurns(maxTurns)
+		}
+	}
+	if cwd := os.Getenv(EnvCWD); cwd != "" {
+		opts.WithCWD(cwd)
+	}
+	if value := os.Getenv(EnvVerbose); value != "" {
+		verbose, err := strconv.ParseBool(value)
+		if err != nil {
+			violations = append(violations, NewValidationErrorWithCause(EnvVerbose, fmt.Sprintf("%q is not a boolean", value), err))
+		} else {
+			opts.WithVerbose(verbose)
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, &OptionsValidationError{Violations: violations}
+	}
+	return opts, nil
+}
@@ -0,0 +1,94 @@
+package types
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// setOptionsEnv sets every variable read by OptionsFromEnv, clearing those not in vars.
+func setOptionsEnv(t *testing.T, vars map[string]string) {
+	t.Helper()
+	for _, name := range []string{EnvModel, EnvCLIPath, EnvPermissionMode, EnvMaxTurns, EnvCWD, EnvVerbose} {
+		t.Setenv(name, vars[name])
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	setOptionsEnv(t, map[string]string{
+		EnvModel:          "claude-sonnet-4-5",
+		EnvCLIPath:        "/opt/claude/bin/claude",
+		EnvPermissionMode: "acceptEdits",
+		EnvMaxTurns:       "8",
+		EnvCWD:            "/srv/app",
+		EnvVerbose:        "true",
+	})
+
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		t.Fatalf("OptionsFromEnv failed: %v", err)
+	}
+	if opts.Model == nil || *opts.Model != "claude-sonnet-4-5" {
+		t.Errorf("Model = %v", opts.Model)
+	}
+	if opts.CLIPath == nil || *opts.CLIPath != "/opt/claude/bin/claude" {
+		t.Errorf("CLIPath = %v", opts.CLIPath)
+	}
+	if opts.PermissionMode == nil || *opts.PermissionMode != PermissionModeAcceptEdits {
+		t.Errorf("PermissionMode = %v", opts.PermissionMode)
+	}
+	if opts.MaxTurns == nil || *opts.MaxTurns != 8 {
+		t.Errorf("MaxTurns = %v", opts.MaxTurns)
+	}
+	if opts.CWD == nil || *opts.CWD != "/srv/app" {
+		t.Errorf("CWD = %v", opts.CWD)
+	}
+	if !opts.Verbose {
+		t.Error("Verbose should be set")
+	}
+
+	// Builders override values from the environment
+	opts.WithModel("opus")
+	if *opts.Model != "opus" {
+		t.Errorf("builder did not override the model: %s", *opts.Model)
+	}
+}
+
+func TestOptionsFromEnv_Unset(t *testing.T) {
+	setOptionsEnv(t, nil)
+
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		t.Fatalf("OptionsFromEnv failed: %v", err)
+	}
+	if !reflect.DeepEqual(opts, NewClaudeAgentOptions()) {
+		t.Errorf("unset variables should leave defaults, got %+v", opts)
+	}
+}
+
+func TestOptionsFromEnv_InvalidValues(t *testing.T) {
+	setOptionsEnv(t, map[string]string{
+		EnvModel:          "claude-sonnet-4-5",
+		EnvPermissionMode: "yolo",
+		EnvMaxTurns:       "ten",
+		EnvVerbose:        "sometimes",
+	})
+
+	opts, err := OptionsFromEnv()
+	if opts != nil {
+		t.Error("no options should be returned on error")
+	}
+	var optsErr *OptionsValidationError
+	if !errors.As(err, &optsErr) {
+		t.Fatalf("OptionsFromEnv() error = %v, want *OptionsValidationError", err)
+	}
+	want := []string{EnvPermissionMode, EnvMaxTurns, EnvVerbose}
+	if got := optsErr.Fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields() = %v, want %v", got, want)
+	}
+
+	setOptionsEnv(t, map[string]string{EnvMaxTurns: "-3"})
+	if _, err := OptionsFromEnv(); !IsValidationError(err) {
+		t.Errorf("negative max turns: error = %v, want ValidationError", err)
+	}
+}
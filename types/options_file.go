@@ -0,0 +1,220 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// LoadOptionsFromFile reads options from a JSON config file, so that model,
+// tools, MCP servers, agents and plugins can be kept in a checked-in file
+// instead of Go code.
+//
+// Keys are the JSON tags of ClaudeAgentOptions (e.g. "model", "allowed_tools",
+// "mcp_servers"); unset keys keep the defaults of NewClaudeAgentOptions. An
+// unknown key is an error naming the key. "system_prompt" may be a string or a
+// SystemPromptPreset object, and "script_turn_timeout", "query_timeout",
+// "idle_timeout" and "auto_reconnect_backoff" a duration string such as "30s"
+// or a number of nanoseconds.
+//
+// Callbacks, writers and other fields tagged json:"-" cannot come from a file;
+// set them on the returned options with the With* builders. The loaded options
+// are validated with Validate. YAML files are not supported.
+//
+// Example:
+//
+//	opts, err := types.LoadOptionsFromFile("agent.json")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	opts.WithCanUseTool(approveReads)
+func LoadOptionsFromFile(path string) (*ClaudeAgentOptions, error) {
+	return MergeOptionsFromFile(nil, path)
+}
+
+// MergeOptionsFromFile reads a JSON config file as LoadOptionsFromFile does
+// and applies it on top of base, which is left unchanged: every key set in
+// the file replaces the base's value, lists and maps included, and the other
+// options, callbacks included, keep the base's values. A nil base means
+// NewClaudeAgentOptions. The merged options are validated with Validate.
+//
+// Example:
+//
+//	opts, err := types.MergeOptionsFromFile(defaults, "agent.json")
+func MergeOptionsFromFile(base *ClaudeAgentOptions, path string) (*ClaudeAgentOptions, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, NewValidationError("config", fmt.Sprintf("%s: YAML config files are not supported, use JSON", path))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewValidationErrorWithCause("config", fmt.Sprintf("cannot read %s", path), err)
+	}
+	opts, err := mergeOptionsJSON(base, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return opts, nil
+}
+
+// MergeOptionsJSON applies options encoded as a JSON object, with the keys
+// of LoadOptionsFromFile, on top of base like MergeOptionsFromFile does, for
+// options that come from somewhere else than a file, such as a request.
+//
+// Example:
+//
+//	opts, err := types.MergeOptionsJSON(defaults, []byte(`{"model": "opus"}`))
+func MergeOptionsJSON(base *ClaudeAgentOptions, data []byte) (*ClaudeAgentOptions, error) {
+	return mergeOptionsJSON(base, data)
+}
+
+// mergeOptionsJSON decodes options from a JSON object and copies the fields
+// of the keys it sets onto a copy of base.
+func mergeOptionsJSON(base *ClaudeAgentOptions, data []byte) (*ClaudeAgentOptions, error) {
+	file, err := decodeOptionsJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, configDecodeError("", err)
+	}
+
+	merged := NewClaudeAgentOptions()
+	if base != nil {
+		merged = base.Clone()
+	}
+	from, to := reflect.ValueOf(file).Elem(), reflect.ValueOf(merged).Elem()
+	for i := 0; i < from.NumField(); i++ {
+		key, _, _ := strings.Cut(from.Type().Field(i).Tag.Get("json"), ",")
+		if _, ok := keys[key]; ok && key != "-" {
+			to.Field(i).Set(from.Field(i))
+		}
+	}
+
+	if err := merged.Validate(); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// decodeOptionsJSON decodes options from a JSON object on top of the defaults.
+func decodeOptionsJSON(data []byte) (*ClaudeAgentOptions, error) {
+	opts := NewClaudeAgentOptions()
+
+	// Fields that need more than their struct type to decode shadow the
+	// embedded ones
+	type plainOptions ClaudeAgentOptions
+	file := struct {
+		*plainOptions
+		SystemPrompt      json.RawMessage `json:"system_prompt,omitempty"`
+		ScriptTurnTimeout json.RawMessage `json:"script_turn_timeout,omitempty"`
+		QueryTimeout      json.RawMessage `json:"query_timeout,omitempty"`
+		IdleTimeout       json.RawMessage `json:"idle_timeout,omitempty"`
+		ReconnectBackoff  json.RawMessage `json:"auto_reconnect_backoff,omitempty"`
+	}{plainOptions: (*plainOptions)(opts)}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, configDecodeError("", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, NewValidationError("config", "unexpected data after the options object")
+	}
+
+	prompt, err := decodeSystemPrompt(file.SystemPrompt)
+	if err != nil {
+		return nil, err
+	}
+	opts.SystemPrompt = prompt
+	if opts.ScriptTurnTimeout, err = decodeDuration("script_turn_timeout", file.ScriptTurnTimeout); err != nil {
+		return nil, err
+	}
+	if opts.QueryTimeout, err = decodeDuration("query_timeout", file.QueryTimeout); err != nil {
+		return nil, err
+	}
+	if opts.IdleTimeout, err = decodeDuration("idle_timeout", file.IdleTimeout); err != nil {
+		return nil, err
+	}
+	if opts.AutoReconnectBackoff, err = decodeDuration("auto_reconnect_backoff", file.ReconnectBackoff); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// decodeSystemPrompt decodes a system prompt string or preset object. A
+// missing or null value returns nil.
+func decodeSystemPrompt(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+
+	var preset SystemPromptPreset
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&preset); err != nil {
+		return nil, configDecodeError("system_prompt", err)
+	}
+	return preset, nil
+}
+
+// decodeDuration decodes a duration string or a number of nanoseconds. A
+// missing or null value is zero.
+func decodeDuration(field string, raw json.RawMessage) (time.Duration, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return 0, NewValidationErrorWithCause(field, fmt.Sprintf("invalid duration %q", text), err)
+		}
+		return d, nil
+	}
+
+	var nanos int64
+	if err := json.Unmarshal(raw, &nanos); err != nil {
+		return 0, NewValidationError(field, "must be a duration string such as \"30s\" or a number of nanoseconds")
+	}
+	return time.Duration(nanos), nil
+}
+
+// configDecodeError turns a JSON decoding error into a ValidationError naming
+// the offending key. object is the key of the object being decoded, or "" for
+// the top level.
+func configDecodeError(object string, err error) error {
+	field := object
+	if field == "" {
+		field = "config"
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		if object != "" {
+			field = object + "." + typeErr.Field
+		} else {
+			field = typeErr.Field
+		}
+		return NewValidationError(field, fmt.Sprintf("expected %s, got JSON %s", typeErr.Type, typeErr.Value))
+	}
+	if key, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return NewValidationError(field, fmt.Sprintf("unknown key %s", key))
+	}
+	return NewValidationErrorWithCause(field, "malformed JSON", err)
+}
@@ -0,0 +1,194 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoadOptionsFromFile tests loading the sample config and spot-checks fields
+// that need more than their struct tags to decode.
+func TestLoadOptionsFromFile(t *testing.T) {
+	opts, err := LoadOptionsFromFile(filepath.Join("testdata", "options.json"))
+	if err != nil {
+		t.Fatalf("LoadOptionsFromFile failed: %v", err)
+	}
+
+	preset, ok := opts.SystemPrompt.(SystemPromptPreset)
+	if !ok || preset.Preset != "claude_code" || preset.Append == nil || *preset.Append != "Review Go code." {
+		t.Errorf("SystemPrompt = %#v, want the claude_code preset", opts.SystemPrompt)
+	}
+	if opts.ScriptTurnTimeout != 90*time.Second {
+		t.Errorf("ScriptTurnTimeout = %v, want 90s", opts.ScriptTurnTimeout)
+	}
+	if opts.QueryTimeout != 2*time.Minute {
+		t.Errorf("QueryTimeout = %v, want 2m", opts.QueryTimeout)
+	}
+	if opts.IdleTimeout != 15*time.Minute {
+		t.Errorf("IdleTimeout = %v, want 15m", opts.IdleTimeout)
+	}
+	if opts.Model == nil || *opts.Model != "claude-sonnet-4-5" || opts.MaxTurns == nil || *opts.MaxTurns != 12 {
+		t.Errorf("Model/MaxTurns not loaded: %v/%v", opts.Model, opts.MaxTurns)
+	}
+	if value, ok := opts.ExtraArgs["debug-to-stderr"]; !ok || value != nil {
+		t.Errorf("null extra arg should load as a flag without a value, got %v", value)
+	}
+	if agent := opts.Agents["reviewer"]; agent.Prompt != "You review Go code." || agent.Model == nil || *agent.Model != "sonnet" {
+		t.Errorf("Agents[reviewer] = %+v", agent)
+	}
+	servers, ok := opts.McpServers.(map[string]interface{})
+	if !ok || len(servers) != 2 {
+		t.Errorf("McpServers = %#v, want two server configs", opts.McpServers)
+	}
+
+	// The options can still be decorated in code
+	opts.WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx ToolPermissionContext) (interface{}, error) {
+		return PermissionResultAllow{Behavior: "allow"}, nil
+	})
+	if opts.CanUseTool == nil {
+		t.Error("builder should apply to loaded options")
+	}
+}
+
+// TestLoadOptionsFromFile_CoversEveryField guards the sample config against
+// new serializable options being added without it.
+func TestLoadOptionsFromFile_CoversEveryField(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "options.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sample map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sample); err != nil {
+		t.Fatal(err)
+	}
+
+	optionsType := reflect.TypeOf(ClaudeAgentOptions{})
+	for i := 0; i < optionsType.NumField(); i++ {
+		key, _, _ := strings.Cut(optionsType.Field(i).Tag.Get("json"), ",")
+		if key == "-" || key == "" {
+			continue
+		}
+		if _, ok := sample[key]; !ok {
+			t.Errorf("testdata/options.json is missing %q", key)
+		}
+	}
+}
+
+// TestLoadOptionsFromFile_RoundTrip tests that marshaled options load back unchanged.
+func TestLoadOptionsFromFile_RoundTrip(t *testing.T) {
+	loaded, err := LoadOptionsFromFile(filepath.Join("testdata", "options.json"))
+	if err != nil {
+		t.Fatalf("LoadOptionsFromFile failed: %v", err)
+	}
+
+	data, err := json.Marshal(loaded)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "roundtrip.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadOptionsFromFile(path)
+	if err != nil {
+		t.Fatalf("reloading marshaled options failed: %v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(loaded, reloaded) {
+		t.Errorf("round trip changed the options:\nloaded:   %+v\nreloaded: %+v", loaded, reloaded)
+	}
+}
+
+// TestLoadOptionsFromFile_Errors tests that bad config files name the problem.
+func TestLoadOptionsFromFile_Errors(t *testing.T) {
+	for name, tt := range map[string]struct {
+		file    string
+		content string
+		want    string
+	}{
+		"unknown key":        {"opts.json", `{"model": "sonnet", "modle": "opus"}`, `unknown key "modle"`},
+		"unknown preset key": {"opts.json", `{"system_prompt": {"preset": "claude_code", "extra": 1}}`, `invalid system_prompt: unknown key "extra"`},
+		"wrong type":         {"opts.json", `{"max_turns": "ten"}`, "invalid max_turns"},
+		"bad duration":       {"opts.json", `{"script_turn_timeout": "soon"}`, "invalid script_turn_timeout"},
+		"invalid options":    {"opts.json", `{"max_turns": -1}`, "invalid max_turns: must not be negative"},
+		"malformed":          {"opts.json", `{"model": `, "malformed JSON"},
+		"trailing data":      {"opts.json", `{} {}`, "unexpected data"},
+		"yaml":               {"opts.yaml", "model: sonnet", "YAML config files are not supported"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadOptionsFromFile(path)
+			if !IsValidationError(err) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadOptionsFromFile() error = %v, want ValidationError containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadOptionsFromFile(filepath.Join(t.TempDir(), "missing.json")); !IsValidationError(err) {
+		t.Errorf("missing file: error = %v, want ValidationError", err)
+	}
+}
+
+// TestMergeOptionsFromFile tests that the keys set in a file replace those of
+// the base options, which keep everything else and are left unchanged.
+func TestMergeOptionsFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "opts.json")
+	content := `{"model": "opus", "allowed_tools": ["Read"], "env": {"FILE": "1"}, "query_timeout": "1m"}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	base := NewClaudeAgentOptions().
+		WithModel("sonnet").
+		WithAllowedTools("Bash", "Grep").
+		WithEnvVar("BASE", "1").
+		WithMaxTurns(3)
+	base.CanUseTool = func(context.Context, string, map[string]interface{}, ToolPermissionContext) (interface{}, error) {
+		return nil, nil
+	}
+
+	merged, err := MergeOptionsFromFile(base, path)
+	if err != nil {
+		t.Fatalf("MergeOptionsFromFile failed: %v", err)
+	}
+	if *merged.Model != "opus" || !reflect.DeepEqual(merged.AllowedTools, []string{"Read"}) ||
+		!reflect.DeepEqual(merged.Env, map[string]string{"FILE": "1"}) || merged.QueryTimeout != time.Minute {
+		t.Errorf("file keys not applied: model %q, tools %v, env %v, timeout %v", *merged.Model, merged.AllowedTools, merged.Env, merged.QueryTimeout)
+	}
+	if merged.MaxTurns == nil || *merged.MaxTurns != 3 || merged.CanUseTool == nil {
+		t.Error("options not set in the file lost the base's values")
+	}
+	if *base.Model != "sonnet" || len(base.AllowedTools) != 2 || base.Env["FILE"] != "" {
+		t.Errorf("base was modified: model %q, tools %v, env %v", *base.Model, base.AllowedTools, base.Env)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"max_turns": -1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MergeOptionsFromFile(base, path); !IsValidationError(err) || !strings.Contains(err.Error(), path) {
+		t.Errorf("invalid file: error = %v, want a ValidationError naming %s", err, path)
+	}
+}
+
+func TestMergeOptionsJSON(t *testing.T) {
+	base := NewClaudeAgentOptions().WithModel("sonnet").WithMaxTurns(3)
+
+	merged, err := MergeOptionsJSON(base, []byte(`{"model": "opus", "idle_timeout": "5m"}`))
+	if err != nil {
+		t.Fatalf("MergeOptionsJSON failed: %v", err)
+	}
+	if *merged.Model != "opus" || merged.IdleTimeout != 5*time.Minute || *merged.MaxTurns != 3 {
+		t.Errorf("merged model %q, idle timeout %v, max turns %d", *merged.Model, merged.IdleTimeout, *merged.MaxTurns)
+	}
+
+	if _, err := MergeOptionsJSON(base, []byte(`{"modle": "opus"}`)); !IsValidationError(err) || !strings.Contains(err.Error(), "modle") {
+		t.Errorf("unknown key: error = %v, want a ValidationError naming the key", err)
+	}
+}
@@ -1,7 +1,12 @@
 package types
 
 import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestWithMaxThinkingTokens tests the WithMaxThinkingTokens builder method.
@@ -251,3 +256,198 @@ func TestClaudeAgentOptions_Plugins(t *testing.T) {
 		}
 	})
 }
+
+// TestSettingSourceIsValid tests validation of setting source values.
+func TestSettingSourceIsValid(t *testing.T) {
+	for _, source := range []SettingSource{SettingSourceUser, SettingSourceProject, SettingSourceLocal} {
+		if !source.IsValid() {
+			t.Errorf("%q should be valid", source)
+		}
+	}
+	for _, source := range []SettingSource{"", "global", "User"} {
+		if source.IsValid() {
+			t.Errorf("%q should be invalid", source)
+		}
+	}
+}
+
+// TestClone tests that a cloned options value can be modified independently.
+func TestClone(t *testing.T) {
+	if (*ClaudeAgentOptions)(nil).Clone() != nil {
+		t.Error("Clone of nil options should be nil")
+	}
+
+	orig := NewClaudeAgentOptions().
+		WithAllowedTools("Read").
+		WithEnvVar("A", "1").
+		WithExtraArg("debug", nil).
+		WithHook(HookEventPreToolUse, HookMatcher{Matcher: stringPtr("Bash")})
+
+	clone := orig.Clone()
+	clone.AllowedTools[0] = "Write"
+	clone.WithEnvVar("A", "2").
+		WithExtraArg("verbose", nil).
+		WithHook(HookEventPreToolUse, HookMatcher{Matcher: stringPtr("Edit")}).
+		WithModel("other")
+
+	if orig.AllowedTools[0] != "Read" {
+		t.Errorf("AllowedTools changed through clone: %v", orig.AllowedTools)
+	}
+	if orig.Env["A"] != "1" {
+		t.Errorf("Env changed through clone: %v", orig.Env)
+	}
+	if len(orig.ExtraArgs) != 1 {
+		t.Errorf("ExtraArgs changed through clone: %v", orig.ExtraArgs)
+	}
+	if len(orig.Hooks[HookEventPreToolUse]) != 1 || len(clone.Hooks[HookEventPreToolUse]) != 2 {
+		t.Errorf("hooks not copied: orig %d, clone %d", len(orig.Hooks[HookEventPreToolUse]), len(clone.Hooks[HookEventPreToolUse]))
+	}
+	if orig.Model != nil {
+		t.Errorf("Model changed through clone: %q", *orig.Model)
+	}
+}
+
+// TestValidateSystemPrompt tests which SystemPrompt types Validate accepts.
+func TestValidateSystemPrompt(t *testing.T) {
+	preset := SystemPromptPreset{Type: "preset", Preset: "claude_code"}
+
+	for name, prompt := range map[string]interface{}{
+		"nil":     nil,
+		"string":  "You are helpful.",
+		"value":   preset,
+		"pointer": &preset,
+	} {
+		if err := NewClaudeAgentOptions().WithSystemPrompt(prompt).Validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	for name, prompt := range map[string]interface{}{
+		"struct":      struct{ Text string }{"hi"},
+		"nil pointer": (*SystemPromptPreset)(nil),
+		"string ptr":  stringPtr("hi"),
+		"bad preset":  SystemPromptPreset{Type: "preset", Preset: "other"},
+		"bad type":    &SystemPromptPreset{Type: "template", Preset: "claude_code"},
+	} {
+		err := NewClaudeAgentOptions().WithSystemPrompt(prompt).Validate()
+		if !IsValidationError(err) {
+			t.Errorf("%s: Validate() = %v, want ValidationError", name, err)
+		}
+	}
+
+	err := NewClaudeAgentOptions().WithSystemPrompt(stringPtr("hi")).Validate()
+	if err == nil || !strings.Contains(err.Error(), "*string") {
+		t.Errorf("error should name the actual type, got %v", err)
+	}
+}
+
+// TestValidateReportsAllViolations tests that Validate lists every invalid option.
+func TestValidateReportsAllViolations(t *testing.T) {
+	canUseTool := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx ToolPermissionContext) (interface{}, error) {
+		return PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	opts := NewClaudeAgentOptions().
+		WithCanUseTool(canUseTool).
+		WithPermissionPromptToolName("mcp__auth__prompt").
+		WithDangerouslySkipPermissions(true).
+		WithResume("session-1").
+		WithContinueConversation(true).
+		WithMaxTurns(-1).
+		WithQueryTimeout(-time.Second).
+		WithModel("claude sonnet").
+		WithCLIProfile("3.x")
+
+	err := opts.Validate()
+	var optsErr *OptionsValidationError
+	if !errors.As(err, &optsErr) {
+		t.Fatalf("Validate() = %v, want *OptionsValidationError", err)
+	}
+	want := []string{"can_use_tool", "dangerously_skip_permissions", "continue_conversation", "max_turns", "query_timeout", "model", "cli_profile"}
+	if got := optsErr.Fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields() = %v, want %v", got, want)
+	}
+	if !IsValidationError(err) {
+		t.Error("IsValidationError should find the individual violations")
+	}
+	if !strings.HasPrefix(err.Error(), "7 invalid options: ") {
+		t.Errorf("Error() = %q, want a count prefix", err.Error())
+	}
+}
+
+// TestValidateAcceptsValidOptions tests combinations that must not be rejected.
+func TestValidateAcceptsValidOptions(t *testing.T) {
+	canUseTool := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx ToolPermissionContext) (interface{}, error) {
+		return PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	for name, opts := range map[string]*ClaudeAgentOptions{
+		"defaults":          NewClaudeAgentOptions(),
+		"stdio prompt tool": NewClaudeAgentOptions().WithCanUseTool(canUseTool).WithPermissionPromptToolName("stdio"),
+		"skip permissions":  NewClaudeAgentOptions().WithAllowDangerouslySkipPermissions(true).WithDangerouslySkipPermissions(true),
+		"model id":          NewClaudeAgentOptions().WithModel("claude-sonnet-4-5-20250929").WithMaxTurns(0),
+		"resume":            NewClaudeAgentOptions().WithResume("session-1"),
+		"cli profile":       NewClaudeAgentOptions().WithCLIProfile(CLIProfileV1),
+		"ephemeral":         NewClaudeAgentOptions().WithEphemeral(true).WithTempDir("/tmp/claude").WithCustomStderrLogFile("/tmp/claude/cli.log"),
+	} {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	for _, model := range []string{"", "sonnet\n", "opus\t"} {
+		if err := NewClaudeAgentOptions().WithModel(model).Validate(); !IsValidationError(err) {
+			t.Errorf("model %q: Validate() = %v, want ValidationError", model, err)
+		}
+	}
+	if err := NewClaudeAgentOptions().WithEphemeral(true).WithDefaultStderrLogFile().Validate(); !IsValidationError(err) {
+		t.Errorf("ephemeral with the default stderr log file: Validate() = %v, want ValidationError", err)
+	}
+}
+
+// TestValidateOptionValues tests that Validate rejects invalid values of
+// options that are otherwise only checked when used.
+func TestValidateOptionValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  *ClaudeAgentOptions
+		field string // Empty when the options are valid
+	}{
+		{"model fallbacks", NewClaudeAgentOptions().WithModelFallbacks("sonnet", "claude-haiku-4-5"), ""},
+		{"empty model fallback", NewClaudeAgentOptions().WithModelFallbacks("sonnet", ""), "model_fallbacks[1]"},
+		{"model fallback with whitespace", NewClaudeAgentOptions().WithModelFallbacks("claude haiku"), "model_fallbacks[0]"},
+		{"echoed user messages", NewClaudeAgentOptions().WithEchoedUserMessages(EchoedUserMessagesExclude), ""},
+		{"unknown echoed user messages", NewClaudeAgentOptions().WithEchoedUserMessages("none"), "echoed_user_messages"},
+		{"setting sources", NewClaudeAgentOptions().WithSettingSources(SettingSourceUser, SettingSourceLocal), ""},
+		{"unknown setting source", NewClaudeAgentOptions().WithSettingSources(SettingSourceProject, "global"), "setting_sources"},
+		{"budget", NewClaudeAgentOptions().WithMaxBudgetUSD(0), ""},
+		{"negative budget", NewClaudeAgentOptions().WithMaxBudgetUSD(-1), "max_budget_usd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var optsErr *OptionsValidationError
+			if !errors.As(err, &optsErr) || !reflect.DeepEqual(optsErr.Fields(), []string{tt.field}) {
+				t.Errorf("Validate() = %v, want a violation of %s", err, tt.field)
+			}
+		})
+	}
+}
+
+// TestWithSystemPromptPresetClaude tests the claude_code preset convenience builder.
+func TestWithSystemPromptPresetClaude(t *testing.T) {
+	opts := NewClaudeAgentOptions().WithSystemPromptPresetClaude("Be brief.")
+	preset, ok := opts.SystemPrompt.(SystemPromptPreset)
+	if !ok || preset.Type != "preset" || preset.Preset != "claude_code" || preset.Append == nil || *preset.Append != "Be brief." {
+		t.Errorf("unexpected system prompt: %#v", opts.SystemPrompt)
+	}
+
+	opts.WithSystemPromptPresetClaude("")
+	if preset := opts.SystemPrompt.(SystemPromptPreset); preset.Append != nil {
+		t.Errorf("empty append should leave Append nil, got %q", *preset.Append)
+	}
+}
@@ -0,0 +1,76 @@
+package types
+
+import "fmt"
+
+// QueryOverrides changes session settings for a query sent with
+// Client.QueryWithOptions. Nil fields keep the session's current value.
+//
+// Only settings the CLI can change in a running session are offered. The
+// others are command-line flags of the CLI process and need a new client:
+// tools, MCP servers, the system prompt, agents, plugins, the working
+// directory, the environment, MaxTurns, MaxBudgetUSD and
+// IncludePartialMessages.
+type QueryOverrides struct {
+	PermissionMode    *PermissionMode
+	Model             *string // "" selects the CLI's default
+	MaxThinkingTokens *int    // 0 disables extended thinking
+
+	// IncludePartialMessages is fixed when the CLI starts, so it may only
+	// restate the client's option; it cannot change mid-session
+	IncludePartialMessages *bool
+
+	// Restore puts the overridden settings back once the query's
+	// ResultMessage has been received
+	Restore bool
+}
+
+// NewQueryOverrides creates QueryOverrides that change nothing.
+func NewQueryOverrides() *QueryOverrides {
+	return &QueryOverrides{}
+}
+
+// WithPermissionMode sets the permission mode for the query.
+func (o *QueryOverrides) WithPermissionMode(mode PermissionMode) *QueryOverrides {
+	o.PermissionMode = &mode
+	return o
+}
+
+// WithModel sets the model for the query; "" selects the CLI's default.
+func (o *QueryOverrides) WithModel(model string) *QueryOverrides {
+	o.Model = &model
+	return o
+}
+
+// WithMaxThinkingTokens sets the extended thinking limit for the query; 0
+// disables extended thinking.
+func (o *QueryOverrides) WithMaxThinkingTokens(maxTokens int) *QueryOverrides {
+	o.MaxThinkingTokens = &maxTokens
+	return o
+}
+
+// WithIncludePartialMessages restates whether partial messages are delivered,
+// which must match the client's option.
+func (o *QueryOverrides) WithIncludePartialMessages(include bool) *QueryOverrides {
+	o.IncludePartialMessages = &include
+	return o
+}
+
+// WithRestore puts the overridden settings back once the query's turn
+// completes, instead of keeping them for the rest of the session.
+func (o *QueryOverrides) WithRestore() *QueryOverrides {
+	o.Restore = true
+	return o
+}
+
+// Validate checks the overrides on their own, returning a *ValidationError
+// naming the first invalid field.
+func (o *QueryOverrides) Validate() error {
+	if o.PermissionMode != nil && !o.PermissionMode.IsValid() {
+		return NewValidationError("permission_mode",
+			fmt.Sprintf("%q is not a permission mode (default, acceptEdits, plan, bypassPermissions)", *o.PermissionMode))
+	}
+	if o.MaxThinkingTokens != nil && *o.MaxThinkingTokens < 0 {
+		return NewValidationError("max_thinking_tokens", fmt.Sprintf("must not be negative, got %d", *o.MaxThinkingTokens))
+	}
+	return nil
+}
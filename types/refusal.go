@@ -0,0 +1,104 @@
+package types
+
+import "strings"
+
+// RefusalClassifierFunc reports whether the text of a turn's final answer is a
+// refusal. It complements the refusal stop reason, which not every model or
+// CLI version reports. See DetectRefusal.
+type RefusalClassifierFunc func(text string) bool
+
+// refusalOpenings are phrases that open a refusal. They are only matched at the
+// start of an answer, so answers that mention them in passing are not refusals.
+var refusalOpenings = []string{
+	"i can't help with",
+	"i cannot help with",
+	"i can't assist with",
+	"i cannot assist with",
+	"i can't provide",
+	"i cannot provide",
+	"i'm not able to help",
+	"i am not able to help",
+	"i'm unable to help",
+	"i am unable to help",
+	"i won't be able to help",
+	"i'm not going to help",
+	"i must decline",
+	"i have to decline",
+	"sorry, but i can't",
+	"sorry, but i cannot",
+	"i'm sorry, but i can't",
+	"i'm sorry, but i cannot",
+}
+
+// DefaultRefusalClassifier is the classifier used when none is configured. It
+// matches answers opening with a common refusal phrase such as "I can't help
+// with that". It is deliberately conservative; pipelines that see false
+// positives or missed refusals should configure their own classifier.
+func DefaultRefusalClassifier(text string) bool {
+	opening := strings.ToLower(strings.TrimSpace(text))
+	opening = strings.ReplaceAll(opening, "’", "'")
+	for _, phrase := range refusalOpenings {
+		if strings.HasPrefix(opening, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectRefusal reports whether the model declined the request in a completed
+// turn, returning the refusal as a *RefusalError, or nil. A turn is refused
+// when an assistant message has the refusal stop reason, or when classifier
+// matches the text of the final answer. A nil classifier means
+// DefaultRefusalClassifier; pass one that always returns false to rely on the
+// stop reason alone.
+//
+// Messages of subagents are ignored, and turns ending with an error result are
+// never refusals: their error is reported separately.
+func DetectRefusal(messages []Message, classifier RefusalClassifierFunc) *RefusalError {
+	if classifier == nil {
+		classifier = DefaultRefusalClassifier
+	}
+
+	var refusal *RefusalError
+	var answer string
+	var sessionID string
+	for _, msg := range messages {
+		switch m := msg.(type) {
+		case *AssistantMessage:
+			if m.ParentToolUseID != nil {
+				continue
+			}
+			text := assistantText(m)
+			if m.IsRefusal() && refusal == nil {
+				refusal = NewRefusalError(RefusalByStopReason, text)
+			}
+			if text != "" {
+				answer = text
+			}
+		case *ResultMessage:
+			if m.IsError {
+				return nil
+			}
+			sessionID = m.SessionID
+		}
+	}
+
+	if refusal == nil && answer != "" && classifier(answer) {
+		refusal = NewRefusalError(RefusalByClassifier, answer)
+	}
+	if refusal != nil {
+		refusal.SessionID = sessionID
+	}
+	return refusal
+}
+
+// assistantText concatenates the text blocks of an assistant message.
+func assistantText(m *AssistantMessage) string {
+	var text strings.Builder
+	for _, block := range m.Content {
+		if tb, ok := block.(*TextBlock); ok {
+			text.WriteString(tb.Text)
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,108 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// refusalTurn parses a turn from JSON lines as received from the CLI.
+func refusalTurn(t *testing.T, lines ...string) []Message {
+	t.Helper()
+	var messages []Message
+	for _, line := range lines {
+		msg, err := UnmarshalMessage([]byte(line))
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func assistantLine(stopReason, text string) string {
+	return fmt.Sprintf(`{"type":"assistant","message":{"model":"m","stop_reason":%q,"content":[{"type":"text","text":%q}]}}`, stopReason, text)
+}
+
+const successLine = `{"type":"result","subtype":"success","is_error":false,"session_id":"s-1"}`
+
+func TestDetectRefusal(t *testing.T) {
+	tests := []struct {
+		name       string
+		lines      []string
+		classifier RefusalClassifierFunc
+		want       RefusalSource // "" for no refusal
+	}{
+		{
+			name:  "refusal stop reason",
+			lines: []string{assistantLine("refusal", "This request violates the usage policy."), successLine},
+			want:  RefusalByStopReason,
+		},
+		{
+			name:  "refusal text without stop reason",
+			lines: []string{assistantLine("end_turn", "I’m sorry, but I can’t help with creating malware."), successLine},
+			want:  RefusalByClassifier,
+		},
+		{
+			name: "refusal after tool use",
+			lines: []string{
+				`{"type":"assistant","message":{"model":"m","stop_reason":"tool_use","content":[{"type":"tool_use","id":"t1","name":"Read","input":{}}]}}`,
+				assistantLine("end_turn", "I must decline to modify these credentials."),
+				successLine,
+			},
+			want: RefusalByClassifier,
+		},
+		{
+			name:  "normal answer",
+			lines: []string{assistantLine("end_turn", "The build passes; I updated go.mod."), successLine},
+		},
+		{
+			name:  "refusal phrase mentioned in passing",
+			lines: []string{assistantLine("end_turn", "The error means the linter can't help with generated files, so I excluded them."), successLine},
+		},
+		{
+			name: "only a subagent refused",
+			lines: []string{
+				`{"type":"assistant","parent_tool_use_id":"task1","message":{"model":"m","stop_reason":"refusal","content":[{"type":"text","text":"I can't help with that."}]}}`,
+				assistantLine("end_turn", "The reviewer declined, so I reviewed the change myself."),
+				successLine,
+			},
+		},
+		{
+			name:  "error result",
+			lines: []string{assistantLine("end_turn", "I can't help with that."), `{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"s-1"}`},
+		},
+		{
+			name:       "false positive suppressed by classifier",
+			lines:      []string{assistantLine("end_turn", "I cannot provide a faster algorithm: this one is already optimal."), successLine},
+			classifier: func(text string) bool { return !strings.Contains(text, "algorithm") && DefaultRefusalClassifier(text) },
+		},
+		{
+			name:       "domain refusal found by classifier",
+			lines:      []string{assistantLine("end_turn", "That falls outside what this assistant covers."), successLine},
+			classifier: func(text string) bool { return strings.Contains(text, "outside what this assistant covers") },
+			want:       RefusalByClassifier,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refusal := DetectRefusal(refusalTurn(t, tt.lines...), tt.classifier)
+			if tt.want == "" {
+				if refusal != nil {
+					t.Fatalf("DetectRefusal() = %v, want no refusal", refusal)
+				}
+				return
+			}
+			if refusal == nil || refusal.Source != tt.want {
+				t.Fatalf("DetectRefusal() = %v, want a refusal by %s", refusal, tt.want)
+			}
+			if refusal.SessionID != "s-1" || refusal.Text == "" {
+				t.Errorf("refusal should carry the session and answer: %+v", refusal)
+			}
+			if !IsRefusalError(fmt.Errorf("turn 1: %w", refusal)) {
+				t.Error("IsRefusalError should match a wrapped RefusalError")
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package types
+
+import "strings"
+
+// DefaultToolAliases maps historical or alternate tool names used by older CLI
+// versions and protocols to the canonical names used by current CLI versions.
+// Entries set via ClaudeAgentOptions.WithToolAliases take precedence.
+var DefaultToolAliases = map[string]string{
+	"str_replace_editor":          "Edit",
+	"str_replace_based_edit_tool": "Edit",
+	"multi_edit":                  "MultiEdit",
+	"create_file":                 "Write",
+	"view":                        "Read",
+	"read_file":                   "Read",
+	"write_file":                  "Write",
+	"list_directory":              "LS",
+	"bash_tool":                   "Bash",
+	"web_fetch":                   "WebFetch",
+	"web_search":                  "WebSearch",
+	"dispatch_agent":              "Task",
+}
+
+// canonicalToolNames lists the built-in tools of current CLI versions, used to
+// normalize names that differ only in case (e.g. "bash" vs "Bash").
+var canonicalToolNames = []string{
+	"Bash", "BashOutput", "Edit", "ExitPlanMode", "Glob", "Grep", "KillShell", "LS",
+	"MultiEdit", "NotebookEdit", "NotebookRead", "Read", "Task", "TodoWrite",
+	"WebFetch", "WebSearch", "Write",
+}
+
+// NormalizeToolName maps a tool name reported by the CLI to its canonical form.
+//
+// Lookup order: aliases (user-supplied overrides, where "" disables a built-in
+// alias), DefaultToolAliases, then a case-insensitive match against the built-in
+// tool names. MCP tools ("mcp__server__tool") only have their prefix case
+// normalized. Unknown names are returned unchanged.
+func NormalizeToolName(name string, aliases map[string]string) string {
+	if canonical, ok := aliases[name]; ok {
+		if canonical != "" {
+			return canonical
+		}
+	} else if canonical, ok := DefaultToolAliases[name]; ok {
+		return canonical
+	}
+	if len(name) > len("mcp__") && strings.EqualFold(name[:len("mcp__")], "mcp__") {
+		return "mcp__" + name[len("mcp__"):]
+	}
+	for _, canonical := range canonicalToolNames {
+		if strings.EqualFold(name, canonical) {
+			return canonical
+		}
+	}
+	return name
+}
+
+// MergeToolAliases returns DefaultToolAliases with overrides applied on top.
+// An override mapping to "" removes the built-in alias.
+func MergeToolAliases(overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(DefaultToolAliases)+len(overrides))
+	for alias, canonical := range DefaultToolAliases {
+		merged[alias] = canonical
+	}
+	for alias, canonical := range overrides {
+		if canonical == "" {
+			delete(merged, alias)
+			continue
+		}
+		merged[alias] = canonical
+	}
+	return merged
+}
@@ -0,0 +1,47 @@
+package types
+
+import "testing"
+
+func TestNormalizeToolName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		aliases map[string]string
+		want    string
+	}{
+		{"canonical unchanged", "Edit", nil, "Edit"},
+		{"built-in alias", "str_replace_editor", nil, "Edit"},
+		{"case difference", "bash", nil, "Bash"},
+		{"mcp prefix case", "MCP__github__create_issue", nil, "mcp__github__create_issue"},
+		{"mcp tool unchanged", "mcp__github__create_issue", nil, "mcp__github__create_issue"},
+		{"unknown passes through", "FrobnicateTool", nil, "FrobnicateTool"},
+		{"user alias", "shell", map[string]string{"shell": "Bash"}, "Bash"},
+		{"user alias overrides built-in", "view", map[string]string{"view": "NotebookRead"}, "NotebookRead"},
+		{"built-in alias disabled", "view", map[string]string{"view": ""}, "view"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeToolName(tt.input, tt.aliases); got != tt.want {
+				t.Errorf("NormalizeToolName(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeToolAliases(t *testing.T) {
+	merged := MergeToolAliases(map[string]string{"shell": "Bash", "view": ""})
+
+	if merged["shell"] != "Bash" {
+		t.Errorf("expected user alias to be added, got %q", merged["shell"])
+	}
+	if _, ok := merged["view"]; ok {
+		t.Error("expected disabled built-in alias to be removed")
+	}
+	if merged["str_replace_editor"] != "Edit" {
+		t.Error("expected built-in aliases to be kept")
+	}
+	if _, ok := DefaultToolAliases["shell"]; ok {
+		t.Error("MergeToolAliases must not modify DefaultToolAliases")
+	}
+}
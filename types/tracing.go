@@ -0,0 +1,183 @@
+package types
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// Span names used by the SDK's tracing instrumentation (see WithSpanSink).
+const (
+	SpanTurn           = "claude.turn"            // A query, from sending the prompt to its ResultMessage
+	SpanToolUse        = "claude.tool_use"        // A tool use, from the ToolUseBlock to its ToolResultBlock
+	SpanPermission     = "claude.permission"      // A CanUseTool callback answering a permission request
+	SpanHook           = "claude.hook"            // A hook callback invocation
+	SpanControlRequest = "claude.control_request" // A control request sent to the CLI, until it is answered
+)
+
+// Attribute keys set on SDK spans. Every span carries session ID, turn ID and
+// outcome; the others are set where they apply.
+const (
+	SpanAttrSessionID = "session_id" // Session ID, "" before the CLI announced it
+	SpanAttrTurnID    = "turn_id"    // 1-based number of the turn within the connection, 0 outside a turn
+	SpanAttrOutcome   = "outcome"    // How the span ended, set just before End
+	SpanAttrToolName  = "tool_name"  // Canonical tool name
+	SpanAttrToolUseID = "tool_use_id"
+	SpanAttrHookEvent = "hook_event" // Hook event name, e.g. PreToolUse
+	SpanAttrSubtype   = "subtype"    // Control request subtype
+)
+
+// Span outcomes set under SpanAttrOutcome. A turn ends with the subtype of its
+// ResultMessage instead, e.g. "success" or "error_max_turns".
+const (
+	SpanOutcomeSuccess  = "success"   // Completed without error
+	SpanOutcomeError    = "error"     // Failed; End receives the error
+	SpanOutcomeAllow    = "allow"     // Permission granted
+	SpanOutcomeDeny     = "deny"      // Permission denied
+	SpanOutcomeNoResult = "no_result" // The turn ended before the tool returned
+	SpanOutcomeClosed   = "closed"    // The connection closed first
+)
+
+// SpanSink receives the spans of a session's lifecycles: turns, tool uses,
+// permission requests, hook callbacks and control requests. It is a small
+// adapter point for tracing systems such as OpenTelemetry, which the SDK does
+// not depend on.
+//
+// Spans nested in another span (tool uses in a turn, permission requests and
+// hooks in a tool use, control requests in a turn) are started through the
+// parent's SpanHandle when it also implements SpanSink, and through the sink
+// otherwise. Implementations must be safe for concurrent use: callbacks run on
+// their own goroutines while the message loop starts and ends spans.
+type SpanSink interface {
+	StartSpan(name string, attrs map[string]interface{}) SpanHandle
+}
+
+// SpanHandle is a span started by a SpanSink.
+type SpanHandle interface {
+	// SetAttribute adds or replaces an attribute, such as the outcome.
+	SetAttribute(key string, value interface{})
+
+	// End finishes the span. err is non-nil when the operation failed.
+	End(err error)
+}
+
+// NoopSpanSink discards every span.
+type NoopSpanSink struct{}
+
+// StartSpan returns a handle that ignores attributes and End.
+func (NoopSpanSink) StartSpan(string, map[string]interface{}) SpanHandle { return noopSpan{} }
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) End(error)                        {}
+
+// RecordedSpan is a span captured by a MemorySpanSink.
+type RecordedSpan struct {
+	ID         int // 1-based, in start order
+	ParentID   int // ID of the enclosing span, 0 for a root span
+	Name       string
+	Attributes map[string]interface{}
+	Start      time.Time
+	End        time.Time // Zero until the span ends
+	Ended      bool
+	Err        error
+}
+
+// MemorySpanSink records spans in memory, for tests and debugging. Its
+// handles implement SpanSink, so the parent of each span is recorded.
+type MemorySpanSink struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// NewMemorySpanSink returns an empty MemorySpanSink.
+func NewMemorySpanSink() *MemorySpanSink {
+	return &MemorySpanSink{}
+}
+
+// StartSpan records a root span.
+func (s *MemorySpanSink) StartSpan(name string, attrs map[string]interface{}) SpanHandle {
+	return s.start(0, name, attrs)
+}
+
+// Spans returns copies of the recorded spans in start order.
+func (s *MemorySpanSink) Spans() []RecordedSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	spans := make([]RecordedSpan, len(s.spans))
+	for i, span := range s.spans {
+		spans[i] = *span
+		spans[i].Attributes = maps.Clone(span.Attributes)
+	}
+	return spans
+}
+
+// Children returns copies of the spans started inside the span with the given
+// ID, in start order. ID 0 returns the root spans.
+func (s *MemorySpanSink) Children(id int) []RecordedSpan {
+	var children []RecordedSpan
+	for _, span := range s.Spans() {
+		if span.ParentID == id {
+			children = append(children, span)
+		}
+	}
+	return children
+}
+
+func (s *MemorySpanSink) start(parent int, name string, attrs map[string]interface{}) SpanHandle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := &RecordedSpan{
+		ID:         len(s.spans) + 1,
+		ParentID:   parent,
+		Name:       name,
+		Attributes: maps.Clone(attrs),
+		Start:      time.Now(),
+	}
+	if span.Attributes == nil {
+		span.Attributes = make(map[string]interface{})
+	}
+	s.spans = append(s.spans, span)
+	return &memorySpan{sink: s, span: span}
+}
+
+// memorySpan is the handle of a RecordedSpan.
+type memorySpan struct {
+	sink *MemorySpanSink
+	span *RecordedSpan
+}
+
+// StartSpan records a span nested in this one.
+func (h *memorySpan) StartSpan(name string, attrs map[string]interface{}) SpanHandle {
+	return h.sink.start(h.span.ID, name, attrs)
+}
+
+func (h *memorySpan) SetAttribute(key string, value interface{}) {
+	h.sink.mu.Lock()
+	defer h.sink.mu.Unlock()
+	h.span.Attributes[key] = value
+}
+
+func (h *memorySpan) End(err error) {
+	h.sink.mu.Lock()
+	defer h.sink.mu.Unlock()
+	if h.span.Ended {
+		return
+	}
+	h.span.End = time.Now()
+	h.span.Ended = true
+	h.span.Err = err
+}
+
+// ProtocolTracer receives the raw JSON lines exchanged with the CLI, in the
+// order they are written and read, without their trailing newlines. It sees
+// everything on the wire, including control traffic, so a recording can be
+// replayed. A sent line is traced just before it is written, so that it
+// always precedes the CLI's answer; a line whose write fails is traced too.
+// line must not be retained after the call returns. Implementations must be
+// safe for concurrent use: lines are written and read on different goroutines.
+type ProtocolTracer interface {
+	TraceSent(line []byte)
+	TraceReceived(line []byte)
+}
@@ -0,0 +1,43 @@
+package types
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemorySpanSink(t *testing.T) {
+	sink := NewMemorySpanSink()
+	turn := sink.StartSpan(SpanTurn, map[string]interface{}{SpanAttrTurnID: 1})
+	tool := turn.(SpanSink).StartSpan(SpanToolUse, map[string]interface{}{SpanAttrToolName: "Bash"})
+	tool.SetAttribute(SpanAttrOutcome, SpanOutcomeError)
+	failed := errors.New("exit 1")
+	tool.End(failed)
+	tool.End(nil) // Ending again is ignored
+
+	spans := sink.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].ParentID != 0 || spans[1].ParentID != spans[0].ID {
+		t.Errorf("tool use should nest in the turn: %+v", spans)
+	}
+	if spans[0].Ended {
+		t.Error("turn span should still be open")
+	}
+	if !spans[1].Ended || spans[1].Err != failed || spans[1].Attributes[SpanAttrOutcome] != SpanOutcomeError {
+		t.Errorf("tool span = %+v, want ended with the error and outcome", spans[1])
+	}
+
+	// Spans returns copies
+	spans[1].Attributes[SpanAttrToolName] = "Read"
+	if got := sink.Children(spans[0].ID)[0].Attributes[SpanAttrToolName]; got != "Bash" {
+		t.Errorf("tool_name = %v after modifying a copy, want Bash", got)
+	}
+}
+
+func TestNoopSpanSink(t *testing.T) {
+	var sink SpanSink = NoopSpanSink{}
+	span := sink.StartSpan(SpanTurn, nil)
+	span.SetAttribute(SpanAttrOutcome, SpanOutcomeSuccess)
+	span.End(nil)
+}
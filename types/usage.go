@@ -0,0 +1,225 @@
+package types
+
+import "time"
+
+// CacheEfficiency summarizes prompt cache use and the number of model requests
+// behind one or more results.
+//
+// Values come from ResultMessage.Usage and NumTurns; fields the CLI does not
+// report are left at zero.
+type CacheEfficiency struct {
+	InputTokens         int // Uncached input tokens
+	CacheReadTokens     int // Input tokens read from the prompt cache
+	CacheCreationTokens int // Input tokens written to the prompt cache
+	ModelRequests       int // Model API requests (one per agent turn)
+	ServerToolRequests  int // Server-side tool requests, such as web searches
+}
+
+// CacheEfficiencyFromResult extracts the cache and request counts of a result.
+// A nil result or one without usage yields a zero value.
+func CacheEfficiencyFromResult(result *ResultMessage) CacheEfficiency {
+	if result == nil {
+		return CacheEfficiency{}
+	}
+
+	c := CacheEfficiency{
+		InputTokens:         usageInt(result.Usage, "input_tokens"),
+		CacheReadTokens:     usageInt(result.Usage, "cache_read_input_tokens"),
+		CacheCreationTokens: usageInt(result.Usage, "cache_creation_input_tokens"),
+		ModelRequests:       result.NumTurns,
+	}
+	if serverTools, ok := result.Usage["server_tool_use"].(map[string]interface{}); ok {
+		for key := range serverTools {
+			c.ServerToolRequests += usageInt(serverTools, key)
+		}
+	}
+	return c
+}
+
+// TotalInputTokens returns all input tokens, cached or not.
+func (c CacheEfficiency) TotalInputTokens() int {
+	return c.InputTokens + c.CacheReadTokens + c.CacheCreationTokens
+}
+
+// HitRatio returns the fraction of input tokens read from the prompt cache, or
+// 0 when no input tokens were reported.
+func (c CacheEfficiency) HitRatio() float64 {
+	total := c.TotalInputTokens()
+	if total == 0 {
+		return 0
+	}
+	return float64(c.CacheReadTokens) / float64(total)
+}
+
+// Add returns the sum of c and other.
+func (c CacheEfficiency) Add(other CacheEfficiency) CacheEfficiency {
+	return CacheEfficiency{
+		InputTokens:         c.InputTokens + other.InputTokens,
+		CacheReadTokens:     c.CacheReadTokens + other.CacheReadTokens,
+		CacheCreationTokens: c.CacheCreationTokens + other.CacheCreationTokens,
+		ModelRequests:       c.ModelRequests + other.ModelRequests,
+		ServerToolRequests:  c.ServerToolRequests + other.ServerToolRequests,
+	}
+}
+
+// usageInt reads a numeric usage field, returning 0 when it is absent or not a number.
+func usageInt(usage map[string]interface{}, key string) int {
+	switch v := usage[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+// thinkingCharsPerToken is the rough ratio used to estimate thinking tokens
+// from the length of thinking blocks.
+const thinkingCharsPerToken = 4
+
+// ThinkingUsage splits output tokens between visible output and extended
+// thinking, for tuning MaxThinkingTokens against what it costs.
+//
+// ThinkingTokens comes from the usage's output_tokens_details.thinking_tokens
+// when the CLI reports it. Otherwise it is estimated from the length of the
+// ThinkingBlocks received and Estimated is set; the estimate is rough, and low
+// when the model returns summarized thinking.
+type ThinkingUsage struct {
+	OutputTokens   int  // All output tokens, visible and thinking
+	ThinkingTokens int  // Output tokens attributed to extended thinking
+	Estimated      bool // ThinkingTokens is (partly) estimated rather than reported
+}
+
+// ThinkingUsageFromResult extracts the thinking split of a result.
+// thinkingChars is the length of the thinking blocks of the result's turn,
+// used for the estimate when the usage has no thinking breakdown. A nil
+// result yields a zero value.
+func ThinkingUsageFromResult(result *ResultMessage, thinkingChars int) ThinkingUsage {
+	if result == nil {
+		return ThinkingUsage{}
+	}
+
+	u := ThinkingUsage{OutputTokens: usageInt(result.Usage, "output_tokens")}
+	if details, ok := result.Usage["output_tokens_details"].(map[string]interface{}); ok {
+		if _, reported := details["thinking_tokens"]; reported {
+			u.ThinkingTokens = usageInt(details, "thinking_tokens")
+			return u
+		}
+	}
+	if thinkingChars > 0 {
+		u.ThinkingTokens = (thinkingChars + thinkingCharsPerToken - 1) / thinkingCharsPerToken
+		if u.OutputTokens > 0 && u.ThinkingTokens > u.OutputTokens {
+			u.ThinkingTokens = u.OutputTokens
+		}
+		u.Estimated = true
+	}
+	return u
+}
+
+// VisibleTokens returns the output tokens not spent on thinking.
+func (u ThinkingUsage) VisibleTokens() int {
+	return max(u.OutputTokens-u.ThinkingTokens, 0)
+}
+
+// ThinkingShare returns the fraction of output tokens spent on thinking, or 0
+// when no output tokens were reported.
+func (u ThinkingUsage) ThinkingShare() float64 {
+	if u.OutputTokens == 0 {
+		return 0
+	}
+	return float64(u.ThinkingTokens) / float64(u.OutputTokens)
+}
+
+// Add returns the sum of u and other, estimated if either is.
+func (u ThinkingUsage) Add(other ThinkingUsage) ThinkingUsage {
+	return ThinkingUsage{
+		OutputTokens:   u.OutputTokens + other.OutputTokens,
+		ThinkingTokens: u.ThinkingTokens + other.ThinkingTokens,
+		Estimated:      u.Estimated || other.Estimated,
+	}
+}
+
+// ThinkingChars returns the length of the thinking blocks of an assistant
+// message, or 0 for other messages.
+func ThinkingChars(msg Message) int {
+	assistant, ok := msg.(*AssistantMessage)
+	if !ok {
+		return 0
+	}
+	n := 0
+	for _, block := range assistant.Content {
+		if thinking, ok := block.(*ThinkingBlock); ok {
+			n += len(thinking.Thinking)
+		}
+	}
+	return n
+}
+
+// SessionUsage is the usage summed over the results of a session.
+type SessionUsage struct {
+	Cache    CacheEfficiency // Prompt cache use and request counts
+	Thinking ThinkingUsage   // Output tokens split between visible output and thinking
+}
+
+// Add returns the sum of s and other.
+func (s SessionUsage) Add(other SessionUsage) SessionUsage {
+	return SessionUsage{
+		Cache:    s.Cache.Add(other.Cache),
+		Thinking: s.Thinking.Add(other.Thinking),
+	}
+}
+
+// SessionStats accumulates the results observed by a client, for billing and
+// dashboards. See Client.Stats.
+type SessionStats struct {
+	Queries         int                   // Queries that ended with a result
+	Turns           int                   // Agent turns reported by the results
+	CostUSD         float64               // Cost reported by the results
+	UnpricedResults int                   // Results without a reported cost, not included in CostUSD
+	Duration        time.Duration         // Wall-clock duration reported by the results
+	APIDuration     time.Duration         // Time spent in API requests reported by the results
+	Models          map[string]ModelUsage // Usage by the model that produced each result ("" when unknown)
+}
+
+// ModelUsage is the usage of the results produced by one model.
+type ModelUsage struct {
+	Results             int     // Results attributed to the model
+	InputTokens         int     // Uncached input tokens
+	OutputTokens        int     // Output tokens, including thinking
+	CacheReadTokens     int     // Input tokens read from the prompt cache
+	CacheCreationTokens int     // Input tokens written to the prompt cache
+	CostUSD             float64 // Cost reported by the results
+}
+
+// ModelUsageFromResult extracts the token usage and cost of a result, counted
+// as one result. A nil result yields a zero value.
+func ModelUsageFromResult(result *ResultMessage) ModelUsage {
+	if result == nil {
+		return ModelUsage{}
+	}
+	u := ModelUsage{
+		Results:             1,
+		InputTokens:         usageInt(result.Usage, "input_tokens"),
+		OutputTokens:        usageInt(result.Usage, "output_tokens"),
+		CacheReadTokens:     usageInt(result.Usage, "cache_read_input_tokens"),
+		CacheCreationTokens: usageInt(result.Usage, "cache_creation_input_tokens"),
+	}
+	if result.TotalCostUSD != nil {
+		u.CostUSD = *result.TotalCostUSD
+	}
+	return u
+}
+
+// Add returns the sum of u and other.
+func (u ModelUsage) Add(other ModelUsage) ModelUsage {
+	return ModelUsage{
+		Results:             u.Results + other.Results,
+		InputTokens:         u.InputTokens + other.InputTokens,
+		OutputTokens:        u.OutputTokens + other.OutputTokens,
+		CacheReadTokens:     u.CacheReadTokens + other.CacheReadTokens,
+		CacheCreationTokens: u.CacheCreationTokens + other.CacheCreationTokens,
+		CostUSD:             u.CostUSD + other.CostUSD,
+	}
+}
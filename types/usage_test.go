@@ -0,0 +1,135 @@
+package types
+
+import "testing"
+
+// TestCacheEfficiencyFromResult tests cache metrics for high, zero and absent cache usage.
+func TestCacheEfficiencyFromResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		result    *ResultMessage
+		want      CacheEfficiency
+		wantRatio float64
+	}{
+		{
+			name: "high cache reads",
+			result: &ResultMessage{NumTurns: 4, Usage: map[string]interface{}{
+				"input_tokens":                float64(200),
+				"cache_read_input_tokens":     float64(9500),
+				"cache_creation_input_tokens": float64(300),
+				"output_tokens":               float64(120),
+				"server_tool_use":             map[string]interface{}{"web_search_requests": float64(1), "web_fetch_requests": float64(2)},
+			}},
+			want:      CacheEfficiency{InputTokens: 200, CacheReadTokens: 9500, CacheCreationTokens: 300, ModelRequests: 4, ServerToolRequests: 3},
+			wantRatio: 0.95,
+		},
+		{
+			name: "zero cache reads",
+			result: &ResultMessage{NumTurns: 1, Usage: map[string]interface{}{
+				"input_tokens":                float64(1500),
+				"cache_read_input_tokens":     float64(0),
+				"cache_creation_input_tokens": float64(500),
+			}},
+			want: CacheEfficiency{InputTokens: 1500, CacheCreationTokens: 500, ModelRequests: 1},
+		},
+		{
+			name:   "no usage",
+			result: &ResultMessage{NumTurns: 2},
+			want:   CacheEfficiency{ModelRequests: 2},
+		},
+		{
+			name:   "malformed fields",
+			result: &ResultMessage{Usage: map[string]interface{}{"input_tokens": "lots", "server_tool_use": "none"}},
+		},
+		{
+			name: "nil result",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CacheEfficiencyFromResult(tt.result)
+			if got != tt.want {
+				t.Errorf("CacheEfficiencyFromResult() = %+v, want %+v", got, tt.want)
+			}
+			if ratio := got.HitRatio(); ratio != tt.wantRatio {
+				t.Errorf("HitRatio() = %v, want %v", ratio, tt.wantRatio)
+			}
+		})
+	}
+}
+
+// TestCacheEfficiencyAdd tests that per-turn values sum into a session total.
+func TestCacheEfficiencyAdd(t *testing.T) {
+	first := CacheEfficiency{InputTokens: 1000, CacheCreationTokens: 1000, ModelRequests: 1}
+	second := CacheEfficiency{InputTokens: 100, CacheReadTokens: 1900, ModelRequests: 2, ServerToolRequests: 1}
+
+	total := first.Add(second)
+	want := CacheEfficiency{InputTokens: 1100, CacheReadTokens: 1900, CacheCreationTokens: 1000, ModelRequests: 3, ServerToolRequests: 1}
+	if total != want {
+		t.Errorf("Add() = %+v, want %+v", total, want)
+	}
+	if total.TotalInputTokens() != 4000 || total.HitRatio() != 0.475 {
+		t.Errorf("TotalInputTokens() = %d, HitRatio() = %v", total.TotalInputTokens(), total.HitRatio())
+	}
+}
+
+// TestThinkingUsageFromResult tests the thinking split with and without a
+// reported breakdown.
+func TestThinkingUsageFromResult(t *testing.T) {
+	tests := []struct {
+		name          string
+		result        *ResultMessage
+		thinkingChars int
+		want          ThinkingUsage
+	}{
+		{
+			name: "reported breakdown",
+			result: &ResultMessage{Usage: map[string]interface{}{
+				"output_tokens":         float64(1000),
+				"output_tokens_details": map[string]interface{}{"thinking_tokens": float64(600)},
+			}},
+			thinkingChars: 40, // Ignored when the CLI reports the breakdown
+			want:          ThinkingUsage{OutputTokens: 1000, ThinkingTokens: 600},
+		},
+		{
+			name:          "estimated from thinking blocks",
+			result:        &ResultMessage{Usage: map[string]interface{}{"output_tokens": float64(1000)}},
+			thinkingChars: 1601,
+			want:          ThinkingUsage{OutputTokens: 1000, ThinkingTokens: 401, Estimated: true},
+		},
+		{
+			name:          "estimate capped at output tokens",
+			result:        &ResultMessage{Usage: map[string]interface{}{"output_tokens": float64(100)}},
+			thinkingChars: 4000,
+			want:          ThinkingUsage{OutputTokens: 100, ThinkingTokens: 100, Estimated: true},
+		},
+		{
+			name:   "no thinking",
+			result: &ResultMessage{Usage: map[string]interface{}{"output_tokens": float64(250)}},
+			want:   ThinkingUsage{OutputTokens: 250},
+		},
+		{
+			name: "nil result",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ThinkingUsageFromResult(tt.result, tt.thinkingChars)
+			if got != tt.want {
+				t.Errorf("ThinkingUsageFromResult() = %+v, want %+v", got, tt.want)
+			}
+			if got.VisibleTokens()+got.ThinkingTokens != got.OutputTokens {
+				t.Errorf("VisibleTokens() = %d does not complete the split", got.VisibleTokens())
+			}
+		})
+	}
+
+	total := ThinkingUsage{OutputTokens: 1000, ThinkingTokens: 600}.Add(ThinkingUsage{OutputTokens: 1000, ThinkingTokens: 200, Estimated: true})
+	if want := (ThinkingUsage{OutputTokens: 2000, ThinkingTokens: 800, Estimated: true}); total != want {
+		t.Errorf("Add() = %+v, want %+v", total, want)
+	}
+	if total.ThinkingShare() != 0.4 {
+		t.Errorf("ThinkingShare() = %v, want 0.4", total.ThinkingShare())
+	}
+}